@@ -35,13 +35,16 @@ import (
 	"proxy-enhancer-ultra/internal/handlers"
 	"proxy-enhancer-ultra/internal/middleware"
 	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/proxy"
 	"proxy-enhancer-ultra/internal/services"
+	"proxy-enhancer-ultra/internal/storage"
 	"proxy-enhancer-ultra/pkg/logger"
 
 	_ "proxy-enhancer-ultra/docs" // 导入生成的swagger文档
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/mux"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -55,6 +58,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	if err := middleware.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
 	// 初始化JWT管理器
 	jwtManager := auth.NewJWTManager(cfg.JWT.Secret, cfg.JWT.ExpiresIn)
@@ -77,14 +83,33 @@ func main() {
 		&models.Domain{},
 		&models.Rule{},
 		&models.Popup{},
+		&models.RuleProxyConfig{},
+		&models.PopupProxyConfig{},
+		&models.PopupVariant{},
+		&models.PopupTranslation{},
+		&models.PopupEvent{},
 		&models.Submission{},
+		&models.SubmissionNote{},
+		&models.DataKey{},
+		&models.File{},
+		&models.ExportJob{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.PopupNotification{},
+		&models.MailMessage{},
 		&models.ProxyLog{},
 		&models.SystemMetric{},
+		&models.AuditLog{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// 执行数据迁移
+	if err := db.RunMigrations(); err != nil {
+		log.Fatalf("Failed to run data migrations: %v", err)
+	}
+
 	// 创建默认数据
 	err = db.Seed()
 	if err != nil {
@@ -96,8 +121,53 @@ func main() {
 	proxyService := services.NewProxyService(db.DB, logger)
 	popupService := services.NewPopupService(db.DB, logger)
 	ruleService := services.NewRuleService(db.DB, logger)
-	submissionService := services.NewSubmissionService(db.DB, logger)
+	fileStorage, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+	fileService := services.NewFileService(db.DB, logger, fileStorage, cfg.Storage.WithDefaults().MaxUploadSize)
+	submissionGuard := services.NewSubmissionGuard(cfg, logger)
+	auditService := services.NewAuditService(db.DB, logger)
+	encryptionService, err := services.NewEncryptionService(db.DB, logger, cfg.Security.Encryption, cfg.FingerprintSecret(), auditService)
+	if err != nil {
+		log.Fatalf("Failed to initialize field encryption: %v", err)
+	}
+	if err := encryptionService.Load(); err != nil {
+		log.Fatalf("Failed to load data keys: %v", err)
+	}
+	webhookService := services.NewWebhookService(db.DB, logger, cfg.Webhooks, encryptionService)
+	mailService, err := services.NewMailService(db.DB, logger, cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to initialize mail service: %v", err)
+	}
+	notificationService := services.NewNotificationService(db.DB, logger, mailService, encryptionService)
+	submissionService := services.NewSubmissionService(db.DB, logger, submissionGuard, fileService, webhookService, notificationService, auditService, encryptionService)
 	monitoringService := services.NewMonitoringService(db.DB, logger)
+	exportJobService := services.NewExportJobService(db.DB, logger, fileStorage, cfg.Export, encryptionService)
+	retentionService, err := services.NewRetentionService(db.DB, logger, cfg.Retention, fileService, encryptionService, auditService)
+	if err != nil {
+		log.Fatalf("Failed to initialize retention janitor: %v", err)
+	}
+
+	// 启动弹窗排期调度器
+	popupScheduler := services.NewPopupScheduler(db.DB, logger, auditService)
+	popupScheduler.Start(services.DefaultPopupScheduleInterval)
+
+	// 启动导出任务工作协程
+	exportJobService.Start()
+
+	// 启动数据密钥轮换后的重新加密
+	encryptionService.Start()
+
+	// 启动Webhook投递工作协程
+	webhookService.Start()
+
+	// 启动邮件发送和提交汇总通知
+	mailService.Start()
+	notificationService.Start()
+
+	// 启动数据保留清理任务
+	retentionService.Start()
 
 	// 初始化处理器
 	authHandler := handlers.NewAuthHandler(userService, logger)
@@ -108,6 +178,13 @@ func main() {
 	submissionHandler := handlers.NewSubmissionHandler(submissionService, logger)
 	monitoringHandler := handlers.NewMonitoringHandler(monitoringService, logger)
 	profileHandler := handlers.NewProfileHandler(userService, logger)
+	auditHandler := handlers.NewAuditHandler(auditService, logger)
+	fileHandler := handlers.NewFileHandler(fileService, logger)
+	exportJobHandler := handlers.NewExportJobHandler(exportJobService, logger)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, logger)
+	notificationHandler := handlers.NewNotificationHandler(notificationService, mailService, logger)
+	encryptionHandler := handlers.NewEncryptionHandler(encryptionService, logger)
+	retentionHandler := handlers.NewRetentionHandler(retentionService, logger)
 
 	// 设置Gin模式（根据环境变量）
 	if cfg.IsProduction() {
@@ -134,9 +211,10 @@ func main() {
 	// 公共路由
 	auth := r.Group("/api/auth")
 	{
-		auth.POST("/login", gin.WrapF(authHandler.Login))
-		auth.POST("/register", gin.WrapF(authHandler.Register))
-		auth.POST("/refresh", gin.WrapF(authHandler.RefreshToken))
+		auth.POST("/login", wrapHandler(authHandler.Login))
+		auth.POST("/register", wrapHandler(authHandler.Register))
+		auth.POST("/refresh", wrapHandler(authHandler.RefreshToken))
+		auth.GET("/captcha", wrapHandler(submissionHandler.GetCaptcha))
 	}
 
 	// 健康检查
@@ -149,103 +227,191 @@ func main() {
 
 	// 需要认证的路由
 	protected := r.Group("/api")
-	protected.Use(func(c *gin.Context) {
-		// 将gin.Context适配为标准的http.Handler
-		handler := middleware.AuthMiddleware(jwtManager)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c.Next()
-		}))
-		handler.ServeHTTP(c.Writer, c.Request)
-		if c.IsAborted() {
-			return
-		}
-	})
+	protected.Use(wrapMiddleware(middleware.AuthMiddleware(jwtManager)))
 	{
 		// 认证相关
 		auth := protected.Group("/auth")
 		{
-			auth.POST("/logout", gin.WrapF(authHandler.Logout))
+			auth.POST("/logout", wrapHandler(authHandler.Logout))
 		}
 
 		// 用户相关
 		users := protected.Group("/users")
 		{
-			users.GET("/profile", gin.WrapF(profileHandler.GetProfile))
-			users.PUT("/profile", gin.WrapF(profileHandler.UpdateProfile))
-			users.POST("/change-password", gin.WrapF(profileHandler.ChangePassword))
+			users.GET("/profile", wrapHandler(profileHandler.GetProfile))
+			users.PUT("/profile", wrapHandler(profileHandler.UpdateProfile))
+			users.POST("/change-password", wrapHandler(profileHandler.ChangePassword))
 		}
 
 		// 代理配置
 		proxy := protected.Group("/proxy")
 		{
-			proxy.GET("/configs", gin.WrapF(proxyHandler.ListProxyConfigs))
-			proxy.POST("/configs", gin.WrapF(proxyHandler.CreateProxyConfig))
-			proxy.GET("/configs/:id", gin.WrapF(proxyHandler.GetProxyConfig))
-			proxy.PUT("/configs/:id", gin.WrapF(proxyHandler.UpdateProxyConfig))
-			proxy.DELETE("/configs/:id", gin.WrapF(proxyHandler.DeleteProxyConfig))
-			proxy.POST("/configs/:id/toggle", gin.WrapF(proxyHandler.ToggleProxyConfig))
-			proxy.GET("/configs/:id/stats", gin.WrapF(proxyHandler.GetProxyStats))
+			proxy.GET("/configs", wrapHandler(proxyHandler.ListProxyConfigs))
+			proxy.POST("/configs", wrapHandler(proxyHandler.CreateProxyConfig))
+			proxy.GET("/configs/:id", wrapHandler(proxyHandler.GetProxyConfig))
+			proxy.PUT("/configs/:id", wrapHandler(proxyHandler.UpdateProxyConfig))
+			proxy.DELETE("/configs/:id", wrapHandler(proxyHandler.DeleteProxyConfig))
+			proxy.POST("/configs/:id/toggle", wrapHandler(proxyHandler.ToggleProxyConfig))
+			proxy.GET("/configs/:id/stats", wrapHandler(proxyHandler.GetProxyStats))
 		}
 
 		// 弹窗管理
 		popups := protected.Group("/popups")
 		{
-			popups.GET("", gin.WrapF(popupHandler.ListPopups))
-			popups.POST("", gin.WrapF(popupHandler.CreatePopup))
-			popups.GET("/:id", gin.WrapF(popupHandler.GetPopup))
-			popups.PUT("/:id", gin.WrapF(popupHandler.UpdatePopup))
-			popups.DELETE("/:id", gin.WrapF(popupHandler.DeletePopup))
-			popups.POST("/:id/toggle", gin.WrapF(popupHandler.TogglePopupStatus))
-			popups.GET("/:id/stats", gin.WrapF(popupHandler.GetPopupStats))
+			popups.GET("", wrapHandler(popupHandler.ListPopups))
+			popups.POST("", wrapHandler(popupHandler.CreatePopup))
+			popups.GET("/:id", wrapHandler(popupHandler.GetPopup))
+			popups.PUT("/:id", wrapHandler(popupHandler.UpdatePopup))
+			popups.DELETE("/:id", wrapHandler(popupHandler.DeletePopup))
+			popups.POST("/:id/toggle", wrapHandler(popupHandler.TogglePopupStatus))
+			popups.GET("/:id/stats", wrapHandler(popupHandler.GetPopupStats))
+			popups.GET("/:id/performance", wrapHandler(popupHandler.GetPopupPerformance))
+			popups.GET("/:id/preview", wrapHandler(popupHandler.PreviewPopup))
+			popups.GET("/:id/translations", wrapHandler(popupHandler.ListTranslations))
+			popups.PUT("/:id/translations/:locale", wrapHandler(popupHandler.SaveTranslation))
+			popups.DELETE("/:id/translations/:locale", wrapHandler(popupHandler.DeleteTranslation))
+			popups.GET("/:id/notifications", wrapHandler(notificationHandler.GetPopupNotification))
+			popups.PUT("/:id/notifications", wrapHandler(notificationHandler.UpdatePopupNotification))
+			popups.GET("/translations/export", wrapHandler(popupHandler.ExportTranslations))
+			popups.POST("/translations/import", wrapHandler(popupHandler.ImportTranslations))
 		}
 
 		// 规则管理
 		rules := protected.Group("/rules")
 		{
-			rules.GET("", gin.WrapF(ruleHandler.ListRules))
-			rules.POST("", gin.WrapF(ruleHandler.CreateRule))
-			rules.GET("/:id", gin.WrapF(ruleHandler.GetRule))
-			rules.PUT("/:id", gin.WrapF(ruleHandler.UpdateRule))
-			rules.DELETE("/:id", gin.WrapF(ruleHandler.DeleteRule))
-			rules.POST("/:id/toggle", gin.WrapF(ruleHandler.ToggleRuleStatus))
-			rules.PUT("/priorities", gin.WrapF(ruleHandler.UpdateRulePriorities))
+			rules.GET("", wrapHandler(ruleHandler.ListRules))
+			rules.POST("", wrapHandler(ruleHandler.CreateRule))
+			rules.GET("/schema", wrapHandler(ruleHandler.GetRuleSchema))
+			rules.GET("/:id", wrapHandler(ruleHandler.GetRule))
+			rules.PUT("/:id", wrapHandler(ruleHandler.UpdateRule))
+			rules.DELETE("/:id", wrapHandler(ruleHandler.DeleteRule))
+			rules.POST("/:id/toggle", wrapHandler(ruleHandler.ToggleRuleStatus))
+			rules.PUT("/priorities", wrapHandler(ruleHandler.UpdateRulePriorities))
+			rules.POST("/dry-run", wrapHandler(ruleHandler.DryRunRules))
+			rules.POST("/:id/test", wrapHandler(ruleHandler.TestRule))
+			rules.GET("/conflicts", wrapMiddleware(middleware.AdminMiddleware), wrapHandler(ruleHandler.GetRuleConflicts))
 		}
 
 		// 提交管理
 		submissions := protected.Group("/submissions")
 		{
-			submissions.GET("", gin.WrapF(submissionHandler.ListSubmissions))
-			submissions.POST("", gin.WrapF(submissionHandler.CreateSubmission))
-			submissions.GET("/:id", gin.WrapF(submissionHandler.GetSubmission))
-			submissions.PUT("/:id", gin.WrapF(submissionHandler.UpdateSubmission))
-			submissions.DELETE("/:id", gin.WrapF(submissionHandler.DeleteSubmission))
-			submissions.GET("/export", gin.WrapF(submissionHandler.ExportSubmissions))
-			submissions.DELETE("/popup/:popup_id", gin.WrapF(submissionHandler.DeleteSubmissionsByPopup))
+			submissions.GET("", wrapHandler(submissionHandler.ListSubmissions))
+			submissions.POST("", wrapHandler(submissionHandler.CreateSubmission))
+			submissions.GET("/:id", wrapHandler(submissionHandler.GetSubmission))
+			submissions.PUT("/:id", wrapHandler(submissionHandler.UpdateSubmission))
+			submissions.DELETE("/:id", wrapHandler(submissionHandler.DeleteSubmission))
+			submissions.GET("/export", wrapHandler(submissionHandler.ExportSubmissions))
+			submissions.DELETE("/popup/:popup_id", wrapHandler(submissionHandler.DeleteSubmissionsByPopup))
+
+			// 来源归因分析
+			submissions.GET("/analytics/sources", wrapHandler(submissionHandler.GetSourceBreakdown))
+			submissions.GET("/analytics/timeseries", wrapHandler(submissionHandler.GetSourceTimeSeries))
+
+			// 线索处理
+			submissions.PATCH("/batch/processed", wrapHandler(submissionHandler.BatchUpdateSubmissionStatus))
+			submissions.PATCH("/batch/tags", wrapHandler(submissionHandler.BatchUpdateSubmissionTags))
+			submissions.PATCH("/batch/assignee", wrapHandler(submissionHandler.BatchAssignSubmissions))
+			submissions.PATCH("/:id/processed", wrapHandler(submissionHandler.UpdateSubmissionStatus))
+			submissions.PATCH("/:id/tags", wrapHandler(submissionHandler.SetSubmissionTags))
+			submissions.PATCH("/:id/assignee", wrapHandler(submissionHandler.AssignSubmission))
+			submissions.GET("/:id/notes", wrapHandler(submissionHandler.ListSubmissionNotes))
+			submissions.POST("/:id/notes", wrapHandler(submissionHandler.AddSubmissionNote))
+			submissions.GET("/:id/history", wrapHandler(submissionHandler.ListSubmissionHistory))
+
+			// 敏感字段原文，需要 submission:decrypt 权限
+			submissions.GET("/:id/decrypt", wrapHandler(submissionHandler.DecryptSubmission))
+		}
+
+		// 文件管理
+		files := protected.Group("/files")
+		{
+			files.GET("", wrapHandler(fileHandler.ListFiles))
+			files.POST("/upload", wrapHandler(fileHandler.UploadFile))
+			files.GET("/stats", wrapHandler(fileHandler.GetFileStats))
+			files.DELETE("/cleanup", wrapMiddleware(middleware.AdminMiddleware), wrapHandler(fileHandler.CleanupFiles))
+			files.GET("/:id", wrapHandler(fileHandler.GetFile))
+			files.GET("/:id/download", wrapHandler(fileHandler.DownloadFile))
+			files.DELETE("/:id", wrapHandler(fileHandler.DeleteFile))
+		}
+
+		// 导出任务
+		exports := protected.Group("/exports")
+		{
+			exports.GET("", wrapHandler(exportJobHandler.ListExportJobs))
+			exports.POST("", wrapHandler(exportJobHandler.CreateExportJob))
+			exports.GET("/:id", wrapHandler(exportJobHandler.GetExportJob))
+			exports.GET("/:id/download", wrapHandler(exportJobHandler.DownloadExportJob))
+			exports.DELETE("/:id", wrapHandler(exportJobHandler.DeleteExportJob))
+		}
+
+		// 邮件配置（管理员）
+		notifications := protected.Group("/notifications")
+		notifications.Use(wrapMiddleware(middleware.AdminMiddleware))
+		{
+			notifications.GET("/email", wrapHandler(notificationHandler.GetEmailConfig))
+			notifications.POST("/email/test", wrapHandler(notificationHandler.TestEmail))
+		}
+
+		// Webhook（管理员）
+		webhooks := protected.Group("/webhooks")
+		webhooks.Use(wrapMiddleware(middleware.AdminMiddleware))
+		{
+			webhooks.GET("", wrapHandler(webhookHandler.ListWebhooks))
+			webhooks.POST("", wrapHandler(webhookHandler.CreateWebhook))
+			webhooks.GET("/dead-letters", wrapHandler(webhookHandler.ListDeadLetters))
+			webhooks.POST("/deliveries/:id/replay", wrapHandler(webhookHandler.ReplayWebhookDelivery))
+			webhooks.GET("/:id", wrapHandler(webhookHandler.GetWebhook))
+			webhooks.PUT("/:id", wrapHandler(webhookHandler.UpdateWebhook))
+			webhooks.DELETE("/:id", wrapHandler(webhookHandler.DeleteWebhook))
+			webhooks.POST("/:id/rotate-secret", wrapHandler(webhookHandler.RotateWebhookSecret))
+			webhooks.POST("/:id/test", wrapHandler(webhookHandler.TestWebhook))
+			webhooks.GET("/:id/deliveries", wrapHandler(webhookHandler.ListWebhookDeliveries))
+			webhooks.POST("/:id/replay-dead", wrapHandler(webhookHandler.ReplayDeadLetters))
+		}
+
+		// 字段加密（管理员）
+		encryption := protected.Group("/encryption")
+		encryption.Use(wrapMiddleware(middleware.AdminMiddleware))
+		{
+			encryption.GET("", wrapHandler(encryptionHandler.GetStatus))
+			encryption.POST("/rotate", wrapHandler(encryptionHandler.RotateDataKey))
+			encryption.PUT("/decrypt-roles", wrapHandler(encryptionHandler.UpdateDecryptRoles))
+		}
+
+		// 数据保留和个人数据删除（管理员）
+		retention := protected.Group("/retention")
+		retention.Use(wrapMiddleware(middleware.AdminMiddleware))
+		{
+			retention.GET("", wrapHandler(retentionHandler.GetStatus))
+			retention.POST("/run", wrapHandler(retentionHandler.RunRetention))
+			retention.POST("/erasure", wrapHandler(retentionHandler.EraseSubject))
 		}
 
 		// 系统监控
 		monitoring := protected.Group("/monitoring")
 		{
-			monitoring.GET("/health", gin.WrapF(monitoringHandler.GetHealthCheck))
-			monitoring.GET("/dashboard", gin.WrapF(monitoringHandler.GetDashboardData))
-			monitoring.GET("/metrics/system", gin.WrapF(monitoringHandler.GetSystemMetrics))
-			monitoring.GET("/metrics/proxy", gin.WrapF(monitoringHandler.GetProxyMetrics))
+			monitoring.GET("/health", wrapHandler(monitoringHandler.GetHealthCheck))
+			monitoring.GET("/dashboard", wrapHandler(monitoringHandler.GetDashboardData))
+			monitoring.GET("/metrics/system", wrapHandler(monitoringHandler.GetSystemMetrics))
+			monitoring.GET("/metrics/proxy", wrapHandler(monitoringHandler.GetProxyMetrics))
 		}
 
 		// 用户管理（管理员）
 		admin := users.Group("/admin")
-		admin.Use(func(c *gin.Context) {
-			// 创建一个适配器来处理AdminMiddleware
-			handler := middleware.AdminMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				c.Next()
-			}))
-			handler.ServeHTTP(c.Writer, c.Request)
-		})
+		admin.Use(wrapMiddleware(middleware.AdminMiddleware))
+		{
+			admin.POST("/", wrapHandler(userAdminHandler.CreateUser))
+			admin.GET("/:id", wrapHandler(userAdminHandler.GetUser))
+			admin.PUT("/:id", wrapHandler(userAdminHandler.UpdateUser))
+			admin.DELETE("/:id", wrapHandler(userAdminHandler.DeleteUser))
+			admin.GET("/", wrapHandler(userAdminHandler.ListUsers))
+		}
+
+		// 审计日志（管理员）
+		auditLogs := protected.Group("/audit-logs")
+		auditLogs.Use(wrapMiddleware(middleware.AdminMiddleware))
 		{
-			admin.POST("/", gin.WrapF(userAdminHandler.CreateUser))
-			admin.GET("/:id", gin.WrapF(userAdminHandler.GetUser))
-			admin.PUT("/:id", gin.WrapF(userAdminHandler.UpdateUser))
-			admin.DELETE("/:id", gin.WrapF(userAdminHandler.DeleteUser))
-			admin.GET("/", gin.WrapF(userAdminHandler.ListUsers))
+			auditLogs.GET("", wrapHandler(auditHandler.ListAuditLogs))
 		}
 	}
 
@@ -263,11 +429,39 @@ func main() {
 		}
 	}()
 
+	// 代理服务器处理代理域名的流量，并在数据面接收弹窗事件上报和表单提交
+	var proxySrv *http.Server
+	if cfg.Proxy.Port != 0 {
+		proxyServer := proxy.NewProxyServer(db.DB, logger, cfg)
+		proxyServer.Handle(proxy.EventsEndpointPath, http.HandlerFunc(popupHandler.TrackEvents))
+		proxyServer.Handle(proxy.FormsEndpointPath, http.HandlerFunc(submissionHandler.SubmitFormStep))
+		proxyServer.Handle(proxy.CaptchaEndpointPath, http.HandlerFunc(submissionHandler.GetCaptcha))
+		proxyServer.Handle(proxy.UploadsEndpointPath, http.HandlerFunc(submissionHandler.UploadFormFile))
+
+		proxySrv = &http.Server{
+			Addr:    cfg.GetProxyAddr(),
+			Handler: proxyServer,
+		}
+		go func() {
+			log.Printf("Proxy server starting on %s", cfg.GetProxyAddr())
+			if err := proxySrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start proxy server: %v", err)
+			}
+		}()
+	}
+
 	// 等待中断信号以优雅地关闭服务器
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
+	popupScheduler.Stop()
+	exportJobService.Stop()
+	webhookService.Stop()
+	notificationService.Stop()
+	mailService.Stop()
+	encryptionService.Stop()
+	retentionService.Stop()
 
 	// 5秒超时的上下文
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -277,6 +471,38 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	if proxySrv != nil {
+		if err := proxySrv.Shutdown(ctx); err != nil {
+			log.Fatal("Proxy server forced to shutdown:", err)
+		}
+	}
 
 	log.Println("Server exited")
 }
+
+// wrapHandler 将标准处理器适配为gin处理器，并把gin路径参数同步为mux路由变量供处理器读取
+func wrapHandler(h http.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vars := make(map[string]string, len(c.Params))
+		for _, param := range c.Params {
+			vars[param.Key] = param.Value
+		}
+		h(c.Writer, mux.SetURLVars(c.Request, vars))
+	}
+}
+
+// wrapMiddleware 将标准中间件适配为gin中间件
+// 中间件放行时把附带用户信息的请求交给后续处理器，未放行时终止后续处理
+func wrapMiddleware(mw func(http.Handler) http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		passed := false
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			passed = true
+			c.Request = r
+			c.Next()
+		})).ServeHTTP(c.Writer, c.Request)
+		if !passed {
+			c.Abort()
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package attribution
+
+import (
+	"net/url"
+	"strings"
+
+	"proxy-enhancer-ultra/internal/ruledsl"
+)
+
+// 来源字段长度上限，与提交记录的列宽一致
+const (
+	maxUTMLen    = 100
+	maxPathLen   = 500
+	maxDomainLen = 255
+)
+
+// utmParams 归因使用的 UTM 参数
+var utmParams = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"}
+
+// Source 提交的来源归因
+type Source struct {
+	ReferrerDomain string // 会话开始时的外部来源域名，直接访问或站内跳转时为空
+	UTMSource      string
+	UTMMedium      string
+	UTMCampaign    string
+	UTMTerm        string
+	UTMContent     string
+	LandingPage    string // 会话的落地页路径，不含查询参数
+	ProxiedPath    string // 提交表单的代理页面路径，不含查询参数
+	DeviceClass    string // desktop、mobile、tablet 或 bot，与弹窗受众规则的设备条件使用同一分类
+}
+
+// Capture 根据提交页面地址、会话落地页、会话来源域名和浏览器信息获取来源归因
+//
+// 提交页面地址带有任一 UTM 参数时使用提交页面的 UTM 参数，否则使用落地页的 UTM 参数。
+// landingPage 为路径加查询参数，为空时视为在提交页面开始的会话
+func Capture(pageURL, landingPage, referrerDomain, userAgent string) Source {
+	page := parseURL(pageURL)
+	landing := parseURL(landingPage)
+	if landingPage == "" {
+		landing = page
+	}
+
+	utm := page.Query()
+	if !hasUTM(utm) {
+		utm = landing.Query()
+	}
+
+	return Source{
+		ReferrerDomain: NormalizeDomain(referrerDomain),
+		UTMSource:      normalizeUTM(utm.Get("utm_source")),
+		UTMMedium:      normalizeUTM(utm.Get("utm_medium")),
+		UTMCampaign:    normalizeUTM(utm.Get("utm_campaign")),
+		UTMTerm:        normalizeUTM(utm.Get("utm_term")),
+		UTMContent:     normalizeUTM(utm.Get("utm_content")),
+		LandingPage:    normalizePath(landing.Path),
+		ProxiedPath:    normalizePath(page.Path),
+		DeviceClass:    ruledsl.DeviceClass(userAgent),
+	}
+}
+
+// NormalizeDomain 规范化来源域名，去除端口并转为小写，不是有效域名时返回空字符串
+func NormalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if host, _, found := strings.Cut(domain, ":"); found {
+		domain = host
+	}
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" || len(domain) > maxDomainLen || strings.ContainsAny(domain, "/?#@ \t") {
+		return ""
+	}
+	return domain
+}
+
+// parseURL 解析完整地址或路径，无效时返回空地址
+func parseURL(raw string) *url.URL {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return &url.URL{}
+	}
+	return parsed
+}
+
+// hasUTM 判断查询参数中是否有 UTM 参数
+func hasUTM(query url.Values) bool {
+	for _, name := range utmParams {
+		if strings.TrimSpace(query.Get(name)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeUTM 与弹窗受众规则的 utm_source 一致，去除首尾空白、转为小写并截断
+func normalizeUTM(value string) string {
+	return truncate(strings.ToLower(strings.TrimSpace(value)), maxUTMLen)
+}
+
+// normalizePath 路径为空时视为根路径，超长时截断
+func normalizePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return truncate(path, maxPathLen)
+}
+
+// truncate 按字符截断字符串
+func truncate(value string, max int) string {
+	if runes := []rune(value); len(runes) > max {
+		return string(runes[:max])
+	}
+	return value
+}
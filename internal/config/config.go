@@ -1,8 +1,12 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/spf13/viper"
@@ -18,6 +22,11 @@ type Config struct {
 	Security   SecurityConfig   `mapstructure:"security"`
 	Cache      CacheConfig      `mapstructure:"cache"`
 	Monitoring MonitoringConfig `mapstructure:"monitoring"`
+	Storage    StorageConfig    `mapstructure:"storage"`
+	Export     ExportConfig     `mapstructure:"export"`
+	Webhooks   WebhookConfig    `mapstructure:"webhooks"`
+	Mail       MailConfig       `mapstructure:"mail"`
+	Retention  RetentionConfig  `mapstructure:"retention"`
 }
 
 // ServerConfig 服务器配置
@@ -27,6 +36,10 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
 	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+
+	// TrustedProxies 可信反向代理的IP或CIDR，只有来自这些地址的请求才使用 X-Forwarded-For 和 X-Real-IP 中的客户端IP，
+	// 为空时始终使用连接的对端地址
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // DatabaseConfig 数据库配置
@@ -54,6 +67,8 @@ type JWTConfig struct {
 
 // ProxyConfig 代理配置
 type ProxyConfig struct {
+	Host                string        `mapstructure:"host"`
+	Port                int           `mapstructure:"port"` // 代理流量监听端口，为0时不启动代理服务器
 	Timeout             time.Duration `mapstructure:"timeout"`
 	MaxIdleConns        int           `mapstructure:"max_idle_conns"`
 	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
@@ -73,8 +88,10 @@ type LoggingConfig struct {
 
 // SecurityConfig 安全配置
 type SecurityConfig struct {
-	CORS      CORSConfig      `mapstructure:"cors"`
-	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	CORS        CORSConfig            `mapstructure:"cors"`
+	RateLimit   RateLimitConfig       `mapstructure:"rate_limit"`
+	Submissions SubmissionGuardConfig `mapstructure:"submissions"`
+	Encryption  EncryptionConfig      `mapstructure:"encryption"`
 }
 
 // CORSConfig CORS配置
@@ -91,6 +108,283 @@ type RateLimitConfig struct {
 	Burst             int `mapstructure:"burst"`
 }
 
+// SubmissionGuardConfig 弹窗表单提交防护配置，为零值的项使用默认值
+type SubmissionGuardConfig struct {
+	TokenSecret   string        `mapstructure:"token_secret"`   // 表单令牌签名密钥，为空时由JWT密钥派生
+	TokenTTL      time.Duration `mapstructure:"token_ttl"`      // 表单令牌有效期
+	MinFillTime   time.Duration `mapstructure:"min_fill_time"`  // 页面加载后到提交的最短时间，更快的提交视为机器人
+	IPLimit       int           `mapstructure:"ip_limit"`       // 每个IP每分钟最多提交的表单步骤数
+	PopupLimit    int           `mapstructure:"popup_limit"`    // 每个弹窗每分钟最多接受的表单步骤数
+	PowDifficulty int           `mapstructure:"pow_difficulty"` // 工作量证明验证码要求的前导零比特数
+}
+
+// 弹窗表单提交防护的默认值
+const (
+	DefaultFormTokenTTL         = 24 * time.Hour
+	DefaultFormMinFillTime      = 3 * time.Second
+	DefaultSubmissionIPLimit    = 20
+	DefaultSubmissionPopupLimit = 600
+	DefaultPowDifficulty        = 16
+	maxPowDifficulty            = 24
+)
+
+// WithDefaults 返回补全默认值的配置，工作量证明难度限制在页面脚本可以完成的范围内
+func (c SubmissionGuardConfig) WithDefaults() SubmissionGuardConfig {
+	if c.TokenTTL <= 0 {
+		c.TokenTTL = DefaultFormTokenTTL
+	}
+	if c.MinFillTime <= 0 {
+		c.MinFillTime = DefaultFormMinFillTime
+	}
+	if c.IPLimit <= 0 {
+		c.IPLimit = DefaultSubmissionIPLimit
+	}
+	if c.PopupLimit <= 0 {
+		c.PopupLimit = DefaultSubmissionPopupLimit
+	}
+	if c.PowDifficulty <= 0 {
+		c.PowDifficulty = DefaultPowDifficulty
+	}
+	if c.PowDifficulty > maxPowDifficulty {
+		c.PowDifficulty = maxPowDifficulty
+	}
+	return c
+}
+
+// EncryptionConfig 提交数据敏感字段加密配置
+//
+// 主密钥只用于包装数据库中的数据密钥。轮换主密钥时把原来的主密钥移到 previous_master_keys，
+// 服务启动时用新的主密钥重新包装所有数据密钥
+type EncryptionConfig struct {
+	MasterKey          string            `mapstructure:"master_key"`           // 当前主密钥，base64编码的32字节，为空时不加密
+	MasterKeyID        string            `mapstructure:"master_key_id"`        // 当前主密钥的标识，轮换主密钥时必须更换，默认 default
+	PreviousMasterKeys map[string]string `mapstructure:"previous_master_keys"` // 轮换前的主密钥，键为主密钥标识
+	EncryptClientInfo  bool              `mapstructure:"encrypt_client_info"`  // 同时加密用户IP和浏览器信息，数据库中只保留IP所在的网段
+}
+
+// DefaultMasterKeyID 未配置主密钥标识时使用的标识
+const DefaultMasterKeyID = "default"
+
+// WithDefaults 返回补全默认值后的配置
+func (c EncryptionConfig) WithDefaults() EncryptionConfig {
+	if c.MasterKeyID == "" {
+		c.MasterKeyID = DefaultMasterKeyID
+	}
+	return c
+}
+
+// StorageConfig 文件存储配置，保存管理后台上传的文件和弹窗表单的上传文件
+type StorageConfig struct {
+	Driver        string             `mapstructure:"driver"`          // 存储后端，local 或 s3，默认 local
+	MaxUploadSize int64              `mapstructure:"max_upload_size"` // 管理后台单个上传文件的最大字节数
+	Local         LocalStorageConfig `mapstructure:"local"`
+	S3            S3StorageConfig    `mapstructure:"s3"`
+}
+
+// LocalStorageConfig 本地文件系统存储配置
+type LocalStorageConfig struct {
+	Path string `mapstructure:"path"` // 存储目录
+}
+
+// S3StorageConfig S3兼容对象存储配置，也可以使用 MinIO 等兼容服务
+type S3StorageConfig struct {
+	Endpoint  string `mapstructure:"endpoint"`   // 服务地址，如 http://localhost:9000，为空时使用 AWS S3 的区域地址
+	Region    string `mapstructure:"region"`     // 区域，默认 us-east-1
+	Bucket    string `mapstructure:"bucket"`     // 存储桶
+	AccessKey string `mapstructure:"access_key"` // 访问密钥ID
+	SecretKey string `mapstructure:"secret_key"` // 访问密钥
+	PathStyle bool   `mapstructure:"path_style"` // 使用路径风格的地址，MinIO 需要开启
+	Prefix    string `mapstructure:"prefix"`     // 对象键前缀
+}
+
+// 文件存储后端
+const (
+	StorageDriverLocal = "local"
+	StorageDriverS3    = "s3"
+)
+
+// 文件存储的默认值
+const (
+	DefaultStoragePath   = "data/uploads"
+	DefaultMaxUploadSize = 20 << 20
+	DefaultS3Region      = "us-east-1"
+)
+
+// WithDefaults 返回补全默认值后的配置
+func (c StorageConfig) WithDefaults() StorageConfig {
+	if c.Driver == "" {
+		c.Driver = StorageDriverLocal
+	}
+	if c.MaxUploadSize <= 0 {
+		c.MaxUploadSize = DefaultMaxUploadSize
+	}
+	if c.Local.Path == "" {
+		c.Local.Path = DefaultStoragePath
+	}
+	if c.S3.Region == "" {
+		c.S3.Region = DefaultS3Region
+	}
+	return c
+}
+
+// ExportConfig 后台导出任务配置，为零值的项使用默认值
+type ExportConfig struct {
+	Workers     int           `mapstructure:"workers"`      // 同时执行的导出任务数
+	ArtifactTTL time.Duration `mapstructure:"artifact_ttl"` // 导出文件的保留时间，过期后自动删除
+}
+
+// 导出任务的默认值
+const (
+	DefaultExportWorkers     = 2
+	DefaultExportArtifactTTL = 24 * time.Hour
+)
+
+// WithDefaults 返回补全默认值后的配置
+func (c ExportConfig) WithDefaults() ExportConfig {
+	if c.Workers <= 0 {
+		c.Workers = DefaultExportWorkers
+	}
+	if c.ArtifactTTL <= 0 {
+		c.ArtifactTTL = DefaultExportArtifactTTL
+	}
+	return c
+}
+
+// WebhookConfig Webhook投递配置，为零值的项使用默认值
+type WebhookConfig struct {
+	Workers     int           `mapstructure:"workers"`      // 同时投递的请求数
+	MaxAttempts int           `mapstructure:"max_attempts"` // 最多投递次数，全部失败后进入死信列表
+	Timeout     time.Duration `mapstructure:"timeout"`      // 单次投递的请求超时
+	RetryBase   time.Duration `mapstructure:"retry_base"`   // 第一次重试的间隔，之后每次翻倍
+	RetryMax    time.Duration `mapstructure:"retry_max"`    // 重试间隔的上限
+}
+
+// Webhook投递的默认值
+const (
+	DefaultWebhookWorkers     = 4
+	DefaultWebhookMaxAttempts = 8
+	DefaultWebhookTimeout     = 10 * time.Second
+	DefaultWebhookRetryBase   = 30 * time.Second
+	DefaultWebhookRetryMax    = 6 * time.Hour
+)
+
+// WithDefaults 返回补全默认值后的配置
+func (c WebhookConfig) WithDefaults() WebhookConfig {
+	if c.Workers <= 0 {
+		c.Workers = DefaultWebhookWorkers
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = DefaultWebhookMaxAttempts
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultWebhookTimeout
+	}
+	if c.RetryBase <= 0 {
+		c.RetryBase = DefaultWebhookRetryBase
+	}
+	if c.RetryMax <= 0 {
+		c.RetryMax = DefaultWebhookRetryMax
+	}
+	return c
+}
+
+// MailConfig SMTP邮件配置，为零值的项使用默认值
+type MailConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`      // 未启用时不发送通知邮件
+	Host        string        `mapstructure:"host"`         // SMTP服务器地址
+	Port        int           `mapstructure:"port"`         // SMTP端口
+	Username    string        `mapstructure:"username"`     // 为空时不认证
+	Password    string        `mapstructure:"password"`     // 认证密码
+	From        string        `mapstructure:"from"`         // 发件人地址
+	FromName    string        `mapstructure:"from_name"`    // 发件人名称
+	Encryption  string        `mapstructure:"encryption"`   // starttls、tls 或 none
+	Timeout     time.Duration `mapstructure:"timeout"`      // 连接和发送一封邮件的超时
+	MaxAttempts int           `mapstructure:"max_attempts"` // 最多发送次数，全部失败后放弃并记录日志
+	RetryBase   time.Duration `mapstructure:"retry_base"`   // 第一次重试的间隔，之后每次翻倍
+}
+
+// 邮件加密方式
+const (
+	MailEncryptionSTARTTLS = "starttls" // 明文连接后升级为TLS，服务器不支持时发送失败
+	MailEncryptionTLS      = "tls"      // 直接建立TLS连接，通常使用465端口
+	MailEncryptionNone     = "none"     // 不加密，只用于本地中继和测试
+)
+
+// 邮件配置的默认值
+const (
+	DefaultMailPort        = 587
+	DefaultMailTimeout     = 30 * time.Second
+	DefaultMailMaxAttempts = 5
+	DefaultMailRetryBase   = time.Minute
+)
+
+// WithDefaults 返回补全默认值后的配置，465端口默认使用TLS，其他端口默认使用STARTTLS
+func (c MailConfig) WithDefaults() MailConfig {
+	if c.Port <= 0 {
+		c.Port = DefaultMailPort
+	}
+	if c.Encryption == "" {
+		c.Encryption = MailEncryptionSTARTTLS
+		if c.Port == 465 {
+			c.Encryption = MailEncryptionTLS
+		}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultMailTimeout
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = DefaultMailMaxAttempts
+	}
+	if c.RetryBase <= 0 {
+		c.RetryBase = DefaultMailRetryBase
+	}
+	return c
+}
+
+// RetentionConfig 数据保留配置，保留天数为0的表不清理，为零值的其他项使用默认值
+type RetentionConfig struct {
+	Interval      time.Duration  `mapstructure:"interval"`       // 清理任务的执行间隔
+	BatchSize     int            `mapstructure:"batch_size"`     // 每个事务删除或匿名化的行数
+	Submissions   TableRetention `mapstructure:"submissions"`    // 弹窗提交，弹窗可以单独设置
+	ProxyLogs     TableRetention `mapstructure:"proxy_logs"`     // 代理访问日志
+	SystemMetrics TableRetention `mapstructure:"system_metrics"` // 系统指标，不包含个人信息，只支持删除
+}
+
+// TableRetention 单个表的保留期限和过期后的处理方式
+type TableRetention struct {
+	Days int    `mapstructure:"days"` // 保留天数，为0时不清理
+	Mode string `mapstructure:"mode"` // delete 或 anonymize
+}
+
+// 数据过期后的处理方式
+const (
+	RetentionModeDelete    = "delete"    // 硬删除
+	RetentionModeAnonymize = "anonymize" // 保留记录用于统计，清除可以识别访客的内容
+)
+
+// 数据保留的默认值
+const (
+	DefaultRetentionInterval  = time.Hour
+	DefaultRetentionBatchSize = 500
+)
+
+// WithDefaults 返回补全默认值后的配置，未设置处理方式的表过期后硬删除
+func (c RetentionConfig) WithDefaults() RetentionConfig {
+	if c.Interval <= 0 {
+		c.Interval = DefaultRetentionInterval
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultRetentionBatchSize
+	}
+	for _, table := range []*TableRetention{&c.Submissions, &c.ProxyLogs} {
+		if table.Mode == "" {
+			table.Mode = RetentionModeDelete
+		}
+	}
+	c.SystemMetrics.Mode = RetentionModeDelete
+	return c
+}
+
 // CacheConfig 缓存配置
 type CacheConfig struct {
 	Redis RedisConfig `mapstructure:"redis"`
@@ -124,6 +418,7 @@ func Load(configPath string) (*Config, error) {
 	// 服务器配置环境变量绑定
 	viper.BindEnv("server.host", "SERVER_HOST")
 	viper.BindEnv("server.port", "SERVER_PORT")
+	viper.BindEnv("proxy.port", "PROXY_PORT")
 
 	// 数据库配置环境变量绑定
 	viper.BindEnv("database.postgres.host", "DB_HOST")
@@ -135,6 +430,21 @@ func Load(configPath string) (*Config, error) {
 
 	// JWT配置环境变量绑定
 	viper.BindEnv("jwt.secret", "JWT_SECRET")
+	viper.BindEnv("security.submissions.token_secret", "FORM_TOKEN_SECRET")
+	viper.BindEnv("security.encryption.master_key", "FIELD_ENCRYPTION_KEY")
+	viper.BindEnv("security.encryption.master_key_id", "FIELD_ENCRYPTION_KEY_ID")
+
+	// 文件存储配置环境变量绑定
+	viper.BindEnv("storage.driver", "STORAGE_DRIVER")
+	viper.BindEnv("storage.s3.endpoint", "S3_ENDPOINT")
+	viper.BindEnv("storage.s3.bucket", "S3_BUCKET")
+	viper.BindEnv("storage.s3.access_key", "S3_ACCESS_KEY")
+	viper.BindEnv("storage.s3.secret_key", "S3_SECRET_KEY")
+
+	// 邮件配置环境变量绑定
+	viper.BindEnv("mail.host", "SMTP_HOST")
+	viper.BindEnv("mail.username", "SMTP_USERNAME")
+	viper.BindEnv("mail.password", "SMTP_PASSWORD")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -153,6 +463,11 @@ func (c *Config) GetAddr() string {
 	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
 }
 
+// GetProxyAddr 获取代理服务器地址
+func (c *Config) GetProxyAddr() string {
+	return fmt.Sprintf("%s:%d", c.Proxy.Host, c.Proxy.Port)
+}
+
 // GetDSN 获取数据库连接字符串
 func (c *Config) GetDSN() string {
 	// 使用PostgreSQL配置
@@ -169,6 +484,43 @@ func (c *Config) GetDSN() string {
 	return dsn
 }
 
+// processFormSecret 未配置任何密钥时进程内共享的随机表单令牌密钥，重启后之前签发的令牌失效
+var (
+	processFormSecret     []byte
+	processFormSecretOnce sync.Once
+)
+
+// FormTokenSecret 返回表单令牌的签名密钥，未单独配置时由JWT密钥派生，避免直接复用JWT密钥
+// 两者都未配置时返回进程内共享的随机密钥，代理服务器和管理服务签发、校验的令牌保持一致
+func (c *Config) FormTokenSecret() []byte {
+	if c.Security.Submissions.TokenSecret != "" {
+		return []byte(c.Security.Submissions.TokenSecret)
+	}
+	if c.JWT.Secret == "" {
+		processFormSecretOnce.Do(func() {
+			processFormSecret = make([]byte, 32)
+			if _, err := rand.Read(processFormSecret); err != nil {
+				panic("failed to generate form token secret: " + err.Error())
+			}
+		})
+		return processFormSecret
+	}
+	mac := hmac.New(sha256.New, []byte(c.JWT.Secret))
+	mac.Write([]byte("popup-form-token"))
+	return mac.Sum(nil)
+}
+
+// FingerprintSecret 返回计算提交去重键、审计日志中数据主体标识等带密钥哈希的密钥，由JWT密钥派生
+// 这些哈希会保存到数据库，不能使用重启后变化的随机密钥，未配置JWT密钥时返回 nil
+func (c *Config) FingerprintSecret() []byte {
+	if c.JWT.Secret == "" {
+		return nil
+	}
+	mac := hmac.New(sha256.New, []byte(c.JWT.Secret))
+	mac.Write([]byte("submission-fingerprint"))
+	return mac.Sum(nil)
+}
+
 // IsProduction 判断是否为生产环境
 func (c *Config) IsProduction() bool {
 	return os.Getenv("APP_ENV") == "production"
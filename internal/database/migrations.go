@@ -0,0 +1,238 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"proxy-enhancer-ultra/internal/attribution"
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/ruledsl"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// schemaMigration 已执行的数据迁移记录
+type schemaMigration struct {
+	ID        string    `gorm:"primaryKey;size:100" comment:"迁移ID"` // 迁移ID
+	AppliedAt time.Time `gorm:"autoCreateTime" comment:"执行时间"`      // 迁移执行时间
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations" // 数据迁移记录表
+}
+
+// migration 数据迁移，AutoMigrate 完成表结构变更后按顺序执行且只执行一次
+type migration struct {
+	ID          string
+	Description string
+	Up          func(tx *gorm.DB, log logger.Logger) error
+}
+
+// migrations 数据迁移列表，只能在末尾追加
+var migrations = []migration{
+	{
+		ID:          "20261019_bind_rules_popups_to_proxy_configs",
+		Description: "将引入代理配置绑定前创建的规则和弹窗标记为全局，保持原有行为",
+		Up: func(tx *gorm.DB, log logger.Logger) error {
+			if err := tx.Exec(`UPDATE rules SET is_global = true
+				WHERE NOT EXISTS (SELECT 1 FROM rule_proxy_configs rpc WHERE rpc.rule_id = rules.id)`).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`UPDATE popups SET is_global = true
+				WHERE NOT EXISTS (SELECT 1 FROM popup_proxy_configs ppc WHERE ppc.popup_id = popups.id)`).Error
+		},
+	},
+	{
+		ID:          "20261019_rule_definitions_v2",
+		Description: "将规则的触发条件和动作转换为版本2的结构化定义，并修正 rule_type、description 字段",
+		Up:          upgradeRuleDefinitions,
+	},
+	{
+		ID:          "20261019_submission_search_indexes",
+		Description: "为提交记录的表单数据、来源页面、浏览器信息和IP地址创建搜索索引",
+		Up:          createSubmissionSearchIndexes,
+	},
+	{
+		ID:          "20261019_submission_source_attribution",
+		Description: "为提交来源分析创建索引，并根据已有提交的来源页面和浏览器信息补充提交页面路径、UTM参数和设备类型",
+		Up:          backfillSubmissionSources,
+	},
+	{
+		ID:          "20261019_clear_unkeyed_erasure_subject_ids",
+		Description: "清除删除个人数据审计日志中无密钥的邮箱和手机号哈希，避免通过穷举还原被删除数据的主体",
+		Up: func(tx *gorm.DB, log logger.Logger) error {
+			// 无密钥的SHA-256为64位十六进制，带密钥的哈希为32位
+			return tx.Exec(`UPDATE audit_logs SET resource_id = ''
+				WHERE resource_type = 'subject' AND length(resource_id) = 64`).Error
+		},
+	},
+	{
+		ID:          "20261019_clear_unkeyed_dedup_keys",
+		Description: "清除未启用字段加密时保存的无密钥去重键，这些提交不再参与去重",
+		Up: func(tx *gorm.DB, log logger.Logger) error {
+			return tx.Exec(`UPDATE submissions SET dedup_key = ''
+				WHERE length(dedup_key) = 64`).Error
+		},
+	},
+}
+
+// createSubmissionSearchIndexes 创建提交记录的搜索索引
+//
+// 表单数据的GIN索引支持字段等值和存在条件；字段值全文、来源页面和浏览器信息的模糊搜索
+// 需要 pg_trgm 扩展，数据库用户没有创建扩展的权限时跳过这些索引，搜索仍然可用但需要扫描表
+func createSubmissionSearchIndexes(tx *gorm.DB, log logger.Logger) error {
+	if err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_submissions_form_data
+		ON submissions USING gin (form_data jsonb_path_ops)`).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_submissions_user_ip
+		ON submissions USING gist (user_ip inet_ops)`).Error; err != nil {
+		return err
+	}
+
+	if err := tx.SavePoint("pg_trgm").Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`).Error; err != nil {
+		log.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Warn("pg_trgm extension is unavailable, skipping submission text search indexes")
+		return tx.RollbackTo("pg_trgm").Error
+	}
+	// 表达式必须与查询中的 submissionValuesExpr 一致
+	if err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_submissions_form_values_trgm
+		ON submissions USING gin ((jsonb_path_query_array(form_data, '$.*')::text) gin_trgm_ops)`).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_submissions_referrer_url_trgm
+		ON submissions USING gin (referrer_url gin_trgm_ops)`).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`CREATE INDEX IF NOT EXISTS idx_submissions_user_agent_trgm
+		ON submissions USING gin (user_agent gin_trgm_ops)`).Error
+}
+
+// backfillSubmissionSources 补充来源归因列之前创建的提交的来源信息
+//
+// 已有提交的来源页面是提交表单的页面地址，没有记录会话落地页和外部来源域名，这两项保持为空
+func backfillSubmissionSources(tx *gorm.DB, log logger.Logger) error {
+	if err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_submissions_popup_created
+		ON submissions (popup_id, created_at)`).Error; err != nil {
+		return err
+	}
+
+	var submissions []*models.Submission
+	var updated int
+	err := tx.Unscoped().Model(&models.Submission{}).Select("id", "referrer_url", "user_agent").
+		Where("device_class IS NULL").
+		FindInBatches(&submissions, 500, func(batch *gorm.DB, _ int) error {
+			for _, submission := range submissions {
+				source := attribution.Capture(submission.ReferrerURL, "", "", submission.UserAgent)
+				if err := tx.Unscoped().Model(&models.Submission{}).Where("id = ?", submission.ID).UpdateColumns(map[string]interface{}{
+					"utm_source":   source.UTMSource,
+					"utm_medium":   source.UTMMedium,
+					"utm_campaign": source.UTMCampaign,
+					"utm_term":     source.UTMTerm,
+					"utm_content":  source.UTMContent,
+					"proxied_path": source.ProxiedPath,
+					"device_class": source.DeviceClass,
+				}).Error; err != nil {
+					return fmt.Errorf("failed to backfill submission %s: %w", submission.ID, err)
+				}
+			}
+			updated += len(submissions)
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(map[string]interface{}{
+		"submissions": updated,
+	}).Info("Backfilled submission sources")
+	return nil
+}
+
+// upgradeRuleDefinitions 将版本1的规则定义升级为版本2
+//
+// 版本1把规则类型写入 name、把动作内容写入 description，这里一并修正；
+// 无法解析的规则保持原样并记录日志，由管理员手动处理
+func upgradeRuleDefinitions(tx *gorm.DB, log logger.Logger) error {
+	var rules []*models.Rule
+	return tx.Unscoped().Model(&models.Rule{}).FindInBatches(&rules, 100, func(batch *gorm.DB, _ int) error {
+		for _, rule := range rules {
+			def, err := ruledsl.ParseDefinition(rule.TriggerConditions, rule.Actions)
+			if err != nil {
+				log.WithFields(map[string]interface{}{
+					"rule_id": rule.ID,
+					"error":   err.Error(),
+				}).Warn("Skipping rule with unparseable definition")
+				continue
+			}
+			triggerConditions, actions, err := def.Marshal()
+			if err != nil {
+				return err
+			}
+
+			updates := map[string]interface{}{
+				"trigger_conditions": triggerConditions,
+				"actions":            actions,
+			}
+			if rule.RuleType == "" {
+				updates["rule_type"] = rule.Name
+			}
+			var legacy struct {
+				Content string `json:"content"`
+			}
+			if json.Unmarshal([]byte(rule.Actions), &legacy) == nil && legacy.Content != "" && rule.Description == legacy.Content {
+				updates["description"] = ""
+			}
+
+			if err := tx.Unscoped().Model(&models.Rule{}).Where("id = ?", rule.ID).UpdateColumns(updates).Error; err != nil {
+				return fmt.Errorf("failed to upgrade rule %s: %w", rule.ID, err)
+			}
+		}
+		return nil
+	}).Error
+}
+
+// RunMigrations 执行尚未执行的数据迁移
+func (d *Database) RunMigrations() error {
+	if err := d.DB.AutoMigrate(&schemaMigration{}); err != nil {
+		return fmt.Errorf("failed to migrate schema_migrations: %w", err)
+	}
+
+	var applied []string
+	if err := d.DB.Model(&schemaMigration{}).Pluck("id", &applied).Error; err != nil {
+		return fmt.Errorf("failed to load applied migrations: %w", err)
+	}
+	done := make(map[string]bool, len(applied))
+	for _, id := range applied {
+		done[id] = true
+	}
+
+	for _, m := range migrations {
+		if done[m.ID] {
+			continue
+		}
+
+		err := d.DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx, d.logger); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{ID: m.ID}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to run migration %s: %w", m.ID, err)
+		}
+
+		d.logger.WithFields(map[string]interface{}{
+			"migration":   m.ID,
+			"description": m.Description,
+		}).Info("Data migration applied")
+	}
+
+	return nil
+}
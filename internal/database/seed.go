@@ -17,6 +17,11 @@ func (d *Database) Seed() error {
 		return fmt.Errorf("failed to create default roles: %w", err)
 	}
 
+	// 创建默认权限
+	if err := d.createDefaultPermissions(); err != nil {
+		return fmt.Errorf("failed to create default permissions: %w", err)
+	}
+
 	// 创建默认管理员用户
 	if err := d.createDefaultAdmin(); err != nil {
 		return fmt.Errorf("failed to create default admin: %w", err)
@@ -63,6 +68,36 @@ func (d *Database) createDefaultRoles() error {
 	return nil
 }
 
+// createDefaultPermissions 创建默认权限，权限第一次创建时授予admin角色，之后的授权由管理员维护
+func (d *Database) createDefaultPermissions() error {
+	var count int64
+	d.DB.Model(&models.Permission{}).Where("name = ?", "submission:decrypt").Count(&count)
+	if count > 0 {
+		d.logger.Info("Submission decrypt permission already exists, skipping creation")
+		return nil
+	}
+
+	permission := &models.Permission{
+		Name:     "submission:decrypt",
+		Resource: "submission",
+		Action:   "decrypt",
+	}
+	if err := d.DB.Create(permission).Error; err != nil {
+		return fmt.Errorf("failed to create submission decrypt permission: %w", err)
+	}
+
+	var adminRole models.Role
+	if err := d.DB.Where("name = ?", "admin").First(&adminRole).Error; err != nil {
+		return fmt.Errorf("failed to find admin role: %w", err)
+	}
+	if err := d.DB.Create(&models.RolePermission{RoleID: adminRole.ID, PermissionID: permission.ID}).Error; err != nil {
+		return fmt.Errorf("failed to grant submission decrypt permission: %w", err)
+	}
+
+	d.logger.Info("Submission decrypt permission created and granted to admin role")
+	return nil
+}
+
 // createDefaultAdmin 创建默认管理员用户
 func (d *Database) createDefaultAdmin() error {
 	// 检查是否已存在管理员用户
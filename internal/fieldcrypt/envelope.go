@@ -0,0 +1,130 @@
+package fieldcrypt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 加密字段值的键
+const (
+	EnvelopeKey = "$enc" // 密文
+	MaskKey     = "mask" // 脱敏文本
+	IndexKey    = "bidx" // 盲索引，没有盲索引密钥或值不是简单值时没有该键
+)
+
+// Seal 加密一个字段值，返回保存到表单数据中的加密字段值，field 作为附加数据防止密文被移动到其他字段
+func Seal(k *Keyring, field string, value interface{}) (map[string]interface{}, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	token, err := k.Encrypt(plaintext, []byte(field))
+	if err != nil {
+		return nil, err
+	}
+	envelope := map[string]interface{}{
+		EnvelopeKey: token,
+		MaskKey:     Mask(value),
+	}
+	if index, ok := k.BlindIndex(field, value); ok {
+		envelope[IndexKey] = index
+	}
+	return envelope, nil
+}
+
+// Open 解密 Seal 返回的加密字段值
+func Open(k *Keyring, field string, envelope map[string]interface{}) (interface{}, error) {
+	token, _, ok := Envelope(envelope)
+	if !ok {
+		return nil, fmt.Errorf("field %s is not encrypted", field)
+	}
+	plaintext, err := k.Decrypt(token, []byte(field))
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(plaintext, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Envelope 判断字段值是否为加密字段值，返回密文和脱敏文本
+func Envelope(value interface{}) (token, mask string, ok bool) {
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return "", "", false
+	}
+	token, ok = m[EnvelopeKey].(string)
+	if !ok {
+		return "", "", false
+	}
+	mask, _ = m[MaskKey].(string)
+	return token, mask, true
+}
+
+// MaskData 把表单数据中的加密字段值替换为脱敏文本，返回是否有字段被替换
+func MaskData(data map[string]interface{}) bool {
+	masked := false
+	for name, value := range data {
+		if _, mask, ok := Envelope(value); ok {
+			data[name] = mask
+			masked = true
+		}
+	}
+	return masked
+}
+
+// MaskJSON 把表单数据JSON中的加密字段值替换为脱敏文本，无法解析或没有加密字段时原样返回
+func MaskJSON(formData string) string {
+	if !strings.Contains(formData, EnvelopeKey) {
+		return formData
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(formData), &data); err != nil || !MaskData(data) {
+		return formData
+	}
+	masked, err := json.Marshal(data)
+	if err != nil {
+		return formData
+	}
+	return string(masked)
+}
+
+// Mask 返回字段值的脱敏文本：邮箱保留用户名首字符和域名，11个字符以上保留前3个和后4个字符
+// （如 138****5678），7-10个字符保留首尾各2个字符，3-6个字符保留首尾各1个字符，更短的值全部隐藏
+func Mask(value interface{}) string {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		text = v
+	case float64:
+		text = formatNumber(v)
+	case bool, json.Number:
+		text = fmt.Sprint(v)
+	default:
+		return "****"
+	}
+
+	if at := strings.LastIndex(text, "@"); at > 0 && at < len(text)-1 {
+		local := []rune(text[:at])
+		return string(local[0]) + "****" + text[at:]
+	}
+
+	runes := []rune(text)
+	switch n := len(runes); {
+	case n == 0:
+		return ""
+	case n >= 11:
+		return string(runes[:3]) + strings.Repeat("*", n-7) + string(runes[n-4:])
+	case n >= 7:
+		return string(runes[:2]) + strings.Repeat("*", n-4) + string(runes[n-2:])
+	case n >= 3:
+		return string(runes[:1]) + strings.Repeat("*", n-2) + string(runes[n-1:])
+	default:
+		return strings.Repeat("*", n)
+	}
+}
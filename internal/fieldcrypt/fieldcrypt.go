@@ -0,0 +1,266 @@
+// Package fieldcrypt 提供提交数据敏感字段的信封加密
+//
+// 字段值使用数据密钥通过 AES-256-GCM 加密，数据密钥由配置中的主密钥包装后保存在数据库中。
+// 加密后的字段值保存为 {"$enc": "<密文>", "mask": "<脱敏文本>", "bidx": "<盲索引>"}，没有解密权限时显示脱敏文本，
+// 盲索引是规范化后的字段值的HMAC，用于在不解密的情况下按字段值精确查找
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// KeySize 主密钥和数据密钥的字节数
+const KeySize = 32
+
+// tokenVersion 密文格式版本
+const tokenVersion = "v1"
+
+// ErrUnknownKey 密文使用的数据密钥不在密钥环中
+var ErrUnknownKey = errors.New("unknown data key")
+
+// GenerateKey 生成随机密钥
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ParseKey 解析base64编码的32字节密钥
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.New("key must be base64 encoded")
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Wrap 使用主密钥包装数据密钥，keyID 作为附加数据，包装结果只能用同一 keyID 解开
+func Wrap(master, dataKey []byte, keyID string) (string, error) {
+	sealed, err := seal(master, dataKey, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Unwrap 使用主密钥解开数据密钥
+func Unwrap(master []byte, wrapped, keyID string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, errors.New("invalid wrapped key")
+	}
+	dataKey, err := open(master, sealed, []byte(keyID))
+	if err != nil {
+		return nil, errors.New("failed to unwrap data key, the master key may be wrong")
+	}
+	if len(dataKey) != KeySize {
+		return nil, errors.New("invalid data key size")
+	}
+	return dataKey, nil
+}
+
+// Keyring 数据密钥环，并发安全
+type Keyring struct {
+	mu       sync.RWMutex
+	keys     map[string][]byte
+	active   string
+	indexKey []byte
+}
+
+// NewKeyring 创建空的密钥环
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string][]byte)}
+}
+
+// Add 添加数据密钥，active 为 true 时之后的加密使用该密钥
+func (k *Keyring) Add(id string, key []byte, active bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = key
+	if active {
+		k.active = id
+	}
+}
+
+// SetIndexKey 设置计算盲索引的密钥，盲索引密钥不随数据密钥轮换，否则已保存的盲索引都需要重新计算
+func (k *Keyring) SetIndexKey(key []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.indexKey = key
+}
+
+// BlindIndex 计算字段值的盲索引，没有盲索引密钥或值不是简单值时返回 false
+//
+// 值先按 NormalizeValue 规范化，使 138-1234-5678 和 13812345678 的盲索引相同
+func (k *Keyring) BlindIndex(field string, value interface{}) (string, bool) {
+	k.mu.RLock()
+	key := k.indexKey
+	k.mu.RUnlock()
+	return KeyedIndex(key, field, value)
+}
+
+// KeyedIndex 使用指定密钥计算字段值规范化后的HMAC，算法与盲索引相同，密钥为空或值不是简单值时返回 false
+func KeyedIndex(key []byte, field string, value interface{}) (string, bool) {
+	if len(key) == 0 {
+		return "", false
+	}
+	normalized, ok := NormalizeValue(value)
+	if !ok {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), true
+}
+
+// NormalizeValue 规范化用于精确匹配的字段值：去除首尾空白、转为小写并去掉其中的空白和 -()，
+// 同一手机号或邮箱的不同写法得到相同的结果。盲索引、提交去重和删除个人数据都使用该规则，值不是简单值或为空时返回 false
+func NormalizeValue(value interface{}) (string, bool) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case float64:
+		text = formatNumber(v)
+	case bool:
+		text = fmt.Sprint(v)
+	default:
+		return "", false
+	}
+	text = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '\r', '-', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(text)))
+	return text, text != ""
+}
+
+// formatNumber 格式化JSON数字，不使用科学计数法，使以数字提交的手机号与字符串的写法一致
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Active 返回当前用于加密的数据密钥ID，密钥环为空时返回空字符串
+func (k *Keyring) Active() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Has 密钥环中是否有该数据密钥
+func (k *Keyring) Has(id string) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	_, ok := k.keys[id]
+	return ok
+}
+
+// Encrypt 使用当前数据密钥加密，返回 v1.<密钥ID>.<base64密文>
+func (k *Keyring) Encrypt(plaintext, aad []byte) (string, error) {
+	k.mu.RLock()
+	id, key := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+	if key == nil {
+		return "", errors.New("no active data key")
+	}
+	sealed, err := seal(key, plaintext, aad)
+	if err != nil {
+		return "", err
+	}
+	return tokenVersion + "." + id + "." + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密 Encrypt 返回的密文，aad 必须与加密时相同
+func (k *Keyring) Decrypt(token string, aad []byte) ([]byte, error) {
+	id, payload, err := splitToken(token)
+	if err != nil {
+		return nil, err
+	}
+	k.mu.RLock()
+	key := k.keys[id]
+	k.mu.RUnlock()
+	if key == nil {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errors.New("invalid ciphertext encoding")
+	}
+	plaintext, err := open(key, sealed, aad)
+	if err != nil {
+		return nil, errors.New("failed to decrypt value")
+	}
+	return plaintext, nil
+}
+
+// KeyID 返回密文使用的数据密钥ID
+func KeyID(token string) (string, error) {
+	id, _, err := splitToken(token)
+	return id, err
+}
+
+// splitToken 拆分密文中的密钥ID和加密数据
+func splitToken(token string) (string, string, error) {
+	parts := strings.SplitN(token, ".", 3)
+	if len(parts) != 3 || parts[0] != tokenVersion || parts[1] == "" {
+		return "", "", errors.New("invalid ciphertext format")
+	}
+	return parts[1], parts[2], nil
+}
+
+// seal AES-GCM加密，结果为随机nonce加密文
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open 解密 seal 的结果
+func open(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
+
+// newGCM 创建AES-256-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes", KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,301 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKey 返回每个字节都为 b 的测试密钥
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+// newTestKeyring 创建包含一个 active 数据密钥和盲索引密钥的密钥环
+func newTestKeyring(id string, key []byte) *Keyring {
+	k := NewKeyring()
+	k.Add(id, key, true)
+	k.SetIndexKey(testKey(0x01))
+	return k
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	k := newTestKeyring("key-1", testKey(0x11))
+	values := []interface{}{"13812345678", "ann@example.com", float64(42), true, []interface{}{"a", "b"}}
+	for _, value := range values {
+		envelope, err := Seal(k, "phone", value)
+		if err != nil {
+			t.Fatalf("Seal(%v) error = %v", value, err)
+		}
+		token, mask, ok := Envelope(envelope)
+		if !ok {
+			t.Fatalf("Envelope(%v) ok = false", envelope)
+		}
+		if mask != Mask(value) {
+			t.Errorf("mask = %q, want %q", mask, Mask(value))
+		}
+		if id, err := KeyID(token); err != nil || id != "key-1" {
+			t.Errorf("KeyID() = %q, %v, want key-1", id, err)
+		}
+
+		got, err := Open(k, "phone", envelope)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		want, _ := json.Marshal(value)
+		gotJSON, _ := json.Marshal(got)
+		if string(gotJSON) != string(want) {
+			t.Errorf("Open() = %s, want %s", gotJSON, want)
+		}
+	}
+}
+
+func TestSealUsesRandomNonce(t *testing.T) {
+	k := newTestKeyring("key-1", testKey(0x11))
+	first, err := Seal(k, "phone", "13812345678")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	second, err := Seal(k, "phone", "13812345678")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if first[EnvelopeKey] == second[EnvelopeKey] {
+		t.Error("Seal() returned the same ciphertext twice")
+	}
+	if first[IndexKey] != second[IndexKey] {
+		t.Errorf("blind index = %v and %v, want equal", first[IndexKey], second[IndexKey])
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	k := newTestKeyring("key-1", testKey(0x11))
+	envelope, err := Seal(k, "phone", "13812345678")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	token := envelope[EnvelopeKey].(string)
+
+	// 修改密文中间的一个字节
+	prefix := tokenVersion + ".key-1."
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(token, prefix))
+	if err != nil {
+		t.Fatalf("invalid token: %v", err)
+	}
+	sealed[len(sealed)/2] ^= 0x01
+	tampered := prefix + base64.RawStdEncoding.EncodeToString(sealed)
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		field   string
+		token   string
+		wantErr error
+	}{
+		{name: "tampered ciphertext", keyring: k, field: "phone", token: tampered},
+		{name: "wrong key", keyring: newTestKeyring("key-1", testKey(0x22)), field: "phone", token: token},
+		{name: "unknown key", keyring: newTestKeyring("key-2", testKey(0x11)), field: "phone", token: token, wantErr: ErrUnknownKey},
+		{name: "moved to another field", keyring: k, field: "email", token: token},
+		{name: "invalid format", keyring: k, field: "phone", token: "v2.key-1.abc"},
+		{name: "truncated", keyring: k, field: "phone", token: prefix + "AAAA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(tt.keyring, tt.field, map[string]interface{}{EnvelopeKey: tt.token})
+			if err == nil {
+				t.Fatal("Open() error = nil, want error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Open() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := Open(k, "phone", map[string]interface{}{"value": "13812345678"}); err == nil {
+		t.Error("Open() of a plain value error = nil, want error")
+	}
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	master := testKey(0x33)
+	dataKey, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	wrapped, err := Wrap(master, dataKey, "key-1")
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+
+	got, err := Unwrap(master, wrapped, "key-1")
+	if err != nil {
+		t.Fatalf("Unwrap() error = %v", err)
+	}
+	if !bytes.Equal(got, dataKey) {
+		t.Error("Unwrap() returned a different data key")
+	}
+
+	if _, err := Unwrap(testKey(0x44), wrapped, "key-1"); err == nil {
+		t.Error("Unwrap() with the wrong master key error = nil, want error")
+	}
+	if _, err := Unwrap(master, wrapped, "key-2"); err == nil {
+		t.Error("Unwrap() with another key id error = nil, want error")
+	}
+	if _, err := Unwrap(master, "not base64!", "key-1"); err == nil {
+		t.Error("Unwrap() of invalid data error = nil, want error")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	valid := base64.StdEncoding.EncodeToString(testKey(0x55))
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"surrounding whitespace", " " + valid + "\n", false},
+		{"not base64", "not a key", true},
+		{"too short", base64.StdEncoding.EncodeToString(make([]byte, 16)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKey(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(key, testKey(0x55)) {
+				t.Error("ParseKey() returned a different key")
+			}
+		})
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	k := newTestKeyring("key-1", testKey(0x11))
+
+	// HMAC-SHA256(0x01 * 32, "phone\x0013812345678") 的前16字节
+	want := "290fe20a4ce8106d40c49540624865b4"
+	for _, value := range []interface{}{"13812345678", " 138-1234-5678 ", "(138) 1234 5678", float64(13812345678)} {
+		got, ok := k.BlindIndex("phone", value)
+		if !ok || got != want {
+			t.Errorf("BlindIndex(%v) = %s, %v, want %s", value, got, ok, want)
+		}
+	}
+
+	email, _ := k.BlindIndex("email", "Ann@Example.com")
+	if got, _ := k.BlindIndex("email", " ann@example.COM"); got != email {
+		t.Errorf("BlindIndex() differs by case: %s and %s", got, email)
+	}
+	if other, _ := k.BlindIndex("other", "ann@example.com"); other == email {
+		t.Error("BlindIndex() is the same for different fields")
+	}
+	if got, _ := k.BlindIndex("phone", "13812345679"); got == want {
+		t.Error("BlindIndex() is the same for different values")
+	}
+
+	for _, value := range []interface{}{"", "  ", nil, []interface{}{"a"}, map[string]interface{}{}} {
+		if got, ok := k.BlindIndex("phone", value); ok {
+			t.Errorf("BlindIndex(%v) = %s, want no index", value, got)
+		}
+	}
+	if got, ok := NewKeyring().BlindIndex("phone", "13812345678"); ok {
+		t.Errorf("BlindIndex() without an index key = %s, want no index", got)
+	}
+	if got, ok := KeyedIndex(testKey(0x01), "phone", "138 1234 5678"); !ok || got != want {
+		t.Errorf("KeyedIndex() = %s, %v, want %s", got, ok, want)
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		want   string
+		wantOK bool
+	}{
+		{"phone", "13812345678", "13812345678", true},
+		{"formatted phone", " +86 (138) 1234-5678 ", "+8613812345678", true},
+		{"tabs and newlines", "138\t1234\n5678\r", "13812345678", true},
+		{"email", " Ann.Lee@Example.COM ", "ann.lee@example.com", true},
+		{"unicode", "Ä Ö", "äö", true},
+		{"number", float64(42), "42", true},
+		{"large number", float64(13812345678), "13812345678", true},
+		{"bool", true, "true", true},
+		{"empty", "", "", false},
+		{"only separators", " - () ", "", false},
+		{"nil", nil, "", false},
+		{"list", []interface{}{"a"}, "", false},
+		{"object", map[string]interface{}{"a": "b"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NormalizeValue(tt.value)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("NormalizeValue(%v) = %q, %v, want %q, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"phone", "13812345678", "138****5678"},
+		{"long", "6222021234567890123", "622************0123"},
+		{"email", "ann.lee@example.com", "a****@example.com"},
+		{"unicode email", "张三@example.com", "张****@example.com"},
+		{"leading at", "@example.com", "@ex*****.com"},
+		{"ten characters", "1234567890", "12******90"},
+		{"seven characters", "1234567", "12***67"},
+		{"six characters", "abcdef", "a****f"},
+		{"unicode name", "张三丰", "张*丰"},
+		{"two characters", "ab", "**"},
+		{"empty", "", ""},
+		{"nil", nil, ""},
+		{"number", float64(42), "**"},
+		{"large number", float64(13812345678), "138****5678"},
+		{"json number", json.Number("13812345678"), "138****5678"},
+		{"bool", true, "t**e"},
+		{"object", map[string]interface{}{"a": "b"}, "****"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mask(tt.value); got != tt.want {
+				t.Errorf("Mask(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskJSON(t *testing.T) {
+	k := newTestKeyring("key-1", testKey(0x11))
+	envelope, err := Seal(k, "phone", "13812345678")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	data, _ := json.Marshal(map[string]interface{}{"name": "Ann", "phone": envelope})
+
+	tests := []struct {
+		name     string
+		formData string
+		want     string
+	}{
+		{"encrypted field", string(data), `{"name":"Ann","phone":"138****5678"}`},
+		{"no encrypted fields", `{"name":"Ann"}`, `{"name":"Ann"}`},
+		{"invalid json", `{"$enc":`, `{"$enc":`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaskJSON(tt.formData); got != tt.want {
+				t.Errorf("MaskJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package formguard
+
+import (
+	"sync"
+	"time"
+)
+
+// limiterSweepSize 计数器超过该数量时清理过期的窗口
+const limiterSweepSize = 10000
+
+// RateLimiter 按键的固定窗口计数限流器，多个实例之间不共享计数
+type RateLimiter struct {
+	mu       sync.Mutex
+	window   time.Duration
+	counters map[string]*windowCounter
+}
+
+// windowCounter 单个键在当前窗口内的计数
+type windowCounter struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimiter 创建限流器
+func NewRateLimiter(window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		window:   window,
+		counters: make(map[string]*windowCounter),
+	}
+}
+
+// Allow 记录一次请求，当前窗口内的请求数超过 limit 时返回false，limit 不大于0时不限制
+func (l *RateLimiter) Allow(key string, limit int, now time.Time) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.counters) >= limiterSweepSize {
+		l.sweep(now)
+	}
+	counter, ok := l.counters[key]
+	if !ok || now.Sub(counter.start) >= l.window {
+		counter = &windowCounter{start: now}
+		l.counters[key] = counter
+	}
+	counter.count++
+	return counter.count <= limit
+}
+
+// sweep 删除已过期的窗口
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, counter := range l.counters {
+		if now.Sub(counter.start) >= l.window {
+			delete(l.counters, key)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package formguard
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/bits"
+)
+
+// maxProofOfWorkNonceLen 工作量证明答案的最大长度
+const maxProofOfWorkNonceLen = 32
+
+// NewChallenge 生成工作量证明的随机题目
+func NewChallenge() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic("formguard: failed to generate challenge: " + err.Error())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// CheckProofOfWork 校验工作量证明：SHA-256(challenge + ":" + nonce) 至少有 difficulty 个前导零比特
+func CheckProofOfWork(challenge string, difficulty int, nonce string) bool {
+	if challenge == "" || nonce == "" || len(nonce) > maxProofOfWorkNonceLen {
+		return false
+	}
+	sum := sha256.Sum256([]byte(challenge + ":" + nonce))
+	return leadingZeroBits(sum[:]) >= difficulty
+}
+
+// leadingZeroBits 计算前导零比特数
+func leadingZeroBits(data []byte) int {
+	count := 0
+	for _, b := range data {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
@@ -0,0 +1,97 @@
+// Package formguard 提供弹窗表单的防垃圾提交工具：签名表单令牌、工作量证明、图片验证码和限流计数
+package formguard
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 表单令牌校验错误
+var (
+	ErrInvalidToken = errors.New("invalid form token")
+	ErrExpiredToken = errors.New("form token expired")
+)
+
+// maxTokenLen 令牌的最大长度，超过时不做解码
+const maxTokenLen = 1024
+
+// Claims 表单令牌内容，在注入弹窗时签发，提交时原样带回
+type Claims struct {
+	PopupID    string `json:"p"`
+	VisitorID  string `json:"v,omitempty"` // 签发时的访客ID，提交时必须相同
+	IssuedAt   int64  `json:"t"`           // 签发时间，Unix毫秒
+	Challenge  string `json:"c,omitempty"` // 工作量证明的题目，未启用时为空
+	Difficulty int    `json:"d,omitempty"` // 工作量证明要求的前导零比特数
+}
+
+// Issued 返回签发时间
+func (c *Claims) Issued() time.Time {
+	return time.UnixMilli(c.IssuedAt)
+}
+
+// Signer 使用HMAC-SHA256签发和校验表单令牌
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner 创建令牌签名器，secret 为空时使用随机密钥，重启后之前签发的令牌失效
+func NewSigner(secret []byte) *Signer {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic("formguard: failed to generate secret: " + err.Error())
+		}
+	}
+	return &Signer{secret: secret}
+}
+
+// Issue 签发令牌，格式为 base64url(JSON).base64url(HMAC)
+func (s *Signer) Issue(claims Claims) string {
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded))
+}
+
+// Verify 校验令牌签名和有效期，ttl 为0时不检查有效期
+func (s *Signer) Verify(token string, ttl time.Duration, now time.Time) (*Claims, error) {
+	if token == "" || len(token) > maxTokenLen {
+		return nil, ErrInvalidToken
+	}
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.sign(encoded)) {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.PopupID == "" || claims.IssuedAt <= 0 {
+		return nil, ErrInvalidToken
+	}
+	// 允许少量时钟误差，签发时间不能明显晚于当前时间
+	if claims.Issued().After(now.Add(time.Minute)) {
+		return nil, ErrInvalidToken
+	}
+	if ttl > 0 && now.Sub(claims.Issued()) > ttl {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+// sign 计算载荷的HMAC
+func (s *Signer) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"proxy-enhancer-ultra/internal/services"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+// AuditHandler 审计日志处理器（管理员功能）
+type AuditHandler struct {
+	BaseHandler
+	auditService *services.AuditService
+	logger       logger.Logger
+}
+
+// NewAuditHandler 创建新的审计日志处理器
+func NewAuditHandler(auditService *services.AuditService, logger logger.Logger) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// ListAuditLogs 获取审计日志列表（管理员）
+func (h *AuditHandler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// 设置默认值
+	page := 1
+	pageSize := 20
+
+	if p, err := strconv.Atoi(query.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if ps, err := strconv.Atoi(query.Get("page_size")); err == nil && ps > 0 && ps <= 100 {
+		pageSize = ps
+	}
+
+	filter := &services.AuditLogFilter{
+		Action:       query.Get("action"),
+		ResourceType: query.Get("resource_type"),
+		ResourceID:   query.Get("resource_id"),
+	}
+	if actorID := query.Get("actor_id"); actorID != "" {
+		id, err := uuid.Parse(actorID)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid actor ID")
+			return
+		}
+		filter.ActorID = &id
+	}
+	if from := query.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid from time, expected RFC3339")
+			return
+		}
+		filter.From = &t
+	}
+	if to := query.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid to time, expected RFC3339")
+			return
+		}
+		filter.To = &t
+	}
+
+	logs, total, err := h.auditService.ListAuditLogs(page, pageSize, filter)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to list audit logs")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve audit logs")
+		return
+	}
+
+	// 计算分页信息
+	totalPages := (int(total) + pageSize - 1) / pageSize
+
+	responseData := map[string]interface{}{
+		"audit_logs": logs,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"page_size":   pageSize,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	}
+	h.respondWithSuccess(w, http.StatusOK, "Audit logs retrieved successfully", responseData)
+}
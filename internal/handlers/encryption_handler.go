@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"proxy-enhancer-ultra/internal/services"
+	"proxy-enhancer-ultra/pkg/logger"
+)
+
+// EncryptionHandler 字段加密管理处理器（管理员功能）
+type EncryptionHandler struct {
+	BaseHandler
+	encryptionService *services.EncryptionService
+	logger            logger.Logger
+}
+
+// NewEncryptionHandler 创建新的字段加密管理处理器
+func NewEncryptionHandler(encryptionService *services.EncryptionService, logger logger.Logger) *EncryptionHandler {
+	return &EncryptionHandler{
+		encryptionService: encryptionService,
+		logger:            logger,
+	}
+}
+
+// GetStatus 获取字段加密配置、数据密钥和拥有解密权限的角色
+func (h *EncryptionHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.encryptionService.GetStatus()
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to get encryption status")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve encryption status")
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Encryption status retrieved successfully", status)
+}
+
+// RotateDataKey 轮换数据密钥，已有的提交在后台重新加密
+func (h *EncryptionHandler) RotateDataKey(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requestActor(r)
+	if !ok {
+		h.respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	key, err := h.encryptionService.RotateDataKey(actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to rotate data key")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Data key rotated successfully", key)
+}
+
+// UpdateDecryptRoles 设置拥有解密权限的角色
+func (h *EncryptionHandler) UpdateDecryptRoles(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requestActor(r)
+	if !ok {
+		h.respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req services.UpdateDecryptRolesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	roles, err := h.encryptionService.UpdateDecryptRoles(&req, actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"roles": req.Roles,
+			"error": err.Error(),
+		}).Error("Failed to update decrypt roles")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Decrypt roles updated successfully", map[string]interface{}{"roles": roles})
+}
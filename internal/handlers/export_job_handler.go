@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"proxy-enhancer-ultra/internal/middleware"
+	"proxy-enhancer-ultra/internal/services"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ExportJobHandler 导出任务处理器
+type ExportJobHandler struct {
+	BaseHandler
+	exportJobService *services.ExportJobService
+	logger           logger.Logger
+}
+
+// NewExportJobHandler 创建新的导出任务处理器
+func NewExportJobHandler(exportJobService *services.ExportJobService, logger logger.Logger) *ExportJobHandler {
+	return &ExportJobHandler{
+		exportJobService: exportJobService,
+		logger:           logger,
+	}
+}
+
+// CreateExportJob 创建导出任务，任务在后台执行，通过任务详情查询进度
+func (h *ExportJobHandler) CreateExportJob(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.CreateExportJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Format == "" {
+		req.Format = services.ExportFormatCSV
+	}
+	if req.Format == "excel" {
+		req.Format = services.ExportFormatXLSX
+	}
+	req.UserID = owner.UserID
+	req.Username = owner.Username
+
+	job, err := h.exportJobService.CreateJob(&req)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"popup_id": req.PopupID,
+			"format":   req.Format,
+			"error":    err.Error(),
+		}).Error("Failed to create export job")
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrDecryptForbidden) {
+			status = http.StatusForbidden
+		}
+		h.respondWithError(w, status, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusAccepted, "Export job created successfully", job)
+}
+
+// ListExportJobs 获取当前用户的导出任务列表
+func (h *ExportJobHandler) ListExportJobs(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	page := 1
+	pageSize := 20
+	if p, err := strconv.Atoi(query.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if ps, err := strconv.Atoi(query.Get("pageSize")); err == nil && ps > 0 && ps <= 100 {
+		pageSize = ps
+	}
+
+	jobs, total, err := h.exportJobService.ListJobs(owner.UserID, page, pageSize)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to list export jobs")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve export jobs")
+		return
+	}
+
+	responseData := map[string]interface{}{
+		"jobs":     jobs,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}
+	h.respondWithSuccess(w, http.StatusOK, "Export jobs retrieved successfully", responseData)
+}
+
+// GetExportJob 获取导出任务详情和进度
+func (h *ExportJobHandler) GetExportJob(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid export job ID")
+		return
+	}
+
+	job, err := h.exportJobService.GetJob(id, owner)
+	if err != nil {
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Export job retrieved successfully", job)
+}
+
+// DownloadExportJob 下载已完成任务的导出文件
+func (h *ExportJobHandler) DownloadExportJob(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid export job ID")
+		return
+	}
+
+	job, content, err := h.exportJobService.OpenArtifact(id, owner)
+	if err != nil {
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", services.ExportContentType(job.Format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": services.ArtifactName(job)}))
+	w.Header().Set("Content-Length", strconv.FormatInt(job.FileSize, 10))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"job_id": id,
+			"error":  err.Error(),
+		}).Warn("Failed to send export file")
+	}
+}
+
+// DeleteExportJob 删除导出任务，正在执行的任务会被中止
+func (h *ExportJobHandler) DeleteExportJob(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid export job ID")
+		return
+	}
+
+	if err := h.exportJobService.DeleteJob(id, owner); err != nil {
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Export job deleted successfully", nil)
+}
+
+// owner 返回当前用户，未登录时写入错误响应并返回 false
+func (h *ExportJobHandler) owner(w http.ResponseWriter, r *http.Request) (services.ExportJobOwner, bool) {
+	userID, username, role, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return services.ExportJobOwner{}, false
+	}
+	return services.ExportJobOwner{UserID: userID, Username: username, IsAdmin: role == "admin"}, true
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"proxy-enhancer-ultra/internal/middleware"
+	"proxy-enhancer-ultra/internal/services"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// multipartMemory 解析上传请求时保存在内存中的最大字节数，超过的部分写入临时文件
+const multipartMemory = 8 << 20
+
+// multipartOverhead 上传请求中文件以外的表单字段和分隔符允许的字节数
+const multipartOverhead = 1 << 20
+
+// FileHandler 文件管理处理器
+type FileHandler struct {
+	BaseHandler
+	fileService *services.FileService
+	logger      logger.Logger
+}
+
+// NewFileHandler 创建新的文件管理处理器
+func NewFileHandler(fileService *services.FileService, logger logger.Logger) *FileHandler {
+	return &FileHandler{
+		fileService: fileService,
+		logger:      logger,
+	}
+}
+
+// UploadFile 上传文件，表单字段 file 为文件内容，category 为可选的分类
+func (h *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.fileService.MaxUploadSize()+multipartOverhead)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		if isRequestTooLarge(err) {
+			h.respondWithError(w, http.StatusRequestEntityTooLarge, "File too large")
+			return
+		}
+		h.respondWithError(w, http.StatusBadRequest, "Invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	content, header, err := r.FormFile("file")
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "File is required")
+		return
+	}
+	defer content.Close()
+
+	req := &services.UploadFileRequest{
+		Reader:   content,
+		Filename: header.Filename,
+		Size:     header.Size,
+		Category: r.FormValue("category"),
+	}
+	if userID, _, _, ok := middleware.GetUserFromContext(r.Context()); ok {
+		req.UploadedBy = &userID
+	}
+
+	file, err := h.fileService.Upload(req)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"filename": header.Filename,
+			"size":     header.Size,
+			"error":    err.Error(),
+		}).Error("Failed to upload file")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusCreated, "File uploaded successfully", file)
+}
+
+// ListFiles 获取文件列表
+func (h *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// 设置默认值
+	page := 1
+	pageSize := 20
+
+	if p, err := strconv.Atoi(query.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if ps, err := strconv.Atoi(query.Get("pageSize")); err == nil && ps > 0 && ps <= 100 {
+		pageSize = ps
+	}
+
+	filter := &services.FileFilter{
+		Category: query.Get("category"),
+		Type:     query.Get("type"),
+	}
+	if popupID := query.Get("popup_id"); popupID != "" {
+		id, err := uuid.Parse(popupID)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
+			return
+		}
+		filter.PopupID = &id
+	}
+	if submissionID := query.Get("submission_id"); submissionID != "" {
+		id, err := uuid.Parse(submissionID)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid submission ID")
+			return
+		}
+		filter.SubmissionID = &id
+	}
+
+	files, total, err := h.fileService.ListFiles(page, pageSize, filter)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to list files")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve files")
+		return
+	}
+
+	responseData := map[string]interface{}{
+		"files":    files,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}
+	h.respondWithSuccess(w, http.StatusOK, "Files retrieved successfully", responseData)
+}
+
+// GetFile 获取文件信息
+func (h *FileHandler) GetFile(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid file ID")
+		return
+	}
+
+	file, err := h.fileService.GetFile(id)
+	if err != nil {
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "File retrieved successfully", file)
+}
+
+// DownloadFile 下载文件，始终以附件形式返回，避免上传的文件在管理后台域名下被浏览器直接渲染
+func (h *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid file ID")
+		return
+	}
+
+	file, content, err := h.fileService.OpenFile(id)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"file_id": id,
+			"error":   err.Error(),
+		}).Warn("Failed to open file")
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	defer content.Close()
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.OriginalName}))
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"file_id": id,
+			"error":   err.Error(),
+		}).Warn("Failed to send file")
+	}
+}
+
+// DeleteFile 删除文件
+func (h *FileHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid file ID")
+		return
+	}
+
+	if err := h.fileService.DeleteFile(id); err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"file_id": id,
+			"error":   err.Error(),
+		}).Error("Failed to delete file")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "File deleted successfully", nil)
+}
+
+// GetFileStats 获取文件统计
+func (h *FileHandler) GetFileStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.fileService.GetFileStats()
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to get file stats")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve file stats")
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "File stats retrieved successfully", stats)
+}
+
+// CleanupFiles 清理早于指定天数的文件
+func (h *FileHandler) CleanupFiles(w http.ResponseWriter, r *http.Request) {
+	var req services.CleanupFilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result, err := h.fileService.CleanupFiles(&req)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to clean up files")
+		status := http.StatusBadRequest
+		if result != nil {
+			status = http.StatusInternalServerError
+		}
+		h.respondWithError(w, status, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Files cleaned up successfully", result)
+}
+
+// isRequestTooLarge 判断是否因超过 MaxBytesReader 的限制而读取失败
+func isRequestTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
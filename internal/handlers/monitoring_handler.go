@@ -9,6 +9,7 @@ import (
 	"proxy-enhancer-ultra/internal/services"
 	"proxy-enhancer-ultra/pkg/logger"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -139,13 +140,13 @@ func (h *MonitoringHandler) GetProxyMetricsHistory(w http.ResponseWriter, r *htt
 // GetProxyStats 获取特定代理的统计信息
 func (h *MonitoringHandler) GetProxyStats(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	proxyConfigID, err := strconv.ParseUint(vars["proxy_config_id"], 10, 32)
+	proxyConfigID, err := uuid.Parse(vars["proxy_config_id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid proxy config ID")
 		return
 	}
 
-	stats, err := h.monitoringService.GetProxyStats(uint(proxyConfigID))
+	stats, err := h.monitoringService.GetProxyStats(proxyConfigID)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"proxy_config_id": proxyConfigID,
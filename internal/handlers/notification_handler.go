@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"proxy-enhancer-ultra/internal/services"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// NotificationHandler 提交通知处理器
+type NotificationHandler struct {
+	BaseHandler
+	notificationService *services.NotificationService
+	mailService         *services.MailService
+	logger              logger.Logger
+}
+
+// NewNotificationHandler 创建新的提交通知处理器
+func NewNotificationHandler(notificationService *services.NotificationService, mailService *services.MailService, logger logger.Logger) *NotificationHandler {
+	return &NotificationHandler{
+		notificationService: notificationService,
+		mailService:         mailService,
+		logger:              logger,
+	}
+}
+
+// GetPopupNotification 获取弹窗的通知设置
+func (h *NotificationHandler) GetPopupNotification(w http.ResponseWriter, r *http.Request) {
+	popupID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
+		return
+	}
+
+	settings, err := h.notificationService.GetSettings(popupID)
+	if err != nil {
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Notification settings retrieved successfully", settings)
+}
+
+// UpdatePopupNotification 保存弹窗的通知设置
+func (h *NotificationHandler) UpdatePopupNotification(w http.ResponseWriter, r *http.Request) {
+	popupID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
+		return
+	}
+
+	var req services.UpdateNotificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Actor, _ = requestActor(r)
+
+	settings, err := h.notificationService.UpdateSettings(popupID, &req)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"popup_id": popupID,
+			"error":    err.Error(),
+		}).Error("Failed to update notification settings")
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrDecryptForbidden) {
+			status = http.StatusForbidden
+		}
+		h.respondWithError(w, status, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Notification settings updated successfully", settings)
+}
+
+// GetEmailConfig 获取服务器的邮件配置，不包含密码
+func (h *NotificationHandler) GetEmailConfig(w http.ResponseWriter, r *http.Request) {
+	h.respondWithSuccess(w, http.StatusOK, "Email config retrieved successfully", h.mailService.GetConfig())
+}
+
+// TestEmail 发送测试邮件，可以在请求中提供尚未保存的SMTP配置
+func (h *NotificationHandler) TestEmail(w http.ResponseWriter, r *http.Request) {
+	var req services.TestEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.mailService.SendTest(r.Context(), &req); err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"to":    req.To,
+			"error": err.Error(),
+		}).Warn("Test email failed")
+		h.respondWithSuccess(w, http.StatusOK, "Test email failed", map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Test email sent successfully", map[string]interface{}{
+		"success": true,
+		"message": "Test email sent",
+	})
+}
@@ -5,12 +5,17 @@ import (
 	"net/http"
 	"strconv"
 
+	"proxy-enhancer-ultra/internal/proxy"
 	"proxy-enhancer-ultra/internal/services"
 	"proxy-enhancer-ultra/pkg/logger"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+// maxEventBeaconSize 事件上报请求体的最大字节数
+const maxEventBeaconSize = 16 << 10
+
 // PopupHandler 弹窗处理器
 type PopupHandler struct {
 	popupService *services.PopupService
@@ -34,8 +39,8 @@ func (h *PopupHandler) CreatePopup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 基本验证
-	if req.ProxyConfigID == 0 {
-		h.respondWithError(w, http.StatusBadRequest, "Proxy config ID is required")
+	if req.ProxyConfigID == uuid.Nil && len(req.ProxyConfigIDs) == 0 && !req.IsGlobal {
+		h.respondWithError(w, http.StatusBadRequest, "Proxy config ID is required unless the popup is global")
 		return
 	}
 
@@ -62,10 +67,11 @@ func (h *PopupHandler) CreatePopup(w http.ResponseWriter, r *http.Request) {
 	popup, err := h.popupService.CreatePopup(&req)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
-			"proxy_config_id": req.ProxyConfigID,
-			"title":           req.Title,
-			"popup_type":      req.PopupType,
-			"error":           err.Error(),
+			"proxy_config_id":  req.ProxyConfigID,
+			"proxy_config_ids": req.ProxyConfigIDs,
+			"title":            req.Title,
+			"popup_type":       req.PopupType,
+			"error":            err.Error(),
 		}).Error("Failed to create popup")
 		h.respondWithError(w, http.StatusBadRequest, err.Error())
 		return
@@ -80,13 +86,13 @@ func (h *PopupHandler) CreatePopup(w http.ResponseWriter, r *http.Request) {
 // GetPopup 获取弹窗
 func (h *PopupHandler) GetPopup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
 		return
 	}
 
-	popup, err := h.popupService.GetPopup(uint(id))
+	popup, err := h.popupService.GetPopup(id)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"popup_id": id,
@@ -104,7 +110,7 @@ func (h *PopupHandler) GetPopup(w http.ResponseWriter, r *http.Request) {
 // UpdatePopup 更新弹窗
 func (h *PopupHandler) UpdatePopup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
 		return
@@ -116,7 +122,7 @@ func (h *PopupHandler) UpdatePopup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.popupService.UpdatePopup(uint(id), &req); err != nil {
+	if err := h.popupService.UpdatePopup(id, &req); err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"popup_id": id,
 			"error":    err.Error(),
@@ -133,13 +139,13 @@ func (h *PopupHandler) UpdatePopup(w http.ResponseWriter, r *http.Request) {
 // DeletePopup 删除弹窗
 func (h *PopupHandler) DeletePopup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
 		return
 	}
 
-	if err := h.popupService.DeletePopup(uint(id)); err != nil {
+	if err := h.popupService.DeletePopup(id); err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"popup_id": id,
 			"error":    err.Error(),
@@ -159,13 +165,12 @@ func (h *PopupHandler) ListPopups(w http.ResponseWriter, r *http.Request) {
 	pageStr := r.URL.Query().Get("page")
 	pageSizeStr := r.URL.Query().Get("page_size")
 	proxyConfigIDStr := r.URL.Query().Get("proxy_config_id")
-	popupType := r.URL.Query().Get("popup_type")
 	enabledStr := r.URL.Query().Get("enabled")
 
 	// 设置默认值
 	page := 1
 	pageSize := 10
-	var proxyConfigID *uint
+	var proxyConfigID *uuid.UUID
 	var enabled *bool
 
 	// 解析页码
@@ -184,9 +189,8 @@ func (h *PopupHandler) ListPopups(w http.ResponseWriter, r *http.Request) {
 
 	// 解析代理配置ID
 	if proxyConfigIDStr != "" {
-		if pcid, err := strconv.ParseUint(proxyConfigIDStr, 10, 32); err == nil {
-			id := uint(pcid)
-			proxyConfigID = &id
+		if pcid, err := uuid.Parse(proxyConfigIDStr); err == nil {
+			proxyConfigID = &pcid
 		}
 	}
 
@@ -197,7 +201,7 @@ func (h *PopupHandler) ListPopups(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	popups, total, err := h.popupService.ListPopups(page, pageSize, proxyConfigID, popupType, enabled)
+	popups, total, err := h.popupService.ListPopups(page, pageSize, proxyConfigID, enabled)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"error": err.Error(),
@@ -223,13 +227,13 @@ func (h *PopupHandler) ListPopups(w http.ResponseWriter, r *http.Request) {
 // TogglePopupStatus 切换弹窗状态
 func (h *PopupHandler) TogglePopupStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
 		return
 	}
 
-	if err := h.popupService.TogglePopupStatus(uint(id)); err != nil {
+	if err := h.popupService.TogglePopupStatus(id); err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"popup_id": id,
 			"error":    err.Error(),
@@ -246,13 +250,13 @@ func (h *PopupHandler) TogglePopupStatus(w http.ResponseWriter, r *http.Request)
 // GetPopupsByProxyConfig 根据代理配置获取弹窗
 func (h *PopupHandler) GetPopupsByProxyConfig(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	proxyConfigID, err := strconv.ParseUint(vars["proxy_config_id"], 10, 32)
+	proxyConfigID, err := uuid.Parse(vars["proxy_config_id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid proxy config ID")
 		return
 	}
 
-	popups, err := h.popupService.GetPopupsByProxyConfig(uint(proxyConfigID))
+	popups, err := h.popupService.GetPopupsByProxyConfig(proxyConfigID)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"proxy_config_id": proxyConfigID,
@@ -270,13 +274,13 @@ func (h *PopupHandler) GetPopupsByProxyConfig(w http.ResponseWriter, r *http.Req
 // GetPopupStats 获取弹窗统计信息
 func (h *PopupHandler) GetPopupStats(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
 		return
 	}
 
-	stats, err := h.popupService.GetPopupStats(uint(id))
+	stats, err := h.popupService.GetPopupStats(id)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"popup_id": id,
@@ -291,6 +295,122 @@ func (h *PopupHandler) GetPopupStats(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetPopupPerformance 获取弹窗按天的曝光、点击、关闭和提交数据
+func (h *PopupHandler) GetPopupPerformance(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
+		return
+	}
+
+	days := 30
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		if d, err := strconv.Atoi(daysStr); err == nil && d > 0 && d <= 365 {
+			days = d
+		}
+	}
+
+	performance, err := h.popupService.GetPopupPerformance(id, days)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"popup_id": id,
+			"error":    err.Error(),
+		}).Error("Failed to get popup performance")
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": performance,
+	})
+}
+
+// TrackEvents 接收代理页面通过 sendBeacon 上报的弹窗事件，挂载在代理数据面
+func (h *PopupHandler) TrackEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	proxyConfig := proxy.ProxyConfigFromRequest(r)
+	if proxyConfig == nil {
+		h.respondWithError(w, http.StatusNotFound, "Proxy configuration not found")
+		return
+	}
+
+	// sendBeacon 可能以 text/plain 发送，不校验 Content-Type
+	var batch services.PopupEventBatch
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventBeaconSize)).Decode(&batch); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if _, err := h.popupService.RecordEvents(proxyConfig.ID, proxy.VisitorID(r), batch.Events); err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"proxy_config_id": proxyConfig.ID,
+			"error":           err.Error(),
+		}).Warn("Failed to record popup events")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewPopup 预览弹窗，传入proxy_config_id时在代理页面中预览
+func (h *PopupHandler) PreviewPopup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
+		return
+	}
+
+	query := r.URL.Query()
+	req := services.PopupPreviewRequest{
+		URL:       query.Get("url"),
+		UserAgent: query.Get("user_agent"),
+		Locale:    query.Get("locale"),
+	}
+	if proxyConfigIDStr := query.Get("proxy_config_id"); proxyConfigIDStr != "" {
+		proxyConfigID, err := uuid.Parse(proxyConfigIDStr)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid proxy config ID")
+			return
+		}
+		req.ProxyConfigID = &proxyConfigID
+	}
+	if variantIDStr := query.Get("variant_id"); variantIDStr != "" {
+		variantID, err := uuid.Parse(variantIDStr)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid variant ID")
+			return
+		}
+		req.VariantID = &variantID
+	}
+	if fullPipelineStr := query.Get("full_pipeline"); fullPipelineStr != "" {
+		if fullPipeline, err := strconv.ParseBool(fullPipelineStr); err == nil {
+			req.FullPipeline = fullPipeline
+		}
+	}
+
+	preview, err := h.popupService.PreviewPopup(r.Context(), id, &req)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"popup_id": id,
+			"error":    err.Error(),
+		}).Error("Failed to preview popup")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": preview,
+	})
+}
+
 // respondWithError 返回错误响应
 func (h *PopupHandler) respondWithError(w http.ResponseWriter, code int, message string) {
 	h.respondWithJSON(w, code, map[string]string{"error": message})
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"proxy-enhancer-ultra/internal/services"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxTranslationBundleSize 翻译文件导入请求体的最大字节数
+const maxTranslationBundleSize = 8 << 20
+
+// ListTranslations 获取弹窗的翻译列表
+func (h *PopupHandler) ListTranslations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
+		return
+	}
+
+	translations, err := h.popupService.ListTranslations(id)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"popup_id": id,
+			"error":    err.Error(),
+		}).Error("Failed to list popup translations")
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": translations,
+	})
+}
+
+// SaveTranslation 创建或替换弹窗在某个语言下的翻译
+func (h *PopupHandler) SaveTranslation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
+		return
+	}
+
+	var req services.PopupTranslationInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	translation, err := h.popupService.SaveTranslation(id, vars["locale"], &req)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"popup_id": id,
+			"locale":   vars["locale"],
+			"error":    err.Error(),
+		}).Error("Failed to save popup translation")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": translation,
+	})
+}
+
+// DeleteTranslation 删除弹窗在某个语言下的翻译
+func (h *PopupHandler) DeleteTranslation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
+		return
+	}
+
+	if err := h.popupService.DeleteTranslation(id, vars["locale"]); err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"popup_id": id,
+			"locale":   vars["locale"],
+			"error":    err.Error(),
+		}).Error("Failed to delete popup translation")
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Popup translation deleted successfully",
+	})
+}
+
+// ExportTranslations 以JSON文件导出某个语言的翻译，popup_ids 为逗号分隔的弹窗ID，为空时导出所有弹窗
+func (h *PopupHandler) ExportTranslations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	locale := query.Get("locale")
+	if locale == "" {
+		h.respondWithError(w, http.StatusBadRequest, "locale is required")
+		return
+	}
+
+	var popupIDs []uuid.UUID
+	if popupIDsStr := query.Get("popup_ids"); popupIDsStr != "" {
+		for _, idStr := range strings.Split(popupIDsStr, ",") {
+			id, err := uuid.Parse(strings.TrimSpace(idStr))
+			if err != nil {
+				h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
+				return
+			}
+			popupIDs = append(popupIDs, id)
+		}
+	}
+
+	bundle, err := h.popupService.ExportTranslations(locale, popupIDs)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"locale": locale,
+			"error":  err.Error(),
+		}).Error("Failed to export popup translations")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to export popup translations")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=popup-translations-"+bundle.Locale+".json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// ImportTranslations 导入翻译人员填写的翻译文件
+func (h *PopupHandler) ImportTranslations(w http.ResponseWriter, r *http.Request) {
+	var bundle services.TranslationBundle
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTranslationBundleSize)).Decode(&bundle); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid translation bundle")
+		return
+	}
+
+	result, err := h.popupService.ImportTranslations(&bundle)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"locale": bundle.Locale,
+			"error":  err.Error(),
+		}).Error("Failed to import popup translations")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": result,
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"proxy-enhancer-ultra/internal/services"
 	"proxy-enhancer-ultra/pkg/logger"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -64,13 +65,13 @@ func (h *ProxyHandler) CreateProxyConfig(w http.ResponseWriter, r *http.Request)
 // GetProxyConfig 获取代理配置
 func (h *ProxyHandler) GetProxyConfig(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid proxy config ID")
 		return
 	}
 
-	config, err := h.proxyService.GetProxyConfig(uint(id))
+	config, err := h.proxyService.GetProxyConfig(id)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"error": err.Error(),
@@ -88,7 +89,7 @@ func (h *ProxyHandler) GetProxyConfig(w http.ResponseWriter, r *http.Request) {
 // UpdateProxyConfig 更新代理配置
 func (h *ProxyHandler) UpdateProxyConfig(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid proxy config ID")
 		return
@@ -100,7 +101,7 @@ func (h *ProxyHandler) UpdateProxyConfig(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.proxyService.UpdateProxyConfig(uint(id), &updates); err != nil {
+	if err := h.proxyService.UpdateProxyConfig(id, &updates); err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"error": err.Error(),
 			"id":    id,
@@ -117,13 +118,13 @@ func (h *ProxyHandler) UpdateProxyConfig(w http.ResponseWriter, r *http.Request)
 // DeleteProxyConfig 删除代理配置
 func (h *ProxyHandler) DeleteProxyConfig(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid proxy config ID")
 		return
 	}
 
-	if err := h.proxyService.DeleteProxyConfig(uint(id)); err != nil {
+	if err := h.proxyService.DeleteProxyConfig(id); err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"error": err.Error(),
 			"id":    id,
@@ -196,13 +197,13 @@ func (h *ProxyHandler) ListProxyConfigs(w http.ResponseWriter, r *http.Request)
 // ToggleProxyConfig 切换代理配置状态
 func (h *ProxyHandler) ToggleProxyConfig(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid proxy config ID")
 		return
 	}
 
-	if err := h.proxyService.ToggleProxyConfig(uint(id)); err != nil {
+	if err := h.proxyService.ToggleProxyConfig(id); err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"error": err.Error(),
 			"id":    id,
@@ -219,7 +220,7 @@ func (h *ProxyHandler) ToggleProxyConfig(w http.ResponseWriter, r *http.Request)
 // GetProxyStats 获取代理统计信息
 func (h *ProxyHandler) GetProxyStats(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid proxy config ID")
 		return
@@ -243,7 +244,7 @@ func (h *ProxyHandler) GetProxyStats(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	stats, err := h.proxyService.GetProxyStats(uint(id), startTime, endTime)
+	stats, err := h.proxyService.GetProxyStats(id, startTime, endTime)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"error": err.Error(),
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"proxy-enhancer-ultra/internal/services"
+	"proxy-enhancer-ultra/pkg/logger"
+)
+
+// RetentionHandler 数据保留和个人数据删除处理器（管理员功能）
+type RetentionHandler struct {
+	BaseHandler
+	retentionService *services.RetentionService
+	logger           logger.Logger
+}
+
+// NewRetentionHandler 创建新的数据保留处理器
+func NewRetentionHandler(retentionService *services.RetentionService, logger logger.Logger) *RetentionHandler {
+	return &RetentionHandler{
+		retentionService: retentionService,
+		logger:           logger,
+	}
+}
+
+// GetStatus 获取数据保留配置和最近一次清理的结果
+func (h *RetentionHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.retentionService.GetStatus()
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to get retention status")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve retention status")
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Retention status retrieved successfully", status)
+}
+
+// RunRetention 立即执行一次数据保留清理
+func (h *RetentionHandler) RunRetention(w http.ResponseWriter, r *http.Request) {
+	run := h.retentionService.Run()
+	if run.Error != "" {
+		h.respondWithError(w, http.StatusInternalServerError, run.Error)
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Retention run completed", run)
+}
+
+// EraseSubject 删除所有弹窗中包含指定邮箱或手机号的提交
+func (h *RetentionHandler) EraseSubject(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requestActor(r)
+	if !ok {
+		h.respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req services.EraseSubjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result, err := h.retentionService.EraseSubject(&req, actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to erase subject")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	message := "Subject erased successfully"
+	if result.DryRun {
+		message = "Matching submissions found"
+	}
+	h.respondWithSuccess(w, http.StatusOK, message, result)
+}
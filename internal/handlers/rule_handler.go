@@ -35,8 +35,8 @@ func (h *RuleHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 基本验证
-	if req.ProxyConfigID == uuid.Nil {
-		h.respondWithError(w, http.StatusBadRequest, "Proxy config ID is required")
+	if req.ProxyConfigID == uuid.Nil && len(req.ProxyConfigIDs) == 0 && !req.IsGlobal {
+		h.respondWithError(w, http.StatusBadRequest, "Proxy config ID is required unless the rule is global")
 		return
 	}
 
@@ -50,7 +50,7 @@ func (h *RuleHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Action == "" {
+	if req.Action == "" && len(req.Actions) == 0 {
 		h.respondWithError(w, http.StatusBadRequest, "Action is required")
 		return
 	}
@@ -58,9 +58,10 @@ func (h *RuleHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
 	rule, err := h.ruleService.CreateRule(&req)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
-			"proxy_config_id": req.ProxyConfigID,
-			"rule_type":       req.RuleType,
-			"error":           err.Error(),
+			"proxy_config_id":  req.ProxyConfigID,
+			"proxy_config_ids": req.ProxyConfigIDs,
+			"rule_type":        req.RuleType,
+			"error":            err.Error(),
 		}).Error("Failed to create rule")
 		h.respondWithError(w, http.StatusBadRequest, err.Error())
 		return
@@ -96,6 +97,13 @@ func (h *RuleHandler) GetRule(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetRuleSchema 获取规则定义的JSON Schema
+func (h *RuleHandler) GetRuleSchema(w http.ResponseWriter, r *http.Request) {
+	h.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": h.ruleService.GetDefinitionSchema(),
+	})
+}
+
 // UpdateRule 更新规则
 func (h *RuleHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -153,12 +161,14 @@ func (h *RuleHandler) ListRules(w http.ResponseWriter, r *http.Request) {
 	// 解析查询参数
 	pageStr := r.URL.Query().Get("page")
 	pageSizeStr := r.URL.Query().Get("page_size")
+	proxyConfigIDStr := r.URL.Query().Get("proxy_config_id")
 	ruleType := r.URL.Query().Get("rule_type")
 	enabledStr := r.URL.Query().Get("enabled")
 
 	// 设置默认值
 	page := 1
 	pageSize := 10
+	var proxyConfigID *uuid.UUID
 	var enabled *bool
 
 	// 解析页码
@@ -175,6 +185,13 @@ func (h *RuleHandler) ListRules(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// 解析代理配置ID
+	if proxyConfigIDStr != "" {
+		if pcid, err := uuid.Parse(proxyConfigIDStr); err == nil {
+			proxyConfigID = &pcid
+		}
+	}
+
 	// 解析启用状态
 	if enabledStr != "" {
 		if e, err := strconv.ParseBool(enabledStr); err == nil {
@@ -182,7 +199,7 @@ func (h *RuleHandler) ListRules(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	rules, total, err := h.ruleService.ListRules(page, pageSize, ruleType, enabled)
+	rules, total, err := h.ruleService.ListRules(page, pageSize, proxyConfigID, ruleType, enabled)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"error": err.Error(),
@@ -298,6 +315,83 @@ func (h *RuleHandler) UpdateRulePriorities(w http.ResponseWriter, r *http.Reques
 	})
 }
 
+// TestRule 试运行单条已保存的规则，未指定代理配置时使用规则唯一绑定的代理配置
+func (h *RuleHandler) TestRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ruleID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid rule ID format")
+		return
+	}
+
+	var req services.RuleTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.RuleIDs = []uuid.UUID{ruleID}
+	req.Rules = nil
+
+	h.runRuleTest(w, r, &req)
+}
+
+// DryRunRules 试运行规则集，可同时包含已保存规则、未保存的规则定义和弹窗
+func (h *RuleHandler) DryRunRules(w http.ResponseWriter, r *http.Request) {
+	var req services.RuleTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	h.runRuleTest(w, r, &req)
+}
+
+// runRuleTest 执行试运行并返回结果
+func (h *RuleHandler) runRuleTest(w http.ResponseWriter, r *http.Request, req *services.RuleTestRequest) {
+	result, err := h.ruleService.TestRules(r.Context(), req)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"proxy_config_id": req.ProxyConfigID,
+			"url":             req.URL,
+			"error":           err.Error(),
+		}).Error("Failed to test rules")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": result,
+	})
+}
+
+// GetRuleConflicts 检测选择器可能重叠且动作冲突的规则（管理员）
+func (h *RuleHandler) GetRuleConflicts(w http.ResponseWriter, r *http.Request) {
+	var proxyConfigID *uuid.UUID
+	if proxyConfigIDStr := r.URL.Query().Get("proxy_config_id"); proxyConfigIDStr != "" {
+		pcid, err := uuid.Parse(proxyConfigIDStr)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid proxy config ID format")
+			return
+		}
+		proxyConfigID = &pcid
+	}
+
+	conflicts, err := h.ruleService.DetectConflicts(proxyConfigID)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"proxy_config_id": proxyConfigID,
+			"error":           err.Error(),
+		}).Error("Failed to detect rule conflicts")
+		h.respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  conflicts,
+		"total": len(conflicts),
+	})
+}
+
 // respondWithError 返回错误响应
 func (h *RuleHandler) respondWithError(w http.ResponseWriter, code int, message string) {
 	h.respondWithJSON(w, code, map[string]string{"error": message})
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
 
+	"proxy-enhancer-ultra/internal/middleware"
+	"proxy-enhancer-ultra/internal/popupspec"
+	"proxy-enhancer-ultra/internal/proxy"
 	"proxy-enhancer-ultra/internal/services"
 	"proxy-enhancer-ultra/pkg/logger"
 
@@ -12,6 +15,9 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// maxFormStepSize 表单步骤提交请求体的最大字节数
+const maxFormStepSize = 64 << 10
+
 // SubmissionCRUDHandler 提交CRUD操作处理器
 type SubmissionCRUDHandler struct {
 	BaseHandler
@@ -53,23 +59,202 @@ func (h *SubmissionCRUDHandler) CreateSubmission(w http.ResponseWriter, r *http.
 			"ip_address": req.IPAddress,
 			"error":      err.Error(),
 		}).Error("Failed to create submission")
+		if errors.Is(err, services.ErrDuplicateSubmission) {
+			h.respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
 		h.respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if submission.Deduplicated {
+		// 重复提交更新或合并到已有记录，没有创建新记录
+		h.respondWithSuccess(w, http.StatusOK, "Duplicate submission merged into existing submission", submission)
+		return
+	}
 	h.respondWithSuccess(w, http.StatusCreated, "Submission created successfully", submission)
 }
 
+// SubmitFormStep 接收代理页面提交的弹窗表单步骤，挂载在代理数据面
+func (h *SubmissionCRUDHandler) SubmitFormStep(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	proxyConfig := proxy.ProxyConfigFromRequest(r)
+	if proxyConfig == nil {
+		h.respondWithError(w, http.StatusNotFound, "Proxy configuration not found")
+		return
+	}
+
+	var req services.SubmitFormStepRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFormStepSize)).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.PopupID == uuid.Nil {
+		h.respondWithError(w, http.StatusBadRequest, "Popup ID is required")
+		return
+	}
+
+	req.ProxyConfigID = proxyConfig.ID
+	req.VisitorID = proxy.VisitorID(r)
+	req.IPAddress = middleware.GetClientIP(r)
+	req.UserAgent = r.UserAgent()
+	req.Referrer = r.Referer()
+	if cookie, err := r.Cookie(popupspec.StateCookieName); err == nil {
+		// 只使用与提交相同会话的来源，会话已超时的状态属于上一个会话
+		if state, err := popupspec.DecodeVisitorState(cookie.Value); err == nil && state.Session.ID == req.SessionID {
+			req.LandingPage = state.Session.Landing
+			req.ReferrerDomain = state.Session.Referrer
+		}
+	}
+
+	result, err := h.submissionService.SubmitFormStep(&req)
+	if err != nil {
+		fields := map[string]interface{}{
+			"proxy_config_id": proxyConfig.ID,
+			"popup_id":        req.PopupID,
+			"step":            req.Step,
+			"error":           err.Error(),
+		}
+		if status, message := dataPlaneError(err); status == http.StatusInternalServerError {
+			h.logger.WithFields(fields).Error("Failed to submit form step")
+			h.respondWithError(w, status, "Failed to save form step")
+		} else {
+			h.logger.WithFields(fields).Warn("Form step rejected")
+			h.respondWithError(w, status, message)
+		}
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Form step saved successfully", result)
+}
+
+// UploadFormFile 接收代理页面上传的弹窗表单文件，挂载在代理数据面
+// 表单字段 popup_id、field、form_token 和文件 file，返回的文件ID作为字段值随步骤提交
+func (h *SubmissionCRUDHandler) UploadFormFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	proxyConfig := proxy.ProxyConfigFromRequest(r)
+	if proxyConfig == nil {
+		h.respondWithError(w, http.StatusNotFound, "Proxy configuration not found")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, popupspec.MaxFileSize+multipartOverhead)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		if isRequestTooLarge(err) {
+			h.respondWithError(w, http.StatusRequestEntityTooLarge, "File too large")
+			return
+		}
+		h.respondWithError(w, http.StatusBadRequest, "Invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	popupID, err := uuid.Parse(r.FormValue("popup_id"))
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Popup ID is required")
+		return
+	}
+	content, header, err := r.FormFile("file")
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "File is required")
+		return
+	}
+	defer content.Close()
+
+	req := &services.FormFileUploadRequest{
+		PopupID:       popupID,
+		Field:         r.FormValue("field"),
+		FormToken:     r.FormValue("form_token"),
+		Reader:        content,
+		Filename:      header.Filename,
+		Size:          header.Size,
+		ProxyConfigID: proxyConfig.ID,
+		VisitorID:     proxy.VisitorID(r),
+		IPAddress:     middleware.GetClientIP(r),
+		UserAgent:     r.UserAgent(),
+	}
+
+	result, err := h.submissionService.UploadFormFile(req)
+	if err != nil {
+		fields := map[string]interface{}{
+			"proxy_config_id": proxyConfig.ID,
+			"popup_id":        popupID,
+			"field":           req.Field,
+			"error":           err.Error(),
+		}
+		if status, message := dataPlaneError(err); status == http.StatusInternalServerError {
+			h.logger.WithFields(fields).Error("Failed to upload form file")
+			h.respondWithError(w, status, "Failed to upload file")
+		} else {
+			h.logger.WithFields(fields).Warn("Form file upload rejected")
+			h.respondWithError(w, status, message)
+		}
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusCreated, "File uploaded successfully", result)
+}
+
+// dataPlaneError 把代理数据面公开接口的错误映射为状态码和返回给访客的提示
+// 只有防护拒绝、重复提交和请求校验错误返回具体提示，其他错误返回500，详细信息只写入日志
+func dataPlaneError(err error) (int, string) {
+	if rejected := services.AsSubmissionRejected(err); rejected != nil {
+		if rejected.IsRateLimited() {
+			return http.StatusTooManyRequests, rejected.Error()
+		}
+		return http.StatusForbidden, rejected.Error()
+	}
+	if errors.Is(err, services.ErrDuplicateSubmission) {
+		return http.StatusConflict, services.ErrDuplicateSubmission.Error()
+	}
+	if input := services.AsInputError(err); input != nil {
+		return http.StatusBadRequest, input.Error()
+	}
+	return http.StatusInternalServerError, ""
+}
+
+// GetCaptcha 生成图片验证码，挂载在代理数据面供弹窗表单使用，同时作为登录页的公共接口
+func (h *SubmissionCRUDHandler) GetCaptcha(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		h.respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	captcha, err := h.submissionService.NewCaptcha()
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"ip_address": middleware.GetClientIP(r),
+			"error":      err.Error(),
+		}).Error("Failed to generate captcha")
+		h.respondWithError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.respondWithSuccess(w, http.StatusOK, "Captcha generated successfully", captcha)
+}
+
 // GetSubmission 获取提交
 func (h *SubmissionCRUDHandler) GetSubmission(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid submission ID")
 		return
 	}
 
-	submission, err := h.submissionService.GetSubmission(uint(id))
+	submission, err := h.submissionService.GetSubmission(id)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"submission_id": id,
@@ -82,10 +267,41 @@ func (h *SubmissionCRUDHandler) GetSubmission(w http.ResponseWriter, r *http.Req
 	h.respondWithSuccess(w, http.StatusOK, "Submission retrieved successfully", submission)
 }
 
+// DecryptSubmission 获取敏感字段为原文的提交，需要角色拥有 submission:decrypt 权限，每次查看记录审计日志
+func (h *SubmissionCRUDHandler) DecryptSubmission(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid submission ID")
+		return
+	}
+	actor, ok := requestActor(r)
+	if !ok {
+		h.respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	submission, err := h.submissionService.DecryptSubmission(id, actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"submission_id": id,
+			"user_id":       actor.UserID,
+			"error":         err.Error(),
+		}).Warn("Failed to decrypt submission")
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrDecryptForbidden) {
+			status = http.StatusForbidden
+		}
+		h.respondWithError(w, status, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Submission decrypted successfully", submission)
+}
+
 // UpdateSubmission 更新提交
 func (h *SubmissionCRUDHandler) UpdateSubmission(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid submission ID")
 		return
@@ -97,7 +313,7 @@ func (h *SubmissionCRUDHandler) UpdateSubmission(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if err := h.submissionService.UpdateSubmission(uint(id), &req); err != nil {
+	if err := h.submissionService.UpdateSubmission(id, &req); err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"submission_id": id,
 			"error":         err.Error(),
@@ -112,13 +328,13 @@ func (h *SubmissionCRUDHandler) UpdateSubmission(w http.ResponseWriter, r *http.
 // DeleteSubmission 删除提交
 func (h *SubmissionCRUDHandler) DeleteSubmission(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	id, err := uuid.Parse(vars["id"])
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid submission ID")
 		return
 	}
 
-	if err := h.submissionService.DeleteSubmission(uint(id)); err != nil {
+	if err := h.submissionService.DeleteSubmission(id); err != nil {
 		h.logger.WithFields(map[string]interface{}{
 			"submission_id": id,
 			"error":         err.Error(),
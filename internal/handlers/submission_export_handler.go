@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"proxy-enhancer-ultra/internal/services"
 	"proxy-enhancer-ultra/pkg/logger"
@@ -26,90 +28,108 @@ func NewSubmissionExportHandler(submissionService *services.SubmissionService, l
 }
 
 // ExportSubmissions 导出提交数据
+//
+// 弹窗ID取自路径参数 popup_id 或查询参数 popup_id；查询参数 format 为 json、csv 或 xlsx（excel），
+// columns 为 schema 或 union，bom=true 时CSV写入UTF-8 BOM，start_date、end_date 为可选的日期范围，
+// decrypt=true 时导出敏感字段原文，需要解密权限
 func (h *SubmissionExportHandler) ExportSubmissions(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	popupID, err := uuid.Parse(vars["popup_id"])
-	if err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
+	req, ok := h.parseExportRequest(w, r)
+	if !ok {
 		return
 	}
+	h.export(w, req)
+}
 
-	// 获取导出格式
-	format := r.URL.Query().Get("format")
-	if format == "" {
-		format = "json" // 默认格式
-	}
-
-	// 验证导出格式
-	if !h.isValidExportFormat(format) {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid export format. Supported formats: json, csv")
+// ExportSubmissionsWithDateRange 按日期范围导出提交数据，start_date 和 end_date 必填
+func (h *SubmissionExportHandler) ExportSubmissionsWithDateRange(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.parseExportRequest(w, r)
+	if !ok {
 		return
 	}
 
-	data, err := h.submissionService.ExportSubmissions(popupID, format)
-	if err != nil {
-		h.logger.WithFields(map[string]interface{}{
-			"popup_id": popupID,
-			"format":   format,
-			"error":    err.Error(),
-		}).Error("Failed to export submissions")
-		h.respondWithError(w, http.StatusBadRequest, err.Error())
+	// 验证日期参数
+	if req.StartDate == "" || req.EndDate == "" {
+		h.respondWithError(w, http.StatusBadRequest, "Start date and end date are required")
 		return
 	}
 
-	// 设置响应头
-	h.setExportHeaders(w, format)
-
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	h.export(w, req)
 }
 
-// ExportSubmissionsWithDateRange 按日期范围导出提交数据
-func (h *SubmissionExportHandler) ExportSubmissionsWithDateRange(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	popupID, err := uuid.Parse(vars["popup_id"])
+// parseExportRequest 解析导出参数，参数无效时写入错误响应并返回 false
+func (h *SubmissionExportHandler) parseExportRequest(w http.ResponseWriter, r *http.Request) (*services.ExportSubmissionsRequest, bool) {
+	query := r.URL.Query()
+	rawPopupID := mux.Vars(r)["popup_id"]
+	if rawPopupID == "" {
+		rawPopupID = query.Get("popup_id")
+	}
+	popupID, err := uuid.Parse(rawPopupID)
 	if err != nil {
 		h.respondWithError(w, http.StatusBadRequest, "Invalid popup ID")
-		return
+		return nil, false
 	}
 
-	// 获取导出格式和日期范围
-	format := r.URL.Query().Get("format")
-	startDate := r.URL.Query().Get("start_date")
-	endDate := r.URL.Query().Get("end_date")
-
+	// 获取导出格式
+	format := query.Get("format")
 	if format == "" {
-		format = "json"
+		format = services.ExportFormatJSON // 默认格式
+	}
+	if format == "excel" {
+		format = services.ExportFormatXLSX
 	}
 
+	// 验证导出格式
 	if !h.isValidExportFormat(format) {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid export format. Supported formats: json, csv")
-		return
+		h.respondWithError(w, http.StatusBadRequest, "Invalid export format. Supported formats: json, csv, xlsx")
+		return nil, false
 	}
 
-	// 验证日期参数
-	if startDate == "" || endDate == "" {
-		h.respondWithError(w, http.StatusBadRequest, "Start date and end date are required")
-		return
+	req := &services.ExportSubmissionsRequest{
+		PopupID:   popupID,
+		Format:    format,
+		Columns:   query.Get("columns"),
+		StartDate: query.Get("start_date"),
+		EndDate:   query.Get("end_date"),
+	}
+	if bom := query.Get("bom"); bom != "" {
+		req.BOM, err = strconv.ParseBool(bom)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid bom parameter")
+			return nil, false
+		}
+	}
+	if decrypt := query.Get("decrypt"); decrypt != "" {
+		req.Decrypt, err = strconv.ParseBool(decrypt)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid decrypt parameter")
+			return nil, false
+		}
 	}
+	req.Actor, _ = requestActor(r)
+	return req, true
+}
 
-	// 这里可以调用服务层的按日期范围导出方法
-	// 目前使用现有的导出方法
-	data, err := h.submissionService.ExportSubmissions(popupID, format)
+// export 导出并写入文件响应
+func (h *SubmissionExportHandler) export(w http.ResponseWriter, req *services.ExportSubmissionsRequest) {
+	data, err := h.submissionService.ExportSubmissions(req)
 	if err != nil {
 		h.logger.WithFields(map[string]interface{}{
-			"popup_id":   popupID,
-			"format":     format,
-			"start_date": startDate,
-			"end_date":   endDate,
+			"popup_id":   req.PopupID,
+			"format":     req.Format,
+			"start_date": req.StartDate,
+			"end_date":   req.EndDate,
 			"error":      err.Error(),
-		}).Error("Failed to export submissions with date range")
-		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		}).Error("Failed to export submissions")
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrDecryptForbidden) {
+			status = http.StatusForbidden
+		}
+		h.respondWithError(w, status, err.Error())
 		return
 	}
 
 	// 设置响应头
-	h.setExportHeaders(w, format)
+	h.setExportHeaders(w, req.Format)
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
@@ -117,7 +137,7 @@ func (h *SubmissionExportHandler) ExportSubmissionsWithDateRange(w http.Response
 
 // isValidExportFormat 检查导出格式是否有效
 func (h *SubmissionExportHandler) isValidExportFormat(format string) bool {
-	validFormats := []string{"json", "csv", "xlsx"}
+	validFormats := []string{services.ExportFormatJSON, services.ExportFormatCSV, services.ExportFormatXLSX}
 	for _, validFormat := range validFormats {
 		if format == validFormat {
 			return true
@@ -128,17 +148,6 @@ func (h *SubmissionExportHandler) isValidExportFormat(format string) bool {
 
 // setExportHeaders 设置导出文件的响应头
 func (h *SubmissionExportHandler) setExportHeaders(w http.ResponseWriter, format string) {
-	switch format {
-	case "json":
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Content-Disposition", "attachment; filename=submissions.json")
-	case "csv":
-		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
-		w.Header().Set("Content-Disposition", "attachment; filename=submissions.csv")
-	case "xlsx":
-		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-		w.Header().Set("Content-Disposition", "attachment; filename=submissions.xlsx")
-	default:
-		w.Header().Set("Content-Type", "application/octet-stream")
-	}
+	w.Header().Set("Content-Type", services.ExportContentType(format))
+	w.Header().Set("Content-Disposition", "attachment; filename=submissions."+format)
 }
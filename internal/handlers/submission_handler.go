@@ -14,10 +14,11 @@ type SubmissionHandler struct {
 	logger            logger.Logger
 
 	// 组合的专门处理器
-	crudHandler   *SubmissionCRUDHandler
-	queryHandler  *SubmissionQueryHandler
-	exportHandler *SubmissionExportHandler
-	statsHandler  *SubmissionStatsHandler
+	crudHandler     *SubmissionCRUDHandler
+	queryHandler    *SubmissionQueryHandler
+	exportHandler   *SubmissionExportHandler
+	statsHandler    *SubmissionStatsHandler
+	workflowHandler *SubmissionWorkflowHandler
 }
 
 // NewSubmissionHandler 创建新的提交处理器
@@ -27,10 +28,11 @@ func NewSubmissionHandler(submissionService *services.SubmissionService, logger
 		logger:            logger,
 
 		// 初始化专门的处理器
-		crudHandler:   NewSubmissionCRUDHandler(submissionService, logger),
-		queryHandler:  NewSubmissionQueryHandler(submissionService, logger),
-		exportHandler: NewSubmissionExportHandler(submissionService, logger),
-		statsHandler:  NewSubmissionStatsHandler(submissionService, logger),
+		crudHandler:     NewSubmissionCRUDHandler(submissionService, logger),
+		queryHandler:    NewSubmissionQueryHandler(submissionService, logger),
+		exportHandler:   NewSubmissionExportHandler(submissionService, logger),
+		statsHandler:    NewSubmissionStatsHandler(submissionService, logger),
+		workflowHandler: NewSubmissionWorkflowHandler(submissionService, logger),
 	}
 }
 
@@ -39,11 +41,31 @@ func (h *SubmissionHandler) CreateSubmission(w http.ResponseWriter, r *http.Requ
 	h.crudHandler.CreateSubmission(w, r)
 }
 
+// SubmitFormStep 接收代理页面提交的弹窗表单步骤 - 委托给CRUD处理器
+func (h *SubmissionHandler) SubmitFormStep(w http.ResponseWriter, r *http.Request) {
+	h.crudHandler.SubmitFormStep(w, r)
+}
+
+// UploadFormFile 接收代理页面上传的弹窗表单文件 - 委托给CRUD处理器
+func (h *SubmissionHandler) UploadFormFile(w http.ResponseWriter, r *http.Request) {
+	h.crudHandler.UploadFormFile(w, r)
+}
+
+// GetCaptcha 生成图片验证码 - 委托给CRUD处理器
+func (h *SubmissionHandler) GetCaptcha(w http.ResponseWriter, r *http.Request) {
+	h.crudHandler.GetCaptcha(w, r)
+}
+
 // GetSubmission 获取提交 - 委托给CRUD处理器
 func (h *SubmissionHandler) GetSubmission(w http.ResponseWriter, r *http.Request) {
 	h.crudHandler.GetSubmission(w, r)
 }
 
+// DecryptSubmission 获取敏感字段为原文的提交 - 委托给CRUD处理器
+func (h *SubmissionHandler) DecryptSubmission(w http.ResponseWriter, r *http.Request) {
+	h.crudHandler.DecryptSubmission(w, r)
+}
+
 // UpdateSubmission 更新提交 - 委托给CRUD处理器
 func (h *SubmissionHandler) UpdateSubmission(w http.ResponseWriter, r *http.Request) {
 	h.crudHandler.UpdateSubmission(w, r)
@@ -69,6 +91,16 @@ func (h *SubmissionHandler) GetSubmissionStats(w http.ResponseWriter, r *http.Re
 	h.statsHandler.GetSubmissionStats(w, r)
 }
 
+// GetSourceBreakdown 按来源维度统计提交 - 委托给统计处理器
+func (h *SubmissionHandler) GetSourceBreakdown(w http.ResponseWriter, r *http.Request) {
+	h.statsHandler.GetSourceBreakdown(w, r)
+}
+
+// GetSourceTimeSeries 按时间段统计提交来源 - 委托给统计处理器
+func (h *SubmissionHandler) GetSourceTimeSeries(w http.ResponseWriter, r *http.Request) {
+	h.statsHandler.GetSourceTimeSeries(w, r)
+}
+
 // GetSubmissionsByDateRange 根据日期范围获取提交 - 委托给查询处理器
 func (h *SubmissionHandler) GetSubmissionsByDateRange(w http.ResponseWriter, r *http.Request) {
 	h.queryHandler.GetSubmissionsByDateRange(w, r)
@@ -84,5 +116,50 @@ func (h *SubmissionHandler) DeleteSubmissionsByPopup(w http.ResponseWriter, r *h
 	h.crudHandler.DeleteSubmissionsByPopup(w, r)
 }
 
+// UpdateSubmissionStatus 更新提交的处理状态 - 委托给线索处理处理器
+func (h *SubmissionHandler) UpdateSubmissionStatus(w http.ResponseWriter, r *http.Request) {
+	h.workflowHandler.UpdateStatus(w, r)
+}
+
+// SetSubmissionTags 替换提交的全部标签 - 委托给线索处理处理器
+func (h *SubmissionHandler) SetSubmissionTags(w http.ResponseWriter, r *http.Request) {
+	h.workflowHandler.SetTags(w, r)
+}
+
+// AssignSubmission 分配提交的负责人 - 委托给线索处理处理器
+func (h *SubmissionHandler) AssignSubmission(w http.ResponseWriter, r *http.Request) {
+	h.workflowHandler.Assign(w, r)
+}
+
+// ListSubmissionNotes 获取提交的备注 - 委托给线索处理处理器
+func (h *SubmissionHandler) ListSubmissionNotes(w http.ResponseWriter, r *http.Request) {
+	h.workflowHandler.ListNotes(w, r)
+}
+
+// AddSubmissionNote 为提交添加内部备注 - 委托给线索处理处理器
+func (h *SubmissionHandler) AddSubmissionNote(w http.ResponseWriter, r *http.Request) {
+	h.workflowHandler.AddNote(w, r)
+}
+
+// ListSubmissionHistory 获取提交的处理历史 - 委托给线索处理处理器
+func (h *SubmissionHandler) ListSubmissionHistory(w http.ResponseWriter, r *http.Request) {
+	h.workflowHandler.ListHistory(w, r)
+}
+
+// BatchUpdateSubmissionStatus 批量更新提交的处理状态 - 委托给线索处理处理器
+func (h *SubmissionHandler) BatchUpdateSubmissionStatus(w http.ResponseWriter, r *http.Request) {
+	h.workflowHandler.BatchUpdateStatus(w, r)
+}
+
+// BatchUpdateSubmissionTags 批量添加和移除提交标签 - 委托给线索处理处理器
+func (h *SubmissionHandler) BatchUpdateSubmissionTags(w http.ResponseWriter, r *http.Request) {
+	h.workflowHandler.BatchUpdateTags(w, r)
+}
+
+// BatchAssignSubmissions 批量分配提交的负责人 - 委托给线索处理处理器
+func (h *SubmissionHandler) BatchAssignSubmissions(w http.ResponseWriter, r *http.Request) {
+	h.workflowHandler.BatchAssign(w, r)
+}
+
 // 为了向后兼容，这些方法现在从 BaseHandler 重新导出
 // 实际实现已移动到 common_handler.go 中
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"proxy-enhancer-ultra/internal/services"
@@ -79,8 +80,70 @@ func (h *SubmissionQueryHandler) ListSubmissions(w http.ResponseWriter, r *http.
 		}
 	}
 
-	submissions, total, err := h.submissionService.ListSubmissions(page, pageSize, popupID, startDate, endDate)
+	filter := &services.SubmissionFilter{
+		PopupID:   popupID,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Tag:       strings.TrimSpace(r.URL.Query().Get("tag")),
+		Search:    strings.TrimSpace(r.URL.Query().Get("search")),
+		IP:        strings.TrimSpace(r.URL.Query().Get("ip")),
+		Referrer:  strings.TrimSpace(r.URL.Query().Get("referrer")),
+		UserAgent: strings.TrimSpace(r.URL.Query().Get("user_agent")),
+		Sort:      strings.TrimSpace(r.URL.Query().Get("sort")),
+	}
+
+	// 解析处理状态，多个状态用逗号分隔
+	if statusStr := r.URL.Query().Get("status"); statusStr != "" {
+		for _, status := range strings.Split(statusStr, ",") {
+			filter.Status = append(filter.Status, strings.TrimSpace(status))
+		}
+	}
+
+	// 解析表单字段条件，每个 field 参数为一个 字段:比较方式[:值] 条件，例如 field=phone:prefix:138
+	for _, fieldStr := range r.URL.Query()["field"] {
+		field, err := services.ParseSubmissionFieldFilter(fieldStr)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter.Fields = append(filter.Fields, field)
+	}
+
+	// 解析是否已处理
+	if processedStr := r.URL.Query().Get("processed"); processedStr != "" {
+		processed, err := strconv.ParseBool(processedStr)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid processed value")
+			return
+		}
+		filter.Processed = &processed
+	}
+
+	// 解析负责人，none 表示未分配
+	if assigneeStr := r.URL.Query().Get("assignee_id"); assigneeStr != "" {
+		if assigneeStr == "none" {
+			filter.Unassigned = true
+		} else {
+			assigneeID, err := uuid.Parse(assigneeStr)
+			if err != nil {
+				h.respondWithError(w, http.StatusBadRequest, "Invalid assignee ID")
+				return
+			}
+			filter.AssigneeID = &assigneeID
+		}
+	}
+
+	if err := filter.Validate(); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	submissions, total, err := h.submissionService.ListSubmissions(page, pageSize, filter)
 	if err != nil {
+		if input := services.AsInputError(err); input != nil {
+			h.respondWithError(w, http.StatusBadRequest, input.Error())
+			return
+		}
 		h.logger.WithFields(map[string]interface{}{
 			"error": err.Error(),
 		}).Error("Failed to list submissions")
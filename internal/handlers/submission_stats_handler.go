@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"proxy-enhancer-ultra/internal/services"
 	"proxy-enhancer-ultra/pkg/logger"
@@ -102,3 +106,117 @@ func (h *SubmissionStatsHandler) GetSubmissionTrends(w http.ResponseWriter, r *h
 
 	h.respondWithSuccess(w, http.StatusOK, "Submission trends retrieved successfully", responseData)
 }
+
+// GetSourceBreakdown 按来源维度统计提交
+// 查询参数：dimension（必填）、popup_id、start_date、end_date、timezone、limit，
+// 以及以维度名为参数名的过滤条件，如 utm_source=google
+func (h *SubmissionStatsHandler) GetSourceBreakdown(w http.ResponseWriter, r *http.Request) {
+	query, err := parseSourceAnalyticsQuery(r)
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	breakdown, err := h.submissionService.GetSourceBreakdown(query)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"dimension": query.Dimension,
+			"error":     err.Error(),
+		}).Error("Failed to get submission source breakdown")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Submission sources retrieved successfully", breakdown)
+}
+
+// GetSourceTimeSeries 按小时、天或周统计提交来源
+// 查询参数与 GetSourceBreakdown 相同，另有 granularity（hour、day、week），dimension 可以为空
+func (h *SubmissionStatsHandler) GetSourceTimeSeries(w http.ResponseWriter, r *http.Request) {
+	query, err := parseSourceAnalyticsQuery(r)
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	series, err := h.submissionService.GetSourceTimeSeries(query)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"dimension":   query.Dimension,
+			"granularity": query.Granularity,
+			"error":       err.Error(),
+		}).Error("Failed to get submission source time series")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Submission source time series retrieved successfully", series)
+}
+
+// parseSourceAnalyticsQuery 解析来源分析的查询参数
+// start_date 和 end_date 为 RFC3339 时间或 YYYY-MM-DD 日期，日期按 timezone 的本地时间解析，end_date 的日期包含当天
+func parseSourceAnalyticsQuery(r *http.Request) (*services.SourceAnalyticsQuery, error) {
+	values := r.URL.Query()
+	query := &services.SourceAnalyticsQuery{
+		Dimension:   values.Get("dimension"),
+		Granularity: values.Get("granularity"),
+		Timezone:    values.Get("timezone"),
+		Filters:     make(map[string]string),
+	}
+
+	if popupIDStr := values.Get("popup_id"); popupIDStr != "" {
+		popupID, err := uuid.Parse(popupIDStr)
+		if err != nil {
+			return nil, errors.New("invalid popup ID")
+		}
+		query.PopupID = &popupID
+	}
+
+	if limitStr := values.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil {
+			return nil, errors.New("invalid limit")
+		}
+		query.Limit = limit
+	}
+
+	location := time.UTC
+	if query.Timezone != "" {
+		loc, err := time.LoadLocation(query.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %s", query.Timezone)
+		}
+		location = loc
+	}
+	parseTime := func(name string, endOfRange bool) (*time.Time, error) {
+		value := values.Get(name)
+		if value == "" {
+			return nil, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return &t, nil
+		}
+		t, err := time.ParseInLocation("2006-01-02", value, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s, expected RFC3339 time or YYYY-MM-DD", name)
+		}
+		if endOfRange {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, nil
+	}
+	var err error
+	if query.StartDate, err = parseTime("start_date", false); err != nil {
+		return nil, err
+	}
+	if query.EndDate, err = parseTime("end_date", true); err != nil {
+		return nil, err
+	}
+
+	for _, dimension := range services.SourceDimensions {
+		if values.Has(dimension) {
+			query.Filters[dimension] = values.Get(dimension)
+		}
+	}
+	return query, nil
+}
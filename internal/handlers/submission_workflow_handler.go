@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"proxy-enhancer-ultra/internal/middleware"
+	"proxy-enhancer-ultra/internal/services"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// SubmissionWorkflowHandler 提交线索处理处理器
+type SubmissionWorkflowHandler struct {
+	BaseHandler
+	submissionService *services.SubmissionService
+	logger            logger.Logger
+}
+
+// NewSubmissionWorkflowHandler 创建新的提交线索处理处理器
+func NewSubmissionWorkflowHandler(submissionService *services.SubmissionService, logger logger.Logger) *SubmissionWorkflowHandler {
+	return &SubmissionWorkflowHandler{
+		submissionService: submissionService,
+		logger:            logger,
+	}
+}
+
+// UpdateStatus 更新提交的处理状态，请求体为空时标记为 contacted
+func (h *SubmissionWorkflowHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.submissionAndActor(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.UpdateSubmissionStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	submission, err := h.submissionService.UpdateSubmissionStatus(id, req.Status, actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"submission_id": id,
+			"status":        req.Status,
+			"error":         err.Error(),
+		}).Error("Failed to update submission status")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Submission status updated successfully", submission)
+}
+
+// SetTags 替换提交的全部标签
+func (h *SubmissionWorkflowHandler) SetTags(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.submissionAndActor(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.UpdateSubmissionTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	submission, err := h.submissionService.SetSubmissionTags(id, req.Tags, actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"submission_id": id,
+			"error":         err.Error(),
+		}).Error("Failed to update submission tags")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Submission tags updated successfully", submission)
+}
+
+// Assign 分配提交的负责人，assignee_id 为空时取消分配
+func (h *SubmissionWorkflowHandler) Assign(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.submissionAndActor(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.AssignSubmissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	submission, err := h.submissionService.AssignSubmission(id, req.AssigneeID, actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"submission_id": id,
+			"assignee_id":   req.AssigneeID,
+			"error":         err.Error(),
+		}).Error("Failed to assign submission")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Submission assigned successfully", submission)
+}
+
+// ListNotes 获取提交的备注
+func (h *SubmissionWorkflowHandler) ListNotes(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid submission ID")
+		return
+	}
+
+	notes, err := h.submissionService.ListSubmissionNotes(id)
+	if err != nil {
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Submission notes retrieved successfully", notes)
+}
+
+// AddNote 为提交添加内部备注
+func (h *SubmissionWorkflowHandler) AddNote(w http.ResponseWriter, r *http.Request) {
+	id, actor, ok := h.submissionAndActor(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.CreateSubmissionNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	note, err := h.submissionService.AddSubmissionNote(id, req.Body, actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"submission_id": id,
+			"error":         err.Error(),
+		}).Error("Failed to add submission note")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusCreated, "Submission note added successfully", note)
+}
+
+// ListHistory 分页获取提交的处理历史
+func (h *SubmissionWorkflowHandler) ListHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid submission ID")
+		return
+	}
+	page, pageSize := pagination(r)
+
+	logs, total, err := h.submissionService.ListSubmissionHistory(id, page, pageSize)
+	if err != nil {
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	responseData := map[string]interface{}{
+		"history":  logs,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}
+	h.respondWithSuccess(w, http.StatusOK, "Submission history retrieved successfully", responseData)
+}
+
+// BatchUpdateStatus 批量更新提交的处理状态，status 为空时标记为 contacted
+func (h *SubmissionWorkflowHandler) BatchUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	actor, ok := h.actor(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.BatchUpdateSubmissionStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result, err := h.submissionService.BatchUpdateSubmissionStatus(&req, actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"count":  len(req.IDs),
+			"status": req.Status,
+			"error":  err.Error(),
+		}).Error("Failed to batch update submission status")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Submission status updated successfully", result)
+}
+
+// BatchUpdateTags 批量添加和移除提交标签
+func (h *SubmissionWorkflowHandler) BatchUpdateTags(w http.ResponseWriter, r *http.Request) {
+	actor, ok := h.actor(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.BatchUpdateSubmissionTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result, err := h.submissionService.BatchUpdateSubmissionTags(&req, actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"count": len(req.IDs),
+			"error": err.Error(),
+		}).Error("Failed to batch update submission tags")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Submission tags updated successfully", result)
+}
+
+// BatchAssign 批量分配提交的负责人
+func (h *SubmissionWorkflowHandler) BatchAssign(w http.ResponseWriter, r *http.Request) {
+	actor, ok := h.actor(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.BatchAssignSubmissionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result, err := h.submissionService.BatchAssignSubmissions(&req, actor)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"count":       len(req.IDs),
+			"assignee_id": req.AssigneeID,
+			"error":       err.Error(),
+		}).Error("Failed to batch assign submissions")
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Submissions assigned successfully", result)
+}
+
+// submissionAndActor 解析路径中的提交ID和当前用户，失败时写入错误响应并返回 false
+func (h *SubmissionWorkflowHandler) submissionAndActor(w http.ResponseWriter, r *http.Request) (uuid.UUID, services.SubmissionActor, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid submission ID")
+		return uuid.Nil, services.SubmissionActor{}, false
+	}
+	actor, ok := h.actor(w, r)
+	return id, actor, ok
+}
+
+// actor 返回当前用户，未登录时写入错误响应并返回 false
+func (h *SubmissionWorkflowHandler) actor(w http.ResponseWriter, r *http.Request) (services.SubmissionActor, bool) {
+	actor, ok := requestActor(r)
+	if !ok {
+		h.respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+	}
+	return actor, ok
+}
+
+// requestActor 返回请求的当前用户
+func requestActor(r *http.Request) (services.SubmissionActor, bool) {
+	userID, username, _, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		return services.SubmissionActor{}, false
+	}
+	return services.SubmissionActor{UserID: userID, Username: username}, true
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"proxy-enhancer-ultra/internal/services"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// WebhookHandler Webhook处理器，所有接口只对管理员开放
+type WebhookHandler struct {
+	BaseHandler
+	webhookService *services.WebhookService
+	logger         logger.Logger
+}
+
+// NewWebhookHandler 创建新的Webhook处理器
+func NewWebhookHandler(webhookService *services.WebhookService, logger logger.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+		logger:         logger,
+	}
+}
+
+// CreateWebhook 创建Webhook订阅，响应中包含签名密钥，之后不再返回
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req services.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Actor, _ = requestActor(r)
+
+	hook, err := h.webhookService.CreateWebhook(&req)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"url":   req.URL,
+			"error": err.Error(),
+		}).Error("Failed to create webhook")
+		h.respondWithError(w, webhookErrorStatus(err), err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusCreated, "Webhook created successfully", hook)
+}
+
+// ListWebhooks 获取Webhook订阅列表
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := pagination(r)
+
+	hooks, total, err := h.webhookService.ListWebhooks(page, pageSize)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to list webhooks")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+		return
+	}
+
+	responseData := map[string]interface{}{
+		"webhooks": hooks,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}
+	h.respondWithSuccess(w, http.StatusOK, "Webhooks retrieved successfully", responseData)
+}
+
+// GetWebhook 获取Webhook订阅详情
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := h.webhookService.GetWebhook(id)
+	if err != nil {
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Webhook retrieved successfully", hook)
+}
+
+// UpdateWebhook 更新Webhook订阅
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	var req services.UpdateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Actor, _ = requestActor(r)
+
+	hook, err := h.webhookService.UpdateWebhook(id, &req)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"webhook_id": id,
+			"error":      err.Error(),
+		}).Error("Failed to update webhook")
+		h.respondWithError(w, webhookErrorStatus(err), err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Webhook updated successfully", hook)
+}
+
+// DeleteWebhook 删除Webhook订阅和投递记录
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteWebhook(id); err != nil {
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Webhook deleted successfully", nil)
+}
+
+// RotateWebhookSecret 轮换签名密钥，响应中包含新密钥
+func (h *WebhookHandler) RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := h.webhookService.RotateSecret(id)
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusOK, "Webhook secret rotated successfully", hook)
+}
+
+// TestWebhook 向接收地址发送一次 ping 事件，结果通过投递记录查看
+func (h *WebhookHandler) TestWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.SendTest(id)
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusAccepted, "Test delivery queued successfully", delivery)
+}
+
+// ListWebhookDeliveries 获取Webhook的投递记录，可按状态过滤
+func (h *WebhookHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	h.listDeliveries(w, r, &services.WebhookDeliveryFilter{
+		WebhookID: &id,
+		Status:    r.URL.Query().Get("status"),
+	})
+}
+
+// ListDeadLetters 获取死信列表，可按 webhook_id 过滤
+func (h *WebhookHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	filter := &services.WebhookDeliveryFilter{Status: services.WebhookDeliveryDead}
+	if raw := r.URL.Query().Get("webhook_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid webhook ID")
+			return
+		}
+		filter.WebhookID = &id
+	}
+
+	h.listDeliveries(w, r, filter)
+}
+
+// ReplayWebhookDelivery 重新投递一条死信或已投递的记录
+func (h *WebhookHandler) ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid delivery ID")
+		return
+	}
+
+	delivery, err := h.webhookService.ReplayDelivery(id)
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusAccepted, "Webhook delivery replayed successfully", delivery)
+}
+
+// ReplayDeadLetters 重新投递Webhook的所有死信
+func (h *WebhookHandler) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := h.webhookService.ReplayDeadLetters(id)
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondWithSuccess(w, http.StatusAccepted, "Webhook dead letters replayed successfully", map[string]interface{}{
+		"replayed": count,
+	})
+}
+
+// listDeliveries 分页返回投递记录
+func (h *WebhookHandler) listDeliveries(w http.ResponseWriter, r *http.Request, filter *services.WebhookDeliveryFilter) {
+	page, pageSize := pagination(r)
+
+	deliveries, total, err := h.webhookService.ListDeliveries(filter, page, pageSize)
+	if err != nil {
+		h.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to list webhook deliveries")
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve webhook deliveries")
+		return
+	}
+
+	responseData := map[string]interface{}{
+		"deliveries": deliveries,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+	}
+	h.respondWithSuccess(w, http.StatusOK, "Webhook deliveries retrieved successfully", responseData)
+}
+
+// webhookID 解析路径中的Webhook ID，无效时写入错误响应并返回 false
+func (h *WebhookHandler) webhookID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// pagination 解析分页参数，默认第1页每页20条，每页最多100条
+func pagination(r *http.Request) (int, int) {
+	query := r.URL.Query()
+	page := 1
+	pageSize := 20
+	if p, err := strconv.Atoi(query.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if ps, err := strconv.Atoi(query.Get("pageSize")); err == nil && ps > 0 && ps <= 100 {
+		pageSize = ps
+	}
+	return page, pageSize
+}
+
+// webhookErrorStatus 没有解密权限时返回 403，其他错误返回 400
+func webhookErrorStatus(err error) int {
+	if errors.Is(err, services.ErrDecryptForbidden) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,93 @@
+// Package mailer 提供通过SMTP发送纯文本邮件的发送器
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// ErrNoRecipients 邮件没有收件人
+var ErrNoRecipients = errors.New("mail has no recipients")
+
+// Message 待发送的邮件
+type Message struct {
+	To      []string
+	Subject string
+	Text    string // 纯文本正文
+}
+
+// Mailer 邮件发送器
+type Mailer interface {
+	// Send 发送邮件，所有收件人都被服务器接受后返回 nil
+	Send(ctx context.Context, msg *Message) error
+}
+
+// ParseAddressList 解析并校验收件人地址，返回不带名称的地址
+func ParseAddressList(addresses []string) ([]string, error) {
+	result := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		parsed, err := mail.ParseAddress(strings.TrimSpace(address))
+		if err != nil {
+			return nil, fmt.Errorf("invalid email address %q", address)
+		}
+		result = append(result, parsed.Address)
+	}
+	return result, nil
+}
+
+// Build 生成邮件内容，标题按RFC 2047编码，正文使用 quoted-printable 编码
+func Build(from *mail.Address, msg *Message, now time.Time) ([]byte, error) {
+	if len(msg.To) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	header("To", strings.Join(msg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", singleLine(msg.Subject)))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Text, "\r\n", "\n")
+	body = strings.ReplaceAll(body, "\n", "\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// singleLine 把换行替换为空格，防止标题中注入邮件头
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// messageID 生成使用发件人域名的 Message-ID
+func messageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return "<" + hex.EncodeToString(buf) + "@" + domain + ">"
+}
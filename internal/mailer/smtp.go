@@ -0,0 +1,112 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"proxy-enhancer-ultra/internal/config"
+)
+
+// SMTPMailer 通过SMTP服务器发送邮件，每封邮件使用一个新连接
+type SMTPMailer struct {
+	cfg  config.MailConfig
+	from *mail.Address
+}
+
+// NewSMTPMailer 创建SMTP发送器
+func NewSMTPMailer(cfg config.MailConfig) (*SMTPMailer, error) {
+	cfg = cfg.WithDefaults()
+	if cfg.Host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q", cfg.From)
+	}
+	from.Name = cfg.FromName
+	switch cfg.Encryption {
+	case config.MailEncryptionSTARTTLS, config.MailEncryptionTLS, config.MailEncryptionNone:
+	default:
+		return nil, fmt.Errorf("unsupported smtp encryption %q", cfg.Encryption)
+	}
+	return &SMTPMailer{cfg: cfg, from: from}, nil
+}
+
+// Send 发送邮件
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := Build(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	// 超时或取消时中断阻塞中的读写
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.cfg.Encryption == config.MailEncryptionSTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.from.Address); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial 连接SMTP服务器，使用TLS加密时直接建立TLS连接
+func (m *SMTPMailer) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	if m.cfg.Encryption == config.MailEncryptionTLS {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: m.cfg.Host}}
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", addr)
+}
@@ -0,0 +1,258 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"proxy-enhancer-ultra/internal/config"
+)
+
+// smtpSession SMTP测试服务收到的一次会话
+type smtpSession struct {
+	auth string
+	from string
+	to   []string
+	data []byte
+}
+
+// newSMTPServer 启动只接受一个连接的SMTP测试服务，extensions 为 EHLO 返回的扩展，
+// reject 中的收件人会被拒绝，会话结束后写入返回的通道
+func newSMTPServer(t *testing.T, extensions []string, reject map[string]bool) (string, int, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		var session smtpSession
+		defer func() { sessions <- session }()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost ESMTP test")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				lines := append([]string{"localhost"}, extensions...)
+				for i, ext := range lines {
+					sep := "-"
+					if i == len(lines)-1 {
+						sep = " "
+					}
+					text.PrintfLine("250%s%s", sep, ext)
+				}
+			case "AUTH":
+				session.auth = arg
+				text.PrintfLine("235 2.7.0 Authentication successful")
+			case "MAIL":
+				// 只记录地址，忽略 BODY=8BITMIME 等参数
+				session.from, _, _ = strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ")
+				text.PrintfLine("250 2.1.0 OK")
+			case "RCPT":
+				to := strings.TrimPrefix(arg, "TO:")
+				if reject[strings.Trim(to, "<>")] {
+					text.PrintfLine("550 5.1.1 Mailbox unavailable")
+					continue
+				}
+				session.to = append(session.to, to)
+				text.PrintfLine("250 2.1.5 OK")
+			case "DATA":
+				text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				if session.data, err = text.ReadDotBytes(); err != nil {
+					return
+				}
+				text.PrintfLine("250 2.0.0 Queued")
+			case "RSET", "NOOP":
+				text.PrintfLine("250 2.0.0 OK")
+			case "QUIT":
+				text.PrintfLine("221 2.0.0 Bye")
+				return
+			default:
+				text.PrintfLine("502 5.5.2 Command not recognized")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, sessions
+}
+
+// newTestMailer 创建连接到测试服务的发送器
+func newTestMailer(t *testing.T, host string, port int, cfg config.MailConfig) *SMTPMailer {
+	t.Helper()
+	cfg.Host = host
+	cfg.Port = port
+	cfg.From = "noreply@example.com"
+	cfg.Timeout = 5 * time.Second
+	if cfg.Encryption == "" {
+		cfg.Encryption = config.MailEncryptionNone
+	}
+	m, err := NewSMTPMailer(cfg)
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+	return m
+}
+
+func TestSMTPMailerSendRoundTrip(t *testing.T) {
+	host, port, sessions := newSMTPServer(t, []string{"8BITMIME", "AUTH PLAIN"}, nil)
+	m := newTestMailer(t, host, port, config.MailConfig{Username: "mailer", Password: "secret", FromName: "弹窗通知"})
+
+	msg := &Message{
+		To:      []string{"ann@example.com", "bob@example.com"},
+		Subject: "新的表单提交\r\nBcc: evil@example.com",
+		Text:    "姓名: Ann\n电话: 13812345678\n",
+	}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	session := <-sessions
+
+	wantAuth := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00mailer\x00secret"))
+	if session.auth != wantAuth {
+		t.Errorf("AUTH = %q, want %q", session.auth, wantAuth)
+	}
+	if session.from != "<noreply@example.com>" {
+		t.Errorf("MAIL FROM = %q, want <noreply@example.com>", session.from)
+	}
+	if got := strings.Join(session.to, ","); got != "<ann@example.com>,<bob@example.com>" {
+		t.Errorf("RCPT TO = %q", got)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(session.data)))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	if got := parsed.Header.Get("Bcc"); got != "" {
+		t.Errorf("Bcc header = %q, want none", got)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("invalid subject: %v", err)
+	}
+	if subject != "新的表单提交 Bcc: evil@example.com" {
+		t.Errorf("Subject = %q", subject)
+	}
+	from, err := parsed.Header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Name != "弹窗通知" || from[0].Address != "noreply@example.com" {
+		t.Errorf("From = %v, %v", from, err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if string(body) != "姓名: Ann\n电话: 13812345678\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSMTPMailerSendErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions []string
+		reject     map[string]bool
+		cfg        config.MailConfig
+		wantErr    string
+	}{
+		{
+			name:    "rejected recipient",
+			reject:  map[string]bool{"bob@example.com": true},
+			wantErr: "recipient bob@example.com rejected",
+		},
+		{
+			name:    "starttls not supported",
+			cfg:     config.MailConfig{Encryption: config.MailEncryptionSTARTTLS},
+			wantErr: "does not support STARTTLS",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, sessions := newSMTPServer(t, tt.extensions, tt.reject)
+			m := newTestMailer(t, host, port, tt.cfg)
+
+			err := m.Send(context.Background(), &Message{To: []string{"ann@example.com", "bob@example.com"}, Subject: "test", Text: "test"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Send() error = %v, want %q", err, tt.wantErr)
+			}
+			if session := <-sessions; session.data != nil {
+				t.Errorf("server received message data after a failed send")
+			}
+		})
+	}
+}
+
+func TestSMTPMailerSendTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	// 接受连接但从不发送问候，发送应在超时后返回
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	m, err := NewSMTPMailer(config.MailConfig{
+		Host:       "127.0.0.1",
+		Port:       ln.Addr().(*net.TCPAddr).Port,
+		From:       "noreply@example.com",
+		Encryption: config.MailEncryptionNone,
+		Timeout:    200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+	start := time.Now()
+	if err := m.Send(context.Background(), &Message{To: []string{"ann@example.com"}, Subject: "test", Text: "test"}); err == nil {
+		t.Fatal("Send() error = nil, want timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Send() returned after %s, want the configured timeout", elapsed)
+	}
+}
+
+func TestNewSMTPMailer(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.MailConfig
+		wantErr bool
+	}{
+		{"valid", config.MailConfig{Host: "smtp.example.com", Port: 587, From: "noreply@example.com"}, false},
+		{"missing host", config.MailConfig{From: "noreply@example.com"}, true},
+		{"invalid sender", config.MailConfig{Host: "smtp.example.com", From: "noreply"}, true},
+		{"unsupported encryption", config.MailConfig{Host: "smtp.example.com", From: "noreply@example.com", Encryption: "ssl"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSMTPMailer(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("NewSMTPMailer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// trustedProxies 可信反向代理的地址段，由 SetTrustedProxies 在启动时设置
+var trustedProxies atomic.Pointer[[]netip.Prefix]
+
+// SetTrustedProxies 设置可信反向代理，元素为IP或CIDR，启动时调用
+func SetTrustedProxies(proxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	trustedProxies.Store(&prefixes)
+	return nil
+}
+
+// GetClientIP 获取客户端IP地址
+//
+// 默认使用连接的对端地址。对端是可信反向代理时，从右向左跳过 X-Forwarded-For 中的可信代理，
+// 取第一个不可信的地址；没有 X-Forwarded-For 时使用 X-Real-IP。客户端可以任意填写这些请求头，
+// 因此不信任来自其他地址的请求头。无法识别对端地址时返回空字符串
+func GetClientIP(r *http.Request) string {
+	remote, ok := remoteAddr(r)
+	if !ok {
+		return ""
+	}
+	if !isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// 无法解析的地址之前的内容都可能是伪造的，使用最后一个可信代理的对端地址
+				break
+			}
+			addr = addr.Unmap()
+			remote = addr
+			if !isTrustedProxy(addr) {
+				return addr.String()
+			}
+		}
+		return remote.String()
+	}
+
+	if xri, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return xri.Unmap().String()
+	}
+	return remote.String()
+}
+
+// remoteAddr 解析连接的对端地址
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// isTrustedProxy 判断地址是否属于可信反向代理
+func isTrustedProxy(addr netip.Addr) bool {
+	prefixes := trustedProxies.Load()
+	if prefixes == nil {
+		return false
+	}
+	for _, prefix := range *prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
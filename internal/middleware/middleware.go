@@ -191,30 +191,6 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// GetClientIP 获取客户端IP地址
-func GetClientIP(r *http.Request) string {
-	// 检查X-Forwarded-For头
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		if len(parts) > 0 {
-			return strings.TrimSpace(parts[0])
-		}
-	}
-
-	// 检查X-Real-IP头
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// 使用RemoteAddr
-	parts := strings.Split(r.RemoteAddr, ":")
-	if len(parts) > 0 {
-		return parts[0]
-	}
-
-	return r.RemoteAddr
-}
-
 // GetUserFromContext 从上下文获取用户信息
 func GetUserFromContext(ctx context.Context) (userID uuid.UUID, username, role string, ok bool) {
 	userIDVal := ctx.Value("user_id")
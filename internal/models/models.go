@@ -90,21 +90,111 @@ type Rule struct {
 	BaseModel
 	Name              string `json:"name" gorm:"size:100;not null" comment:"规则名称"`                        // 规则名称
 	Description       string `json:"description" gorm:"type:text" comment:"规则描述"`                         // 规则功能描述
-	TriggerConditions string `json:"trigger_conditions" gorm:"type:jsonb;not null" comment:"触发条件，JSON格式"` // 规则触发条件，JSON格式
-	Actions           string `json:"actions" gorm:"type:jsonb;not null" comment:"执行动作，JSON格式"`            // 规则执行动作，JSON格式
+	RuleType          string `json:"rule_type" gorm:"size:20;index" comment:"规则类型"`                       // 规则类型：inject、replace、remove、modify
+	TriggerConditions string `json:"trigger_conditions" gorm:"type:jsonb;not null" comment:"触发条件，JSON格式"` // 规则触发条件，见 ruledsl.Trigger
+	Actions           string `json:"actions" gorm:"type:jsonb;not null" comment:"执行动作，JSON格式"`            // 规则执行动作，见 ruledsl.ActionSet
 	IsActive          bool   `json:"is_active" gorm:"default:true" comment:"是否启用"`                        // 规则启用状态
 	Priority          int    `json:"priority" gorm:"default:0;index" comment:"优先级，数字越大优先级越高"`             // 规则执行优先级
+	IsGlobal          bool   `json:"is_global" gorm:"not null;default:false;index" comment:"是否对所有代理配置生效"` // 全局规则对所有代理配置生效
+
+	ProxyConfigs []RuleProxyConfig `json:"proxy_configs,omitempty" gorm:"foreignKey:RuleID" comment:"绑定的代理配置"` // 规则绑定的代理配置列表
+}
+
+// RuleProxyConfig 规则代理配置关联模型 - 多对多关系表
+type RuleProxyConfig struct {
+	RuleID        uuid.UUID    `json:"rule_id" gorm:"type:uuid;primaryKey" comment:"规则ID"`                                                   // 规则ID，外键
+	ProxyConfigID uuid.UUID    `json:"proxy_config_id" gorm:"type:uuid;primaryKey;index" comment:"代理配置ID"`                                   // 代理配置ID，外键
+	CreatedAt     time.Time    `json:"created_at" gorm:"autoCreateTime" comment:"关联创建时间"`                                                    // 关联建立时间
+	Rule          *Rule        `json:"-" gorm:"foreignKey:RuleID;constraint:OnDelete:CASCADE" comment:"关联的规则"`                               // 关联的规则对象
+	ProxyConfig   *ProxyConfig `json:"proxy_config,omitempty" gorm:"foreignKey:ProxyConfigID;constraint:OnDelete:CASCADE" comment:"关联的代理配置"` // 关联的代理配置对象
 }
 
 // Popup 弹窗模型 - 存储弹窗配置信息
 type Popup struct {
 	BaseModel
-	Title       string       `json:"title" gorm:"size:200;not null" comment:"弹窗标题"`                     // 弹窗显示标题
-	Content     string       `json:"content" gorm:"type:text" comment:"弹窗内容"`                           // 弹窗显示内容
-	StyleConfig string       `json:"style_config" gorm:"type:jsonb;default:'{}'" comment:"样式配置，JSON格式"` // 弹窗样式配置
-	FormConfig  string       `json:"form_config" gorm:"type:jsonb;default:'{}'" comment:"表单配置，JSON格式"`  // 表单字段配置
-	IsActive    bool         `json:"is_active" gorm:"default:true" comment:"是否启用"`                      // 弹窗启用状态
-	Submissions []Submission `json:"submissions" gorm:"foreignKey:PopupID" comment:"用户提交的数据列表"`         // 用户提交的数据列表
+	Title        string       `json:"title" gorm:"size:200;not null" comment:"弹窗标题"`                           // 弹窗显示标题
+	Content      string       `json:"content" gorm:"type:text" comment:"弹窗内容"`                                 // 弹窗显示内容
+	StyleConfig  string       `json:"style_config" gorm:"type:jsonb;default:'{}'" comment:"样式配置，JSON格式"`       // 弹窗样式配置
+	FormConfig   string       `json:"form_config" gorm:"type:jsonb;default:'{}'" comment:"表单配置，JSON格式"`        // 表单字段配置
+	IsActive     bool         `json:"is_active" gorm:"default:true" comment:"是否启用"`                            // 弹窗启用状态
+	IsGlobal     bool         `json:"is_global" gorm:"not null;default:false;index" comment:"是否对所有代理配置生效"`     // 全局弹窗对所有代理配置生效
+	DisplayRules string       `json:"display_rules" gorm:"type:jsonb;default:'{}'" comment:"频率限制和受众规则，JSON格式"` // 展示规则，见 popupspec.DisplayRules
+	Submissions  []Submission `json:"submissions" gorm:"foreignKey:PopupID" comment:"用户提交的数据列表"`               // 用户提交的数据列表
+
+	ProxyConfigs []PopupProxyConfig `json:"proxy_configs,omitempty" gorm:"foreignKey:PopupID" comment:"绑定的代理配置"` // 弹窗绑定的代理配置列表
+	Variants     []PopupVariant     `json:"variants,omitempty" gorm:"foreignKey:PopupID" comment:"A/B测试变体"`      // 弹窗的A/B测试变体列表
+
+	DefaultLocale string             `json:"default_locale" gorm:"size:20;not null;default:''" comment:"原文语言"` // 标题、内容和表单原文使用的语言，如 en，没有匹配的翻译时使用原文
+	Translations  []PopupTranslation `json:"translations,omitempty" gorm:"foreignKey:PopupID" comment:"多语言翻译"` // 弹窗的多语言翻译列表
+
+	TriggerType   string `json:"trigger_type" gorm:"size:30;not null;default:'page_load'" comment:"触发方式"` // 触发方式，见 popupspec.TriggerTypes
+	TriggerValue  string `json:"trigger_value" gorm:"size:500" comment:"触发值"`                             // 延迟秒数、滚动百分比或CSS选择器，取决于触发方式
+	TriggerConfig string `json:"trigger_config" gorm:"type:jsonb;default:'{}'" comment:"接口调用触发条件，JSON格式"` // 触发方式为 api_call 时的匹配条件，见 popupspec.APICallTrigger
+
+	StartAt        *time.Time `json:"start_at" gorm:"index" comment:"投放开始时间"`                                 // 投放开始时间，为空时立即开始
+	EndAt          *time.Time `json:"end_at" gorm:"index" comment:"投放结束时间"`                                   // 投放结束时间，为空时不结束
+	Timezone       string     `json:"timezone" gorm:"size:64" comment:"排期时区"`                                 // 每周投放时段使用的IANA时区，为空时使用UTC
+	WeeklySchedule string     `json:"weekly_schedule" gorm:"type:jsonb;default:'[]'" comment:"每周投放时段，JSON格式"` // 每周投放时段，见 popupspec.WeeklySlot
+	ScheduleStatus string     `json:"schedule_status" gorm:"size:20;not null;default:''" comment:"排期状态"`      // 排期调度器最近记录的状态，见 popupspec.Schedule.Status
+
+	Retention string `json:"retention" gorm:"type:jsonb;default:'{}'" comment:"提交数据保留策略，JSON格式"` // 覆盖全局配置的保留天数和处理方式，见 popupspec.Retention
+	Dedup     string `json:"dedup" gorm:"type:jsonb;default:'{}'" comment:"提交去重配置，JSON格式"`       // 去重键字段、时间窗口和重复提交的处理方式，见 popupspec.Dedup
+}
+
+// PopupVariant 弹窗变体模型 - A/B测试中同一弹窗的不同版本，按权重分配流量
+type PopupVariant struct {
+	BaseModel
+	PopupID     uuid.UUID `json:"popup_id" gorm:"type:uuid;not null;index" comment:"弹窗ID"`                 // 所属弹窗ID
+	Name        string    `json:"name" gorm:"size:100;not null" comment:"变体名称"`                            // 变体名称，如 A、B
+	Title       string    `json:"title" gorm:"size:200" comment:"变体标题，为空时使用弹窗标题"`                          // 变体显示标题
+	Content     string    `json:"content" gorm:"type:text" comment:"变体内容，为空时使用弹窗内容"`                       // 变体显示内容
+	StyleConfig string    `json:"style_config" gorm:"type:jsonb;default:'{}'" comment:"变体样式配置，JSON格式"`     // 变体样式配置
+	Weight      int       `json:"weight" gorm:"not null;default:0" comment:"流量权重"`                         // 流量权重，按权重比例分配访客
+	IsControl   bool      `json:"is_control" gorm:"not null;default:false" comment:"是否为对照组"`               // 对照组，统计显著性时作为比较基准
+	IsActive    bool      `json:"is_active" gorm:"not null;default:false" comment:"是否启用"`                  // 变体启用状态，停用的变体不再分配流量
+	Popup       *Popup    `json:"-" gorm:"foreignKey:PopupID;constraint:OnDelete:CASCADE" comment:"关联的弹窗"` // 关联的弹窗对象
+}
+
+// PopupTranslation 弹窗翻译模型 - 弹窗标题、内容和表单文字在某个语言下的翻译，每个弹窗每种语言一条
+// 唯一索引包含软删除的记录，删除翻译时使用硬删除
+type PopupTranslation struct {
+	BaseModel
+	PopupID         uuid.UUID `json:"popup_id" gorm:"type:uuid;not null;uniqueIndex:idx_popup_translations_locale,priority:1" comment:"弹窗ID"` // 所属弹窗ID
+	Locale          string    `json:"locale" gorm:"size:20;not null;uniqueIndex:idx_popup_translations_locale,priority:2" comment:"语言"`       // 语言标签，如 zh-CN，见 popupspec.NormalizeLocale
+	Title           string    `json:"title" gorm:"size:200" comment:"翻译标题，为空时使用原文"`                                                           // 翻译后的标题
+	Content         string    `json:"content" gorm:"type:text" comment:"翻译内容，为空时使用原文"`                                                        // 翻译后的内容
+	FormTranslation string    `json:"form_translation" gorm:"type:jsonb;default:'{}'" comment:"表单文字翻译，JSON格式"`                                // 表单文字翻译，见 popupspec.FormTranslation
+	Popup           *Popup    `json:"-" gorm:"foreignKey:PopupID;constraint:OnDelete:CASCADE" comment:"关联的弹窗"`                                // 关联的弹窗对象
+}
+
+// 弹窗事件类型
+const (
+	PopupEventImpression = "impression" // 弹窗展示给访客
+	PopupEventClose      = "close"      // 访客关闭弹窗
+	PopupEventClick      = "click"      // 访客点击弹窗中的行动按钮或链接
+	PopupEventSubmit     = "submit"     // 访客在弹窗中提交表单
+)
+
+// PopupEvent 弹窗事件模型 - 记录弹窗展示、关闭、点击等访客事件，数据量大，不使用软删除
+type PopupEvent struct {
+	ID            uint64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"事件ID，自增主键"`                                              // 事件ID，自增主键
+	PopupID       uuid.UUID  `json:"popup_id" gorm:"type:uuid;not null;index:idx_popup_events_popup_type_time,priority:1" comment:"弹窗ID"` // 所属弹窗ID
+	VariantID     *uuid.UUID `json:"variant_id" gorm:"type:uuid;index" comment:"变体ID"`                                                    // 展示的变体ID，未启用A/B测试时为空
+	ProxyConfigID *uuid.UUID `json:"proxy_config_id" gorm:"type:uuid" comment:"代理配置ID"`                                                   // 产生事件的代理配置
+	VisitorID     string     `json:"visitor_id" gorm:"size:64;index" comment:"访客ID"`                                                      // 访客ID，来自访客Cookie
+	EventType     string     `json:"event_type" gorm:"size:20;not null;index:idx_popup_events_popup_type_time,priority:2" comment:"事件类型"` // 事件类型，如 impression
+	ElapsedMS     *int64     `json:"elapsed_ms" comment:"距弹窗展示的毫秒数"`                                                                      // 距弹窗展示的毫秒数，展示事件为空
+	Target        string     `json:"target" gorm:"size:100" comment:"点击目标"`                                                               // 点击事件的行动按钮标识
+	CreatedAt     time.Time  `json:"created_at" gorm:"autoCreateTime;index:idx_popup_events_popup_type_time,priority:3" comment:"事件时间"`   // 事件发生时间
+}
+
+// PopupProxyConfig 弹窗代理配置关联模型 - 多对多关系表
+type PopupProxyConfig struct {
+	PopupID       uuid.UUID    `json:"popup_id" gorm:"type:uuid;primaryKey" comment:"弹窗ID"`                                                  // 弹窗ID，外键
+	ProxyConfigID uuid.UUID    `json:"proxy_config_id" gorm:"type:uuid;primaryKey;index" comment:"代理配置ID"`                                   // 代理配置ID，外键
+	CreatedAt     time.Time    `json:"created_at" gorm:"autoCreateTime" comment:"关联创建时间"`                                                    // 关联建立时间
+	Popup         *Popup       `json:"-" gorm:"foreignKey:PopupID;constraint:OnDelete:CASCADE" comment:"关联的弹窗"`                              // 关联的弹窗对象
+	ProxyConfig   *ProxyConfig `json:"proxy_config,omitempty" gorm:"foreignKey:ProxyConfigID;constraint:OnDelete:CASCADE" comment:"关联的代理配置"` // 关联的代理配置对象
 }
 
 // Submission 数据提交模型 - 存储用户通过弹窗提交的数据
@@ -116,6 +206,162 @@ type Submission struct {
 	UserAgent   string    `json:"user_agent" gorm:"type:text" comment:"用户浏览器信息"`              // 用户浏览器信息
 	ReferrerURL string    `json:"referrer_url" gorm:"type:text" comment:"来源页面URL"`            // 提交时的来源页面
 	Popup       Popup     `json:"popup" gorm:"foreignKey:PopupID" comment:"关联的弹窗配置"`          // 关联的弹窗配置对象
+
+	VariantID *uuid.UUID `json:"variant_id" gorm:"type:uuid;index" comment:"变体ID"` // 提交时展示的弹窗变体，未启用A/B测试时为空
+	VisitorID string     `json:"visitor_id" gorm:"size:64;index" comment:"访客ID"`   // 访客ID，来自访客Cookie
+
+	// 多步表单逐步保存，同一弹窗、访客和会话的各步骤合并为一条提交记录
+	SessionID   string     `json:"session_id" gorm:"size:64;index" comment:"访客会话ID"`               // 提交时的访客会话ID
+	LastStep    string     `json:"last_step" gorm:"size:64" comment:"最近保存的步骤"`                     // 最近保存的表单步骤ID
+	IsPartial   bool       `json:"is_partial" gorm:"not null;default:false;index" comment:"是否未完成"` // 多步表单提交最后一步前为true
+	CompletedAt *time.Time `json:"completed_at" comment:"完成时间"`                                    // 提交最后一步的时间
+
+	// 线索处理流程
+	Status      string     `json:"status" gorm:"size:20;not null;default:'new';index" comment:"处理状态"` // 处理状态：new、contacted、qualified、spam
+	Tags        string     `json:"tags" gorm:"type:jsonb;not null;default:'[]'" comment:"标签，JSON数组"`  // 标签列表
+	AssigneeID  *uuid.UUID `json:"assignee_id" gorm:"type:uuid;index" comment:"负责人ID"`                // 负责跟进的用户，未分配时为空
+	ProcessedAt *time.Time `json:"processed_at" comment:"处理时间"`                                       // 状态最近一次离开 new 的时间
+
+	// 敏感字段加密，加密的字段值在 FormData 中保存为 {"$enc": 密文, "mask": 脱敏文本}
+	EncryptionKeyID *uuid.UUID `json:"-" gorm:"type:uuid;index" comment:"数据密钥ID"` // 加密该记录使用的数据密钥，没有加密内容时为空
+	ClientInfo      string     `json:"-" gorm:"type:text" comment:"加密的客户端信息"`     // 启用客户端信息加密时保存加密的完整IP和浏览器信息
+	MaskedFields    []string   `json:"masked_fields,omitempty" gorm:"-"`          // 显示为脱敏文本的加密字段，不保存
+
+	AnonymizedAt *time.Time `json:"anonymized_at" gorm:"index" comment:"匿名化时间"` // 超过保留期限后清除表单数据和访客信息的时间，未匿名化时为空
+
+	// 提交去重，重复提交被拒绝或合并到已有的提交记录时累加次数
+	DedupKey        string     `json:"-" gorm:"size:64;index" comment:"去重键"`                       // 去重键字段值的带密钥哈希，弹窗未配置去重或字段没有值时为空
+	DuplicateCount  int        `json:"duplicate_count" gorm:"not null;default:0" comment:"重复提交次数"` // 被拒绝、更新或合并到该记录的重复提交次数
+	LastDuplicateAt *time.Time `json:"last_duplicate_at" comment:"最近重复提交时间"`                       // 最近一次收到重复提交的时间
+	Deduplicated    bool       `json:"deduplicated,omitempty" gorm:"-"`                            // 创建提交时新数据被更新或合并到该已有记录，不保存
+
+	// 来源归因，创建提交时从会话落地页、提交页面地址和浏览器信息中获取，匿名化时保留
+	ReferrerDomain string `json:"referrer_domain" gorm:"size:255" comment:"来源域名"` // 会话开始时的外部来源域名，直接访问时为空
+	UTMSource      string `json:"utm_source" gorm:"size:100" comment:"utm_source"`
+	UTMMedium      string `json:"utm_medium" gorm:"size:100" comment:"utm_medium"`
+	UTMCampaign    string `json:"utm_campaign" gorm:"size:100" comment:"utm_campaign"`
+	UTMTerm        string `json:"utm_term" gorm:"size:100" comment:"utm_term"`
+	UTMContent     string `json:"utm_content" gorm:"size:100" comment:"utm_content"`
+	LandingPage    string `json:"landing_page" gorm:"size:500" comment:"落地页路径"`  // 会话第一个页面的路径，不含查询参数
+	ProxiedPath    string `json:"proxied_path" gorm:"size:500" comment:"提交页面路径"` // 提交表单的代理页面路径，不含查询参数
+	DeviceClass    string `json:"device_class" gorm:"size:20" comment:"设备类型"`    // desktop、mobile、tablet 或 bot
+}
+
+// DataKey 数据密钥模型 - 加密提交敏感字段的数据密钥和计算盲索引的密钥，由配置中的主密钥包装后保存
+type DataKey struct {
+	BaseModel
+	Purpose     string     `json:"purpose" gorm:"size:20;not null;uniqueIndex:idx_data_keys_active,where:status = 'active'" comment:"密钥用途"` // data 加密字段值，index 计算盲索引
+	WrappedKey  string     `json:"-" gorm:"type:text;not null" comment:"包装后的密钥"`                                                            // 主密钥加密的密钥
+	MasterKeyID string     `json:"master_key_id" gorm:"size:64;not null" comment:"主密钥标识"`                                                   // 包装该密钥使用的主密钥
+	Status      string     `json:"status" gorm:"size:20;not null;uniqueIndex:idx_data_keys_active" comment:"密钥状态"`                          // active 或 retired，每种用途同一时间只有一个 active 密钥
+	RetiredAt   *time.Time `json:"retired_at" comment:"停用时间"`                                                                               // 轮换后停止用于加密的时间
+}
+
+// SubmissionNote 提交备注模型 - 处理线索时填写的内部备注，只在管理后台显示
+type SubmissionNote struct {
+	BaseModel
+	SubmissionID uuid.UUID  `json:"submission_id" gorm:"type:uuid;not null;index" comment:"提交记录ID"` // 所属提交记录
+	AuthorID     *uuid.UUID `json:"author_id" gorm:"type:uuid" comment:"作者ID"`                      // 填写备注的用户
+	Author       string     `json:"author" gorm:"size:50" comment:"作者用户名"`                          // 填写时的用户名，用户删除后仍可显示
+	Body         string     `json:"body" gorm:"type:text;not null" comment:"备注内容"`                  // 备注内容
+}
+
+// File 文件模型 - 管理后台上传的文件和弹窗表单上传的文件，内容保存在文件存储中
+type File struct {
+	BaseModel
+	Filename     string     `json:"filename" gorm:"size:255;not null;uniqueIndex" comment:"存储键"` // 文件在存储后端中的键
+	OriginalName string     `json:"original_name" gorm:"size:255" comment:"原始文件名"`               // 上传时的文件名
+	Size         int64      `json:"size" gorm:"not null" comment:"文件大小，字节"`                      // 文件大小
+	ContentType  string     `json:"type" gorm:"size:100" comment:"MIME类型"`                       // 根据文件内容识别的MIME类型
+	Category     string     `json:"category" gorm:"size:50;index" comment:"分类"`                  // 文件分类，弹窗表单上传的文件为 form
+	Checksum     string     `json:"checksum" gorm:"size:64" comment:"SHA-256校验和"`                // 文件内容的SHA-256
+	UploadedBy   *uuid.UUID `json:"uploaded_by" gorm:"type:uuid" comment:"上传用户ID"`               // 管理后台上传的用户，表单上传时为空
+	PopupID      *uuid.UUID `json:"popup_id" gorm:"type:uuid;index" comment:"弹窗ID"`              // 表单上传文件所属的弹窗
+	SubmissionID *uuid.UUID `json:"submission_id" gorm:"type:uuid;index" comment:"提交记录ID"`       // 引用该文件的提交记录，提交前为空
+	FieldName    string     `json:"field_name" gorm:"size:64" comment:"表单字段名"`                   // 表单上传文件对应的字段
+	VisitorID    string     `json:"-" gorm:"size:64;index" comment:"上传访客ID"`                     // 表单上传文件的访客，提交时只能引用自己上传的文件
+	URL          string     `json:"url" gorm:"-"`                                                // 管理后台下载地址，不存储
+}
+
+// ExportJob 导出任务模型 - 后台把提交数据流式导出为文件，完成后可以在过期前下载
+type ExportJob struct {
+	BaseModel
+	UserID        uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index" comment:"创建用户ID"` // 创建任务的用户，任务列表按用户区分
+	PopupID       uuid.UUID  `json:"popup_id" gorm:"type:uuid;not null;index" comment:"弹窗ID"`  // 导出的弹窗
+	Format        string     `json:"format" gorm:"size:10;not null" comment:"导出格式"`            // json、csv 或 xlsx
+	Columns       string     `json:"columns" gorm:"size:20" comment:"表单字段列"`                   // schema 或 union，为空时自动选择
+	BOM           bool       `json:"bom" gorm:"not null;default:false" comment:"CSV是否写入BOM"`   // CSV开头写入UTF-8 BOM
+	Decrypt       bool       `json:"decrypt" gorm:"not null;default:false" comment:"是否解密敏感字段"` // 创建用户有解密权限时导出敏感字段的原文，否则导出脱敏文本
+	StartDate     string     `json:"start_date" gorm:"size:10" comment:"开始日期"`                 // 提交时间范围的开始日期，YYYY-MM-DD
+	EndDate       string     `json:"end_date" gorm:"size:10" comment:"结束日期"`                   // 提交时间范围的结束日期，YYYY-MM-DD
+	Status        string     `json:"status" gorm:"size:20;not null;index" comment:"任务状态"`      // pending、running、completed、failed 或 expired
+	TotalRows     int64      `json:"total_rows" gorm:"not null;default:0" comment:"总行数"`       // 开始导出时统计的提交记录数
+	ProcessedRows int64      `json:"processed_rows" gorm:"not null;default:0" comment:"已导出行数"` // 已写入文件的提交记录数
+	StorageKey    string     `json:"-" gorm:"size:255" comment:"文件存储键"`                        // 导出文件在存储后端中的键
+	FileSize      int64      `json:"file_size" gorm:"not null;default:0" comment:"文件大小，字节"`    // 导出文件的大小
+	Error         string     `json:"error,omitempty" gorm:"type:text" comment:"失败原因"`          // 任务失败时的错误信息
+	StartedAt     *time.Time `json:"started_at" comment:"开始时间"`                                // 开始导出的时间
+	CompletedAt   *time.Time `json:"completed_at" comment:"完成时间"`                              // 导出完成或失败的时间
+	ExpiresAt     *time.Time `json:"expires_at" gorm:"index" comment:"过期时间"`                   // 导出文件的过期时间，过期后自动删除
+}
+
+// Webhook Webhook订阅模型 - 提交记录事件发生时向订阅地址发送签名的POST请求
+type Webhook struct {
+	BaseModel
+	Name          string     `json:"name" gorm:"size:100;not null" comment:"名称"`                            // 订阅名称
+	URL           string     `json:"url" gorm:"type:text;not null" comment:"接收地址"`                          // 接收事件的HTTP(S)地址
+	Secret        string     `json:"-" gorm:"size:128;not null" comment:"签名密钥"`                             // 计算请求签名的密钥，只在创建和轮换时返回
+	Events        string     `json:"events" gorm:"type:jsonb;not null;default:'[]'" comment:"订阅的事件，JSON数组"` // 订阅的事件类型，如 ["submission.completed"]
+	PopupID       *uuid.UUID `json:"popup_id" gorm:"type:uuid;index" comment:"弹窗ID"`                        // 只接收该弹窗的事件，为空时接收所有弹窗
+	ProxyConfigID *uuid.UUID `json:"proxy_config_id" gorm:"type:uuid;index" comment:"代理配置ID"`               // 只接收通过该代理配置提交的事件，为空时不限
+	IsActive      bool       `json:"is_active" gorm:"not null;default:true;index" comment:"是否启用"`           // 停用后不再产生新的投递
+	MaskSensitive bool       `json:"mask_sensitive" gorm:"not null;default:false" comment:"是否脱敏"`           // 敏感字段只发送脱敏文本，否则发送原文并记录审计日志
+	Description   string     `json:"description" gorm:"type:text" comment:"描述"`                             // 订阅说明
+}
+
+// WebhookDelivery Webhook投递模型 - 与提交记录在同一事务中写入的发件箱，由后台投递并按指数退避重试
+type WebhookDelivery struct {
+	BaseModel
+	WebhookID      uuid.UUID  `json:"webhook_id" gorm:"type:uuid;not null;index" comment:"Webhook ID"`                              // 所属的Webhook订阅
+	Event          string     `json:"event" gorm:"size:64;not null" comment:"事件类型"`                                                 // 事件类型
+	Payload        string     `json:"payload" gorm:"type:jsonb;not null" comment:"请求体，JSON格式"`                                      // 事件发生时生成的请求体，重试和重放时不变
+	SubmissionID   *uuid.UUID `json:"submission_id" gorm:"type:uuid;index" comment:"提交记录ID"`                                        // 触发事件的提交记录，测试投递时为空
+	Status         string     `json:"status" gorm:"size:20;not null;index:idx_webhook_deliveries_due,priority:1" comment:"投递状态"`    // pending、delivered 或 dead
+	Attempts       int        `json:"attempts" gorm:"not null;default:0" comment:"已投递次数"`                                           // 已经发出的请求次数
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"not null;index:idx_webhook_deliveries_due,priority:2" comment:"下次投递时间"` // 待投递时下次发送的时间
+	LastError      string     `json:"last_error,omitempty" gorm:"type:text" comment:"最近的错误"`                                        // 最近一次失败的原因
+	ResponseStatus int        `json:"response_status" gorm:"not null;default:0" comment:"最近的响应状态码"`                                 // 最近一次请求的HTTP状态码，请求未完成时为0
+	DeliveredAt    *time.Time `json:"delivered_at" comment:"投递成功时间"`                                                                // 接收方返回2xx的时间
+}
+
+// PopupNotification 弹窗通知设置模型 - 每个弹窗一条，决定新提交的邮件通知方式
+type PopupNotification struct {
+	BaseModel
+	PopupID         uuid.UUID  `json:"popup_id" gorm:"type:uuid;not null;uniqueIndex" comment:"弹窗ID"`           // 所属弹窗
+	Mode            string     `json:"mode" gorm:"size:10;not null;default:'off';index" comment:"通知方式"`         // off、instant、hourly 或 daily
+	Recipients      string     `json:"recipients" gorm:"type:jsonb;not null;default:'[]'" comment:"收件人，JSON数组"` // 收件人邮箱地址
+	SubjectTemplate string     `json:"subject_template" gorm:"type:text" comment:"标题模板"`                        // 邮件标题模板，为空时使用默认模板
+	BodyTemplate    string     `json:"body_template" gorm:"type:text" comment:"正文模板"`                           // 邮件正文模板，为空时使用默认模板
+	DigestHour      int        `json:"digest_hour" gorm:"not null;default:0" comment:"每日汇总时间"`                  // 每日汇总在服务器时区的几点发送，0-23
+	MaskSensitive   bool       `json:"mask_sensitive" gorm:"not null;default:false" comment:"是否脱敏"`             // 邮件中敏感字段只显示脱敏文本，否则显示原文并记录审计日志
+	LastDigestAt    *time.Time `json:"last_digest_at" comment:"最近汇总截止时间"`                                       // 最近一次汇总覆盖到的时间，下次汇总从这里开始
+}
+
+// MailMessage 邮件发件箱模型 - 待发送的通知邮件，发送失败时按指数退避重试
+type MailMessage struct {
+	BaseModel
+	PopupID       *uuid.UUID `json:"popup_id" gorm:"type:uuid;index" comment:"弹窗ID"`                                          // 触发通知的弹窗，测试邮件为空
+	SubmissionID  *uuid.UUID `json:"submission_id" gorm:"type:uuid;index" comment:"提交记录ID"`                                   // 只包含一条提交的通知邮件对应的提交，删除个人数据时删除邮件
+	SubmissionIDs string     `json:"submission_ids" gorm:"type:jsonb;default:'[]'" comment:"提交记录ID，JSON数组"`                   // 包含多条提交的汇总邮件对应的提交
+	Kind          string     `json:"kind" gorm:"size:20;not null" comment:"邮件类型"`                                             // instant 或 digest
+	Recipients    string     `json:"recipients" gorm:"type:jsonb;not null" comment:"收件人，JSON数组"`                              // 收件人邮箱地址
+	Subject       string     `json:"subject" gorm:"type:text;not null" comment:"标题"`                                          // 渲染后的标题
+	Body          string     `json:"body" gorm:"type:text;not null" comment:"正文"`                                             // 渲染后的纯文本正文
+	Status        string     `json:"status" gorm:"size:20;not null;index:idx_mail_messages_due,priority:1" comment:"发送状态"`    // pending、sent 或 failed
+	Attempts      int        `json:"attempts" gorm:"not null;default:0" comment:"已发送次数"`                                      // 已经尝试发送的次数
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index:idx_mail_messages_due,priority:2" comment:"下次发送时间"` // 待发送时下次尝试的时间
+	LastError     string     `json:"last_error,omitempty" gorm:"type:text" comment:"最近的错误"`                                   // 最近一次发送失败的原因
+	SentAt        *time.Time `json:"sent_at" comment:"发送时间"`                                                                  // 发送成功的时间
 }
 
 // ProxyLog 代理日志模型 - 存储代理服务访问日志
@@ -131,6 +377,17 @@ type ProxyLog struct {
 	ErrorMessage  string    `json:"error_message" gorm:"type:text" comment:"错误信息"`           // 错误信息，失败时记录
 }
 
+// AuditLog 审计日志模型 - 记录用户操作和系统自动执行的变更，只追加不修改
+type AuditLog struct {
+	ID           uint64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"日志ID，自增主键"`                                        // 日志ID，自增主键
+	Action       string     `json:"action" gorm:"size:64;not null;index" comment:"操作"`                                             // 操作，如 popup.activated
+	ResourceType string     `json:"resource_type" gorm:"size:50;not null;index:idx_audit_logs_resource,priority:1" comment:"资源类型"` // 资源类型，如 popup
+	ResourceID   string     `json:"resource_id" gorm:"size:64;index:idx_audit_logs_resource,priority:2" comment:"资源ID"`            // 资源ID
+	ActorID      *uuid.UUID `json:"actor_id" gorm:"type:uuid;index" comment:"操作用户ID"`                                              // 操作用户ID，系统自动执行时为空
+	Details      string     `json:"details" gorm:"type:jsonb;default:'{}'" comment:"详细信息，JSON格式"`                                  // 变更详情
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime;index" comment:"记录时间"`                                         // 记录时间
+}
+
 // SystemMetric 系统指标模型 - 存储系统监控指标数据
 type SystemMetric struct {
 	BaseModel
@@ -178,14 +435,58 @@ func (Popup) TableName() string {
 	return "popups" // 弹窗配置表
 }
 
+func (RuleProxyConfig) TableName() string {
+	return "rule_proxy_configs" // 规则代理配置关联表
+}
+
+func (PopupProxyConfig) TableName() string {
+	return "popup_proxy_configs" // 弹窗代理配置关联表
+}
+
+func (PopupVariant) TableName() string {
+	return "popup_variants" // 弹窗变体表
+}
+
+func (PopupEvent) TableName() string {
+	return "popup_events" // 弹窗事件表
+}
+
 func (Submission) TableName() string {
 	return "submissions" // 数据提交表
 }
 
+func (File) TableName() string {
+	return "files" // 文件表
+}
+
 func (ProxyLog) TableName() string {
 	return "proxy_logs" // 代理访问日志表
 }
 
+func (AuditLog) TableName() string {
+	return "audit_logs" // 审计日志表
+}
+
+func (ExportJob) TableName() string {
+	return "export_jobs" // 导出任务表
+}
+
+func (Webhook) TableName() string {
+	return "webhooks" // Webhook订阅表
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries" // Webhook投递表
+}
+
+func (PopupNotification) TableName() string {
+	return "popup_notifications" // 弹窗通知设置表
+}
+
+func (MailMessage) TableName() string {
+	return "mail_messages" // 邮件发件箱表
+}
+
 func (SystemMetric) TableName() string {
 	return "system_metrics" // 系统监控指标表
 }
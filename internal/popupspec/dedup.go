@@ -0,0 +1,132 @@
+package popupspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"proxy-enhancer-ultra/internal/fieldcrypt"
+)
+
+// 重复提交的处理方式
+const (
+	DedupReject = "reject" // 拒绝新的提交
+	DedupUpdate = "update" // 用新的表单数据替换已有提交的表单数据
+	DedupMerge  = "merge"  // 新的表单数据只补充已有提交中没有值的字段
+)
+
+// 去重配置限制
+const (
+	maxDedupFields      = 5
+	maxDedupWindowHours = 24 * 366
+)
+
+// Dedup 弹窗提交去重配置，去重键字段的值都相同且在时间窗口内的完成提交视为重复提交
+type Dedup struct {
+	Fields      []string `json:"fields,omitempty"`       // 组成去重键的表单字段，如 phone、email，为空时不去重
+	WindowHours int      `json:"window_hours,omitempty"` // 与已有提交的创建时间间隔不超过该小时数时视为重复，为0时不限制
+	Action      string   `json:"action,omitempty"`       // reject、update 或 merge，为空时拒绝
+}
+
+// ParseDedup 解析去重配置JSON，为空时返回空配置
+func ParseDedup(raw string) (*Dedup, error) {
+	dedup := &Dedup{}
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "null" {
+		return dedup, nil
+	}
+	if err := json.Unmarshal([]byte(raw), dedup); err != nil {
+		return nil, fmt.Errorf("invalid dedup config: %w", err)
+	}
+	return dedup, nil
+}
+
+// Normalize 规范化去重配置，未设置字段时清空其他设置
+func (d *Dedup) Normalize() {
+	fields := make([]string, 0, len(d.Fields))
+	for _, field := range d.Fields {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	d.Fields = fields
+	d.Action = strings.ToLower(strings.TrimSpace(d.Action))
+	if len(d.Fields) == 0 {
+		*d = Dedup{}
+		return
+	}
+	if d.Action == "" {
+		d.Action = DedupReject
+	}
+}
+
+// Validate 校验去重配置，form 不为nil时去重键字段必须是表单中的非文件字段
+func (d *Dedup) Validate(form *FormConfig) error {
+	if len(d.Fields) > maxDedupFields {
+		return fmt.Errorf("at most %d dedup fields are allowed", maxDedupFields)
+	}
+	seen := make(map[string]bool, len(d.Fields))
+	for _, name := range d.Fields {
+		if !ValidFieldName(name) {
+			return fmt.Errorf("invalid dedup field name: %s", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate dedup field: %s", name)
+		}
+		seen[name] = true
+		if form == nil || form.IsZero() {
+			continue
+		}
+		field := form.FindField(name)
+		if field == nil {
+			return fmt.Errorf("dedup field %s is not in the form", name)
+		}
+		if field.Type == FieldFile {
+			return fmt.Errorf("file field %s cannot be a dedup field", name)
+		}
+	}
+	if d.WindowHours < 0 || d.WindowHours > maxDedupWindowHours {
+		return fmt.Errorf("dedup window_hours must be between 0 and %d", maxDedupWindowHours)
+	}
+	switch d.Action {
+	case DedupReject, DedupUpdate, DedupMerge:
+	case "":
+		if len(d.Fields) > 0 {
+			return fmt.Errorf("dedup action is required")
+		}
+	default:
+		return fmt.Errorf("invalid dedup action: %s", d.Action)
+	}
+	return nil
+}
+
+// IsZero 判断是否未启用去重
+func (d *Dedup) IsZero() bool {
+	return len(d.Fields) == 0
+}
+
+// Marshal 序列化去重配置，用于存储
+func (d *Dedup) Marshal() (string, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal dedup config: %w", err)
+	}
+	return string(data), nil
+}
+
+// Key 返回表单数据的去重键原文，由字段名和规范化后的字段值组成，任一字段没有值时返回 false
+// 字段值按 fieldcrypt.NormalizeValue 规范化，同一手机号的不同写法得到相同的键
+func (d *Dedup) Key(data map[string]interface{}) (string, bool) {
+	if d.IsZero() {
+		return "", false
+	}
+	parts := make([]string, 0, len(d.Fields)*2)
+	for _, name := range d.Fields {
+		text, ok := fieldcrypt.NormalizeValue(data[name])
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, name, text)
+	}
+	return strings.Join(parts, "\x00"), true
+}
@@ -0,0 +1,196 @@
+package popupspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 访客类型
+const (
+	VisitorAny       = ""          // 不限
+	VisitorNew       = "new"       // 首次会话的访客
+	VisitorReturning = "returning" // 之前访问过的访客
+)
+
+// 展示规则限制
+const (
+	maxPerDayLimit  = 100
+	maxPageViews    = 1000
+	maxUTMSources   = 50
+	maxUTMSourceLen = 100
+)
+
+// DisplayRules 弹窗的频率限制和受众规则，存储于 Popup.DisplayRules
+//
+// 规则由注入的页面脚本在展示前判断，HTMLInjector 也会根据访客状态Cookie
+// 做相同的判断，不满足规则的弹窗不会注入页面
+type DisplayRules struct {
+	Frequency FrequencyCap `json:"frequency"`
+	Audience  Audience     `json:"audience"`
+}
+
+// FrequencyCap 频率限制，零值表示不限制
+type FrequencyCap struct {
+	OncePerSession  bool `json:"once_per_session,omitempty"`  // 每个会话最多展示一次
+	MaxPerDay       int  `json:"max_per_day,omitempty"`       // 每天最多展示次数（UTC日期）
+	StopAfterSubmit bool `json:"stop_after_submit,omitempty"` // 提交后不再展示
+	StopAfterClose  bool `json:"stop_after_close,omitempty"`  // 关闭后不再展示
+}
+
+// Audience 受众规则，零值表示不限制
+type Audience struct {
+	Visitor      string   `json:"visitor,omitempty"`        // new、returning，为空时不限
+	MinPageViews int      `json:"min_page_views,omitempty"` // 本次会话的最少浏览页数（含当前页面）
+	MaxPageViews int      `json:"max_page_views,omitempty"` // 本次会话的最多浏览页数，0表示不限
+	UTMSources   []string `json:"utm_sources,omitempty"`    // 会话来源的 utm_source，为空时不限，不区分大小写
+}
+
+// ParseDisplayRules 解析展示规则JSON，空值返回零值规则
+func ParseDisplayRules(raw string) (*DisplayRules, error) {
+	rules := &DisplayRules{}
+	if strings.TrimSpace(raw) == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(raw), rules); err != nil {
+		return nil, fmt.Errorf("invalid display rules: %w", err)
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Normalize 统一 utm_source 的大小写并去除空白和重复值
+func (d *DisplayRules) Normalize() {
+	d.Audience.Visitor = strings.ToLower(strings.TrimSpace(d.Audience.Visitor))
+
+	seen := make(map[string]bool, len(d.Audience.UTMSources))
+	sources := make([]string, 0, len(d.Audience.UTMSources))
+	for _, source := range d.Audience.UTMSources {
+		source = normalizeUTMSource(source)
+		if source == "" || seen[source] {
+			continue
+		}
+		seen[source] = true
+		sources = append(sources, source)
+	}
+	d.Audience.UTMSources = sources
+}
+
+// Validate 校验展示规则
+func (d *DisplayRules) Validate() error {
+	frequency := d.Frequency
+	if frequency.MaxPerDay < 0 || frequency.MaxPerDay > maxPerDayLimit {
+		return fmt.Errorf("max_per_day must be between 0 and %d", maxPerDayLimit)
+	}
+
+	audience := d.Audience
+	switch audience.Visitor {
+	case VisitorAny, VisitorNew, VisitorReturning:
+	default:
+		return fmt.Errorf("visitor must be one of %q, %q", VisitorNew, VisitorReturning)
+	}
+	if audience.MinPageViews < 0 || audience.MinPageViews > maxPageViews {
+		return fmt.Errorf("min_page_views must be between 0 and %d", maxPageViews)
+	}
+	if audience.MaxPageViews < 0 || audience.MaxPageViews > maxPageViews {
+		return fmt.Errorf("max_page_views must be between 0 and %d", maxPageViews)
+	}
+	if audience.MaxPageViews > 0 && audience.MaxPageViews < audience.MinPageViews {
+		return fmt.Errorf("max_page_views must not be less than min_page_views")
+	}
+	if len(audience.UTMSources) > maxUTMSources {
+		return fmt.Errorf("at most %d utm_sources are allowed", maxUTMSources)
+	}
+	for _, source := range audience.UTMSources {
+		if len([]rune(source)) > maxUTMSourceLen {
+			return fmt.Errorf("utm_source %q is too long", source)
+		}
+	}
+	return nil
+}
+
+// IsZero 判断是否未设置任何规则
+func (d *DisplayRules) IsZero() bool {
+	return d.Frequency == FrequencyCap{} &&
+		d.Audience.Visitor == VisitorAny &&
+		d.Audience.MinPageViews == 0 &&
+		d.Audience.MaxPageViews == 0 &&
+		len(d.Audience.UTMSources) == 0
+}
+
+// Marshal 序列化为存储和注入页面使用的JSON
+func (d *DisplayRules) Marshal() (string, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal display rules: %w", err)
+	}
+	return string(data), nil
+}
+
+// Allows 判断访客当前的页面浏览是否满足弹窗的展示规则，不满足时返回原因
+// state 应已通过 Advance 计入当前页面
+func (d *DisplayRules) Allows(popupID string, state *VisitorState) (bool, string) {
+	audience := d.Audience
+	switch audience.Visitor {
+	case VisitorNew:
+		if state.Session.Returning {
+			return false, "visitor is returning"
+		}
+	case VisitorReturning:
+		if !state.Session.Returning {
+			return false, "visitor is new"
+		}
+	}
+	if audience.MinPageViews > 0 && state.Session.PageViews < audience.MinPageViews {
+		return false, "not enough page views"
+	}
+	if audience.MaxPageViews > 0 && state.Session.PageViews > audience.MaxPageViews {
+		return false, "too many page views"
+	}
+	if len(audience.UTMSources) > 0 && !containsFold(audience.UTMSources, state.Session.UTMSource) {
+		return false, "utm_source does not match"
+	}
+
+	popup := state.Popups[popupID]
+	if popup == nil {
+		return true, ""
+	}
+	frequency := d.Frequency
+	if frequency.StopAfterSubmit && popup.Submitted {
+		return false, "already submitted"
+	}
+	if frequency.StopAfterClose && popup.Closed {
+		return false, "already closed"
+	}
+	if frequency.OncePerSession && popup.SessionID != "" && popup.SessionID == state.Session.ID {
+		return false, "already shown in this session"
+	}
+	if frequency.MaxPerDay > 0 && popup.Day == state.day() && popup.DayCount >= frequency.MaxPerDay {
+		return false, "daily limit reached"
+	}
+	return true, ""
+}
+
+// normalizeUTMSource 规范化 utm_source
+func normalizeUTMSource(source string) string {
+	source = strings.ToLower(strings.TrimSpace(source))
+	if runes := []rune(source); len(runes) > maxUTMSourceLen {
+		source = string(runes[:maxUTMSourceLen])
+	}
+	return source
+}
+
+// containsFold 判断列表中是否包含不区分大小写的值
+func containsFold(values []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
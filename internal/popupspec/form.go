@@ -0,0 +1,733 @@
+package popupspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 表单字段类型
+const (
+	FieldText     = "text"
+	FieldEmail    = "email"
+	FieldTel      = "tel"
+	FieldNumber   = "number"
+	FieldTextarea = "textarea"
+	FieldSelect   = "select"
+	FieldRadio    = "radio"
+	FieldCheckbox = "checkbox" // 单个复选框，值为布尔值
+	FieldFile     = "file"     // 文件，页面脚本先上传文件，提交时的值为文件ID
+)
+
+// FieldTypes 支持的表单字段类型
+var FieldTypes = []string{
+	FieldText,
+	FieldEmail,
+	FieldTel,
+	FieldNumber,
+	FieldTextarea,
+	FieldSelect,
+	FieldRadio,
+	FieldCheckbox,
+	FieldFile,
+}
+
+// 字段显示条件的运算符
+const (
+	ConditionEquals    = "eq"        // 等于 Value
+	ConditionNotEquals = "neq"       // 不等于 Value
+	ConditionIn        = "in"        // 等于 Values 中的任意一个
+	ConditionNotIn     = "not_in"    // 不等于 Values 中的任何一个
+	ConditionNotEmpty  = "not_empty" // 已填写
+	ConditionEmpty     = "empty"     // 未填写
+)
+
+// 表单验证码类型，提交最后一步时校验
+const (
+	CaptchaImage       = "image" // 图片验证码，访客在最后一步填写
+	CaptchaProofOfWork = "pow"   // 工作量证明，页面脚本在后台计算，访客无需操作
+)
+
+// 表单配置限制
+const (
+	maxFormSteps        = 10
+	maxFormFields       = 50
+	maxFormOptions      = 100
+	maxFormTextLen      = 200
+	maxFormMessageLen   = 1000
+	maxFormPatternLen   = 200
+	maxFormValueLen     = 5000
+	maxConditionValues  = 50
+	maxFileAcceptTypes  = 20
+	defaultFormStepName = "step"
+)
+
+// 文件字段的大小限制，字节
+const (
+	DefaultFileMaxSize int64 = 5 << 20
+	MaxFileSize        int64 = 20 << 20
+)
+
+// FileIDKey 文件字段在表单数据中保存为对象，该键为存储的文件ID
+const FileIDKey = "file_id"
+
+// 表单值格式
+var (
+	formNamePattern  = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,63}$`)
+	formEmailPattern = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+	mimeTypePattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]*/(\*|[a-z0-9][a-z0-9.+-]*)$`)
+	fileIDPattern    = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// FormConfig 弹窗表单配置，存储于 Popup.FormConfig
+//
+// 单页表单使用 Fields，多步表单使用 Steps，两者只能设置一个。页面脚本逐步提交，
+// 服务端按弹窗、访客和会话把各步骤的数据合并为一条提交记录，提交最后一步前记录为未完成。
+// 字段的 ShowIf 只能引用在它之前声明的字段，隐藏字段的值不会保存
+type FormConfig struct {
+	Fields         []FormField `json:"fields,omitempty"`
+	Steps          []FormStep  `json:"steps,omitempty"`
+	ShowProgress   bool        `json:"show_progress,omitempty"`   // 多步表单显示进度条
+	SubmitLabel    string      `json:"submit_label,omitempty"`    // 提交按钮文字
+	NextLabel      string      `json:"next_label,omitempty"`      // 下一步按钮文字
+	BackLabel      string      `json:"back_label,omitempty"`      // 上一步按钮文字
+	SuccessMessage string      `json:"success_message,omitempty"` // 提交成功后显示的文字，为空时直接关闭弹窗
+	SubmitURL      string      `json:"submit_url,omitempty"`      // 提交完成后由页面脚本把完整数据另外发送到的地址
+	Captcha        string      `json:"captcha,omitempty"`         // 验证码类型，为空时不使用验证码，见 CaptchaImage
+	CaptchaLabel   string      `json:"captcha_label,omitempty"`   // 图片验证码输入框的文字
+}
+
+// FormStep 多步表单的一个步骤
+type FormStep struct {
+	ID     string      `json:"id"` // 步骤ID，为空时按顺序生成
+	Title  string      `json:"title,omitempty"`
+	Fields []FormField `json:"fields"`
+}
+
+// FormField 表单字段
+type FormField struct {
+	Name         string            `json:"name"` // 字段名，在整个表单中唯一，作为提交数据的键
+	Label        string            `json:"label"`
+	Type         string            `json:"type"` // 字段类型，见 FieldTypes，默认 text
+	Required     bool              `json:"required"`
+	Options      []string          `json:"options,omitempty"`       // select、radio 的选项
+	OptionLabels map[string]string `json:"option_labels,omitempty"` // 选项的显示文字，键为选项值，未设置时显示选项值
+	Placeholder  string            `json:"placeholder,omitempty"`
+	Validation   *FieldValidation  `json:"validation,omitempty"`
+	ShowIf       *FieldCondition   `json:"show_if,omitempty"` // 显示条件，为空时始终显示
+	Accept       []string          `json:"accept,omitempty"`   // 文件字段允许的MIME类型，如 image/*，为空时不限制
+	MaxSize      int64             `json:"max_size,omitempty"` // 文件字段的最大字节数，为0时使用 DefaultFileMaxSize
+	Sensitive    bool              `json:"sensitive,omitempty"` // 敏感字段，配置了加密主密钥时加密保存，管理后台脱敏显示，不能按字段值搜索
+}
+
+// FieldValidation 文本字段的校验规则
+type FieldValidation struct {
+	MinLength int    `json:"min_length,omitempty"`
+	MaxLength int    `json:"max_length,omitempty"`
+	Pattern   string `json:"pattern,omitempty"` // 正则表达式，需完整匹配
+	Message   string `json:"message,omitempty"` // 校验失败时的提示
+}
+
+// FieldCondition 字段显示条件，比较引用字段的值。复选框勾选时值为 true，未勾选和隐藏的字段视为未填写
+type FieldCondition struct {
+	Field    string   `json:"field"`
+	Operator string   `json:"operator"`
+	Value    string   `json:"value,omitempty"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// ParseFormConfig 解析并规范化表单配置JSON，空值返回零值配置
+func ParseFormConfig(raw string) (*FormConfig, error) {
+	form := &FormConfig{}
+	if strings.TrimSpace(raw) == "" {
+		return form, nil
+	}
+	if err := json.Unmarshal([]byte(raw), form); err != nil {
+		return nil, fmt.Errorf("invalid form config: %w", err)
+	}
+	form.Normalize()
+	if err := form.Validate(); err != nil {
+		return nil, err
+	}
+	return form, nil
+}
+
+// Normalize 去除空白，补全默认的字段类型、条件运算符和步骤ID
+func (c *FormConfig) Normalize() {
+	c.SubmitLabel = strings.TrimSpace(c.SubmitLabel)
+	c.NextLabel = strings.TrimSpace(c.NextLabel)
+	c.BackLabel = strings.TrimSpace(c.BackLabel)
+	c.SuccessMessage = strings.TrimSpace(c.SuccessMessage)
+	c.SubmitURL = strings.TrimSpace(c.SubmitURL)
+	c.Captcha = strings.ToLower(strings.TrimSpace(c.Captcha))
+	c.CaptchaLabel = strings.TrimSpace(c.CaptchaLabel)
+	for i := range c.Fields {
+		c.Fields[i].normalize()
+	}
+	for i := range c.Steps {
+		step := &c.Steps[i]
+		step.ID = strings.TrimSpace(step.ID)
+		if step.ID == "" {
+			step.ID = defaultFormStepName + strconv.Itoa(i+1)
+		}
+		step.Title = strings.TrimSpace(step.Title)
+		for j := range step.Fields {
+			step.Fields[j].normalize()
+		}
+	}
+}
+
+// normalize 规范化字段
+func (f *FormField) normalize() {
+	f.Name = strings.TrimSpace(f.Name)
+	f.Label = strings.TrimSpace(f.Label)
+	f.Type = strings.ToLower(strings.TrimSpace(f.Type))
+	if f.Type == "" {
+		f.Type = FieldText
+	}
+	f.Placeholder = strings.TrimSpace(f.Placeholder)
+	f.Options = normalizeList(f.Options, func(s string) string { return s })
+	f.Accept = normalizeList(f.Accept, strings.ToLower)
+	if f.ShowIf != nil {
+		f.ShowIf.Field = strings.TrimSpace(f.ShowIf.Field)
+		f.ShowIf.Operator = strings.ToLower(strings.TrimSpace(f.ShowIf.Operator))
+		if f.ShowIf.Operator == "" {
+			f.ShowIf.Operator = ConditionEquals
+		}
+	}
+}
+
+// Validate 校验表单配置
+func (c *FormConfig) Validate() error {
+	if len(c.Fields) > 0 && len(c.Steps) > 0 {
+		return fmt.Errorf("fields and steps cannot both be set")
+	}
+	if len(c.Steps) > maxFormSteps {
+		return fmt.Errorf("at most %d steps are allowed", maxFormSteps)
+	}
+	if len([]rune(c.SubmitLabel)) > maxFormTextLen || len([]rune(c.NextLabel)) > maxFormTextLen || len([]rune(c.BackLabel)) > maxFormTextLen {
+		return fmt.Errorf("button labels must be at most %d characters", maxFormTextLen)
+	}
+	if len([]rune(c.SuccessMessage)) > maxFormMessageLen {
+		return fmt.Errorf("success_message must be at most %d characters", maxFormMessageLen)
+	}
+	if c.SubmitURL != "" && !validSubmitURL(c.SubmitURL) {
+		return fmt.Errorf("submit_url must be an http(s) URL or a path starting with /")
+	}
+	if c.Captcha != "" && c.Captcha != CaptchaImage && c.Captcha != CaptchaProofOfWork {
+		return fmt.Errorf("captcha must be one of %s, %s", CaptchaImage, CaptchaProofOfWork)
+	}
+	if len([]rune(c.CaptchaLabel)) > maxFormTextLen {
+		return fmt.Errorf("captcha_label must be at most %d characters", maxFormTextLen)
+	}
+
+	stepIDs := make(map[string]bool, len(c.Steps))
+	for _, step := range c.Steps {
+		if !formNamePattern.MatchString(step.ID) {
+			return fmt.Errorf("invalid step id %q", step.ID)
+		}
+		if stepIDs[step.ID] {
+			return fmt.Errorf("duplicate step id %q", step.ID)
+		}
+		stepIDs[step.ID] = true
+		if len(step.Fields) == 0 {
+			return fmt.Errorf("step %q has no fields", step.ID)
+		}
+		if len([]rune(step.Title)) > maxFormTextLen {
+			return fmt.Errorf("step %q title must be at most %d characters", step.ID, maxFormTextLen)
+		}
+	}
+
+	// 显示条件只能引用之前声明的字段，保证页面脚本和服务端按声明顺序一次即可算出可见性
+	declared := make(map[string]*FormField)
+	count := 0
+	for _, step := range c.StepList() {
+		for i := range step.Fields {
+			field := &step.Fields[i]
+			if err := field.validate(declared); err != nil {
+				return err
+			}
+			declared[field.Name] = field
+			count++
+		}
+	}
+	if count > maxFormFields {
+		return fmt.Errorf("at most %d fields are allowed", maxFormFields)
+	}
+	return nil
+}
+
+// ValidFieldName 字段名是否有效：以字母开头，由字母、数字、_ 和 - 组成，最长64个字符
+func ValidFieldName(name string) bool {
+	return formNamePattern.MatchString(name)
+}
+
+// validate 校验字段，declared 为之前声明的字段
+func (f *FormField) validate(declared map[string]*FormField) error {
+	if !formNamePattern.MatchString(f.Name) {
+		return fmt.Errorf("invalid field name %q, expected letters, digits, _ or - starting with a letter", f.Name)
+	}
+	if declared[f.Name] != nil {
+		return fmt.Errorf("duplicate field name %q", f.Name)
+	}
+	if !containsFold(FieldTypes, f.Type) {
+		return fmt.Errorf("field %q type must be one of %s", f.Name, strings.Join(FieldTypes, ", "))
+	}
+	if len([]rune(f.Label)) > maxFormTextLen || len([]rune(f.Placeholder)) > maxFormTextLen {
+		return fmt.Errorf("field %q label and placeholder must be at most %d characters", f.Name, maxFormTextLen)
+	}
+
+	switch f.Type {
+	case FieldSelect, FieldRadio:
+		if len(f.Options) == 0 {
+			return fmt.Errorf("field %q requires options", f.Name)
+		}
+		if len(f.Options) > maxFormOptions {
+			return fmt.Errorf("field %q allows at most %d options", f.Name, maxFormOptions)
+		}
+	default:
+		if len(f.Options) > 0 || len(f.OptionLabels) > 0 {
+			return fmt.Errorf("field %q does not support options", f.Name)
+		}
+	}
+	for value, label := range f.OptionLabels {
+		if !containsValue(f.Options, value) {
+			return fmt.Errorf("field %q option_labels references unknown option %q", f.Name, value)
+		}
+		if len([]rune(label)) > maxFormTextLen {
+			return fmt.Errorf("field %q option labels must be at most %d characters", f.Name, maxFormTextLen)
+		}
+	}
+
+	if f.Type == FieldFile {
+		if f.Validation != nil {
+			return fmt.Errorf("field %q does not support validation", f.Name)
+		}
+		if f.Sensitive {
+			return fmt.Errorf("file field %q cannot be sensitive", f.Name)
+		}
+		if f.MaxSize < 0 || f.MaxSize > MaxFileSize {
+			return fmt.Errorf("field %q max_size must be between 0 and %d bytes", f.Name, MaxFileSize)
+		}
+		if len(f.Accept) > maxFileAcceptTypes {
+			return fmt.Errorf("field %q allows at most %d accept types", f.Name, maxFileAcceptTypes)
+		}
+		for _, accept := range f.Accept {
+			if !mimeTypePattern.MatchString(accept) {
+				return fmt.Errorf("field %q has an invalid accept type %q, expected a MIME type such as image/png or image/*", f.Name, accept)
+			}
+		}
+	} else if len(f.Accept) > 0 || f.MaxSize != 0 {
+		return fmt.Errorf("field %q does not support accept and max_size", f.Name)
+	}
+
+	if v := f.Validation; v != nil {
+		if v.MinLength < 0 || v.MaxLength < 0 || v.MaxLength > maxFormValueLen {
+			return fmt.Errorf("field %q length limits must be between 0 and %d", f.Name, maxFormValueLen)
+		}
+		if v.MaxLength > 0 && v.MinLength > v.MaxLength {
+			return fmt.Errorf("field %q min_length cannot be greater than max_length", f.Name)
+		}
+		if v.Pattern != "" {
+			if len(v.Pattern) > maxFormPatternLen {
+				return fmt.Errorf("field %q pattern must be at most %d characters", f.Name, maxFormPatternLen)
+			}
+			if _, err := regexp.Compile(v.Pattern); err != nil {
+				return fmt.Errorf("field %q has an invalid pattern: %w", f.Name, err)
+			}
+		}
+		if len([]rune(v.Message)) > maxFormTextLen {
+			return fmt.Errorf("field %q validation message must be at most %d characters", f.Name, maxFormTextLen)
+		}
+	}
+
+	if cond := f.ShowIf; cond != nil {
+		if cond.Field == f.Name {
+			return fmt.Errorf("field %q show_if cannot reference itself", f.Name)
+		}
+		if declared[cond.Field] == nil {
+			return fmt.Errorf("field %q show_if must reference a field declared before it", f.Name)
+		}
+		switch cond.Operator {
+		case ConditionEquals, ConditionNotEquals, ConditionNotEmpty, ConditionEmpty:
+		case ConditionIn, ConditionNotIn:
+			if len(cond.Values) == 0 {
+				return fmt.Errorf("field %q show_if operator %s requires values", f.Name, cond.Operator)
+			}
+			if len(cond.Values) > maxConditionValues {
+				return fmt.Errorf("field %q show_if allows at most %d values", f.Name, maxConditionValues)
+			}
+		default:
+			return fmt.Errorf("field %q show_if operator must be one of eq, neq, in, not_in, not_empty, empty", f.Name)
+		}
+	}
+	return nil
+}
+
+// IsZero 判断是否未配置表单字段，页面使用弹窗内容中自带的表单
+func (c *FormConfig) IsZero() bool {
+	return len(c.Fields) == 0 && len(c.Steps) == 0
+}
+
+// Marshal 序列化为存储使用的JSON
+func (c *FormConfig) Marshal() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal form config: %w", err)
+	}
+	return string(data), nil
+}
+
+// StepList 返回表单的步骤，单页表单视为只有一个步骤
+func (c *FormConfig) StepList() []FormStep {
+	if len(c.Steps) > 0 {
+		return c.Steps
+	}
+	if len(c.Fields) > 0 {
+		return []FormStep{{ID: defaultFormStepName + "1", Fields: c.Fields}}
+	}
+	return nil
+}
+
+// StepIndex 返回步骤的序号，单页表单和未配置字段的表单步骤ID可以为空，不存在时返回 -1
+func (c *FormConfig) StepIndex(id string) int {
+	steps := c.StepList()
+	if id == "" && len(steps) <= 1 {
+		return 0
+	}
+	for i, step := range steps {
+		if step.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// ApplyStep 将一个步骤提交的值合并到表单数据中
+//
+// 步骤中未提交的字段会被清除，隐藏字段的值不会保存。未配置字段时接受任意字段名的简单值。
+// 返回错误时 data 可能已被部分修改
+func (c *FormConfig) ApplyStep(index int, data, values map[string]interface{}) error {
+	if c.IsZero() {
+		return applyFreeFormValues(data, values)
+	}
+	steps := c.StepList()
+	if index < 0 || index >= len(steps) {
+		return fmt.Errorf("invalid step")
+	}
+
+	step := steps[index]
+	for i := range step.Fields {
+		field := &step.Fields[i]
+		value, err := field.normalizeValue(values[field.Name])
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			delete(data, field.Name)
+		} else {
+			data[field.Name] = value
+		}
+	}
+
+	visible := c.prune(data)
+	for i := range step.Fields {
+		field := &step.Fields[i]
+		if visible[field.Name] && field.Required && data[field.Name] == nil {
+			return fmt.Errorf("%s is required", field.displayName())
+		}
+	}
+	return nil
+}
+
+// Complete 清除隐藏字段和未声明的字段，并校验所有可见的必填字段都已填写，用于提交最后一步时
+func (c *FormConfig) Complete(data map[string]interface{}) error {
+	if c.IsZero() {
+		return nil
+	}
+	visible := c.prune(data)
+	for _, step := range c.StepList() {
+		for i := range step.Fields {
+			field := &step.Fields[i]
+			if visible[field.Name] && field.Required && data[field.Name] == nil {
+				return fmt.Errorf("%s is required", field.displayName())
+			}
+		}
+	}
+	return nil
+}
+
+// prune 按声明顺序计算字段的可见性，删除隐藏字段和未声明字段的值，返回可见字段
+func (c *FormConfig) prune(data map[string]interface{}) map[string]bool {
+	visible := make(map[string]bool)
+	for _, step := range c.StepList() {
+		for i := range step.Fields {
+			field := &step.Fields[i]
+			if field.ShowIf == nil || field.ShowIf.matches(data) {
+				visible[field.Name] = true
+			} else {
+				delete(data, field.Name)
+			}
+		}
+	}
+	for name := range data {
+		if !visible[name] {
+			delete(data, name)
+		}
+	}
+	return visible
+}
+
+// applyFreeFormValues 合并弹窗内容中自带表单提交的值，只接受字符串、数字和布尔值
+func applyFreeFormValues(data, values map[string]interface{}) error {
+	for name, raw := range values {
+		if !formNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid field name %q", name)
+		}
+		switch v := raw.(type) {
+		case nil:
+			delete(data, name)
+		case string:
+			if len([]rune(v)) > maxFormValueLen {
+				return fmt.Errorf("%s must be at most %d characters", name, maxFormValueLen)
+			}
+			data[name] = v
+		case float64, bool:
+			data[name] = v
+		default:
+			return fmt.Errorf("%s must be a string, number or boolean", name)
+		}
+	}
+	if len(data) > maxFormFields {
+		return fmt.Errorf("at most %d fields are allowed", maxFormFields)
+	}
+	return nil
+}
+
+// matches 判断表单数据是否满足显示条件
+func (cond *FieldCondition) matches(data map[string]interface{}) bool {
+	value := conditionValue(data[cond.Field])
+	switch cond.Operator {
+	case ConditionEquals:
+		return value == cond.Value
+	case ConditionNotEquals:
+		return value != cond.Value
+	case ConditionIn:
+		return containsValue(cond.Values, value)
+	case ConditionNotIn:
+		return !containsValue(cond.Values, value)
+	case ConditionNotEmpty:
+		return value != ""
+	case ConditionEmpty:
+		return value == ""
+	}
+	return false
+}
+
+// normalizeValue 校验并规范化字段值，未填写时返回nil
+func (f *FormField) normalizeValue(raw interface{}) (interface{}, error) {
+	if f.Type == FieldFile {
+		return f.normalizeFileValue(raw)
+	}
+	if f.Type == FieldCheckbox {
+		switch v := raw.(type) {
+		case nil:
+			return nil, nil
+		case bool:
+			if !v {
+				return nil, nil
+			}
+			return true, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "", "false", "0", "off":
+				return nil, nil
+			case "true", "1", "on":
+				return true, nil
+			}
+		}
+		return nil, fmt.Errorf("%s must be a boolean", f.displayName())
+	}
+
+	var value string
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		value = strings.TrimSpace(v)
+	case float64:
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return nil, fmt.Errorf("%s must be a string", f.displayName())
+	}
+	if value == "" {
+		return nil, nil
+	}
+	if len([]rune(value)) > maxFormValueLen {
+		return nil, fmt.Errorf("%s must be at most %d characters", f.displayName(), maxFormValueLen)
+	}
+
+	switch f.Type {
+	case FieldNumber:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", f.displayName())
+		}
+		return number, nil
+	case FieldEmail:
+		if !formEmailPattern.MatchString(value) {
+			return nil, fmt.Errorf("%s must be a valid email address", f.displayName())
+		}
+	case FieldSelect, FieldRadio:
+		if !containsValue(f.Options, value) {
+			return nil, fmt.Errorf("%s must be one of the options", f.displayName())
+		}
+		return value, nil
+	}
+
+	if v := f.Validation; v != nil {
+		length := len([]rune(value))
+		if (v.MinLength > 0 && length < v.MinLength) || (v.MaxLength > 0 && length > v.MaxLength) {
+			return nil, f.validationError(fmt.Sprintf("%s length is out of range", f.displayName()))
+		}
+		if v.Pattern != "" {
+			if pattern, err := regexp.Compile(`^(?:` + v.Pattern + `)$`); err == nil && !pattern.MatchString(value) {
+				return nil, f.validationError(fmt.Sprintf("%s has an invalid format", f.displayName()))
+			}
+		}
+	}
+	return value, nil
+}
+
+// normalizeFileValue 文件字段提交上传接口返回的文件ID，保存为只包含文件ID的对象，由调用方校验文件并补充文件信息
+func (f *FormField) normalizeFileValue(raw interface{}) (interface{}, error) {
+	var id string
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		id = strings.TrimSpace(v)
+		if id == "" {
+			return nil, nil
+		}
+	case map[string]interface{}:
+		id, _ = v[FileIDKey].(string)
+	}
+	id = strings.ToLower(id)
+	if !fileIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("%s must be an uploaded file", f.displayName())
+	}
+	return map[string]interface{}{FileIDKey: id}, nil
+}
+
+// FileMaxSize 返回文件字段的最大字节数
+func (f *FormField) FileMaxSize() int64 {
+	if f.MaxSize > 0 {
+		return f.MaxSize
+	}
+	return DefaultFileMaxSize
+}
+
+// AcceptsType 判断文件字段是否接受该MIME类型，Accept 为空时接受所有类型
+func (f *FormField) AcceptsType(contentType string) bool {
+	if len(f.Accept) == 0 {
+		return true
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+	for _, accept := range f.Accept {
+		if accept == contentType || (strings.HasSuffix(accept, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(accept, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindField 按字段名查找字段，不存在时返回nil
+func (c *FormConfig) FindField(name string) *FormField {
+	for _, step := range c.StepList() {
+		for i := range step.Fields {
+			if step.Fields[i].Name == name {
+				return &step.Fields[i]
+			}
+		}
+	}
+	return nil
+}
+
+// SensitiveFields 返回所有敏感字段的字段名
+func (c *FormConfig) SensitiveFields() []string {
+	var names []string
+	for _, step := range c.StepList() {
+		for _, field := range step.Fields {
+			if field.Sensitive {
+				names = append(names, field.Name)
+			}
+		}
+	}
+	return names
+}
+
+// FileID 返回文件字段值中的文件ID，不是文件值时返回空字符串
+func FileID(value interface{}) string {
+	if v, ok := value.(map[string]interface{}); ok {
+		id, _ := v[FileIDKey].(string)
+		return id
+	}
+	return ""
+}
+
+// validationError 优先使用配置的校验提示
+func (f *FormField) validationError(fallback string) error {
+	if f.Validation != nil && f.Validation.Message != "" {
+		return fmt.Errorf("%s", f.Validation.Message)
+	}
+	return fmt.Errorf("%s", fallback)
+}
+
+// displayName 错误提示中使用的字段名称
+func (f *FormField) displayName() string {
+	if f.Label != "" {
+		return f.Label
+	}
+	return f.Name
+}
+
+// conditionValue 返回显示条件比较使用的字符串，与页面脚本的取值方式一致
+func conditionValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// containsValue 判断列表中是否包含值，区分大小写
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validSubmitURL 判断提交地址是否为 http(s) URL 或以 / 开头的路径
+func validSubmitURL(raw string) bool {
+	if strings.HasPrefix(raw, "/") {
+		return !strings.HasPrefix(raw, "//")
+	}
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,98 @@
+package popupspec
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// 语言选择
+//
+// 注入弹窗时按 URL 路径前缀、语言Cookie、Accept-Language 的顺序选择第一个有翻译的语言，
+// 都没有时使用弹窗的原文
+const (
+	LocaleCookieName   = "pe_lang" // 访客选择的语言，由被代理站点的语言切换写入
+	maxLocaleLen       = 20
+	maxAcceptLanguages = 10
+)
+
+// localePathPattern 可以作为语言前缀的路径段，如 /en/、/zh-CN/，避免把普通路径误认为语言
+var localePathPattern = regexp.MustCompile(`^[a-zA-Z]{2}([-_][a-zA-Z]{2})?$`)
+
+// mulTag Accept-Language 中通配符 * 对应的语言标签
+var mulTag = language.Make("mul")
+
+// NormalizeLocale 规范化语言标签，如 zh_cn 规范化为 zh-CN
+func NormalizeLocale(raw string) (string, error) {
+	raw = strings.ReplaceAll(strings.TrimSpace(raw), "_", "-")
+	if raw == "" || len(raw) > maxLocaleLen {
+		return "", fmt.Errorf("invalid locale %q", raw)
+	}
+	tag, err := language.Parse(raw)
+	if err != nil || tag == language.Und {
+		return "", fmt.Errorf("invalid locale %q", raw)
+	}
+	return tag.String(), nil
+}
+
+// RequestLocales 按优先级返回请求的候选语言：URL路径前缀、语言Cookie、Accept-Language（按权重排序）
+func RequestLocales(r *http.Request) []string {
+	var locales []string
+	add := func(raw string) {
+		if locale, err := NormalizeLocale(raw); err == nil && !containsFold(locales, locale) {
+			locales = append(locales, locale)
+		}
+	}
+
+	if segment, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/"); localePathPattern.MatchString(segment) {
+		add(segment)
+	}
+	if cookie, err := r.Cookie(LocaleCookieName); err == nil {
+		add(cookie.Value)
+	}
+	if header := r.Header.Get("Accept-Language"); header != "" {
+		if tags, _, err := language.ParseAcceptLanguage(header); err == nil {
+			for i, tag := range tags {
+				if i >= maxAcceptLanguages {
+					break
+				}
+				// 通配符 * 解析为 mul，不对应具体语言
+				if tag != mulTag {
+					add(tag.String())
+				}
+			}
+		}
+	}
+	return locales
+}
+
+// MatchLocale 返回候选语言中第一个可用的语言，没有时返回空字符串
+//
+// 先按候选顺序匹配完整标签或基础语言（zh-TW 可以使用 zh），都不匹配时再接受同一基础语言的其他地区（zh 可以使用 zh-CN）
+func MatchLocale(candidates, available []string) string {
+	for _, candidate := range candidates {
+		for _, locale := range available {
+			if strings.EqualFold(locale, candidate) || strings.EqualFold(locale, baseLanguage(candidate)) {
+				return locale
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		base := baseLanguage(candidate)
+		for _, locale := range available {
+			if strings.EqualFold(baseLanguage(locale), base) {
+				return locale
+			}
+		}
+	}
+	return ""
+}
+
+// baseLanguage 返回语言标签的基础语言，如 zh-CN 返回 zh
+func baseLanguage(locale string) string {
+	base, _, _ := strings.Cut(locale, "-")
+	return strings.ToLower(base)
+}
@@ -0,0 +1,67 @@
+package popupspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 提交数据过期后的处理方式
+const (
+	RetentionInherit   = ""          // 使用全局配置
+	RetentionDelete    = "delete"    // 硬删除
+	RetentionAnonymize = "anonymize" // 保留记录用于统计，清除表单数据和访客信息
+)
+
+// 保留天数限制
+const maxRetentionDays = 3650
+
+// Retention 弹窗提交数据的保留策略，覆盖全局配置中的 submissions 设置
+type Retention struct {
+	Days    int    `json:"days,omitempty"`    // 保留天数，为0时使用全局配置
+	Mode    string `json:"mode,omitempty"`    // delete 或 anonymize，为空时使用全局配置
+	Forever bool   `json:"forever,omitempty"` // 永久保留，不清理该弹窗的提交
+}
+
+// ParseRetention 解析保留策略JSON，为空时返回空策略
+func ParseRetention(raw string) (*Retention, error) {
+	retention := &Retention{}
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "null" {
+		return retention, nil
+	}
+	if err := json.Unmarshal([]byte(raw), retention); err != nil {
+		return nil, fmt.Errorf("invalid retention: %w", err)
+	}
+	return retention, nil
+}
+
+// Validate 校验保留策略
+func (r *Retention) Validate() error {
+	if r.Days < 0 || r.Days > maxRetentionDays {
+		return fmt.Errorf("retention days must be between 0 and %d", maxRetentionDays)
+	}
+	switch r.Mode {
+	case RetentionInherit, RetentionDelete, RetentionAnonymize:
+	default:
+		return fmt.Errorf("invalid retention mode: %s", r.Mode)
+	}
+	if r.Forever && r.Days > 0 {
+		return fmt.Errorf("retention days cannot be set when keeping submissions forever")
+	}
+	return nil
+}
+
+// IsZero 判断是否使用全局配置
+func (r *Retention) IsZero() bool {
+	return r.Days == 0 && r.Mode == RetentionInherit && !r.Forever
+}
+
+// Marshal 序列化保留策略，用于存储
+func (r *Retention) Marshal() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal retention: %w", err)
+	}
+	return string(data), nil
+}
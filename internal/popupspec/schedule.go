@@ -0,0 +1,211 @@
+package popupspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 排期状态
+const (
+	ScheduleNone     = ""          // 未设置排期
+	SchedulePending  = "pending"   // 未到开始时间
+	ScheduleActive   = "active"    // 在投放时间内
+	ScheduleOffHours = "off_hours" // 在开始和结束时间之间，但不在每周投放时段内
+	ScheduleExpired  = "expired"   // 已过结束时间
+)
+
+// 排期限制
+const maxWeeklySlots = 50
+
+// weekdays 星期缩写，与 time.Weekday 顺序一致
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Schedule 弹窗排期，开始、结束时间为绝对时间，每周投放时段按 Timezone 的本地时间计算
+type Schedule struct {
+	StartAt  *time.Time   `json:"start_at,omitempty"` // 为空时立即开始
+	EndAt    *time.Time   `json:"end_at,omitempty"`   // 为空时不结束
+	Timezone string       `json:"timezone,omitempty"` // IANA时区，如 Asia/Shanghai，为空时使用UTC
+	Weekly   []WeeklySlot `json:"weekly,omitempty"`   // 每周投放时段，为空时全天投放
+}
+
+// WeeklySlot 每周投放时段，End 不大于 Start 时表示跨越午夜到次日
+type WeeklySlot struct {
+	Days  []string `json:"days"`  // 时段开始的星期：mon..sun
+	Start string   `json:"start"` // 开始时间 HH:MM
+	End   string   `json:"end"`   // 结束时间 HH:MM，可以为 24:00
+}
+
+// NewSchedule 根据弹窗的排期字段创建排期，weeklyJSON 为 WeeklySlot 数组
+func NewSchedule(startAt, endAt *time.Time, timezone, weeklyJSON string) (*Schedule, error) {
+	schedule := &Schedule{StartAt: startAt, EndAt: endAt, Timezone: timezone}
+	if raw := strings.TrimSpace(weeklyJSON); raw != "" && raw != "null" {
+		if err := json.Unmarshal([]byte(raw), &schedule.Weekly); err != nil {
+			return nil, fmt.Errorf("invalid weekly schedule: %w", err)
+		}
+	}
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// Validate 校验排期
+func (s *Schedule) Validate() error {
+	if _, err := s.location(); err != nil {
+		return err
+	}
+	if s.StartAt != nil && s.EndAt != nil && !s.EndAt.After(*s.StartAt) {
+		return fmt.Errorf("end_at must be after start_at")
+	}
+	if len(s.Weekly) > maxWeeklySlots {
+		return fmt.Errorf("at most %d weekly slots are allowed", maxWeeklySlots)
+	}
+	for i, slot := range s.Weekly {
+		if err := slot.validate(); err != nil {
+			return fmt.Errorf("weekly[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// IsZero 判断是否未设置排期
+func (s *Schedule) IsZero() bool {
+	return s.StartAt == nil && s.EndAt == nil && len(s.Weekly) == 0
+}
+
+// WeeklyJSON 序列化每周投放时段，用于存储
+func (s *Schedule) WeeklyJSON() (string, error) {
+	weekly := s.Weekly
+	if weekly == nil {
+		weekly = []WeeklySlot{}
+	}
+	data, err := json.Marshal(weekly)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal weekly schedule: %w", err)
+	}
+	return string(data), nil
+}
+
+// Status 返回指定时间的排期状态
+func (s *Schedule) Status(now time.Time) string {
+	if s.IsZero() {
+		return ScheduleNone
+	}
+	if s.StartAt != nil && now.Before(*s.StartAt) {
+		return SchedulePending
+	}
+	if s.EndAt != nil && !now.Before(*s.EndAt) {
+		return ScheduleExpired
+	}
+	if len(s.Weekly) > 0 && !s.inWeeklySlot(now) {
+		return ScheduleOffHours
+	}
+	return ScheduleActive
+}
+
+// ActiveAt 判断指定时间是否在投放时间内，未设置排期时始终投放
+func (s *Schedule) ActiveAt(now time.Time) bool {
+	status := s.Status(now)
+	return status == ScheduleNone || status == ScheduleActive
+}
+
+// inWeeklySlot 判断时间是否落在任一每周投放时段内
+func (s *Schedule) inWeeklySlot(now time.Time) bool {
+	location, err := s.location()
+	if err != nil {
+		return false
+	}
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	today := weekdays[local.Weekday()]
+	yesterday := weekdays[(local.Weekday()+6)%7]
+
+	for _, slot := range s.Weekly {
+		start, _ := parseClock(slot.Start)
+		end, _ := parseClock(slot.End)
+		if end > start {
+			if slot.hasDay(today) && minute >= start && minute < end {
+				return true
+			}
+			continue
+		}
+		// 跨越午夜：开始当天的剩余时间和次日的开头部分
+		if slot.hasDay(today) && minute >= start {
+			return true
+		}
+		if slot.hasDay(yesterday) && minute < end {
+			return true
+		}
+	}
+	return false
+}
+
+// location 返回排期使用的时区
+func (s *Schedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+	return location, nil
+}
+
+// validate 校验每周投放时段
+func (w WeeklySlot) validate() error {
+	if len(w.Days) == 0 {
+		return fmt.Errorf("days is required")
+	}
+	for _, day := range w.Days {
+		if !w.knownDay(day) {
+			return fmt.Errorf("invalid day %q, expected one of %s", day, strings.Join(weekdays, ", "))
+		}
+	}
+	start, err := parseClock(w.Start)
+	if err != nil || start == 24*60 {
+		return fmt.Errorf("invalid start time %q, expected HH:MM", w.Start)
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return fmt.Errorf("invalid end time %q, expected HH:MM", w.End)
+	}
+	if start == end {
+		return fmt.Errorf("start and end time must differ")
+	}
+	return nil
+}
+
+// knownDay 判断是否为有效的星期缩写
+func (w WeeklySlot) knownDay(day string) bool {
+	for _, d := range weekdays {
+		if strings.EqualFold(d, day) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDay 判断时段是否包含指定星期
+func (w WeeklySlot) hasDay(day string) bool {
+	for _, d := range w.Days {
+		if strings.EqualFold(d, day) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock 解析 HH:MM 为当天的分钟数，允许 24:00
+func parseClock(value string) (int, error) {
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,296 @@
+package popupspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 弹窗位置
+const (
+	PositionCenter      = "center"
+	PositionTop         = "top"
+	PositionBottom      = "bottom"
+	PositionLeft        = "left"
+	PositionRight       = "right"
+	PositionTopLeft     = "top-left"
+	PositionTopRight    = "top-right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottomRight = "bottom-right"
+)
+
+// Positions 支持的弹窗位置
+var Positions = []string{
+	PositionCenter,
+	PositionTop,
+	PositionBottom,
+	PositionLeft,
+	PositionRight,
+	PositionTopLeft,
+	PositionTopRight,
+	PositionBottomLeft,
+	PositionBottomRight,
+}
+
+// 弹窗动画
+const (
+	AnimationFade  = "fade"
+	AnimationSlide = "slide"
+	AnimationZoom  = "zoom"
+	AnimationNone  = "none"
+)
+
+// 移动端布局
+const (
+	MobileLayoutDefault     = ""             // 与桌面端相同，宽度不超过屏幕
+	MobileLayoutFullscreen  = "fullscreen"   // 全屏展示
+	MobileLayoutBottomSheet = "bottom_sheet" // 贴底展示
+)
+
+// 样式默认值
+const (
+	defaultPopupWidth       = "480px"
+	defaultBackgroundColor  = "#ffffff"
+	defaultTextColor        = "#1f2937"
+	defaultAccentColor      = "#2563eb"
+	defaultOverlayColor     = "rgba(0, 0, 0, 0.5)"
+	defaultFontFamily       = "-apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif"
+	defaultFontSize         = "15px"
+	defaultBorderRadius     = "8px"
+	defaultMobileBreakpoint = 640
+	minMobileBreakpoint     = 240
+	maxMobileBreakpoint     = 1440
+	maxFontFamilyLen        = 200
+)
+
+// 样式值格式，只允许不会跳出声明的字符，编译后的CSS可以直接写入 <style>
+var (
+	cssLengthPattern = regexp.MustCompile(`^\d+(\.\d+)?(px|%|vw|vh|rem|em)$`)
+	cssColorPattern  = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|(rgb|rgba|hsl|hsla)\([0-9.,%\s/]+\)|[a-zA-Z]+)$`)
+	cssFontPattern   = regexp.MustCompile(`^[\w\s,'"-]+$`)
+)
+
+// StyleConfig 弹窗样式配置，存储于 Popup.StyleConfig 和 PopupVariant.StyleConfig
+//
+// 弹窗渲染在 Shadow DOM 中，样式配置编译为只作用于该弹窗的CSS，
+// 页面样式不会影响弹窗，弹窗样式也不会影响页面。零值使用默认样式
+type StyleConfig struct {
+	Position    string      `json:"position,omitempty"`     // 弹窗位置，见 Positions，默认 center
+	Width       string      `json:"width,omitempty"`        // 弹窗宽度，如 480px、90%，不超过屏幕宽度
+	HideOverlay bool        `json:"hide_overlay,omitempty"` // 不显示遮罩层，访客可以继续操作页面
+	Colors      StyleColors `json:"colors"`
+	Font        StyleFont   `json:"font"`
+	Radius      string      `json:"radius,omitempty"`    // 圆角，如 8px
+	Animation   string      `json:"animation,omitempty"` // 展示动画：fade、slide、zoom、none，默认 fade
+	Mobile      MobileStyle `json:"mobile"`
+}
+
+// StyleColors 弹窗颜色，支持 #hex、rgb()、rgba()、hsl()、hsla() 和颜色名称
+type StyleColors struct {
+	Background string `json:"background,omitempty"` // 背景色
+	Text       string `json:"text,omitempty"`       // 文字颜色
+	Accent     string `json:"accent,omitempty"`     // 按钮和链接颜色
+	Overlay    string `json:"overlay,omitempty"`    // 遮罩层颜色
+}
+
+// StyleFont 弹窗字体
+type StyleFont struct {
+	Family string `json:"family,omitempty"` // 字体，如 'Noto Sans SC', sans-serif
+	Size   string `json:"size,omitempty"`   // 字号，如 15px
+}
+
+// MobileStyle 移动端样式，屏幕宽度不超过 Breakpoint 时生效
+type MobileStyle struct {
+	Layout     string `json:"layout,omitempty"`     // 移动端布局：fullscreen、bottom_sheet，为空时与桌面端相同
+	Breakpoint int    `json:"breakpoint,omitempty"` // 移动端断点（像素），默认 640
+}
+
+// ParseStyleConfig 解析并规范化样式配置JSON，空值返回零值配置
+func ParseStyleConfig(raw string) (*StyleConfig, error) {
+	style := &StyleConfig{}
+	if strings.TrimSpace(raw) == "" {
+		return style, nil
+	}
+	if err := json.Unmarshal([]byte(raw), style); err != nil {
+		return nil, fmt.Errorf("invalid style config: %w", err)
+	}
+	style.Normalize()
+	if err := style.Validate(); err != nil {
+		return nil, err
+	}
+	return style, nil
+}
+
+// Normalize 去除样式值两端的空白，统一枚举值的大小写
+func (s *StyleConfig) Normalize() {
+	s.Position = strings.ToLower(strings.TrimSpace(s.Position))
+	s.Width = strings.TrimSpace(s.Width)
+	s.Colors.Background = strings.TrimSpace(s.Colors.Background)
+	s.Colors.Text = strings.TrimSpace(s.Colors.Text)
+	s.Colors.Accent = strings.TrimSpace(s.Colors.Accent)
+	s.Colors.Overlay = strings.TrimSpace(s.Colors.Overlay)
+	s.Font.Family = strings.TrimSpace(s.Font.Family)
+	s.Font.Size = strings.TrimSpace(s.Font.Size)
+	s.Radius = strings.TrimSpace(s.Radius)
+	s.Animation = strings.ToLower(strings.TrimSpace(s.Animation))
+	s.Mobile.Layout = strings.ToLower(strings.TrimSpace(s.Mobile.Layout))
+}
+
+// Validate 校验样式配置
+func (s *StyleConfig) Validate() error {
+	if s.Position != "" && !containsFold(Positions, s.Position) {
+		return fmt.Errorf("position must be one of %s", strings.Join(Positions, ", "))
+	}
+	lengths := []struct{ name, value string }{
+		{"width", s.Width},
+		{"font.size", s.Font.Size},
+		{"radius", s.Radius},
+	}
+	for _, length := range lengths {
+		if length.value != "" && !cssLengthPattern.MatchString(length.value) {
+			return fmt.Errorf("%s must be a CSS length such as 480px, 90%% or 1.5rem", length.name)
+		}
+	}
+	colors := []struct{ name, value string }{
+		{"colors.background", s.Colors.Background},
+		{"colors.text", s.Colors.Text},
+		{"colors.accent", s.Colors.Accent},
+		{"colors.overlay", s.Colors.Overlay},
+	}
+	for _, color := range colors {
+		if color.value != "" && !cssColorPattern.MatchString(color.value) {
+			return fmt.Errorf("%s must be a CSS color such as #2563eb or rgba(0, 0, 0, 0.5)", color.name)
+		}
+	}
+	if s.Font.Family != "" && (len(s.Font.Family) > maxFontFamilyLen || !cssFontPattern.MatchString(s.Font.Family)) {
+		return fmt.Errorf("font.family must be a list of font names")
+	}
+	switch s.Animation {
+	case "", AnimationFade, AnimationSlide, AnimationZoom, AnimationNone:
+	default:
+		return fmt.Errorf("animation must be one of %s, %s, %s, %s", AnimationFade, AnimationSlide, AnimationZoom, AnimationNone)
+	}
+	switch s.Mobile.Layout {
+	case MobileLayoutDefault, MobileLayoutFullscreen, MobileLayoutBottomSheet:
+	default:
+		return fmt.Errorf("mobile.layout must be one of %s, %s", MobileLayoutFullscreen, MobileLayoutBottomSheet)
+	}
+	if s.Mobile.Breakpoint != 0 && (s.Mobile.Breakpoint < minMobileBreakpoint || s.Mobile.Breakpoint > maxMobileBreakpoint) {
+		return fmt.Errorf("mobile.breakpoint must be between %d and %d", minMobileBreakpoint, maxMobileBreakpoint)
+	}
+	return nil
+}
+
+// IsZero 判断是否未设置任何样式
+func (s *StyleConfig) IsZero() bool {
+	return *s == StyleConfig{}
+}
+
+// Marshal 序列化为存储使用的JSON
+func (s *StyleConfig) Marshal() (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal style config: %w", err)
+	}
+	return string(data), nil
+}
+
+// CSS 编译为弹窗 Shadow DOM 内使用的CSS
+//
+// Shadow DOM 内的结构为 .pe-overlay（可选）和 .pe-popup > .pe-close + .pe-content，
+// :host 重置继承的页面样式
+func (s *StyleConfig) CSS() string {
+	position := orDefault(strings.ToLower(s.Position), PositionCenter)
+	animation := orDefault(s.Animation, AnimationFade)
+	radius := orDefault(s.Radius, defaultBorderRadius)
+	accent := orDefault(s.Colors.Accent, defaultAccentColor)
+
+	var b strings.Builder
+	b.WriteString(":host { all: initial; }\n")
+	b.WriteString(".pe-overlay { position: fixed; inset: 0; pointer-events: auto; background: " + orDefault(s.Colors.Overlay, defaultOverlayColor) + "; }\n")
+	b.WriteString(".pe-popup { position: fixed; box-sizing: border-box; pointer-events: auto;" +
+		" width: " + orDefault(s.Width, defaultPopupWidth) + "; max-width: calc(100vw - 32px); max-height: calc(100vh - 32px); overflow: auto;" +
+		" padding: 24px; border-radius: " + radius + "; box-shadow: 0 10px 40px rgba(0, 0, 0, 0.25);" +
+		" background: " + orDefault(s.Colors.Background, defaultBackgroundColor) + "; color: " + orDefault(s.Colors.Text, defaultTextColor) + ";" +
+		" font-family: " + orDefault(s.Font.Family, defaultFontFamily) + "; font-size: " + orDefault(s.Font.Size, defaultFontSize) + "; line-height: 1.5;" +
+		" " + positionCSS(position) + " }\n")
+	b.WriteString(".pe-close { position: absolute; top: 8px; right: 12px; padding: 0; border: 0; background: none; color: inherit; font: inherit; font-size: 22px; line-height: 1; cursor: pointer; opacity: 0.6; }\n")
+	b.WriteString(".pe-close:hover { opacity: 1; }\n")
+	b.WriteString(".pe-content a { color: " + accent + "; }\n")
+	b.WriteString(".pe-content button, .pe-content input[type=submit] { padding: 8px 16px; border: 0; border-radius: 4px; background: " + accent + "; color: #ffffff; font: inherit; cursor: pointer; }\n")
+	b.WriteString(".pe-content input:not([type=submit]):not([type=checkbox]):not([type=radio]), .pe-content textarea, .pe-content select {" +
+		" box-sizing: border-box; width: 100%; margin: 4px 0 12px; padding: 8px; border: 1px solid #d1d5db; border-radius: 4px; background: #ffffff; color: #111827; font: inherit; }\n")
+
+	// 表单配置渲染的表单，见 FormConfig
+	b.WriteString(".pe-form [hidden] { display: none !important; }\n")
+	b.WriteString(".pe-progress { display: flex; align-items: center; gap: 8px; margin-bottom: 16px; font-size: 0.85em; }\n")
+	b.WriteString(".pe-progress-bar { flex: 1; height: 4px; border-radius: 2px; background: rgba(127, 127, 127, 0.25); overflow: hidden; }\n")
+	b.WriteString(".pe-progress-fill { display: block; width: 0; height: 100%; background: " + accent + "; transition: width 0.2s; }\n")
+	b.WriteString(".pe-step { min-width: 0; margin: 0; padding: 0; border: 0; }\n")
+	b.WriteString(".pe-step-title { padding: 0; margin-bottom: 12px; font-weight: 600; }\n")
+	b.WriteString(".pe-field > label, .pe-label { display: block; font-weight: 500; }\n")
+	b.WriteString(".pe-choice { display: flex; align-items: center; gap: 8px; margin: 4px 0 12px; }\n")
+	b.WriteString(".pe-form-error { margin: 0 0 12px; color: #dc2626; }\n")
+	b.WriteString(".pe-form-actions { display: flex; justify-content: flex-end; gap: 8px; }\n")
+	b.WriteString(".pe-content .pe-back { background: none; color: inherit; box-shadow: inset 0 0 0 1px currentColor; }\n")
+	b.WriteString(".pe-hp { position: absolute; left: -10000px; width: 1px; height: 1px; overflow: hidden; }\n")
+	b.WriteString(".pe-captcha-row { display: flex; align-items: center; gap: 8px; }\n")
+	b.WriteString(".pe-captcha-image { display: block; width: 150px; height: 50px; border-radius: 4px; }\n")
+	b.WriteString(".pe-content .pe-captcha-refresh { padding: 4px 8px; background: none; color: inherit; font-size: 18px; }\n")
+
+	if animation != AnimationNone {
+		b.WriteString(".pe-popup { animation: pe-" + animation + " 0.2s ease-out; }\n")
+		b.WriteString(".pe-overlay { animation: pe-fade 0.2s ease-out; }\n")
+		b.WriteString("@keyframes pe-fade { from { opacity: 0; } to { opacity: 1; } }\n")
+		b.WriteString("@keyframes pe-slide { from { opacity: 0; translate: 0 24px; } to { opacity: 1; translate: 0 0; } }\n")
+		b.WriteString("@keyframes pe-zoom { from { opacity: 0; scale: 0.9; } to { opacity: 1; scale: 1; } }\n")
+		b.WriteString("@media (prefers-reduced-motion: reduce) { .pe-popup, .pe-overlay { animation: none; } }\n")
+	}
+
+	breakpoint := s.Mobile.Breakpoint
+	if breakpoint == 0 {
+		breakpoint = defaultMobileBreakpoint
+	}
+	switch s.Mobile.Layout {
+	case MobileLayoutFullscreen:
+		b.WriteString("@media (max-width: " + strconv.Itoa(breakpoint) + "px) { .pe-popup { inset: 0; width: 100%; max-width: none; height: 100%; max-height: none; border-radius: 0; transform: none; } }\n")
+	case MobileLayoutBottomSheet:
+		b.WriteString("@media (max-width: " + strconv.Itoa(breakpoint) + "px) { .pe-popup { top: auto; right: 0; bottom: 0; left: 0; width: 100%; max-width: none; max-height: 85vh;" +
+			" border-radius: " + radius + " " + radius + " 0 0; transform: none; } }\n")
+	}
+
+	return b.String()
+}
+
+// positionCSS 返回弹窗位置的CSS声明
+func positionCSS(position string) string {
+	switch position {
+	case PositionTop:
+		return "top: 16px; left: 50%; transform: translateX(-50%);"
+	case PositionBottom:
+		return "bottom: 16px; left: 50%; transform: translateX(-50%);"
+	case PositionLeft:
+		return "top: 50%; left: 16px; transform: translateY(-50%);"
+	case PositionRight:
+		return "top: 50%; right: 16px; transform: translateY(-50%);"
+	case PositionTopLeft:
+		return "top: 16px; left: 16px;"
+	case PositionTopRight:
+		return "top: 16px; right: 16px;"
+	case PositionBottomLeft:
+		return "bottom: 16px; left: 16px;"
+	case PositionBottomRight:
+		return "bottom: 16px; right: 16px;"
+	}
+	return "top: 50%; left: 50%; transform: translate(-50%, -50%);"
+}
+
+// orDefault 值为空时返回默认值
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
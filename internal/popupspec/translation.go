@@ -0,0 +1,258 @@
+package popupspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FormTranslation 表单文字的翻译，存储于 PopupTranslation.FormTranslation，未翻译的文字使用原文
+//
+// 只翻译显示的文字，字段名和选项值保持不变，不同语言的提交数据可以直接合并统计
+type FormTranslation struct {
+	SubmitLabel    string                      `json:"submit_label,omitempty"`
+	NextLabel      string                      `json:"next_label,omitempty"`
+	BackLabel      string                      `json:"back_label,omitempty"`
+	SuccessMessage string                      `json:"success_message,omitempty"`
+	CaptchaLabel   string                      `json:"captcha_label,omitempty"`
+	Steps          map[string]string           `json:"steps,omitempty"`  // 步骤ID -> 步骤标题
+	Fields         map[string]FieldTranslation `json:"fields,omitempty"` // 字段名 -> 字段文字
+}
+
+// FieldTranslation 字段文字的翻译
+type FieldTranslation struct {
+	Label       string            `json:"label,omitempty"`
+	Placeholder string            `json:"placeholder,omitempty"`
+	Message     string            `json:"message,omitempty"` // 校验失败时的提示
+	Options     map[string]string `json:"options,omitempty"` // 选项值 -> 显示文字
+}
+
+// ParseFormTranslation 解析并校验表单翻译JSON，空值返回零值
+func ParseFormTranslation(raw string) (*FormTranslation, error) {
+	translation := &FormTranslation{}
+	if strings.TrimSpace(raw) == "" {
+		return translation, nil
+	}
+	if err := json.Unmarshal([]byte(raw), translation); err != nil {
+		return nil, fmt.Errorf("invalid form translation: %w", err)
+	}
+	translation.Normalize()
+	if err := translation.Validate(); err != nil {
+		return nil, err
+	}
+	return translation, nil
+}
+
+// Normalize 去除空白并删除空的翻译
+func (t *FormTranslation) Normalize() {
+	t.SubmitLabel = strings.TrimSpace(t.SubmitLabel)
+	t.NextLabel = strings.TrimSpace(t.NextLabel)
+	t.BackLabel = strings.TrimSpace(t.BackLabel)
+	t.SuccessMessage = strings.TrimSpace(t.SuccessMessage)
+	t.CaptchaLabel = strings.TrimSpace(t.CaptchaLabel)
+	for id, title := range t.Steps {
+		if title = strings.TrimSpace(title); title == "" {
+			delete(t.Steps, id)
+		} else {
+			t.Steps[id] = title
+		}
+	}
+	for name, field := range t.Fields {
+		field.Label = strings.TrimSpace(field.Label)
+		field.Placeholder = strings.TrimSpace(field.Placeholder)
+		field.Message = strings.TrimSpace(field.Message)
+		for value, label := range field.Options {
+			if label = strings.TrimSpace(label); label == "" {
+				delete(field.Options, value)
+			} else {
+				field.Options[value] = label
+			}
+		}
+		if field.Label == "" && field.Placeholder == "" && field.Message == "" && len(field.Options) == 0 {
+			delete(t.Fields, name)
+		} else {
+			t.Fields[name] = field
+		}
+	}
+}
+
+// Validate 校验翻译文字的长度
+func (t *FormTranslation) Validate() error {
+	for _, text := range []string{t.SubmitLabel, t.NextLabel, t.BackLabel, t.CaptchaLabel} {
+		if len([]rune(text)) > maxFormTextLen {
+			return fmt.Errorf("button and captcha labels must be at most %d characters", maxFormTextLen)
+		}
+	}
+	if len([]rune(t.SuccessMessage)) > maxFormMessageLen {
+		return fmt.Errorf("success_message must be at most %d characters", maxFormMessageLen)
+	}
+	if len(t.Steps) > maxFormSteps || len(t.Fields) > maxFormFields {
+		return fmt.Errorf("form translation has too many steps or fields")
+	}
+	for id, title := range t.Steps {
+		if len([]rune(title)) > maxFormTextLen {
+			return fmt.Errorf("step %q title must be at most %d characters", id, maxFormTextLen)
+		}
+	}
+	for name, field := range t.Fields {
+		if len([]rune(field.Label)) > maxFormTextLen || len([]rune(field.Placeholder)) > maxFormTextLen || len([]rune(field.Message)) > maxFormTextLen {
+			return fmt.Errorf("field %q texts must be at most %d characters", name, maxFormTextLen)
+		}
+		if len(field.Options) > maxFormOptions {
+			return fmt.Errorf("field %q allows at most %d options", name, maxFormOptions)
+		}
+		for _, label := range field.Options {
+			if len([]rune(label)) > maxFormTextLen {
+				return fmt.Errorf("field %q option labels must be at most %d characters", name, maxFormTextLen)
+			}
+		}
+	}
+	return nil
+}
+
+// Retain 删除表单中已不存在的步骤、字段和选项的翻译，导入按旧版原文翻译的文件时使用
+func (t *FormTranslation) Retain(c *FormConfig) {
+	steps := make(map[string]bool)
+	fields := make(map[string]*FormField)
+	for _, step := range c.StepList() {
+		if len(c.Steps) > 0 {
+			steps[step.ID] = true
+		}
+		for i := range step.Fields {
+			fields[step.Fields[i].Name] = &step.Fields[i]
+		}
+	}
+	for id := range t.Steps {
+		if !steps[id] {
+			delete(t.Steps, id)
+		}
+	}
+	for name, text := range t.Fields {
+		field, ok := fields[name]
+		if !ok {
+			delete(t.Fields, name)
+			continue
+		}
+		for value := range text.Options {
+			if !containsValue(field.Options, value) {
+				delete(text.Options, value)
+			}
+		}
+		if text.Label == "" && text.Placeholder == "" && text.Message == "" && len(text.Options) == 0 {
+			delete(t.Fields, name)
+		}
+	}
+}
+
+// IsZero 判断是否没有任何翻译
+func (t *FormTranslation) IsZero() bool {
+	return t.SubmitLabel == "" && t.NextLabel == "" && t.BackLabel == "" && t.SuccessMessage == "" && t.CaptchaLabel == "" &&
+		len(t.Steps) == 0 && len(t.Fields) == 0
+}
+
+// Marshal 序列化为存储使用的JSON
+func (t *FormTranslation) Marshal() (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal form translation: %w", err)
+	}
+	return string(data), nil
+}
+
+// SourceTexts 提取表单中需要翻译的原文，结构与翻译相同，导出给翻译人员参考
+func (c *FormConfig) SourceTexts() *FormTranslation {
+	source := &FormTranslation{
+		SubmitLabel:    c.SubmitLabel,
+		NextLabel:      c.NextLabel,
+		BackLabel:      c.BackLabel,
+		SuccessMessage: c.SuccessMessage,
+		CaptchaLabel:   c.CaptchaLabel,
+	}
+	for _, step := range c.StepList() {
+		if step.Title != "" && len(c.Steps) > 0 {
+			if source.Steps == nil {
+				source.Steps = make(map[string]string)
+			}
+			source.Steps[step.ID] = step.Title
+		}
+		for _, field := range step.Fields {
+			text := FieldTranslation{Label: field.Label, Placeholder: field.Placeholder}
+			if field.Validation != nil {
+				text.Message = field.Validation.Message
+			}
+			for _, option := range field.Options {
+				if text.Options == nil {
+					text.Options = make(map[string]string)
+				}
+				text.Options[option] = field.OptionLabel(option)
+			}
+			if source.Fields == nil {
+				source.Fields = make(map[string]FieldTranslation)
+			}
+			source.Fields[field.Name] = text
+		}
+	}
+	return source
+}
+
+// Localize 返回使用翻译文字的表单配置副本，不修改原配置
+func (c *FormConfig) Localize(t *FormTranslation) *FormConfig {
+	if t == nil || t.IsZero() {
+		return c
+	}
+
+	localized := *c
+	localized.SubmitLabel = orDefault(t.SubmitLabel, c.SubmitLabel)
+	localized.NextLabel = orDefault(t.NextLabel, c.NextLabel)
+	localized.BackLabel = orDefault(t.BackLabel, c.BackLabel)
+	localized.SuccessMessage = orDefault(t.SuccessMessage, c.SuccessMessage)
+	localized.CaptchaLabel = orDefault(t.CaptchaLabel, c.CaptchaLabel)
+	localized.Fields = localizeFields(c.Fields, t)
+	if len(c.Steps) > 0 {
+		localized.Steps = make([]FormStep, len(c.Steps))
+		for i, step := range c.Steps {
+			step.Title = orDefault(t.Steps[step.ID], step.Title)
+			step.Fields = localizeFields(step.Fields, t)
+			localized.Steps[i] = step
+		}
+	}
+	return &localized
+}
+
+// localizeFields 返回使用翻译文字的字段副本
+func localizeFields(fields []FormField, t *FormTranslation) []FormField {
+	if fields == nil {
+		return nil
+	}
+	localized := make([]FormField, len(fields))
+	for i, field := range fields {
+		if text, ok := t.Fields[field.Name]; ok {
+			field.Label = orDefault(text.Label, field.Label)
+			field.Placeholder = orDefault(text.Placeholder, field.Placeholder)
+			if field.Validation != nil && text.Message != "" {
+				validation := *field.Validation
+				validation.Message = text.Message
+				field.Validation = &validation
+			}
+			if len(text.Options) > 0 {
+				labels := make(map[string]string, len(field.Options))
+				for value, label := range field.OptionLabels {
+					labels[value] = label
+				}
+				for value, label := range text.Options {
+					if containsValue(field.Options, value) {
+						labels[value] = label
+					}
+				}
+				field.OptionLabels = labels
+			}
+		}
+		localized[i] = field
+	}
+	return localized
+}
+
+// OptionLabel 返回选项的显示文字，未设置时为选项值
+func (f *FormField) OptionLabel(value string) string {
+	return orDefault(f.OptionLabels[value], value)
+}
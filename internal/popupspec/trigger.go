@@ -0,0 +1,206 @@
+package popupspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 触发方式，由注入的页面脚本根据弹窗元素的 data-trigger-* 属性绑定
+const (
+	TriggerPageLoad         = "page_load"         // 页面加载后展示
+	TriggerTimeDelay        = "time_delay"        // 页面加载若干秒后展示，TriggerValue 为秒数
+	TriggerScrollPercentage = "scroll_percentage" // 页面滚动到指定百分比时展示，TriggerValue 为百分比
+	TriggerElementClick     = "element_click"     // 点击匹配的元素时展示，TriggerValue 为CSS选择器
+	TriggerExitIntent       = "exit_intent"       // 鼠标移出页面顶部时展示
+	TriggerFormSubmit       = "form_submit"       // 提交匹配的表单时展示，TriggerValue 为CSS选择器，为空时匹配所有表单
+	TriggerAPICall          = "api_call"          // 页面的 fetch/XHR 请求匹配 APICallTrigger 时展示
+)
+
+// TriggerTypes 支持的触发方式
+var TriggerTypes = []string{
+	TriggerPageLoad,
+	TriggerTimeDelay,
+	TriggerScrollPercentage,
+	TriggerElementClick,
+	TriggerExitIntent,
+	TriggerFormSubmit,
+	TriggerAPICall,
+}
+
+// 接口调用触发条件限制
+const (
+	maxAPICallPatternLen = 500
+	maxAPICallStatuses   = 20
+)
+
+// apiCallMethods 支持匹配的请求方法
+var apiCallMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// APICallTrigger 接口调用触发条件，匹配被代理页面发起的 fetch/XHR 请求，存储于 Popup.TriggerConfig
+//
+// URLPattern 中的 * 匹配任意字符（包括 /）。以 / 开头时匹配请求路径，
+// 模式中包含 ? 时匹配路径和查询参数；否则匹配完整URL（不含 # 之后的部分）
+type APICallTrigger struct {
+	Methods    []string `json:"methods,omitempty"`   // 请求方法，为空时不限
+	URLPattern string   `json:"url_pattern"`         // URL匹配模式，如 /api/cart/add
+	Statuses   []string `json:"statuses,omitempty"`  // 响应状态码，如 200、2xx，为空时不限
+	NextPage   bool     `json:"next_page,omitempty"` // 经代理转发的请求匹配时，在访客的下一个HTML页面打开弹窗
+}
+
+// ParseAPICallTrigger 解析接口调用触发条件JSON
+func ParseAPICallTrigger(raw string) (*APICallTrigger, error) {
+	trigger := &APICallTrigger{}
+	if err := json.Unmarshal([]byte(raw), trigger); err != nil {
+		return nil, fmt.Errorf("invalid api_call trigger: %w", err)
+	}
+	if err := trigger.Validate(); err != nil {
+		return nil, err
+	}
+	return trigger, nil
+}
+
+// Normalize 统一请求方法和状态码的大小写并去除空白和重复值
+func (t *APICallTrigger) Normalize() {
+	t.URLPattern = strings.TrimSpace(t.URLPattern)
+	t.Methods = normalizeList(t.Methods, strings.ToUpper)
+	t.Statuses = normalizeList(t.Statuses, strings.ToLower)
+}
+
+// Validate 校验接口调用触发条件
+func (t *APICallTrigger) Validate() error {
+	if t.URLPattern == "" {
+		return fmt.Errorf("url_pattern is required")
+	}
+	if len([]rune(t.URLPattern)) > maxAPICallPatternLen {
+		return fmt.Errorf("url_pattern must be at most %d characters", maxAPICallPatternLen)
+	}
+	for _, method := range t.Methods {
+		if !containsFold(apiCallMethods, method) {
+			return fmt.Errorf("invalid method %q", method)
+		}
+	}
+	if len(t.Statuses) > maxAPICallStatuses {
+		return fmt.Errorf("at most %d statuses are allowed", maxAPICallStatuses)
+	}
+	for _, status := range t.Statuses {
+		if !validStatusPattern(status) {
+			return fmt.Errorf("invalid status %q, expected a code such as 200 or a class such as 2xx", status)
+		}
+	}
+	return nil
+}
+
+// Marshal 序列化为存储和注入页面使用的JSON
+func (t *APICallTrigger) Marshal() (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal api_call trigger: %w", err)
+	}
+	return string(data), nil
+}
+
+// Matches 判断请求是否匹配，requestURL 为访客访问的完整URL，与页面脚本看到的URL一致
+func (t *APICallTrigger) Matches(method string, requestURL *url.URL, status int) bool {
+	if len(t.Methods) > 0 && !containsFold(t.Methods, method) {
+		return false
+	}
+	if !t.matchesStatus(status) {
+		return false
+	}
+
+	var target string
+	switch {
+	case strings.HasPrefix(t.URLPattern, "/") && strings.Contains(t.URLPattern, "?"):
+		target = requestURL.EscapedPath()
+		if requestURL.RawQuery != "" {
+			target += "?" + requestURL.RawQuery
+		}
+	case strings.HasPrefix(t.URLPattern, "/"):
+		target = requestURL.EscapedPath()
+	default:
+		withoutFragment := *requestURL
+		withoutFragment.Fragment = ""
+		withoutFragment.RawFragment = ""
+		target = withoutFragment.String()
+	}
+	return matchGlob(t.URLPattern, target)
+}
+
+// matchesStatus 判断响应状态码是否匹配
+func (t *APICallTrigger) matchesStatus(status int) bool {
+	if len(t.Statuses) == 0 {
+		return true
+	}
+	code := strconv.Itoa(status)
+	for _, pattern := range t.Statuses {
+		if pattern == code || (strings.HasSuffix(pattern, "xx") && len(code) == 3 && code[0] == pattern[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// validStatusPattern 判断是否为有效的状态码或状态码类别
+func validStatusPattern(pattern string) bool {
+	if len(pattern) != 3 || pattern[0] < '1' || pattern[0] > '5' {
+		return false
+	}
+	if pattern[1:] == "xx" {
+		return true
+	}
+	code, err := strconv.Atoi(pattern)
+	return err == nil && code >= 100 && code <= 599
+}
+
+// matchGlob 判断值是否完整匹配模式，* 匹配任意长度的任意字符
+func matchGlob(pattern, value string) bool {
+	p, v := 0, 0
+	star, mark := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case p < len(pattern) && pattern[p] == value[v]:
+			p++
+			v++
+		case star >= 0:
+			p = star + 1
+			mark++
+			v = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// normalizeList 规范化列表中的值并去除空白和重复值
+func normalizeList(values []string, normalize func(string) string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		value = normalize(strings.TrimSpace(value))
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+package popupspec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 访客状态Cookie
+//
+// 由注入的页面脚本维护（每次页面加载计入浏览、展示/关闭/提交时更新弹窗状态），
+// 服务端只读取，用于在注入前做与页面脚本相同的判断
+const (
+	StateCookieName   = "pe_state"
+	StateCookieMaxAge = 365 * 24 * 60 * 60 // 一年
+	SessionTimeout    = 30 * time.Minute   // 超过该时间无浏览视为新会话
+	MaxTrackedPopups  = 30                 // Cookie中最多记录的弹窗数，超出时丢弃最早展示的弹窗
+)
+
+// dayLayout 频率限制使用的UTC日期格式
+const dayLayout = "2006-01-02"
+
+// VisitorState 访客状态，以base64url编码的JSON存储在 StateCookieName Cookie中
+type VisitorState struct {
+	Session SessionState           `json:"s"`
+	Popups  map[string]*PopupState `json:"p,omitempty"` // 键为弹窗ID
+
+	today string // 当前页面浏览的UTC日期，由 Advance 设置
+}
+
+// SessionState 当前会话状态
+type SessionState struct {
+	ID        string `json:"id,omitempty"` // 会话ID，由页面脚本生成
+	LastSeen  int64  `json:"t,omitempty"`  // 最近一次浏览的Unix时间（秒）
+	PageViews int    `json:"pv,omitempty"` // 本次会话的浏览页数
+	Returning bool   `json:"r,omitempty"`  // 之前有过会话
+	UTMSource string `json:"u,omitempty"`  // 本次会话最近一次带来的 utm_source
+
+	// 来源归因，页面脚本在会话开始时记录，提交表单时保存到提交记录
+	Landing  string `json:"l,omitempty"` // 会话第一个页面的路径和查询参数
+	Referrer string `json:"f,omitempty"` // 会话开始时的外部来源域名，直接访问或站内跳转时为空
+}
+
+// PopupState 单个弹窗的展示状态
+type PopupState struct {
+	Day       string `json:"d,omitempty"`   // 最近展示的UTC日期
+	DayCount  int    `json:"n,omitempty"`   // Day 当天的展示次数
+	SessionID string `json:"sid,omitempty"` // 最近展示时的会话ID
+	Closed    bool   `json:"c,omitempty"`   // 访客关闭过弹窗
+	Submitted bool   `json:"x,omitempty"`   // 访客提交过弹窗
+}
+
+// DecodeVisitorState 解码Cookie值
+func DecodeVisitorState(value string) (*VisitorState, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid visitor state encoding: %w", err)
+	}
+
+	state := &VisitorState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid visitor state: %w", err)
+	}
+	return state, nil
+}
+
+// Encode 编码为Cookie值
+func (s *VisitorState) Encode() (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal visitor state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// VisitorStateFromRequest 读取请求的访客状态并计入当前页面浏览
+// Cookie不存在或无效时视为首次访问的新访客
+func VisitorStateFromRequest(r *http.Request, now time.Time) *VisitorState {
+	state := &VisitorState{}
+	if cookie, err := r.Cookie(StateCookieName); err == nil {
+		if decoded, err := DecodeVisitorState(cookie.Value); err == nil {
+			state = decoded
+		}
+	}
+
+	state.Advance(now, r.URL.Query().Get("utm_source"))
+	return state
+}
+
+// Advance 计入一次页面浏览，与页面脚本在加载时的处理一致
+// 会话超时后开始新会话，新会话的ID由页面脚本生成，这里保持为空
+func (s *VisitorState) Advance(now time.Time, utmSource string) {
+	s.today = now.UTC().Format(dayLayout)
+
+	timestamp := now.Unix()
+	if s.Session.ID == "" || timestamp-s.Session.LastSeen > int64(SessionTimeout/time.Second) {
+		s.Session = SessionState{Returning: s.Session.ID != "" || s.Session.Returning}
+	}
+
+	s.Session.PageViews++
+	s.Session.LastSeen = timestamp
+	if source := normalizeUTMSource(utmSource); source != "" {
+		s.Session.UTMSource = source
+	}
+}
+
+// day 返回当前页面浏览的UTC日期
+func (s *VisitorState) day() string {
+	if s.today != "" {
+		return s.today
+	}
+	return time.Now().UTC().Format(dayLayout)
+}
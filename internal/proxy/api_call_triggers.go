@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 待打开弹窗Cookie
+//
+// 经代理转发的请求匹配开启 next_page 的接口调用触发条件时写入弹窗ID，
+// 页面脚本在下一个页面加载时打开其中的弹窗并清除该Cookie
+const (
+	PendingTriggerCookieName = "pe_trig"
+	pendingTriggerMaxAge     = 5 * 60 // 五分钟内没有打开新页面则不再展示
+	maxPendingTriggers       = 10
+	pendingTriggerSeparator  = "."
+	apiCallTriggerCacheTTL   = 10 * time.Second
+)
+
+// APICallTriggerIndex 按代理配置缓存开启 next_page 的接口调用触发条件，避免每个转发请求都查询数据库
+type APICallTriggerIndex struct {
+	db      *gorm.DB
+	logger  logger.Logger
+	entries sync.Map // 代理配置ID -> *apiCallTriggerEntry
+}
+
+// apiCallTriggerEntry 单个代理配置的接口调用触发条件缓存
+type apiCallTriggerEntry struct {
+	loadedAt time.Time
+	triggers []popupAPICallTrigger
+}
+
+// popupAPICallTrigger 弹窗的接口调用触发条件
+type popupAPICallTrigger struct {
+	popupID string
+	trigger *popupspec.APICallTrigger
+}
+
+// NewAPICallTriggerIndex 创建新的接口调用触发条件索引
+func NewAPICallTriggerIndex(db *gorm.DB, logger logger.Logger) *APICallTriggerIndex {
+	return &APICallTriggerIndex{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Match 返回转发请求匹配的弹窗ID，r 为客户端的原始请求，status 为目标站点的响应状态码
+func (idx *APICallTriggerIndex) Match(proxyConfigID uuid.UUID, r *http.Request, status int) []string {
+	triggers := idx.triggers(proxyConfigID)
+	if len(triggers) == 0 {
+		return nil
+	}
+
+	requestURL := clientURL(r)
+	var popupIDs []string
+	for _, t := range triggers {
+		if t.trigger.Matches(r.Method, requestURL, status) {
+			popupIDs = append(popupIDs, t.popupID)
+		}
+	}
+	return popupIDs
+}
+
+// triggers 返回代理配置的接口调用触发条件，缓存过期后重新加载，加载失败时沿用旧的缓存
+func (idx *APICallTriggerIndex) triggers(proxyConfigID uuid.UUID) []popupAPICallTrigger {
+	if idx.db == nil {
+		return nil
+	}
+
+	var cached *apiCallTriggerEntry
+	if value, ok := idx.entries.Load(proxyConfigID); ok {
+		cached = value.(*apiCallTriggerEntry)
+		if time.Since(cached.loadedAt) < apiCallTriggerCacheTTL {
+			return cached.triggers
+		}
+	}
+
+	triggers, err := idx.load(proxyConfigID)
+	if err != nil {
+		idx.logger.WithFields(map[string]interface{}{
+			"proxy_config_id": proxyConfigID,
+			"error":           err.Error(),
+		}).Warn("Failed to load api_call triggers")
+		if cached != nil {
+			return cached.triggers
+		}
+		return nil
+	}
+
+	idx.entries.Store(proxyConfigID, &apiCallTriggerEntry{loadedAt: time.Now(), triggers: triggers})
+	return triggers
+}
+
+// load 查询对该代理配置生效且开启 next_page 的接口调用触发条件
+func (idx *APICallTriggerIndex) load(proxyConfigID uuid.UUID) ([]popupAPICallTrigger, error) {
+	var popups []*models.Popup
+	bound := idx.db.Model(&models.PopupProxyConfig{}).Select("popup_id").Where("proxy_config_id = ?", proxyConfigID)
+	if err := idx.db.Select("id", "trigger_config").
+		Where("is_active = ? AND trigger_type = ? AND (is_global = ? OR id IN (?))", true, popupspec.TriggerAPICall, true, bound).
+		Find(&popups).Error; err != nil {
+		return nil, err
+	}
+
+	triggers := make([]popupAPICallTrigger, 0, len(popups))
+	for _, popup := range popups {
+		trigger, err := popupspec.ParseAPICallTrigger(popup.TriggerConfig)
+		if err != nil {
+			idx.logger.WithFields(map[string]interface{}{
+				"popup_id": popup.ID,
+				"error":    err.Error(),
+			}).Warn("Ignoring invalid api_call trigger")
+			continue
+		}
+		if trigger.NextPage {
+			triggers = append(triggers, popupAPICallTrigger{popupID: popup.ID.String(), trigger: trigger})
+		}
+	}
+	return triggers, nil
+}
+
+// FlagPendingTriggers 将弹窗ID合并写入待打开弹窗Cookie
+func FlagPendingTriggers(w http.ResponseWriter, r *http.Request, popupIDs []string) {
+	if len(popupIDs) == 0 {
+		return
+	}
+
+	pending := pendingTriggers(r)
+	for _, popupID := range popupIDs {
+		if !containsField(pending, popupID) {
+			pending = append(pending, popupID)
+		}
+	}
+	if len(pending) > maxPendingTriggers {
+		pending = pending[len(pending)-maxPendingTriggers:]
+	}
+
+	// 页面脚本需要读取并清除，不能设置 HttpOnly
+	http.SetCookie(w, &http.Cookie{
+		Name:     PendingTriggerCookieName,
+		Value:    strings.Join(pending, pendingTriggerSeparator),
+		Path:     "/",
+		MaxAge:   pendingTriggerMaxAge,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// pendingTriggers 读取请求中已有的待打开弹窗ID
+func pendingTriggers(r *http.Request) []string {
+	cookie, err := r.Cookie(PendingTriggerCookieName)
+	if err != nil {
+		return nil
+	}
+
+	var popupIDs []string
+	for _, popupID := range strings.Split(cookie.Value, pendingTriggerSeparator) {
+		if _, err := uuid.Parse(popupID); err == nil {
+			popupIDs = append(popupIDs, popupID)
+		}
+	}
+	return popupIDs
+}
+
+// clientURL 返回访客访问的完整URL
+func clientURL(r *http.Request) *url.URL {
+	scheme := "http"
+	if isSecureRequest(r) {
+		scheme = "https"
+	}
+	return &url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		Path:     r.URL.Path,
+		RawPath:  r.URL.RawPath,
+		RawQuery: r.URL.RawQuery,
+	}
+}
@@ -2,8 +2,10 @@ package proxy
 
 import (
 	"fmt"
+	"time"
 
 	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
 )
 
 // AssetsProvider 静态资源提供器
@@ -15,46 +17,20 @@ func NewAssetsProvider() *AssetsProvider {
 }
 
 // GetCSS 获取注入的CSS样式
+// 弹窗的样式在各自的 Shadow DOM 中，这里只控制宿主元素的定位和显示，不影响页面的其他元素
 func (ap *AssetsProvider) GetCSS() string {
 	return `
 /* 代理增强器样式 */
-.proxy-popup {
-    position: fixed;
-    top: 50%;
-    left: 50%;
-    transform: translate(-50%, -50%);
-    background: white;
-    border: 1px solid #ccc;
-    border-radius: 8px;
-    box-shadow: 0 4px 20px rgba(0,0,0,0.3);
-    z-index: 10000;
-    max-width: 500px;
-    max-height: 80vh;
-    overflow-y: auto;
-    padding: 20px;
+.proxy-popup[data-popup-id] {
+    all: initial !important;
+    position: fixed !important;
+    inset: 0 !important;
+    z-index: 2147483000 !important;
+    pointer-events: none !important;
 }
 
-.proxy-popup-overlay {
-    position: fixed;
-    top: 0;
-    left: 0;
-    width: 100%;
-    height: 100%;
-    background: rgba(0,0,0,0.5);
-    z-index: 9999;
-}
-
-.proxy-popup-close {
-    position: absolute;
-    top: 10px;
-    right: 15px;
-    font-size: 24px;
-    cursor: pointer;
-    color: #999;
-}
-
-.proxy-popup-close:hover {
-    color: #333;
+.proxy-popup[data-popup-id]:not([data-pe-open]) {
+    display: none !important;
 }
 `
 }
@@ -69,52 +45,769 @@ func (ap *AssetsProvider) GetJavaScript(proxyConfig *models.ProxyConfig) string
     // 代理配置
     window.PROXY_CONFIG = {
         domain: '%s',
-        configId: '%s'
+        configId: '%s',
+        eventsEndpoint: '%s',
+        formsEndpoint: '%s',
+        captchaEndpoint: '%s',
+        uploadsEndpoint: '%s'
+    };
+    
+    // 访客状态，与服务端 popupspec.VisitorState 的编码和判断逻辑保持一致
+    window.ProxyVisitorState = {
+        cookieName: '%s',
+        maxAge: %d,
+        sessionTimeout: %d,
+        maxPopups: %d,
+        state: null,
+        
+        load: function() {
+            var match = document.cookie.match(new RegExp('(?:^|; )' + this.cookieName + '=([^;]*)'));
+            var state = null;
+            if (match) {
+                try {
+                    var encoded = match[1].replace(/-/g, '+').replace(/_/g, '/');
+                    while (encoded.length & 3) {
+                        encoded += '=';
+                    }
+                    state = JSON.parse(decodeURIComponent(escape(atob(encoded))));
+                } catch (error) {
+                    state = null;
+                }
+            }
+            state = state || {};
+            state.s = state.s || {};
+            state.p = state.p || {};
+            return state;
+        },
+        
+        save: function() {
+            var state = this.state;
+            // 只保留最近展示的弹窗，避免Cookie过大
+            var ids = Object.keys(state.p);
+            if (ids.length > this.maxPopups) {
+                ids.sort(function(a, b) {
+                    return (state.p[a].d || '') < (state.p[b].d || '') ? -1 : 1;
+                });
+                ids.slice(0, ids.length - this.maxPopups).forEach(function(id) {
+                    delete state.p[id];
+                });
+            }
+            var encoded = btoa(unescape(encodeURIComponent(JSON.stringify(state))))
+                .replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+            document.cookie = this.cookieName + '=' + encoded + '; path=/; max-age=' + this.maxAge +
+                '; samesite=lax' + (location.protocol === 'https:' ? '; secure' : '');
+        },
+        
+        today: function() {
+            return new Date().toISOString().slice(0, 10);
+        },
+        
+        // 计入当前页面浏览，会话超时后开始新会话
+        advance: function() {
+            var state = this.state = this.load();
+            var now = Math.floor(Date.now() / 1000);
+            if (!state.s.id || now - (state.s.t || 0) > this.sessionTimeout) {
+                state.s = {
+                    id: Math.random().toString(36).slice(2, 10) + now.toString(36),
+                    r: !!(state.s.id || state.s.r),
+                    l: (location.pathname + location.search).slice(0, 300),
+                    f: this.referrerDomain()
+                };
+            }
+            state.s.pv = (state.s.pv || 0) + 1;
+            state.s.t = now;
+            var source = new URLSearchParams(location.search).get('utm_source');
+            source = source ? source.trim().toLowerCase().slice(0, 100) : '';
+            if (source) {
+                state.s.u = source;
+            }
+            this.save();
+        },
+        
+        // 会话来源的外部域名，直接访问或站内跳转时为空
+        referrerDomain: function() {
+            try {
+                var host = document.referrer ? new URL(document.referrer).hostname.toLowerCase() : '';
+                return host && host !== location.hostname.toLowerCase() ? host.slice(0, 255) : '';
+            } catch (error) {
+                return '';
+            }
+        },
+        
+        // 判断弹窗的频率限制和受众规则
+        allows: function(popupId, rules) {
+            if (!rules) {
+                return true;
+            }
+            var state = this.state = this.load();
+            var session = state.s;
+            var audience = rules.audience || {};
+            var frequency = rules.frequency || {};
+            if (audience.visitor === 'new' && session.r) {
+                return false;
+            }
+            if (audience.visitor === 'returning' && !session.r) {
+                return false;
+            }
+            if (audience.min_page_views && (session.pv || 0) < audience.min_page_views) {
+                return false;
+            }
+            if (audience.max_page_views && (session.pv || 0) > audience.max_page_views) {
+                return false;
+            }
+            if (audience.utm_sources && audience.utm_sources.length && audience.utm_sources.indexOf(session.u) < 0) {
+                return false;
+            }
+            
+            var popup = state.p[popupId];
+            if (!popup) {
+                return true;
+            }
+            if (frequency.stop_after_submit && popup.x) {
+                return false;
+            }
+            if (frequency.stop_after_close && popup.c) {
+                return false;
+            }
+            if (frequency.once_per_session && popup.sid && popup.sid === session.id) {
+                return false;
+            }
+            if (frequency.max_per_day && popup.d === this.today() && (popup.n || 0) >= frequency.max_per_day) {
+                return false;
+            }
+            return true;
+        },
+        
+        // 记录弹窗的展示、关闭和提交
+        record: function(popupId, type) {
+            var state = this.state = this.load();
+            var popup = state.p[popupId] = state.p[popupId] || {};
+            if (type === 'impression') {
+                var today = this.today();
+                popup.n = popup.d === today ? (popup.n || 0) + 1 : 1;
+                popup.d = today;
+                popup.sid = state.s.id;
+            } else if (type === 'close') {
+                popup.c = true;
+            } else if (type === 'submit') {
+                popup.x = true;
+            } else {
+                return;
+            }
+            this.save();
+        }
     };
+    ProxyVisitorState.advance();
     
     // 弹窗管理器
     window.ProxyPopupManager = {
+        // 弹窗展示时间，用于计算关闭、点击、提交距展示的耗时
+        shownAt: {},
+        
         show: function(popupId) {
             var popup = document.getElementById('popup-' + popupId);
-            if (popup) {
-                // 创建遮罩层
-                var overlay = document.createElement('div');
-                overlay.className = 'proxy-popup-overlay';
-                overlay.onclick = function() {
-                    ProxyPopupManager.hide(popupId);
-                };
-                document.body.appendChild(overlay);
+            if (popup && !popup.hasAttribute('data-pe-open')) {
+                // 达到频率限制或不属于目标受众时不展示
+                var rules = null;
+                try {
+                    rules = JSON.parse(popup.getAttribute('data-display-rules') || 'null');
+                } catch (error) {
+                    rules = null;
+                }
+                if (!ProxyVisitorState.allows(popupId, rules)) {
+                    return false;
+                }
                 
-                // 显示弹窗
-                popup.style.display = 'block';
+                ProxyPopupManager.mount(popup);
+                popup.setAttribute('data-pe-open', '');
                 
-                // 添加关闭按钮
-                var closeBtn = document.createElement('span');
-                closeBtn.className = 'proxy-popup-close';
-                closeBtn.innerHTML = '×';
-                closeBtn.onclick = function() {
-                    ProxyPopupManager.hide(popupId);
-                };
-                popup.appendChild(closeBtn);
+                ProxyPopupManager.shownAt[popupId] = Date.now();
+                ProxyPopupManager.track(popupId, 'impression');
+                return true;
             }
+            return false;
+        },
+        
+        // 将弹窗模板挂载到 Shadow DOM，页面样式和弹窗样式互不影响，不支持 Shadow DOM 时直接挂载到宿主元素
+        mount: function(popup) {
+            if (popup.peRoot) {
+                return popup.peRoot;
+            }
+            var popupId = popup.getAttribute('data-popup-id');
+            var template = popup.querySelector('template[data-pe-shadow]');
+            var root = popup.attachShadow ? popup.attachShadow({ mode: 'open' }) : popup;
+            if (template) {
+                root.appendChild(document.importNode(template.content, true));
+                template.parentNode.removeChild(template);
+            }
+            
+            var dismiss = function() {
+                ProxyPopupManager.dismiss(popupId);
+            };
+            var overlay = root.querySelector('.pe-overlay');
+            if (overlay) {
+                overlay.addEventListener('click', dismiss);
+            }
+            var closeBtn = root.querySelector('.pe-close');
+            if (closeBtn) {
+                closeBtn.addEventListener('click', dismiss);
+            }
+            
+            // 点击带 data-pe-cta 属性的元素或链接视为行动按钮点击
+            root.addEventListener('click', function(event) {
+                var target = event.target.closest ? event.target.closest('[data-pe-cta], a[href]') : null;
+                if (target) {
+                    ProxyPopupManager.track(popupId, 'click', target.getAttribute('data-pe-cta') || target.getAttribute('href'));
+                }
+            });
+            
+            ProxyPopupForms.bind(popupId, root);
+            
+            popup.peRoot = root;
+            return root;
         },
         
         hide: function(popupId) {
             var popup = document.getElementById('popup-' + popupId);
             if (popup) {
-                popup.style.display = 'none';
-                
-                // 移除遮罩层
-                var overlay = document.querySelector('.proxy-popup-overlay');
-                if (overlay) {
-                    overlay.remove();
+                popup.removeAttribute('data-pe-open');
+            }
+        },
+        
+        // 访客主动关闭弹窗
+        dismiss: function(popupId) {
+            ProxyPopupManager.track(popupId, 'close');
+            ProxyPopupManager.hide(popupId);
+        },
+        
+        // 返回弹窗及展示的变体标识，提交数据时用于A/B测试转化归因
+        context: function(popupId) {
+            var popup = document.getElementById('popup-' + popupId);
+            return {
+                popup_id: popupId,
+                variant_id: popup ? popup.getAttribute('data-variant-id') : null
+            };
+        },
+        
+        // 上报弹窗事件，优先使用 sendBeacon，页面卸载时也能送达
+        track: function(popupId, type, target) {
+            ProxyVisitorState.record(popupId, type);
+            
+            var event = ProxyPopupManager.context(popupId);
+            event.type = type;
+            if (target) {
+                event.target = String(target).slice(0, 100);
+            }
+            var shownAt = ProxyPopupManager.shownAt[popupId];
+            if (type !== 'impression' && shownAt) {
+                event.elapsed_ms = Date.now() - shownAt;
+            }
+            
+            var body = JSON.stringify({ events: [event] });
+            var endpoint = window.PROXY_CONFIG.eventsEndpoint;
+            try {
+                if (navigator.sendBeacon && navigator.sendBeacon(endpoint, new Blob([body], { type: 'application/json' }))) {
+                    return;
                 }
-                
-                // 移除关闭按钮
-                var closeBtn = popup.querySelector('.proxy-popup-close');
-                if (closeBtn) {
-                    closeBtn.remove();
+                fetch(endpoint, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: body,
+                    credentials: 'same-origin',
+                    keepalive: true
+                });
+            } catch (error) {
+                console.error('Error tracking popup event:', error);
+            }
+        }
+    };
+    
+    // 弹窗表单，由服务端按 popupspec.FormConfig 渲染，逐步提交到数据面，服务端把各步骤合并为一条提交记录
+    window.ProxyPopupForms = {
+        // 页面加载时间，服务端要求表单在签发令牌后经过最短填写时间才能提交
+        loadedAt: Date.now(),
+        proofs: {},
+        
+        bind: function(popupId, root) {
+            var form = root.querySelector('form[data-pe-form]');
+            if (!form) {
+                return;
+            }
+            var steps = Array.prototype.slice.call(form.querySelectorAll('.pe-step'));
+            var state = { index: 0, busy: false };
+            var update = function() {
+                ProxyPopupForms.applyConditions(form);
+            };
+            form.addEventListener('input', update);
+            form.addEventListener('change', update);
+            // 选择文件后立即上传，提交步骤时只提交服务端返回的文件ID
+            form.addEventListener('change', function(event) {
+                if (event.target.type === 'file') {
+                    ProxyPopupForms.upload(popupId, form, event.target);
+                }
+            });
+            
+            var captcha = form.querySelector('.pe-captcha');
+            if (captcha) {
+                captcha.querySelector('.pe-captcha-refresh').addEventListener('click', function() {
+                    ProxyPopupForms.loadCaptcha(captcha);
+                });
+            }
+            
+            var back = form.querySelector('.pe-back');
+            if (back) {
+                back.addEventListener('click', function() {
+                    if (state.index > 0) {
+                        ProxyPopupForms.go(form, steps, state, state.index - 1);
+                    }
+                });
+            }
+            
+            // 每一步都保存到服务端，访客中途离开时已填写的步骤保留为未完成的提交
+            form.addEventListener('submit', function(event) {
+                event.preventDefault();
+                var step = steps[state.index];
+                var last = state.index === steps.length - 1;
+                if (state.busy || !step || !ProxyPopupForms.check(step) || (last && captcha && !ProxyPopupForms.check(captcha))) {
+                    return;
+                }
+                state.busy = true;
+                ProxyPopupForms.showError(form, '');
+                ProxyPopupForms.uploads(step).then(function() {
+                    return ProxyPopupForms.save(popupId, form, step.getAttribute('data-step'), ProxyPopupForms.values(step), last);
+                }).then(function(result) {
+                    state.busy = false;
+                    if (result.completed) {
+                        ProxyPopupForms.finish(popupId, form);
+                    } else {
+                        ProxyPopupForms.go(form, steps, state, state.index + 1);
+                    }
+                }).catch(function(error) {
+                    state.busy = false;
+                    ProxyPopupForms.showError(form, error.message);
+                    // 服务端校验后验证码即失效，提交失败时换一张
+                    if (last && captcha) {
+                        ProxyPopupForms.loadCaptcha(captcha);
+                    }
+                });
+            });
+            
+            update();
+            ProxyPopupForms.go(form, steps, state, 0);
+        },
+        
+        // 切换到指定步骤并更新按钮和进度
+        go: function(form, steps, state, index) {
+            state.index = index;
+            steps.forEach(function(step, i) {
+                ProxyPopupForms.toggle(step, i === index);
+            });
+            var last = index === steps.length - 1;
+            var back = form.querySelector('.pe-back');
+            if (back) {
+                ProxyPopupForms.toggle(back, index > 0);
+            }
+            var next = form.querySelector('.pe-next');
+            if (next) {
+                next.textContent = next.getAttribute(last ? 'data-submit-label' : 'data-next-label');
+            }
+            // 验证码只在最后一步填写，到达最后一步时加载图片或开始计算工作量证明
+            var captcha = form.querySelector('.pe-captcha');
+            if (captcha) {
+                ProxyPopupForms.toggle(captcha, last);
+                if (last && !captcha.hasAttribute('data-captcha-id')) {
+                    ProxyPopupForms.loadCaptcha(captcha);
+                }
+            }
+            var popup = ProxyPopupForms.popupOf(form);
+            if (last && popup) {
+                ProxyPopupForms.proof(popup);
+            }
+            var progress = form.querySelector('.pe-progress');
+            if (progress) {
+                progress.setAttribute('aria-valuenow', String(index + 1));
+                progress.querySelector('.pe-progress-fill').style.width = ((index + 1) / steps.length * 100) + '%%';
+                progress.querySelector('.pe-progress-text').textContent = (index + 1) + ' / ' + steps.length;
+            }
+        },
+        
+        // 按声明顺序计算字段的可见性，与服务端 popupspec.FormConfig 的判断一致，隐藏的字段不参与校验和提交
+        applyConditions: function(form) {
+            var values = {};
+            var fields = form.querySelectorAll('.pe-field');
+            for (var i = 0; i < fields.length; i++) {
+                var field = fields[i];
+                var condition = null;
+                try {
+                    condition = JSON.parse(field.getAttribute('data-show-if') || 'null');
+                } catch (error) {
+                    condition = null;
+                }
+                var visible = !condition || ProxyPopupForms.matches(condition, values);
+                ProxyPopupForms.toggle(field, visible);
+                var inputs = field.querySelectorAll('input, select, textarea');
+                for (var j = 0; j < inputs.length; j++) {
+                    inputs[j].disabled = !visible;
+                }
+                if (visible) {
+                    var value = ProxyPopupForms.fieldValue(field);
+                    if (value !== null) {
+                        values[field.getAttribute('data-field')] = value;
+                    }
+                }
+            }
+        },
+        
+        matches: function(condition, values) {
+            var value = Object.prototype.hasOwnProperty.call(values, condition.field) ? String(values[condition.field]) : '';
+            var list = condition.values || [];
+            switch (condition.operator) {
+                case 'eq':
+                    return value === (condition.value || '');
+                case 'neq':
+                    return value !== (condition.value || '');
+                case 'in':
+                    return list.indexOf(value) >= 0;
+                case 'not_in':
+                    return list.indexOf(value) < 0;
+                case 'not_empty':
+                    return value !== '';
+                case 'empty':
+                    return value === '';
+            }
+            return false;
+        },
+        
+        // 返回字段的值，未填写时返回 null，复选框勾选时为 true，文件字段为上传后的文件ID
+        fieldValue: function(field) {
+            var type = field.getAttribute('data-type');
+            if (type === 'file') {
+                var file = field.querySelector('input');
+                return file ? file.getAttribute('data-file-id') || null : null;
+            }
+            if (type === 'checkbox' || type === 'radio') {
+                var checked = field.querySelector('input:checked');
+                if (!checked) {
+                    return null;
+                }
+                return type === 'checkbox' ? true : checked.value;
+            }
+            var input = field.querySelector('input, select, textarea');
+            var value = input ? String(input.value).trim() : '';
+            if (value === '') {
+                return null;
+            }
+            if (type === 'number' && !isNaN(Number(value))) {
+                return Number(value);
+            }
+            return value;
+        },
+        
+        // 收集容器内可见字段的值
+        values: function(container) {
+            var values = {};
+            var fields = container.querySelectorAll('.pe-field');
+            for (var i = 0; i < fields.length; i++) {
+                if (fields[i].hasAttribute('hidden')) {
+                    continue;
+                }
+                var value = ProxyPopupForms.fieldValue(fields[i]);
+                if (value !== null) {
+                    values[fields[i].getAttribute('data-field')] = value;
+                }
+            }
+            return values;
+        },
+        
+        // 使用浏览器的表单校验提示当前步骤的第一个无效字段
+        check: function(step) {
+            var inputs = step.querySelectorAll('input, select, textarea');
+            for (var i = 0; i < inputs.length; i++) {
+                var input = inputs[i];
+                if (input.disabled || !input.checkValidity) {
+                    continue;
+                }
+                input.setCustomValidity('');
+                if (!input.checkValidity()) {
+                    var message = input.getAttribute('data-message');
+                    if (message && !input.validity.valueMissing) {
+                        input.setCustomValidity(message);
+                    }
+                    input.reportValidity();
+                    return false;
+                }
+            }
+            return true;
+        },
+        
+        // 提交一个步骤，带上注入时签发的表单令牌和蜜罐字段，最后一步附带验证码
+        save: function(popupId, form, step, values, last) {
+            var body = ProxyPopupManager.context(popupId);
+            var popup = document.getElementById('popup-' + popupId);
+            // 服务端校验失败的提示使用页面显示的语言
+            body.locale = popup ? popup.getAttribute('data-locale') : null;
+            body.session_id = ProxyVisitorState.load().s.id;
+            body.step = step;
+            body.values = values;
+            body.form_token = popup ? popup.getAttribute('data-form-token') : null;
+            var honeypot = form.querySelector('[data-pe-honeypot]');
+            body.honeypot = honeypot ? honeypot.value : '';
+            var captcha = form.querySelector('.pe-captcha');
+            if (last && captcha) {
+                body.captcha_id = captcha.getAttribute('data-captcha-id');
+                body.captcha_answer = String(captcha.querySelector('[data-pe-captcha]').value).trim();
+            }
+            return ProxyPopupForms.ready(popup).then(function() {
+                return last && popup ? ProxyPopupForms.proof(popup) : null;
+            }).then(function(nonce) {
+                if (nonce) {
+                    body.pow = nonce;
+                }
+                return fetch(window.PROXY_CONFIG.formsEndpoint, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(body),
+                    credentials: 'same-origin'
+                });
+            }).then(function(response) {
+                return ProxyPopupForms.result(response, 'Submission failed');
+            });
+        },
+        
+        // 把文件上传到数据面，超过字段大小上限时不上传，重新选择文件时旧的上传结果作废
+        upload: function(popupId, form, input) {
+            input.removeAttribute('data-file-id');
+            input.peUpload = null;
+            var file = input.files && input.files[0];
+            if (!file) {
+                return;
+            }
+            var maxSize = Number(input.getAttribute('data-max-size') || 0);
+            if (maxSize && file.size > maxSize) {
+                input.value = '';
+                ProxyPopupForms.showError(form, 'File is too large');
+                return;
+            }
+            ProxyPopupForms.showError(form, '');
+            var popup = document.getElementById('popup-' + popupId);
+            var data = new FormData();
+            data.append('popup_id', popupId);
+            data.append('field', input.name);
+            data.append('form_token', popup ? popup.getAttribute('data-form-token') || '' : '');
+            data.append('file', file);
+            var pending = fetch(window.PROXY_CONFIG.uploadsEndpoint, {
+                method: 'POST',
+                body: data,
+                credentials: 'same-origin'
+            }).then(function(response) {
+                return ProxyPopupForms.result(response, 'Upload failed');
+            }).then(function(result) {
+                if (input.peUpload === pending) {
+                    input.setAttribute('data-file-id', result.file_id);
+                    input.peUpload = null;
+                    ProxyPopupForms.applyConditions(form);
+                }
+            }, function(error) {
+                if (input.peUpload === pending) {
+                    input.value = '';
+                    input.peUpload = null;
+                    ProxyPopupForms.showError(form, error.message);
+                }
+                throw error;
+            });
+            input.peUpload = pending;
+            // 提交步骤时再处理上传失败，这里只避免未处理的拒绝
+            pending.catch(function() {});
+        },
+        
+        // 等待步骤内正在进行的文件上传完成
+        uploads: function(step) {
+            var inputs = step.querySelectorAll('input[type="file"]');
+            var pending = [];
+            for (var i = 0; i < inputs.length; i++) {
+                if (!inputs[i].disabled && inputs[i].peUpload) {
+                    pending.push(inputs[i].peUpload);
+                }
+            }
+            return Promise.all(pending);
+        },
+        
+        // 解析数据面的响应，失败时抛出带状态码的错误
+        result: function(response, fallback) {
+            return response.json().then(function(result) {
+                if (!response.ok || !result.success) {
+                    var error = new Error(result.message || fallback);
+                    error.status = response.status;
+                    throw error;
+                }
+                return result.data;
+            });
+        },
+        
+        // 等待最短填写时间，过快提交会被服务端拒绝
+        ready: function(popup) {
+            var minFill = popup ? Number(popup.getAttribute('data-min-fill')) || 0 : 0;
+            var wait = ProxyPopupForms.loadedAt + minFill - Date.now();
+            return new Promise(function(resolve) {
+                setTimeout(resolve, Math.max(wait, 0));
+            });
+        },
+        
+        popupOf: function(form) {
+            var root = form.getRootNode ? form.getRootNode() : null;
+            var host = root && root.host ? root.host : form;
+            return host.closest ? host.closest('.proxy-popup') : null;
+        },
+        
+        // 计算工作量证明，每个题目只计算一次，未启用时返回 null
+        proof: function(popup) {
+            var challenge = popup.getAttribute('data-pow-challenge');
+            if (!challenge) {
+                return Promise.resolve(null);
+            }
+            if (!ProxyPopupForms.proofs[challenge]) {
+                var difficulty = Number(popup.getAttribute('data-pow-difficulty')) || 0;
+                ProxyPopupForms.proofs[challenge] = ProxyPopupForms.solve(challenge, difficulty);
+            }
+            return ProxyPopupForms.proofs[challenge];
+        },
+        
+        // 查找使 SHA-256(challenge + ':' + nonce) 至少有 difficulty 个前导零比特的 nonce，分批计算避免阻塞页面
+        solve: function(challenge, difficulty) {
+            return new Promise(function(resolve) {
+                var nonce = 0;
+                var run = function() {
+                    for (var end = nonce + 5000; nonce < end; nonce++) {
+                        if (ProxyPopupForms.zeroBits(ProxyPopupForms.sha256(challenge + ':' + nonce), difficulty)) {
+                            resolve(String(nonce));
+                            return;
+                        }
+                    }
+                    setTimeout(run, 0);
+                };
+                run();
+            });
+        },
+        
+        zeroBits: function(words, count) {
+            for (var i = 0; i < words.length && count > 0; i++, count -= 32) {
+                var word = words[i] >>> 0;
+                if (count >= 32 ? word !== 0 : (word >>> (32 - count)) !== 0) {
+                    return false;
+                }
+            }
+            return true;
+        },
+        
+        // 计算 ASCII 字符串的 SHA-256，返回8个32位整数，非安全上下文中没有 crypto.subtle
+        sha256: function(message) {
+            var k = [
+                0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+                0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+                0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+                0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+                0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+                0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+                0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+                0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2
+            ];
+            var h = [0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19];
+            var ror = function(x, n) {
+                return (x >>> n) | (x << (32 - n));
+            };
+            var bytes = [];
+            for (var i = 0; i < message.length; i++) {
+                bytes.push(message.charCodeAt(i) & 0xff);
+            }
+            var bitLength = bytes.length * 8;
+            bytes.push(0x80);
+            while (bytes.length %% 64 !== 56) {
+                bytes.push(0);
+            }
+            bytes.push(0, 0, 0, 0, (bitLength >>> 24) & 0xff, (bitLength >>> 16) & 0xff, (bitLength >>> 8) & 0xff, bitLength & 0xff);
+            var w = new Array(64);
+            for (var offset = 0; offset < bytes.length; offset += 64) {
+                var t;
+                for (t = 0; t < 16; t++) {
+                    var j = offset + t * 4;
+                    w[t] = (bytes[j] << 24) | (bytes[j + 1] << 16) | (bytes[j + 2] << 8) | bytes[j + 3];
+                }
+                for (t = 16; t < 64; t++) {
+                    var s0 = ror(w[t - 15], 7) ^ ror(w[t - 15], 18) ^ (w[t - 15] >>> 3);
+                    var s1 = ror(w[t - 2], 17) ^ ror(w[t - 2], 19) ^ (w[t - 2] >>> 10);
+                    w[t] = (w[t - 16] + s0 + w[t - 7] + s1) | 0;
+                }
+                var a = h[0], b = h[1], c = h[2], d = h[3], e = h[4], f = h[5], g = h[6], hh = h[7];
+                for (t = 0; t < 64; t++) {
+                    var t1 = (hh + (ror(e, 6) ^ ror(e, 11) ^ ror(e, 25)) + ((e & f) ^ (~e & g)) + k[t] + w[t]) | 0;
+                    var t2 = ((ror(a, 2) ^ ror(a, 13) ^ ror(a, 22)) + ((a & b) ^ (a & c) ^ (b & c))) | 0;
+                    hh = g;
+                    g = f;
+                    f = e;
+                    e = (d + t1) | 0;
+                    d = c;
+                    c = b;
+                    b = a;
+                    a = (t1 + t2) | 0;
+                }
+                h[0] = (h[0] + a) | 0;
+                h[1] = (h[1] + b) | 0;
+                h[2] = (h[2] + c) | 0;
+                h[3] = (h[3] + d) | 0;
+                h[4] = (h[4] + e) | 0;
+                h[5] = (h[5] + f) | 0;
+                h[6] = (h[6] + g) | 0;
+                h[7] = (h[7] + hh) | 0;
+            }
+            return h;
+        },
+        
+        // 从数据面加载新的图片验证码并清空答案
+        loadCaptcha: function(captcha) {
+            var input = captcha.querySelector('[data-pe-captcha]');
+            input.value = '';
+            fetch(window.PROXY_CONFIG.captchaEndpoint, { credentials: 'same-origin', cache: 'no-store' }).then(function(response) {
+                return response.json();
+            }).then(function(result) {
+                if (result && result.success && result.data) {
+                    captcha.setAttribute('data-captcha-id', result.data.captchaId);
+                    captcha.querySelector('.pe-captcha-image').src = result.data.captchaImage;
                 }
+            }).catch(function(error) {
+                console.error('Error loading captcha:', error);
+            });
+        },
+        
+        // 表单完成后记录转化，配置了提交地址时另外发送完整数据，显示成功提示或关闭弹窗
+        finish: function(popupId, form) {
+            ProxyPopupManager.track(popupId, 'submit');
+            var submitURL = form.getAttribute('data-submit-url');
+            if (submitURL) {
+                ProxyDataCollector.submitData(ProxyPopupForms.values(form), submitURL);
+            }
+            var success = form.querySelector('.pe-form-success');
+            if (!success) {
+                ProxyPopupManager.hide(popupId);
+                return;
+            }
+            Array.prototype.forEach.call(form.children, function(child) {
+                ProxyPopupForms.toggle(child, child === success);
+            });
+        },
+        
+        showError: function(form, message) {
+            var error = form.querySelector('.pe-form-error');
+            if (error) {
+                error.textContent = message;
+                ProxyPopupForms.toggle(error, !!message);
+            }
+        },
+        
+        toggle: function(element, visible) {
+            if (visible) {
+                element.removeAttribute('hidden');
+            } else {
+                element.setAttribute('hidden', '');
             }
         }
     };
@@ -131,6 +824,10 @@ func (ap *AssetsProvider) GetJavaScript(proxyConfig *models.ProxyConfig) string
         },
         
         submitData: function(data, endpoint) {
+            // 弹窗内的提交记录提交耗时
+            if (data && data.popup_id) {
+                ProxyPopupManager.track(data.popup_id, 'submit');
+            }
             fetch(endpoint, {
                 method: 'POST',
                 headers: {
@@ -147,7 +844,204 @@ func (ap *AssetsProvider) GetJavaScript(proxyConfig *models.ProxyConfig) string
         }
     };
     
+    // 弹窗触发器，按弹窗元素的 data-trigger-* 属性绑定，触发方式见 popupspec.TriggerTypes
+    window.ProxyPopupTriggers = {
+        pendingCookieName: '%s',
+        dataPlanePrefix: '%s',
+        apiCalls: [],
+        
+        init: function() {
+            var popups = document.querySelectorAll('.proxy-popup[data-popup-id]');
+            for (var i = 0; i < popups.length; i++) {
+                ProxyPopupTriggers.bind(popups[i]);
+            }
+            ProxyPopupTriggers.openPending();
+        },
+        
+        bind: function(popup) {
+            var popupId = popup.getAttribute('data-popup-id');
+            var value = popup.getAttribute('data-trigger-value') || '';
+            var show = function() {
+                return ProxyPopupManager.show(popupId);
+            };
+            switch (popup.getAttribute('data-trigger-type') || 'page_load') {
+                case 'page_load':
+                    show();
+                    break;
+                case 'time_delay':
+                    setTimeout(show, (parseFloat(value) || 0) * 1000);
+                    break;
+                case 'scroll_percentage':
+                    var onScroll = function() {
+                        var scrollable = document.documentElement.scrollHeight - window.innerHeight;
+                        var percentage = scrollable > 0 ? window.scrollY / scrollable * 100 : 100;
+                        if (percentage >= (parseFloat(value) || 0)) {
+                            window.removeEventListener('scroll', onScroll);
+                            show();
+                        }
+                    };
+                    window.addEventListener('scroll', onScroll, { passive: true });
+                    onScroll();
+                    break;
+                case 'element_click':
+                    document.addEventListener('click', function(event) {
+                        if (ProxyPopupTriggers.closest(event.target, value)) {
+                            show();
+                        }
+                    }, true);
+                    break;
+                case 'exit_intent':
+                    var onLeave = function(event) {
+                        if (!event.relatedTarget && event.clientY <= 0) {
+                            document.removeEventListener('mouseout', onLeave);
+                            show();
+                        }
+                    };
+                    document.addEventListener('mouseout', onLeave);
+                    break;
+                case 'form_submit':
+                    document.addEventListener('submit', function(event) {
+                        var form = event.target;
+                        if (!ProxyPopupTriggers.closest(form, '.proxy-popup') && ProxyPopupTriggers.closest(form, value || 'form')) {
+                            show();
+                        }
+                    }, true);
+                    break;
+                case 'api_call':
+                    try {
+                        var config = JSON.parse(popup.getAttribute('data-trigger-config') || '{}');
+                        if (config.url_pattern) {
+                            ProxyPopupTriggers.apiCalls.push({
+                                popupId: popupId,
+                                config: config,
+                                pattern: ProxyPopupTriggers.globToRegExp(config.url_pattern)
+                            });
+                        }
+                    } catch (error) {
+                        console.error('Invalid api_call trigger:', error);
+                    }
+                    break;
+            }
+        },
+        
+        // 无效的选择器视为不匹配
+        closest: function(element, selector) {
+            try {
+                return element && element.closest ? element.closest(selector) : null;
+            } catch (error) {
+                return null;
+            }
+        },
+        
+        // * 匹配任意字符，与服务端 popupspec.APICallTrigger 的匹配规则一致
+        globToRegExp: function(pattern) {
+            return new RegExp('^' + pattern.split('*').map(function(part) {
+                return part.replace(/[.+?^${}()|[\]\\]/g, '\\$&');
+            }).join('.*') + '$');
+        },
+        
+        // 页面的 fetch/XHR 请求完成后匹配接口调用触发条件，忽略本代理的数据面请求
+        onAPICall: function(method, url, status) {
+            if (!status || !ProxyPopupTriggers.apiCalls.length) {
+                return;
+            }
+            var target;
+            try {
+                target = new URL(url, location.href);
+            } catch (error) {
+                return;
+            }
+            if (target.origin === location.origin && target.pathname.indexOf(ProxyPopupTriggers.dataPlanePrefix) === 0) {
+                return;
+            }
+            method = String(method || 'GET').toUpperCase();
+            var code = String(status);
+            ProxyPopupTriggers.apiCalls.forEach(function(trigger) {
+                var config = trigger.config;
+                if (config.methods && config.methods.length && config.methods.indexOf(method) < 0) {
+                    return;
+                }
+                if (config.statuses && config.statuses.length && !config.statuses.some(function(pattern) {
+                    return pattern === code || (/xx$/.test(pattern) && pattern.charAt(0) === code.charAt(0));
+                })) {
+                    return;
+                }
+                var value = target.href.split('#')[0];
+                if (config.url_pattern.charAt(0) === '/') {
+                    value = target.pathname + (config.url_pattern.indexOf('?') >= 0 ? target.search : '');
+                }
+                if (trigger.pattern.test(value)) {
+                    ProxyPopupManager.show(trigger.popupId);
+                }
+            });
+        },
+        
+        hookFetch: function() {
+            if (!window.fetch) {
+                return;
+            }
+            var originalFetch = window.fetch;
+            window.fetch = function(input, init) {
+                var request = typeof Request !== 'undefined' && input instanceof Request ? input : null;
+                var method = (init && init.method) || (request ? request.method : 'GET');
+                var url = request ? request.url : String(input);
+                return originalFetch.apply(this, arguments).then(function(response) {
+                    ProxyPopupTriggers.onAPICall(method, url, response.status);
+                    return response;
+                });
+            };
+        },
+        
+        hookXHR: function() {
+            if (!window.XMLHttpRequest) {
+                return;
+            }
+            var proto = XMLHttpRequest.prototype;
+            var originalOpen = proto.open;
+            var originalSend = proto.send;
+            proto.open = function(method, url) {
+                this.__peRequest = { method: method, url: url };
+                return originalOpen.apply(this, arguments);
+            };
+            proto.send = function() {
+                var xhr = this;
+                var request = xhr.__peRequest;
+                if (request) {
+                    xhr.addEventListener('loadend', function() {
+                        ProxyPopupTriggers.onAPICall(request.method, request.url, xhr.status);
+                    });
+                }
+                return originalSend.apply(this, arguments);
+            };
+        },
+        
+        // 打开经代理转发的请求匹配接口调用触发条件时标记的弹窗
+        openPending: function() {
+            var match = document.cookie.match(new RegExp('(?:^|; )' + ProxyPopupTriggers.pendingCookieName + '=([^;]*)'));
+            if (!match) {
+                return;
+            }
+            document.cookie = ProxyPopupTriggers.pendingCookieName + '=; path=/; max-age=0';
+            match[1].split('.').forEach(function(popupId) {
+                if (popupId) {
+                    ProxyPopupManager.show(popupId);
+                }
+            });
+        }
+    };
+    
+    // 尽早拦截请求，页面脚本可能在弹窗元素解析完成前保存 fetch 的引用
+    ProxyPopupTriggers.hookFetch();
+    ProxyPopupTriggers.hookXHR();
+    if (document.readyState === 'loading') {
+        document.addEventListener('DOMContentLoaded', ProxyPopupTriggers.init);
+    } else {
+        ProxyPopupTriggers.init();
+    }
+    
     console.log('Proxy enhancer loaded for domain:', window.PROXY_CONFIG.domain);
 })();
-`, proxyConfig.ProxyDomain, proxyConfig.ID)
+`, proxyConfig.ProxyDomain, proxyConfig.ID, EventsEndpointPath, FormsEndpointPath, CaptchaEndpointPath, UploadsEndpointPath,
+		popupspec.StateCookieName, popupspec.StateCookieMaxAge, int(popupspec.SessionTimeout/time.Second), popupspec.MaxTrackedPopups,
+		PendingTriggerCookieName, DataPlanePrefix)
 }
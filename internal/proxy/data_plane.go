@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"proxy-enhancer-ultra/internal/models"
+)
+
+// 数据面端点
+const (
+	DataPlanePrefix     = "/__pe/"                    // 代理域名下保留的路径前缀，不转发到目标站点
+	EventsEndpointPath  = DataPlanePrefix + "events"  // 弹窗事件上报端点
+	FormsEndpointPath   = DataPlanePrefix + "forms"   // 弹窗表单分步提交端点
+	CaptchaEndpointPath = DataPlanePrefix + "captcha" // 弹窗表单图片验证码端点
+	UploadsEndpointPath = DataPlanePrefix + "uploads" // 弹窗表单文件上传端点
+)
+
+// proxyConfigKey 请求上下文中代理配置的键
+type proxyConfigKey struct{}
+
+// Handle 注册数据面处理器，pattern 必须以 DataPlanePrefix 开头
+// 处理器收到的请求已识别访客，并可通过 ProxyConfigFromRequest 获取当前代理配置
+func (p *ProxyServer) Handle(pattern string, handler http.Handler) {
+	if !strings.HasPrefix(pattern, DataPlanePrefix) {
+		panic("proxy: data plane pattern must start with " + DataPlanePrefix)
+	}
+	p.dataPlane.Handle(pattern, handler)
+}
+
+// isDataPlaneRequest 判断请求是否访问数据面端点
+func isDataPlaneRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, DataPlanePrefix)
+}
+
+// withProxyConfig 返回在上下文中携带代理配置的请求
+func withProxyConfig(r *http.Request, proxyConfig *models.ProxyConfig) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), proxyConfigKey{}, proxyConfig))
+}
+
+// ProxyConfigFromRequest 返回数据面请求所属的代理配置，不存在时返回nil
+func ProxyConfigFromRequest(r *http.Request) *models.ProxyConfig {
+	proxyConfig, _ := r.Context().Value(proxyConfigKey{}).(*models.ProxyConfig)
+	return proxyConfig
+}
@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxDiffTextLength 差异中文本节点的最大显示长度
+const maxDiffTextLength = 80
+
+// maxDiffEdits 结构差异的最大编辑步数，超过后放弃计算以限制内存占用
+const maxDiffEdits = 1000
+
+// DiffEntry HTML结构差异项
+type DiffEntry struct {
+	Op    string `json:"op"`    // insert 或 delete
+	Path  string `json:"path"`  // 节点路径（删除项为原文档路径，新增项为新文档路径）
+	Depth int    `json:"depth"` // 节点深度
+	Node  string `json:"node"`  // 节点签名
+}
+
+// outlineLine 文档大纲中的一行，对应一个节点
+type outlineLine struct {
+	key  string
+	path string
+	sig  string
+	dep  int
+}
+
+// DiffHTML 比较两个文档的结构，返回节点级别的差异；差异过大时第二个返回值为false
+func DiffHTML(original, transformed *html.Node) ([]DiffEntry, bool) {
+	a := buildOutline(original)
+	b := buildOutline(transformed)
+
+	ops, ok := myersDiff(a, b)
+	if !ok {
+		return []DiffEntry{}, false
+	}
+
+	diff := []DiffEntry{}
+	for _, op := range ops {
+		var line outlineLine
+		if op.insert {
+			line = b[op.index]
+		} else {
+			line = a[op.index]
+		}
+		entry := DiffEntry{Path: line.path, Depth: line.dep, Node: line.sig}
+		if op.insert {
+			entry.Op = "insert"
+		} else {
+			entry.Op = "delete"
+		}
+		diff = append(diff, entry)
+	}
+
+	return diff, true
+}
+
+// buildOutline 将文档展开为按深度缩进的节点签名序列
+func buildOutline(doc *html.Node) []outlineLine {
+	var lines []outlineLine
+	var walk func(node *html.Node, depth int)
+	walk = func(node *html.Node, depth int) {
+		if sig := nodeSignature(node); sig != "" {
+			path := NodePath(node)
+			if node.Type != html.ElementNode && node.Parent != nil {
+				path = NodePath(node.Parent) + ">" + sig
+			}
+			lines = append(lines, outlineLine{
+				key:  fmt.Sprintf("%d|%s", depth, sig),
+				path: path,
+				sig:  sig,
+				dep:  depth,
+			})
+			depth++
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child, depth)
+		}
+	}
+	walk(doc, 0)
+	return lines
+}
+
+// nodeSignature 生成节点签名，忽略纯空白文本
+func nodeSignature(node *html.Node) string {
+	switch node.Type {
+	case html.ElementNode:
+		attrs := make([]string, 0, len(node.Attr))
+		for _, attr := range node.Attr {
+			attrs = append(attrs, fmt.Sprintf("%s=%q", attr.Key, attr.Val))
+		}
+		sort.Strings(attrs)
+		if len(attrs) == 0 {
+			return "<" + node.Data + ">"
+		}
+		return "<" + node.Data + " " + strings.Join(attrs, " ") + ">"
+	case html.TextNode, html.RawNode:
+		text := strings.Join(strings.Fields(node.Data), " ")
+		if text == "" {
+			return ""
+		}
+		if len(text) > maxDiffTextLength {
+			text = text[:maxDiffTextLength] + "..."
+		}
+		return "#text " + text
+	case html.CommentNode:
+		return "<!--" + strings.TrimSpace(node.Data) + "-->"
+	default:
+		return ""
+	}
+}
+
+// diffOp 编辑脚本中的一步
+type diffOp struct {
+	insert bool
+	index  int
+}
+
+// myersDiff 使用Myers算法计算从a到b的最短编辑脚本
+func myersDiff(a, b []outlineLine) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil, true
+	}
+
+	offset := max
+	v := make([]int, 2*max+2)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		if d > maxDiffEdits {
+			return nil, false
+		}
+		// 只保存本轮会读取的对角线区间[-d, d]，使内存占用为O(D²)
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x].key == b[y].key {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(trace, a, b, d), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// backtrackDiff 回溯Myers算法的轨迹，生成按文档顺序排列的编辑操作
+func backtrackDiff(trace [][]int, a, b []outlineLine, depth int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+
+	for d := depth; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+
+		if x == prevX {
+			ops = append(ops, diffOp{insert: true, index: prevY})
+		} else {
+			ops = append(ops, diffOp{insert: false, index: prevX})
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
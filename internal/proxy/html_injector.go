@@ -3,10 +3,17 @@ package proxy
 import (
 	"bytes"
 	"fmt"
+	"net/http"
+	"strconv"
+	"time"
 
+	"proxy-enhancer-ultra/internal/formguard"
 	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+	"proxy-enhancer-ultra/internal/ruledsl"
 	"proxy-enhancer-ultra/pkg/logger"
 
+	"github.com/google/uuid"
 	"golang.org/x/net/html"
 	"gorm.io/gorm"
 )
@@ -17,6 +24,12 @@ type HTMLInjector struct {
 	logger         logger.Logger
 	htmlParser     *HTMLParser
 	assetsProvider *AssetsProvider
+	ruleEngine     *RuleEngine
+
+	// 表单防垃圾提交设置，formSigner 为nil时不签发表单令牌
+	formSigner    *formguard.Signer
+	minFillTime   time.Duration
+	powDifficulty int
 }
 
 // NewHTMLInjector 创建新的HTML注入器
@@ -26,19 +39,34 @@ func NewHTMLInjector(db *gorm.DB, logger logger.Logger) *HTMLInjector {
 		logger:         logger,
 		htmlParser:     NewHTMLParser(),
 		assetsProvider: NewAssetsProvider(),
+		ruleEngine:     NewRuleEngine(),
 	}
 }
 
-// ProcessHTML 处理HTML内容
-func (hi *HTMLInjector) ProcessHTML(body []byte, proxyConfig *models.ProxyConfig, urlRewriter *URLRewriter) ([]byte, error) {
+// ProcessHTML 处理HTML内容，r 为客户端的原始请求，用于判断规则触发条件
+// trace 不为nil时记录规则执行追踪
+func (hi *HTMLInjector) ProcessHTML(body []byte, proxyConfig *models.ProxyConfig, urlRewriter *URLRewriter, r *http.Request, trace *ExecutionTrace) ([]byte, error) {
 	// 解析HTML
 	doc, err := html.Parse(bytes.NewReader(body))
 	if err != nil {
 		return body, err
 	}
 
+	// 应用满足触发条件的内容规则
+	rules, err := hi.loadActiveRules(proxyConfig)
+	if err != nil {
+		trace.AddError(err)
+	}
+	start := time.Now()
+	applications := hi.ruleEngine.Execute(doc, rules, ruledsl.NewContext(r, start))
+	hi.logRuleErrors(proxyConfig, applications)
+	if trace != nil {
+		trace.Rules = applications
+		trace.RulesDurationUS = time.Since(start).Microseconds()
+	}
+
 	// 注入自定义内容
-	hi.injectCustomContent(doc, proxyConfig)
+	hi.injectCustomContent(doc, proxyConfig, r)
 
 	// 修改链接和资源路径
 	urlRewriter.RewriteURLs(doc, proxyConfig)
@@ -52,8 +80,8 @@ func (hi *HTMLInjector) ProcessHTML(body []byte, proxyConfig *models.ProxyConfig
 	return buf.Bytes(), nil
 }
 
-// injectCustomContent 注入自定义内容
-func (hi *HTMLInjector) injectCustomContent(doc *html.Node, proxyConfig *models.ProxyConfig) {
+// injectCustomContent 注入自定义内容，r 用于识别访客、分配弹窗变体和判断展示规则
+func (hi *HTMLInjector) injectCustomContent(doc *html.Node, proxyConfig *models.ProxyConfig, r *http.Request) {
 	// 查找head标签
 	headNode := hi.htmlParser.FindNode(doc, "head")
 	if headNode == nil {
@@ -70,7 +98,7 @@ func (hi *HTMLInjector) injectCustomContent(doc *html.Node, proxyConfig *models.
 	}
 
 	// 注入弹窗和交互功能
-	hi.injectInteractiveElements(bodyNode, proxyConfig)
+	hi.injectInteractiveElements(bodyNode, proxyConfig, r)
 }
 
 // injectBaseAssets 注入基础资源
@@ -103,42 +131,346 @@ func (hi *HTMLInjector) injectBaseAssets(headNode *html.Node, proxyConfig *model
 }
 
 // injectInteractiveElements 注入交互元素
-func (hi *HTMLInjector) injectInteractiveElements(bodyNode *html.Node, proxyConfig *models.ProxyConfig) {
+func (hi *HTMLInjector) injectInteractiveElements(bodyNode *html.Node, proxyConfig *models.ProxyConfig, r *http.Request) {
 	// 如果没有数据库连接，跳过弹窗注入
 	if hi.db == nil {
 		return
 	}
 
-	// 获取该代理配置的弹窗规则
-	var popups []models.Popup
-	hi.db.Where("proxy_config_id = ? AND enabled = ?", proxyConfig.ID, true).Find(&popups)
+	// 获取对该代理配置生效且在投放时间内的弹窗，包括全局弹窗
+	now := time.Now()
+	var popups []*models.Popup
+	bound := hi.db.Model(&models.PopupProxyConfig{}).Select("popup_id").Where("proxy_config_id = ?", proxyConfig.ID)
+	if err := hi.db.Preload("Variants", "is_active = ?", true).Preload("Translations").
+		Where("is_active = ? AND (is_global = ? OR id IN (?))", true, true, bound).
+		Where("(start_at IS NULL OR start_at <= ?) AND (end_at IS NULL OR end_at > ?)", now, now).
+		Order("created_at ASC").Find(&popups).Error; err != nil {
+		hi.logger.WithFields(map[string]interface{}{
+			"proxy_config_id": proxyConfig.ID,
+			"error":           err.Error(),
+		}).Error("Failed to load popups")
+		return
+	}
+
+	// 跳过访客已达到频率限制或不属于目标受众的弹窗，页面脚本展示前会再次判断
+	visitorID := VisitorID(r)
+	popups = hi.filterScheduled(popups, now)
+	state := popupspec.VisitorStateFromRequest(r, now)
+	displayRules := hi.parseDisplayRules(popups)
+	hi.markSubmittedPopups(state, visitorID, popups, displayRules)
+
+	// 按访客分配变体并选择访客语言的翻译，展示、关闭、点击等事件由页面脚本上报到数据面
+	locales := popupspec.RequestLocales(r)
+	for i, popup := range popups {
+		if allowed, reason := displayRules[i].Allows(popup.ID.String(), state); !allowed {
+			hi.logger.WithFields(map[string]interface{}{
+				"popup_id": popup.ID,
+				"reason":   reason,
+			}).Debug("Popup skipped by display rules")
+			continue
+		}
+		variant := AssignVariant(popup, visitorID)
+		rendered := ApplyTranslation(ApplyVariant(popup, variant), SelectTranslation(popup, locales))
+		container := hi.createPopupElement(rendered, variant)
+		container.Attr = append(container.Attr, hi.formGuardAttrs(rendered, visitorID, now)...)
+		bodyNode.AppendChild(container)
+	}
+}
+
+// formGuardAttrs 为带表单的弹窗签发表单令牌，返回页面脚本提交时使用的属性
+// 令牌绑定弹窗和访客，记录签发时间用于判断最短填写时间，表单使用工作量证明时包含题目
+func (hi *HTMLInjector) formGuardAttrs(popup *models.Popup, visitorID string, now time.Time) []html.Attribute {
+	if hi.formSigner == nil {
+		return nil
+	}
+	form, err := popupspec.ParseFormConfig(popup.FormConfig)
+	if err != nil || form.IsZero() {
+		return nil
+	}
+
+	claims := formguard.Claims{
+		PopupID:   popup.ID.String(),
+		VisitorID: visitorID,
+		IssuedAt:  now.UnixMilli(),
+	}
+	if form.Captcha == popupspec.CaptchaProofOfWork {
+		claims.Challenge = formguard.NewChallenge()
+		claims.Difficulty = hi.powDifficulty
+	}
+
+	attrs := []html.Attribute{
+		{Key: "data-form-token", Val: hi.formSigner.Issue(claims)},
+		{Key: "data-min-fill", Val: strconv.FormatInt(hi.minFillTime.Milliseconds(), 10)},
+	}
+	if claims.Challenge != "" {
+		attrs = append(attrs,
+			html.Attribute{Key: "data-pow-challenge", Val: claims.Challenge},
+			html.Attribute{Key: "data-pow-difficulty", Val: strconv.Itoa(claims.Difficulty)},
+		)
+	}
+	return attrs
+}
+
+// filterScheduled 过滤不在每周投放时段内的弹窗，排期无效时不投放
+func (hi *HTMLInjector) filterScheduled(popups []*models.Popup, now time.Time) []*models.Popup {
+	result := popups[:0]
+	for _, popup := range popups {
+		schedule, err := popupspec.NewSchedule(popup.StartAt, popup.EndAt, popup.Timezone, popup.WeeklySchedule)
+		if err != nil {
+			hi.logger.WithFields(map[string]interface{}{
+				"popup_id": popup.ID,
+				"error":    err.Error(),
+			}).Warn("Skipping popup with invalid schedule")
+			continue
+		}
+		if schedule.ActiveAt(now) {
+			result = append(result, popup)
+		}
+	}
+	return result
+}
+
+// parseDisplayRules 解析弹窗的展示规则，规则无效时不限制
+func (hi *HTMLInjector) parseDisplayRules(popups []*models.Popup) []*popupspec.DisplayRules {
+	result := make([]*popupspec.DisplayRules, len(popups))
+	for i, popup := range popups {
+		rules, err := popupspec.ParseDisplayRules(popup.DisplayRules)
+		if err != nil {
+			hi.logger.WithFields(map[string]interface{}{
+				"popup_id": popup.ID,
+				"error":    err.Error(),
+			}).Warn("Ignoring invalid popup display rules")
+			rules = &popupspec.DisplayRules{}
+		}
+		result[i] = rules
+	}
+	return result
+}
+
+// markSubmittedPopups 根据提交记录标记访客已提交的弹窗，访客清除Cookie后“提交后不再展示”仍然生效
+func (hi *HTMLInjector) markSubmittedPopups(state *popupspec.VisitorState, visitorID string, popups []*models.Popup, displayRules []*popupspec.DisplayRules) {
+	if visitorID == "" {
+		return
+	}
+
+	var popupIDs []uuid.UUID
+	for i, popup := range popups {
+		if displayRules[i].Frequency.StopAfterSubmit {
+			popupIDs = append(popupIDs, popup.ID)
+		}
+	}
+	if len(popupIDs) == 0 {
+		return
+	}
 
+	var submitted []uuid.UUID
+	if err := hi.db.Model(&models.Submission{}).Distinct("popup_id").
+		Where("visitor_id = ? AND popup_id IN ? AND is_partial = ?", visitorID, popupIDs, false).
+		Pluck("popup_id", &submitted).Error; err != nil {
+		hi.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Warn("Failed to check visitor submissions")
+		return
+	}
+
+	for _, popupID := range submitted {
+		key := popupID.String()
+		if state.Popups == nil {
+			state.Popups = make(map[string]*popupspec.PopupState)
+		}
+		if state.Popups[key] == nil {
+			state.Popups[key] = &popupspec.PopupState{}
+		}
+		state.Popups[key].Submitted = true
+	}
+}
+
+// injectPopups 将弹窗元素追加到body中
+func (hi *HTMLInjector) injectPopups(bodyNode *html.Node, popups []*models.Popup) {
 	for _, popup := range popups {
 		// 创建弹窗容器
-		popupContainer := hi.createPopupElement(&popup)
+		popupContainer := hi.createPopupElement(popup, nil)
 		bodyNode.AppendChild(popupContainer)
 	}
 }
 
-// createPopupElement 创建弹窗元素
-func (hi *HTMLInjector) createPopupElement(popup *models.Popup) *html.Node {
+// Transform 将指定的规则和弹窗应用到文档，不读取数据库，供试运行和预览使用
+func (hi *HTMLInjector) Transform(doc *html.Node, rules []*models.Rule, popups []*models.Popup, evalCtx *ruledsl.Context) []RuleApplication {
+	applications := hi.ruleEngine.Apply(doc, rules, evalCtx)
+
+	if len(popups) > 0 {
+		if bodyNode := hi.htmlParser.FindNode(doc, "body"); bodyNode != nil {
+			hi.injectPopups(bodyNode, popups)
+		}
+	}
+
+	return applications
+}
+
+// InjectAssets 注入基础样式和脚本
+func (hi *HTMLInjector) InjectAssets(doc *html.Node, proxyConfig *models.ProxyConfig) {
+	if headNode := hi.htmlParser.FindNode(doc, "head"); headNode != nil {
+		hi.injectBaseAssets(headNode, proxyConfig)
+	}
+}
+
+// loadActiveRules 加载对该代理配置生效的启用规则（包括全局规则），按优先级排序
+func (hi *HTMLInjector) loadActiveRules(proxyConfig *models.ProxyConfig) ([]*models.Rule, error) {
+	if hi.db == nil {
+		return nil, nil
+	}
+
+	var rules []*models.Rule
+	bound := hi.db.Model(&models.RuleProxyConfig{}).Select("rule_id").Where("proxy_config_id = ?", proxyConfig.ID)
+	if err := hi.db.Where("is_active = ? AND (is_global = ? OR id IN (?))", true, true, bound).Order("priority ASC").Find(&rules).Error; err != nil {
+		hi.logger.WithFields(map[string]interface{}{
+			"proxy_config_id": proxyConfig.ID,
+			"error":           err.Error(),
+		}).Error("Failed to load active rules")
+		return nil, fmt.Errorf("failed to load active rules: %w", err)
+	}
+	return rules, nil
+}
+
+// logRuleErrors 记录执行失败的规则
+func (hi *HTMLInjector) logRuleErrors(proxyConfig *models.ProxyConfig, applications []RuleApplication) {
+	for _, application := range applications {
+		if application.Error == "" {
+			continue
+		}
+		hi.logger.WithFields(map[string]interface{}{
+			"proxy_config_id": proxyConfig.ID,
+			"rule_id":         application.RuleID,
+			"error":           application.Error,
+		}).Warn("Failed to apply rule")
+	}
+}
+
+// RenderPopup 渲染单个弹窗的HTML片段，variant 不为nil时使用变体内容，translation 不为nil时使用翻译文字
+func (hi *HTMLInjector) RenderPopup(popup *models.Popup, variant *models.PopupVariant, translation *models.PopupTranslation) (string, error) {
+	return renderHTML(hi.createPopupElement(ApplyTranslation(ApplyVariant(popup, variant), translation), variant))
+}
+
+// popupTriggerAttrs 返回页面脚本绑定触发方式使用的属性，接口调用触发条件无效时不会被触发
+func popupTriggerAttrs(popup *models.Popup) []html.Attribute {
+	triggerType := popup.TriggerType
+	if triggerType == "" {
+		triggerType = popupspec.TriggerPageLoad
+	}
+	attrs := []html.Attribute{{Key: "data-trigger-type", Val: triggerType}}
+	if popup.TriggerValue != "" {
+		attrs = append(attrs, html.Attribute{Key: "data-trigger-value", Val: popup.TriggerValue})
+	}
+	if triggerType == popupspec.TriggerAPICall {
+		if trigger, err := popupspec.ParseAPICallTrigger(popup.TriggerConfig); err == nil {
+			if data, err := trigger.Marshal(); err == nil {
+				attrs = append(attrs, html.Attribute{Key: "data-trigger-config", Val: data})
+			}
+		}
+	}
+	return attrs
+}
+
+// createPopupElement 创建弹窗元素，variant 不为nil时标记展示的变体
+func (hi *HTMLInjector) createPopupElement(popup *models.Popup, variant *models.PopupVariant) *html.Node {
 	// 创建弹窗容器
 	container := &html.Node{
 		Type: html.ElementNode,
 		Data: "div",
 		Attr: []html.Attribute{
-			{Key: "id", Val: fmt.Sprintf("popup-%d", popup.ID)},
+			{Key: "id", Val: fmt.Sprintf("popup-%s", popup.ID)},
 			{Key: "class", Val: "proxy-popup"},
-			{Key: "style", Val: "display: none;"},
+			{Key: "data-popup-id", Val: popup.ID.String()},
+		},
+	}
+	if variant != nil {
+		container.Attr = append(container.Attr, html.Attribute{Key: "data-variant-id", Val: variant.ID.String()})
+	}
+	if popup.DefaultLocale != "" {
+		container.Attr = append(container.Attr, html.Attribute{Key: "data-locale", Val: popup.DefaultLocale})
+	}
+	if rules, err := popupspec.ParseDisplayRules(popup.DisplayRules); err == nil && !rules.IsZero() {
+		if data, err := rules.Marshal(); err == nil {
+			container.Attr = append(container.Attr, html.Attribute{Key: "data-display-rules", Val: data})
+		}
+	}
+	container.Attr = append(container.Attr, popupTriggerAttrs(popup)...)
+
+	// 弹窗内容放在模板中，页面脚本展示前挂载到 Shadow DOM
+	container.AppendChild(hi.createPopupTemplate(popup))
+
+	return container
+}
+
+// createPopupTemplate 创建弹窗的 Shadow DOM 模板，包含编译后的样式、遮罩层、关闭按钮、弹窗内容和配置的表单
+func (hi *HTMLInjector) createPopupTemplate(popup *models.Popup) *html.Node {
+	style, err := popupspec.ParseStyleConfig(popup.StyleConfig)
+	if err != nil {
+		hi.logger.WithFields(map[string]interface{}{
+			"popup_id": popup.ID,
+			"error":    err.Error(),
+		}).Warn("Ignoring invalid popup style config")
+		style = &popupspec.StyleConfig{}
+	}
+
+	template := &html.Node{
+		Type: html.ElementNode,
+		Data: "template",
+		Attr: []html.Attribute{{Key: "data-pe-shadow", Val: ""}},
+	}
+
+	styleNode := &html.Node{Type: html.ElementNode, Data: "style"}
+	styleNode.AppendChild(&html.Node{Type: html.TextNode, Data: style.CSS()})
+	template.AppendChild(styleNode)
+
+	dialogAttrs := []html.Attribute{
+		{Key: "class", Val: "pe-popup"},
+		{Key: "part", Val: "popup"},
+		{Key: "role", Val: "dialog"},
+		{Key: "aria-label", Val: popup.Title},
+	}
+	if popup.DefaultLocale != "" {
+		dialogAttrs = append(dialogAttrs, html.Attribute{Key: "lang", Val: popup.DefaultLocale})
+	}
+	if !style.HideOverlay {
+		template.AppendChild(&html.Node{
+			Type: html.ElementNode,
+			Data: "div",
+			Attr: []html.Attribute{{Key: "class", Val: "pe-overlay"}, {Key: "part", Val: "overlay"}},
+		})
+		dialogAttrs = append(dialogAttrs, html.Attribute{Key: "aria-modal", Val: "true"})
+	}
+	dialog := &html.Node{Type: html.ElementNode, Data: "div", Attr: dialogAttrs}
+	template.AppendChild(dialog)
+
+	closeButton := &html.Node{
+		Type: html.ElementNode,
+		Data: "button",
+		Attr: []html.Attribute{
+			{Key: "type", Val: "button"},
+			{Key: "class", Val: "pe-close"},
+			{Key: "part", Val: "close"},
+			{Key: "aria-label", Val: "Close"},
 		},
 	}
+	closeButton.AppendChild(&html.Node{Type: html.TextNode, Data: "×"})
+	dialog.AppendChild(closeButton)
 
-	// 添加弹窗内容
 	content := &html.Node{
-		Type: html.RawNode,
-		Data: popup.Content,
+		Type: html.ElementNode,
+		Data: "div",
+		Attr: []html.Attribute{{Key: "class", Val: "pe-content"}, {Key: "part", Val: "content"}},
 	}
-	container.AppendChild(content)
+	content.AppendChild(&html.Node{Type: html.RawNode, Data: popup.Content})
+	if form, err := popupspec.ParseFormConfig(popup.FormConfig); err != nil {
+		hi.logger.WithFields(map[string]interface{}{
+			"popup_id": popup.ID,
+			"error":    err.Error(),
+		}).Warn("Ignoring invalid popup form config")
+	} else if !form.IsZero() {
+		content.AppendChild(createPopupForm(form))
+	}
+	dialog.AppendChild(content)
 
-	return container
+	return template
 }
@@ -0,0 +1,280 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"proxy-enhancer-ultra/internal/popupspec"
+
+	"golang.org/x/net/html"
+)
+
+// 表单按钮的默认文字，可以通过 FormConfig 和翻译修改
+const (
+	defaultFormNextLabel   = "Next"
+	defaultFormBackLabel   = "Back"
+	defaultFormSubmitLabel = "Submit"
+	defaultCaptchaLabel    = "Enter the code shown above"
+)
+
+// honeypotFieldName 蜜罐字段的名称，访客看不到该字段，自动填表的机器人通常会填写
+const honeypotFieldName = "website"
+
+// createPopupForm 根据表单配置创建弹窗表单
+// 所有步骤都渲染在页面中，页面脚本负责切换步骤、按条件显示字段、更新进度并逐步提交到 FormsEndpointPath
+func createPopupForm(form *popupspec.FormConfig) *html.Node {
+	steps := form.StepList()
+	submitLabel := orDefaultLabel(form.SubmitLabel, defaultFormSubmitLabel)
+	nextLabel := orDefaultLabel(form.NextLabel, defaultFormNextLabel)
+
+	formAttrs := []html.Attribute{
+		{Key: "class", Val: "pe-form"},
+		{Key: "part", Val: "form"},
+		{Key: "data-pe-form", Val: ""},
+		{Key: "novalidate", Val: ""},
+	}
+	if form.SubmitURL != "" {
+		formAttrs = append(formAttrs, html.Attribute{Key: "data-submit-url", Val: form.SubmitURL})
+	}
+	formNode := newElement("form", formAttrs...)
+
+	if form.ShowProgress && len(steps) > 1 {
+		total := strconv.Itoa(len(steps))
+		progress := newElement("div",
+			html.Attribute{Key: "class", Val: "pe-progress"},
+			html.Attribute{Key: "part", Val: "progress"},
+			html.Attribute{Key: "role", Val: "progressbar"},
+			html.Attribute{Key: "aria-valuemin", Val: "1"},
+			html.Attribute{Key: "aria-valuemax", Val: total},
+			html.Attribute{Key: "aria-valuenow", Val: "1"},
+		)
+		bar := newElement("span", html.Attribute{Key: "class", Val: "pe-progress-bar"})
+		bar.AppendChild(newElement("span", html.Attribute{Key: "class", Val: "pe-progress-fill"}))
+		progress.AppendChild(bar)
+		progress.AppendChild(newTextElement("span", "1 / "+total, html.Attribute{Key: "class", Val: "pe-progress-text"}))
+		formNode.AppendChild(progress)
+	}
+
+	for i, step := range steps {
+		stepAttrs := []html.Attribute{
+			{Key: "class", Val: "pe-step"},
+			{Key: "data-step", Val: step.ID},
+		}
+		if i > 0 {
+			stepAttrs = append(stepAttrs, html.Attribute{Key: "hidden", Val: ""})
+		}
+		stepNode := newElement("fieldset", stepAttrs...)
+		if step.Title != "" {
+			stepNode.AppendChild(newTextElement("legend", step.Title, html.Attribute{Key: "class", Val: "pe-step-title"}))
+		}
+		for j := range step.Fields {
+			stepNode.AppendChild(createFormField(&step.Fields[j]))
+		}
+		formNode.AppendChild(stepNode)
+	}
+
+	formNode.AppendChild(createHoneypot())
+	if form.Captcha == popupspec.CaptchaImage {
+		formNode.AppendChild(createCaptcha(form))
+	}
+
+	formNode.AppendChild(newElement("p",
+		html.Attribute{Key: "class", Val: "pe-form-error"},
+		html.Attribute{Key: "role", Val: "alert"},
+		html.Attribute{Key: "hidden", Val: ""},
+	))
+
+	actions := newElement("div", html.Attribute{Key: "class", Val: "pe-form-actions"})
+	actions.AppendChild(newTextElement("button", orDefaultLabel(form.BackLabel, defaultFormBackLabel),
+		html.Attribute{Key: "type", Val: "button"},
+		html.Attribute{Key: "class", Val: "pe-back"},
+		html.Attribute{Key: "hidden", Val: ""},
+	))
+	firstLabel := submitLabel
+	if len(steps) > 1 {
+		firstLabel = nextLabel
+	}
+	actions.AppendChild(newTextElement("button", firstLabel,
+		html.Attribute{Key: "type", Val: "submit"},
+		html.Attribute{Key: "class", Val: "pe-next"},
+		html.Attribute{Key: "data-next-label", Val: nextLabel},
+		html.Attribute{Key: "data-submit-label", Val: submitLabel},
+	))
+	formNode.AppendChild(actions)
+
+	if form.SuccessMessage != "" {
+		formNode.AppendChild(newTextElement("p", form.SuccessMessage,
+			html.Attribute{Key: "class", Val: "pe-form-success"},
+			html.Attribute{Key: "role", Val: "status"},
+			html.Attribute{Key: "hidden", Val: ""},
+		))
+	}
+
+	return formNode
+}
+
+// createHoneypot 创建蜜罐字段，不在任何步骤中，不会作为表单字段提交
+func createHoneypot() *html.Node {
+	wrapper := newElement("div",
+		html.Attribute{Key: "class", Val: "pe-hp"},
+		html.Attribute{Key: "aria-hidden", Val: "true"},
+	)
+	wrapper.AppendChild(newElement("input",
+		html.Attribute{Key: "type", Val: "text"},
+		html.Attribute{Key: "name", Val: honeypotFieldName},
+		html.Attribute{Key: "tabindex", Val: "-1"},
+		html.Attribute{Key: "autocomplete", Val: "off"},
+		html.Attribute{Key: "data-pe-honeypot", Val: ""},
+	))
+	return wrapper
+}
+
+// createCaptcha 创建图片验证码，页面脚本在最后一步显示并从 CaptchaEndpointPath 加载图片
+func createCaptcha(form *popupspec.FormConfig) *html.Node {
+	wrapper := newElement("div",
+		html.Attribute{Key: "class", Val: "pe-captcha"},
+		html.Attribute{Key: "part", Val: "captcha"},
+		html.Attribute{Key: "hidden", Val: ""},
+	)
+	row := newElement("div", html.Attribute{Key: "class", Val: "pe-captcha-row"})
+	row.AppendChild(newElement("img",
+		html.Attribute{Key: "class", Val: "pe-captcha-image"},
+		html.Attribute{Key: "alt", Val: ""},
+	))
+	row.AppendChild(newTextElement("button", "↻",
+		html.Attribute{Key: "type", Val: "button"},
+		html.Attribute{Key: "class", Val: "pe-captcha-refresh"},
+		html.Attribute{Key: "aria-label", Val: "Refresh"},
+	))
+	wrapper.AppendChild(row)
+	wrapper.AppendChild(newTextElement("label", orDefaultLabel(form.CaptchaLabel, defaultCaptchaLabel),
+		html.Attribute{Key: "for", Val: "pe-captcha-answer"}))
+	wrapper.AppendChild(newElement("input",
+		html.Attribute{Key: "id", Val: "pe-captcha-answer"},
+		html.Attribute{Key: "type", Val: "text"},
+		html.Attribute{Key: "inputmode", Val: "numeric"},
+		html.Attribute{Key: "autocomplete", Val: "off"},
+		html.Attribute{Key: "required", Val: ""},
+		html.Attribute{Key: "data-pe-captcha", Val: ""},
+	))
+	return wrapper
+}
+
+// createFormField 创建表单字段，显示条件以JSON写入 data-show-if 属性
+func createFormField(field *popupspec.FormField) *html.Node {
+	wrapperAttrs := []html.Attribute{
+		{Key: "class", Val: "pe-field"},
+		{Key: "data-field", Val: field.Name},
+		{Key: "data-type", Val: field.Type},
+	}
+	if field.ShowIf != nil {
+		if data, err := json.Marshal(field.ShowIf); err == nil {
+			wrapperAttrs = append(wrapperAttrs, html.Attribute{Key: "data-show-if", Val: string(data)})
+		}
+	}
+	wrapper := newElement("div", wrapperAttrs...)
+	id := "pe-field-" + field.Name
+
+	switch field.Type {
+	case popupspec.FieldCheckbox:
+		label := newElement("label", html.Attribute{Key: "class", Val: "pe-choice"})
+		label.AppendChild(newElement("input", fieldInputAttrs(field, id, popupspec.FieldCheckbox,
+			html.Attribute{Key: "value", Val: "true"})...))
+		label.AppendChild(&html.Node{Type: html.TextNode, Data: field.Label})
+		wrapper.AppendChild(label)
+		return wrapper
+
+	case popupspec.FieldRadio:
+		wrapper.Attr = append(wrapper.Attr, html.Attribute{Key: "role", Val: "radiogroup"})
+		wrapper.AppendChild(newTextElement("span", field.Label, html.Attribute{Key: "class", Val: "pe-label"}))
+		for i, option := range field.Options {
+			label := newElement("label", html.Attribute{Key: "class", Val: "pe-choice"})
+			label.AppendChild(newElement("input", fieldInputAttrs(field, id+"-"+strconv.Itoa(i), popupspec.FieldRadio,
+				html.Attribute{Key: "value", Val: option})...))
+			label.AppendChild(&html.Node{Type: html.TextNode, Data: field.OptionLabel(option)})
+			wrapper.AppendChild(label)
+		}
+		return wrapper
+	}
+
+	wrapper.AppendChild(newTextElement("label", field.Label, html.Attribute{Key: "for", Val: id}))
+	switch field.Type {
+	case popupspec.FieldSelect:
+		selectNode := newElement("select", fieldInputAttrs(field, id, "")...)
+		selectNode.AppendChild(newTextElement("option", field.Placeholder, html.Attribute{Key: "value", Val: ""}))
+		for _, option := range field.Options {
+			selectNode.AppendChild(newTextElement("option", field.OptionLabel(option), html.Attribute{Key: "value", Val: option}))
+		}
+		wrapper.AppendChild(selectNode)
+	case popupspec.FieldTextarea:
+		wrapper.AppendChild(newElement("textarea", fieldInputAttrs(field, id, "")...))
+	case popupspec.FieldFile:
+		// 选择文件后由脚本上传到数据面，提交步骤时只提交文件ID
+		attrs := fieldInputAttrs(field, id, popupspec.FieldFile,
+			html.Attribute{Key: "data-max-size", Val: strconv.FormatInt(field.FileMaxSize(), 10)})
+		if len(field.Accept) > 0 {
+			attrs = append(attrs, html.Attribute{Key: "accept", Val: strings.Join(field.Accept, ",")})
+		}
+		wrapper.AppendChild(newElement("input", attrs...))
+	default:
+		wrapper.AppendChild(newElement("input", fieldInputAttrs(field, id, field.Type)...))
+	}
+	return wrapper
+}
+
+// fieldInputAttrs 返回输入控件的属性，浏览器按这些属性做与服务端一致的基本校验
+func fieldInputAttrs(field *popupspec.FormField, id, inputType string, extra ...html.Attribute) []html.Attribute {
+	attrs := []html.Attribute{
+		{Key: "id", Val: id},
+		{Key: "name", Val: field.Name},
+	}
+	if inputType != "" {
+		attrs = append(attrs, html.Attribute{Key: "type", Val: inputType})
+	}
+	attrs = append(attrs, extra...)
+	if field.Required {
+		attrs = append(attrs, html.Attribute{Key: "required", Val: ""})
+	}
+	if field.Placeholder != "" && field.Type != popupspec.FieldSelect && field.Type != popupspec.FieldFile &&
+		inputType != popupspec.FieldCheckbox && inputType != popupspec.FieldRadio {
+		attrs = append(attrs, html.Attribute{Key: "placeholder", Val: field.Placeholder})
+	}
+	if v := field.Validation; v != nil {
+		if v.MinLength > 0 {
+			attrs = append(attrs, html.Attribute{Key: "minlength", Val: strconv.Itoa(v.MinLength)})
+		}
+		if v.MaxLength > 0 {
+			attrs = append(attrs, html.Attribute{Key: "maxlength", Val: strconv.Itoa(v.MaxLength)})
+		}
+		if v.Pattern != "" {
+			attrs = append(attrs, html.Attribute{Key: "pattern", Val: v.Pattern})
+		}
+		if v.Message != "" {
+			attrs = append(attrs, html.Attribute{Key: "data-message", Val: v.Message})
+		}
+	}
+	return attrs
+}
+
+// orDefaultLabel 文字为空时返回默认文字
+func orDefaultLabel(label, fallback string) string {
+	if label == "" {
+		return fallback
+	}
+	return label
+}
+
+// newElement 创建元素节点
+func newElement(tag string, attrs ...html.Attribute) *html.Node {
+	return &html.Node{Type: html.ElementNode, Data: tag, Attr: attrs}
+}
+
+// newTextElement 创建只包含文本的元素节点
+func newTextElement(tag, text string, attrs ...html.Attribute) *html.Node {
+	node := newElement(tag, attrs...)
+	if text != "" {
+		node.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+	}
+	return node
+}
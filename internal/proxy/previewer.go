@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/ruledsl"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+)
+
+// maxPreviewBodySize 预览时读取目标页面的最大字节数
+const maxPreviewBodySize = 5 << 20
+
+// PreviewOptions 预览选项
+type PreviewOptions struct {
+	URL          string            // 待预览的页面，可以是路径或完整URL
+	UserAgent    string            // 请求目标站点时使用的User-Agent
+	Rules        []*models.Rule    // 需要试运行的规则，按顺序执行
+	Popups       []*models.Popup   // 需要注入的弹窗
+	FullPipeline bool              // 是否同时注入基础资源并重写URL，使输出与线上代理一致
+	Headers      map[string]string // 模拟访客请求头（如Cookie、CF-IPCountry），用于判断触发条件
+	At           time.Time         // 模拟访问时间，为零值时使用当前时间
+}
+
+// PreviewResult 预览结果
+type PreviewResult struct {
+	TargetURL       string            `json:"target_url"`
+	StatusCode      int               `json:"status_code"`
+	OriginalHTML    string            `json:"original_html"`
+	TransformedHTML string            `json:"transformed_html"`
+	Diff            []DiffEntry       `json:"diff"`
+	DiffTruncated   bool              `json:"diff_truncated"`
+	Rules           []RuleApplication `json:"rules"`
+	FetchTime       int64             `json:"fetch_time"` // 拉取目标页面耗时，毫秒
+}
+
+// Previewer 规则和弹窗的试运行器，通过代理配置拉取页面并应用变换但不保存任何数据
+type Previewer struct {
+	logger       logger.Logger
+	client       *http.Client
+	htmlInjector *HTMLInjector
+	urlRewriter  *URLRewriter
+}
+
+// NewPreviewer 创建新的试运行器
+func NewPreviewer(db *gorm.DB, logger logger.Logger) *Previewer {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	return &Previewer{
+		logger:       logger,
+		client:       client,
+		htmlInjector: NewHTMLInjector(db, logger),
+		urlRewriter:  NewURLRewriter(),
+	}
+}
+
+// Preview 拉取页面并应用规则和弹窗，返回原始与变换后的HTML及结构差异
+func (p *Previewer) Preview(ctx context.Context, proxyConfig *models.ProxyConfig, opts *PreviewOptions) (*PreviewResult, error) {
+	targetURL, err := p.resolveTargetURL(proxyConfig, opts.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create preview request: %w", err)
+	}
+	if opts.UserAgent != "" {
+		req.Header.Set("User-Agent", opts.UserAgent)
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	// 重定向同样只允许指向代理域名或目标站点，避免目标站点借助重定向让预览请求任意地址
+	client := *p.client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after %d redirects", 10)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("preview redirect scheme %q is not allowed", req.URL.Scheme)
+		}
+		if !p.belongsToProxyConfig(proxyConfig, req.URL.Host) {
+			return fmt.Errorf("preview redirect host %s does not belong to proxy config", req.URL.Host)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch target page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPreviewBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target page: %w", err)
+	}
+	fetchTime := time.Since(start)
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.Contains(strings.ToLower(contentType), "text/html") {
+		return nil, fmt.Errorf("target page is not HTML (content type %q)", contentType)
+	}
+
+	original, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse target page: %w", err)
+	}
+	transformed, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse target page: %w", err)
+	}
+
+	applications := p.htmlInjector.Transform(transformed, opts.Rules, opts.Popups, p.simulateContext(proxyConfig, opts))
+	if opts.FullPipeline {
+		p.htmlInjector.InjectAssets(transformed, proxyConfig)
+		p.urlRewriter.RewriteURLs(transformed, proxyConfig)
+	}
+
+	originalHTML, err := renderHTML(original)
+	if err != nil {
+		return nil, err
+	}
+	transformedHTML, err := renderHTML(transformed)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, complete := DiffHTML(original, transformed)
+
+	return &PreviewResult{
+		TargetURL:       targetURL,
+		StatusCode:      resp.StatusCode,
+		OriginalHTML:    originalHTML,
+		TransformedHTML: transformedHTML,
+		Diff:            diff,
+		DiffTruncated:   !complete,
+		Rules:           applications,
+		FetchTime:       fetchTime.Milliseconds(),
+	}, nil
+}
+
+// resolveTargetURL 将预览地址映射为代理配置的目标地址
+func (p *Previewer) resolveTargetURL(proxyConfig *models.ProxyConfig, rawURL string) (string, error) {
+	if rawURL == "" {
+		rawURL = "/"
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid preview URL: %w", err)
+	}
+
+	// 完整URL只允许指向代理域名或目标站点，避免借助预览请求任意地址
+	if parsed.Host != "" && !p.belongsToProxyConfig(proxyConfig, parsed.Host) {
+		return "", fmt.Errorf("preview URL host %s does not belong to proxy config", parsed.Host)
+	}
+
+	req := &http.Request{URL: &url.URL{Path: parsed.Path, RawQuery: parsed.RawQuery}}
+	return p.urlRewriter.BuildTargetURL(proxyConfig.TargetURL, req), nil
+}
+
+// belongsToProxyConfig 判断主机是否为代理配置的代理域名或目标站点
+func (p *Previewer) belongsToProxyConfig(proxyConfig *models.ProxyConfig, host string) bool {
+	targetHost := p.urlRewriter.extractHost(proxyConfig.TargetURL)
+	return strings.EqualFold(host, proxyConfig.ProxyDomain) || (targetHost != "" && strings.EqualFold(host, targetHost))
+}
+
+// simulateContext 构建模拟访客访问代理域名时的条件求值上下文
+func (p *Previewer) simulateContext(proxyConfig *models.ProxyConfig, opts *PreviewOptions) *ruledsl.Context {
+	visitorURL := &url.URL{Path: "/"}
+	if parsed, err := url.Parse(opts.URL); err == nil && parsed.Path != "" {
+		visitorURL = &url.URL{Path: parsed.Path, RawQuery: parsed.RawQuery}
+	}
+
+	visitorReq := &http.Request{
+		Method: http.MethodGet,
+		Host:   proxyConfig.ProxyDomain,
+		URL:    visitorURL,
+		Header: make(http.Header),
+	}
+	if opts.UserAgent != "" {
+		visitorReq.Header.Set("User-Agent", opts.UserAgent)
+	}
+	for key, value := range opts.Headers {
+		visitorReq.Header.Set(key, value)
+	}
+
+	now := opts.At
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return ruledsl.NewContext(visitorReq, now)
+}
+
+// renderHTML 将文档渲染为字符串
+func renderHTML(doc *html.Node) (string, error) {
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return "", fmt.Errorf("failed to render HTML: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"time"
 
+	"proxy-enhancer-ultra/internal/auth"
 	"proxy-enhancer-ultra/internal/config"
+	"proxy-enhancer-ultra/internal/formguard"
 	"proxy-enhancer-ultra/internal/models"
 	"proxy-enhancer-ultra/pkg/logger"
 
@@ -22,6 +24,9 @@ type ProxyServer struct {
 	requestProcessor *RequestProcessor
 	htmlInjector     *HTMLInjector
 	urlRewriter      *URLRewriter
+	apiCallTriggers  *APICallTriggerIndex
+	jwtManager       *auth.JWTManager // 校验调试令牌，为nil时不输出执行追踪
+	dataPlane        *http.ServeMux   // 数据面端点，如弹窗事件上报
 }
 
 // NewProxyServer 创建新的代理服务器
@@ -38,16 +43,28 @@ func NewProxyServer(db *gorm.DB, logger logger.Logger, cfg *config.Config) *Prox
 	}
 
 	server := &ProxyServer{
-		db:     db,
-		logger: logger,
-		config: cfg,
-		client: client,
+		db:        db,
+		logger:    logger,
+		config:    cfg,
+		client:    client,
+		dataPlane: http.NewServeMux(),
 	}
 
 	// 初始化处理器
 	server.requestProcessor = NewRequestProcessor(logger)
 	server.htmlInjector = NewHTMLInjector(db, logger)
 	server.urlRewriter = NewURLRewriter()
+	server.apiCallTriggers = NewAPICallTriggerIndex(db, logger)
+	if cfg != nil && cfg.JWT.Secret != "" {
+		server.jwtManager = auth.NewJWTManager(cfg.JWT.Secret, cfg.JWT.ExpiresIn)
+	}
+	if cfg != nil {
+		// 与提交防护使用相同的密钥，数据面校验这里签发的表单令牌
+		guard := cfg.Security.Submissions.WithDefaults()
+		server.htmlInjector.formSigner = formguard.NewSigner(cfg.FormTokenSecret())
+		server.htmlInjector.minFillTime = guard.MinFillTime
+		server.htmlInjector.powDifficulty = guard.PowDifficulty
+	}
 
 	return server
 }
@@ -68,6 +85,15 @@ func (p *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 识别访客，新访客下发访客ID Cookie
+	r, _ = EnsureVisitorID(w, r)
+
+	// 数据面请求由注册的处理器处理，不转发到目标站点
+	if isDataPlaneRequest(r) {
+		p.dataPlane.ServeHTTP(w, withProxyConfig(r, proxyConfig))
+		return
+	}
+
 	// 构建目标URL
 	targetURL := p.buildTargetURL(proxyConfig.TargetURL, r)
 
@@ -94,19 +120,31 @@ func (p *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer resp.Body.Close()
 
+	// 请求匹配接口调用触发条件时，在访客的下一个页面打开弹窗
+	FlagPendingTriggers(w, r, p.apiCallTriggers.Match(proxyConfig.ID, r, resp.StatusCode))
+
+	// 管理员调试请求记录规则执行追踪
+	var trace *ExecutionTrace
+	if p.isDebugRequest(r) {
+		trace = NewExecutionTrace(proxyConfig.ID, r, startTime)
+	}
+
 	// 处理响应
-	processedBody, err := p.requestProcessor.ProcessResponse(resp, proxyConfig, p.htmlInjector, p.urlRewriter)
+	processedBody, err := p.requestProcessor.ProcessResponse(resp, r, proxyConfig, p.htmlInjector, p.urlRewriter, trace)
 	if err != nil {
 		p.logger.WithFields(map[string]interface{}{
 			"error": err.Error(),
 		}).Warn("Failed to process response, serving original")
 		// 如果处理失败，返回原始响应
+		trace.AddError(err)
+		p.writeTrace(w, trace)
 		p.requestProcessor.CopyResponse(w, resp)
 		return
 	}
 
 	// 复制响应头并写入处理后的内容
 	p.requestProcessor.CopyResponseHeaders(w, resp, len(processedBody))
+	p.writeTrace(w, trace)
 	w.WriteHeader(resp.StatusCode)
 	w.Write(processedBody)
 
@@ -114,6 +152,38 @@ func (p *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	p.logProxyRequest(r, resp, proxyConfig.BaseModel.ID, time.Since(startTime))
 }
 
+// isDebugRequest 判断请求是否携带有效的管理员调试令牌（请求头或Cookie）
+func (p *ProxyServer) isDebugRequest(r *http.Request) bool {
+	if p.jwtManager == nil {
+		return false
+	}
+
+	token := r.Header.Get(DebugTokenHeader)
+	if token == "" {
+		if cookie, err := r.Cookie(DebugCookieName); err == nil {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		return false
+	}
+
+	claims, err := p.jwtManager.ValidateToken(token)
+	return err == nil && claims.Role == "admin"
+}
+
+// writeTrace 将执行追踪写入响应头
+func (p *ProxyServer) writeTrace(w http.ResponseWriter, trace *ExecutionTrace) {
+	if trace == nil {
+		return
+	}
+	if err := trace.WriteHeaders(w.Header()); err != nil {
+		p.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Warn("Failed to encode execution trace")
+	}
+}
+
 // getProxyConfig 获取代理配置
 func (p *ProxyServer) getProxyConfig(host string) (*models.ProxyConfig, error) {
 	// 如果没有数据库连接，返回默认配置
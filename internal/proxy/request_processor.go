@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
 	"proxy-enhancer-ultra/pkg/logger"
 )
 
@@ -48,6 +49,12 @@ func (rp *RequestProcessor) CreateProxyRequest(originalReq *http.Request, target
 		}
 	}
 
+	// 调试令牌、访客ID、访客状态和待打开弹窗只用于本代理，不转发给目标站点
+	stripCookie(proxyReq.Header, DebugCookieName)
+	stripCookie(proxyReq.Header, VisitorCookieName)
+	stripCookie(proxyReq.Header, popupspec.StateCookieName)
+	stripCookie(proxyReq.Header, PendingTriggerCookieName)
+
 	// 设置Host头
 	proxyReq.Host = parsedURL.Host
 	proxyReq.Header.Set("Host", parsedURL.Host)
@@ -67,8 +74,8 @@ func (rp *RequestProcessor) CreateProxyRequest(originalReq *http.Request, target
 	return proxyReq, nil
 }
 
-// ProcessResponse 处理响应内容
-func (rp *RequestProcessor) ProcessResponse(resp *http.Response, proxyConfig *models.ProxyConfig, htmlInjector *HTMLInjector, urlRewriter *URLRewriter) ([]byte, error) {
+// ProcessResponse 处理响应内容，originalReq 为客户端的原始请求，trace 不为nil时记录规则执行追踪
+func (rp *RequestProcessor) ProcessResponse(resp *http.Response, originalReq *http.Request, proxyConfig *models.ProxyConfig, htmlInjector *HTMLInjector, urlRewriter *URLRewriter, trace *ExecutionTrace) ([]byte, error) {
 	// 读取响应内容
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -82,7 +89,7 @@ func (rp *RequestProcessor) ProcessResponse(resp *http.Response, proxyConfig *mo
 	}
 
 	// 处理HTML内容
-	return htmlInjector.ProcessHTML(body, proxyConfig, urlRewriter)
+	return htmlInjector.ProcessHTML(body, proxyConfig, urlRewriter, originalReq, trace)
 }
 
 // CopyResponse 复制完整响应
@@ -131,6 +138,7 @@ func (rp *RequestProcessor) shouldSkipHeader(key string) bool {
 		"Trailers",
 		"Transfer-Encoding",
 		"Upgrade",
+		DebugTokenHeader,
 	}
 
 	for _, skipHeader := range skipHeaders {
@@ -148,6 +156,8 @@ func (rp *RequestProcessor) shouldSkipResponseHeader(key string) bool {
 		"Transfer-Encoding",
 		"Content-Length",          // 我们会重新设置
 		"Content-Security-Policy", // 可能会阻止我们的脚本
+		TraceHeader,               // 仅由本代理生成
+		TraceSummaryHeader,
 	}
 
 	for _, skipHeader := range skipHeaders {
@@ -158,6 +168,30 @@ func (rp *RequestProcessor) shouldSkipResponseHeader(key string) bool {
 	return false
 }
 
+// stripCookie 从请求头中移除指定名称的Cookie
+func stripCookie(header http.Header, name string) {
+	values := header.Values("Cookie")
+	if len(values) == 0 {
+		return
+	}
+
+	var kept []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ";") {
+			part = strings.TrimSpace(part)
+			if part == "" || strings.HasPrefix(part, name+"=") {
+				continue
+			}
+			kept = append(kept, part)
+		}
+	}
+
+	header.Del("Cookie")
+	if len(kept) > 0 {
+		header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
+
 // GetClientIP 获取客户端IP
 func (rp *RequestProcessor) GetClientIP(r *http.Request) string {
 	// 尝试从X-Forwarded-For头获取
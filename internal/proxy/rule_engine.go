@@ -0,0 +1,314 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/ruledsl"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+)
+
+// maxMatchedNodeSnippet 匹配节点HTML片段的最大长度
+const maxMatchedNodeSnippet = 200
+
+// RuleEngine 规则执行引擎，将规则动作应用到HTML文档
+type RuleEngine struct {
+	htmlParser  *HTMLParser
+	definitions sync.Map // 已解析的规则定义缓存，规则ID -> *compiledRule
+}
+
+// compiledRule 缓存的已解析规则定义和选择器
+type compiledRule struct {
+	updatedAt  time.Time
+	definition *ruledsl.Definition
+	selector   *Selector
+}
+
+// NewRuleEngine 创建新的规则执行引擎
+func NewRuleEngine() *RuleEngine {
+	return &RuleEngine{
+		htmlParser: NewHTMLParser(),
+	}
+}
+
+// MatchedNode 规则命中的节点信息
+type MatchedNode struct {
+	Path    string `json:"path"`
+	Tag     string `json:"tag"`
+	Snippet string `json:"snippet"`
+}
+
+// RuleApplication 单条规则的执行结果
+type RuleApplication struct {
+	RuleID     uuid.UUID     `json:"rule_id"`
+	RuleName   string        `json:"rule_name"`
+	Priority   int           `json:"priority"`
+	Selector   string        `json:"selector"`
+	Actions    []string      `json:"actions"`
+	Matched    int           `json:"matched"`
+	Nodes      []MatchedNode `json:"nodes"`
+	Skipped    bool          `json:"skipped,omitempty"`  // 触发条件不满足，未执行
+	Overlaps   []uuid.UUID   `json:"overlaps,omitempty"` // 已修改过相同节点的先执行规则，本规则的结果会覆盖或叠加在其之上
+	DurationUS int64         `json:"duration_us"`        // 执行耗时（微秒）
+	Error      string        `json:"error,omitempty"`
+}
+
+// Apply 按顺序将规则应用到文档，返回每条规则的执行结果（包含命中节点详情）
+// evalCtx 为请求上下文，为nil时不检查触发条件
+func (re *RuleEngine) Apply(doc *html.Node, rules []*models.Rule, evalCtx *ruledsl.Context) []RuleApplication {
+	return re.run(doc, rules, evalCtx, true)
+}
+
+// Execute 与 Apply 相同，但不生成命中节点详情，供代理请求使用以减少开销
+func (re *RuleEngine) Execute(doc *html.Node, rules []*models.Rule, evalCtx *ruledsl.Context) []RuleApplication {
+	return re.run(doc, rules, evalCtx, false)
+}
+
+// run 按顺序执行规则，记录同一节点被多条规则修改的情况
+func (re *RuleEngine) run(doc *html.Node, rules []*models.Rule, evalCtx *ruledsl.Context, describe bool) []RuleApplication {
+	results := make([]RuleApplication, 0, len(rules))
+	touched := make(map[*html.Node][]uuid.UUID)
+	for _, rule := range rules {
+		start := time.Now()
+		result := re.applyRule(doc, rule, evalCtx, describe, touched)
+		result.DurationUS = time.Since(start).Microseconds()
+		results = append(results, result)
+	}
+	return results
+}
+
+// applyRule 应用单条规则，touched 记录每个节点已被哪些规则修改
+func (re *RuleEngine) applyRule(doc *html.Node, rule *models.Rule, evalCtx *ruledsl.Context, describe bool, touched map[*html.Node][]uuid.UUID) RuleApplication {
+	result := RuleApplication{
+		RuleID:   rule.ID,
+		RuleName: rule.Name,
+		Priority: rule.Priority,
+	}
+	if describe {
+		result.Nodes = []MatchedNode{}
+	}
+
+	compiled, err := re.compileRule(rule)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	def := compiled.definition
+	result.Selector = def.Trigger.Selector
+	result.Actions = def.ActionTypes()
+
+	if evalCtx != nil && !def.Trigger.When.Evaluate(evalCtx) {
+		result.Skipped = true
+		return result
+	}
+
+	// 先收集匹配节点再修改，避免遍历过程中修改树结构
+	nodes := compiled.selector.MatchAll(doc)
+	result.Matched = len(nodes)
+	if describe {
+		for _, node := range nodes {
+			result.Nodes = append(result.Nodes, describeNode(node))
+		}
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for _, node := range nodes {
+		for _, earlier := range touched[node] {
+			if !seen[earlier] {
+				seen[earlier] = true
+				result.Overlaps = append(result.Overlaps, earlier)
+			}
+		}
+		touched[node] = append(touched[node], rule.ID)
+	}
+
+	for _, node := range nodes {
+		if err := re.applyActions(node, def.Actions.Actions); err != nil {
+			result.Error = err.Error()
+			break
+		}
+	}
+
+	return result
+}
+
+// compileRule 解析规则定义并编译选择器，已保存的规则按ID缓存，更新时间变化后重新解析
+func (re *RuleEngine) compileRule(rule *models.Rule) (*compiledRule, error) {
+	if rule.ID != uuid.Nil {
+		if cached, ok := re.definitions.Load(rule.ID); ok {
+			entry := cached.(*compiledRule)
+			if entry.updatedAt.Equal(rule.UpdatedAt) {
+				return entry, nil
+			}
+		}
+	}
+
+	def, err := ruledsl.ParseDefinition(rule.TriggerConditions, rule.Actions)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := CompileSelector(def.Trigger.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := &compiledRule{updatedAt: rule.UpdatedAt, definition: def, selector: selector}
+	if rule.ID != uuid.Nil {
+		re.definitions.Store(rule.ID, compiled)
+	}
+	return compiled, nil
+}
+
+// applyActions 对单个节点依次执行动作
+func (re *RuleEngine) applyActions(node *html.Node, actions []ruledsl.Action) error {
+	for _, action := range actions {
+		if err := re.applyAction(node, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyAction 对单个节点执行动作
+func (re *RuleEngine) applyAction(node *html.Node, action ruledsl.Action) error {
+	switch action.Type {
+	case ruledsl.ActionRemove:
+		if node.Parent != nil {
+			node.Parent.RemoveChild(node)
+		}
+		return nil
+	case ruledsl.ActionReplace:
+		return re.insertContent(node, action.Content, ruledsl.PositionReplace)
+	case ruledsl.ActionAppend:
+		position := action.Position
+		if position == "" {
+			position = ruledsl.PositionInside
+		}
+		return re.insertContent(node, action.Content, position)
+	case ruledsl.ActionPrepend:
+		position := action.Position
+		if position == "" || position == ruledsl.PositionInside {
+			position = ruledsl.PositionInsideStart
+		}
+		return re.insertContent(node, action.Content, position)
+	case ruledsl.ActionModifyText:
+		for child := node.FirstChild; child != nil; {
+			next := child.NextSibling
+			node.RemoveChild(child)
+			child = next
+		}
+		node.AppendChild(&html.Node{Type: html.TextNode, Data: action.Content})
+		return nil
+	case ruledsl.ActionModifyAttribute:
+		setAttr(node, action.Attribute, action.Value)
+		return nil
+	default:
+		return fmt.Errorf("unsupported action %q", action.Type)
+	}
+}
+
+// insertContent 将HTML片段插入到节点的指定位置
+func (re *RuleEngine) insertContent(node *html.Node, content, position string) error {
+	context := node
+	if position == "before" || position == "after" || position == "replace" {
+		if node.Parent == nil {
+			return fmt.Errorf("cannot insert %s a detached node", position)
+		}
+		context = node.Parent
+	}
+	if context == nil || context.Type != html.ElementNode {
+		context = &html.Node{Type: html.ElementNode, Data: "body"}
+	}
+
+	fragment, err := html.ParseFragment(strings.NewReader(content), context)
+	if err != nil {
+		return fmt.Errorf("failed to parse content: %w", err)
+	}
+
+	switch position {
+	case "before":
+		for _, child := range fragment {
+			node.Parent.InsertBefore(child, node)
+		}
+	case "after":
+		next := node.NextSibling
+		for _, child := range fragment {
+			node.Parent.InsertBefore(child, next)
+		}
+	case "replace":
+		for _, child := range fragment {
+			node.Parent.InsertBefore(child, node)
+		}
+		node.Parent.RemoveChild(node)
+	case "inside_start":
+		first := node.FirstChild
+		for _, child := range fragment {
+			node.InsertBefore(child, first)
+		}
+	default:
+		for _, child := range fragment {
+			node.AppendChild(child)
+		}
+	}
+
+	return nil
+}
+
+// describeNode 生成节点的描述信息
+func describeNode(node *html.Node) MatchedNode {
+	var buf bytes.Buffer
+	html.Render(&buf, node)
+	snippet := buf.String()
+	if len(snippet) > maxMatchedNodeSnippet {
+		snippet = snippet[:maxMatchedNodeSnippet] + "..."
+	}
+
+	return MatchedNode{
+		Path:    NodePath(node),
+		Tag:     node.Data,
+		Snippet: snippet,
+	}
+}
+
+// NodePath 生成节点在文档中的路径，如 html>body>div#main>p:nth-child(2)
+func NodePath(node *html.Node) string {
+	var parts []string
+	for n := node; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		part := n.Data
+		if id := getAttr(n, "id"); id != "" {
+			part += "#" + id
+		} else if n.Parent != nil && n.Parent.Type == html.ElementNode {
+			index, total := 0, 0
+			for sibling := n.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+				if sibling.Type == html.ElementNode && sibling.Data == n.Data {
+					total++
+					if sibling == n {
+						index = total
+					}
+				}
+			}
+			if total > 1 {
+				part += fmt.Sprintf(":nth-of-type(%d)", index)
+			}
+		}
+		parts = append([]string{part}, parts...)
+	}
+	return strings.Join(parts, ">")
+}
+
+// setAttr 设置节点属性
+func setAttr(node *html.Node, key, value string) {
+	for i, attr := range node.Attr {
+		if attr.Key == key {
+			node.Attr[i].Val = value
+			return
+		}
+	}
+	node.Attr = append(node.Attr, html.Attribute{Key: key, Val: value})
+}
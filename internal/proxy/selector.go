@@ -0,0 +1,397 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Selector 编译后的CSS选择器，支持常用的选择器子集
+//
+// 支持：标签、*、#id、.class、[attr]、[attr=v]、[attr~=v]、[attr^=v]、[attr$=v]、[attr*=v]，
+// 后代组合符（空格）、子代组合符（>）以及逗号分组。
+type Selector struct {
+	raw    string
+	groups []complexSelector
+}
+
+// complexSelector 由组合符连接的复合选择器序列
+type complexSelector struct {
+	compounds   []compoundSelector
+	combinators []byte // combinators[i] 连接 compounds[i] 与 compounds[i+1]，取值 ' ' 或 '>'
+}
+
+// compoundSelector 作用于单个元素的复合选择器
+type compoundSelector struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+// attrSelector 属性选择器
+type attrSelector struct {
+	key string
+	op  string
+	val string
+}
+
+// CompileSelector 编译CSS选择器
+func CompileSelector(selector string) (*Selector, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return nil, fmt.Errorf("empty selector")
+	}
+
+	s := &Selector{raw: selector}
+	for _, part := range splitSelectorGroups(selector) {
+		group, err := parseComplexSelector(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+		s.groups = append(s.groups, group)
+	}
+
+	return s, nil
+}
+
+// String 返回原始选择器文本
+func (s *Selector) String() string {
+	return s.raw
+}
+
+// Match 判断节点是否匹配选择器
+func (s *Selector) Match(node *html.Node) bool {
+	if node == nil || node.Type != html.ElementNode {
+		return false
+	}
+	for _, group := range s.groups {
+		if group.match(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchAll 按文档顺序返回所有匹配的节点
+func (s *Selector) MatchAll(root *html.Node) []*html.Node {
+	var result []*html.Node
+	NewHTMLParser().WalkNodes(root, func(node *html.Node) {
+		if s.Match(node) {
+			result = append(result, node)
+		}
+	})
+	return result
+}
+
+// MayOverlap 判断两个选择器是否可能匹配同一元素
+//
+// 只比较每组最右侧的复合选择器（标签、id、属性值），不考虑祖先约束，
+// 因此结果偏保守：返回false时一定不重叠，返回true时可能重叠
+func (s *Selector) MayOverlap(other *Selector) bool {
+	for _, a := range s.groups {
+		for _, b := range other.groups {
+			if a.subject().compatible(b.subject()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subject 返回复杂选择器最右侧、即实际匹配元素的复合选择器
+func (cs complexSelector) subject() compoundSelector {
+	return cs.compounds[len(cs.compounds)-1]
+}
+
+// compatible 判断两个复合选择器是否可能同时满足
+func (c compoundSelector) compatible(other compoundSelector) bool {
+	if c.tag != "" && other.tag != "" && c.tag != other.tag {
+		return false
+	}
+	if c.id != "" && other.id != "" && c.id != other.id {
+		return false
+	}
+	for _, a := range c.attrs {
+		for _, b := range other.attrs {
+			if a.key != b.key {
+				continue
+			}
+			if a.op == "=" && !b.accepts(a.val) || b.op == "=" && !a.accepts(b.val) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// accepts 判断属性值是否满足属性选择器
+func (a attrSelector) accepts(value string) bool {
+	return a.match(&html.Node{Type: html.ElementNode, Attr: []html.Attribute{{Key: a.key, Val: value}}})
+}
+
+// splitSelectorGroups 按逗号拆分选择器组（忽略引号和方括号中的逗号）
+func splitSelectorGroups(selector string) []string {
+	var groups []string
+	var quote byte
+	depth := 0
+	start := 0
+
+	for i := 0; i < len(selector); i++ {
+		c := selector[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			groups = append(groups, strings.TrimSpace(selector[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(groups, strings.TrimSpace(selector[start:]))
+}
+
+// parseComplexSelector 解析带组合符的选择器
+func parseComplexSelector(text string) (complexSelector, error) {
+	var sel complexSelector
+	if text == "" {
+		return sel, fmt.Errorf("empty selector group")
+	}
+
+	i := 0
+	pendingCombinator := byte(0)
+	for i < len(text) {
+		c := text[i]
+		if c == ' ' || c == '\t' || c == '\n' {
+			if len(sel.compounds) > 0 && pendingCombinator == 0 {
+				pendingCombinator = ' '
+			}
+			i++
+			continue
+		}
+		if c == '>' {
+			if len(sel.compounds) == 0 {
+				return sel, fmt.Errorf("unexpected combinator '>'")
+			}
+			pendingCombinator = '>'
+			i++
+			continue
+		}
+
+		compound, next, err := parseCompoundSelector(text, i)
+		if err != nil {
+			return sel, err
+		}
+		if len(sel.compounds) > 0 {
+			sel.combinators = append(sel.combinators, pendingCombinator)
+		}
+		sel.compounds = append(sel.compounds, compound)
+		pendingCombinator = 0
+		i = next
+	}
+
+	if len(sel.compounds) == 0 || pendingCombinator == '>' {
+		return sel, fmt.Errorf("incomplete selector")
+	}
+
+	return sel, nil
+}
+
+// parseCompoundSelector 从位置start开始解析复合选择器，返回结束位置
+func parseCompoundSelector(text string, start int) (compoundSelector, int, error) {
+	var compound compoundSelector
+	i := start
+	empty := true
+
+	for i < len(text) {
+		c := text[i]
+		switch {
+		case c == '*':
+			i++
+		case c == '#':
+			name, next := readIdentifier(text, i+1)
+			if name == "" {
+				return compound, i, fmt.Errorf("missing id after '#'")
+			}
+			compound.id = name
+			i = next
+		case c == '.':
+			name, next := readIdentifier(text, i+1)
+			if name == "" {
+				return compound, i, fmt.Errorf("missing class after '.'")
+			}
+			compound.classes = append(compound.classes, name)
+			i = next
+		case c == '[':
+			attr, next, err := parseAttrSelector(text, i+1)
+			if err != nil {
+				return compound, i, err
+			}
+			compound.attrs = append(compound.attrs, attr)
+			i = next
+		case isIdentifierChar(c):
+			if !empty {
+				return compound, i, fmt.Errorf("unexpected tag name at %d", i)
+			}
+			name, next := readIdentifier(text, i)
+			compound.tag = strings.ToLower(name)
+			i = next
+		default:
+			if empty {
+				return compound, i, fmt.Errorf("unexpected character %q", c)
+			}
+			return compound, i, nil
+		}
+		empty = false
+	}
+
+	return compound, i, nil
+}
+
+// parseAttrSelector 解析方括号内的属性选择器
+func parseAttrSelector(text string, start int) (attrSelector, int, error) {
+	var attr attrSelector
+	end := strings.IndexByte(text[start:], ']')
+	if end < 0 {
+		return attr, start, fmt.Errorf("unterminated attribute selector")
+	}
+	body := strings.TrimSpace(text[start : start+end])
+	next := start + end + 1
+
+	for _, op := range []string{"~=", "^=", "$=", "*=", "="} {
+		if idx := strings.Index(body, op); idx > 0 {
+			attr.key = strings.ToLower(strings.TrimSpace(body[:idx]))
+			attr.op = op
+			attr.val = strings.Trim(strings.TrimSpace(body[idx+len(op):]), `"'`)
+			return attr, next, nil
+		}
+	}
+
+	if body == "" {
+		return attr, start, fmt.Errorf("empty attribute selector")
+	}
+	attr.key = strings.ToLower(body)
+	return attr, next, nil
+}
+
+// readIdentifier 读取标识符
+func readIdentifier(text string, start int) (string, int) {
+	i := start
+	for i < len(text) && isIdentifierChar(text[i]) {
+		i++
+	}
+	return text[start:i], i
+}
+
+// isIdentifierChar 判断字符是否可用于标识符
+func isIdentifierChar(c byte) bool {
+	return c == '-' || c == '_' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// match 从右向左匹配复杂选择器
+func (cs complexSelector) match(node *html.Node) bool {
+	return cs.matchAt(node, len(cs.compounds)-1)
+}
+
+func (cs complexSelector) matchAt(node *html.Node, index int) bool {
+	if !cs.compounds[index].match(node) {
+		return false
+	}
+	if index == 0 {
+		return true
+	}
+
+	switch cs.combinators[index-1] {
+	case '>':
+		parent := node.Parent
+		return parent != nil && parent.Type == html.ElementNode && cs.matchAt(parent, index-1)
+	default:
+		for ancestor := node.Parent; ancestor != nil; ancestor = ancestor.Parent {
+			if ancestor.Type == html.ElementNode && cs.matchAt(ancestor, index-1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// match 判断单个元素是否满足复合选择器
+func (c compoundSelector) match(node *html.Node) bool {
+	if node.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && c.tag != node.Data {
+		return false
+	}
+	if c.id != "" && getAttr(node, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(getAttr(node, "class"))
+		for _, class := range c.classes {
+			if !containsField(classes, class) {
+				return false
+			}
+		}
+	}
+	for _, attr := range c.attrs {
+		if !attr.match(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// match 判断属性选择器是否满足
+func (a attrSelector) match(node *html.Node) bool {
+	for _, attr := range node.Attr {
+		if attr.Key != a.key {
+			continue
+		}
+		switch a.op {
+		case "":
+			return true
+		case "=":
+			return attr.Val == a.val
+		case "~=":
+			return containsField(strings.Fields(attr.Val), a.val)
+		case "^=":
+			return a.val != "" && strings.HasPrefix(attr.Val, a.val)
+		case "$=":
+			return a.val != "" && strings.HasSuffix(attr.Val, a.val)
+		case "*=":
+			return a.val != "" && strings.Contains(attr.Val, a.val)
+		}
+	}
+	return false
+}
+
+// getAttr 获取节点属性值
+func getAttr(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// containsField 检查字段列表是否包含指定值
+func containsField(fields []string, value string) bool {
+	for _, field := range fields {
+		if field == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 规则执行追踪相关的请求、响应头
+const (
+	DebugTokenHeader   = "X-PE-Debug-Token"   // 携带管理员JWT的请求头
+	DebugCookieName    = "pe_debug"           // 携带管理员JWT的Cookie
+	TraceHeader        = "X-PE-Trace"         // base64url编码的追踪JSON
+	TraceSummaryHeader = "X-PE-Trace-Summary" // 可直接阅读的追踪摘要
+
+	// maxTraceHeaderSize 追踪响应头的最大长度，超出时截断规则列表
+	maxTraceHeaderSize = 16 * 1024
+)
+
+// ExecutionTrace 单次代理响应的规则执行追踪
+type ExecutionTrace struct {
+	ProxyConfigID   uuid.UUID         `json:"proxy_config_id"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	StartedAt       time.Time         `json:"started_at"`
+	Rules           []RuleApplication `json:"rules"`
+	RulesDurationUS int64             `json:"rules_duration_us"` // 全部规则执行耗时（微秒）
+	TotalDurationMS int64             `json:"total_duration_ms"` // 从收到请求到写出响应头的耗时（毫秒）
+	Errors          []string          `json:"errors,omitempty"`
+	Truncated       bool              `json:"truncated,omitempty"` // 规则列表因响应头长度限制被截断
+}
+
+// NewExecutionTrace 创建请求的执行追踪
+func NewExecutionTrace(proxyConfigID uuid.UUID, r *http.Request, startedAt time.Time) *ExecutionTrace {
+	return &ExecutionTrace{
+		ProxyConfigID: proxyConfigID,
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		StartedAt:     startedAt,
+		Rules:         []RuleApplication{},
+	}
+}
+
+// AddError 记录执行过程中的错误，trace为nil时忽略
+func (t *ExecutionTrace) AddError(err error) {
+	if t == nil || err == nil {
+		return
+	}
+	t.Errors = append(t.Errors, err.Error())
+}
+
+// Summary 生成追踪摘要，如 rules=5 matched=3 skipped=1 errors=0 rules_us=820
+func (t *ExecutionTrace) Summary() string {
+	matched, skipped, errs := 0, 0, len(t.Errors)
+	for _, rule := range t.Rules {
+		switch {
+		case rule.Skipped:
+			skipped++
+		case rule.Matched > 0:
+			matched++
+		}
+		if rule.Error != "" {
+			errs++
+		}
+	}
+	return fmt.Sprintf("rules=%d matched=%d skipped=%d errors=%d rules_us=%d total_ms=%d",
+		len(t.Rules), matched, skipped, errs, t.RulesDurationUS, t.TotalDurationMS)
+}
+
+// Encode 将追踪编码为响应头的值，超过长度限制时从末尾截断规则列表
+func (t *ExecutionTrace) Encode() (string, error) {
+	trace := *t
+	for {
+		data, err := json.Marshal(&trace)
+		if err != nil {
+			return "", err
+		}
+		encoded := base64.RawURLEncoding.EncodeToString(data)
+		if len(encoded) <= maxTraceHeaderSize || len(trace.Rules) == 0 {
+			return encoded, nil
+		}
+		trace.Rules = trace.Rules[:len(trace.Rules)/2]
+		trace.Truncated = true
+	}
+}
+
+// WriteHeaders 将追踪写入响应头，并禁止缓存包含追踪信息的响应
+func (t *ExecutionTrace) WriteHeaders(header http.Header) error {
+	t.TotalDurationMS = time.Since(t.StartedAt).Milliseconds()
+
+	encoded, err := t.Encode()
+	if err != nil {
+		return err
+	}
+	header.Set(TraceHeader, encoded)
+	header.Set(TraceSummaryHeader, t.Summary())
+	header.Set("Cache-Control", "private, no-store")
+	return nil
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+)
+
+// SelectTranslation 按访客的候选语言选择弹窗翻译，候选语言优先匹配原文语言或没有匹配的翻译时返回nil
+func SelectTranslation(popup *models.Popup, locales []string) *models.PopupTranslation {
+	if len(locales) == 0 || len(popup.Translations) == 0 {
+		return nil
+	}
+
+	available := make([]string, 0, len(popup.Translations)+1)
+	if popup.DefaultLocale != "" {
+		available = append(available, popup.DefaultLocale)
+	}
+	for _, translation := range popup.Translations {
+		available = append(available, translation.Locale)
+	}
+
+	matched := popupspec.MatchLocale(locales, available)
+	if matched == "" || matched == popup.DefaultLocale {
+		return nil
+	}
+	for i := range popup.Translations {
+		if popup.Translations[i].Locale == matched {
+			return &popup.Translations[i]
+		}
+	}
+	return nil
+}
+
+// ApplyTranslation 返回使用翻译文字的弹窗副本，翻译未设置的文字沿用原文
+//
+// 副本的 DefaultLocale 设置为翻译的语言，表示渲染内容使用的语言；
+// 在 ApplyVariant 之后调用，变体的样式保留，标题和内容以翻译为准
+func ApplyTranslation(popup *models.Popup, translation *models.PopupTranslation) *models.Popup {
+	if translation == nil {
+		return popup
+	}
+
+	rendered := *popup
+	rendered.DefaultLocale = translation.Locale
+	if translation.Title != "" {
+		rendered.Title = translation.Title
+	}
+	if translation.Content != "" {
+		rendered.Content = translation.Content
+	}
+	formTranslation, err := popupspec.ParseFormTranslation(translation.FormTranslation)
+	if err != nil || formTranslation.IsZero() {
+		return &rendered
+	}
+	if form, err := popupspec.ParseFormConfig(popup.FormConfig); err == nil && !form.IsZero() {
+		if data, err := form.Localize(formTranslation).Marshal(); err == nil {
+			rendered.FormConfig = data
+		}
+	}
+	return &rendered
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"bytes"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+
+	"github.com/google/uuid"
+)
+
+// AssignVariant 按流量权重为访客分配弹窗变体，没有可分配的变体时返回nil
+//
+// 分配结果由弹窗ID和访客ID的哈希决定，同一访客在权重不变时始终看到同一变体；
+// 访客ID为空时随机分配
+func AssignVariant(popup *models.Popup, visitorID string) *models.PopupVariant {
+	candidates := make([]*models.PopupVariant, 0, len(popup.Variants))
+	total := uint64(0)
+	for i := range popup.Variants {
+		variant := &popup.Variants[i]
+		if !variant.IsActive || variant.Weight <= 0 {
+			continue
+		}
+		candidates = append(candidates, variant)
+		total += uint64(variant.Weight)
+	}
+	if total == 0 {
+		return nil
+	}
+
+	// 按ID排序，保证分配结果与查询顺序无关
+	sort.Slice(candidates, func(i, j int) bool {
+		return bytes.Compare(candidates[i].ID[:], candidates[j].ID[:]) < 0
+	})
+
+	var point uint64
+	if visitorID == "" {
+		point = rand.Uint64() % total
+	} else {
+		point = variantBucket(popup.ID, visitorID) % total
+	}
+
+	for _, variant := range candidates {
+		if point < uint64(variant.Weight) {
+			return variant
+		}
+		point -= uint64(variant.Weight)
+	}
+	return candidates[len(candidates)-1]
+}
+
+// variantBucket 计算访客在弹窗上的稳定分桶值
+func variantBucket(popupID uuid.UUID, visitorID string) uint64 {
+	h := fnv.New64a()
+	h.Write(popupID[:])
+	h.Write([]byte(visitorID))
+	return h.Sum64()
+}
+
+// ApplyVariant 返回使用变体内容的弹窗副本，变体未设置的字段沿用弹窗本身的值
+func ApplyVariant(popup *models.Popup, variant *models.PopupVariant) *models.Popup {
+	if variant == nil {
+		return popup
+	}
+
+	rendered := *popup
+	if variant.Title != "" {
+		rendered.Title = variant.Title
+	}
+	if variant.Content != "" {
+		rendered.Content = variant.Content
+	}
+	if style, err := popupspec.ParseStyleConfig(variant.StyleConfig); err == nil && !style.IsZero() {
+		rendered.StyleConfig = variant.StyleConfig
+	}
+	return &rendered
+}
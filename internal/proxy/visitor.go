@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// 访客标识
+const (
+	VisitorCookieName   = "pe_vid"           // 访客ID Cookie，用于A/B测试的稳定分组和转化归因
+	visitorCookieMaxAge = 365 * 24 * 60 * 60 // 一年
+)
+
+// visitorIDKey 请求上下文中访客ID的键
+type visitorIDKey struct{}
+
+// EnsureVisitorID 读取访客ID，不存在或无效时生成新ID并通过响应Cookie下发
+// 返回的请求在上下文中携带访客ID
+func EnsureVisitorID(w http.ResponseWriter, r *http.Request) (*http.Request, string) {
+	visitorID := visitorIDFromCookie(r)
+	if visitorID == "" {
+		visitorID = uuid.NewString()
+		http.SetCookie(w, &http.Cookie{
+			Name:     VisitorCookieName,
+			Value:    visitorID,
+			Path:     "/",
+			MaxAge:   visitorCookieMaxAge,
+			HttpOnly: true,
+			Secure:   isSecureRequest(r),
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), visitorIDKey{}, visitorID)), visitorID
+}
+
+// VisitorID 返回请求的访客ID，优先使用上下文中的值，没有时返回空字符串
+func VisitorID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if visitorID, ok := r.Context().Value(visitorIDKey{}).(string); ok {
+		return visitorID
+	}
+	return visitorIDFromCookie(r)
+}
+
+// visitorIDFromCookie 从Cookie读取并校验访客ID
+func visitorIDFromCookie(r *http.Request) string {
+	cookie, err := r.Cookie(VisitorCookieName)
+	if err != nil {
+		return ""
+	}
+	if _, err := uuid.Parse(cookie.Value); err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// isSecureRequest 判断客户端是否通过HTTPS访问
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
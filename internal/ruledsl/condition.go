@@ -0,0 +1,245 @@
+package ruledsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 条件字段
+const (
+	FieldPath     = "path"     // 请求路径
+	FieldQuery    = "query"    // 查询参数，需指定key
+	FieldCookie   = "cookie"   // Cookie，需指定key
+	FieldHeader   = "header"   // 请求头，需指定key
+	FieldMethod   = "method"   // 请求方法
+	FieldHost     = "host"     // 请求主机
+	FieldReferrer = "referrer" // 来源页面
+	FieldDevice   = "device"   // 设备类型：mobile、tablet、desktop、bot
+	FieldGeo      = "geo"      // 国家/地区代码（ISO 3166-1 alpha-2）
+	FieldTime     = "time"     // 当日时间 HH:MM
+	FieldDate     = "date"     // 日期 YYYY-MM-DD
+	FieldWeekday  = "weekday"  // 星期：mon..sun
+)
+
+// 条件操作符
+const (
+	OpEquals    = "eq"
+	OpNotEquals = "neq"
+	OpContains  = "contains"
+	OpPrefix    = "prefix"
+	OpSuffix    = "suffix"
+	OpGlob      = "glob"
+	OpRegex     = "regex"
+	OpIn        = "in"
+	OpExists    = "exists"
+	OpBetween   = "between"
+)
+
+// maxConditionDepth 条件嵌套的最大深度
+const maxConditionDepth = 16
+
+// Condition 触发条件节点，分组节点（all/any/not）与叶子节点（field/op）二选一
+//
+// 示例：
+//
+//	{"all": [
+//	  {"field": "path", "op": "glob", "value": "/products/*"},
+//	  {"not": {"field": "device", "op": "eq", "value": "bot"}},
+//	  {"field": "time", "op": "between", "values": ["09:00", "18:00"], "timezone": "Asia/Shanghai"}
+//	]}
+type Condition struct {
+	All []*Condition `json:"all,omitempty"` // 全部满足
+	Any []*Condition `json:"any,omitempty"` // 任一满足
+	Not *Condition   `json:"not,omitempty"` // 取反
+
+	Field         string   `json:"field,omitempty"`
+	Key           string   `json:"key,omitempty"` // query、cookie、header 的名称
+	Op            string   `json:"op,omitempty"`
+	Value         string   `json:"value,omitempty"`
+	Values        []string `json:"values,omitempty"`
+	CaseSensitive bool     `json:"case_sensitive,omitempty"`
+	Timezone      string   `json:"timezone,omitempty"` // time、date、weekday 使用的时区，默认UTC
+
+	regex    *regexp.Regexp
+	location *time.Location
+}
+
+// Parse 解析并编译条件JSON，空输入返回nil表示无条件
+func Parse(data []byte) (*Condition, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" || trimmed == "null" || trimmed == "{}" {
+		return nil, nil
+	}
+
+	var cond Condition
+	if err := json.Unmarshal([]byte(trimmed), &cond); err != nil {
+		return nil, fmt.Errorf("invalid condition JSON: %w", err)
+	}
+	if err := cond.Compile(); err != nil {
+		return nil, err
+	}
+	return &cond, nil
+}
+
+// Compile 校验条件树并预编译正则和时区
+func (c *Condition) Compile() error {
+	return c.compile(0)
+}
+
+func (c *Condition) compile(depth int) error {
+	if depth > maxConditionDepth {
+		return fmt.Errorf("condition nesting exceeds %d levels", maxConditionDepth)
+	}
+
+	groups := 0
+	if len(c.All) > 0 {
+		groups++
+	}
+	if len(c.Any) > 0 {
+		groups++
+	}
+	if c.Not != nil {
+		groups++
+	}
+	isLeaf := c.Field != "" || c.Op != ""
+
+	switch {
+	case groups > 1 || (groups == 1 && isLeaf):
+		return fmt.Errorf("condition must be exactly one of all, any, not or a field comparison")
+	case groups == 0 && !isLeaf:
+		return fmt.Errorf("empty condition")
+	}
+
+	for _, child := range c.All {
+		if err := child.compile(depth + 1); err != nil {
+			return err
+		}
+	}
+	for _, child := range c.Any {
+		if err := child.compile(depth + 1); err != nil {
+			return err
+		}
+	}
+	if c.Not != nil {
+		return c.Not.compile(depth + 1)
+	}
+	if isLeaf {
+		return c.compileLeaf()
+	}
+	return nil
+}
+
+// compileLeaf 校验叶子条件
+func (c *Condition) compileLeaf() error {
+	switch c.Field {
+	case FieldQuery, FieldCookie, FieldHeader:
+		if c.Key == "" {
+			return fmt.Errorf("field %s requires a key", c.Field)
+		}
+	case FieldPath, FieldMethod, FieldHost, FieldReferrer, FieldDevice, FieldGeo:
+	case FieldTime, FieldDate, FieldWeekday:
+		return c.compileTemporal()
+	default:
+		return fmt.Errorf("unknown condition field %q", c.Field)
+	}
+
+	switch c.Op {
+	case OpEquals, OpNotEquals, OpContains, OpPrefix, OpSuffix:
+		if c.Value == "" {
+			return fmt.Errorf("operator %s requires a value", c.Op)
+		}
+	case OpGlob:
+		if _, err := path.Match(c.Value, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", c.Value, err)
+		}
+	case OpRegex:
+		pattern := c.Value
+		if !c.CaseSensitive {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q: %w", c.Value, err)
+		}
+		c.regex = re
+	case OpIn:
+		if len(c.Values) == 0 {
+			return fmt.Errorf("operator in requires values")
+		}
+	case OpExists:
+	default:
+		return fmt.Errorf("operator %q is not supported for field %s", c.Op, c.Field)
+	}
+	return nil
+}
+
+// compileTemporal 校验时间类条件
+func (c *Condition) compileTemporal() error {
+	c.location = time.UTC
+	if c.Timezone != "" {
+		location, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+		}
+		c.location = location
+	}
+
+	layout := ""
+	switch c.Field {
+	case FieldTime:
+		layout = "15:04"
+	case FieldDate:
+		layout = "2006-01-02"
+	case FieldWeekday:
+		if c.Op != OpIn && c.Op != OpEquals {
+			return fmt.Errorf("field weekday supports only eq and in")
+		}
+		for _, day := range append(c.Values, c.Value) {
+			if day != "" && parseWeekday(day) < 0 {
+				return fmt.Errorf("invalid weekday %q", day)
+			}
+		}
+		return nil
+	}
+
+	if c.Op != OpBetween {
+		return fmt.Errorf("field %s supports only between", c.Field)
+	}
+	if len(c.Values) != 2 {
+		return fmt.Errorf("operator between requires exactly two values")
+	}
+	for i, value := range c.Values {
+		parsed, err := time.Parse(layout, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q", c.Field, value)
+		}
+		// 规范化格式，求值时按字符串比较
+		c.Values[i] = parsed.Format(layout)
+	}
+	return nil
+}
+
+// parseWeekday 解析星期缩写，无效时返回-1
+func parseWeekday(day string) time.Weekday {
+	switch strings.ToLower(day) {
+	case "sun", "sunday":
+		return time.Sunday
+	case "mon", "monday":
+		return time.Monday
+	case "tue", "tuesday":
+		return time.Tuesday
+	case "wed", "wednesday":
+		return time.Wednesday
+	case "thu", "thursday":
+		return time.Thursday
+	case "fri", "friday":
+		return time.Friday
+	case "sat", "saturday":
+		return time.Saturday
+	}
+	return -1
+}
@@ -0,0 +1,92 @@
+package ruledsl
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 设备类型
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+)
+
+// countryHeaders 上游CDN/负载均衡写入的国家代码请求头，按优先级排列
+var countryHeaders = []string{"CF-IPCountry", "X-Country-Code", "X-Geo-Country", "X-AppEngine-Country", "CloudFront-Viewer-Country"}
+
+// Context 条件求值所需的请求信息
+type Context struct {
+	Method   string
+	Host     string
+	Path     string
+	Query    url.Values
+	Headers  http.Header
+	Cookies  map[string]string
+	Referrer string
+	Device   string
+	Country  string
+	Now      time.Time
+}
+
+// NewContext 从HTTP请求构建求值上下文
+func NewContext(r *http.Request, now time.Time) *Context {
+	cookies := make(map[string]string)
+	for _, cookie := range r.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+
+	return &Context{
+		Method:   r.Method,
+		Host:     r.Host,
+		Path:     r.URL.Path,
+		Query:    r.URL.Query(),
+		Headers:  r.Header,
+		Cookies:  cookies,
+		Referrer: r.Referer(),
+		Device:   DeviceClass(r.UserAgent()),
+		Country:  CountryFromRequest(r),
+		Now:      now,
+	}
+}
+
+// DeviceClass 根据User-Agent粗略判断设备类型
+func DeviceClass(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return DeviceDesktop
+	case containsAny(ua, "bot", "crawler", "spider", "slurp", "headless", "curl/", "wget/", "python-requests"):
+		return DeviceBot
+	case containsAny(ua, "ipad", "tablet", "kindle", "silk/", "playbook") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return DeviceTablet
+	case containsAny(ua, "mobile", "iphone", "ipod", "android", "windows phone", "blackberry", "opera mini"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
+
+// CountryFromRequest 从上游写入的请求头中读取国家代码
+func CountryFromRequest(r *http.Request) string {
+	for _, header := range countryHeaders {
+		if value := strings.TrimSpace(r.Header.Get(header)); value != "" {
+			return strings.ToUpper(value)
+		}
+	}
+	return ""
+}
+
+// containsAny 检查字符串是否包含任一子串
+func containsAny(s string, substrings ...string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
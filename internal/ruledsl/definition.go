@@ -0,0 +1,270 @@
+package ruledsl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CurrentVersion 当前规则定义版本
+//
+// 版本历史：
+//   - 1：TriggerConditions 为 {"selector","action","position","when"}，Actions 为 {"content"}
+//   - 2：TriggerConditions 为 Trigger，Actions 为 ActionSet，支持多个动作
+const CurrentVersion = 2
+
+// 规则动作类型
+const (
+	ActionAppend          = "append"
+	ActionPrepend         = "prepend"
+	ActionReplace         = "replace"
+	ActionRemove          = "remove"
+	ActionModifyText      = "modify_text"
+	ActionModifyAttribute = "modify_attribute"
+)
+
+// 动作插入位置
+const (
+	PositionBefore      = "before"
+	PositionAfter       = "after"
+	PositionInside      = "inside"
+	PositionInsideStart = "inside_start"
+	PositionReplace     = "replace"
+)
+
+// Trigger 规则触发定义，存储于 Rule.TriggerConditions
+type Trigger struct {
+	Version  int        `json:"version"`
+	Selector string     `json:"selector"`       // CSS选择器
+	When     *Condition `json:"when,omitempty"` // 请求级触发条件
+}
+
+// Action 规则动作
+type Action struct {
+	Type      string `json:"type"`
+	Position  string `json:"position,omitempty"`  // append、prepend 的插入位置
+	Content   string `json:"content,omitempty"`   // 插入或替换的HTML、文本内容
+	Attribute string `json:"attribute,omitempty"` // modify_attribute 的属性名
+	Value     string `json:"value,omitempty"`     // modify_attribute 的属性值
+}
+
+// ActionSet 规则动作列表，存储于 Rule.Actions，按顺序作用于每个匹配节点
+type ActionSet struct {
+	Version int      `json:"version"`
+	Actions []Action `json:"actions"`
+}
+
+// Definition 完整的规则定义
+type Definition struct {
+	Trigger Trigger
+	Actions ActionSet
+}
+
+// legacyTrigger 版本1的触发条件
+type legacyTrigger struct {
+	Selector string          `json:"selector"`
+	Action   string          `json:"action"`
+	Position string          `json:"position"`
+	When     json.RawMessage `json:"when"`
+}
+
+// NewDefinition 创建当前版本的规则定义
+func NewDefinition(selector string, when *Condition, actions ...Action) *Definition {
+	return &Definition{
+		Trigger: Trigger{Version: CurrentVersion, Selector: selector, When: when},
+		Actions: ActionSet{Version: CurrentVersion, Actions: actions},
+	}
+}
+
+// ParseDefinition 解析规则的两个JSON字段，旧版本定义会升级为当前版本
+func ParseDefinition(triggerJSON, actionsJSON string) (*Definition, error) {
+	var probe struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(triggerJSON), &probe); err != nil {
+		return nil, fmt.Errorf("invalid trigger conditions: %w", err)
+	}
+
+	switch {
+	case probe.Version == CurrentVersion:
+		return parseCurrent(triggerJSON, actionsJSON)
+	case probe.Version <= 1:
+		return upgradeLegacy(triggerJSON, actionsJSON)
+	default:
+		return nil, fmt.Errorf("unsupported rule definition version %d", probe.Version)
+	}
+}
+
+// parseCurrent 按当前版本的JSON Schema校验并解析
+func parseCurrent(triggerJSON, actionsJSON string) (*Definition, error) {
+	if err := ValidateJSON(TriggerSchema, []byte(triggerJSON)); err != nil {
+		return nil, fmt.Errorf("invalid trigger conditions: %w", err)
+	}
+	if err := ValidateJSON(ActionsSchema, []byte(actionsJSON)); err != nil {
+		return nil, fmt.Errorf("invalid actions: %w", err)
+	}
+
+	var def Definition
+	if err := json.Unmarshal([]byte(triggerJSON), &def.Trigger); err != nil {
+		return nil, fmt.Errorf("invalid trigger conditions: %w", err)
+	}
+	if err := json.Unmarshal([]byte(actionsJSON), &def.Actions); err != nil {
+		return nil, fmt.Errorf("invalid actions: %w", err)
+	}
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// upgradeLegacy 将版本1的定义升级为当前版本
+func upgradeLegacy(triggerJSON, actionsJSON string) (*Definition, error) {
+	var legacy legacyTrigger
+	if err := json.Unmarshal([]byte(triggerJSON), &legacy); err != nil {
+		return nil, fmt.Errorf("invalid trigger conditions: %w", err)
+	}
+
+	var legacyActions struct {
+		Content string `json:"content"`
+	}
+	if strings.TrimSpace(actionsJSON) != "" {
+		if err := json.Unmarshal([]byte(actionsJSON), &legacyActions); err != nil {
+			return nil, fmt.Errorf("invalid actions: %w", err)
+		}
+	}
+
+	when, err := Parse(legacy.When)
+	if err != nil {
+		return nil, err
+	}
+
+	action, err := LegacyAction(legacy.Action, legacy.Position, legacyActions.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	def := NewDefinition(legacy.Selector, when, action)
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// LegacyAction 将单个动作的扁平字段转换为动作定义
+func LegacyAction(actionType, position, content string) (Action, error) {
+	action := Action{Type: actionType, Position: position, Content: content}
+
+	switch actionType {
+	case ActionPrepend:
+		if position == "" || position == PositionInside {
+			action.Position = PositionInsideStart
+		}
+	case ActionModifyAttribute:
+		// 版本1使用 name=value 形式的内容
+		key, value, ok := strings.Cut(content, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return Action{}, fmt.Errorf("modify_attribute content must be in the form name=value")
+		}
+		action.Attribute = key
+		action.Value = strings.Trim(strings.TrimSpace(value), `"'`)
+		action.Content = ""
+		action.Position = ""
+	case ActionRemove, ActionModifyText, ActionReplace:
+		action.Position = ""
+	}
+	return action, nil
+}
+
+// Validate 校验定义的语义约束，JSON Schema 无法表达的部分在这里检查
+func (d *Definition) Validate() error {
+	if strings.TrimSpace(d.Trigger.Selector) == "" {
+		return fmt.Errorf("selector is required")
+	}
+	if d.Trigger.When != nil {
+		if err := d.Trigger.When.Compile(); err != nil {
+			return fmt.Errorf("invalid conditions: %w", err)
+		}
+	}
+	if len(d.Actions.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+
+	for i, action := range d.Actions.Actions {
+		if err := action.validate(); err != nil {
+			return fmt.Errorf("actions[%d]: %w", i, err)
+		}
+		// 节点被移除或替换后，后续动作无法继续作用于该节点
+		if (action.Type == ActionRemove || action.Type == ActionReplace) && i != len(d.Actions.Actions)-1 {
+			return fmt.Errorf("actions[%d]: %s must be the last action", i, action.Type)
+		}
+	}
+	return nil
+}
+
+// validate 校验单个动作
+func (a Action) validate() error {
+	switch a.Type {
+	case ActionAppend, ActionPrepend:
+		if a.Content == "" {
+			return fmt.Errorf("%s requires content", a.Type)
+		}
+		switch a.Position {
+		case "", PositionBefore, PositionAfter, PositionInside, PositionInsideStart:
+		default:
+			return fmt.Errorf("invalid position %q for %s", a.Position, a.Type)
+		}
+	case ActionReplace:
+		if a.Position != "" && a.Position != PositionReplace {
+			return fmt.Errorf("replace does not accept a position")
+		}
+	case ActionRemove, ActionModifyText:
+		if a.Position != "" {
+			return fmt.Errorf("%s does not accept a position", a.Type)
+		}
+	case ActionModifyAttribute:
+		if a.Attribute == "" {
+			return fmt.Errorf("modify_attribute requires an attribute")
+		}
+	default:
+		return fmt.Errorf("unsupported action %q", a.Type)
+	}
+	return nil
+}
+
+// Marshal 序列化为 Rule.TriggerConditions 和 Rule.Actions 字段的值
+func (d *Definition) Marshal() (string, string, error) {
+	d.Trigger.Version = CurrentVersion
+	d.Actions.Version = CurrentVersion
+
+	trigger, err := marshalNoEscape(d.Trigger)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal trigger conditions: %w", err)
+	}
+	actions, err := marshalNoEscape(d.Actions)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal actions: %w", err)
+	}
+	return trigger, actions, nil
+}
+
+// ActionTypes 返回动作类型列表
+func (d *Definition) ActionTypes() []string {
+	types := make([]string, 0, len(d.Actions.Actions))
+	for _, action := range d.Actions.Actions {
+		types = append(types, action.Type)
+	}
+	return types
+}
+
+// marshalNoEscape 序列化JSON且不转义HTML字符，保持注入内容可读
+func marshalNoEscape(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
@@ -0,0 +1,158 @@
+package ruledsl
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Evaluate 对请求上下文求值，nil条件视为始终满足
+func (c *Condition) Evaluate(ctx *Context) bool {
+	if c == nil {
+		return true
+	}
+
+	switch {
+	case len(c.All) > 0:
+		for _, child := range c.All {
+			if !child.Evaluate(ctx) {
+				return false
+			}
+		}
+		return true
+	case len(c.Any) > 0:
+		for _, child := range c.Any {
+			if child.Evaluate(ctx) {
+				return true
+			}
+		}
+		return false
+	case c.Not != nil:
+		return !c.Not.Evaluate(ctx)
+	}
+
+	switch c.Field {
+	case FieldTime, FieldDate, FieldWeekday:
+		return c.evaluateTemporal(ctx.Now)
+	}
+
+	value, present := c.lookup(ctx)
+	return c.compare(value, present)
+}
+
+// lookup 读取叶子条件对应的请求值
+func (c *Condition) lookup(ctx *Context) (string, bool) {
+	switch c.Field {
+	case FieldPath:
+		return ctx.Path, true
+	case FieldMethod:
+		return ctx.Method, true
+	case FieldHost:
+		return ctx.Host, true
+	case FieldReferrer:
+		return ctx.Referrer, ctx.Referrer != ""
+	case FieldDevice:
+		return ctx.Device, true
+	case FieldGeo:
+		return ctx.Country, ctx.Country != ""
+	case FieldQuery:
+		values, ok := ctx.Query[c.Key]
+		if !ok || len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	case FieldCookie:
+		value, ok := ctx.Cookies[c.Key]
+		return value, ok
+	case FieldHeader:
+		values, ok := ctx.Headers[http.CanonicalHeaderKey(c.Key)]
+		if !ok || len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	}
+	return "", false
+}
+
+// compare 按操作符比较请求值
+func (c *Condition) compare(value string, present bool) bool {
+	if c.Op == OpExists {
+		return present
+	}
+	if !present {
+		// 缺失的值只满足否定比较
+		return c.Op == OpNotEquals
+	}
+
+	if c.Op == OpRegex {
+		return c.regex.MatchString(value)
+	}
+
+	expected := c.Value
+	if !c.CaseSensitive {
+		value = strings.ToLower(value)
+		expected = strings.ToLower(expected)
+	}
+
+	switch c.Op {
+	case OpEquals:
+		return value == expected
+	case OpNotEquals:
+		return value != expected
+	case OpContains:
+		return strings.Contains(value, expected)
+	case OpPrefix:
+		return strings.HasPrefix(value, expected)
+	case OpSuffix:
+		return strings.HasSuffix(value, expected)
+	case OpGlob:
+		matched, _ := path.Match(expected, value)
+		return matched
+	case OpIn:
+		for _, candidate := range c.Values {
+			if !c.CaseSensitive {
+				candidate = strings.ToLower(candidate)
+			}
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evaluateTemporal 对时间类条件求值
+func (c *Condition) evaluateTemporal(now time.Time) bool {
+	location := c.location
+	if location == nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+
+	switch c.Field {
+	case FieldWeekday:
+		days := c.Values
+		if c.Value != "" {
+			days = append([]string{c.Value}, days...)
+		}
+		for _, day := range days {
+			if parseWeekday(day) == local.Weekday() {
+				return true
+			}
+		}
+		return false
+	case FieldTime:
+		current := local.Format("15:04")
+		start, end := c.Values[0], c.Values[1]
+		if start <= end {
+			return current >= start && current < end
+		}
+		// 跨午夜的时间段，如 22:00 - 06:00
+		return current >= start || current < end
+	case FieldDate:
+		current := local.Format("2006-01-02")
+		return current >= c.Values[0] && current <= c.Values[1]
+	}
+	return false
+}
@@ -0,0 +1,314 @@
+package ruledsl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// TriggerSchema Rule.TriggerConditions 的 JSON Schema（draft-07）
+const TriggerSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "RuleTrigger",
+  "type": "object",
+  "required": ["version", "selector"],
+  "additionalProperties": false,
+  "properties": {
+    "version": {"type": "integer", "enum": [2]},
+    "selector": {"type": "string", "minLength": 1, "maxLength": 1000},
+    "when": {"$ref": "#/definitions/condition"}
+  },
+  "definitions": {
+    "condition": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "all": {"type": "array", "minItems": 1, "items": {"$ref": "#/definitions/condition"}},
+        "any": {"type": "array", "minItems": 1, "items": {"$ref": "#/definitions/condition"}},
+        "not": {"$ref": "#/definitions/condition"},
+        "field": {"type": "string", "enum": ["path", "query", "cookie", "header", "method", "host", "referrer", "device", "geo", "time", "date", "weekday"]},
+        "key": {"type": "string", "maxLength": 200},
+        "op": {"type": "string", "enum": ["eq", "neq", "contains", "prefix", "suffix", "glob", "regex", "in", "exists", "between"]},
+        "value": {"type": "string", "maxLength": 2000},
+        "values": {"type": "array", "maxItems": 500, "items": {"type": "string", "maxLength": 2000}},
+        "case_sensitive": {"type": "boolean"},
+        "timezone": {"type": "string", "maxLength": 64}
+      }
+    }
+  }
+}`
+
+// ActionsSchema Rule.Actions 的 JSON Schema（draft-07）
+const ActionsSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "RuleActions",
+  "type": "object",
+  "required": ["version", "actions"],
+  "additionalProperties": false,
+  "properties": {
+    "version": {"type": "integer", "enum": [2]},
+    "actions": {"type": "array", "minItems": 1, "maxItems": 20, "items": {"$ref": "#/definitions/action"}}
+  },
+  "definitions": {
+    "action": {
+      "type": "object",
+      "required": ["type"],
+      "additionalProperties": false,
+      "properties": {
+        "type": {"type": "string", "enum": ["append", "prepend", "replace", "remove", "modify_text", "modify_attribute"]},
+        "position": {"type": "string", "enum": ["before", "after", "inside", "inside_start", "replace"]},
+        "content": {"type": "string", "maxLength": 200000},
+        "attribute": {"type": "string", "pattern": "^[A-Za-z_:][-A-Za-z0-9_:.]*$", "maxLength": 100},
+        "value": {"type": "string", "maxLength": 10000}
+      }
+    }
+  }
+}`
+
+// jsonSchema 支持的 JSON Schema 子集：type、enum、properties、required、
+// additionalProperties（布尔）、items、min/maxItems、min/maxLength、pattern、$ref
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaCache 已解析的Schema缓存
+var schemaCache sync.Map
+
+// ValidationError Schema校验错误，包含全部违反约束的路径
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// ValidateJSON 按 JSON Schema 校验JSON文档
+func ValidateJSON(schemaJSON string, document []byte) error {
+	schema, err := loadSchema(schemaJSON)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	v := &schemaValidator{root: schema}
+	v.validate(schema, value, "$")
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// loadSchema 解析并缓存Schema
+func loadSchema(schemaJSON string) (*jsonSchema, error) {
+	if cached, ok := schemaCache.Load(schemaJSON); ok {
+		return cached.(*jsonSchema), nil
+	}
+
+	var schema jsonSchema
+	if err := json.Unmarshal([]byte(schemaJSON), &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if err := compilePatterns(&schema); err != nil {
+		return nil, err
+	}
+	schemaCache.Store(schemaJSON, &schema)
+	return &schema, nil
+}
+
+// compilePatterns 预编译Schema中的正则
+func compilePatterns(s *jsonSchema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid schema pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for _, child := range s.Properties {
+		if err := compilePatterns(child); err != nil {
+			return err
+		}
+	}
+	for _, child := range s.Definitions {
+		if err := compilePatterns(child); err != nil {
+			return err
+		}
+	}
+	return compilePatterns(s.Items)
+}
+
+// schemaValidator 单次校验的状态
+type schemaValidator struct {
+	root     *jsonSchema
+	problems []string
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) validate(s *jsonSchema, value interface{}, path string) {
+	if s.Ref != "" {
+		resolved, err := v.resolve(s.Ref)
+		if err != nil {
+			v.fail(path, "%s", err.Error())
+			return
+		}
+		s = resolved
+	}
+
+	if s.Type != "" && !matchesType(s.Type, value) {
+		v.fail(path, "expected %s", s.Type)
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		allowed := make([]string, 0, len(s.Enum))
+		for _, e := range s.Enum {
+			allowed = append(allowed, fmt.Sprint(e))
+		}
+		v.fail(path, "must be one of %s", strings.Join(allowed, ", "))
+	}
+
+	switch typed := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(typed)
+		if s.MinLength != nil && length < *s.MinLength {
+			v.fail(path, "must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			v.fail(path, "must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(typed) {
+			v.fail(path, "does not match pattern %s", s.Pattern)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(typed) < *s.MinItems {
+			v.fail(path, "must contain at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(typed) > *s.MaxItems {
+			v.fail(path, "must contain at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range typed {
+				v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := typed[name]; !ok {
+				v.fail(path, "missing required property %q", name)
+			}
+		}
+
+		// 按键排序，保证错误信息顺序稳定
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					v.fail(path, "unknown property %q", key)
+				}
+				continue
+			}
+			v.validate(child, typed[key], path+"."+key)
+		}
+	}
+}
+
+// resolve 解析本文档内的 #/definitions/xxx 引用
+func (v *schemaValidator) resolve(ref string) (*jsonSchema, error) {
+	name, ok := strings.CutPrefix(ref, "#/definitions/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	s, ok := v.root.Definitions[name]
+	if !ok {
+		return nil, errors.New("unresolved $ref " + ref)
+	}
+	return s, nil
+}
+
+// matchesType 检查值是否符合Schema类型
+func matchesType(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := number.Int64()
+		return err == nil
+	}
+	return false
+}
+
+// inEnum 检查值是否在枚举中
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, candidate := range enum {
+		switch c := candidate.(type) {
+		case float64:
+			if number, ok := value.(json.Number); ok {
+				if f, err := number.Float64(); err == nil && f == c {
+					return true
+				}
+			}
+		default:
+			if candidate == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// AuditService 审计日志服务
+type AuditService struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewAuditService 创建新的审计日志服务
+func NewAuditService(db *gorm.DB, logger logger.Logger) *AuditService {
+	return &AuditService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Record 记录审计日志
+func (s *AuditService) Record(entry *AuditEntry) error {
+	return s.RecordTx(s.db, entry)
+}
+
+// RecordTx 在指定事务中记录审计日志，与被审计的变更一起提交或回滚
+func (s *AuditService) RecordTx(tx *gorm.DB, entry *AuditEntry) error {
+	details := "{}"
+	if len(entry.Details) > 0 {
+		data, err := json.Marshal(entry.Details)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit details: %w", err)
+		}
+		details = string(data)
+	}
+
+	log := &models.AuditLog{
+		Action:       entry.Action,
+		ResourceType: entry.ResourceType,
+		ResourceID:   entry.ResourceID,
+		ActorID:      entry.ActorID,
+		Details:      details,
+	}
+	if err := tx.Create(log).Error; err != nil {
+		return fmt.Errorf("failed to record audit log: %w", err)
+	}
+	return nil
+}
+
+// ListAuditLogs 分页查询审计日志，按时间倒序
+func (s *AuditService) ListAuditLogs(page, pageSize int, filter *AuditLogFilter) ([]*models.AuditLog, int64, error) {
+	query := s.db.Model(&models.AuditLog{})
+	if filter != nil {
+		if filter.Action != "" {
+			query = query.Where("action = ?", filter.Action)
+		}
+		if filter.ResourceType != "" {
+			query = query.Where("resource_type = ?", filter.ResourceType)
+		}
+		if filter.ResourceID != "" {
+			query = query.Where("resource_id = ?", filter.ResourceID)
+		}
+		if filter.ActorID != nil {
+			query = query.Where("actor_id = ?", *filter.ActorID)
+		}
+		if filter.From != nil {
+			query = query.Where("created_at >= ?", *filter.From)
+		}
+		if filter.To != nil {
+			query = query.Where("created_at < ?", *filter.To)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit logs: %w", err)
+	}
+
+	var logs []*models.AuditLog
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit logs: %w", err)
+	}
+
+	return logs, total, nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 审计操作
+const (
+	AuditActionPopupActivated   = "popup.activated"   // 弹窗进入投放时间
+	AuditActionPopupDeactivated = "popup.deactivated" // 弹窗离开每周投放时段，或排期被修改为未开始
+	AuditActionPopupExpired     = "popup.expired"     // 弹窗超过投放结束时间
+
+	AuditActionSubmissionStatusChanged = "submission.status_changed" // 提交处理状态变更
+	AuditActionSubmissionTagsChanged   = "submission.tags_changed"   // 提交标签变更
+	AuditActionSubmissionAssigned      = "submission.assigned"       // 提交负责人变更
+	AuditActionSubmissionNoteAdded     = "submission.note_added"     // 添加提交备注
+	AuditActionSubmissionDecrypted     = "submission.decrypted"      // 查看提交敏感字段原文
+	AuditActionSubmissionsExported     = "submission.exported"       // 导出包含敏感字段原文的提交数据
+	AuditActionSubmissionDelivered     = "submission.delivered"      // 通过Webhook或通知邮件发送敏感字段原文
+
+	AuditActionDataKeyRotated      = "data_key.rotated"             // 轮换数据密钥
+	AuditActionDecryptRolesChanged = "permission.decrypt_roles_set" // 设置拥有解密权限的角色
+
+	AuditActionRetentionApplied = "retention.applied" // 清理任务删除或匿名化超过保留期限的数据
+	AuditActionSubjectErased    = "subject.erased"    // 按邮箱或手机号删除个人的所有提交
+)
+
+// 审计资源类型
+const (
+	AuditResourcePopup      = "popup"
+	AuditResourceSubmission = "submission"
+	AuditResourceDataKey    = "data_key"
+	AuditResourcePermission = "permission"
+	AuditResourceTable      = "table"
+	AuditResourceSubject    = "subject" // 资源ID为邮箱和手机号的带密钥哈希，没有密钥时为空，不记录原文
+)
+
+// AuditEntry 审计日志记录请求
+type AuditEntry struct {
+	Action       string
+	ResourceType string
+	ResourceID   string
+	ActorID      *uuid.UUID // 为nil表示系统自动执行
+	Details      map[string]interface{}
+}
+
+// AuditLogFilter 审计日志查询条件
+type AuditLogFilter struct {
+	Action       string
+	ResourceType string
+	ResourceID   string
+	ActorID      *uuid.UUID
+	From         *time.Time
+	To           *time.Time
+}
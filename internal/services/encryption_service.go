@@ -0,0 +1,877 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-enhancer-ultra/internal/config"
+	"proxy-enhancer-ultra/internal/fieldcrypt"
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// clientInfoAAD 加密客户端信息时使用的附加数据，与表单字段名区分
+const clientInfoAAD = "$client_info"
+
+// dataKeysLockSQL 创建和轮换数据密钥时持有的事务级咨询锁，避免多个实例同时创建 active 密钥
+const dataKeysLockSQL = "SELECT pg_advisory_xact_lock(hashtext('data_keys'))"
+
+// EncryptionService 提交数据敏感字段加密服务
+//
+// 表单配置中标记为 sensitive 的字段使用数据密钥加密后保存，数据密钥由配置中的主密钥包装后保存在
+// data_keys 表中。轮换数据密钥后，后台任务把使用旧密钥加密的提交重新加密；更换主密钥后，
+// 服务启动时用新的主密钥重新包装所有数据密钥。只有角色拥有 submission:decrypt 权限的用户可以查看原文，
+// 其他地方显示加密时保存的脱敏文本。未配置主密钥时不加密
+type EncryptionService struct {
+	db       *gorm.DB
+	logger   logger.Logger
+	cfg      config.EncryptionConfig
+	audit    *AuditService
+	master   []byte
+	previous map[string][]byte
+	// fingerprintKey 未配置字段加密时计算带密钥哈希的服务端密钥
+	fingerprintKey []byte
+
+	mu      sync.RWMutex
+	keyring *fieldcrypt.Keyring
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewEncryptionService 创建新的字段加密服务，主密钥格式无效时返回错误
+func NewEncryptionService(db *gorm.DB, logger logger.Logger, cfg config.EncryptionConfig, fingerprintSecret []byte, audit *AuditService) (*EncryptionService, error) {
+	cfg = cfg.WithDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &EncryptionService{
+		db:             db,
+		logger:         logger,
+		cfg:            cfg,
+		audit:          audit,
+		previous:       make(map[string][]byte),
+		fingerprintKey: fingerprintSecret,
+		keyring:        fieldcrypt.NewKeyring(),
+		wake:           make(chan struct{}, 1),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+	if strings.TrimSpace(cfg.MasterKey) == "" {
+		return s, nil
+	}
+
+	master, err := fieldcrypt.ParseKey(cfg.MasterKey)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("invalid encryption master key: %w", err)
+	}
+	s.master = master
+	for id, encoded := range cfg.PreviousMasterKeys {
+		if id == cfg.MasterKeyID {
+			cancel()
+			return nil, fmt.Errorf("previous master key %q has the same id as the current master key", id)
+		}
+		key, err := fieldcrypt.ParseKey(encoded)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid previous master key %q: %w", id, err)
+		}
+		s.previous[id] = key
+	}
+	return s, nil
+}
+
+// Enabled 是否配置了主密钥
+func (s *EncryptionService) Enabled() bool {
+	return s != nil && s.master != nil
+}
+
+// Load 加载数据密钥，使用旧主密钥包装的密钥用当前主密钥重新包装，没有 active 密钥时创建新密钥
+func (s *EncryptionService) Load() error {
+	if !s.Enabled() {
+		return nil
+	}
+	keyring := fieldcrypt.NewKeyring()
+	rewrapped := 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(dataKeysLockSQL).Error; err != nil {
+			return err
+		}
+		var keys []*models.DataKey
+		if err := tx.Order("created_at").Find(&keys).Error; err != nil {
+			return err
+		}
+
+		hasData, hasIndex := false, false
+		for _, key := range keys {
+			raw, err := s.unwrap(key)
+			if err != nil {
+				return fmt.Errorf("data key %s: %w", key.ID, err)
+			}
+			if key.MasterKeyID != s.cfg.MasterKeyID {
+				wrapped, err := fieldcrypt.Wrap(s.master, raw, s.cfg.MasterKeyID)
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(key).Updates(map[string]interface{}{
+					"wrapped_key":   wrapped,
+					"master_key_id": s.cfg.MasterKeyID,
+				}).Error; err != nil {
+					return err
+				}
+				rewrapped++
+			}
+
+			active := key.Status == DataKeyStatusActive
+			switch key.Purpose {
+			case DataKeyPurposeIndex:
+				if active {
+					keyring.SetIndexKey(raw)
+					hasIndex = true
+				}
+			default:
+				keyring.Add(key.ID.String(), raw, active)
+				hasData = hasData || active
+			}
+		}
+
+		if !hasData {
+			key, raw, err := s.createKey(tx, DataKeyPurposeData)
+			if err != nil {
+				return err
+			}
+			keyring.Add(key.ID.String(), raw, true)
+		}
+		if !hasIndex {
+			_, raw, err := s.createKey(tx, DataKeyPurposeIndex)
+			if err != nil {
+				return err
+			}
+			keyring.SetIndexKey(raw)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load data keys: %w", err)
+	}
+
+	s.mu.Lock()
+	s.keyring = keyring
+	s.mu.Unlock()
+
+	if rewrapped > 0 {
+		s.logger.WithFields(map[string]interface{}{
+			"master_key_id": s.cfg.MasterKeyID,
+			"keys":          rewrapped,
+		}).Info("Data keys rewrapped with the current master key")
+	}
+	return nil
+}
+
+// Start 启动后台任务，定期重新加载密钥并重新加密使用已停用密钥的提交，未配置主密钥时不启动
+func (s *EncryptionService) Start() {
+	if !s.Enabled() {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(encryptionRekeyInterval)
+		defer ticker.Stop()
+		for {
+			s.rekeyRetired()
+			select {
+			case <-ticker.C:
+				if err := s.Load(); err != nil {
+					s.logger.WithFields(map[string]interface{}{
+						"error": err.Error(),
+					}).Error("Failed to reload data keys")
+				}
+			case <-s.wake:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]interface{}{
+		"master_key_id":       s.cfg.MasterKeyID,
+		"encrypt_client_info": s.cfg.EncryptClientInfo,
+	}).Info("Field encryption enabled")
+}
+
+// Stop 停止后台任务，未完成的重新加密在下次启动后继续
+func (s *EncryptionService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// SealSubmission 把明文表单数据写入 submission.FormData，同时加密表单配置中的敏感字段，
+// 启用客户端信息加密时加密 UserIP 和 UserAgent，数据库中只保留IP所在的网段
+func (s *EncryptionService) SealSubmission(submission *models.Submission, form *popupspec.FormConfig, data map[string]interface{}) error {
+	submission.EncryptionKeyID = nil
+	submission.ClientInfo = ""
+	if s.Enabled() {
+		keyring := s.current()
+		encrypted := false
+		if form != nil {
+			for _, name := range form.SensitiveFields() {
+				value, ok := data[name]
+				if !ok || value == nil {
+					continue
+				}
+				sealed, err := fieldcrypt.Seal(keyring, name, value)
+				if err != nil {
+					return fmt.Errorf("failed to encrypt field %s: %w", name, err)
+				}
+				data[name] = sealed
+				encrypted = true
+			}
+		}
+		if s.cfg.EncryptClientInfo && (submission.UserIP != "" || submission.UserAgent != "") {
+			info, err := json.Marshal(clientInfo{IP: submission.UserIP, UserAgent: submission.UserAgent})
+			if err != nil {
+				return err
+			}
+			token, err := keyring.Encrypt(info, []byte(clientInfoAAD))
+			if err != nil {
+				return fmt.Errorf("failed to encrypt client info: %w", err)
+			}
+			submission.ClientInfo = token
+			submission.UserIP = anonymizeIP(submission.UserIP)
+			submission.UserAgent = ""
+			encrypted = true
+		}
+		if encrypted {
+			id, err := uuid.Parse(keyring.Active())
+			if err != nil {
+				return errors.New("no active data key")
+			}
+			submission.EncryptionKeyID = &id
+		}
+	}
+
+	formDataJSON, err := json.Marshal(data)
+	if err != nil {
+		return errors.New("invalid form data")
+	}
+	submission.FormData = string(formDataJSON)
+	return nil
+}
+
+// OpenSubmission 解密提交记录，返回明文表单数据，并把加密保存的IP和浏览器信息还原到 submission
+func (s *EncryptionService) OpenSubmission(submission *models.Submission) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(submission.FormData), &data); err != nil || data == nil {
+		data = make(map[string]interface{})
+	}
+	if submission.EncryptionKeyID == nil {
+		return data, nil
+	}
+	if !s.Enabled() {
+		return nil, errors.New("submission contains encrypted fields but field encryption is not configured")
+	}
+
+	if _, err := s.OpenFields(data); err != nil {
+		return nil, err
+	}
+
+	if submission.ClientInfo != "" {
+		plaintext, err := s.decrypt(submission.ClientInfo, []byte(clientInfoAAD))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt client info: %w", err)
+		}
+		var info clientInfo
+		if err := json.Unmarshal(plaintext, &info); err != nil {
+			return nil, errors.New("invalid client info")
+		}
+		submission.UserIP = info.IP
+		submission.UserAgent = info.UserAgent
+		submission.ClientInfo = ""
+	}
+	return data, nil
+}
+
+// OpenFields 把表单数据中的加密字段值替换为明文，返回解密的字段数
+func (s *EncryptionService) OpenFields(data map[string]interface{}) (int, error) {
+	opened := 0
+	for name, value := range data {
+		envelope, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, _, isEnvelope := fieldcrypt.Envelope(envelope); !isEnvelope {
+			continue
+		}
+		if !s.Enabled() {
+			return 0, errors.New("submission contains encrypted fields but field encryption is not configured")
+		}
+		plain, err := s.openField(name, envelope)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt field %s: %w", name, err)
+		}
+		data[name] = plain
+		opened++
+	}
+	return opened, nil
+}
+
+// RevealSubmission 把提交记录的表单数据替换为明文，调用前应检查用户的解密权限
+func (s *EncryptionService) RevealSubmission(submission *models.Submission) error {
+	data, err := s.OpenSubmission(submission)
+	if err != nil {
+		return err
+	}
+	formDataJSON, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	submission.FormData = string(formDataJSON)
+	submission.MaskedFields = nil
+	return nil
+}
+
+// BlindIndex 返回字段值的盲索引，用于按敏感字段的值精确查找，未配置主密钥时返回 false
+func (s *EncryptionService) BlindIndex(field string, value interface{}) (string, bool) {
+	if !s.Enabled() {
+		return "", false
+	}
+	return s.current().BlindIndex(field, value)
+}
+
+// Fingerprint 返回值的带密钥哈希，用于保存后不能反推原文的标识，如提交去重键和审计日志中的数据主体
+// 配置了字段加密时使用盲索引密钥，否则使用服务端密钥，都没有时返回 false，调用方不能退回到无密钥的哈希
+func (s *EncryptionService) Fingerprint(purpose string, value interface{}) (string, bool) {
+	if fingerprint, ok := s.BlindIndex(purpose, value); ok {
+		return fingerprint, true
+	}
+	if s == nil {
+		return "", false
+	}
+	return fieldcrypt.KeyedIndex(s.fingerprintKey, purpose, value)
+}
+
+// SensitiveFieldNames 返回弹窗表单中标记为敏感的字段名，popupID 为空时返回所有弹窗的敏感字段，未配置主密钥时返回空列表
+// 启用加密后这些字段的值以密文保存，只能通过盲索引精确查找
+func (s *EncryptionService) SensitiveFieldNames(popupID *uuid.UUID) ([]string, error) {
+	if !s.Enabled() {
+		return nil, nil
+	}
+	query := s.db.Unscoped().Model(&models.Popup{}).Where("form_config IS NOT NULL AND form_config <> '{}'::jsonb")
+	if popupID != nil {
+		query = query.Where("id = ?", *popupID)
+	}
+	var configs []string
+	if err := query.Pluck("form_config", &configs).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, raw := range configs {
+		form, err := popupspec.ParseFormConfig(raw)
+		if err != nil || form == nil {
+			continue
+		}
+		for _, name := range form.SensitiveFields() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CanDecrypt 用户的角色是否拥有解密权限
+func (s *EncryptionService) CanDecrypt(userID uuid.UUID) (bool, error) {
+	var count int64
+	err := s.db.Table("user_roles").
+		Joins("JOIN role_permissions ON role_permissions.role_id = user_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("user_roles.user_id = ? AND permissions.name = ?", userID, PermissionSubmissionDecrypt).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// AuthorizeDecrypt 检查用户的解密权限并记录审计日志，没有权限时返回 ErrDecryptForbidden
+func (s *EncryptionService) AuthorizeDecrypt(actor SubmissionActor, action, resourceType, resourceID string, details map[string]interface{}) error {
+	allowed, err := s.CanDecrypt(actor.UserID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		s.logger.WithFields(map[string]interface{}{
+			"user_id":     actor.UserID,
+			"username":    actor.Username,
+			"action":      action,
+			"resource_id": resourceID,
+		}).Warn("Decryption denied")
+		return ErrDecryptForbidden
+	}
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	details["username"] = actor.Username
+	return s.audit.Record(&AuditEntry{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		ActorID:      actorID(actor),
+		Details:      details,
+	})
+}
+
+// AuthorizePlaintextDelivery 启用加密时，把Webhook或通知邮件设置为发送敏感字段原文需要用户有解密权限，
+// 没有权限时返回 ErrDecryptForbidden
+func (s *EncryptionService) AuthorizePlaintextDelivery(actor SubmissionActor) error {
+	if !s.Enabled() {
+		return nil
+	}
+	allowed, err := s.CanDecrypt(actor.UserID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrDecryptForbidden
+	}
+	return nil
+}
+
+// RecordDelivery 在 tx 中记录向外部发送敏感字段原文的审计日志，操作人为系统
+func (s *EncryptionService) RecordDelivery(tx *gorm.DB, resourceType, resourceID string, details map[string]interface{}) error {
+	return s.audit.RecordTx(tx, &AuditEntry{
+		Action:       AuditActionSubmissionDelivered,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Details:      details,
+	})
+}
+
+// DecryptSubmission 返回表单数据为明文的提交记录，记录审计日志
+func (s *EncryptionService) DecryptSubmission(id uuid.UUID, actor SubmissionActor) (*models.Submission, error) {
+	var submission models.Submission
+	if err := s.db.Preload("Popup").First(&submission, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("submission not found")
+		}
+		return nil, err
+	}
+	if err := s.AuthorizeDecrypt(actor, AuditActionSubmissionDecrypted, AuditResourceSubmission, id.String(), nil); err != nil {
+		return nil, err
+	}
+	if err := s.RevealSubmission(&submission); err != nil {
+		return nil, err
+	}
+	return &submission, nil
+}
+
+// RotateDataKey 停用当前数据密钥并创建新密钥，之后的提交使用新密钥加密，已有的提交由后台任务重新加密
+func (s *EncryptionService) RotateDataKey(actor SubmissionActor) (*models.DataKey, error) {
+	if !s.Enabled() {
+		return nil, errors.New("field encryption is not configured")
+	}
+	var created *models.DataKey
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(dataKeysLockSQL).Error; err != nil {
+			return err
+		}
+		var previous models.DataKey
+		if err := tx.Where("purpose = ? AND status = ?", DataKeyPurposeData, DataKeyStatusActive).First(&previous).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("no active data key")
+			}
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&previous).Updates(map[string]interface{}{
+			"status":     DataKeyStatusRetired,
+			"retired_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		key, _, err := s.createKey(tx, DataKeyPurposeData)
+		if err != nil {
+			return err
+		}
+		created = key
+		return s.audit.RecordTx(tx, &AuditEntry{
+			Action:       AuditActionDataKeyRotated,
+			ResourceType: AuditResourceDataKey,
+			ResourceID:   key.ID.String(),
+			ActorID:      actorID(actor),
+			Details: map[string]interface{}{
+				"retired_key_id": previous.ID,
+				"username":       actor.Username,
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Load(); err != nil {
+		return nil, err
+	}
+
+	// 通知后台任务立即开始重新加密，通道已有通知时不需要重复发送
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"key_id":  created.ID,
+		"user_id": actor.UserID,
+	}).Info("Data key rotated")
+	return created, nil
+}
+
+// GetStatus 返回字段加密的配置和密钥状态
+func (s *EncryptionService) GetStatus() (*EncryptionStatus, error) {
+	status := &EncryptionStatus{
+		Enabled:           s.Enabled(),
+		EncryptClientInfo: s.Enabled() && s.cfg.EncryptClientInfo,
+		DecryptRoles:      []string{},
+		Keys:              []*DataKeyStatus{},
+	}
+	if status.Enabled {
+		status.MasterKeyID = s.cfg.MasterKeyID
+	}
+
+	if err := s.db.Model(&models.Role{}).
+		Joins("JOIN role_permissions ON role_permissions.role_id = roles.id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("permissions.name = ?", PermissionSubmissionDecrypt).
+		Order("roles.name").
+		Pluck("roles.name", &status.DecryptRoles).Error; err != nil {
+		return nil, err
+	}
+
+	var keys []*models.DataKey
+	if err := s.db.Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		EncryptionKeyID uuid.UUID
+		Count           int64
+	}
+	if err := s.db.Unscoped().Model(&models.Submission{}).
+		Select("encryption_key_id, COUNT(*) AS count").
+		Where("encryption_key_id IS NOT NULL").
+		Group("encryption_key_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	used := make(map[uuid.UUID]int64, len(counts))
+	for _, c := range counts {
+		used[c.EncryptionKeyID] = c.Count
+	}
+	for _, key := range keys {
+		status.Keys = append(status.Keys, &DataKeyStatus{DataKey: key, Submissions: used[key.ID]})
+	}
+	return status, nil
+}
+
+// UpdateDecryptRoles 设置拥有解密权限的角色
+func (s *EncryptionService) UpdateDecryptRoles(req *UpdateDecryptRolesRequest, actor SubmissionActor) ([]string, error) {
+	names := make([]string, 0, len(req.Roles))
+	seen := make(map[string]bool)
+	for _, name := range req.Roles {
+		name = strings.TrimSpace(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var roles []models.Role
+		if len(names) > 0 {
+			if err := tx.Where("name IN ?", names).Find(&roles).Error; err != nil {
+				return err
+			}
+		}
+		if len(roles) != len(names) {
+			found := make(map[string]bool, len(roles))
+			for _, role := range roles {
+				found[role.Name] = true
+			}
+			for _, name := range names {
+				if !found[name] {
+					return fmt.Errorf("role %q not found", name)
+				}
+			}
+		}
+
+		permission := models.Permission{
+			Name:     PermissionSubmissionDecrypt,
+			Resource: "submission",
+			Action:   "decrypt",
+		}
+		if err := tx.Where("name = ?", permission.Name).FirstOrCreate(&permission).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("permission_id = ?", permission.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if err := tx.Create(&models.RolePermission{RoleID: role.ID, PermissionID: permission.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return s.audit.RecordTx(tx, &AuditEntry{
+			Action:       AuditActionDecryptRolesChanged,
+			ResourceType: AuditResourcePermission,
+			ResourceID:   PermissionSubmissionDecrypt,
+			ActorID:      actorID(actor),
+			Details: map[string]interface{}{
+				"roles":    names,
+				"username": actor.Username,
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"roles":   names,
+		"user_id": actor.UserID,
+	}).Info("Decrypt roles updated")
+	return names, nil
+}
+
+// current 返回当前的密钥环
+func (s *EncryptionService) current() *fieldcrypt.Keyring {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keyring
+}
+
+// decrypt 解密密文，密钥不在密钥环中时（其他实例刚轮换了密钥）重新加载密钥后重试一次
+func (s *EncryptionService) decrypt(token string, aad []byte) ([]byte, error) {
+	plaintext, err := s.current().Decrypt(token, aad)
+	if errors.Is(err, fieldcrypt.ErrUnknownKey) {
+		if loadErr := s.Load(); loadErr != nil {
+			return nil, loadErr
+		}
+		plaintext, err = s.current().Decrypt(token, aad)
+	}
+	return plaintext, err
+}
+
+// openField 解密一个加密字段值
+func (s *EncryptionService) openField(field string, envelope map[string]interface{}) (interface{}, error) {
+	value, err := fieldcrypt.Open(s.current(), field, envelope)
+	if errors.Is(err, fieldcrypt.ErrUnknownKey) {
+		if loadErr := s.Load(); loadErr != nil {
+			return nil, loadErr
+		}
+		value, err = fieldcrypt.Open(s.current(), field, envelope)
+	}
+	return value, err
+}
+
+// unwrap 解开数据密钥，包装密钥的主密钥既不是当前主密钥也不在 previous_master_keys 中时返回错误
+func (s *EncryptionService) unwrap(key *models.DataKey) ([]byte, error) {
+	master := s.master
+	if key.MasterKeyID != s.cfg.MasterKeyID {
+		master = s.previous[key.MasterKeyID]
+		if master == nil {
+			return nil, fmt.Errorf("master key %q is not configured, add it to previous_master_keys", key.MasterKeyID)
+		}
+	}
+	return fieldcrypt.Unwrap(master, key.WrappedKey, key.MasterKeyID)
+}
+
+// createKey 生成并保存新的 active 密钥
+func (s *EncryptionService) createKey(tx *gorm.DB, purpose string) (*models.DataKey, []byte, error) {
+	raw, err := fieldcrypt.GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := fieldcrypt.Wrap(s.master, raw, s.cfg.MasterKeyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := &models.DataKey{
+		Purpose:     purpose,
+		WrappedKey:  wrapped,
+		MasterKeyID: s.cfg.MasterKeyID,
+		Status:      DataKeyStatusActive,
+	}
+	if err := tx.Create(key).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create data key: %w", err)
+	}
+	s.logger.WithFields(map[string]interface{}{
+		"key_id":  key.ID,
+		"purpose": purpose,
+	}).Info("Data key created")
+	return key, raw, nil
+}
+
+// rekeyRetired 使用当前数据密钥重新加密使用已停用密钥加密的提交，包括已删除的提交
+func (s *EncryptionService) rekeyRetired() {
+	retired := s.db.Model(&models.DataKey{}).Select("id").
+		Where("purpose = ? AND status = ?", DataKeyPurposeData, DataKeyStatusRetired)
+	var lastID uuid.UUID
+	total := 0
+	for s.ctx.Err() == nil {
+		var submissions []*models.Submission
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("encryption_key_id IN (?) AND id > ?", retired, lastID).
+				Order("id").Limit(encryptionRekeyBatch).
+				Find(&submissions).Error; err != nil {
+				return err
+			}
+			for _, submission := range submissions {
+				lastID = submission.ID
+				if err := s.rekey(submission); err != nil {
+					// 无法解密的提交保持原样，避免阻塞其他提交的重新加密
+					s.logger.WithFields(map[string]interface{}{
+						"submission_id": submission.ID,
+						"error":         err.Error(),
+					}).Error("Failed to re-encrypt submission")
+					continue
+				}
+				if err := tx.Unscoped().Model(submission).UpdateColumns(map[string]interface{}{
+					"form_data":         submission.FormData,
+					"client_info":       submission.ClientInfo,
+					"encryption_key_id": submission.EncryptionKeyID,
+				}).Error; err != nil {
+					return err
+				}
+				total++
+			}
+			return nil
+		})
+		if err != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"error": err.Error(),
+			}).Error("Failed to re-encrypt submissions")
+			return
+		}
+		if len(submissions) < encryptionRekeyBatch {
+			break
+		}
+	}
+
+	if total > 0 {
+		s.logger.WithFields(map[string]interface{}{
+			"submissions": total,
+		}).Info("Submissions re-encrypted with the active data key")
+	}
+}
+
+// rekey 使用当前数据密钥重新加密提交记录中的加密字段值和客户端信息，不改变哪些字段被加密
+func (s *EncryptionService) rekey(submission *models.Submission) error {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(submission.FormData), &data); err != nil {
+		return fmt.Errorf("invalid form data: %w", err)
+	}
+	keyring := s.current()
+	id, err := uuid.Parse(keyring.Active())
+	if err != nil {
+		return errors.New("no active data key")
+	}
+
+	for name, value := range data {
+		envelope, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, _, isEnvelope := fieldcrypt.Envelope(envelope); !isEnvelope {
+			continue
+		}
+		plain, err := s.openField(name, envelope)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt field %s: %w", name, err)
+		}
+		sealed, err := fieldcrypt.Seal(keyring, name, plain)
+		if err != nil {
+			return err
+		}
+		data[name] = sealed
+	}
+	if submission.ClientInfo != "" {
+		plaintext, err := s.decrypt(submission.ClientInfo, []byte(clientInfoAAD))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt client info: %w", err)
+		}
+		token, err := keyring.Encrypt(plaintext, []byte(clientInfoAAD))
+		if err != nil {
+			return err
+		}
+		submission.ClientInfo = token
+	}
+
+	formDataJSON, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	submission.FormData = string(formDataJSON)
+	submission.EncryptionKeyID = &id
+	return nil
+}
+
+// maskSubmission 把表单数据中的加密字段值替换为脱敏文本，并记录被脱敏的字段
+func maskSubmission(submission *models.Submission) {
+	if submission == nil || !strings.Contains(submission.FormData, fieldcrypt.EnvelopeKey) {
+		return
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(submission.FormData), &data); err != nil {
+		return
+	}
+	var masked []string
+	for name, value := range data {
+		if _, mask, ok := fieldcrypt.Envelope(value); ok {
+			data[name] = mask
+			masked = append(masked, name)
+		}
+	}
+	if len(masked) == 0 {
+		return
+	}
+	formDataJSON, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	sort.Strings(masked)
+	submission.FormData = string(formDataJSON)
+	submission.MaskedFields = masked
+}
+
+// maskSubmissions 脱敏显示多条提交记录
+func maskSubmissions(submissions []*models.Submission) {
+	for _, submission := range submissions {
+		maskSubmission(submission)
+	}
+}
+
+// anonymizeIP 返回IP所在的网段地址，IPv4保留前24位，IPv6保留前48位，无法解析时返回空字符串
+func anonymizeIP(ip string) string {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"proxy-enhancer-ultra/internal/models"
+)
+
+// 数据密钥用途
+const (
+	DataKeyPurposeData  = "data"  // 加密敏感字段值和客户端信息
+	DataKeyPurposeIndex = "index" // 计算盲索引，不轮换
+)
+
+// 数据密钥状态
+const (
+	DataKeyStatusActive  = "active"  // 当前用于加密
+	DataKeyStatusRetired = "retired" // 已轮换，只用于解密，后台任务把使用该密钥的提交重新加密
+)
+
+// PermissionSubmissionDecrypt 查看和导出提交敏感字段原文的权限
+const PermissionSubmissionDecrypt = "submission:decrypt"
+
+// ErrDecryptForbidden 当前用户的角色没有解密权限
+var ErrDecryptForbidden = errors.New("permission denied: " + PermissionSubmissionDecrypt + " is required to view sensitive fields")
+
+// EncryptionStatus 字段加密的配置和密钥状态
+type EncryptionStatus struct {
+	Enabled           bool             `json:"enabled"`
+	MasterKeyID       string           `json:"master_key_id,omitempty"`
+	EncryptClientInfo bool             `json:"encrypt_client_info"`
+	DecryptRoles      []string         `json:"decrypt_roles"` // 拥有解密权限的角色
+	Keys              []*DataKeyStatus `json:"keys"`
+}
+
+// DataKeyStatus 数据密钥及使用该密钥加密的提交数
+type DataKeyStatus struct {
+	*models.DataKey
+	Submissions int64 `json:"submissions"`
+}
+
+// UpdateDecryptRolesRequest 设置拥有解密权限的角色
+type UpdateDecryptRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// clientInfo 加密保存的客户端信息
+type clientInfo struct {
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// 字段加密后台任务的时间间隔和批量大小
+const (
+	encryptionRekeyInterval = time.Minute // 重新加载密钥并重新加密使用已停用密钥的提交的间隔
+	encryptionRekeyBatch    = 200         // 每个事务重新加密的提交数
+)
@@ -0,0 +1,529 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"proxy-enhancer-ultra/internal/config"
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/storage"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 导出任务调度的时间间隔
+const (
+	exportPollInterval  = 10 * time.Second // 没有收到新任务通知时检查待执行任务的间隔，多实例部署时由其他实例创建的任务依赖轮询发现
+	exportSweepInterval = 10 * time.Minute // 清理过期文件和中断任务的间隔
+	exportStaleAfter    = 30 * time.Minute // 运行中的任务超过该时间没有更新进度视为已中断
+)
+
+// errExportJobCancelled 导出过程中任务被删除
+var errExportJobCancelled = errors.New("export job was cancelled")
+
+// ExportJobService 导出任务服务
+//
+// 创建任务后由后台工作协程按数据库游标把提交记录写入临时文件，再保存到文件存储，
+// 导出文件在保留时间后自动删除。待执行的任务通过 FOR UPDATE SKIP LOCKED 领取，多个实例可以同时运行
+type ExportJobService struct {
+	db      *gorm.DB
+	logger  logger.Logger
+	exports *SubmissionExportService
+	storage storage.Storage
+	cfg     config.ExportConfig
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewExportJobService 创建新的导出任务服务
+func NewExportJobService(db *gorm.DB, logger logger.Logger, store storage.Storage, cfg config.ExportConfig, encryption *EncryptionService) *ExportJobService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ExportJobService{
+		db:      db,
+		logger:  logger,
+		exports: NewSubmissionExportService(db, logger, encryption),
+		storage: store,
+		cfg:     cfg.WithDefaults(),
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start 启动导出工作协程和过期清理
+func (s *ExportJobService) Start() {
+	for i := 0; i < s.cfg.Workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(exportSweepInterval)
+		defer ticker.Stop()
+		s.sweep(time.Now())
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep(time.Now())
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]interface{}{
+		"workers":      s.cfg.Workers,
+		"artifact_ttl": s.cfg.ArtifactTTL,
+	}).Info("Export job workers started")
+}
+
+// Stop 停止导出，正在执行的任务标记为失败
+func (s *ExportJobService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// CreateJob 创建导出任务
+func (s *ExportJobService) CreateJob(req *CreateExportJobRequest) (*models.ExportJob, error) {
+	job := &models.ExportJob{
+		UserID:    req.UserID,
+		PopupID:   req.PopupID,
+		Format:    req.Format,
+		Columns:   req.Columns,
+		BOM:       req.BOM,
+		StartDate: req.StartDate,
+		EndDate:   req.EndDate,
+		Decrypt:   req.Decrypt,
+		Status:    ExportJobStatusPending,
+	}
+	exportReq := exportRequestOf(job)
+	if err := s.exports.ValidateExportRequest(exportReq); err != nil {
+		return nil, err
+	}
+
+	// 验证弹窗是否存在
+	var popup models.Popup
+	if err := s.db.Select("id").First(&popup, req.PopupID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("popup not found")
+		}
+		return nil, err
+	}
+
+	// 解密权限在创建任务时检查，任务执行时不再检查
+	exportReq.Actor = SubmissionActor{UserID: req.UserID, Username: req.Username}
+	if err := s.exports.AuthorizeDecrypt(exportReq); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to create export job: %w", err)
+	}
+
+	// 通知空闲的工作协程，通道已有通知时不需要重复发送
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"job_id":   job.ID,
+		"popup_id": job.PopupID,
+		"format":   job.Format,
+		"user_id":  job.UserID,
+	}).Info("Export job created")
+	return job, nil
+}
+
+// ListJobs 获取用户的导出任务列表，按创建时间倒序
+func (s *ExportJobService) ListJobs(userID uuid.UUID, page, pageSize int) ([]*models.ExportJob, int64, error) {
+	var jobs []*models.ExportJob
+	var total int64
+
+	query := s.db.Model(&models.ExportJob{}).Where("user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&jobs).Error; err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
+
+// GetJob 获取导出任务，不属于当前用户的任务视为不存在
+func (s *ExportJobService) GetJob(id uuid.UUID, owner ExportJobOwner) (*models.ExportJob, error) {
+	var job models.ExportJob
+	if err := s.db.First(&job, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("export job not found")
+		}
+		return nil, err
+	}
+	if !owner.IsAdmin && job.UserID != owner.UserID {
+		return nil, errors.New("export job not found")
+	}
+	return &job, nil
+}
+
+// OpenArtifact 打开已完成任务的导出文件，调用方负责关闭
+func (s *ExportJobService) OpenArtifact(id uuid.UUID, owner ExportJobOwner) (*models.ExportJob, io.ReadCloser, error) {
+	job, err := s.GetJob(id, owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch job.Status {
+	case ExportJobStatusCompleted:
+	case ExportJobStatusExpired:
+		return nil, nil, errors.New("export has expired")
+	case ExportJobStatusFailed:
+		return nil, nil, errors.New("export failed")
+	default:
+		return nil, nil, errors.New("export is not ready yet")
+	}
+
+	content, err := s.storage.Open(context.Background(), job.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, errors.New("export file not found")
+		}
+		return nil, nil, err
+	}
+	return job, content, nil
+}
+
+// DeleteJob 删除导出任务和导出文件，正在执行的任务会在下次更新进度时中止
+func (s *ExportJobService) DeleteJob(id uuid.UUID, owner ExportJobOwner) error {
+	job, err := s.GetJob(id, owner)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Unscoped().Delete(&models.ExportJob{}, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("failed to delete export job: %w", err)
+	}
+	if job.StorageKey != "" {
+		s.deleteArtifact(job.StorageKey)
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"job_id": id,
+	}).Info("Export job deleted")
+	return nil
+}
+
+// ArtifactName 返回导出文件的下载文件名
+func ArtifactName(job *models.ExportJob) string {
+	return fmt.Sprintf("submissions-%s-%s.%s", job.PopupID.String()[:8], job.CreatedAt.Format("20060102-150405"), job.Format)
+}
+
+// work 工作协程，循环领取并执行待执行的任务
+func (s *ExportJobService) work() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := s.claim()
+		if err != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"error": err.Error(),
+			}).Error("Failed to claim export job")
+		}
+		if job != nil {
+			s.run(job)
+			continue
+		}
+
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// claim 领取最早创建的待执行任务并标记为运行中，没有任务时返回 nil
+func (s *ExportJobService) claim() (*models.ExportJob, error) {
+	if s.ctx.Err() != nil {
+		return nil, nil
+	}
+	var job models.ExportJob
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", ExportJobStatusPending).
+			Order("created_at").
+			First(&job).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		job.Status = ExportJobStatusRunning
+		job.StartedAt = &now
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":     job.Status,
+			"started_at": now,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// run 执行导出任务
+func (s *ExportJobService) run(job *models.ExportJob) {
+	start := time.Now()
+	size, count, key, err := s.export(job)
+	if err != nil {
+		if errors.Is(err, errExportJobCancelled) {
+			s.logger.WithFields(map[string]interface{}{
+				"job_id": job.ID,
+			}).Info("Export job cancelled")
+			return
+		}
+		s.fail(job, err)
+		return
+	}
+
+	now := time.Now()
+	result := s.db.Model(&models.ExportJob{}).
+		Where("id = ? AND status = ?", job.ID, ExportJobStatusRunning).
+		Updates(map[string]interface{}{
+			"status":         ExportJobStatusCompleted,
+			"processed_rows": count,
+			"storage_key":    key,
+			"file_size":      size,
+			"completed_at":   now,
+			"expires_at":     now.Add(s.cfg.ArtifactTTL),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		// 任务在上传期间被删除或状态无法更新，导出文件不会再被引用
+		s.deleteArtifact(key)
+		if result.Error != nil {
+			s.fail(job, result.Error)
+		}
+		return
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"job_id":   job.ID,
+		"popup_id": job.PopupID,
+		"format":   job.Format,
+		"rows":     count,
+		"size":     size,
+		"duration": time.Since(start),
+	}).Info("Export job completed")
+}
+
+// export 把提交记录写入临时文件再保存到文件存储，返回文件大小、记录数和存储键
+func (s *ExportJobService) export(job *models.ExportJob) (int64, int64, string, error) {
+	req := exportRequestOf(job)
+	total, err := s.exports.CountSubmissions(s.ctx, req)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if err := s.updateJob(job.ID, map[string]interface{}{"total_rows": total}); err != nil {
+		return 0, 0, "", err
+	}
+
+	tmp, err := os.CreateTemp("", "export-*."+job.Format)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	count, err := s.exports.WriteExport(s.ctx, w, req, func(processed int64) error {
+		return s.updateJob(job.ID, map[string]interface{}{"processed_rows": processed})
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return 0, count, "", err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, count, "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, count, "", err
+	}
+
+	key := fmt.Sprintf("exports/%s/%s.%s", job.CreatedAt.Format("2006/01"), job.ID, job.Format)
+	if err := s.storage.Put(s.ctx, key, tmp, size, ExportContentType(job.Format)); err != nil {
+		return 0, count, "", fmt.Errorf("failed to save export file: %w", err)
+	}
+	return size, count, key, nil
+}
+
+// updateJob 更新运行中任务的字段，任务已被删除时返回 errExportJobCancelled
+func (s *ExportJobService) updateJob(id uuid.UUID, values map[string]interface{}) error {
+	result := s.db.Model(&models.ExportJob{}).
+		Where("id = ? AND status = ?", id, ExportJobStatusRunning).
+		Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errExportJobCancelled
+	}
+	return nil
+}
+
+// fail 把任务标记为失败
+func (s *ExportJobService) fail(job *models.ExportJob, cause error) {
+	message := cause.Error()
+	if errors.Is(cause, context.Canceled) {
+		message = "export was interrupted by server shutdown"
+	}
+	if err := s.db.Model(&models.ExportJob{}).
+		Where("id = ? AND status = ?", job.ID, ExportJobStatusRunning).
+		Updates(map[string]interface{}{
+			"status":       ExportJobStatusFailed,
+			"error":        message,
+			"completed_at": time.Now(),
+		}).Error; err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"job_id": job.ID,
+			"error":  err.Error(),
+		}).Error("Failed to update export job status")
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"job_id":   job.ID,
+		"popup_id": job.PopupID,
+		"error":    message,
+	}).Error("Export job failed")
+}
+
+// sweep 删除过期的导出文件，并把长时间没有进度的运行中任务标记为失败
+func (s *ExportJobService) sweep(now time.Time) {
+	var expired []*models.ExportJob
+	if err := s.db.Select("id", "storage_key").
+		Where("status = ? AND expires_at < ?", ExportJobStatusCompleted, now).
+		Find(&expired).Error; err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to load expired export jobs")
+		return
+	}
+	for _, job := range expired {
+		result := s.db.Model(&models.ExportJob{}).
+			Where("id = ? AND status = ?", job.ID, ExportJobStatusCompleted).
+			Updates(map[string]interface{}{
+				"status":      ExportJobStatusExpired,
+				"storage_key": "",
+			})
+		if result.Error != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"job_id": job.ID,
+				"error":  result.Error.Error(),
+			}).Error("Failed to expire export job")
+			continue
+		}
+		if result.RowsAffected > 0 {
+			s.deleteArtifact(job.StorageKey)
+		}
+	}
+
+	result := s.db.Model(&models.ExportJob{}).
+		Where("status = ? AND updated_at < ?", ExportJobStatusRunning, now.Add(-exportStaleAfter)).
+		Updates(map[string]interface{}{
+			"status":       ExportJobStatusFailed,
+			"error":        "export was interrupted",
+			"completed_at": now,
+		})
+	if result.Error != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"error": result.Error.Error(),
+		}).Error("Failed to fail stale export jobs")
+	}
+
+	if len(expired) > 0 || result.RowsAffected > 0 {
+		s.logger.WithFields(map[string]interface{}{
+			"expired": len(expired),
+			"stale":   result.RowsAffected,
+		}).Info("Export jobs cleaned up")
+	}
+}
+
+// invalidateExportJobs 在事务中作废可能包含指定弹窗在 since 之后创建的提交的导出任务，返回需要删除的导出文件存储键
+//
+// 已完成的任务标记为过期，运行中的任务标记为失败，工作协程在下次更新进度时中止并丢弃导出文件
+func invalidateExportJobs(tx *gorm.DB, popupIDs []uuid.UUID, since time.Time, reason string) ([]string, error) {
+	if len(popupIDs) == 0 {
+		return nil, nil
+	}
+	var jobs []*models.ExportJob
+	if err := tx.Select("id", "status", "storage_key").
+		Where("popup_id IN ?", popupIDs).
+		Where("status = ? OR (status = ? AND completed_at >= ?)", ExportJobStatusRunning, ExportJobStatusCompleted, since).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var keys []string
+	for _, job := range jobs {
+		status := ExportJobStatusExpired
+		if job.Status == ExportJobStatusRunning {
+			status = ExportJobStatusFailed
+		}
+		if err := tx.Model(&models.ExportJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":       status,
+			"storage_key":  "",
+			"error":        reason,
+			"completed_at": gorm.Expr("COALESCE(completed_at, ?)", now),
+		}).Error; err != nil {
+			return nil, err
+		}
+		if job.StorageKey != "" {
+			keys = append(keys, job.StorageKey)
+		}
+	}
+	return keys, nil
+}
+
+// deleteArtifact 删除导出文件，失败时只记录日志
+func (s *ExportJobService) deleteArtifact(key string) {
+	if err := s.storage.Delete(context.Background(), key); err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"key":   key,
+			"error": err.Error(),
+		}).Warn("Failed to delete export file")
+	}
+}
+
+// exportRequestOf 返回导出任务的导出参数
+func exportRequestOf(job *models.ExportJob) *ExportSubmissionsRequest {
+	return &ExportSubmissionsRequest{
+		PopupID:   job.PopupID,
+		Format:    job.Format,
+		Columns:   job.Columns,
+		BOM:       job.BOM,
+		StartDate: job.StartDate,
+		EndDate:   job.EndDate,
+		Decrypt:   job.Decrypt,
+	}
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"github.com/google/uuid"
+)
+
+// 导出任务状态
+const (
+	ExportJobStatusPending   = "pending"   // 等待执行
+	ExportJobStatusRunning   = "running"   // 正在导出
+	ExportJobStatusCompleted = "completed" // 导出完成，文件可以下载
+	ExportJobStatusFailed    = "failed"    // 导出失败
+	ExportJobStatusExpired   = "expired"   // 导出文件已过期删除
+)
+
+// CreateExportJobRequest 创建导出任务请求，参数与同步导出相同
+type CreateExportJobRequest struct {
+	PopupID   uuid.UUID `json:"popup_id"`
+	Format    string    `json:"format"`
+	Columns   string    `json:"columns"`    // schema 或 union，为空时自动选择
+	BOM       bool      `json:"bom"`        // CSV开头写入UTF-8 BOM
+	StartDate string    `json:"start_date"` // 开始日期 YYYY-MM-DD，包含当天
+	EndDate   string    `json:"end_date"`   // 结束日期 YYYY-MM-DD，包含当天
+	Decrypt   bool      `json:"decrypt"`    // 导出敏感字段原文，需要解密权限
+
+	UserID   uuid.UUID `json:"-"` // 由处理器根据当前用户填写
+	Username string    `json:"-"` // 由处理器根据当前用户填写
+}
+
+// ExportJobOwner 访问导出任务的用户，管理员可以访问所有用户的任务
+type ExportJobOwner struct {
+	UserID   uuid.UUID
+	Username string
+	IsAdmin  bool
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/storage"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 文件名和分类格式
+var (
+	fileCategoryPattern  = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+	fileExtensionPattern = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+)
+
+// 文件限制
+const (
+	maxOriginalNameLen = 255
+	recentUploadsLimit = 10
+)
+
+// FileService 文件服务，文件内容保存在存储后端，文件信息保存在数据库
+type FileService struct {
+	db            *gorm.DB
+	logger        logger.Logger
+	storage       storage.Storage
+	maxUploadSize int64
+}
+
+// NewFileService 创建新的文件服务，maxUploadSize 为管理后台上传文件的上限
+func NewFileService(db *gorm.DB, logger logger.Logger, store storage.Storage, maxUploadSize int64) *FileService {
+	return &FileService{
+		db:            db,
+		logger:        logger,
+		storage:       store,
+		maxUploadSize: maxUploadSize,
+	}
+}
+
+// MaxUploadSize 返回管理后台上传文件的上限
+func (s *FileService) MaxUploadSize() int64 {
+	return s.maxUploadSize
+}
+
+// Upload 保存上传的文件，根据文件内容识别MIME类型并计算校验和
+func (s *FileService) Upload(req *UploadFileRequest) (*models.File, error) {
+	maxSize := req.MaxSize
+	if maxSize <= 0 {
+		maxSize = s.maxUploadSize
+	}
+	if req.Size <= 0 {
+		return nil, &InputError{Message: "file is empty"}
+	}
+	if req.Size > maxSize {
+		return nil, &InputError{Message: fmt.Sprintf("file must be at most %s", formatFileSize(maxSize))}
+	}
+	category := strings.ToLower(strings.TrimSpace(req.Category))
+	if category == "" {
+		category = FileCategoryGeneral
+	}
+	if !fileCategoryPattern.MatchString(category) {
+		return nil, &InputError{Message: "invalid file category, expected lowercase letters, digits, _ or -"}
+	}
+	originalName := sanitizeFilename(req.Filename)
+
+	// 按文件内容识别类型，无法识别时参考扩展名
+	reader := bufio.NewReaderSize(req.Reader, 512)
+	head, err := reader.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	contentType := detectContentType(head, originalName)
+	if req.Accept != nil && !req.Accept(contentType) {
+		return nil, &InputError{Message: fmt.Sprintf("file type %s is not allowed", mediaType(contentType))}
+	}
+
+	id := uuid.New()
+	ext := strings.ToLower(path.Ext(originalName))
+	if !fileExtensionPattern.MatchString(ext) {
+		ext = ""
+	}
+	now := time.Now()
+	key := fmt.Sprintf("%s/%s/%s%s", category, now.Format("2006/01"), id, ext)
+
+	hash := sha256.New()
+	if err := s.storage.Put(context.Background(), key, io.TeeReader(reader, hash), req.Size, contentType); err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"key":   key,
+			"error": err.Error(),
+		}).Error("Failed to store file")
+		return nil, errors.New("failed to store file")
+	}
+
+	file := &models.File{
+		Filename:     key,
+		OriginalName: originalName,
+		Size:         req.Size,
+		ContentType:  contentType,
+		Category:     category,
+		Checksum:     hex.EncodeToString(hash.Sum(nil)),
+		UploadedBy:   req.UploadedBy,
+		PopupID:      req.PopupID,
+		FieldName:    req.FieldName,
+		VisitorID:    req.VisitorID,
+	}
+	file.ID = id
+	if err := s.db.Create(file).Error; err != nil {
+		s.deleteStored(key)
+		return nil, fmt.Errorf("failed to save file: %w", err)
+	}
+	s.withURL(file)
+
+	s.logger.WithFields(map[string]interface{}{
+		"file_id":  file.ID,
+		"category": file.Category,
+		"size":     file.Size,
+		"type":     file.ContentType,
+	}).Info("File uploaded successfully")
+
+	return file, nil
+}
+
+// GetFile 获取文件信息
+func (s *FileService) GetFile(id uuid.UUID) (*models.File, error) {
+	var file models.File
+	if err := s.db.Where("id = ?", id).First(&file).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("file not found")
+		}
+		return nil, err
+	}
+	s.withURL(&file)
+	return &file, nil
+}
+
+// OpenFile 获取文件信息并打开文件内容，调用方负责关闭
+func (s *FileService) OpenFile(id uuid.UUID) (*models.File, io.ReadCloser, error) {
+	file, err := s.GetFile(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := s.storage.Open(context.Background(), file.Filename)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, errors.New("file content not found")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, content, nil
+}
+
+// ListFiles 分页查询文件，按上传时间倒序
+func (s *FileService) ListFiles(page, pageSize int, filter *FileFilter) ([]*models.File, int64, error) {
+	query := s.filterQuery(s.db.Model(&models.File{}), filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count files: %w", err)
+	}
+
+	var files []*models.File
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&files).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list files: %w", err)
+	}
+	for _, file := range files {
+		s.withURL(file)
+	}
+	return files, total, nil
+}
+
+// DeleteFile 删除文件记录和文件内容
+func (s *FileService) DeleteFile(id uuid.UUID) error {
+	file, err := s.GetFile(id)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Unscoped().Delete(&models.File{}, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	s.deleteStored(file.Filename)
+
+	s.logger.WithFields(map[string]interface{}{
+		"file_id": id,
+	}).Info("File deleted successfully")
+	return nil
+}
+
+// GetFileStats 获取文件统计
+func (s *FileService) GetFileStats() (*FileStats, error) {
+	stats := &FileStats{
+		Categories:    []FileGroupStats{},
+		Types:         []FileGroupStats{},
+		RecentUploads: []RecentFileUpload{},
+	}
+
+	var total struct {
+		Count int64
+		Size  int64
+	}
+	if err := s.db.Model(&models.File{}).Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS size").Scan(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to get file stats: %w", err)
+	}
+	stats.TotalFiles = total.Count
+	stats.TotalSize = total.Size
+
+	if err := s.db.Model(&models.File{}).
+		Select("category, COUNT(*) AS count, COALESCE(SUM(size), 0) AS size").
+		Group("category").Order("size DESC").Scan(&stats.Categories).Error; err != nil {
+		return nil, fmt.Errorf("failed to get file stats by category: %w", err)
+	}
+	if err := s.db.Model(&models.File{}).
+		Select("content_type AS type, COUNT(*) AS count, COALESCE(SUM(size), 0) AS size").
+		Group("content_type").Order("size DESC").Scan(&stats.Types).Error; err != nil {
+		return nil, fmt.Errorf("failed to get file stats by type: %w", err)
+	}
+	if err := s.db.Model(&models.File{}).
+		Select("original_name AS filename, size, created_at").
+		Order("created_at DESC").Limit(recentUploadsLimit).Scan(&stats.RecentUploads).Error; err != nil {
+		return nil, fmt.Errorf("failed to get recent uploads: %w", err)
+	}
+	return stats, nil
+}
+
+// CleanupFiles 删除早于指定天数的文件
+func (s *FileService) CleanupFiles(req *CleanupFilesRequest) (*CleanupFilesResult, error) {
+	if req.OlderThanDays < 1 {
+		return nil, errors.New("older_than_days must be at least 1")
+	}
+	query := s.db.Model(&models.File{}).Where("created_at < ?", time.Now().AddDate(0, 0, -req.OlderThanDays))
+	if len(req.Categories) > 0 {
+		query = query.Where("category IN ?", req.Categories)
+	}
+	if len(req.Types) > 0 {
+		conditions := s.db.Where("1 = 0")
+		for _, fileType := range req.Types {
+			conditions = conditions.Or("content_type LIKE ?", typePattern(fileType))
+		}
+		query = query.Where(conditions)
+	}
+	if req.OrphanedOnly {
+		query = query.Where("category = ? AND submission_id IS NULL", FileCategoryForm)
+	}
+
+	var files []*models.File
+	if err := query.Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to find files: %w", err)
+	}
+
+	result := &CleanupFilesResult{}
+	for _, file := range files {
+		if err := s.db.Unscoped().Delete(&models.File{}, "id = ?", file.ID).Error; err != nil {
+			return result, fmt.Errorf("failed to delete file: %w", err)
+		}
+		s.deleteStored(file.Filename)
+		result.DeletedCount++
+		result.FreedSpace += file.Size
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"older_than_days": req.OlderThanDays,
+		"deleted_count":   result.DeletedCount,
+		"freed_space":     result.FreedSpace,
+	}).Info("Files cleaned up successfully")
+	return result, nil
+}
+
+// filterQuery 添加文件查询条件
+func (s *FileService) filterQuery(query *gorm.DB, filter *FileFilter) *gorm.DB {
+	if filter == nil {
+		return query
+	}
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.Type != "" {
+		query = query.Where("content_type LIKE ?", typePattern(filter.Type))
+	}
+	if filter.PopupID != nil {
+		query = query.Where("popup_id = ?", *filter.PopupID)
+	}
+	if filter.SubmissionID != nil {
+		query = query.Where("submission_id = ?", *filter.SubmissionID)
+	}
+	return query
+}
+
+// deleteStored 删除存储的文件内容，失败时只记录日志，数据库记录已删除。未配置文件服务时不删除
+func (s *FileService) deleteStored(keys ...string) {
+	if s == nil || len(keys) == 0 {
+		return
+	}
+	if err := storage.DeleteAll(context.Background(), s.storage, keys...); err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"keys":  keys,
+			"error": err.Error(),
+		}).Warn("Failed to delete stored file")
+	}
+}
+
+// withURL 设置管理后台的下载地址
+func (s *FileService) withURL(file *models.File) {
+	file.URL = "/api/files/" + file.ID.String() + "/download"
+}
+
+// detectContentType 按文件内容识别MIME类型，内容无法识别时使用扩展名对应的类型
+func detectContentType(head []byte, filename string) string {
+	contentType := http.DetectContentType(head)
+	if contentType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(strings.ToLower(path.Ext(filename))); byExt != "" {
+			return byExt
+		}
+	}
+	return contentType
+}
+
+// mediaType 返回去掉参数的MIME类型
+func mediaType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		return strings.TrimSpace(contentType[:i])
+	}
+	return contentType
+}
+
+// typePattern 返回匹配MIME类型或类型前缀的 LIKE 模式
+func typePattern(fileType string) string {
+	fileType = strings.NewReplacer("%", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(fileType)))
+	if !strings.Contains(fileType, "/") {
+		return fileType + "/%"
+	}
+	return fileType + "%"
+}
+
+// sanitizeFilename 去除文件名中的路径和控制字符
+func sanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	if runes := []rune(name); len(runes) > maxOriginalNameLen {
+		name = string(runes[:maxOriginalNameLen])
+	}
+	return name
+}
+
+// formatFileSize 格式化文件大小
+func formatFileSize(size int64) string {
+	switch {
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", size>>10)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
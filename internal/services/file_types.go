@@ -0,0 +1,101 @@
+package services
+
+import (
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 文件分类
+const (
+	FileCategoryGeneral = "general" // 管理后台上传时未指定分类
+	FileCategoryForm    = "form"    // 弹窗表单上传的文件
+)
+
+// UploadFileRequest 上传文件请求，Size 必须为内容的实际字节数
+type UploadFileRequest struct {
+	Reader     io.Reader
+	Filename   string // 原始文件名
+	Size       int64
+	Category   string
+	UploadedBy *uuid.UUID
+
+	// 弹窗表单上传时填写
+	PopupID   *uuid.UUID
+	FieldName string
+	VisitorID string
+
+	MaxSize int64                         // 最大字节数，为0时使用存储配置的上限
+	Accept  func(contentType string) bool // 按识别出的MIME类型判断是否接受，为nil时接受所有类型
+}
+
+// FormFileUploadRequest 代理页面上传弹窗表单文件字段的请求
+type FormFileUploadRequest struct {
+	PopupID   uuid.UUID
+	Field     string // 文件字段名
+	FormToken string // 注入弹窗时签发的表单令牌
+	Reader    io.Reader
+	Filename  string
+	Size      int64
+
+	// 以下字段由处理器根据请求填写
+	ProxyConfigID uuid.UUID
+	VisitorID     string
+	IPAddress     string
+	UserAgent     string
+}
+
+// FormFileResult 表单文件的上传结果，提交步骤时把 FileID 作为字段值
+type FormFileResult struct {
+	FileID      uuid.UUID `json:"file_id"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+}
+
+// FileFilter 文件列表查询条件
+type FileFilter struct {
+	Category     string
+	Type         string // MIME类型或类型前缀，如 image/png、image
+	PopupID      *uuid.UUID
+	SubmissionID *uuid.UUID
+}
+
+// CleanupFilesRequest 清理文件请求
+type CleanupFilesRequest struct {
+	OlderThanDays int      `json:"older_than_days"`
+	Categories    []string `json:"categories"`
+	Types         []string `json:"types"`         // MIME类型或类型前缀
+	OrphanedOnly  bool     `json:"orphaned_only"` // 只清理未被任何提交记录引用的表单上传文件
+}
+
+// CleanupFilesResult 清理文件结果
+type CleanupFilesResult struct {
+	DeletedCount int64 `json:"deleted_count"`
+	FreedSpace   int64 `json:"freed_space"`
+}
+
+// FileStats 文件统计
+type FileStats struct {
+	TotalFiles    int64              `json:"total_files"`
+	TotalSize     int64              `json:"total_size"`
+	Categories    []FileGroupStats   `json:"categories"`
+	Types         []FileGroupStats   `json:"types"`
+	RecentUploads []RecentFileUpload `json:"recent_uploads"`
+}
+
+// FileGroupStats 按分类或类型分组的文件统计
+type FileGroupStats struct {
+	Category string `json:"category,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Count    int64  `json:"count"`
+	Size     int64  `json:"size"`
+}
+
+// RecentFileUpload 最近上传的文件
+type RecentFileUpload struct {
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"proxy-enhancer-ultra/internal/config"
+	"proxy-enhancer-ultra/internal/mailer"
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 邮件发送调度的时间间隔
+const (
+	mailPollInterval  = 10 * time.Second    // 没有收到新邮件通知时检查到期邮件的间隔
+	mailLeaseMargin   = time.Minute         // 领取邮件后在发送超时之外额外保留的时间，实例崩溃后邮件在租期结束时重新发送
+	mailRetryMax      = 6 * time.Hour       // 重试间隔的上限
+	mailSweepInterval = time.Hour           // 清理旧邮件的间隔
+	mailRetention     = 30 * 24 * time.Hour // 已发送和发送失败的邮件保留时间
+)
+
+// MailService 邮件服务
+//
+// 通知邮件先写入发件箱表，由后台工作协程通过SMTP发送，失败时按指数退避重试，
+// 重试次数用完后标记为失败并记录错误日志。未启用邮件时不写入发件箱
+type MailService struct {
+	db     *gorm.DB
+	logger logger.Logger
+	cfg    config.MailConfig
+	mailer mailer.Mailer
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewMailService 创建新的邮件服务，启用邮件但SMTP配置无效时返回错误
+func NewMailService(db *gorm.DB, logger logger.Logger, cfg config.MailConfig) (*MailService, error) {
+	cfg = cfg.WithDefaults()
+	var m mailer.Mailer
+	if cfg.Enabled {
+		smtpMailer, err := mailer.NewSMTPMailer(cfg)
+		if err != nil {
+			return nil, err
+		}
+		m = smtpMailer
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MailService{
+		db:     db,
+		logger: logger,
+		cfg:    cfg,
+		mailer: m,
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// Enabled 是否启用了邮件发送
+func (s *MailService) Enabled() bool {
+	return s != nil && s.mailer != nil
+}
+
+// Start 启动邮件发送工作协程和旧邮件清理，未启用邮件时不启动
+func (s *MailService) Start() {
+	if !s.Enabled() {
+		return
+	}
+	s.wg.Add(2)
+	go s.work()
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(mailSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep(time.Now())
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]interface{}{
+		"host":       s.cfg.Host,
+		"port":       s.cfg.Port,
+		"encryption": s.cfg.Encryption,
+	}).Info("Mail worker started")
+}
+
+// Stop 停止发送，正在发送的邮件在下次启动后重新发送
+func (s *MailService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// EnqueueTx 在事务中把邮件写入发件箱，事务提交后调用 Notify 立即发送
+// submissionIDs 为邮件正文包含的提交，删除提交时一并删除邮件
+func (s *MailService) EnqueueTx(tx *gorm.DB, popupID *uuid.UUID, submissionIDs []uuid.UUID, kind, recipients, subject, body string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	message := &models.MailMessage{
+		PopupID:       popupID,
+		Kind:          kind,
+		Recipients:    recipients,
+		Subject:       subject,
+		Body:          body,
+		Status:        MailStatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	switch {
+	case len(submissionIDs) == 1:
+		message.SubmissionID = &submissionIDs[0]
+	case len(submissionIDs) > 1:
+		ids, err := json.Marshal(submissionIDs)
+		if err != nil {
+			return fmt.Errorf("failed to queue mail: %w", err)
+		}
+		message.SubmissionIDs = string(ids)
+	}
+	if err := tx.Create(message).Error; err != nil {
+		return fmt.Errorf("failed to queue mail: %w", err)
+	}
+	return nil
+}
+
+// Notify 通知空闲的工作协程检查到期邮件
+func (s *MailService) Notify() {
+	if !s.Enabled() {
+		return
+	}
+	// 通道已有通知时不需要重复发送
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// GetConfig 返回邮件配置，不包含密码
+func (s *MailService) GetConfig() *EmailConfigInfo {
+	return &EmailConfigInfo{
+		Enabled:    s.Enabled(),
+		Host:       s.cfg.Host,
+		Port:       s.cfg.Port,
+		Username:   s.cfg.Username,
+		From:       s.cfg.From,
+		FromName:   s.cfg.FromName,
+		Encryption: s.cfg.Encryption,
+		UseSSL:     s.cfg.Encryption != config.MailEncryptionNone,
+	}
+}
+
+// SendTest 立即发送测试邮件，不经过发件箱，用于检查SMTP配置
+func (s *MailService) SendTest(ctx context.Context, req *TestEmailRequest) error {
+	cfg := s.cfg
+	if req.Host != "" {
+		cfg.Host = req.Host
+		cfg.Port = req.Port
+		cfg.Username = req.Username
+		if req.Password != "" {
+			cfg.Password = req.Password
+		}
+		if req.From != "" {
+			cfg.From = req.From
+		}
+		if req.FromName != "" {
+			cfg.FromName = req.FromName
+		}
+		cfg.Encryption = ""
+		if req.UseSSL != nil && !*req.UseSSL {
+			cfg.Encryption = config.MailEncryptionNone
+		}
+		cfg = cfg.WithDefaults()
+	}
+
+	m, err := mailer.NewSMTPMailer(cfg)
+	if err != nil {
+		return err
+	}
+	to := req.To
+	if to == "" {
+		to = cfg.From
+	}
+	recipients, err := mailer.ParseAddressList([]string{to})
+	if err != nil {
+		return err
+	}
+	if err := m.Send(ctx, &mailer.Message{
+		To:      recipients,
+		Subject: "Test email from Proxy Enhancer",
+		Text:    "This is a test email. Your SMTP settings are working.",
+	}); err != nil {
+		return fmt.Errorf("failed to send test email: %w", err)
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"host": cfg.Host,
+		"to":   to,
+	}).Info("Test email sent")
+	return nil
+}
+
+// DeliverDue 在当前协程中依次发送所有到期的邮件，返回尝试发送的数量，可用于不启动工作协程时手动发送
+func (s *MailService) DeliverDue(ctx context.Context) (int, error) {
+	if !s.Enabled() {
+		return 0, nil
+	}
+	count := 0
+	for ctx.Err() == nil {
+		message, err := s.claim(time.Now())
+		if err != nil {
+			return count, err
+		}
+		if message == nil {
+			break
+		}
+		s.deliver(ctx, message)
+		count++
+	}
+	return count, ctx.Err()
+}
+
+// work 工作协程，循环领取并发送到期的邮件
+func (s *MailService) work() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(mailPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.ctx.Err() != nil {
+			return
+		}
+		message, err := s.claim(time.Now())
+		if err != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"error": err.Error(),
+			}).Error("Failed to claim mail message")
+		}
+		if message != nil {
+			s.deliver(s.ctx, message)
+			continue
+		}
+
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// claim 领取最早到期的邮件，增加发送次数并把下次发送时间推迟一个租期，没有到期邮件时返回 nil
+func (s *MailService) claim(now time.Time) (*models.MailMessage, error) {
+	var message models.MailMessage
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", MailStatusPending, now).
+			Order("next_attempt_at").
+			First(&message).Error; err != nil {
+			return err
+		}
+		message.Attempts++
+		return tx.Model(&message).Updates(map[string]interface{}{
+			"attempts":        message.Attempts,
+			"next_attempt_at": now.Add(s.cfg.Timeout + mailLeaseMargin),
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// deliver 发送一封邮件并记录结果
+func (s *MailService) deliver(ctx context.Context, message *models.MailMessage) {
+	var recipients []string
+	if err := json.Unmarshal([]byte(message.Recipients), &recipients); err != nil || len(recipients) == 0 {
+		s.fail(message, "mail has no valid recipients")
+		return
+	}
+
+	err := s.mailer.Send(ctx, &mailer.Message{
+		To:      recipients,
+		Subject: message.Subject,
+		Text:    message.Body,
+	})
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		// 服务停止导致发送中断，不计入发送次数
+		s.update(message, map[string]interface{}{
+			"attempts":        message.Attempts - 1,
+			"next_attempt_at": time.Now(),
+		})
+		return
+	}
+	if err == nil {
+		s.update(message, map[string]interface{}{
+			"status":     MailStatusSent,
+			"last_error": "",
+			"sent_at":    time.Now(),
+		})
+		s.logger.WithFields(map[string]interface{}{
+			"mail_id":  message.ID,
+			"popup_id": message.PopupID,
+			"kind":     message.Kind,
+		}).Info("Mail sent")
+		return
+	}
+
+	if message.Attempts >= s.cfg.MaxAttempts {
+		s.fail(message, err.Error())
+		return
+	}
+	delay := s.cfg.RetryBase
+	for i := 1; i < message.Attempts && delay < mailRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > mailRetryMax {
+		delay = mailRetryMax
+	}
+	s.update(message, map[string]interface{}{
+		"last_error":      err.Error(),
+		"next_attempt_at": time.Now().Add(delay),
+	})
+	s.logger.WithFields(map[string]interface{}{
+		"mail_id":  message.ID,
+		"popup_id": message.PopupID,
+		"attempts": message.Attempts,
+		"retry_in": delay,
+		"error":    err.Error(),
+	}).Warn("Failed to send mail, will retry")
+}
+
+// fail 把邮件标记为发送失败
+func (s *MailService) fail(message *models.MailMessage, reason string) {
+	s.update(message, map[string]interface{}{
+		"status":     MailStatusFailed,
+		"last_error": reason,
+	})
+	s.logger.WithFields(map[string]interface{}{
+		"mail_id":  message.ID,
+		"popup_id": message.PopupID,
+		"kind":     message.Kind,
+		"attempts": message.Attempts,
+		"error":    reason,
+	}).Error("Mail delivery failed")
+}
+
+// update 更新待发送邮件，邮件已被其他实例重新领取时不修改
+func (s *MailService) update(message *models.MailMessage, values map[string]interface{}) {
+	if err := s.db.Model(&models.MailMessage{}).
+		Where("id = ? AND status = ? AND attempts = ?", message.ID, MailStatusPending, message.Attempts).
+		Updates(values).Error; err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"mail_id": message.ID,
+			"error":   err.Error(),
+		}).Error("Failed to update mail message")
+	}
+}
+
+// sweep 删除超过保留时间的已发送和发送失败的邮件
+func (s *MailService) sweep(now time.Time) {
+	result := s.db.Unscoped().
+		Where("status IN ? AND updated_at < ?", []string{MailStatusSent, MailStatusFailed}, now.Add(-mailRetention)).
+		Delete(&models.MailMessage{})
+	if result.Error != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"error": result.Error.Error(),
+		}).Error("Failed to clean up mail messages")
+		return
+	}
+	if result.RowsAffected > 0 {
+		s.logger.WithFields(map[string]interface{}{
+			"deleted": result.RowsAffected,
+		}).Info("Mail messages cleaned up")
+	}
+}
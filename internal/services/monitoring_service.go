@@ -9,6 +9,7 @@ import (
 	"proxy-enhancer-ultra/internal/models"
 	"proxy-enhancer-ultra/pkg/logger"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -222,10 +223,10 @@ func (s *MonitoringService) GetProxyMetricsHistory(hours int) ([]*models.SystemM
 }
 
 // GetProxyStats 获取特定代理的统计信息
-func (s *MonitoringService) GetProxyStats(proxyConfigID uint) (map[string]interface{}, error) {
+func (s *MonitoringService) GetProxyStats(proxyConfigID uuid.UUID) (map[string]interface{}, error) {
 	// 验证代理配置是否存在
 	var proxyConfig models.ProxyConfig
-	if err := s.db.First(&proxyConfig, proxyConfigID).Error; err != nil {
+	if err := s.db.Where("id = ?", proxyConfigID).First(&proxyConfig).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("proxy config not found")
 		}
@@ -288,7 +289,7 @@ func (s *MonitoringService) CleanupOldMetrics(days int) error {
 	cutoffTime := time.Now().AddDate(0, 0, -days)
 
 	// 删除旧的系统指标
-	if err := s.db.Where("collected_at < ?", cutoffTime).Delete(&models.SystemMetric{}).Error; err != nil {
+	if err := s.db.Where(`"timestamp" < ?`, cutoffTime).Delete(&models.SystemMetric{}).Error; err != nil {
 		s.logger.WithFields(map[string]interface{}{
 			"cutoff_time": cutoffTime,
 			"error":       err.Error(),
@@ -0,0 +1,585 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"proxy-enhancer-ultra/internal/fieldcrypt"
+	"proxy-enhancer-ultra/internal/mailer"
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 汇总通知的调度参数
+const (
+	notificationDigestInterval = time.Minute // 检查到期汇总的间隔
+	notificationDigestLimit    = 100         // 一封汇总邮件最多列出的提交数
+	notificationMaxRecipients  = 20          // 每个弹窗最多的收件人数
+	notificationSubjectLimit   = 200         // 渲染后标题的最大字符数
+	notificationBodyLimit      = 1 << 20     // 渲染后正文的最大字节数
+	defaultDigestHour          = 9           // 每日汇总的默认发送时间
+)
+
+// DefaultNotificationSubjectTemplate 默认的邮件标题模板
+const DefaultNotificationSubjectTemplate = `{{if .Digest}}[{{.Popup.Title}}] {{.Count}} new submission(s){{else}}[{{.Popup.Title}}] New submission{{end}}`
+
+// DefaultNotificationBodyTemplate 默认的邮件正文模板
+const DefaultNotificationBodyTemplate = `{{if .Digest -}}
+{{.Count}} new submission(s) for "{{.Popup.Title}}" between {{.PeriodStart.Format "2006-01-02 15:04"}} and {{.PeriodEnd.Format "2006-01-02 15:04"}}.
+{{range .Submissions}}
+--- {{.CreatedAt.Format "2006-01-02 15:04:05"}} ({{.ID}})
+{{range .Fields}}{{.Label}}: {{.Value}}
+{{end}}{{end}}{{if .Truncated}}
+Only the first {{len .Submissions}} submissions are listed.
+{{end}}{{else}}{{with .Submission -}}
+New submission for "{{$.Popup.Title}}" at {{.CreatedAt.Format "2006-01-02 15:04:05"}} ({{.ID}}).
+
+{{range .Fields}}{{.Label}}: {{.Value}}
+{{end}}{{if .ReferrerURL}}
+Page: {{.ReferrerURL}}
+{{end}}{{end}}{{end}}`
+
+// NotificationService 提交通知服务
+//
+// 弹窗可以设置为每条提交完成后立即发送邮件，或按小时、按天发送汇总。
+// 单条通知与提交记录在同一事务中写入发件箱，汇总由后台定时生成，邮件统一由 MailService 发送
+type NotificationService struct {
+	db         *gorm.DB
+	logger     logger.Logger
+	mail       *MailService
+	exports    *SubmissionExportService
+	encryption *EncryptionService
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewNotificationService 创建新的提交通知服务
+func NewNotificationService(db *gorm.DB, logger logger.Logger, mail *MailService, encryption *EncryptionService) *NotificationService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &NotificationService{
+		db:         db,
+		logger:     logger,
+		mail:       mail,
+		exports:    NewSubmissionExportService(db, logger, nil),
+		encryption: encryption,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Start 启动汇总通知调度，未启用邮件时不启动
+func (s *NotificationService) Start() {
+	if !s.mail.Enabled() {
+		s.logger.Info("Mail is disabled, submission notifications will not be sent")
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(notificationDigestInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.SendDueDigests(time.Now())
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止汇总通知调度
+func (s *NotificationService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// GetSettings 获取弹窗的通知设置，没有设置时返回关闭状态的默认设置
+func (s *NotificationService) GetSettings(popupID uuid.UUID) (*NotificationSettings, error) {
+	if err := s.checkPopup(popupID); err != nil {
+		return nil, err
+	}
+	var setting models.PopupNotification
+	err := s.db.Where("popup_id = ?", popupID).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		setting = models.PopupNotification{
+			PopupID:    popupID,
+			Mode:       NotificationModeOff,
+			Recipients: "[]",
+			DigestHour: defaultDigestHour,
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return s.settingsOf(&setting), nil
+}
+
+// UpdateSettings 保存弹窗的通知设置，模板在保存前用示例数据试渲染
+func (s *NotificationService) UpdateSettings(popupID uuid.UUID, req *UpdateNotificationRequest) (*NotificationSettings, error) {
+	switch req.Mode {
+	case NotificationModeOff, NotificationModeInstant, NotificationModeHourly, NotificationModeDaily:
+	default:
+		return nil, fmt.Errorf("invalid notification mode: %s", req.Mode)
+	}
+	recipients, err := mailer.ParseAddressList(req.Recipients)
+	if err != nil {
+		return nil, err
+	}
+	if req.Mode != NotificationModeOff && len(recipients) == 0 {
+		return nil, errors.New("at least one recipient is required")
+	}
+	if len(recipients) > notificationMaxRecipients {
+		return nil, fmt.Errorf("at most %d recipients are allowed", notificationMaxRecipients)
+	}
+	if req.DigestHour != nil && (*req.DigestHour < 0 || *req.DigestHour > 23) {
+		return nil, errors.New("digest_hour must be between 0 and 23")
+	}
+	recipientsJSON, err := json.Marshal(recipients)
+	if err != nil {
+		return nil, err
+	}
+	setting := &models.PopupNotification{
+		PopupID:         popupID,
+		Mode:            req.Mode,
+		Recipients:      string(recipientsJSON),
+		SubjectTemplate: req.SubjectTemplate,
+		BodyTemplate:    req.BodyTemplate,
+		DigestHour:      defaultDigestHour,
+	}
+	if err := validateNotificationTemplates(setting); err != nil {
+		return nil, err
+	}
+	if err := s.checkPopup(popupID); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.PopupNotification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("popup_id = ?", popupID).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		found := err == nil
+		if found {
+			setting.ID = existing.ID
+			setting.CreatedAt = existing.CreatedAt
+			setting.DigestHour = existing.DigestHour
+			setting.MaskSensitive = existing.MaskSensitive
+			setting.LastDigestAt = existing.LastDigestAt
+		}
+		if req.DigestHour != nil {
+			setting.DigestHour = *req.DigestHour
+		}
+		if req.MaskSensitive != nil {
+			setting.MaskSensitive = *req.MaskSensitive
+		}
+		// 新建或从脱敏改为显示原文时检查解密权限
+		if !setting.MaskSensitive && (!found || existing.MaskSensitive) {
+			if err := s.encryption.AuthorizePlaintextDelivery(req.Actor); err != nil {
+				return err
+			}
+		}
+		// 切换到汇总方式时从现在开始统计，不补发之前的提交
+		if isDigestMode(setting.Mode) && (!found || existing.Mode != setting.Mode) {
+			now := time.Now()
+			setting.LastDigestAt = &now
+		}
+		if found {
+			return tx.Save(setting).Error
+		}
+		return tx.Create(setting).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save notification settings: %w", err)
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"popup_id":   popupID,
+		"mode":       setting.Mode,
+		"recipients": len(recipients),
+	}).Info("Notification settings updated")
+	return s.settingsOf(setting), nil
+}
+
+// EnqueueTx 在提交记录的事务中为设置了立即通知的弹窗写入通知邮件，事务提交后调用 Notify 立即发送
+//
+// 模板渲染失败只记录日志，不影响提交
+func (s *NotificationService) EnqueueTx(tx *gorm.DB, submission *models.Submission) error {
+	if s == nil || !s.mail.Enabled() {
+		return nil
+	}
+	var setting models.PopupNotification
+	err := tx.Where("popup_id = ? AND mode = ?", submission.PopupID, NotificationModeInstant).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var popup models.Popup
+	if err := tx.Select("id", "title", "form_config").First(&popup, "id = ?", submission.PopupID).Error; err != nil {
+		return err
+	}
+
+	item, opened := s.notificationSubmission(&setting, &popup, submission)
+	data := &NotificationData{
+		Popup:       NotificationPopup{ID: popup.ID, Title: popup.Title},
+		Count:       1,
+		Submission:  item,
+		Submissions: []*NotificationSubmission{item},
+	}
+	subject, body, err := renderNotification(&setting, data)
+	if err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"popup_id":      submission.PopupID,
+			"submission_id": submission.ID,
+			"error":         err.Error(),
+		}).Error("Failed to render submission notification")
+		return nil
+	}
+	if opened > 0 {
+		if err := s.encryption.RecordDelivery(tx, AuditResourceSubmission, submission.ID.String(), map[string]interface{}{
+			"channel":  "email",
+			"popup_id": popup.ID,
+			"kind":     MailKindInstant,
+			"fields":   opened,
+		}); err != nil {
+			return err
+		}
+	}
+	return s.mail.EnqueueTx(tx, &popup.ID, []uuid.UUID{submission.ID}, MailKindInstant, setting.Recipients, subject, body)
+}
+
+// Notify 通知邮件工作协程发送新写入的邮件
+func (s *NotificationService) Notify() {
+	if s == nil {
+		return
+	}
+	s.mail.Notify()
+}
+
+// SendDueDigests 为到期的按小时、按天汇总生成通知邮件
+func (s *NotificationService) SendDueDigests(now time.Time) {
+	var settings []*models.PopupNotification
+	if err := s.db.Where("mode IN ?", []string{NotificationModeHourly, NotificationModeDaily}).Find(&settings).Error; err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to load notification settings")
+		return
+	}
+
+	queued := false
+	for _, setting := range settings {
+		end := digestPeriodEnd(setting, now)
+		if setting.LastDigestAt != nil && !setting.LastDigestAt.Before(end) {
+			continue
+		}
+		sent, err := s.sendDigest(setting.ID, now)
+		if err != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"popup_id": setting.PopupID,
+				"error":    err.Error(),
+			}).Error("Failed to send submission digest")
+			continue
+		}
+		queued = queued || sent
+	}
+	if queued {
+		s.mail.Notify()
+	}
+}
+
+// sendDigest 在事务中锁定通知设置，统计上次汇总之后完成的提交并写入汇总邮件，返回是否写入了邮件
+//
+// 设置被其他实例锁定时跳过，没有新提交时只推进汇总时间
+func (s *NotificationService) sendDigest(id uuid.UUID, now time.Time) (bool, error) {
+	queued := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var setting models.PopupNotification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).First(&setting, "id = ?", id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !isDigestMode(setting.Mode) {
+			return nil
+		}
+		end := digestPeriodEnd(&setting, now)
+		start := end.Add(-digestPeriod(setting.Mode))
+		if setting.LastDigestAt != nil {
+			start = *setting.LastDigestAt
+		}
+		if !start.Before(end) {
+			return nil
+		}
+
+		var popup models.Popup
+		err = tx.Select("id", "title", "form_config").First(&popup, "id = ?", setting.PopupID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 弹窗已删除，只推进汇总时间
+			return tx.Model(&setting).Update("last_digest_at", end).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		query := tx.Model(&models.Submission{}).
+			Where("popup_id = ? AND is_partial = ?", setting.PopupID, false).
+			Where("COALESCE(completed_at, created_at) > ? AND COALESCE(completed_at, created_at) <= ?", start, end).
+			Session(&gorm.Session{})
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			var submissions []*models.Submission
+			if err := query.Order("COALESCE(completed_at, created_at)").Limit(notificationDigestLimit).Find(&submissions).Error; err != nil {
+				return err
+			}
+			data := &NotificationData{
+				Popup:       NotificationPopup{ID: popup.ID, Title: popup.Title},
+				Digest:      true,
+				PeriodStart: start,
+				PeriodEnd:   end,
+				Count:       count,
+				Truncated:   count > int64(len(submissions)),
+			}
+			ids := make([]uuid.UUID, 0, len(submissions))
+			opened := 0
+			for _, submission := range submissions {
+				item, fields := s.notificationSubmission(&setting, &popup, submission)
+				data.Submissions = append(data.Submissions, item)
+				ids = append(ids, submission.ID)
+				opened += fields
+			}
+
+			subject, body, err := renderNotification(&setting, data)
+			if err != nil {
+				// 模板在保存时已校验，渲染失败时跳过本次汇总，避免每分钟重复报错
+				s.logger.WithFields(map[string]interface{}{
+					"popup_id": setting.PopupID,
+					"count":    count,
+					"error":    err.Error(),
+				}).Error("Failed to render submission digest, digest skipped")
+			} else {
+				if opened > 0 {
+					if err := s.encryption.RecordDelivery(tx, AuditResourcePopup, popup.ID.String(), map[string]interface{}{
+						"channel":        "email",
+						"kind":           MailKindDigest,
+						"fields":         opened,
+						"submission_ids": ids,
+					}); err != nil {
+						return err
+					}
+				}
+				if err := s.mail.EnqueueTx(tx, &popup.ID, ids, MailKindDigest, setting.Recipients, subject, body); err != nil {
+					return err
+				}
+				queued = true
+			}
+		}
+		return tx.Model(&setting).Update("last_digest_at", end).Error
+	})
+	return queued, err
+}
+
+// notificationSubmission 返回模板中的提交记录和解密的字段数，字段按表单配置排列，配置中没有的字段按名称排序追加
+//
+// 通知设置为脱敏或解密失败时敏感字段只显示脱敏文本
+func (s *NotificationService) notificationSubmission(setting *models.PopupNotification, popup *models.Popup, submission *models.Submission) (*NotificationSubmission, int) {
+	data := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(submission.FormData), &data); err != nil {
+		data = make(map[string]interface{})
+	}
+	opened := 0
+	if !setting.MaskSensitive {
+		var err error
+		if opened, err = s.encryption.OpenFields(data); err != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"popup_id":      popup.ID,
+				"submission_id": submission.ID,
+				"error":         err.Error(),
+			}).Error("Failed to decrypt submission for notification, sensitive fields masked")
+			// 解密失败时可能已有部分字段被解密，重新解析后全部脱敏
+			opened = 0
+			data = make(map[string]interface{})
+			if err := json.Unmarshal([]byte(submission.FormData), &data); err != nil {
+				data = make(map[string]interface{})
+			}
+		}
+	}
+	fieldcrypt.MaskData(data)
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+
+	item := &NotificationSubmission{
+		ID:          submission.ID,
+		CreatedAt:   submission.CreatedAt,
+		CompletedAt: submission.CompletedAt,
+		ReferrerURL: submission.ReferrerURL,
+		Data:        data,
+	}
+	for _, column := range s.exports.exportColumns(popup, keys, ExportColumnsSchema) {
+		item.Fields = append(item.Fields, NotificationField{
+			Name:  column.key,
+			Label: column.title,
+			Value: notificationValue(data[column.key]),
+		})
+	}
+	return item, opened
+}
+
+// settingsOf 返回附带默认模板的通知设置
+func (s *NotificationService) settingsOf(setting *models.PopupNotification) *NotificationSettings {
+	return &NotificationSettings{
+		PopupNotification:      setting,
+		MailEnabled:            s.mail.Enabled(),
+		DefaultSubjectTemplate: DefaultNotificationSubjectTemplate,
+		DefaultBodyTemplate:    DefaultNotificationBodyTemplate,
+	}
+}
+
+// checkPopup 验证弹窗存在
+func (s *NotificationService) checkPopup(popupID uuid.UUID) error {
+	var count int64
+	if err := s.db.Model(&models.Popup{}).Where("id = ?", popupID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("popup not found")
+	}
+	return nil
+}
+
+// renderNotification 渲染邮件标题和正文，模板为空时使用默认模板
+func renderNotification(setting *models.PopupNotification, data *NotificationData) (string, string, error) {
+	subjectTemplate := setting.SubjectTemplate
+	if strings.TrimSpace(subjectTemplate) == "" {
+		subjectTemplate = DefaultNotificationSubjectTemplate
+	}
+	bodyTemplate := setting.BodyTemplate
+	if strings.TrimSpace(bodyTemplate) == "" {
+		bodyTemplate = DefaultNotificationBodyTemplate
+	}
+
+	subject, err := executeNotificationTemplate("subject", subjectTemplate, data)
+	if err != nil {
+		return "", "", err
+	}
+	subject = strings.Join(strings.Fields(subject), " ")
+	if utf8.RuneCountInString(subject) > notificationSubjectLimit {
+		subject = string([]rune(subject)[:notificationSubjectLimit])
+	}
+	if subject == "" {
+		return "", "", errors.New("subject template rendered an empty subject")
+	}
+
+	body, err := executeNotificationTemplate("body", bodyTemplate, data)
+	if err != nil {
+		return "", "", err
+	}
+	if len(body) > notificationBodyLimit {
+		return "", "", errors.New("body template rendered too much content")
+	}
+	return subject, body, nil
+}
+
+// executeNotificationTemplate 解析并执行模板
+func executeNotificationTemplate(name, text string, data *NotificationData) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// validateNotificationTemplates 用示例数据试渲染模板，汇总方式使用汇总数据，其他方式使用单条通知数据
+func validateNotificationTemplates(setting *models.PopupNotification) error {
+	now := time.Now()
+	sample := &NotificationSubmission{
+		ID:        uuid.Nil,
+		CreatedAt: now,
+		Data:      map[string]interface{}{"email": "visitor@example.com"},
+		Fields:    []NotificationField{{Name: "email", Label: "Email", Value: "visitor@example.com"}},
+	}
+	data := &NotificationData{
+		Popup:       NotificationPopup{Title: "Sample popup"},
+		Count:       1,
+		Submissions: []*NotificationSubmission{sample},
+	}
+	if isDigestMode(setting.Mode) {
+		data.Digest = true
+		data.PeriodStart = now.Add(-digestPeriod(setting.Mode))
+		data.PeriodEnd = now
+	} else {
+		data.Submission = sample
+	}
+	_, _, err := renderNotification(setting, data)
+	return err
+}
+
+// notificationValue 把表单值转换为邮件中的文本，上传的文件显示文件名
+func notificationValue(value interface{}) string {
+	switch v := exportValue(value).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// isDigestMode 是否为汇总通知方式
+func isDigestMode(mode string) bool {
+	return mode == NotificationModeHourly || mode == NotificationModeDaily
+}
+
+// digestPeriod 返回汇总的周期
+func digestPeriod(mode string) time.Duration {
+	if mode == NotificationModeHourly {
+		return time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// digestPeriodEnd 返回 now 之前最近一次汇总的截止时间：按小时汇总为整点，按天汇总为当天或前一天的 DigestHour
+func digestPeriodEnd(setting *models.PopupNotification, now time.Time) time.Time {
+	if setting.Mode == NotificationModeHourly {
+		return now.Truncate(time.Hour)
+	}
+	local := now.In(time.Local)
+	end := time.Date(local.Year(), local.Month(), local.Day(), setting.DigestHour, 0, 0, 0, time.Local)
+	if end.After(now) {
+		end = end.AddDate(0, 0, -1)
+	}
+	return end
+}
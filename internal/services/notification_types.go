@@ -0,0 +1,122 @@
+package services
+
+import (
+	"time"
+
+	"proxy-enhancer-ultra/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// 提交通知方式
+const (
+	NotificationModeOff     = "off"     // 不发送通知
+	NotificationModeInstant = "instant" // 每条提交完成后立即发送
+	NotificationModeHourly  = "hourly"  // 每小时整点发送上一小时的汇总
+	NotificationModeDaily   = "daily"   // 每天在 DigestHour 发送前一天的汇总
+)
+
+// 邮件类型
+const (
+	MailKindInstant = "instant" // 单条提交通知
+	MailKindDigest  = "digest"  // 汇总通知
+)
+
+// 邮件发送状态
+const (
+	MailStatusPending = "pending" // 等待发送或重试
+	MailStatusSent    = "sent"    // 已被SMTP服务器接受
+	MailStatusFailed  = "failed"  // 重试次数用完
+)
+
+// UpdateNotificationRequest 更新弹窗通知设置请求
+type UpdateNotificationRequest struct {
+	Mode            string   `json:"mode"`
+	Recipients      []string `json:"recipients"`       // 通知方式不为 off 时必填
+	SubjectTemplate string   `json:"subject_template"` // 为空时使用默认模板
+	BodyTemplate    string   `json:"body_template"`    // 为空时使用默认模板
+	DigestHour      *int     `json:"digest_hour"`      // 每日汇总的发送时间 0-23，为空时不修改
+	MaskSensitive   *bool    `json:"mask_sensitive"`   // 邮件中敏感字段只显示脱敏文本，为空时不修改，新建时默认显示原文；启用加密时显示原文需要解密权限
+
+	Actor SubmissionActor `json:"-"`
+}
+
+// NotificationSettings 弹窗通知设置，附带默认模板供编辑时参考
+type NotificationSettings struct {
+	*models.PopupNotification
+	MailEnabled            bool   `json:"mail_enabled"` // 服务器是否启用了邮件发送
+	DefaultSubjectTemplate string `json:"default_subject_template"`
+	DefaultBodyTemplate    string `json:"default_body_template"`
+}
+
+// EmailConfigInfo 邮件配置，不包含密码
+type EmailConfigInfo struct {
+	Enabled    bool   `json:"enabled"`
+	Host       string `json:"smtp_host"`
+	Port       int    `json:"smtp_port"`
+	Username   string `json:"smtp_username"`
+	From       string `json:"from_email"`
+	FromName   string `json:"from_name"`
+	Encryption string `json:"encryption"`
+	UseSSL     bool   `json:"use_ssl"`
+}
+
+// TestEmailRequest 发送测试邮件请求，填写 smtp_host 时使用请求中的SMTP配置代替服务器配置
+type TestEmailRequest struct {
+	To       string `json:"to"` // 为空时发送给发件人地址
+	Host     string `json:"smtp_host"`
+	Port     int    `json:"smtp_port"`
+	Username string `json:"smtp_username"`
+	Password string `json:"smtp_password"` // 为空时使用服务器配置的密码
+	From     string `json:"from_email"`
+	FromName string `json:"from_name"`
+	UseSSL   *bool  `json:"use_ssl"`
+}
+
+// NotificationData 通知模板的数据，单条通知时 Submission 为该提交，汇总时为空
+type NotificationData struct {
+	Popup       NotificationPopup
+	Digest      bool
+	PeriodStart time.Time // 汇总的开始时间（不含）
+	PeriodEnd   time.Time // 汇总的截止时间（含）
+	Count       int64     // 提交总数
+	Truncated   bool      // 汇总的提交过多时只列出前面的部分
+	Submission  *NotificationSubmission
+	Submissions []*NotificationSubmission
+}
+
+// NotificationPopup 通知模板中的弹窗
+type NotificationPopup struct {
+	ID    uuid.UUID
+	Title string
+}
+
+// NotificationSubmission 通知模板中的提交记录
+type NotificationSubmission struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+	ReferrerURL string
+	Data        map[string]interface{} // 原始表单数据
+	Fields      []NotificationField    // 按表单配置顺序排列的字段
+}
+
+// NotificationField 通知模板中的表单字段
+type NotificationField struct {
+	Name  string
+	Label string
+	Value string
+}
+
+// Value 返回字段的文本值，字段不存在时返回空字符串，模板中写作 {{.Submission.Value "email"}}
+func (s *NotificationSubmission) Value(name string) string {
+	if s == nil {
+		return ""
+	}
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return field.Value
+		}
+	}
+	return ""
+}
@@ -3,11 +3,14 @@ package services
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
 	"proxy-enhancer-ultra/pkg/logger"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -29,13 +32,10 @@ func NewPopupCRUDService(db *gorm.DB, logger logger.Logger) *PopupCRUDService {
 
 // CreatePopup 创建弹窗
 func (s *PopupCRUDService) CreatePopup(req *CreatePopupRequest) (*models.Popup, error) {
-	// 验证代理配置是否存在
-	var proxyConfig models.ProxyConfig
-	if err := s.db.First(&proxyConfig, req.ProxyConfigID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("proxy config not found")
-		}
-		return nil, fmt.Errorf("failed to check proxy config: %w", err)
+	// 验证代理配置作用范围
+	scope := newProxyScope(req.IsGlobal, req.ProxyConfigID, req.ProxyConfigIDs)
+	if err := validateProxyScope(s.db, scope); err != nil {
+		return nil, err
 	}
 
 	// 验证请求数据
@@ -44,47 +44,92 @@ func (s *PopupCRUDService) CreatePopup(req *CreatePopupRequest) (*models.Popup,
 	}
 
 	// 设置默认值
-	position := req.Position
-	if position == "" {
-		position = "center" // 默认居中
-	}
-
 	if req.Enabled == nil {
 		enabled := true
 		req.Enabled = &enabled
 	}
 
+	displayRules, err := marshalDisplayRules(req.DisplayRules)
+	if err != nil {
+		return nil, err
+	}
+	triggerConfig, err := marshalTriggerConfig(req.TriggerType, req.APICall)
+	if err != nil {
+		return nil, err
+	}
+	styleConfig, err := resolveStyleConfig("", req.StyleConfig, req.Style, req.Position)
+	if err != nil {
+		return nil, err
+	}
+	formConfig, err := marshalFormConfig(req.FormConfig)
+	if err != nil {
+		return nil, err
+	}
+	retention, err := marshalRetention(req.Retention)
+	if err != nil {
+		return nil, err
+	}
+	dedup, err := marshalDedup(req.Dedup)
+	if err != nil {
+		return nil, err
+	}
+
 	popup := &models.Popup{
-		Title:       req.Title,
-		Content:     req.Content,
-		StyleConfig: req.Style,
-		FormConfig:  "{}", // 默认空的表单配置
-		IsActive:    *req.Enabled,
+		Title:         req.Title,
+		Content:       req.Content,
+		StyleConfig:   styleConfig,
+		FormConfig:    formConfig,
+		DefaultLocale: req.DefaultLocale,
+		IsActive:      *req.Enabled,
+		IsGlobal:      scope.IsGlobal,
+		DisplayRules:  displayRules,
+		TriggerType:   req.TriggerType,
+		TriggerValue:  strings.TrimSpace(req.TriggerValue),
+		TriggerConfig: triggerConfig,
+		Retention:     retention,
+		Dedup:         dedup,
+	}
+	if err := applyPopupSchedule(popup, req.Schedule); err != nil {
+		return nil, err
 	}
 
-	if err := s.db.Create(popup).Error; err != nil {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(popup).Error; err != nil {
+			return err
+		}
+		if err := syncPopupVariants(tx, popup.ID, req.Variants); err != nil {
+			return err
+		}
+		return replacePopupBindings(tx, popup.ID, scope.ProxyConfigIDs)
+	})
+	if err != nil {
 		s.logger.WithFields(map[string]interface{}{
-			"proxy_config_id": req.ProxyConfigID,
-			"title":           req.Title,
-			"popup_type":      req.PopupType,
-			"error":           err.Error(),
+			"proxy_config_ids": scope.ProxyConfigIDs,
+			"title":            req.Title,
+			"popup_type":       req.PopupType,
+			"error":            err.Error(),
 		}).Error("Failed to create popup")
 		return nil, fmt.Errorf("failed to create popup: %w", err)
 	}
 
 	s.logger.WithFields(map[string]interface{}{
-		"popup_id":        popup.ID,
-		"proxy_config_id": req.ProxyConfigID,
-		"title":           req.Title,
+		"popup_id":         popup.ID,
+		"is_global":        scope.IsGlobal,
+		"proxy_config_ids": scope.ProxyConfigIDs,
+		"title":            req.Title,
 	}).Info("Popup created successfully")
 
 	return popup, nil
 }
 
 // GetPopup 获取弹窗
-func (s *PopupCRUDService) GetPopup(id uint) (*models.Popup, error) {
+func (s *PopupCRUDService) GetPopup(id uuid.UUID) (*models.Popup, error) {
 	var popup models.Popup
-	if err := s.db.Preload("ProxyConfig").First(&popup, id).Error; err != nil {
+	if err := s.db.Preload("ProxyConfigs").Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at ASC")
+	}).Preload("Translations", func(db *gorm.DB) *gorm.DB {
+		return db.Order("locale ASC")
+	}).Where("id = ?", id).First(&popup).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("popup not found")
 		}
@@ -95,10 +140,10 @@ func (s *PopupCRUDService) GetPopup(id uint) (*models.Popup, error) {
 }
 
 // UpdatePopup 更新弹窗
-func (s *PopupCRUDService) UpdatePopup(id uint, req *UpdatePopupRequest) error {
+func (s *PopupCRUDService) UpdatePopup(id uuid.UUID, req *UpdatePopupRequest) error {
 	// 检查弹窗是否存在
 	var popup models.Popup
-	if err := s.db.First(&popup, id).Error; err != nil {
+	if err := s.db.Where("id = ?", id).First(&popup).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("popup not found")
 		}
@@ -110,6 +155,22 @@ func (s *PopupCRUDService) UpdatePopup(id uint, req *UpdatePopupRequest) error {
 		return err
 	}
 
+	// 合并并验证新的代理配置作用范围
+	scope := ProxyScope{IsGlobal: popup.IsGlobal}
+	if req.IsGlobal != nil || req.ProxyConfigIDs != nil {
+		if req.IsGlobal != nil {
+			scope.IsGlobal = *req.IsGlobal
+		}
+		if req.ProxyConfigIDs != nil {
+			scope = newProxyScope(scope.IsGlobal, uuid.Nil, *req.ProxyConfigIDs)
+		} else if err := s.db.Model(&models.PopupProxyConfig{}).Where("popup_id = ?", id).Pluck("proxy_config_id", &scope.ProxyConfigIDs).Error; err != nil {
+			return fmt.Errorf("failed to get popup proxy configs: %w", err)
+		}
+		if err := validateProxyScope(s.db, scope); err != nil {
+			return err
+		}
+	}
+
 	// 准备更新数据
 	updateData := make(map[string]interface{})
 
@@ -119,28 +180,109 @@ func (s *PopupCRUDService) UpdatePopup(id uint, req *UpdatePopupRequest) error {
 	if req.Content != "" {
 		updateData["content"] = req.Content
 	}
-	if req.PopupType != "" {
-		updateData["popup_type"] = req.PopupType
-	}
 	if req.TriggerType != "" {
 		updateData["trigger_type"] = req.TriggerType
 	}
 	if req.TriggerValue != "" {
-		updateData["trigger_value"] = req.TriggerValue
+		updateData["trigger_value"] = strings.TrimSpace(req.TriggerValue)
+	}
+	if req.TriggerType != "" || req.APICall != nil {
+		triggerType := req.TriggerType
+		if triggerType == "" {
+			triggerType = popup.TriggerType
+		}
+		if triggerType != popupspec.TriggerAPICall && req.APICall != nil {
+			return errors.New("api_call can only be set for api_call trigger")
+		}
+		triggerConfig, err := marshalTriggerConfig(triggerType, req.APICall)
+		if err != nil {
+			return err
+		}
+		if req.APICall != nil || triggerType != popupspec.TriggerAPICall {
+			updateData["trigger_config"] = triggerConfig
+		}
+	}
+	if req.StyleConfig != nil || req.Style != "" || req.Position != "" {
+		styleConfig, err := resolveStyleConfig(popup.StyleConfig, req.StyleConfig, req.Style, req.Position)
+		if err != nil {
+			return err
+		}
+		updateData["style_config"] = styleConfig
 	}
-	if req.Position != "" {
-		updateData["position"] = req.Position
+	if req.FormConfig != nil {
+		formConfig, err := marshalFormConfig(req.FormConfig)
+		if err != nil {
+			return err
+		}
+		updateData["form_config"] = formConfig
+	}
+	if req.DefaultLocale != nil {
+		updateData["default_locale"] = *req.DefaultLocale
 	}
-	if req.Style != "" {
-		updateData["style"] = req.Style
+	if req.Retention != nil {
+		retention, err := marshalRetention(req.Retention)
+		if err != nil {
+			return err
+		}
+		updateData["retention"] = retention
+	}
+	if req.Dedup != nil {
+		if req.FormConfig == nil {
+			// 只修改去重配置时检查字段是否在已保存的表单中
+			form, err := popupspec.ParseFormConfig(popup.FormConfig)
+			if err == nil {
+				if err := req.Dedup.Validate(form); err != nil {
+					return fmt.Errorf("invalid dedup: %w", err)
+				}
+			}
+		}
+		dedup, err := marshalDedup(req.Dedup)
+		if err != nil {
+			return err
+		}
+		updateData["dedup"] = dedup
 	}
 	if req.Enabled != nil {
 		updateData["is_active"] = *req.Enabled
 	}
+	if req.IsGlobal != nil {
+		updateData["is_global"] = *req.IsGlobal
+	}
+	if req.DisplayRules != nil {
+		displayRules, err := marshalDisplayRules(req.DisplayRules)
+		if err != nil {
+			return err
+		}
+		updateData["display_rules"] = displayRules
+	}
+	if req.Schedule != nil {
+		scheduled := &models.Popup{}
+		if err := applyPopupSchedule(scheduled, req.Schedule); err != nil {
+			return err
+		}
+		updateData["start_at"] = scheduled.StartAt
+		updateData["end_at"] = scheduled.EndAt
+		updateData["timezone"] = scheduled.Timezone
+		updateData["weekly_schedule"] = scheduled.WeeklySchedule
+	}
 
 	updateData["updated_at"] = time.Now()
 
-	if err := s.db.Model(&popup).Updates(updateData).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&popup).Updates(updateData).Error; err != nil {
+			return err
+		}
+		if req.Variants != nil {
+			if err := syncPopupVariants(tx, popup.ID, *req.Variants); err != nil {
+				return err
+			}
+		}
+		if req.ProxyConfigIDs != nil {
+			return replacePopupBindings(tx, popup.ID, scope.ProxyConfigIDs)
+		}
+		return nil
+	})
+	if err != nil {
 		s.logger.WithFields(map[string]interface{}{
 			"popup_id": id,
 			"error":    err.Error(),
@@ -156,10 +298,10 @@ func (s *PopupCRUDService) UpdatePopup(id uint, req *UpdatePopupRequest) error {
 }
 
 // DeletePopup 删除弹窗
-func (s *PopupCRUDService) DeletePopup(id uint) error {
+func (s *PopupCRUDService) DeletePopup(id uuid.UUID) error {
 	// 检查弹窗是否存在
 	var popup models.Popup
-	if err := s.db.First(&popup, id).Error; err != nil {
+	if err := s.db.Where("id = ?", id).First(&popup).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("popup not found")
 		}
@@ -210,7 +352,7 @@ func (s *PopupCRUDService) DeletePopup(id uint) error {
 }
 
 // ListPopups 获取弹窗列表
-func (s *PopupCRUDService) ListPopups(page, pageSize int, proxyConfigID *uint, popupType string, enabled *bool) ([]*models.Popup, int64, error) {
+func (s *PopupCRUDService) ListPopups(page, pageSize int, proxyConfigID *uuid.UUID, enabled *bool) ([]*models.Popup, int64, error) {
 	var popups []*models.Popup
 	var total int64
 
@@ -219,10 +361,7 @@ func (s *PopupCRUDService) ListPopups(page, pageSize int, proxyConfigID *uint, p
 
 	// 添加过滤条件
 	if proxyConfigID != nil {
-		query = query.Where("proxy_config_id = ?", *proxyConfigID)
-	}
-	if popupType != "" {
-		query = query.Where("popup_type = ?", popupType)
+		query = scopePopupsToProxyConfig(query, *proxyConfigID)
 	}
 	if enabled != nil {
 		query = query.Where("is_active = ?", *enabled)
@@ -235,7 +374,7 @@ func (s *PopupCRUDService) ListPopups(page, pageSize int, proxyConfigID *uint, p
 
 	// 获取分页数据
 	offset := (page - 1) * pageSize
-	if err := query.Preload("ProxyConfig").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&popups).Error; err != nil {
+	if err := query.Preload("ProxyConfigs").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&popups).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to get popups: %w", err)
 	}
 
@@ -243,10 +382,10 @@ func (s *PopupCRUDService) ListPopups(page, pageSize int, proxyConfigID *uint, p
 }
 
 // TogglePopupStatus 切换弹窗状态
-func (s *PopupCRUDService) TogglePopupStatus(id uint) error {
+func (s *PopupCRUDService) TogglePopupStatus(id uuid.UUID) error {
 	// 检查弹窗是否存在
 	var popup models.Popup
-	if err := s.db.First(&popup, id).Error; err != nil {
+	if err := s.db.Where("id = ?", id).First(&popup).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("popup not found")
 		}
@@ -274,12 +413,96 @@ func (s *PopupCRUDService) TogglePopupStatus(id uint) error {
 	return nil
 }
 
-// GetPopupsByProxyConfig 根据代理配置获取弹窗
-func (s *PopupCRUDService) GetPopupsByProxyConfig(proxyConfigID uint) ([]*models.Popup, error) {
+// GetPopupsByProxyConfig 根据代理配置获取生效的弹窗，包括全局弹窗
+func (s *PopupCRUDService) GetPopupsByProxyConfig(proxyConfigID uuid.UUID) ([]*models.Popup, error) {
 	var popups []*models.Popup
-	if err := s.db.Where("proxy_config_id = ? AND is_active = ?", proxyConfigID, true).Order("created_at ASC").Find(&popups).Error; err != nil {
+	query := scopePopupsToProxyConfig(s.db.Model(&models.Popup{}), proxyConfigID)
+	if err := query.Where("is_active = ?", true).Order("created_at ASC").Find(&popups).Error; err != nil {
 		return nil, fmt.Errorf("failed to get popups by proxy config: %w", err)
 	}
 
 	return popups, nil
 }
+
+// marshalDisplayRules 序列化展示规则，为nil时返回空对象
+func marshalDisplayRules(rules *popupspec.DisplayRules) (string, error) {
+	if rules == nil {
+		return "{}", nil
+	}
+	return rules.Marshal()
+}
+
+// marshalRetention 序列化提交数据保留策略，为nil时使用全局配置
+func marshalRetention(retention *popupspec.Retention) (string, error) {
+	if retention == nil {
+		return "{}", nil
+	}
+	return retention.Marshal()
+}
+
+// marshalDedup 序列化提交去重配置，为nil时不去重
+func marshalDedup(dedup *popupspec.Dedup) (string, error) {
+	if dedup == nil {
+		return "{}", nil
+	}
+	return dedup.Marshal()
+}
+
+// resolveStyleConfig 根据样式配置和旧版的 style、position 字段生成样式配置JSON
+// 只传入 position 时在 current 的基础上修改位置，未设置任何样式时返回空对象
+func resolveStyleConfig(current string, styleConfig *popupspec.StyleConfig, style, position string) (string, error) {
+	if styleConfig == nil {
+		raw := style
+		if raw == "" {
+			raw = current
+		}
+		parsed, err := popupspec.ParseStyleConfig(raw)
+		if err != nil {
+			if style != "" {
+				return "", fmt.Errorf("invalid style: %w", err)
+			}
+			parsed = &popupspec.StyleConfig{} // 已保存的样式无效时使用默认样式
+		}
+		styleConfig = parsed
+	}
+	if position != "" {
+		styleConfig.Position = position
+	}
+	if styleConfig.IsZero() {
+		return "{}", nil
+	}
+	return styleConfig.Marshal()
+}
+
+// marshalTriggerConfig 序列化触发条件，只有接口调用触发方式保存匹配条件，其他触发方式返回空对象
+func marshalTriggerConfig(triggerType string, apiCall *popupspec.APICallTrigger) (string, error) {
+	if triggerType != popupspec.TriggerAPICall || apiCall == nil {
+		return "{}", nil
+	}
+	return apiCall.Marshal()
+}
+
+// marshalFormConfig 序列化表单配置，为nil或未配置字段时返回空对象
+func marshalFormConfig(form *popupspec.FormConfig) (string, error) {
+	if form == nil || form.IsZero() {
+		return "{}", nil
+	}
+	return form.Marshal()
+}
+
+// applyPopupSchedule 将投放排期写入弹窗字段，为nil时清除排期
+func applyPopupSchedule(popup *models.Popup, schedule *popupspec.Schedule) error {
+	if schedule == nil {
+		schedule = &popupspec.Schedule{}
+	}
+	weekly, err := schedule.WeeklyJSON()
+	if err != nil {
+		return err
+	}
+
+	popup.StartAt = schedule.StartAt
+	popup.EndAt = schedule.EndAt
+	popup.Timezone = schedule.Timezone
+	popup.WeeklySchedule = weekly
+	return nil
+}
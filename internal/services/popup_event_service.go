@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 弹窗事件上报限制
+const (
+	maxPopupEventBatch     = 20                                       // 单次上报的最大事件数
+	maxPopupEventElapsedMS = int64(24 * time.Hour / time.Millisecond) // 超过该耗时视为无效
+	maxPopupEventTarget    = 100                                      // 点击目标的最大长度
+)
+
+// popupEventTypes 允许上报的事件类型
+var popupEventTypes = map[string]bool{
+	models.PopupEventImpression: true,
+	models.PopupEventClose:      true,
+	models.PopupEventClick:      true,
+	models.PopupEventSubmit:     true,
+}
+
+// PopupEventService 弹窗事件服务，记录数据面上报的访客事件
+type PopupEventService struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewPopupEventService 创建新的弹窗事件服务
+func NewPopupEventService(db *gorm.DB, logger logger.Logger) *PopupEventService {
+	return &PopupEventService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// RecordEvents 记录访客在代理页面上产生的弹窗事件，返回保存的事件数
+//
+// 只接受对该代理配置生效的启用弹窗，变体不属于弹窗时丢弃变体ID；
+// 类型未知或弹窗不匹配的事件被跳过，不影响同一批次的其他事件
+func (s *PopupEventService) RecordEvents(proxyConfigID uuid.UUID, visitorID string, inputs []PopupEventInput) (int, error) {
+	if len(inputs) == 0 {
+		return 0, errors.New("no events to record")
+	}
+	if len(inputs) > maxPopupEventBatch {
+		return 0, fmt.Errorf("too many events, at most %d per request", maxPopupEventBatch)
+	}
+
+	popupIDs := make([]uuid.UUID, 0, len(inputs))
+	variantIDs := make([]uuid.UUID, 0, len(inputs))
+	for _, input := range inputs {
+		popupIDs = append(popupIDs, input.PopupID)
+		if input.VariantID != nil {
+			variantIDs = append(variantIDs, *input.VariantID)
+		}
+	}
+
+	// 对该代理配置生效的弹窗，包括全局弹窗
+	var activePopupIDs []uuid.UUID
+	bound := s.db.Model(&models.PopupProxyConfig{}).Select("popup_id").Where("proxy_config_id = ?", proxyConfigID)
+	if err := s.db.Model(&models.Popup{}).
+		Where("id IN ? AND is_active = ? AND (is_global = ? OR id IN (?))", popupIDs, true, true, bound).
+		Pluck("id", &activePopupIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to check popups: %w", err)
+	}
+	active := make(map[uuid.UUID]bool, len(activePopupIDs))
+	for _, id := range activePopupIDs {
+		active[id] = true
+	}
+
+	// 变体所属的弹窗，已删除的变体仍可归因
+	variantPopups := make(map[uuid.UUID]uuid.UUID, len(variantIDs))
+	if len(variantIDs) > 0 {
+		var variants []models.PopupVariant
+		if err := s.db.Unscoped().Select("id", "popup_id").Where("id IN ?", variantIDs).Find(&variants).Error; err != nil {
+			return 0, fmt.Errorf("failed to check popup variants: %w", err)
+		}
+		for _, variant := range variants {
+			variantPopups[variant.ID] = variant.PopupID
+		}
+	}
+
+	events := make([]models.PopupEvent, 0, len(inputs))
+	for _, input := range inputs {
+		if !popupEventTypes[input.Type] || !active[input.PopupID] {
+			continue
+		}
+
+		event := models.PopupEvent{
+			PopupID:       input.PopupID,
+			ProxyConfigID: &proxyConfigID,
+			VisitorID:     visitorID,
+			EventType:     input.Type,
+			Target:        truncateEventTarget(input.Target),
+		}
+		if input.VariantID != nil && variantPopups[*input.VariantID] == input.PopupID {
+			event.VariantID = input.VariantID
+		}
+		if input.Type != models.PopupEventImpression && input.ElapsedMS != nil &&
+			*input.ElapsedMS >= 0 && *input.ElapsedMS <= maxPopupEventElapsedMS {
+			event.ElapsedMS = input.ElapsedMS
+		}
+		events = append(events, event)
+	}
+
+	if skipped := len(inputs) - len(events); skipped > 0 {
+		s.logger.WithFields(map[string]interface{}{
+			"proxy_config_id": proxyConfigID,
+			"skipped":         skipped,
+		}).Debug("Skipped invalid popup events")
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := s.db.Create(&events).Error; err != nil {
+		return 0, fmt.Errorf("failed to save popup events: %w", err)
+	}
+
+	return len(events), nil
+}
+
+// truncateEventTarget 截断点击目标，保证不超过字段长度且不截断多字节字符
+func truncateEventTarget(target string) string {
+	if utf8.RuneCountInString(target) <= maxPopupEventTarget {
+		return target
+	}
+	return string([]rune(target)[:maxPopupEventTarget])
+}
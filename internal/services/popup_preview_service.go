@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+	"proxy-enhancer-ultra/internal/proxy"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PopupPreview 弹窗预览结果
+type PopupPreview struct {
+	HTML string               `json:"html"` // 弹窗片段
+	CSS  string               `json:"css"`
+	JS   string               `json:"js"`
+	Page *proxy.PreviewResult `json:"page,omitempty"` // 在代理页面中的预览，仅在指定代理配置时返回
+}
+
+// PopupPreviewService 弹窗预览服务
+type PopupPreviewService struct {
+	db             *gorm.DB
+	logger         logger.Logger
+	previewer      *proxy.Previewer
+	htmlInjector   *proxy.HTMLInjector
+	assetsProvider *proxy.AssetsProvider
+}
+
+// NewPopupPreviewService 创建新的弹窗预览服务
+func NewPopupPreviewService(db *gorm.DB, logger logger.Logger) *PopupPreviewService {
+	return &PopupPreviewService{
+		db:             db,
+		logger:         logger,
+		previewer:      proxy.NewPreviewer(db, logger),
+		htmlInjector:   proxy.NewHTMLInjector(db, logger),
+		assetsProvider: proxy.NewAssetsProvider(),
+	}
+}
+
+// PreviewPopup 预览弹窗，指定代理配置时将弹窗注入到代理页面中
+func (s *PopupPreviewService) PreviewPopup(ctx context.Context, id uuid.UUID, req *PopupPreviewRequest) (*PopupPreview, error) {
+	var popup models.Popup
+	if err := s.db.Where("id = ?", id).First(&popup).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("popup not found")
+		}
+		return nil, fmt.Errorf("failed to get popup: %w", err)
+	}
+
+	var variant *models.PopupVariant
+	if req.VariantID != nil {
+		variant = &models.PopupVariant{}
+		if err := s.db.Where("id = ? AND popup_id = ?", *req.VariantID, id).First(variant).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("popup variant not found")
+			}
+			return nil, fmt.Errorf("failed to get popup variant: %w", err)
+		}
+	}
+
+	var translation *models.PopupTranslation
+	if req.Locale != "" {
+		locale, err := popupspec.NormalizeLocale(req.Locale)
+		if err != nil {
+			return nil, err
+		}
+		translation = &models.PopupTranslation{}
+		if err := s.db.Where("popup_id = ? AND locale = ?", id, locale).First(translation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("popup translation not found")
+			}
+			return nil, fmt.Errorf("failed to get popup translation: %w", err)
+		}
+	}
+
+	snippet, err := s.htmlInjector.RenderPopup(&popup, variant, translation)
+	if err != nil {
+		return nil, err
+	}
+
+	// 未指定代理配置时使用占位配置生成脚本
+	proxyConfig := &models.ProxyConfig{ProxyDomain: "preview.local"}
+	if req.ProxyConfigID != nil {
+		proxyConfig, err = findProxyConfigByID(s.db, *req.ProxyConfigID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	preview := &PopupPreview{
+		HTML: snippet,
+		CSS:  s.assetsProvider.GetCSS(),
+		JS:   s.assetsProvider.GetJavaScript(proxyConfig),
+	}
+
+	if req.ProxyConfigID != nil {
+		page, err := s.previewer.Preview(ctx, proxyConfig, &proxy.PreviewOptions{
+			URL:          req.URL,
+			UserAgent:    req.UserAgent,
+			Popups:       []*models.Popup{proxy.ApplyTranslation(proxy.ApplyVariant(&popup, variant), translation)},
+			FullPipeline: req.FullPipeline,
+		})
+		if err != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"popup_id":        id,
+				"proxy_config_id": *req.ProxyConfigID,
+				"error":           err.Error(),
+			}).Warn("Popup page preview failed")
+			return nil, err
+		}
+		preview.Page = page
+	}
+
+	return preview, nil
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPopupScheduleInterval 排期检查的默认间隔
+const DefaultPopupScheduleInterval = time.Minute
+
+// PopupScheduler 弹窗排期调度器
+//
+// 投放时间由 HTMLInjector 在每次请求时实时判断，调度器只负责发现排期状态的变化，
+// 并把开始投放、暂停、到期写入审计日志
+type PopupScheduler struct {
+	db     *gorm.DB
+	logger logger.Logger
+	audit  *AuditService
+	stop   chan struct{}
+}
+
+// NewPopupScheduler 创建新的弹窗排期调度器
+func NewPopupScheduler(db *gorm.DB, logger logger.Logger, audit *AuditService) *PopupScheduler {
+	return &PopupScheduler{
+		db:     db,
+		logger: logger,
+		audit:  audit,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start 启动调度器，立即检查一次，之后按间隔检查
+func (s *PopupScheduler) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		s.runOnce()
+		for {
+			select {
+			case <-ticker.C:
+				s.runOnce()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]interface{}{
+		"interval": interval,
+	}).Info("Popup scheduler started")
+}
+
+// Stop 停止调度器
+func (s *PopupScheduler) Stop() {
+	close(s.stop)
+}
+
+// runOnce 执行一次检查并记录错误
+func (s *PopupScheduler) runOnce() {
+	if _, err := s.Tick(time.Now()); err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Failed to run popup scheduler")
+	}
+}
+
+// Tick 检查所有设置了排期的弹窗，更新状态发生变化的弹窗并记录审计日志，返回变化的弹窗数
+func (s *PopupScheduler) Tick(now time.Time) (int, error) {
+	var popups []*models.Popup
+	if err := s.db.Select("id", "title", "is_active", "start_at", "end_at", "timezone", "weekly_schedule", "schedule_status").
+		Where("start_at IS NOT NULL OR end_at IS NOT NULL OR weekly_schedule::text <> '[]' OR schedule_status <> ''").
+		Find(&popups).Error; err != nil {
+		return 0, fmt.Errorf("failed to load scheduled popups: %w", err)
+	}
+
+	changed := 0
+	for _, popup := range popups {
+		schedule, err := popupspec.NewSchedule(popup.StartAt, popup.EndAt, popup.Timezone, popup.WeeklySchedule)
+		if err != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"popup_id": popup.ID,
+				"error":    err.Error(),
+			}).Warn("Skipping popup with invalid schedule")
+			continue
+		}
+
+		status := schedule.Status(now)
+		if status == popup.ScheduleStatus {
+			continue
+		}
+
+		ok, err := s.transition(popup, status, now)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed++
+		}
+	}
+
+	return changed, nil
+}
+
+// transition 记录弹窗的排期状态变化，多个实例同时运行时只有一个实例会成功更新并记录审计日志
+func (s *PopupScheduler) transition(popup *models.Popup, status string, now time.Time) (bool, error) {
+	updated := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Popup{}).
+			Where("id = ? AND schedule_status = ?", popup.ID, popup.ScheduleStatus).
+			UpdateColumn("schedule_status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		updated = true
+
+		action := scheduleAuditAction(popup.ScheduleStatus, status)
+		if action == "" {
+			return nil
+		}
+		return s.audit.RecordTx(tx, &AuditEntry{
+			Action:       action,
+			ResourceType: AuditResourcePopup,
+			ResourceID:   popup.ID.String(),
+			Details: map[string]interface{}{
+				"title":       popup.Title,
+				"is_active":   popup.IsActive,
+				"from_status": popup.ScheduleStatus,
+				"to_status":   status,
+				"start_at":    popup.StartAt,
+				"end_at":      popup.EndAt,
+				"timezone":    popup.Timezone,
+				"checked_at":  now,
+			},
+		})
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update popup schedule status: %w", err)
+	}
+
+	if updated {
+		s.logger.WithFields(map[string]interface{}{
+			"popup_id": popup.ID,
+			"from":     popup.ScheduleStatus,
+			"to":       status,
+		}).Info("Popup schedule status changed")
+	}
+	return updated, nil
+}
+
+// scheduleAuditAction 返回排期状态变化对应的审计操作，不需要记录时返回空字符串
+// 排期被清除时弹窗恢复由 IsActive 控制，不记录
+func scheduleAuditAction(from, to string) string {
+	switch {
+	case to == popupspec.ScheduleNone:
+		return ""
+	case to == popupspec.ScheduleActive:
+		return AuditActionPopupActivated
+	case to == popupspec.ScheduleExpired:
+		return AuditActionPopupExpired
+	case from == popupspec.ScheduleActive:
+		return AuditActionPopupDeactivated
+	}
+	return ""
+}
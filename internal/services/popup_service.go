@@ -1,9 +1,12 @@
 package services
 
 import (
+	"context"
+
 	"proxy-enhancer-ultra/internal/models"
 	"proxy-enhancer-ultra/pkg/logger"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -13,8 +16,12 @@ type PopupService struct {
 	logger logger.Logger
 
 	// 组合的专门服务
-	crudService  *PopupCRUDService
-	statsService *PopupStatsService
+	crudService    *PopupCRUDService
+	statsService   *PopupStatsService
+	previewService *PopupPreviewService
+	eventService   *PopupEventService
+
+	translationService *PopupTranslationService
 }
 
 // NewPopupService 创建新的弹窗服务
@@ -24,8 +31,12 @@ func NewPopupService(db *gorm.DB, logger logger.Logger) *PopupService {
 		logger: logger,
 
 		// 初始化专门的服务
-		crudService:  NewPopupCRUDService(db, logger),
-		statsService: NewPopupStatsService(db, logger),
+		crudService:    NewPopupCRUDService(db, logger),
+		statsService:   NewPopupStatsService(db, logger),
+		previewService: NewPopupPreviewService(db, logger),
+		eventService:   NewPopupEventService(db, logger),
+
+		translationService: NewPopupTranslationService(db, logger),
 	}
 }
 
@@ -38,36 +49,76 @@ func (s *PopupService) CreatePopup(req *CreatePopupRequest) (*models.Popup, erro
 }
 
 // GetPopup 获取弹窗 - 委托给CRUD服务
-func (s *PopupService) GetPopup(id uint) (*models.Popup, error) {
+func (s *PopupService) GetPopup(id uuid.UUID) (*models.Popup, error) {
 	return s.crudService.GetPopup(id)
 }
 
 // UpdatePopup 更新弹窗 - 委托给CRUD服务
-func (s *PopupService) UpdatePopup(id uint, req *UpdatePopupRequest) error {
+func (s *PopupService) UpdatePopup(id uuid.UUID, req *UpdatePopupRequest) error {
 	return s.crudService.UpdatePopup(id, req)
 }
 
 // DeletePopup 删除弹窗 - 委托给CRUD服务
-func (s *PopupService) DeletePopup(id uint) error {
+func (s *PopupService) DeletePopup(id uuid.UUID) error {
 	return s.crudService.DeletePopup(id)
 }
 
 // ListPopups 获取弹窗列表 - 委托给CRUD服务
-func (s *PopupService) ListPopups(page, pageSize int, proxyConfigID *uint, popupType string, enabled *bool) ([]*models.Popup, int64, error) {
-	return s.crudService.ListPopups(page, pageSize, proxyConfigID, popupType, enabled)
+func (s *PopupService) ListPopups(page, pageSize int, proxyConfigID *uuid.UUID, enabled *bool) ([]*models.Popup, int64, error) {
+	return s.crudService.ListPopups(page, pageSize, proxyConfigID, enabled)
 }
 
 // TogglePopupStatus 切换弹窗状态 - 委托给CRUD服务
-func (s *PopupService) TogglePopupStatus(id uint) error {
+func (s *PopupService) TogglePopupStatus(id uuid.UUID) error {
 	return s.crudService.TogglePopupStatus(id)
 }
 
 // GetPopupsByProxyConfig 根据代理配置获取弹窗 - 委托给CRUD服务
-func (s *PopupService) GetPopupsByProxyConfig(proxyConfigID uint) ([]*models.Popup, error) {
+func (s *PopupService) GetPopupsByProxyConfig(proxyConfigID uuid.UUID) ([]*models.Popup, error) {
 	return s.crudService.GetPopupsByProxyConfig(proxyConfigID)
 }
 
 // GetPopupStats 获取弹窗统计信息 - 委托给统计服务
-func (s *PopupService) GetPopupStats(id uint) (map[string]interface{}, error) {
+func (s *PopupService) GetPopupStats(id uuid.UUID) (map[string]interface{}, error) {
 	return s.statsService.GetPopupStats(id)
 }
+
+// GetPopupPerformance 获取弹窗按天的性能数据 - 委托给统计服务
+func (s *PopupService) GetPopupPerformance(id uuid.UUID, days int) (map[string]interface{}, error) {
+	return s.statsService.GetPopupPerformance(id, days)
+}
+
+// RecordEvents 记录数据面上报的弹窗事件 - 委托给事件服务
+func (s *PopupService) RecordEvents(proxyConfigID uuid.UUID, visitorID string, events []PopupEventInput) (int, error) {
+	return s.eventService.RecordEvents(proxyConfigID, visitorID, events)
+}
+
+// PreviewPopup 预览弹窗 - 委托给预览服务
+func (s *PopupService) PreviewPopup(ctx context.Context, id uuid.UUID, req *PopupPreviewRequest) (*PopupPreview, error) {
+	return s.previewService.PreviewPopup(ctx, id, req)
+}
+
+// ListTranslations 获取弹窗的翻译 - 委托给翻译服务
+func (s *PopupService) ListTranslations(popupID uuid.UUID) ([]*models.PopupTranslation, error) {
+	return s.translationService.ListTranslations(popupID)
+}
+
+// SaveTranslation 保存弹窗翻译 - 委托给翻译服务
+func (s *PopupService) SaveTranslation(popupID uuid.UUID, locale string, input *PopupTranslationInput) (*models.PopupTranslation, error) {
+	return s.translationService.SaveTranslation(popupID, locale, input)
+}
+
+// DeleteTranslation 删除弹窗翻译 - 委托给翻译服务
+func (s *PopupService) DeleteTranslation(popupID uuid.UUID, locale string) error {
+	return s.translationService.DeleteTranslation(popupID, locale)
+}
+
+// ExportTranslations 导出翻译文件 - 委托给翻译服务
+func (s *PopupService) ExportTranslations(locale string, popupIDs []uuid.UUID) (*TranslationBundle, error) {
+	return s.translationService.ExportTranslations(locale, popupIDs)
+}
+
+// ImportTranslations 导入翻译文件 - 委托给翻译服务
+func (s *PopupService) ImportTranslations(bundle *TranslationBundle) (*TranslationImportResult, error) {
+	return s.translationService.ImportTranslations(bundle)
+}
@@ -3,14 +3,22 @@ package services
 import (
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"proxy-enhancer-ultra/internal/models"
 	"proxy-enhancer-ultra/pkg/logger"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// A/B测试显著性检验参数
+const (
+	variantSignificanceLevel = 0.05 // 显著性水平
+	variantMinImpressions    = 100  // 参与检验的最小曝光数
+)
+
 // PopupStatsService 弹窗统计服务
 type PopupStatsService struct {
 	db     *gorm.DB
@@ -26,10 +34,10 @@ func NewPopupStatsService(db *gorm.DB, logger logger.Logger) *PopupStatsService
 }
 
 // GetPopupStats 获取弹窗统计信息
-func (s *PopupStatsService) GetPopupStats(id uint) (map[string]interface{}, error) {
+func (s *PopupStatsService) GetPopupStats(id uuid.UUID) (map[string]interface{}, error) {
 	// 检查弹窗是否存在
 	var popup models.Popup
-	if err := s.db.First(&popup, id).Error; err != nil {
+	if err := s.db.Where("id = ?", id).First(&popup).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("popup not found")
 		}
@@ -41,25 +49,25 @@ func (s *PopupStatsService) GetPopupStats(id uint) (map[string]interface{}, erro
 
 	// 总提交数
 	var totalSubmissions int64
-	s.db.Model(&models.Submission{}).Where("popup_id = ?", id).Count(&totalSubmissions)
+	s.db.Model(&models.Submission{}).Where("popup_id = ? AND is_partial = ?", id, false).Count(&totalSubmissions)
 	stats["total_submissions"] = totalSubmissions
 
 	// 今日提交数
 	var todaySubmissions int64
 	today := time.Now().Truncate(24 * time.Hour)
-	s.db.Model(&models.Submission{}).Where("popup_id = ? AND created_at >= ?", id, today).Count(&todaySubmissions)
+	s.db.Model(&models.Submission{}).Where("popup_id = ? AND is_partial = ? AND created_at >= ?", id, false, today).Count(&todaySubmissions)
 	stats["today_submissions"] = todaySubmissions
 
 	// 本周提交数
 	var weekSubmissions int64
 	weekStart := time.Now().AddDate(0, 0, -int(time.Now().Weekday())).Truncate(24 * time.Hour)
-	s.db.Model(&models.Submission{}).Where("popup_id = ? AND created_at >= ?", id, weekStart).Count(&weekSubmissions)
+	s.db.Model(&models.Submission{}).Where("popup_id = ? AND is_partial = ? AND created_at >= ?", id, false, weekStart).Count(&weekSubmissions)
 	stats["week_submissions"] = weekSubmissions
 
 	// 本月提交数
 	var monthSubmissions int64
 	monthStart := time.Date(time.Now().Year(), time.Now().Month(), 1, 0, 0, 0, 0, time.Now().Location())
-	s.db.Model(&models.Submission{}).Where("popup_id = ? AND created_at >= ?", id, monthStart).Count(&monthSubmissions)
+	s.db.Model(&models.Submission{}).Where("popup_id = ? AND is_partial = ? AND created_at >= ?", id, false, monthStart).Count(&monthSubmissions)
 	stats["month_submissions"] = monthSubmissions
 
 	// 最近提交时间
@@ -70,9 +78,240 @@ func (s *PopupStatsService) GetPopupStats(id uint) (map[string]interface{}, erro
 		stats["last_submission_at"] = nil
 	}
 
+	// 曝光、点击、关闭及各变体对比
+	variants, totals, err := s.getVariantStats(id)
+	if err != nil {
+		return nil, err
+	}
+	stats["total_impressions"] = totals.Impressions
+	stats["total_clicks"] = totals.Clicks
+	stats["total_closes"] = totals.Closes
+	stats["conversion_rate"] = conversionRate(totalSubmissions, totals.Impressions)
+	stats["click_through_rate"] = conversionRate(totals.Clicks, totals.Impressions)
+	stats["dismiss_rate"] = conversionRate(totals.Closes, totals.Impressions)
+	stats["variants"] = variants
+
+	// 从弹窗展示到提交的耗时
+	timeToSubmit, err := s.getTimeToSubmit(s.db.Where("popup_id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	stats["avg_time_to_submit_ms"] = timeToSubmit.Avg
+	stats["median_time_to_submit_ms"] = timeToSubmit.Median
+
 	return stats, nil
 }
 
+// variantCount 按变体分组的计数
+type variantCount struct {
+	VariantID *uuid.UUID
+	Count     int64
+}
+
+// popupEventCount 按变体和事件类型分组的计数
+type popupEventCount struct {
+	VariantID *uuid.UUID
+	EventType string
+	Count     int64
+}
+
+// popupEventTotals 弹窗事件汇总
+type popupEventTotals struct {
+	Impressions int64
+	Clicks      int64
+	Closes      int64
+}
+
+// add 累加一组事件计数
+func (t *popupEventTotals) add(eventType string, count int64) {
+	switch eventType {
+	case models.PopupEventImpression:
+		t.Impressions += count
+	case models.PopupEventClick:
+		t.Clicks += count
+	case models.PopupEventClose:
+		t.Closes += count
+	}
+}
+
+// countPopupEvents 按事件类型统计范围内的弹窗事件
+func (s *PopupStatsService) countPopupEvents(scope *gorm.DB) (*popupEventTotals, error) {
+	var rows []popupEventCount
+	if err := scope.Model(&models.PopupEvent{}).Select("event_type, COUNT(*) AS count").
+		Group("event_type").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count popup events: %w", err)
+	}
+
+	totals := &popupEventTotals{}
+	for _, row := range rows {
+		totals.add(row.EventType, row.Count)
+	}
+	return totals, nil
+}
+
+// timeToSubmit 展示到提交耗时的统计，没有数据时为nil
+type timeToSubmit struct {
+	Avg    *float64
+	Median *float64
+}
+
+// getTimeToSubmit 统计提交事件距弹窗展示的平均和中位耗时（毫秒）
+func (s *PopupStatsService) getTimeToSubmit(scope *gorm.DB) (*timeToSubmit, error) {
+	var result timeToSubmit
+	err := scope.Model(&models.PopupEvent{}).
+		Select("AVG(elapsed_ms) AS avg, PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY elapsed_ms) AS median").
+		Where("event_type = ? AND elapsed_ms IS NOT NULL", models.PopupEventSubmit).
+		Scan(&result).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute time to submit: %w", err)
+	}
+	return &result, nil
+}
+
+// GetVariantStats 获取弹窗各变体的曝光、提交、转化率，并与对照组做显著性检验
+func (s *PopupStatsService) GetVariantStats(id uuid.UUID) ([]*PopupVariantStats, int64, error) {
+	variants, totals, err := s.getVariantStats(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	return variants, totals.Impressions, nil
+}
+
+// getVariantStats 获取弹窗各变体的统计及全部变体的事件汇总
+func (s *PopupStatsService) getVariantStats(id uuid.UUID) ([]*PopupVariantStats, *popupEventTotals, error) {
+	var variants []models.PopupVariant
+	if err := s.db.Where("popup_id = ?", id).Order("created_at ASC").Find(&variants).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get popup variants: %w", err)
+	}
+
+	var events []popupEventCount
+	if err := s.db.Model(&models.PopupEvent{}).Select("variant_id, event_type, COUNT(*) AS count").
+		Where("popup_id = ? AND event_type IN ?", id, []string{models.PopupEventImpression, models.PopupEventClick, models.PopupEventClose}).
+		Group("variant_id, event_type").Scan(&events).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count popup events: %w", err)
+	}
+
+	var submissions []variantCount
+	if err := s.db.Model(&models.Submission{}).Select("variant_id, COUNT(*) AS count").
+		Where("popup_id = ? AND is_partial = ?", id, false).Group("variant_id").Scan(&submissions).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count popup submissions: %w", err)
+	}
+
+	// 按变体汇总，uuid.Nil 表示未分配变体
+	eventsBy := make(map[uuid.UUID]*popupEventTotals)
+	totals := &popupEventTotals{}
+	for _, row := range events {
+		key := variantKey(row.VariantID)
+		if eventsBy[key] == nil {
+			eventsBy[key] = &popupEventTotals{}
+		}
+		eventsBy[key].add(row.EventType, row.Count)
+		totals.add(row.EventType, row.Count)
+	}
+	submissionsBy := make(map[uuid.UUID]int64, len(submissions))
+	for _, row := range submissions {
+		submissionsBy[variantKey(row.VariantID)] = row.Count
+	}
+
+	result := make([]*PopupVariantStats, 0, len(variants)+1)
+	var control *PopupVariantStats
+	for i := range variants {
+		variant := &variants[i]
+		stat := &PopupVariantStats{
+			VariantID:   &variant.ID,
+			Name:        variant.Name,
+			Weight:      variant.Weight,
+			IsControl:   variant.IsControl,
+			IsActive:    variant.IsActive,
+			Submissions: submissionsBy[variant.ID],
+		}
+		stat.setEvents(eventsBy[variant.ID])
+		if variant.IsControl {
+			control = stat
+		}
+		result = append(result, stat)
+	}
+
+	// 未指定对照组时使用最早创建的变体
+	if control == nil && len(result) > 0 {
+		control = result[0]
+	}
+
+	// 启用A/B测试前或未分配变体的数据单独列出，不参与检验
+	if eventsBy[uuid.Nil] != nil || submissionsBy[uuid.Nil] > 0 {
+		stat := &PopupVariantStats{
+			Name:        "unassigned",
+			Submissions: submissionsBy[uuid.Nil],
+		}
+		stat.setEvents(eventsBy[uuid.Nil])
+		result = append(result, stat)
+	}
+
+	if control != nil {
+		for _, stat := range result {
+			if stat == control || stat.VariantID == nil {
+				continue
+			}
+			compareToControl(stat, control)
+		}
+	}
+
+	return result, totals, nil
+}
+
+// setEvents 填充变体的事件计数并计算各项比率
+func (stat *PopupVariantStats) setEvents(totals *popupEventTotals) {
+	if totals != nil {
+		stat.Impressions = totals.Impressions
+		stat.Clicks = totals.Clicks
+		stat.Closes = totals.Closes
+	}
+	stat.ConversionRate = conversionRate(stat.Submissions, stat.Impressions)
+	stat.ClickThroughRate = conversionRate(stat.Clicks, stat.Impressions)
+	stat.DismissRate = conversionRate(stat.Closes, stat.Impressions)
+}
+
+// variantKey 将可为空的变体ID转换为map键
+func variantKey(id *uuid.UUID) uuid.UUID {
+	if id == nil {
+		return uuid.Nil
+	}
+	return *id
+}
+
+// conversionRate 计算相对曝光数的比率，如转化率、点击率、关闭率
+func conversionRate(count, impressions int64) float64 {
+	if impressions == 0 {
+		return 0
+	}
+	return float64(count) / float64(impressions)
+}
+
+// compareToControl 计算变体相对对照组的提升，并用双比例z检验判断差异是否显著
+func compareToControl(stat, control *PopupVariantStats) {
+	if control.ConversionRate > 0 {
+		lift := (stat.ConversionRate - control.ConversionRate) / control.ConversionRate
+		stat.Lift = &lift
+	}
+
+	n1, n2 := float64(control.Impressions), float64(stat.Impressions)
+	if n1 == 0 || n2 == 0 {
+		return
+	}
+	pooled := (float64(control.Submissions) + float64(stat.Submissions)) / (n1 + n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/n1 + 1/n2))
+	if se == 0 {
+		return
+	}
+
+	z := (stat.ConversionRate - control.ConversionRate) / se
+	p := math.Erfc(math.Abs(z) / math.Sqrt2)
+	stat.ZScore = &z
+	stat.PValue = &p
+	stat.Significant = p < variantSignificanceLevel &&
+		control.Impressions >= variantMinImpressions && stat.Impressions >= variantMinImpressions
+}
+
 // GetOverallStats 获取总体统计信息
 func (s *PopupStatsService) GetOverallStats() (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
@@ -118,10 +357,10 @@ func (s *PopupStatsService) GetOverallStats() (map[string]interface{}, error) {
 }
 
 // GetPopupPerformance 获取弹窗性能数据
-func (s *PopupStatsService) GetPopupPerformance(id uint, days int) (map[string]interface{}, error) {
+func (s *PopupStatsService) GetPopupPerformance(id uuid.UUID, days int) (map[string]interface{}, error) {
 	// 检查弹窗是否存在
 	var popup models.Popup
-	if err := s.db.First(&popup, id).Error; err != nil {
+	if err := s.db.Where("id = ?", id).First(&popup).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("popup not found")
 		}
@@ -133,10 +372,14 @@ func (s *PopupStatsService) GetPopupPerformance(id uint, days int) (map[string]i
 	// 计算开始时间
 	startTime := time.Now().AddDate(0, 0, -days).Truncate(24 * time.Hour)
 
-	// 按天统计提交数
+	// 按天统计提交数和弹窗事件
 	type DailyStats struct {
-		Date  string `json:"date"`
-		Count int64  `json:"count"`
+		Date           string  `json:"date"`
+		Count          int64   `json:"count"` // 提交数
+		Impressions    int64   `json:"impressions"`
+		Clicks         int64   `json:"clicks"`
+		Closes         int64   `json:"closes"`
+		ConversionRate float64 `json:"conversion_rate"`
 	}
 
 	var dailyStats []DailyStats
@@ -146,12 +389,21 @@ func (s *PopupStatsService) GetPopupPerformance(id uint, days int) (map[string]i
 
 		var count int64
 		s.db.Model(&models.Submission{}).
-			Where("popup_id = ? AND created_at >= ? AND created_at < ?", id, date, nextDate).
+			Where("popup_id = ? AND is_partial = ? AND created_at >= ? AND created_at < ?", id, false, date, nextDate).
 			Count(&count)
 
+		events, err := s.countPopupEvents(s.db.Where("popup_id = ? AND created_at >= ? AND created_at < ?", id, date, nextDate))
+		if err != nil {
+			return nil, err
+		}
+
 		dailyStats = append(dailyStats, DailyStats{
-			Date:  date.Format("2006-01-02"),
-			Count: count,
+			Date:           date.Format("2006-01-02"),
+			Count:          count,
+			Impressions:    events.Impressions,
+			Clicks:         events.Clicks,
+			Closes:         events.Closes,
+			ConversionRate: conversionRate(count, events.Impressions),
 		})
 	}
 
@@ -160,10 +412,27 @@ func (s *PopupStatsService) GetPopupPerformance(id uint, days int) (map[string]i
 	// 计算总提交数（指定时间范围内）
 	var totalInPeriod int64
 	s.db.Model(&models.Submission{}).
-		Where("popup_id = ? AND created_at >= ?", id, startTime).
+		Where("popup_id = ? AND is_partial = ? AND created_at >= ?", id, false, startTime).
 		Count(&totalInPeriod)
 	performance["total_in_period"] = totalInPeriod
 
+	// 指定时间范围内的曝光、点击率、关闭率和提交耗时
+	events, err := s.countPopupEvents(s.db.Where("popup_id = ? AND created_at >= ?", id, startTime))
+	if err != nil {
+		return nil, err
+	}
+	performance["impressions_in_period"] = events.Impressions
+	performance["conversion_rate"] = conversionRate(totalInPeriod, events.Impressions)
+	performance["click_through_rate"] = conversionRate(events.Clicks, events.Impressions)
+	performance["dismiss_rate"] = conversionRate(events.Closes, events.Impressions)
+
+	timeToSubmit, err := s.getTimeToSubmit(s.db.Where("popup_id = ? AND created_at >= ?", id, startTime))
+	if err != nil {
+		return nil, err
+	}
+	performance["avg_time_to_submit_ms"] = timeToSubmit.Avg
+	performance["median_time_to_submit_ms"] = timeToSubmit.Median
+
 	// 计算平均每日提交数
 	avgDaily := float64(totalInPeriod) / float64(days)
 	performance["avg_daily_submissions"] = avgDaily
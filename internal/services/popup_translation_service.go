@@ -0,0 +1,304 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 弹窗翻译限制
+const (
+	maxTranslationTitleLen = 200  // 与 Popup.Title 的长度一致
+	maxTranslationImport   = 1000 // 单个翻译文件的最大弹窗数
+)
+
+// PopupTranslationService 弹窗翻译服务，管理弹窗的多语言文字并支持按语言导出、导入翻译文件
+type PopupTranslationService struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewPopupTranslationService 创建新的弹窗翻译服务
+func NewPopupTranslationService(db *gorm.DB, logger logger.Logger) *PopupTranslationService {
+	return &PopupTranslationService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ListTranslations 获取弹窗的所有翻译，按语言排序
+func (s *PopupTranslationService) ListTranslations(popupID uuid.UUID) ([]*models.PopupTranslation, error) {
+	if _, err := s.getPopup(s.db, popupID); err != nil {
+		return nil, err
+	}
+
+	var translations []*models.PopupTranslation
+	if err := s.db.Where("popup_id = ?", popupID).Order("locale ASC").Find(&translations).Error; err != nil {
+		return nil, fmt.Errorf("failed to get popup translations: %w", err)
+	}
+	return translations, nil
+}
+
+// SaveTranslation 创建或替换弹窗在某个语言下的翻译
+func (s *PopupTranslationService) SaveTranslation(popupID uuid.UUID, locale string, input *PopupTranslationInput) (*models.PopupTranslation, error) {
+	locale, err := popupspec.NormalizeLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+	popup, err := s.getPopup(s.db, popupID)
+	if err != nil {
+		return nil, err
+	}
+	translation, err := buildPopupTranslation(popup, locale, input)
+	if err != nil {
+		return nil, err
+	}
+	if translation == nil {
+		return nil, errors.New("translation is empty")
+	}
+
+	if err := upsertPopupTranslation(s.db, translation); err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"popup_id": popupID,
+			"locale":   locale,
+			"error":    err.Error(),
+		}).Error("Failed to save popup translation")
+		return nil, err
+	}
+
+	var saved models.PopupTranslation
+	if err := s.db.Where("popup_id = ? AND locale = ?", popupID, locale).First(&saved).Error; err != nil {
+		return nil, fmt.Errorf("failed to get popup translation: %w", err)
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"popup_id": popupID,
+		"locale":   locale,
+	}).Info("Popup translation saved successfully")
+
+	return &saved, nil
+}
+
+// DeleteTranslation 删除弹窗在某个语言下的翻译
+func (s *PopupTranslationService) DeleteTranslation(popupID uuid.UUID, locale string) error {
+	locale, err := popupspec.NormalizeLocale(locale)
+	if err != nil {
+		return err
+	}
+
+	// 唯一索引包含软删除的记录，使用硬删除以便重新创建同一语言的翻译
+	result := s.db.Unscoped().Where("popup_id = ? AND locale = ?", popupID, locale).Delete(&models.PopupTranslation{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete popup translation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("popup translation not found")
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"popup_id": popupID,
+		"locale":   locale,
+	}).Info("Popup translation deleted successfully")
+
+	return nil
+}
+
+// ExportTranslations 导出某个语言的翻译文件，包含弹窗原文和已有的翻译，popupIDs 为空时导出所有弹窗
+func (s *PopupTranslationService) ExportTranslations(locale string, popupIDs []uuid.UUID) (*TranslationBundle, error) {
+	locale, err := popupspec.NormalizeLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+
+	query := s.db.Select("id", "title", "content", "form_config", "default_locale").
+		Preload("Translations", "locale = ?", locale).
+		Order("created_at ASC")
+	if len(popupIDs) > 0 {
+		query = query.Where("id IN ?", popupIDs)
+	}
+	var popups []models.Popup
+	if err := query.Find(&popups).Error; err != nil {
+		return nil, fmt.Errorf("failed to get popups: %w", err)
+	}
+
+	bundle := &TranslationBundle{
+		Locale:     locale,
+		ExportedAt: time.Now().UTC(),
+		Popups:     make([]TranslationBundleEntry, 0, len(popups)),
+	}
+	for _, popup := range popups {
+		entry := TranslationBundleEntry{
+			PopupID:      popup.ID,
+			SourceLocale: popup.DefaultLocale,
+			Source: PopupTranslationInput{
+				Title:   popup.Title,
+				Content: popup.Content,
+			},
+		}
+		if form, err := popupspec.ParseFormConfig(popup.FormConfig); err == nil && !form.IsZero() {
+			entry.Source.Form = form.SourceTexts()
+		}
+		if len(popup.Translations) > 0 {
+			translation := popup.Translations[0]
+			entry.Translation.Title = translation.Title
+			entry.Translation.Content = translation.Content
+			if form, err := popupspec.ParseFormTranslation(translation.FormTranslation); err == nil && !form.IsZero() {
+				entry.Translation.Form = form
+			}
+		}
+		bundle.Popups = append(bundle.Popups, entry)
+	}
+
+	return bundle, nil
+}
+
+// ImportTranslations 导入翻译文件，所有条目校验通过后在一个事务中保存
+// 翻译为空或弹窗已不存在的条目被跳过，表单中已不存在的字段和步骤的翻译被忽略
+func (s *PopupTranslationService) ImportTranslations(bundle *TranslationBundle) (*TranslationImportResult, error) {
+	locale, err := popupspec.NormalizeLocale(bundle.Locale)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundle.Popups) == 0 {
+		return nil, errors.New("translation bundle has no popups")
+	}
+	if len(bundle.Popups) > maxTranslationImport {
+		return nil, fmt.Errorf("translation bundle has too many popups, at most %d", maxTranslationImport)
+	}
+
+	popupIDs := make([]uuid.UUID, 0, len(bundle.Popups))
+	for _, entry := range bundle.Popups {
+		popupIDs = append(popupIDs, entry.PopupID)
+	}
+	var popups []models.Popup
+	if err := s.db.Select("id", "form_config", "default_locale").Where("id IN ?", popupIDs).Find(&popups).Error; err != nil {
+		return nil, fmt.Errorf("failed to get popups: %w", err)
+	}
+	byID := make(map[uuid.UUID]*models.Popup, len(popups))
+	for i := range popups {
+		byID[popups[i].ID] = &popups[i]
+	}
+
+	result := &TranslationImportResult{Locale: locale}
+	translations := make([]*models.PopupTranslation, 0, len(bundle.Popups))
+	seen := make(map[uuid.UUID]bool, len(bundle.Popups))
+	for _, entry := range bundle.Popups {
+		popup, ok := byID[entry.PopupID]
+		if !ok || seen[entry.PopupID] {
+			result.Skipped++
+			continue
+		}
+		seen[entry.PopupID] = true
+		input := entry.Translation
+		translation, err := buildPopupTranslation(popup, locale, &input)
+		if err != nil {
+			return nil, fmt.Errorf("popup %s: %w", entry.PopupID, err)
+		}
+		if translation == nil {
+			result.Skipped++
+			continue
+		}
+		translations = append(translations, translation)
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, translation := range translations {
+			if err := upsertPopupTranslation(tx, translation); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"locale": locale,
+			"error":  err.Error(),
+		}).Error("Failed to import popup translations")
+		return nil, err
+	}
+	result.Imported = len(translations)
+
+	s.logger.WithFields(map[string]interface{}{
+		"locale":   locale,
+		"imported": result.Imported,
+		"skipped":  result.Skipped,
+	}).Info("Popup translations imported successfully")
+
+	return result, nil
+}
+
+// getPopup 获取翻译所需的弹窗字段
+func (s *PopupTranslationService) getPopup(db *gorm.DB, popupID uuid.UUID) (*models.Popup, error) {
+	var popup models.Popup
+	if err := db.Select("id", "form_config", "default_locale").Where("id = ?", popupID).First(&popup).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("popup not found")
+		}
+		return nil, fmt.Errorf("failed to get popup: %w", err)
+	}
+	return &popup, nil
+}
+
+// buildPopupTranslation 校验翻译请求并创建翻译模型，翻译为空时返回nil
+func buildPopupTranslation(popup *models.Popup, locale string, input *PopupTranslationInput) (*models.PopupTranslation, error) {
+	if popup.DefaultLocale != "" && strings.EqualFold(popup.DefaultLocale, locale) {
+		return nil, fmt.Errorf("locale %s is the popup default locale", locale)
+	}
+
+	title := strings.TrimSpace(input.Title)
+	if utf8.RuneCountInString(title) > maxTranslationTitleLen {
+		return nil, fmt.Errorf("title must be at most %d characters", maxTranslationTitleLen)
+	}
+	content := strings.TrimSpace(input.Content)
+
+	formTranslation := "{}"
+	if input.Form != nil {
+		input.Form.Normalize()
+		if err := input.Form.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid form translation: %w", err)
+		}
+		form, err := popupspec.ParseFormConfig(popup.FormConfig)
+		if err != nil {
+			return nil, err
+		}
+		input.Form.Retain(form)
+		if !input.Form.IsZero() {
+			if formTranslation, err = input.Form.Marshal(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if title == "" && content == "" && formTranslation == "{}" {
+		return nil, nil
+	}
+	return &models.PopupTranslation{
+		PopupID:         popup.ID,
+		Locale:          locale,
+		Title:           title,
+		Content:         content,
+		FormTranslation: formTranslation,
+	}, nil
+}
+
+// upsertPopupTranslation 按弹窗和语言创建或替换翻译
+func upsertPopupTranslation(db *gorm.DB, translation *models.PopupTranslation) error {
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "popup_id"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "content", "form_translation", "updated_at"}),
+	}).Create(translation).Error
+	if err != nil {
+		return fmt.Errorf("failed to save popup translation: %w", err)
+	}
+	return nil
+}
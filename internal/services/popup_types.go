@@ -1,16 +1,38 @@
 package services
 
+import (
+	"time"
+
+	"proxy-enhancer-ultra/internal/popupspec"
+
+	"github.com/google/uuid"
+)
+
 // CreatePopupRequest 创建弹窗请求
 type CreatePopupRequest struct {
-	ProxyConfigID uint   `json:"proxy_config_id" binding:"required"`
-	Title         string `json:"title" binding:"required"`
-	Content       string `json:"content" binding:"required"`
-	PopupType     string `json:"popup_type" binding:"required"`
-	TriggerType   string `json:"trigger_type" binding:"required"`
-	TriggerValue  string `json:"trigger_value"`
-	Position      string `json:"position"`
-	Style         string `json:"style"`
-	Enabled       *bool  `json:"enabled"`
+	ProxyConfigID  uuid.UUID   `json:"proxy_config_id"`  // 绑定的代理配置，兼容旧版单个ID
+	ProxyConfigIDs []uuid.UUID `json:"proxy_config_ids"` // 绑定的代理配置列表
+	IsGlobal       bool        `json:"is_global"`        // 对所有代理配置生效
+	Title          string      `json:"title" binding:"required"`
+	Content        string      `json:"content" binding:"required"`
+	PopupType      string      `json:"popup_type" binding:"required"`
+	TriggerType    string      `json:"trigger_type" binding:"required"`
+	TriggerValue   string      `json:"trigger_value"` // 延迟秒数、滚动百分比或CSS选择器，取决于触发方式
+	Position       string      `json:"position"`      // 兼容旧版，等同于 style_config.position
+	Style          string      `json:"style"`         // 兼容旧版，StyleConfig 的JSON字符串
+	Enabled        *bool       `json:"enabled"`
+
+	StyleConfig  *popupspec.StyleConfig    `json:"style_config"`  // 样式配置，为空时使用默认样式
+	Variants     []PopupVariantInput       `json:"variants"`      // A/B测试变体，为空时不分流
+	DisplayRules *popupspec.DisplayRules   `json:"display_rules"` // 频率限制和受众规则，为空时不限制
+	Schedule     *popupspec.Schedule       `json:"schedule"`      // 投放排期，为空时一直投放
+	APICall      *popupspec.APICallTrigger `json:"api_call"`      // 接口调用触发条件，触发方式为 api_call 时必填
+	FormConfig   *popupspec.FormConfig     `json:"form_config"`   // 表单配置，为空时使用弹窗内容中自带的表单
+
+	DefaultLocale string `json:"default_locale"` // 原文语言，如 en，没有匹配的翻译时使用原文
+
+	Retention *popupspec.Retention `json:"retention"` // 提交数据保留策略，为空时使用全局配置
+	Dedup     *popupspec.Dedup     `json:"dedup"`     // 提交去重配置，为空时不去重
 }
 
 // UpdatePopupRequest 更新弹窗请求
@@ -20,7 +42,109 @@ type UpdatePopupRequest struct {
 	PopupType    string `json:"popup_type"`
 	TriggerType  string `json:"trigger_type"`
 	TriggerValue string `json:"trigger_value"`
-	Position     string `json:"position"`
-	Style        string `json:"style"`
+	Position     string `json:"position"` // 兼容旧版，只修改样式配置中的位置
+	Style        string `json:"style"`    // 兼容旧版，StyleConfig 的JSON字符串
 	Enabled      *bool  `json:"enabled"`
+
+	ProxyConfigIDs *[]uuid.UUID `json:"proxy_config_ids"` // 传入时替换绑定的代理配置
+	IsGlobal       *bool        `json:"is_global"`
+
+	StyleConfig  *popupspec.StyleConfig    `json:"style_config"`  // 传入时替换样式配置
+	Variants     *[]PopupVariantInput      `json:"variants"`      // 传入时同步变体：更新带ID的变体，创建新变体，删除未传入的变体
+	DisplayRules *popupspec.DisplayRules   `json:"display_rules"` // 传入时替换展示规则
+	Schedule     *popupspec.Schedule       `json:"schedule"`      // 传入时替换投放排期，传入 {} 清除排期
+	APICall      *popupspec.APICallTrigger `json:"api_call"`      // 传入时替换接口调用触发条件，触发方式改为 api_call 时必填
+	FormConfig   *popupspec.FormConfig     `json:"form_config"`   // 传入时替换表单配置，传入 {} 清除
+
+	DefaultLocale *string `json:"default_locale"` // 传入时替换原文语言，传入空字符串清除
+
+	Retention *popupspec.Retention `json:"retention"` // 传入时替换提交数据保留策略，传入 {} 使用全局配置
+	Dedup     *popupspec.Dedup     `json:"dedup"`     // 传入时替换提交去重配置，传入 {} 关闭去重
+}
+
+// PopupVariantInput 弹窗变体请求
+type PopupVariantInput struct {
+	ID        *uuid.UUID `json:"id"` // 更新已有变体时传入
+	Name      string     `json:"name"`
+	Title     string     `json:"title"`   // 为空时使用弹窗标题
+	Content   string     `json:"content"` // 为空时使用弹窗内容
+	Style     string     `json:"style"`   // 兼容旧版，StyleConfig 的JSON字符串
+	Weight    int        `json:"weight"`  // 流量权重
+	IsControl bool       `json:"is_control"`
+	Enabled   *bool      `json:"enabled"`
+
+	StyleConfig *popupspec.StyleConfig `json:"style_config"` // 变体样式，不为空时替换弹窗的样式配置
+}
+
+// PopupPreviewRequest 弹窗预览请求
+type PopupPreviewRequest struct {
+	ProxyConfigID *uuid.UUID `json:"proxy_config_id"` // 指定后在代理页面中预览
+	VariantID     *uuid.UUID `json:"variant_id"`      // 预览指定的变体
+	Locale        string     `json:"locale"`          // 预览指定语言的翻译
+	URL           string     `json:"url"`
+	UserAgent     string     `json:"user_agent"`
+	FullPipeline  bool       `json:"full_pipeline"`
+}
+
+// PopupVariantStats 弹窗变体统计
+type PopupVariantStats struct {
+	VariantID        *uuid.UUID `json:"variant_id"` // 为空表示未分配变体的曝光和提交
+	Name             string     `json:"name"`
+	Weight           int        `json:"weight"`
+	IsControl        bool       `json:"is_control"`
+	IsActive         bool       `json:"is_active"`
+	Impressions      int64      `json:"impressions"`
+	Clicks           int64      `json:"clicks"`
+	Closes           int64      `json:"closes"`
+	Submissions      int64      `json:"submissions"`
+	ConversionRate   float64    `json:"conversion_rate"`    // 提交数 / 曝光数
+	ClickThroughRate float64    `json:"click_through_rate"` // 点击数 / 曝光数
+	DismissRate      float64    `json:"dismiss_rate"`       // 关闭数 / 曝光数
+	Lift             *float64   `json:"lift"`               // 相对对照组转化率的提升比例
+	ZScore           *float64   `json:"z_score"`            // 与对照组的双比例z检验统计量
+	PValue           *float64   `json:"p_value"`            // 双侧p值
+	Significant      bool       `json:"significant"`        // p值低于显著性水平且样本量足够
+}
+
+// PopupEventInput 数据面上报的弹窗事件
+type PopupEventInput struct {
+	PopupID   uuid.UUID  `json:"popup_id"`
+	VariantID *uuid.UUID `json:"variant_id"`
+	Type      string     `json:"type"`       // impression、close、click、submit
+	ElapsedMS *int64     `json:"elapsed_ms"` // 距弹窗展示的毫秒数
+	Target    string     `json:"target"`     // 点击的行动按钮标识
+}
+
+// PopupEventBatch 数据面事件上报请求
+type PopupEventBatch struct {
+	Events []PopupEventInput `json:"events"`
+}
+
+// PopupTranslationInput 弹窗翻译请求，为空的文字使用原文
+type PopupTranslationInput struct {
+	Title   string                     `json:"title"`
+	Content string                     `json:"content"`
+	Form    *popupspec.FormTranslation `json:"form"` // 表单文字翻译
+}
+
+// TranslationBundle 一种语言的弹窗翻译文件，导出给翻译人员填写后再导入
+type TranslationBundle struct {
+	Locale     string                   `json:"locale"`
+	ExportedAt time.Time                `json:"exported_at"`
+	Popups     []TranslationBundleEntry `json:"popups"`
+}
+
+// TranslationBundleEntry 翻译文件中的单个弹窗，导入时只读取 popup_id 和 translation
+type TranslationBundleEntry struct {
+	PopupID      uuid.UUID             `json:"popup_id"`
+	SourceLocale string                `json:"source_locale"` // 原文语言
+	Source       PopupTranslationInput `json:"source"`        // 需要翻译的原文
+	Translation  PopupTranslationInput `json:"translation"`   // 已有的翻译，由翻译人员填写
+}
+
+// TranslationImportResult 翻译导入结果
+type TranslationImportResult struct {
+	Locale   string `json:"locale"`
+	Imported int    `json:"imported"` // 保存的翻译数
+	Skipped  int    `json:"skipped"`  // 翻译为空或弹窗不存在而跳过的条目数
 }
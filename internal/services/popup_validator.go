@@ -1,6 +1,20 @@
 package services
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"proxy-enhancer-ultra/internal/popupspec"
+)
+
+// 弹窗变体限制
+const (
+	maxPopupVariants      = 20
+	maxPopupVariantWeight = 10000
+	maxPopupTriggerDelay  = 3600 // 延迟触发的最大秒数
+)
 
 // PopupValidator 弹窗验证器
 type PopupValidator struct{}
@@ -21,21 +35,60 @@ func (v *PopupValidator) ValidatePopupType(popupType string) error {
 
 // ValidateTriggerType 验证触发类型
 func (v *PopupValidator) ValidateTriggerType(triggerType string) error {
-	validTriggerTypes := []string{"page_load", "time_delay", "scroll_percentage", "element_click", "exit_intent", "form_submit"}
-	if !containsString(validTriggerTypes, triggerType) {
+	if !containsString(popupspec.TriggerTypes, triggerType) {
 		return errors.New("invalid trigger type")
 	}
 	return nil
 }
 
+// ValidateTrigger 按触发方式验证触发值和接口调用触发条件
+func (v *PopupValidator) ValidateTrigger(triggerType, triggerValue string, apiCall *popupspec.APICallTrigger) error {
+	triggerValue = strings.TrimSpace(triggerValue)
+	switch triggerType {
+	case popupspec.TriggerTimeDelay:
+		seconds, err := strconv.ParseFloat(triggerValue, 64)
+		if err != nil || seconds < 0 || seconds > maxPopupTriggerDelay {
+			return fmt.Errorf("trigger_value must be a delay between 0 and %d seconds", maxPopupTriggerDelay)
+		}
+	case popupspec.TriggerScrollPercentage:
+		percentage, err := strconv.ParseFloat(triggerValue, 64)
+		if err != nil || percentage < 0 || percentage > 100 {
+			return errors.New("trigger_value must be a percentage between 0 and 100")
+		}
+	case popupspec.TriggerElementClick:
+		if triggerValue == "" {
+			return errors.New("trigger_value must be a CSS selector for element_click trigger")
+		}
+	case popupspec.TriggerAPICall:
+		if apiCall == nil {
+			return errors.New("api_call is required for api_call trigger")
+		}
+	}
+	if triggerType != popupspec.TriggerAPICall && apiCall != nil {
+		return errors.New("api_call can only be set for api_call trigger")
+	}
+	return v.ValidateAPICallTrigger(apiCall)
+}
+
+// ValidateAPICallTrigger 规范化并验证接口调用触发条件，为nil时不做处理
+func (v *PopupValidator) ValidateAPICallTrigger(apiCall *popupspec.APICallTrigger) error {
+	if apiCall == nil {
+		return nil
+	}
+	apiCall.Normalize()
+	if err := apiCall.Validate(); err != nil {
+		return fmt.Errorf("invalid api_call trigger: %w", err)
+	}
+	return nil
+}
+
 // ValidatePosition 验证位置
 func (v *PopupValidator) ValidatePosition(position string) error {
 	if position == "" {
 		return nil // 位置是可选的
 	}
 
-	validPositions := []string{"top", "bottom", "left", "right", "center", "top-left", "top-right", "bottom-left", "bottom-right"}
-	if !containsString(validPositions, position) {
+	if !containsString(popupspec.Positions, position) {
 		return errors.New("invalid position")
 	}
 	return nil
@@ -51,10 +104,46 @@ func (v *PopupValidator) ValidateCreateRequest(req *CreatePopupRequest) error {
 		return err
 	}
 
+	if err := v.ValidateTrigger(req.TriggerType, req.TriggerValue, req.APICall); err != nil {
+		return err
+	}
+
 	if err := v.ValidatePosition(req.Position); err != nil {
 		return err
 	}
 
+	if err := v.ValidateStyleConfig(req.StyleConfig, req.Style); err != nil {
+		return err
+	}
+
+	if err := v.ValidateVariants(req.Variants); err != nil {
+		return err
+	}
+
+	if err := v.ValidateDisplayRules(req.DisplayRules); err != nil {
+		return err
+	}
+
+	if err := v.ValidateSchedule(req.Schedule); err != nil {
+		return err
+	}
+
+	if err := v.ValidateRetention(req.Retention); err != nil {
+		return err
+	}
+
+	if err := v.ValidateDedup(req.Dedup, req.FormConfig); err != nil {
+		return err
+	}
+
+	if err := v.ValidateFormConfig(req.FormConfig); err != nil {
+		return err
+	}
+
+	if err := v.ValidateDefaultLocale(&req.DefaultLocale); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -70,12 +159,180 @@ func (v *PopupValidator) ValidateUpdateRequest(req *UpdatePopupRequest) error {
 		if err := v.ValidateTriggerType(req.TriggerType); err != nil {
 			return err
 		}
+		if err := v.ValidateTrigger(req.TriggerType, req.TriggerValue, req.APICall); err != nil {
+			return err
+		}
+	} else if err := v.ValidateAPICallTrigger(req.APICall); err != nil {
+		return err
 	}
 
 	if err := v.ValidatePosition(req.Position); err != nil {
 		return err
 	}
 
+	if err := v.ValidateStyleConfig(req.StyleConfig, req.Style); err != nil {
+		return err
+	}
+
+	if req.Variants != nil {
+		if err := v.ValidateVariants(*req.Variants); err != nil {
+			return err
+		}
+	}
+
+	if err := v.ValidateDisplayRules(req.DisplayRules); err != nil {
+		return err
+	}
+
+	if err := v.ValidateSchedule(req.Schedule); err != nil {
+		return err
+	}
+
+	if err := v.ValidateRetention(req.Retention); err != nil {
+		return err
+	}
+
+	if err := v.ValidateDedup(req.Dedup, req.FormConfig); err != nil {
+		return err
+	}
+
+	if err := v.ValidateFormConfig(req.FormConfig); err != nil {
+		return err
+	}
+
+	if err := v.ValidateDefaultLocale(req.DefaultLocale); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ValidateStyleConfig 规范化并验证样式配置，style 为旧版的样式JSON字符串，只在未传入样式配置时验证
+func (v *PopupValidator) ValidateStyleConfig(styleConfig *popupspec.StyleConfig, style string) error {
+	if styleConfig == nil {
+		if style == "" {
+			return nil
+		}
+		if _, err := popupspec.ParseStyleConfig(style); err != nil {
+			return fmt.Errorf("invalid style: %w", err)
+		}
+		return nil
+	}
+	styleConfig.Normalize()
+	if err := styleConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid style config: %w", err)
+	}
+	return nil
+}
+
+// ValidateDisplayRules 规范化并验证展示规则，为nil时不做处理
+func (v *PopupValidator) ValidateDisplayRules(rules *popupspec.DisplayRules) error {
+	if rules == nil {
+		return nil
+	}
+	rules.Normalize()
+	if err := rules.Validate(); err != nil {
+		return fmt.Errorf("invalid display rules: %w", err)
+	}
+	return nil
+}
+
+// ValidateFormConfig 规范化并验证表单配置，为nil时不做处理
+func (v *PopupValidator) ValidateFormConfig(form *popupspec.FormConfig) error {
+	if form == nil {
+		return nil
+	}
+	form.Normalize()
+	if err := form.Validate(); err != nil {
+		return fmt.Errorf("invalid form config: %w", err)
+	}
+	return nil
+}
+
+// ValidateDefaultLocale 规范化并验证原文语言，为nil或空字符串时不做处理
+func (v *PopupValidator) ValidateDefaultLocale(locale *string) error {
+	if locale == nil || strings.TrimSpace(*locale) == "" {
+		if locale != nil {
+			*locale = ""
+		}
+		return nil
+	}
+	normalized, err := popupspec.NormalizeLocale(*locale)
+	if err != nil {
+		return fmt.Errorf("invalid default_locale: %w", err)
+	}
+	*locale = normalized
+	return nil
+}
+
+// ValidateVariants 验证弹窗变体
+func (v *PopupValidator) ValidateVariants(variants []PopupVariantInput) error {
+	if len(variants) > maxPopupVariants {
+		return fmt.Errorf("a popup can have at most %d variants", maxPopupVariants)
+	}
+
+	names := make(map[string]bool, len(variants))
+	controls := 0
+	for i, variant := range variants {
+		if variant.Name == "" {
+			return fmt.Errorf("variants[%d]: name is required", i)
+		}
+		if len(variant.Name) > 100 {
+			return fmt.Errorf("variants[%d]: name is too long", i)
+		}
+		if names[variant.Name] {
+			return fmt.Errorf("variants[%d]: duplicate variant name %q", i, variant.Name)
+		}
+		names[variant.Name] = true
+
+		if variant.Weight < 0 || variant.Weight > maxPopupVariantWeight {
+			return fmt.Errorf("variants[%d]: weight must be between 0 and %d", i, maxPopupVariantWeight)
+		}
+		if err := v.ValidateStyleConfig(variant.StyleConfig, variant.Style); err != nil {
+			return fmt.Errorf("variants[%d]: %w", i, err)
+		}
+		if variant.IsControl {
+			controls++
+		}
+	}
+
+	if controls > 1 {
+		return errors.New("only one variant can be the control")
+	}
+	return nil
+}
+
+// ValidateSchedule 验证投放排期，为nil时不做处理
+func (v *PopupValidator) ValidateSchedule(schedule *popupspec.Schedule) error {
+	if schedule == nil {
+		return nil
+	}
+	if err := schedule.Validate(); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	return nil
+}
+
+// ValidateRetention 验证提交数据保留策略，为nil时不做处理
+func (v *PopupValidator) ValidateRetention(retention *popupspec.Retention) error {
+	if retention == nil {
+		return nil
+	}
+	if err := retention.Validate(); err != nil {
+		return fmt.Errorf("invalid retention: %w", err)
+	}
+	return nil
+}
+
+// ValidateDedup 规范化并验证提交去重配置，form 为请求中的表单配置，为nil时不检查字段是否在表单中
+func (v *PopupValidator) ValidateDedup(dedup *popupspec.Dedup, form *popupspec.FormConfig) error {
+	if dedup == nil {
+		return nil
+	}
+	dedup.Normalize()
+	if err := dedup.Validate(form); err != nil {
+		return fmt.Errorf("invalid dedup: %w", err)
+	}
 	return nil
 }
 
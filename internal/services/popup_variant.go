@@ -0,0 +1,79 @@
+package services
+
+import (
+	"fmt"
+
+	"proxy-enhancer-ultra/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// syncPopupVariants 同步弹窗变体：更新带ID的变体，创建新变体，删除未传入的变体
+// 删除为软删除，保留历史曝光和提交的归因
+func syncPopupVariants(tx *gorm.DB, popupID uuid.UUID, inputs []PopupVariantInput) error {
+	var existing []models.PopupVariant
+	if err := tx.Where("popup_id = ?", popupID).Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to get popup variants: %w", err)
+	}
+	byID := make(map[uuid.UUID]*models.PopupVariant, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+	}
+
+	kept := make(map[uuid.UUID]bool, len(inputs))
+	for _, input := range inputs {
+		enabled := true
+		if input.Enabled != nil {
+			enabled = *input.Enabled
+		}
+		style, err := resolveStyleConfig("", input.StyleConfig, input.Style, "")
+		if err != nil {
+			return err
+		}
+
+		if input.ID == nil {
+			variant := &models.PopupVariant{
+				PopupID:     popupID,
+				Name:        input.Name,
+				Title:       input.Title,
+				Content:     input.Content,
+				StyleConfig: style,
+				Weight:      input.Weight,
+				IsControl:   input.IsControl,
+				IsActive:    enabled,
+			}
+			if err := tx.Create(variant).Error; err != nil {
+				return fmt.Errorf("failed to create popup variant: %w", err)
+			}
+			continue
+		}
+
+		variant, ok := byID[*input.ID]
+		if !ok {
+			return fmt.Errorf("popup variant %s not found", *input.ID)
+		}
+		kept[variant.ID] = true
+		if err := tx.Model(variant).Updates(map[string]interface{}{
+			"name":         input.Name,
+			"title":        input.Title,
+			"content":      input.Content,
+			"style_config": style,
+			"weight":       input.Weight,
+			"is_control":   input.IsControl,
+			"is_active":    enabled,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update popup variant: %w", err)
+		}
+	}
+
+	for id := range byID {
+		if kept[id] {
+			continue
+		}
+		if err := tx.Where("id = ?", id).Delete(&models.PopupVariant{}).Error; err != nil {
+			return fmt.Errorf("failed to delete popup variant: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"proxy-enhancer-ultra/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ProxyScope 规则或弹窗的代理配置作用范围
+type ProxyScope struct {
+	IsGlobal       bool        // 对所有代理配置生效
+	ProxyConfigIDs []uuid.UUID // 绑定的代理配置
+}
+
+// newProxyScope 合并单个和多个代理配置ID并去重
+func newProxyScope(isGlobal bool, proxyConfigID uuid.UUID, proxyConfigIDs []uuid.UUID) ProxyScope {
+	scope := ProxyScope{IsGlobal: isGlobal}
+	seen := make(map[uuid.UUID]bool)
+	for _, id := range append([]uuid.UUID{proxyConfigID}, proxyConfigIDs...) {
+		if id == uuid.Nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		scope.ProxyConfigIDs = append(scope.ProxyConfigIDs, id)
+	}
+	return scope
+}
+
+// validateProxyScope 验证作用范围，非全局时至少绑定一个存在的代理配置
+func validateProxyScope(db *gorm.DB, scope ProxyScope) error {
+	if !scope.IsGlobal && len(scope.ProxyConfigIDs) == 0 {
+		return errors.New("at least one proxy config is required unless is_global is set")
+	}
+	if len(scope.ProxyConfigIDs) == 0 {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&models.ProxyConfig{}).Where("id IN ?", scope.ProxyConfigIDs).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check proxy configs: %w", err)
+	}
+	if int(count) != len(scope.ProxyConfigIDs) {
+		return errors.New("proxy config not found")
+	}
+	return nil
+}
+
+// replaceRuleBindings 替换规则绑定的代理配置
+func replaceRuleBindings(tx *gorm.DB, ruleID uuid.UUID, proxyConfigIDs []uuid.UUID) error {
+	if err := tx.Where("rule_id = ?", ruleID).Delete(&models.RuleProxyConfig{}).Error; err != nil {
+		return fmt.Errorf("failed to clear rule proxy configs: %w", err)
+	}
+	if len(proxyConfigIDs) == 0 {
+		return nil
+	}
+
+	bindings := make([]models.RuleProxyConfig, 0, len(proxyConfigIDs))
+	for _, id := range proxyConfigIDs {
+		bindings = append(bindings, models.RuleProxyConfig{RuleID: ruleID, ProxyConfigID: id})
+	}
+	if err := tx.Create(&bindings).Error; err != nil {
+		return fmt.Errorf("failed to bind rule proxy configs: %w", err)
+	}
+	return nil
+}
+
+// replacePopupBindings 替换弹窗绑定的代理配置
+func replacePopupBindings(tx *gorm.DB, popupID uuid.UUID, proxyConfigIDs []uuid.UUID) error {
+	if err := tx.Where("popup_id = ?", popupID).Delete(&models.PopupProxyConfig{}).Error; err != nil {
+		return fmt.Errorf("failed to clear popup proxy configs: %w", err)
+	}
+	if len(proxyConfigIDs) == 0 {
+		return nil
+	}
+
+	bindings := make([]models.PopupProxyConfig, 0, len(proxyConfigIDs))
+	for _, id := range proxyConfigIDs {
+		bindings = append(bindings, models.PopupProxyConfig{PopupID: popupID, ProxyConfigID: id})
+	}
+	if err := tx.Create(&bindings).Error; err != nil {
+		return fmt.Errorf("failed to bind popup proxy configs: %w", err)
+	}
+	return nil
+}
+
+// scopeRulesToProxyConfig 限定为对指定代理配置生效的规则（全局或已绑定）
+func scopeRulesToProxyConfig(query *gorm.DB, proxyConfigID uuid.UUID) *gorm.DB {
+	return query.Where("(rules.is_global = ? OR rules.id IN (?))", true,
+		query.Session(&gorm.Session{NewDB: true}).Model(&models.RuleProxyConfig{}).Select("rule_id").Where("proxy_config_id = ?", proxyConfigID))
+}
+
+// scopePopupsToProxyConfig 限定为对指定代理配置生效的弹窗（全局或已绑定）
+func scopePopupsToProxyConfig(query *gorm.DB, proxyConfigID uuid.UUID) *gorm.DB {
+	return query.Where("(popups.is_global = ? OR popups.id IN (?))", true,
+		query.Session(&gorm.Session{NewDB: true}).Model(&models.PopupProxyConfig{}).Select("popup_id").Where("proxy_config_id = ?", proxyConfigID))
+}
@@ -9,6 +9,7 @@ import (
 	"proxy-enhancer-ultra/internal/models"
 	"proxy-enhancer-ultra/pkg/logger"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -62,9 +63,9 @@ func (s *ProxyService) CreateProxyConfig(config *models.ProxyConfig) error {
 }
 
 // GetProxyConfig 获取代理配置
-func (s *ProxyService) GetProxyConfig(id uint) (*models.ProxyConfig, error) {
+func (s *ProxyService) GetProxyConfig(id uuid.UUID) (*models.ProxyConfig, error) {
 	var config models.ProxyConfig
-	err := s.db.First(&config, id).Error
+	err := s.db.Where("id = ?", id).First(&config).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("proxy config not found")
@@ -87,8 +88,20 @@ func (s *ProxyService) GetProxyConfigByDomain(domain string) (*models.ProxyConfi
 	return &config, nil
 }
 
+// findProxyConfigByID 根据UUID查找代理配置
+func findProxyConfigByID(db *gorm.DB, id uuid.UUID) (*models.ProxyConfig, error) {
+	var config models.ProxyConfig
+	if err := db.Where("id = ?", id).First(&config).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("proxy config not found")
+		}
+		return nil, err
+	}
+	return &config, nil
+}
+
 // UpdateProxyConfig 更新代理配置
-func (s *ProxyService) UpdateProxyConfig(id uint, updates *models.ProxyConfig) error {
+func (s *ProxyService) UpdateProxyConfig(id uuid.UUID, updates *models.ProxyConfig) error {
 	// 验证更新数据
 	if err := s.validateProxyConfig(updates); err != nil {
 		return err
@@ -96,7 +109,7 @@ func (s *ProxyService) UpdateProxyConfig(id uint, updates *models.ProxyConfig) e
 
 	// 检查配置是否存在
 	var existingConfig models.ProxyConfig
-	err := s.db.First(&existingConfig, id).Error
+	err := s.db.Where("id = ?", id).First(&existingConfig).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return fmt.Errorf("proxy config not found")
@@ -133,10 +146,10 @@ func (s *ProxyService) UpdateProxyConfig(id uint, updates *models.ProxyConfig) e
 }
 
 // DeleteProxyConfig 删除代理配置
-func (s *ProxyService) DeleteProxyConfig(id uint) error {
+func (s *ProxyService) DeleteProxyConfig(id uuid.UUID) error {
 	// 检查配置是否存在
 	var config models.ProxyConfig
-	err := s.db.First(&config, id).Error
+	err := s.db.Where("id = ?", id).First(&config).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return fmt.Errorf("proxy config not found")
@@ -152,18 +165,34 @@ func (s *ProxyService) DeleteProxyConfig(id uint) error {
 		}
 	}()
 
-	// 删除相关的弹窗配置
-	if err := tx.Where("proxy_config_id = ?", id).Delete(&models.Popup{}).Error; err != nil {
+	// 删除仅绑定到该代理配置的弹窗，同时绑定其他代理配置或全局的弹窗保留
+	if err := tx.Where("is_global = ? AND id IN (?) AND id NOT IN (?)", false,
+		tx.Model(&models.PopupProxyConfig{}).Select("popup_id").Where("proxy_config_id = ?", id),
+		tx.Model(&models.PopupProxyConfig{}).Select("popup_id").Where("proxy_config_id <> ?", id),
+	).Delete(&models.Popup{}).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to delete related popups: %w", err)
 	}
 
-	// 删除相关的规则
-	if err := tx.Where("proxy_config_id = ?", id).Delete(&models.Rule{}).Error; err != nil {
+	// 删除仅绑定到该代理配置的规则
+	if err := tx.Where("is_global = ? AND id IN (?) AND id NOT IN (?)", false,
+		tx.Model(&models.RuleProxyConfig{}).Select("rule_id").Where("proxy_config_id = ?", id),
+		tx.Model(&models.RuleProxyConfig{}).Select("rule_id").Where("proxy_config_id <> ?", id),
+	).Delete(&models.Rule{}).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to delete related rules: %w", err)
 	}
 
+	// 解除弹窗和规则与该代理配置的绑定
+	if err := tx.Where("proxy_config_id = ?", id).Delete(&models.PopupProxyConfig{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to unbind popups: %w", err)
+	}
+	if err := tx.Where("proxy_config_id = ?", id).Delete(&models.RuleProxyConfig{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to unbind rules: %w", err)
+	}
+
 	// 删除代理配置
 	if err := tx.Delete(&config).Error; err != nil {
 		tx.Rollback()
@@ -209,9 +238,9 @@ func (s *ProxyService) ListProxyConfigs(page, pageSize int, enabled *bool) ([]*m
 }
 
 // ToggleProxyConfig 切换代理配置状态
-func (s *ProxyService) ToggleProxyConfig(id uint) error {
+func (s *ProxyService) ToggleProxyConfig(id uuid.UUID) error {
 	var config models.ProxyConfig
-	err := s.db.First(&config, id).Error
+	err := s.db.Where("id = ?", id).First(&config).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return fmt.Errorf("proxy config not found")
@@ -236,7 +265,7 @@ func (s *ProxyService) ToggleProxyConfig(id uint) error {
 }
 
 // GetProxyStats 获取代理统计信息
-func (s *ProxyService) GetProxyStats(configID uint, startTime, endTime time.Time) (*ProxyStats, error) {
+func (s *ProxyService) GetProxyStats(configID uuid.UUID, startTime, endTime time.Time) (*ProxyStats, error) {
 	stats := &ProxyStats{}
 
 	// 基础查询
@@ -0,0 +1,557 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-enhancer-ultra/internal/config"
+	"proxy-enhancer-ultra/internal/fieldcrypt"
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// submissionPhoneValuesExpr 转为小写并去掉空白、括号和连字符后的表单字段值JSON文本，
+// 与 fieldcrypt.NormalizeValue 使用相同的规则匹配手机号。该表达式没有索引，只在删除个人数据时使用
+const submissionPhoneValuesExpr = "lower(regexp_replace(" + submissionValuesExpr + ", '[[:space:]()-]', '', 'g'))"
+
+// RetentionService 数据保留服务
+//
+// 后台任务按配置定期清理超过保留期限的提交、代理日志和系统指标，提交可以按弹窗单独设置保留期限和处理方式。
+// 匿名化的提交保留弹窗、变体、处理状态和时间用于统计，清除表单数据、访客信息、备注、上传的文件和Webhook投递记录。
+// 已软删除的数据同样按保留期限处理
+type RetentionService struct {
+	db         *gorm.DB
+	logger     logger.Logger
+	cfg        config.RetentionConfig
+	files      *FileService
+	encryption *EncryptionService
+	audit      *AuditService
+
+	runMu   sync.Mutex // 同一时间只执行一次清理
+	mu      sync.RWMutex
+	lastRun *RetentionRun
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRetentionService 创建新的数据保留服务，处理方式无效时返回错误，避免把拼写错误当作硬删除
+func NewRetentionService(db *gorm.DB, logger logger.Logger, cfg config.RetentionConfig, files *FileService, encryption *EncryptionService, audit *AuditService) (*RetentionService, error) {
+	cfg = cfg.WithDefaults()
+	for table, mode := range map[string]string{
+		RetentionTableSubmissions: cfg.Submissions.Mode,
+		RetentionTableProxyLogs:   cfg.ProxyLogs.Mode,
+	} {
+		if mode != config.RetentionModeDelete && mode != config.RetentionModeAnonymize {
+			return nil, fmt.Errorf("invalid retention mode for %s: %s", table, mode)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RetentionService{
+		db:         db,
+		logger:     logger,
+		cfg:        cfg,
+		files:      files,
+		encryption: encryption,
+		audit:      audit,
+		ctx:        ctx,
+		cancel:     cancel,
+	}, nil
+}
+
+// Start 启动后台清理任务，服务启动一分钟后第一次执行，之后按配置的间隔执行
+func (s *RetentionService) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		timer := time.NewTimer(retentionStartDelay)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				s.Run()
+				timer.Reset(s.cfg.Interval)
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]interface{}{
+		"interval":            s.cfg.Interval.String(),
+		"submissions_days":    s.cfg.Submissions.Days,
+		"proxy_logs_days":     s.cfg.ProxyLogs.Days,
+		"system_metrics_days": s.cfg.SystemMetrics.Days,
+	}).Info("Retention janitor started")
+}
+
+// Stop 停止后台清理任务，正在处理的批次提交后退出
+func (s *RetentionService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Run 立即执行一次清理，已有清理在执行时等待其完成
+func (s *RetentionService) Run() *RetentionRun {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	run := &RetentionRun{StartedAt: time.Now(), Results: []*RetentionTableResult{}}
+	if err := s.run(run); err != nil {
+		run.Error = err.Error()
+		s.logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("Retention run failed")
+	}
+	run.FinishedAt = time.Now()
+
+	s.mu.Lock()
+	s.lastRun = run
+	s.mu.Unlock()
+	return run
+}
+
+// GetStatus 返回数据保留配置、单独设置了保留策略的弹窗和最近一次清理的结果
+func (s *RetentionService) GetStatus() (*RetentionStatus, error) {
+	popups, err := s.popupRetentions()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	lastRun := s.lastRun
+	s.mu.RUnlock()
+	return &RetentionStatus{
+		Interval:      s.cfg.Interval.String(),
+		Submissions:   RetentionPolicy{Days: s.cfg.Submissions.Days, Mode: s.cfg.Submissions.Mode},
+		ProxyLogs:     RetentionPolicy{Days: s.cfg.ProxyLogs.Days, Mode: s.cfg.ProxyLogs.Mode},
+		SystemMetrics: RetentionPolicy{Days: s.cfg.SystemMetrics.Days, Mode: s.cfg.SystemMetrics.Mode},
+		Popups:        popups,
+		LastRun:       lastRun,
+	}, nil
+}
+
+// EraseSubject 查找所有弹窗中表单字段值等于邮箱或手机号的提交并硬删除，同时删除包含这些提交的通知邮件、作废导出文件，记录审计日志
+// 明文字段按值精确匹配，邮箱不区分大小写，手机号忽略空白、括号和连字符；加密字段按盲索引匹配
+func (s *RetentionService) EraseSubject(req *EraseSubjectRequest, actor SubmissionActor) (*ErasureResult, error) {
+	req.Email = strings.TrimSpace(req.Email)
+	req.Phone = strings.TrimSpace(req.Phone)
+	if req.Email == "" && req.Phone == "" {
+		return nil, errors.New("email or phone is required")
+	}
+	if req.Email != "" && !strings.Contains(req.Email, "@") {
+		return nil, errors.New("invalid email")
+	}
+	if _, ok := fieldcrypt.NormalizeValue(req.Phone); req.Phone != "" && !ok {
+		return nil, errors.New("invalid phone")
+	}
+
+	matches, err := s.findSubject(req.Email, req.Phone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find submissions: %w", err)
+	}
+	result := &ErasureResult{
+		SubmissionIDs: make([]uuid.UUID, 0, len(matches)),
+		PopupIDs:      []uuid.UUID{},
+		DryRun:        req.DryRun,
+	}
+	popups := make(map[uuid.UUID]bool)
+	var since time.Time
+	for _, match := range matches {
+		if since.IsZero() || match.CreatedAt.Before(since) {
+			since = match.CreatedAt
+		}
+		result.SubmissionIDs = append(result.SubmissionIDs, match.ID)
+		if !popups[match.PopupID] {
+			popups[match.PopupID] = true
+			result.PopupIDs = append(result.PopupIDs, match.PopupID)
+		}
+	}
+	result.Submissions = len(matches)
+	if req.DryRun {
+		return result, nil
+	}
+
+	var storedKeys []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(result.SubmissionIDs); start += s.cfg.BatchSize {
+			end := start + s.cfg.BatchSize
+			if end > len(result.SubmissionIDs) {
+				end = len(result.SubmissionIDs)
+			}
+			ids := result.SubmissionIDs[start:end]
+			keys, mails, err := purgeSubmissionRecords(tx, ids)
+			if err != nil {
+				return err
+			}
+			storedKeys = append(storedKeys, keys...)
+			result.Mails += int(mails)
+			if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Submission{}).Error; err != nil {
+				return err
+			}
+		}
+		result.Files = len(storedKeys)
+		artifacts, err := invalidateExportJobs(tx, result.PopupIDs, since, "export was invalidated because it contained erased submissions")
+		if err != nil {
+			return err
+		}
+		result.Exports = len(artifacts)
+		storedKeys = append(storedKeys, artifacts...)
+		return s.audit.RecordTx(tx, &AuditEntry{
+			Action:       AuditActionSubjectErased,
+			ResourceType: AuditResourceSubject,
+			ResourceID:   s.subjectID(req.Email, req.Phone),
+			ActorID:      actorID(actor),
+			Details: map[string]interface{}{
+				"submissions":    result.Submissions,
+				"files":          result.Files,
+				"mails":          result.Mails,
+				"exports":        result.Exports,
+				"submission_ids": result.SubmissionIDs,
+				"popup_ids":      result.PopupIDs,
+				"by_email":       req.Email != "",
+				"by_phone":       req.Phone != "",
+				"username":       actor.Username,
+			},
+		})
+	})
+	if err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"user_id": actor.UserID,
+			"error":   err.Error(),
+		}).Error("Failed to erase subject")
+		return nil, fmt.Errorf("failed to erase submissions: %w", err)
+	}
+	s.files.deleteStored(storedKeys...)
+
+	s.logger.WithFields(map[string]interface{}{
+		"user_id":     actor.UserID,
+		"submissions": result.Submissions,
+		"files":       result.Files,
+		"mails":       result.Mails,
+		"exports":     result.Exports,
+	}).Info("Subject erased")
+	return result, nil
+}
+
+// run 依次清理提交、代理日志和系统指标，服务停止时中止
+func (s *RetentionService) run(run *RetentionRun) error {
+	if err := s.cleanupSubmissions(run); err != nil {
+		return fmt.Errorf("failed to clean up submissions: %w", err)
+	}
+
+	if policy := s.cfg.ProxyLogs; policy.Days > 0 {
+		cutoff := time.Now().AddDate(0, 0, -policy.Days)
+		var rows int64
+		var err error
+		if policy.Mode == config.RetentionModeAnonymize {
+			rows, err = s.anonymizeProxyLogs(cutoff)
+		} else {
+			rows, err = s.deleteBatches(&models.ProxyLog{}, "created_at < ?", cutoff)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to clean up proxy logs: %w", err)
+		}
+		s.record(run, &RetentionTableResult{Table: RetentionTableProxyLogs, Mode: policy.Mode, Cutoff: cutoff, Rows: rows})
+	}
+
+	if policy := s.cfg.SystemMetrics; policy.Days > 0 {
+		cutoff := time.Now().AddDate(0, 0, -policy.Days)
+		rows, err := s.deleteBatches(&models.SystemMetric{}, `"timestamp" < ?`, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to clean up system metrics: %w", err)
+		}
+		s.record(run, &RetentionTableResult{Table: RetentionTableSystemMetrics, Mode: policy.Mode, Cutoff: cutoff, Rows: rows})
+	}
+	return s.ctx.Err()
+}
+
+// cleanupSubmissions 先按弹窗单独设置的策略清理，再按全局配置清理其他弹窗的提交
+func (s *RetentionService) cleanupSubmissions(run *RetentionRun) error {
+	popups, err := s.popupRetentions()
+	if err != nil {
+		return err
+	}
+	overridden := make([]uuid.UUID, 0, len(popups))
+	for _, popup := range popups {
+		overridden = append(overridden, popup.PopupID)
+		if popup.Effective.Days <= 0 {
+			continue
+		}
+		popupID := popup.PopupID
+		scope := func(query *gorm.DB) *gorm.DB {
+			return query.Where("popup_id = ?", popupID)
+		}
+		if err := s.cleanupSubmissionScope(run, scope, popup.Effective, &popupID); err != nil {
+			return err
+		}
+	}
+
+	global := RetentionPolicy{Days: s.cfg.Submissions.Days, Mode: s.cfg.Submissions.Mode}
+	if global.Days <= 0 {
+		return nil
+	}
+	scope := func(query *gorm.DB) *gorm.DB {
+		if len(overridden) == 0 {
+			return query
+		}
+		return query.Where("popup_id NOT IN ?", overridden)
+	}
+	return s.cleanupSubmissionScope(run, scope, global, nil)
+}
+
+// cleanupSubmissionScope 分批删除或匿名化范围内早于保留期限的提交，每批在一个事务中完成
+func (s *RetentionService) cleanupSubmissionScope(run *RetentionRun, scope func(*gorm.DB) *gorm.DB, policy RetentionPolicy, popupID *uuid.UUID) error {
+	cutoff := time.Now().AddDate(0, 0, -policy.Days)
+	anonymize := policy.Mode == config.RetentionModeAnonymize
+	var total int64
+	for s.ctx.Err() == nil {
+		var ids []uuid.UUID
+		var storedKeys []string
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			query := scope(tx.Unscoped().Model(&models.Submission{})).Where("created_at < ?", cutoff)
+			if anonymize {
+				query = query.Where("anonymized_at IS NULL")
+			}
+			if err := query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Order("created_at").Limit(s.cfg.BatchSize).
+				Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			keys, _, err := purgeSubmissionRecords(tx, ids)
+			if err != nil {
+				return err
+			}
+			storedKeys = keys
+			if !anonymize {
+				return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Submission{}).Error
+			}
+			return tx.Unscoped().Model(&models.Submission{}).Where("id IN ?", ids).UpdateColumns(map[string]interface{}{
+				"form_data":         "{}",
+				"user_ip":           nil,
+				"user_agent":        "",
+				"referrer_url":      gorm.Expr("split_part(referrer_url, chr(63), 1)"),
+				"visitor_id":        "",
+				"session_id":        "",
+				"client_info":       "",
+				"encryption_key_id": nil,
+				"dedup_key":         "",
+				"anonymized_at":     time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+		s.files.deleteStored(storedKeys...)
+		total += int64(len(ids))
+		if len(ids) < s.cfg.BatchSize {
+			break
+		}
+	}
+	s.record(run, &RetentionTableResult{
+		Table:   RetentionTableSubmissions,
+		PopupID: popupID,
+		Mode:    policy.Mode,
+		Cutoff:  cutoff,
+		Rows:    total,
+	})
+	return nil
+}
+
+// anonymizeProxyLogs 清除早于保留期限的代理日志中的IP、浏览器信息和URL查询参数
+func (s *RetentionService) anonymizeProxyLogs(cutoff time.Time) (int64, error) {
+	var total int64
+	for s.ctx.Err() == nil {
+		batch := s.db.Unscoped().Model(&models.ProxyLog{}).Select("id").
+			Where("created_at < ?", cutoff).
+			Where("user_ip IS NOT NULL OR COALESCE(user_agent, '') <> '' OR strpos(url, chr(63)) > 0").
+			Limit(s.cfg.BatchSize)
+		result := s.db.Unscoped().Model(&models.ProxyLog{}).Where("id IN (?)", batch).UpdateColumns(map[string]interface{}{
+			"user_ip":    nil,
+			"user_agent": "",
+			"url":        gorm.Expr("split_part(url, chr(63), 1)"),
+		})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < int64(s.cfg.BatchSize) {
+			break
+		}
+	}
+	return total, nil
+}
+
+// deleteBatches 分批硬删除满足条件的记录，避免长事务和大量锁
+func (s *RetentionService) deleteBatches(model interface{}, condition string, args ...interface{}) (int64, error) {
+	var total int64
+	for s.ctx.Err() == nil {
+		batch := s.db.Unscoped().Model(model).Select("id").Where(condition, args...).Limit(s.cfg.BatchSize)
+		result := s.db.Unscoped().Where("id IN (?)", batch).Delete(model)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < int64(s.cfg.BatchSize) {
+			break
+		}
+	}
+	return total, nil
+}
+
+// record 记录处理了数据的表或弹窗，同时写入日志和审计日志
+func (s *RetentionService) record(run *RetentionRun, result *RetentionTableResult) {
+	if result.Rows == 0 {
+		return
+	}
+	run.Results = append(run.Results, result)
+
+	fields := map[string]interface{}{
+		"table":  result.Table,
+		"mode":   result.Mode,
+		"cutoff": result.Cutoff,
+		"rows":   result.Rows,
+	}
+	if result.PopupID != nil {
+		fields["popup_id"] = *result.PopupID
+	}
+	s.logger.WithFields(fields).Info("Retention applied")
+	if err := s.audit.Record(&AuditEntry{
+		Action:       AuditActionRetentionApplied,
+		ResourceType: AuditResourceTable,
+		ResourceID:   result.Table,
+		Details:      fields,
+	}); err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"table": result.Table,
+			"error": err.Error(),
+		}).Error("Failed to record retention audit log")
+	}
+}
+
+// popupRetentions 返回单独设置了保留策略的弹窗，包括已删除的弹窗，策略无效的弹窗使用全局配置
+func (s *RetentionService) popupRetentions() ([]*PopupRetention, error) {
+	var popups []*models.Popup
+	if err := s.db.Unscoped().Select("id, title, retention").
+		Where("retention IS NOT NULL AND retention <> '{}'::jsonb").
+		Order("title").Find(&popups).Error; err != nil {
+		return nil, fmt.Errorf("failed to load popup retention: %w", err)
+	}
+
+	result := make([]*PopupRetention, 0, len(popups))
+	for _, popup := range popups {
+		retention, err := popupspec.ParseRetention(popup.Retention)
+		if err != nil || retention.IsZero() {
+			continue
+		}
+		effective := RetentionPolicy{Days: s.cfg.Submissions.Days, Mode: s.cfg.Submissions.Mode}
+		if retention.Days > 0 {
+			effective.Days = retention.Days
+		}
+		if retention.Mode != popupspec.RetentionInherit {
+			effective.Mode = retention.Mode
+		}
+		if retention.Forever {
+			effective.Days = 0
+		}
+		result = append(result, &PopupRetention{
+			PopupID:   popup.ID,
+			Title:     popup.Title,
+			Retention: retention,
+			Effective: effective,
+		})
+	}
+	return result, nil
+}
+
+// findSubject 查找表单字段值等于邮箱或手机号的提交，包括已删除的提交
+func (s *RetentionService) findSubject(email, phone string) ([]subjectMatch, error) {
+	conditions := s.db.Where("1 = 0")
+	var values []string
+	if email != "" {
+		conditions = conditions.Or(submissionValuesExpr+" ILIKE ?", `%"`+jsonLikePattern(email)+`"%`)
+		values = append(values, email)
+	}
+	if normalized, ok := fieldcrypt.NormalizeValue(phone); ok {
+		conditions = conditions.Or(submissionPhoneValuesExpr+" LIKE ?", `%"`+jsonLikePattern(normalized)+`"%`)
+		values = append(values, phone)
+	}
+
+	fields, err := s.encryption.SensitiveFieldNames(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		for _, value := range values {
+			index, ok := s.encryption.BlindIndex(field, value)
+			if !ok {
+				continue
+			}
+			encrypted, err := json.Marshal(map[string]interface{}{
+				field: map[string]string{fieldcrypt.IndexKey: index},
+			})
+			if err != nil {
+				return nil, err
+			}
+			conditions = conditions.Or("form_data @> ?", string(encrypted))
+		}
+	}
+
+	var matches []subjectMatch
+	if err := s.db.Unscoped().Model(&models.Submission{}).Select("id, popup_id, created_at").
+		Where(conditions).Order("created_at").Scan(&matches).Error; err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// purgeSubmissionRecords 删除提交的备注、上传的文件记录、Webhook投递记录和通知邮件，返回需要删除的文件存储键和删除的邮件数
+// 这些记录可能包含表单内容，删除和匿名化提交时都要删除。汇总邮件包含任一提交时整封删除
+func purgeSubmissionRecords(tx *gorm.DB, ids []uuid.UUID) ([]string, int64, error) {
+	var keys []string
+	if err := tx.Unscoped().Model(&models.File{}).Where("submission_id IN ?", ids).Pluck("filename", &keys).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Unscoped().Where("submission_id IN ?", ids).Delete(&models.File{}).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Unscoped().Where("submission_id IN ?", ids).Delete(&models.SubmissionNote{}).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Unscoped().Where("submission_id IN ?", ids).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return nil, 0, err
+	}
+	textIDs := make([]string, len(ids))
+	for i, id := range ids {
+		textIDs[i] = id.String()
+	}
+	mails := tx.Unscoped().
+		Where("submission_id IN ?", ids).
+		Or("EXISTS (SELECT 1 FROM jsonb_array_elements_text(submission_ids) AS included(id) WHERE included.id IN ?)", textIDs).
+		Delete(&models.MailMessage{})
+	if mails.Error != nil {
+		return nil, 0, mails.Error
+	}
+	return keys, mails.RowsAffected, nil
+}
+
+// subjectID 返回邮箱和手机号的带密钥哈希，作为审计日志的资源ID，审计日志中不保存原文
+// 手机号的取值范围很小，无密钥的哈希可以被穷举还原，没有可用的密钥时不记录数据主体标识
+func (s *RetentionService) subjectID(email, phone string) string {
+	id, _ := s.encryption.Fingerprint("$erasure", email+"\x00"+phone)
+	return id
+}
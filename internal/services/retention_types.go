@@ -0,0 +1,85 @@
+package services
+
+import (
+	"time"
+
+	"proxy-enhancer-ultra/internal/popupspec"
+
+	"github.com/google/uuid"
+)
+
+// 数据保留清理的表
+const (
+	RetentionTableSubmissions   = "submissions"
+	RetentionTableProxyLogs     = "proxy_logs"
+	RetentionTableSystemMetrics = "system_metrics"
+)
+
+// RetentionPolicy 表的保留天数和过期后的处理方式，天数为0时不清理
+type RetentionPolicy struct {
+	Days int    `json:"days"`
+	Mode string `json:"mode"` // delete 或 anonymize
+}
+
+// PopupRetention 单独设置了保留策略的弹窗
+type PopupRetention struct {
+	PopupID   uuid.UUID            `json:"popup_id"`
+	Title     string               `json:"title"`
+	Retention *popupspec.Retention `json:"retention"` // 弹窗的设置
+	Effective RetentionPolicy      `json:"effective"` // 与全局配置合并后实际使用的策略
+}
+
+// RetentionStatus 数据保留配置和最近一次清理的结果
+type RetentionStatus struct {
+	Interval      string            `json:"interval"` // 清理任务的执行间隔，如 1h0m0s
+	Submissions   RetentionPolicy   `json:"submissions"`
+	ProxyLogs     RetentionPolicy   `json:"proxy_logs"`
+	SystemMetrics RetentionPolicy   `json:"system_metrics"`
+	Popups        []*PopupRetention `json:"popups"`
+	LastRun       *RetentionRun     `json:"last_run"` // 服务启动后还没有执行过清理时为空
+}
+
+// RetentionRun 一次数据保留清理的结果
+type RetentionRun struct {
+	StartedAt  time.Time               `json:"started_at"`
+	FinishedAt time.Time               `json:"finished_at"`
+	Results    []*RetentionTableResult `json:"results"` // 只包含处理了数据的表和弹窗
+	Error      string                  `json:"error,omitempty"`
+}
+
+// RetentionTableResult 一个表或一个弹窗的提交数据的清理结果
+type RetentionTableResult struct {
+	Table   string     `json:"table"`
+	PopupID *uuid.UUID `json:"popup_id,omitempty"` // 使用弹窗单独设置的策略时不为空
+	Mode    string     `json:"mode"`
+	Cutoff  time.Time  `json:"cutoff"` // 早于该时间的数据被处理
+	Rows    int64      `json:"rows"`
+}
+
+// EraseSubjectRequest 删除某个人的所有提交数据，邮箱和手机号至少填写一个
+type EraseSubjectRequest struct {
+	Email  string `json:"email"`
+	Phone  string `json:"phone"`
+	DryRun bool   `json:"dry_run"` // 只返回匹配的提交，不删除
+}
+
+// ErasureResult 删除个人数据的结果
+type ErasureResult struct {
+	Submissions   int         `json:"submissions"`
+	Files         int         `json:"files"`
+	Mails         int         `json:"mails"`   // 删除的通知邮件数
+	Exports       int         `json:"exports"` // 因包含被删除的提交而作废的导出任务数
+	SubmissionIDs []uuid.UUID `json:"submission_ids"`
+	PopupIDs      []uuid.UUID `json:"popup_ids"`
+	DryRun        bool        `json:"dry_run"`
+}
+
+// 数据保留清理任务的时间间隔
+const retentionStartDelay = time.Minute // 服务启动后第一次清理前的等待时间
+
+// subjectMatch 匹配个人数据的提交
+type subjectMatch struct {
+	ID        uuid.UUID
+	PopupID   uuid.UUID
+	CreatedAt time.Time
+}
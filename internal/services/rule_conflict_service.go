@@ -0,0 +1,236 @@
+package services
+
+import (
+	"fmt"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/proxy"
+	"proxy-enhancer-ultra/internal/ruledsl"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RuleConflictService 规则冲突检测服务
+type RuleConflictService struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewRuleConflictService 创建新的规则冲突检测服务
+func NewRuleConflictService(db *gorm.DB, logger logger.Logger) *RuleConflictService {
+	return &RuleConflictService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// analyzedRule 已解析定义和选择器的规则
+type analyzedRule struct {
+	rule       *models.Rule
+	definition *ruledsl.Definition
+	selector   *proxy.Selector
+}
+
+// DetectConflicts 检测启用规则之间选择器可能重叠且动作冲突的规则对
+// proxyConfigID 不为nil时只检查对该代理配置生效的规则
+func (s *RuleConflictService) DetectConflicts(proxyConfigID *uuid.UUID) ([]*RuleConflict, error) {
+	query := s.db.Model(&models.Rule{}).Preload("ProxyConfigs").Where("rules.is_active = ?", true)
+	if proxyConfigID != nil {
+		query = scopeRulesToProxyConfig(query, *proxyConfigID)
+	}
+
+	// 与代理执行顺序一致
+	var rules []*models.Rule
+	if err := query.Order("priority ASC").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to get rules: %w", err)
+	}
+
+	analyzed := make([]*analyzedRule, 0, len(rules))
+	for _, rule := range rules {
+		def, err := ruledsl.ParseDefinition(rule.TriggerConditions, rule.Actions)
+		if err == nil {
+			var selector *proxy.Selector
+			if selector, err = proxy.CompileSelector(def.Trigger.Selector); err == nil {
+				analyzed = append(analyzed, &analyzedRule{rule: rule, definition: def, selector: selector})
+				continue
+			}
+		}
+		s.logger.WithFields(map[string]interface{}{
+			"rule_id": rule.ID,
+			"error":   err.Error(),
+		}).Warn("Skipping invalid rule in conflict detection")
+	}
+
+	conflicts := make([]*RuleConflict, 0)
+	for i, first := range analyzed {
+		for _, second := range analyzed[i+1:] {
+			global, proxyConfigIDs, ok := sharedScope(first.rule, second.rule, proxyConfigID)
+			if !ok || !first.selector.MayOverlap(second.selector) {
+				continue
+			}
+
+			conflict := detectActionConflict(first, second)
+			if conflict == nil {
+				continue
+			}
+			conflict.Global = global
+			conflict.ProxyConfigIDs = proxyConfigIDs
+			if first.rule.Priority == second.rule.Priority {
+				conflict.AmbiguousOrder = true
+				conflict.WinnerID = nil
+			}
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return conflicts, nil
+}
+
+// sharedScope 计算两条规则同时生效的代理配置，没有交集时返回false
+func sharedScope(a, b *models.Rule, proxyConfigID *uuid.UUID) (bool, []uuid.UUID, bool) {
+	global := a.IsGlobal && b.IsGlobal
+	if proxyConfigID != nil {
+		return global, []uuid.UUID{*proxyConfigID}, true
+	}
+
+	switch {
+	case global:
+		return true, nil, true
+	case a.IsGlobal:
+		return false, boundProxyConfigIDs(b), len(b.ProxyConfigs) > 0
+	case b.IsGlobal:
+		return false, boundProxyConfigIDs(a), len(a.ProxyConfigs) > 0
+	}
+
+	bound := make(map[uuid.UUID]bool, len(a.ProxyConfigs))
+	for _, binding := range a.ProxyConfigs {
+		bound[binding.ProxyConfigID] = true
+	}
+	var shared []uuid.UUID
+	for _, binding := range b.ProxyConfigs {
+		if bound[binding.ProxyConfigID] {
+			shared = append(shared, binding.ProxyConfigID)
+		}
+	}
+	return false, shared, len(shared) > 0
+}
+
+// boundProxyConfigIDs 返回规则绑定的代理配置ID
+func boundProxyConfigIDs(rule *models.Rule) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(rule.ProxyConfigs))
+	for _, binding := range rule.ProxyConfigs {
+		ids = append(ids, binding.ProxyConfigID)
+	}
+	return ids
+}
+
+// detectActionConflict 判断先后执行的两条规则作用于同一元素时动作是否冲突
+func detectActionConflict(first, second *analyzedRule) *RuleConflict {
+	conflict := &RuleConflict{
+		First:  describeConflictRule(first),
+		Second: describeConflictRule(second),
+	}
+	firstLast := lastActionType(first.definition)
+	secondLast := lastActionType(second.definition)
+
+	switch {
+	// 先执行的规则移除或替换元素后，后执行的规则不会再匹配到原元素
+	case firstLast == ruledsl.ActionRemove && secondLast != ruledsl.ActionRemove,
+		firstLast == ruledsl.ActionReplace:
+		conflict.Kind = terminalConflictKind(firstLast)
+		conflict.Reason = fmt.Sprintf("%q runs first and %ss the element, so %q never applies to it", first.rule.Name, firstLast, second.rule.Name)
+		conflict.WinnerID = &first.rule.ID
+	// 后执行的规则移除或替换元素，先执行规则的修改被丢弃
+	case secondLast == ruledsl.ActionRemove && firstLast != ruledsl.ActionRemove,
+		secondLast == ruledsl.ActionReplace:
+		conflict.Kind = terminalConflictKind(secondLast)
+		conflict.Reason = fmt.Sprintf("%q runs later and %ss the element, discarding changes made by %q", second.rule.Name, secondLast, first.rule.Name)
+		conflict.WinnerID = &second.rule.ID
+	// 后执行的规则重写文本，覆盖先执行规则的文本或插入的子元素
+	case hasAction(second.definition, ruledsl.ActionModifyText) && rewritesChildren(first.definition):
+		conflict.Kind = RuleConflictText
+		conflict.Reason = fmt.Sprintf("%q runs later and overwrites the content written by %q", second.rule.Name, first.rule.Name)
+		conflict.WinnerID = &second.rule.ID
+	default:
+		attribute, ok := conflictingAttribute(first.definition, second.definition)
+		if !ok {
+			return nil
+		}
+		conflict.Kind = RuleConflictAttribute
+		conflict.Reason = fmt.Sprintf("%q and %q set attribute %q to different values, %q runs later and wins", first.rule.Name, second.rule.Name, attribute, second.rule.Name)
+		conflict.WinnerID = &second.rule.ID
+	}
+
+	return conflict
+}
+
+// describeConflictRule 生成冲突中的规则信息
+func describeConflictRule(r *analyzedRule) RuleConflictRule {
+	return RuleConflictRule{
+		ID:          r.rule.ID,
+		Name:        r.rule.Name,
+		Priority:    r.rule.Priority,
+		Selector:    r.definition.Trigger.Selector,
+		Actions:     r.definition.ActionTypes(),
+		Conditional: r.definition.Trigger.When != nil,
+	}
+}
+
+// lastActionType 返回最后一个动作的类型，remove、replace 只能是最后一个动作
+func lastActionType(def *ruledsl.Definition) string {
+	return def.Actions.Actions[len(def.Actions.Actions)-1].Type
+}
+
+// terminalConflictKind 返回移除、替换动作对应的冲突类型
+func terminalConflictKind(actionType string) string {
+	if actionType == ruledsl.ActionRemove {
+		return RuleConflictRemoved
+	}
+	return RuleConflictReplaced
+}
+
+// hasAction 判断定义是否包含指定类型的动作
+func hasAction(def *ruledsl.Definition, actionType string) bool {
+	for _, action := range def.Actions.Actions {
+		if action.Type == actionType {
+			return true
+		}
+	}
+	return false
+}
+
+// rewritesChildren 判断定义是否修改元素的子内容（文本或插入到元素内部）
+func rewritesChildren(def *ruledsl.Definition) bool {
+	for _, action := range def.Actions.Actions {
+		switch action.Type {
+		case ruledsl.ActionModifyText:
+			return true
+		case ruledsl.ActionAppend, ruledsl.ActionPrepend:
+			if action.Position == "" || action.Position == ruledsl.PositionInside || action.Position == ruledsl.PositionInsideStart {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// conflictingAttribute 查找两个定义设置为不同值的属性
+func conflictingAttribute(first, second *ruledsl.Definition) (string, bool) {
+	values := make(map[string]string)
+	for _, action := range first.Actions.Actions {
+		if action.Type == ruledsl.ActionModifyAttribute {
+			values[action.Attribute] = action.Value
+		}
+	}
+	for _, action := range second.Actions.Actions {
+		if action.Type != ruledsl.ActionModifyAttribute {
+			continue
+		}
+		if value, ok := values[action.Attribute]; ok && value != action.Value {
+			return action.Attribute, true
+		}
+	}
+	return "", false
+}
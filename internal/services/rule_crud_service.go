@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/ruledsl"
 	"proxy-enhancer-ultra/pkg/logger"
 
 	"github.com/google/uuid"
@@ -35,7 +36,30 @@ func (s *RuleCRUDService) CreateRule(req *CreateRuleRequest) (*models.Rule, erro
 		return nil, err
 	}
 
+	// 构建并验证规则定义
+	def, err := buildRuleDefinition(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validator.ValidateDefinition(def); err != nil {
+		return nil, err
+	}
+	triggerConditions, actions, err := def.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证代理配置作用范围
+	scope := newProxyScope(req.IsGlobal, req.ProxyConfigID, req.ProxyConfigIDs)
+	if err := validateProxyScope(s.db, scope); err != nil {
+		return nil, err
+	}
+
 	// 设置默认值
+	name := req.Name
+	if name == "" {
+		name = req.RuleType
+	}
 	if req.Enabled == nil {
 		enabled := true
 		req.Enabled = &enabled
@@ -49,15 +73,23 @@ func (s *RuleCRUDService) CreateRule(req *CreateRuleRequest) (*models.Rule, erro
 	}
 
 	rule := &models.Rule{
-		Name:              req.RuleType, // 使用RuleType作为Name
-		Description:       req.Content,  // 使用Content作为Description
-		TriggerConditions: fmt.Sprintf(`{"selector":"%s","action":"%s","position":"%s"}`, req.Selector, req.Action, req.Position),
-		Actions:           fmt.Sprintf(`{"content":"%s"}`, req.Content),
+		Name:              name,
+		Description:       req.Description,
+		RuleType:          req.RuleType,
+		TriggerConditions: triggerConditions,
+		Actions:           actions,
 		IsActive:          *req.Enabled,
 		Priority:          req.Priority,
+		IsGlobal:          scope.IsGlobal,
 	}
 
-	if err := s.db.Create(rule).Error; err != nil {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(rule).Error; err != nil {
+			return err
+		}
+		return replaceRuleBindings(tx, rule.ID, scope.ProxyConfigIDs)
+	})
+	if err != nil {
 		s.logger.WithFields(map[string]interface{}{
 			"rule_type": req.RuleType,
 			"error":     err.Error(),
@@ -66,8 +98,10 @@ func (s *RuleCRUDService) CreateRule(req *CreateRuleRequest) (*models.Rule, erro
 	}
 
 	s.logger.WithFields(map[string]interface{}{
-		"rule_id":   rule.ID,
-		"rule_type": req.RuleType,
+		"rule_id":          rule.ID,
+		"rule_type":        req.RuleType,
+		"is_global":        scope.IsGlobal,
+		"proxy_config_ids": scope.ProxyConfigIDs,
 	}).Info("Rule created successfully")
 
 	return rule, nil
@@ -76,7 +110,7 @@ func (s *RuleCRUDService) CreateRule(req *CreateRuleRequest) (*models.Rule, erro
 // GetRule 获取规则
 func (s *RuleCRUDService) GetRule(id uuid.UUID) (*models.Rule, error) {
 	var rule models.Rule
-	if err := s.db.First(&rule, id).Error; err != nil {
+	if err := s.db.Preload("ProxyConfigs").Where("id = ?", id).First(&rule).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("rule not found")
 		}
@@ -90,7 +124,7 @@ func (s *RuleCRUDService) GetRule(id uuid.UUID) (*models.Rule, error) {
 func (s *RuleCRUDService) UpdateRule(id uuid.UUID, req *UpdateRuleRequest) error {
 	// 检查规则是否存在
 	var rule models.Rule
-	if err := s.db.First(&rule, id).Error; err != nil {
+	if err := s.db.Preload("ProxyConfigs").Where("id = ?", id).First(&rule).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("rule not found")
 		}
@@ -102,23 +136,57 @@ func (s *RuleCRUDService) UpdateRule(id uuid.UUID, req *UpdateRuleRequest) error
 		return err
 	}
 
-	// 准备更新数据
-	updateData := make(map[string]interface{})
+	// 合并并验证新的代理配置作用范围
+	scopeChanged := req.IsGlobal != nil || req.ProxyConfigIDs != nil
+	scope := ProxyScope{IsGlobal: rule.IsGlobal}
+	for _, binding := range rule.ProxyConfigs {
+		scope.ProxyConfigIDs = append(scope.ProxyConfigIDs, binding.ProxyConfigID)
+	}
+	if scopeChanged {
+		if req.IsGlobal != nil {
+			scope.IsGlobal = *req.IsGlobal
+		}
+		if req.ProxyConfigIDs != nil {
+			scope = newProxyScope(scope.IsGlobal, uuid.Nil, *req.ProxyConfigIDs)
+		}
+		if err := validateProxyScope(s.db, scope); err != nil {
+			return err
+		}
+	}
 
-	if req.RuleType != "" {
-		updateData["rule_type"] = req.RuleType
+	// 合并并验证规则定义
+	def, err := ruledsl.ParseDefinition(rule.TriggerConditions, rule.Actions)
+	if err != nil {
+		return fmt.Errorf("failed to parse rule definition: %w", err)
 	}
-	if req.Selector != "" {
-		updateData["selector"] = req.Selector
+	if err := applyRuleDefinitionUpdate(def, req); err != nil {
+		return err
+	}
+	if err := s.validator.ValidateDefinition(def); err != nil {
+		return err
+	}
+	triggerConditions, actions, err := def.Marshal()
+	if err != nil {
+		return err
+	}
+
+	// 准备更新数据
+	updateData := map[string]interface{}{
+		"trigger_conditions": triggerConditions,
+		"actions":            actions,
 	}
-	if req.Action != "" {
-		updateData["action"] = req.Action
+
+	if req.Name != nil {
+		if *req.Name == "" {
+			return errors.New("name cannot be empty")
+		}
+		updateData["name"] = *req.Name
 	}
-	if req.Content != "" {
-		updateData["content"] = req.Content
+	if req.Description != nil {
+		updateData["description"] = *req.Description
 	}
-	if req.Position != "" {
-		updateData["position"] = req.Position
+	if req.RuleType != "" {
+		updateData["rule_type"] = req.RuleType
 	}
 	if req.Priority != nil {
 		updateData["priority"] = *req.Priority
@@ -126,10 +194,22 @@ func (s *RuleCRUDService) UpdateRule(id uuid.UUID, req *UpdateRuleRequest) error
 	if req.Enabled != nil {
 		updateData["is_active"] = *req.Enabled
 	}
+	if req.IsGlobal != nil {
+		updateData["is_global"] = *req.IsGlobal
+	}
 
 	updateData["updated_at"] = time.Now()
 
-	if err := s.db.Model(&rule).Updates(updateData).Error; err != nil {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&rule).Updates(updateData).Error; err != nil {
+			return err
+		}
+		if req.ProxyConfigIDs != nil {
+			return replaceRuleBindings(tx, rule.ID, scope.ProxyConfigIDs)
+		}
+		return nil
+	})
+	if err != nil {
 		s.logger.WithFields(map[string]interface{}{
 			"rule_id": id,
 			"error":   err.Error(),
@@ -148,7 +228,7 @@ func (s *RuleCRUDService) UpdateRule(id uuid.UUID, req *UpdateRuleRequest) error
 func (s *RuleCRUDService) DeleteRule(id uuid.UUID) error {
 	// 检查规则是否存在
 	var rule models.Rule
-	if err := s.db.First(&rule, id).Error; err != nil {
+	if err := s.db.Where("id = ?", id).First(&rule).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("rule not found")
 		}
@@ -172,7 +252,7 @@ func (s *RuleCRUDService) DeleteRule(id uuid.UUID) error {
 }
 
 // ListRules 获取规则列表
-func (s *RuleCRUDService) ListRules(page, pageSize int, ruleType string, enabled *bool) ([]*models.Rule, int64, error) {
+func (s *RuleCRUDService) ListRules(page, pageSize int, proxyConfigID *uuid.UUID, ruleType string, enabled *bool) ([]*models.Rule, int64, error) {
 	var rules []*models.Rule
 	var total int64
 
@@ -180,8 +260,11 @@ func (s *RuleCRUDService) ListRules(page, pageSize int, ruleType string, enabled
 	query := s.db.Model(&models.Rule{})
 
 	// 添加过滤条件
+	if proxyConfigID != nil {
+		query = scopeRulesToProxyConfig(query, *proxyConfigID)
+	}
 	if ruleType != "" {
-		query = query.Where("name = ?", ruleType) // 使用name字段代替rule_type
+		query = query.Where("rule_type = ?", ruleType)
 	}
 	if enabled != nil {
 		query = query.Where("is_active = ?", *enabled)
@@ -194,7 +277,7 @@ func (s *RuleCRUDService) ListRules(page, pageSize int, ruleType string, enabled
 
 	// 获取分页数据
 	offset := (page - 1) * pageSize
-	if err := query.Order("priority ASC, created_at DESC").Offset(offset).Limit(pageSize).Find(&rules).Error; err != nil {
+	if err := query.Preload("ProxyConfigs").Order("priority ASC, created_at DESC").Offset(offset).Limit(pageSize).Find(&rules).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to get rules: %w", err)
 	}
 
@@ -205,7 +288,7 @@ func (s *RuleCRUDService) ListRules(page, pageSize int, ruleType string, enabled
 func (s *RuleCRUDService) ToggleRuleStatus(id uuid.UUID) error {
 	// 检查规则是否存在
 	var rule models.Rule
-	if err := s.db.First(&rule, id).Error; err != nil {
+	if err := s.db.Where("id = ?", id).First(&rule).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("rule not found")
 		}
@@ -243,10 +326,11 @@ func (s *RuleCRUDService) GetActiveRules() ([]*models.Rule, error) {
 	return rules, nil
 }
 
-// GetRulesByProxyConfig 根据代理配置获取规则
+// GetRulesByProxyConfig 根据代理配置获取生效的规则，包括全局规则
 func (s *RuleCRUDService) GetRulesByProxyConfig(proxyConfigID uuid.UUID) ([]*models.Rule, error) {
 	var rules []*models.Rule
-	if err := s.db.Where("proxy_config_id = ? AND is_active = ?", proxyConfigID, true).Order("priority ASC").Find(&rules).Error; err != nil {
+	query := scopeRulesToProxyConfig(s.db.Model(&models.Rule{}), proxyConfigID)
+	if err := query.Where("is_active = ?", true).Order("priority ASC").Find(&rules).Error; err != nil {
 		return nil, fmt.Errorf("failed to get rules by proxy config: %w", err)
 	}
 
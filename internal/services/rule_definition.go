@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"proxy-enhancer-ultra/internal/ruledsl"
+)
+
+// buildRuleDefinition 根据创建请求构建规则定义
+func buildRuleDefinition(req *CreateRuleRequest) (*ruledsl.Definition, error) {
+	when, err := ruledsl.Parse(req.Conditions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid conditions: %w", err)
+	}
+
+	actions := req.Actions
+	if len(actions) == 0 {
+		action, err := ruledsl.LegacyAction(req.Action, req.Position, req.Content)
+		if err != nil {
+			return nil, err
+		}
+		actions = []ruledsl.Action{action}
+	}
+
+	return ruledsl.NewDefinition(req.Selector, when, actions...), nil
+}
+
+// applyRuleDefinitionUpdate 将更新请求合并到已有的规则定义
+func applyRuleDefinitionUpdate(def *ruledsl.Definition, req *UpdateRuleRequest) error {
+	if req.Selector != "" {
+		def.Trigger.Selector = req.Selector
+	}
+
+	if req.Conditions != nil {
+		when, err := ruledsl.Parse(req.Conditions)
+		if err != nil {
+			return fmt.Errorf("invalid conditions: %w", err)
+		}
+		def.Trigger.When = when
+	}
+
+	if req.Actions != nil {
+		def.Actions.Actions = req.Actions
+		return nil
+	}
+
+	// 简写字段只能修改单个动作的规则
+	if req.Action == "" && req.Content == "" && req.Position == "" {
+		return nil
+	}
+	if len(def.Actions.Actions) != 1 {
+		return errors.New("rule has multiple actions, use actions to update them")
+	}
+
+	current := def.Actions.Actions[0]
+	actionType, position, content := current.Type, current.Position, current.Content
+	if current.Type == ruledsl.ActionModifyAttribute {
+		content = current.Attribute + "=" + current.Value
+	}
+	if req.Action != "" {
+		actionType = req.Action
+	}
+	if req.Position != "" {
+		position = req.Position
+	}
+	if req.Content != "" {
+		content = req.Content
+	}
+
+	action, err := ruledsl.LegacyAction(actionType, position, content)
+	if err != nil {
+		return err
+	}
+	def.Actions.Actions[0] = action
+	return nil
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/proxy"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RuleTestResult 规则试运行结果
+type RuleTestResult struct {
+	*proxy.PreviewResult
+	Matched bool `json:"matched"` // 是否有规则命中了节点
+}
+
+// RulePreviewService 规则试运行服务
+type RulePreviewService struct {
+	db        *gorm.DB
+	logger    logger.Logger
+	validator *RuleValidator
+	previewer *proxy.Previewer
+}
+
+// NewRulePreviewService 创建新的规则试运行服务
+func NewRulePreviewService(db *gorm.DB, logger logger.Logger) *RulePreviewService {
+	return &RulePreviewService{
+		db:        db,
+		logger:    logger,
+		validator: NewRuleValidator(),
+		previewer: proxy.NewPreviewer(db, logger),
+	}
+}
+
+// TestRules 通过代理配置拉取页面并应用指定规则，不保存任何数据
+func (s *RulePreviewService) TestRules(ctx context.Context, req *RuleTestRequest) (*RuleTestResult, error) {
+	if err := s.resolveProxyConfig(req); err != nil {
+		return nil, err
+	}
+	proxyConfig, err := findProxyConfigByID(s.db, req.ProxyConfigID)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := s.collectRules(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 && req.PopupID == nil {
+		return nil, errors.New("no rules or popup to test")
+	}
+
+	var popups []*models.Popup
+	if req.PopupID != nil {
+		var popup models.Popup
+		if err := s.db.Where("id = ?", *req.PopupID).First(&popup).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("popup not found")
+			}
+			return nil, fmt.Errorf("failed to get popup: %w", err)
+		}
+		popups = append(popups, &popup)
+	}
+
+	opts := &proxy.PreviewOptions{
+		URL:          req.URL,
+		UserAgent:    req.UserAgent,
+		Rules:        rules,
+		Popups:       popups,
+		FullPipeline: req.FullPipeline,
+		Headers:      req.Headers,
+	}
+	if req.At != nil {
+		opts.At = *req.At
+	}
+
+	result, err := s.previewer.Preview(ctx, proxyConfig, opts)
+	if err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"proxy_config_id": req.ProxyConfigID,
+			"url":             req.URL,
+			"error":           err.Error(),
+		}).Warn("Rule dry run failed")
+		return nil, err
+	}
+
+	testResult := &RuleTestResult{PreviewResult: result}
+	for _, application := range result.Rules {
+		if application.Matched > 0 {
+			testResult.Matched = true
+			break
+		}
+	}
+
+	return testResult, nil
+}
+
+// resolveProxyConfig 未指定代理配置时，只试运行一条已保存规则且该规则只绑定了一个代理配置则使用该代理配置
+func (s *RulePreviewService) resolveProxyConfig(req *RuleTestRequest) error {
+	if req.ProxyConfigID != uuid.Nil {
+		return nil
+	}
+	if len(req.RuleIDs) != 1 || len(req.Rules) > 0 {
+		return errors.New("proxy config ID is required")
+	}
+
+	var proxyConfigIDs []uuid.UUID
+	if err := s.db.Model(&models.RuleProxyConfig{}).
+		Where("rule_id = ?", req.RuleIDs[0]).
+		Limit(2).
+		Pluck("proxy_config_id", &proxyConfigIDs).Error; err != nil {
+		return fmt.Errorf("failed to get rule proxy configs: %w", err)
+	}
+	switch len(proxyConfigIDs) {
+	case 0:
+		return errors.New("rule is not bound to a proxy config, proxy config ID is required")
+	case 1:
+		req.ProxyConfigID = proxyConfigIDs[0]
+		return nil
+	}
+	return errors.New("rule is bound to several proxy configs, proxy config ID is required")
+}
+
+// collectRules 按请求顺序收集已保存的规则和未保存的规则定义
+func (s *RulePreviewService) collectRules(req *RuleTestRequest) ([]*models.Rule, error) {
+	rules := make([]*models.Rule, 0, len(req.RuleIDs)+len(req.Rules))
+
+	if len(req.RuleIDs) > 0 {
+		var saved []*models.Rule
+		if err := s.db.Where("id IN ?", req.RuleIDs).Find(&saved).Error; err != nil {
+			return nil, fmt.Errorf("failed to get rules: %w", err)
+		}
+
+		byID := make(map[uuid.UUID]*models.Rule, len(saved))
+		for _, rule := range saved {
+			byID[rule.ID] = rule
+		}
+		for _, id := range req.RuleIDs {
+			rule, ok := byID[id]
+			if !ok {
+				return nil, fmt.Errorf("rule %s not found", id)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	for i := range req.Rules {
+		draft := &req.Rules[i]
+		if err := s.validator.ValidateCreateRequest(draft); err != nil {
+			return nil, fmt.Errorf("rule #%d: %w", i+1, err)
+		}
+		rule, err := s.draftRule(draft)
+		if err != nil {
+			return nil, fmt.Errorf("rule #%d: %w", i+1, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// draftRule 将未保存的规则定义转换为规则模型
+func (s *RulePreviewService) draftRule(req *CreateRuleRequest) (*models.Rule, error) {
+	def, err := buildRuleDefinition(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validator.ValidateDefinition(def); err != nil {
+		return nil, err
+	}
+	triggerConditions, actions, err := def.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	name := req.Name
+	if name == "" {
+		name = req.RuleType
+	}
+	return &models.Rule{
+		Name:              name,
+		Description:       req.Description,
+		RuleType:          req.RuleType,
+		TriggerConditions: triggerConditions,
+		Actions:           actions,
+		IsActive:          true,
+		Priority:          req.Priority,
+	}, nil
+}
@@ -1,7 +1,11 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+
 	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/ruledsl"
 	"proxy-enhancer-ultra/pkg/logger"
 
 	"github.com/google/uuid"
@@ -16,6 +20,8 @@ type RuleService struct {
 	// 组合的专门服务
 	crudService     *RuleCRUDService
 	priorityService *RulePriorityService
+	previewService  *RulePreviewService
+	conflictService *RuleConflictService
 }
 
 // NewRuleService 创建新的规则服务
@@ -27,6 +33,8 @@ func NewRuleService(db *gorm.DB, logger logger.Logger) *RuleService {
 		// 初始化专门的服务
 		crudService:     NewRuleCRUDService(db, logger),
 		priorityService: NewRulePriorityService(db, logger),
+		previewService:  NewRulePreviewService(db, logger),
+		conflictService: NewRuleConflictService(db, logger),
 	}
 }
 
@@ -54,8 +62,8 @@ func (s *RuleService) DeleteRule(id uuid.UUID) error {
 }
 
 // ListRules 获取规则列表 - 委托给CRUD服务
-func (s *RuleService) ListRules(page, pageSize int, ruleType string, enabled *bool) ([]*models.Rule, int64, error) {
-	return s.crudService.ListRules(page, pageSize, ruleType, enabled)
+func (s *RuleService) ListRules(page, pageSize int, proxyConfigID *uuid.UUID, ruleType string, enabled *bool) ([]*models.Rule, int64, error) {
+	return s.crudService.ListRules(page, pageSize, proxyConfigID, ruleType, enabled)
 }
 
 // ToggleRuleStatus 切换规则状态 - 委托给CRUD服务
@@ -77,3 +85,22 @@ func (s *RuleService) GetRulesByProxyConfig(proxyConfigID uuid.UUID) ([]*models.
 func (s *RuleService) UpdateRulePriorities(updates []RulePriorityUpdate) error {
 	return s.priorityService.UpdateRulePriorities(updates)
 }
+
+// TestRules 试运行规则 - 委托给试运行服务
+func (s *RuleService) TestRules(ctx context.Context, req *RuleTestRequest) (*RuleTestResult, error) {
+	return s.previewService.TestRules(ctx, req)
+}
+
+// DetectConflicts 检测规则冲突 - 委托给冲突检测服务
+func (s *RuleService) DetectConflicts(proxyConfigID *uuid.UUID) ([]*RuleConflict, error) {
+	return s.conflictService.DetectConflicts(proxyConfigID)
+}
+
+// GetDefinitionSchema 获取规则定义的JSON Schema
+func (s *RuleService) GetDefinitionSchema() *RuleDefinitionSchema {
+	return &RuleDefinitionSchema{
+		Version:           ruledsl.CurrentVersion,
+		TriggerConditions: json.RawMessage(ruledsl.TriggerSchema),
+		Actions:           json.RawMessage(ruledsl.ActionsSchema),
+	}
+}
@@ -1,28 +1,50 @@
 package services
 
-import "github.com/google/uuid"
+import (
+	"encoding/json"
+	"time"
+
+	"proxy-enhancer-ultra/internal/ruledsl"
+
+	"github.com/google/uuid"
+)
 
 // CreateRuleRequest 创建规则请求
+//
+// 单个动作可以使用 Action、Content、Position 简写，多个动作使用 Actions，两者二选一
 type CreateRuleRequest struct {
-	ProxyConfigID uuid.UUID `json:"proxy_config_id" binding:"required"`
-	RuleType      string    `json:"rule_type" binding:"required"`
-	Selector      string    `json:"selector" binding:"required"`
-	Action        string    `json:"action" binding:"required"`
-	Content       string    `json:"content"`
-	Position      string    `json:"position"`
-	Priority      int       `json:"priority"`
-	Enabled       *bool     `json:"enabled"`
+	ProxyConfigID  uuid.UUID        `json:"proxy_config_id"`  // 绑定的代理配置，兼容旧版单个ID
+	ProxyConfigIDs []uuid.UUID      `json:"proxy_config_ids"` // 绑定的代理配置列表
+	IsGlobal       bool             `json:"is_global"`        // 对所有代理配置生效
+	Name           string           `json:"name"`             // 规则名称，为空时使用规则类型
+	Description    string           `json:"description"`
+	RuleType       string           `json:"rule_type" binding:"required"`
+	Selector       string           `json:"selector" binding:"required"`
+	Action         string           `json:"action"`
+	Content        string           `json:"content"`
+	Position       string           `json:"position"`
+	Actions        []ruledsl.Action `json:"actions"`
+	Priority       int              `json:"priority"`
+	Enabled        *bool            `json:"enabled"`
+	Conditions     json.RawMessage  `json:"conditions"` // 请求级触发条件，见 ruledsl.Condition
 }
 
 // UpdateRuleRequest 更新规则请求
 type UpdateRuleRequest struct {
-	RuleType string `json:"rule_type"`
-	Selector string `json:"selector"`
-	Action   string `json:"action"`
-	Content  string `json:"content"`
-	Position string `json:"position"`
-	Priority *int   `json:"priority"`
-	Enabled  *bool  `json:"enabled"`
+	Name        *string          `json:"name"`
+	Description *string          `json:"description"`
+	RuleType    string           `json:"rule_type"`
+	Selector    string           `json:"selector"`
+	Action      string           `json:"action"` // 仅适用于单个动作的规则
+	Content     string           `json:"content"`
+	Position    string           `json:"position"`
+	Actions     []ruledsl.Action `json:"actions"` // 传入时替换全部动作
+	Priority    *int             `json:"priority"`
+	Enabled     *bool            `json:"enabled"`
+	Conditions  json.RawMessage  `json:"conditions"` // 传入null清除触发条件
+
+	ProxyConfigIDs *[]uuid.UUID `json:"proxy_config_ids"` // 传入时替换绑定的代理配置
+	IsGlobal       *bool        `json:"is_global"`
 }
 
 // RulePriorityUpdate 规则优先级更新
@@ -30,3 +52,53 @@ type RulePriorityUpdate struct {
 	ID       uuid.UUID `json:"id"`
 	Priority int       `json:"priority"`
 }
+
+// RuleTestRequest 规则试运行请求
+type RuleTestRequest struct {
+	ProxyConfigID uuid.UUID           `json:"proxy_config_id"` // 为空时使用单条已保存规则唯一绑定的代理配置
+	URL           string              `json:"url"`
+	UserAgent     string              `json:"user_agent"`
+	RuleIDs       []uuid.UUID         `json:"rule_ids"`
+	Rules         []CreateRuleRequest `json:"rules"`    // 未保存的规则定义
+	PopupID       *uuid.UUID          `json:"popup_id"` // 同时注入的弹窗（可选）
+	FullPipeline  bool                `json:"full_pipeline"`
+	Headers       map[string]string   `json:"headers"` // 模拟访客请求头，用于判断触发条件
+	At            *time.Time          `json:"at"`      // 模拟访问时间
+}
+
+// RuleDefinitionSchema 规则定义的JSON Schema
+type RuleDefinitionSchema struct {
+	Version           int             `json:"version"`
+	TriggerConditions json.RawMessage `json:"trigger_conditions"`
+	Actions           json.RawMessage `json:"actions"`
+}
+
+// 规则冲突类型
+const (
+	RuleConflictRemoved   = "removed"   // 元素被移除，另一条规则的修改丢失或不再生效
+	RuleConflictReplaced  = "replaced"  // 元素被替换，另一条规则的修改丢失或不再生效
+	RuleConflictText      = "text"      // 文本内容被覆盖
+	RuleConflictAttribute = "attribute" // 同一属性被设置为不同的值
+)
+
+// RuleConflictRule 冲突中的规则信息
+type RuleConflictRule struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Priority    int       `json:"priority"`
+	Selector    string    `json:"selector"`
+	Actions     []string  `json:"actions"`
+	Conditional bool      `json:"conditional"` // 含请求级触发条件，仅在条件满足时参与冲突
+}
+
+// RuleConflict 选择器可能重叠且动作冲突的一对规则
+type RuleConflict struct {
+	First          RuleConflictRule `json:"first"`  // 先执行的规则（priority较小）
+	Second         RuleConflictRule `json:"second"` // 后执行的规则
+	Kind           string           `json:"kind"`
+	Reason         string           `json:"reason"`
+	WinnerID       *uuid.UUID       `json:"winner_id"`                  // 最终结果生效的规则，执行顺序不确定时为null
+	AmbiguousOrder bool             `json:"ambiguous_order"`            // 优先级相同，执行顺序不确定
+	Global         bool             `json:"global"`                     // 两条规则均为全局规则
+	ProxyConfigIDs []uuid.UUID      `json:"proxy_config_ids,omitempty"` // 两条规则同时生效的代理配置
+}
@@ -1,6 +1,12 @@
 package services
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"proxy-enhancer-ultra/internal/proxy"
+	"proxy-enhancer-ultra/internal/ruledsl"
+)
 
 // RuleValidator 规则验证器
 type RuleValidator struct{}
@@ -34,7 +40,7 @@ func (v *RuleValidator) ValidatePosition(position string) error {
 		return nil // 位置是可选的
 	}
 
-	validPositions := []string{"before", "after", "inside", "replace"}
+	validPositions := []string{"before", "after", "inside", "inside_start", "replace"}
 	if !containsString(validPositions, position) {
 		return errors.New("invalid position")
 	}
@@ -47,14 +53,50 @@ func (v *RuleValidator) ValidateCreateRequest(req *CreateRuleRequest) error {
 		return err
 	}
 
-	if err := v.ValidateAction(req.Action); err != nil {
+	// 使用 Actions 时由 ValidateDefinition 校验每个动作
+	if len(req.Actions) == 0 {
+		if err := v.ValidateAction(req.Action); err != nil {
+			return err
+		}
+
+		if err := v.ValidatePosition(req.Position); err != nil {
+			return err
+		}
+	}
+
+	if err := v.ValidateConditions(req.Conditions); err != nil {
 		return err
 	}
 
-	if err := v.ValidatePosition(req.Position); err != nil {
+	return nil
+}
+
+// ValidateDefinition 按JSON Schema和语义约束验证规则定义
+func (v *RuleValidator) ValidateDefinition(def *ruledsl.Definition) error {
+	trigger, actions, err := def.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := ruledsl.ValidateJSON(ruledsl.TriggerSchema, []byte(trigger)); err != nil {
+		return fmt.Errorf("invalid trigger conditions: %w", err)
+	}
+	if err := ruledsl.ValidateJSON(ruledsl.ActionsSchema, []byte(actions)); err != nil {
+		return fmt.Errorf("invalid actions: %w", err)
+	}
+	if err := def.Validate(); err != nil {
 		return err
 	}
+	if _, err := proxy.CompileSelector(def.Trigger.Selector); err != nil {
+		return fmt.Errorf("invalid selector: %w", err)
+	}
+	return nil
+}
 
+// ValidateConditions 验证触发条件
+func (v *RuleValidator) ValidateConditions(conditions []byte) error {
+	if _, err := ruledsl.Parse(conditions); err != nil {
+		return fmt.Errorf("invalid conditions: %w", err)
+	}
 	return nil
 }
 
@@ -76,5 +118,9 @@ func (v *RuleValidator) ValidateUpdateRequest(req *UpdateRuleRequest) error {
 		return err
 	}
 
+	if err := v.ValidateConditions(req.Conditions); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sourceMetricsSelect 来源分析的指标
+const sourceMetricsSelect = "COUNT(*) FILTER (WHERE NOT is_partial) AS submissions, " +
+	"COUNT(*) FILTER (WHERE is_partial) AS partial_submissions, " + leadStatsSelect
+
+// sourceBucketLayout 时间段的本地时间格式
+const sourceBucketLayout = "2006-01-02T15:04"
+
+// 来源分析查询的限制
+const (
+	defaultSourceLimit  = 20
+	maxSourceLimit      = 100
+	defaultSeriesLimit  = 5
+	maxSeriesLimit      = 20
+	maxSeriesBuckets    = 1000
+	maxSourceFilterSize = 500 // 维度条件值的最大长度（字符），与来源归因列的最大宽度一致
+)
+
+// defaultSourceRanges 未指定开始时间时各粒度的默认时间范围
+var defaultSourceRanges = map[string]time.Duration{
+	GranularityHour: 2 * 24 * time.Hour,
+	GranularityDay:  30 * 24 * time.Hour,
+	GranularityWeek: 12 * 7 * 24 * time.Hour,
+}
+
+// sourceGranularities 时间序列支持的粒度
+var sourceGranularities = []string{GranularityHour, GranularityDay, GranularityWeek}
+
+// Validate 校验来源分析查询条件并设置默认值，series 为 true 时按时间序列校验
+func (q *SourceAnalyticsQuery) Validate(series bool) error {
+	if q.Dimension != "" && !slices.Contains(SourceDimensions, q.Dimension) {
+		return fmt.Errorf("invalid dimension %q, expected one of %s", q.Dimension, strings.Join(SourceDimensions, ", "))
+	}
+	if !series && q.Dimension == "" {
+		return errors.New("dimension is required")
+	}
+	for dimension, value := range q.Filters {
+		if !slices.Contains(SourceDimensions, dimension) {
+			return fmt.Errorf("invalid filter dimension %q", dimension)
+		}
+		if len([]rune(value)) > maxSourceFilterSize {
+			return fmt.Errorf("filter value for %s must be at most %d characters", dimension, maxSourceFilterSize)
+		}
+	}
+
+	if q.Granularity == "" {
+		q.Granularity = GranularityDay
+	}
+	if !slices.Contains(sourceGranularities, q.Granularity) {
+		return fmt.Errorf("invalid granularity %q, expected one of %s", q.Granularity, strings.Join(sourceGranularities, ", "))
+	}
+	if q.Timezone == "" {
+		q.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %s", q.Timezone)
+	}
+
+	if q.EndDate == nil {
+		end := time.Now()
+		q.EndDate = &end
+	}
+	if q.StartDate == nil {
+		start := q.EndDate.Add(-defaultSourceRanges[q.Granularity])
+		q.StartDate = &start
+	}
+	if !q.StartDate.Before(*q.EndDate) {
+		return errors.New("start_date must be before end_date")
+	}
+
+	limit, maxLimit := defaultSourceLimit, maxSourceLimit
+	if series {
+		limit, maxLimit = defaultSeriesLimit, maxSeriesLimit
+	}
+	if q.Limit == 0 {
+		q.Limit = limit
+	}
+	if q.Limit < 0 || q.Limit > maxLimit {
+		return fmt.Errorf("limit must be between 1 and %d", maxLimit)
+	}
+
+	if series && len(q.buckets()) > maxSeriesBuckets {
+		return fmt.Errorf("time range has more than %d %s buckets, use a shorter range or a larger granularity", maxSeriesBuckets, q.Granularity)
+	}
+	return nil
+}
+
+// location 返回查询使用的时区，必须在 Validate 之后调用
+func (q *SourceAnalyticsQuery) location() *time.Location {
+	location, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// buckets 返回时间范围内所有时间段开始的本地时间，与 date_trunc 对本地时间的截断一致
+func (q *SourceAnalyticsQuery) buckets() []string {
+	location := q.location()
+	// 使用UTC表示本地时间，按本地时间逐段推进，夏令时切换时与数据库的本地时间分组一致
+	wall := func(t time.Time) time.Time {
+		local := t.In(location)
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, time.UTC)
+	}
+	current := truncateBucket(wall(*q.StartDate), q.Granularity)
+	last := wall(q.EndDate.Add(-time.Nanosecond))
+
+	var buckets []string
+	for !current.After(last) && len(buckets) <= maxSeriesBuckets {
+		// 夏令时开始时跳过的本地小时没有对应的时间段，按天和周分组时本地零点总是作为时间段开始
+		local := time.Date(current.Year(), current.Month(), current.Day(), current.Hour(), 0, 0, 0, location)
+		if q.Granularity != GranularityHour || local.Hour() == current.Hour() {
+			buckets = append(buckets, current.Format(sourceBucketLayout))
+		}
+		switch q.Granularity {
+		case GranularityHour:
+			current = current.Add(time.Hour)
+		case GranularityWeek:
+			current = current.AddDate(0, 0, 7)
+		default:
+			current = current.AddDate(0, 0, 1)
+		}
+	}
+	return buckets
+}
+
+// truncateBucket 把本地时间截断到时间段开始，每周从周一开始
+func truncateBucket(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityHour:
+		return t
+	case GranularityWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// applySourceQuery 按弹窗、时间范围和维度条件过滤提交
+func applySourceQuery(query *gorm.DB, q *SourceAnalyticsQuery) *gorm.DB {
+	query = query.Where("created_at >= ? AND created_at < ?", *q.StartDate, *q.EndDate)
+	if q.PopupID != nil {
+		query = query.Where("popup_id = ?", *q.PopupID)
+	}
+	for _, dimension := range SourceDimensions {
+		if value, ok := q.Filters[dimension]; ok {
+			// 维度名来自固定列表，可以直接拼接
+			query = query.Where("COALESCE("+dimension+", '') = ?", value)
+		}
+	}
+	return query
+}
@@ -1,28 +1,48 @@
 package services
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
+	"regexp"
+	"sort"
 	"time"
 
+	"proxy-enhancer-ultra/internal/attribution"
+	"proxy-enhancer-ultra/internal/formguard"
 	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
 	"proxy-enhancer-ultra/pkg/logger"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// formSessionIDPattern 页面脚本生成的访客会话ID格式
+var formSessionIDPattern = regexp.MustCompile(`^[a-z0-9]{1,64}$`)
+
 // SubmissionCRUDService 提交记录CRUD操作服务
 type SubmissionCRUDService struct {
-	db     *gorm.DB
-	logger logger.Logger
+	db            *gorm.DB
+	logger        logger.Logger
+	guard         *SubmissionGuard
+	files         *FileService
+	webhooks      *WebhookService
+	notifications *NotificationService
+	encryption    *EncryptionService
 }
 
-// NewSubmissionCRUDService 创建新的提交CRUD服务
-func NewSubmissionCRUDService(db *gorm.DB, logger logger.Logger) *SubmissionCRUDService {
+// NewSubmissionCRUDService 创建新的提交CRUD服务，guard 为nil时不做防垃圾提交检查，files 为nil时表单不接受文件，
+// webhooks 为nil时不投递Webhook，notifications 为nil时不发送邮件通知，encryption 为nil时不加密敏感字段
+func NewSubmissionCRUDService(db *gorm.DB, logger logger.Logger, guard *SubmissionGuard, files *FileService, webhooks *WebhookService, notifications *NotificationService, encryption *EncryptionService) *SubmissionCRUDService {
 	return &SubmissionCRUDService{
-		db:     db,
-		logger: logger,
+		db:            db,
+		logger:        logger,
+		guard:         guard,
+		files:         files,
+		webhooks:      webhooks,
+		notifications: notifications,
+		encryption:    encryption,
 	}
 }
 
@@ -30,31 +50,78 @@ func NewSubmissionCRUDService(db *gorm.DB, logger logger.Logger) *SubmissionCRUD
 func (s *SubmissionCRUDService) CreateSubmission(req *CreateSubmissionRequest) (*models.Submission, error) {
 	// 验证弹窗是否存在
 	var popup models.Popup
-	if err := s.db.First(&popup, req.PopupID).Error; err != nil {
+	if err := s.db.Where("id = ?", req.PopupID).First(&popup).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("popup not found")
 		}
 		return nil, err
 	}
 
-	// 序列化表单数据
-	formDataJSON, err := json.Marshal(req.FormData)
+	if err := s.checkVariant(req.PopupID, req.VariantID); err != nil {
+		return nil, err
+	}
+
+	form, err := popupspec.ParseFormConfig(popup.FormConfig)
 	if err != nil {
-		return nil, errors.New("invalid form data")
+		return nil, fmt.Errorf("popup form config is invalid: %w", err)
 	}
 
 	// 创建提交记录
 	submission := &models.Submission{
 		PopupID:     req.PopupID, // PopupID是uuid.UUID类型
-		FormData:    string(formDataJSON),
 		UserAgent:   req.UserAgent,
 		UserIP:      req.IPAddress, // 使用UserIP字段
 		ReferrerURL: req.Referrer,  // 使用ReferrerURL字段
+		VariantID:   req.VariantID,
+		VisitorID:   req.VisitorID,
+		Status:      SubmissionStatusNew,
+		Tags:        "[]",
 	}
+	setSubmissionSource(submission, attribution.Capture(req.Referrer, req.LandingPage, req.ReferrerDomain, req.UserAgent))
+
+	var duplicate *duplicateResult
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if duplicate, err = s.resolveDuplicate(tx, &popup, form, req.FormData, submission); err != nil {
+			return err
+		}
+		if duplicate.existing != nil {
+			return s.webhooks.EnqueueTx(tx, WebhookEventSubmissionDuplicate, duplicate.existing, nil)
+		}
+		submission.DedupKey = duplicate.key
 
-	if err := s.db.Create(submission).Error; err != nil {
+		// 序列化表单数据，加密敏感字段
+		if err := s.encryption.SealSubmission(submission, form, req.FormData); err != nil {
+			return err
+		}
+		if err := tx.Create(submission).Error; err != nil {
+			return err
+		}
+		if err := s.webhooks.EnqueueTx(tx, WebhookEventSubmissionCreated, submission, nil); err != nil {
+			return err
+		}
+		if err := s.webhooks.EnqueueTx(tx, WebhookEventSubmissionCompleted, submission, nil); err != nil {
+			return err
+		}
+		return s.notifications.EnqueueTx(tx, submission)
+	})
+	if err != nil {
 		return nil, err
 	}
+	s.webhooks.Notify()
+	s.notifications.Notify()
+	if duplicate.existing != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"submission_id": duplicate.existing.ID,
+			"popup_id":      submission.PopupID,
+			"action":        duplicate.action,
+		}).Info("Duplicate submission received")
+		if duplicate.action == popupspec.DedupReject {
+			return nil, ErrDuplicateSubmission
+		}
+		duplicate.existing.Deduplicated = true
+		return duplicate.existing, nil
+	}
 
 	s.logger.WithFields(map[string]interface{}{
 		"submission_id": submission.ID,
@@ -65,10 +132,254 @@ func (s *SubmissionCRUDService) CreateSubmission(req *CreateSubmissionRequest) (
 	return submission, nil
 }
 
+// SubmitFormStep 保存代理页面提交的表单步骤
+//
+// 同一弹窗、访客和会话的各步骤合并到一条未完成的提交记录中，提交最后一步时校验所有必填字段并标记为完成
+func (s *SubmissionCRUDService) SubmitFormStep(req *SubmitFormStepRequest) (*FormStepResult, error) {
+	if req.VisitorID == "" {
+		return nil, &InputError{Message: "visitor not identified"}
+	}
+	if !formSessionIDPattern.MatchString(req.SessionID) {
+		return nil, &InputError{Message: "invalid session id"}
+	}
+	if err := s.guard.CheckRate(req); err != nil {
+		return nil, err
+	}
+
+	popup, err := s.findProxyPopup(req.PopupID, req.ProxyConfigID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkVariant(req.PopupID, req.VariantID); err != nil {
+		return nil, err
+	}
+
+	form, err := popupspec.ParseFormConfig(popup.FormConfig)
+	if err != nil {
+		return nil, fmt.Errorf("popup form config is invalid: %w", err)
+	}
+	form = s.localizeForm(form, req.PopupID, req.Locale)
+	index := form.StepIndex(req.Step)
+	if index < 0 {
+		return nil, &InputError{Message: "form step not found"}
+	}
+	steps := form.StepList()
+	completed := index >= len(steps)-1
+	if err := s.guard.CheckForm(req, form, completed); err != nil {
+		return nil, err
+	}
+
+	result := &FormStepResult{Step: req.Step, Completed: completed}
+	if !completed {
+		result.NextStep = steps[index+1].ID
+	}
+
+	var duplicate *duplicateResult
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var submission models.Submission
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("popup_id = ? AND visitor_id = ? AND session_id = ? AND is_partial = ?", req.PopupID, req.VisitorID, req.SessionID, true).
+			Order("updated_at DESC").
+			First(&submission).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		found := err == nil
+
+		data := make(map[string]interface{})
+		if found {
+			// 之前步骤的敏感字段先解密，显示条件和必填校验需要明文，保存时使用当前数据密钥重新加密
+			if data, err = s.encryption.OpenSubmission(&submission); err != nil {
+				return err
+			}
+		}
+		if err := form.ApplyStep(index, data, req.Values); err != nil {
+			return invalidInput(err)
+		}
+		var step *popupspec.FormStep
+		if index < len(steps) {
+			step = &steps[index]
+		}
+		var submissionID *uuid.UUID
+		if found {
+			submissionID = &submission.ID
+		}
+		fileIDs, err := s.resolveFormFiles(tx, step, req, data, submissionID)
+		if err != nil {
+			return err
+		}
+		submission.UserIP = req.IPAddress
+		submission.UserAgent = req.UserAgent
+		if completed {
+			if err := form.Complete(data); err != nil {
+				return invalidInput(err)
+			}
+			if err := s.guard.CheckCaptcha(req, form, completed); err != nil {
+				return err
+			}
+
+			// 时间窗口内已有去重键相同的完成提交时，按弹窗配置处理后不再保存本条提交
+			if duplicate, err = s.resolveDuplicate(tx, popup, form, data, &submission); err != nil {
+				return err
+			}
+			if duplicate.existing != nil {
+				result.SubmissionID = duplicate.existing.ID
+				result.Duplicate = true
+				if duplicate.action != popupspec.DedupReject {
+					if err := s.syncDuplicateFiles(tx, duplicate.existing, fileIDs); err != nil {
+						return err
+					}
+				}
+				proxyConfigID := req.ProxyConfigID
+				return s.webhooks.EnqueueTx(tx, WebhookEventSubmissionDuplicate, duplicate.existing, &proxyConfigID)
+			}
+			submission.DedupKey = duplicate.key
+		}
+
+		submission.PopupID = req.PopupID
+		if err := s.encryption.SealSubmission(&submission, form, data); err != nil {
+			return err
+		}
+		submission.ReferrerURL = req.Referrer
+		submission.VariantID = req.VariantID
+		submission.VisitorID = req.VisitorID
+		submission.SessionID = req.SessionID
+		submission.LastStep = req.Step
+		submission.IsPartial = !completed
+		if completed {
+			now := time.Now()
+			submission.CompletedAt = &now
+		}
+
+		source := attribution.Capture(req.Referrer, req.LandingPage, req.ReferrerDomain, req.UserAgent)
+		if found {
+			// 来源归因使用第一步的会话来源，只更新提交页面
+			submission.ProxiedPath = source.ProxiedPath
+			err = tx.Save(&submission).Error
+		} else {
+			setSubmissionSource(&submission, source)
+			submission.Status = SubmissionStatusNew
+			submission.Tags = "[]"
+			err = tx.Create(&submission).Error
+		}
+		if err != nil {
+			return err
+		}
+		result.SubmissionID = submission.ID
+		if err := s.linkFormFiles(tx, submission.ID, step, fileIDs); err != nil {
+			return err
+		}
+
+		proxyConfigID := req.ProxyConfigID
+		if !found {
+			if err := s.webhooks.EnqueueTx(tx, WebhookEventSubmissionCreated, &submission, &proxyConfigID); err != nil {
+				return err
+			}
+		}
+		if completed {
+			if err := s.webhooks.EnqueueTx(tx, WebhookEventSubmissionCompleted, &submission, &proxyConfigID); err != nil {
+				return err
+			}
+			return s.notifications.EnqueueTx(tx, &submission)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.webhooks.Notify()
+	s.notifications.Notify()
+	if duplicate != nil && duplicate.existing != nil {
+		s.files.deleteStored(duplicate.storedKeys...)
+		s.logger.WithFields(map[string]interface{}{
+			"submission_id": duplicate.existing.ID,
+			"popup_id":      req.PopupID,
+			"action":        duplicate.action,
+		}).Info("Duplicate submission received")
+		if duplicate.action == popupspec.DedupReject {
+			return nil, ErrDuplicateSubmission
+		}
+		return result, nil
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"submission_id": result.SubmissionID,
+		"popup_id":      req.PopupID,
+		"step":          req.Step,
+		"completed":     completed,
+	}).Info("Form step submitted successfully")
+
+	return result, nil
+}
+
+// setSubmissionSource 设置提交的来源归因
+func setSubmissionSource(submission *models.Submission, source attribution.Source) {
+	submission.ReferrerDomain = source.ReferrerDomain
+	submission.UTMSource = source.UTMSource
+	submission.UTMMedium = source.UTMMedium
+	submission.UTMCampaign = source.UTMCampaign
+	submission.UTMTerm = source.UTMTerm
+	submission.UTMContent = source.UTMContent
+	submission.LandingPage = source.LandingPage
+	submission.ProxiedPath = source.ProxiedPath
+	submission.DeviceClass = source.DeviceClass
+}
+
+// findProxyPopup 查找对代理配置生效的启用弹窗
+func (s *SubmissionCRUDService) findProxyPopup(popupID, proxyConfigID uuid.UUID) (*models.Popup, error) {
+	var popup models.Popup
+	bound := s.db.Model(&models.PopupProxyConfig{}).Select("popup_id").Where("proxy_config_id = ?", proxyConfigID)
+	if err := s.db.Select("id", "form_config", "dedup").
+		Where("id = ? AND is_active = ? AND (is_global = ? OR id IN (?))", popupID, true, true, bound).
+		First(&popup).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &InputError{Message: "popup not found"}
+		}
+		return nil, err
+	}
+	return &popup, nil
+}
+
+// localizeForm 使用页面显示语言的表单翻译，没有翻译时使用原文
+func (s *SubmissionCRUDService) localizeForm(form *popupspec.FormConfig, popupID uuid.UUID, locale string) *popupspec.FormConfig {
+	if locale == "" {
+		return form
+	}
+	locale, err := popupspec.NormalizeLocale(locale)
+	if err != nil {
+		return form
+	}
+	var translation models.PopupTranslation
+	if err := s.db.Select("form_translation").Where("popup_id = ? AND locale = ?", popupID, locale).First(&translation).Error; err != nil {
+		return form
+	}
+	formTranslation, err := popupspec.ParseFormTranslation(translation.FormTranslation)
+	if err != nil {
+		return form
+	}
+	return form.Localize(formTranslation)
+}
+
+// checkVariant 验证变体属于该弹窗，已删除的变体仍可归因
+func (s *SubmissionCRUDService) checkVariant(popupID uuid.UUID, variantID *uuid.UUID) error {
+	if variantID == nil {
+		return nil
+	}
+	var count int64
+	if err := s.db.Unscoped().Model(&models.PopupVariant{}).Where("id = ? AND popup_id = ?", *variantID, popupID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return &InputError{Message: "popup variant not found"}
+	}
+	return nil
+}
+
 // GetSubmission 获取提交
-func (s *SubmissionCRUDService) GetSubmission(id uint) (*models.Submission, error) {
+func (s *SubmissionCRUDService) GetSubmission(id uuid.UUID) (*models.Submission, error) {
 	var submission models.Submission
-	if err := s.db.Preload("Popup").First(&submission, id).Error; err != nil {
+	if err := s.db.Preload("Popup").First(&submission, "id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("submission not found")
 		}
@@ -79,10 +390,10 @@ func (s *SubmissionCRUDService) GetSubmission(id uint) (*models.Submission, erro
 }
 
 // UpdateSubmission 更新提交
-func (s *SubmissionCRUDService) UpdateSubmission(id uint, req *UpdateSubmissionRequest) error {
+func (s *SubmissionCRUDService) UpdateSubmission(id uuid.UUID, req *UpdateSubmissionRequest) error {
 	// 检查提交是否存在
 	var submission models.Submission
-	if err := s.db.First(&submission, id).Error; err != nil {
+	if err := s.db.First(&submission, "id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("submission not found")
 		}
@@ -92,20 +403,40 @@ func (s *SubmissionCRUDService) UpdateSubmission(id uint, req *UpdateSubmissionR
 	// 准备更新数据
 	updates := make(map[string]interface{})
 
-	if req.FormData != nil {
-		formDataJSON, err := json.Marshal(req.FormData)
+	if req.FormData != nil || req.UserAgent != "" || req.IPAddress != "" {
+		// 表单数据和客户端信息解密后合并修改，再按弹窗当前的表单配置重新加密
+		data, err := s.encryption.OpenSubmission(&submission)
 		if err != nil {
-			return errors.New("invalid form data")
+			return err
+		}
+		if req.FormData != nil {
+			data = req.FormData
+		}
+		if req.UserAgent != "" {
+			submission.UserAgent = req.UserAgent
+		}
+		if req.IPAddress != "" {
+			submission.UserIP = req.IPAddress
 		}
-		updates["form_data"] = string(formDataJSON)
-	}
-
-	if req.UserAgent != "" {
-		updates["user_agent"] = req.UserAgent
-	}
 
-	if req.IPAddress != "" {
-		updates["user_ip"] = req.IPAddress // 使用user_ip字段
+		var popup models.Popup
+		if err := s.db.Select("id", "form_config", "dedup").First(&popup, "id = ?", submission.PopupID).Error; err != nil {
+			return err
+		}
+		form, err := popupspec.ParseFormConfig(popup.FormConfig)
+		if err != nil {
+			return fmt.Errorf("popup form config is invalid: %w", err)
+		}
+		_, dedupKey := s.dedupKeyOf(&popup, data)
+		if err := s.encryption.SealSubmission(&submission, form, data); err != nil {
+			return err
+		}
+		updates["dedup_key"] = dedupKey
+		updates["form_data"] = submission.FormData
+		updates["user_agent"] = submission.UserAgent
+		updates["user_ip"] = submission.UserIP // 使用user_ip字段
+		updates["client_info"] = submission.ClientInfo
+		updates["encryption_key_id"] = submission.EncryptionKeyID
 	}
 
 	if req.Referrer != "" {
@@ -126,19 +457,24 @@ func (s *SubmissionCRUDService) UpdateSubmission(id uint, req *UpdateSubmissionR
 		return err
 	}
 
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
 	s.logger.WithFields(map[string]interface{}{
 		"submission_id": id,
-		"updates":       updates,
+		"fields":        fields,
 	}).Info("Submission updated successfully")
 
 	return nil
 }
 
 // DeleteSubmission 删除提交
-func (s *SubmissionCRUDService) DeleteSubmission(id uint) error {
+func (s *SubmissionCRUDService) DeleteSubmission(id uuid.UUID) error {
 	// 检查提交是否存在
 	var submission models.Submission
-	if err := s.db.First(&submission, id).Error; err != nil {
+	if err := s.db.First(&submission, "id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("submission not found")
 		}
@@ -179,3 +515,11 @@ func (s *SubmissionCRUDService) DeleteSubmissionsByPopup(popupID uuid.UUID) erro
 
 	return nil
 }
+
+// NewCaptcha 生成图片验证码
+func (s *SubmissionCRUDService) NewCaptcha() (*formguard.Captcha, error) {
+	if s.guard == nil {
+		return nil, errors.New("captcha is not enabled")
+	}
+	return s.guard.NewCaptcha()
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dedupLockSQL 同一弹窗同一去重键的提交串行处理，避免并发的重复提交都被保存
+const dedupLockSQL = "SELECT pg_advisory_xact_lock(hashtext(?))"
+
+// duplicateResult 按弹窗去重配置处理新提交的结果
+type duplicateResult struct {
+	key        string             // 新提交的去重键，弹窗未配置去重或字段没有值时为空
+	action     string             // 弹窗配置的处理方式
+	existing   *models.Submission // 时间窗口内已有的提交，不是重复提交时为nil
+	storedKeys []string           // 被删除的未完成提交上传的文件，事务提交后删除文件内容
+}
+
+// resolveDuplicate 在事务中查找时间窗口内去重键相同的已完成提交，找到时按弹窗配置拒绝、更新或合并
+//
+// data 为新提交的明文表单数据，更新和合并时会被修改。incoming 的用户IP和浏览器信息须为本次请求的明文，更新时写入已有提交。
+// incoming 为多步表单的未完成提交时，
+// 更新和合并后删除该记录，之前步骤上传的文件转到已有提交；拒绝时保留该记录，访客可以修改后重新提交
+func (s *SubmissionCRUDService) resolveDuplicate(tx *gorm.DB, popup *models.Popup, form *popupspec.FormConfig, data map[string]interface{}, incoming *models.Submission) (*duplicateResult, error) {
+	dedup, key := s.dedupKeyOf(popup, data)
+	if key == "" {
+		return &duplicateResult{}, nil
+	}
+	result := &duplicateResult{key: key, action: dedup.Action}
+	if err := tx.Exec(dedupLockSQL, popup.ID.String()+":"+result.key).Error; err != nil {
+		return nil, err
+	}
+
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("popup_id = ? AND dedup_key = ? AND is_partial = ?", popup.ID, result.key, false)
+	if incoming.ID != uuid.Nil {
+		query = query.Where("id <> ?", incoming.ID)
+	}
+	if dedup.WindowHours > 0 {
+		query = query.Where("created_at >= ?", time.Now().Add(-time.Duration(dedup.WindowHours)*time.Hour))
+	}
+	var existing models.Submission
+	if err := query.Order("created_at DESC").First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"duplicate_count":   gorm.Expr("duplicate_count + 1"),
+		"last_duplicate_at": now,
+	}
+	if dedup.Action == popupspec.DedupUpdate || dedup.Action == popupspec.DedupMerge {
+		current, err := s.encryption.OpenSubmission(&existing)
+		if err != nil {
+			return nil, err
+		}
+		if dedup.Action == popupspec.DedupMerge {
+			data = mergeFormData(current, data)
+		} else {
+			// 更新时保存新提交的请求信息，合并时保留已有提交的请求信息
+			existing.UserIP = incoming.UserIP
+			existing.UserAgent = incoming.UserAgent
+		}
+		if err := s.encryption.SealSubmission(&existing, form, data); err != nil {
+			return nil, err
+		}
+		updates["form_data"] = existing.FormData
+		updates["user_ip"] = existing.UserIP
+		updates["user_agent"] = existing.UserAgent
+		updates["client_info"] = existing.ClientInfo
+		updates["encryption_key_id"] = existing.EncryptionKeyID
+		updates["updated_at"] = now
+	}
+	if err := tx.Model(&existing).UpdateColumns(updates).Error; err != nil {
+		return nil, err
+	}
+	existing.DuplicateCount++
+	existing.LastDuplicateAt = &now
+	result.existing = &existing
+
+	if incoming.ID != uuid.Nil && dedup.Action != popupspec.DedupReject {
+		if err := tx.Model(&models.File{}).Where("submission_id = ?", incoming.ID).
+			Update("submission_id", existing.ID).Error; err != nil {
+			return nil, err
+		}
+		keys, _, err := purgeSubmissionRecords(tx, []uuid.UUID{incoming.ID})
+		if err != nil {
+			return nil, err
+		}
+		result.storedKeys = keys
+		if err := tx.Unscoped().Delete(&models.Submission{}, "id = ?", incoming.ID).Error; err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// syncDuplicateFiles 更新或合并重复提交后，把表单数据引用的新上传文件关联到已有提交，
+// 并取消已有提交中不再被表单数据引用的文件的关联，未关联的文件可以通过文件清理删除
+func (s *SubmissionCRUDService) syncDuplicateFiles(tx *gorm.DB, submission *models.Submission, uploaded []uuid.UUID) error {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(submission.FormData), &data); err != nil {
+		return fmt.Errorf("invalid form data: %w", err)
+	}
+	referenced := make([]uuid.UUID, 0, len(data))
+	for _, value := range data {
+		if id, err := uuid.Parse(popupspec.FileID(value)); err == nil {
+			referenced = append(referenced, id)
+		}
+	}
+
+	unlink := tx.Model(&models.File{}).Where("submission_id = ?", submission.ID)
+	if len(referenced) > 0 {
+		unlink = unlink.Where("id NOT IN ?", referenced)
+	}
+	if err := unlink.Update("submission_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to update form files: %w", err)
+	}
+	if len(uploaded) > 0 && len(referenced) > 0 {
+		if err := tx.Model(&models.File{}).Where("id IN ? AND id IN ?", uploaded, referenced).
+			Update("submission_id", submission.ID).Error; err != nil {
+			return fmt.Errorf("failed to update form files: %w", err)
+		}
+	}
+	return nil
+}
+
+// dedupKeyOf 返回弹窗的去重配置和明文表单数据的去重键，未配置去重、配置无效、字段没有值或没有可用的密钥时去重键为空
+//
+// 去重键是字段值的带密钥哈希，避免从去重键反推手机号等敏感值：配置了字段加密时使用盲索引密钥，否则使用服务端密钥。
+// 启用字段加密前后同一值的去重键不同，启用前的提交不会与启用后的提交去重
+func (s *SubmissionCRUDService) dedupKeyOf(popup *models.Popup, data map[string]interface{}) (*popupspec.Dedup, string) {
+	dedup, err := popupspec.ParseDedup(popup.Dedup)
+	if err != nil {
+		// 配置无效时不去重，保存提交比拒绝访客更安全
+		return &popupspec.Dedup{}, ""
+	}
+	raw, ok := dedup.Key(data)
+	if !ok {
+		return dedup, ""
+	}
+	key, ok := s.encryption.Fingerprint("$dedup", raw)
+	if !ok {
+		s.logger.WithFields(map[string]interface{}{
+			"popup_id": popup.ID,
+		}).Warn("Submission deduplication skipped: no fingerprint key is configured")
+		return dedup, ""
+	}
+	return dedup, key
+}
+
+// mergeFormData 合并重复提交的表单数据，已有提交中有值的字段保持不变，新提交只补充没有值的字段
+func mergeFormData(current, incoming map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(current)+len(incoming))
+	for name, value := range current {
+		merged[name] = value
+	}
+	for name, value := range incoming {
+		if isEmptyFormValue(merged[name]) {
+			merged[name] = value
+		}
+	}
+	return merged
+}
+
+// isEmptyFormValue 判断表单字段是否没有值
+func isEmptyFormValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
@@ -1,133 +1,500 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+	"proxy-enhancer-ultra/internal/xlsx"
 	"proxy-enhancer-ultra/pkg/logger"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// exportTimeLayout CSV中时间列的格式
+const exportTimeLayout = "2006-01-02 15:04:05"
+
+// exportDateLayout 导出日期范围参数的格式
+const exportDateLayout = "2006-01-02"
+
+// utf8BOM UTF-8字节顺序标记
+const utf8BOM = "\xEF\xBB\xBF"
+
+// exportProgressInterval 流式导出时每写入多少条记录报告一次进度
+const exportProgressInterval = 1000
+
+// exportBaseColumns 表格导出中表单字段之前的固定列
+var exportBaseColumns = []string{
+	"id", "popup_id", "variant_id", "visitor_id", "session_id", "is_partial", "last_step",
+	"created_at", "completed_at", "user_ip", "user_agent", "referrer_url",
+}
+
+// exportContentTypes 各导出格式的MIME类型
+var exportContentTypes = map[string]string{
+	ExportFormatJSON: "application/json",
+	ExportFormatCSV:  "text/csv; charset=utf-8",
+	ExportFormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// ExportContentType 返回导出格式的MIME类型
+func ExportContentType(format string) string {
+	if contentType, ok := exportContentTypes[format]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// ExportProgress 流式导出的进度回调，参数为已写入的记录数，返回错误时中止导出
+type ExportProgress func(processed int64) error
+
 // SubmissionExportService 提交数据导出服务
 type SubmissionExportService struct {
-	db     *gorm.DB
-	logger logger.Logger
+	db         *gorm.DB
+	logger     logger.Logger
+	encryption *EncryptionService
 }
 
-// NewSubmissionExportService 创建新的提交导出服务
-func NewSubmissionExportService(db *gorm.DB, logger logger.Logger) *SubmissionExportService {
+// NewSubmissionExportService 创建新的提交导出服务，encryption 为nil时不能导出加密字段的原文
+func NewSubmissionExportService(db *gorm.DB, logger logger.Logger, encryption *EncryptionService) *SubmissionExportService {
 	return &SubmissionExportService{
-		db:     db,
-		logger: logger,
+		db:         db,
+		logger:     logger,
+		encryption: encryption,
+	}
+}
+
+// exportColumn 表格导出中的一个表单字段列
+type exportColumn struct {
+	key   string // 表单数据中的字段名
+	title string // 表头
+}
+
+// tableWriter 表格导出的行写入器，单元格为 string、bool、float64、time.Time 或 nil，xlsx.Writer 直接实现该接口
+type tableWriter interface {
+	WriteHeader(titles []string) error
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// ExportSubmissions 导出提交数据并返回文件内容，数据量大时应使用导出任务
+func (s *SubmissionExportService) ExportSubmissions(req *ExportSubmissionsRequest) ([]byte, error) {
+	if err := s.ValidateExportRequest(req); err != nil {
+		return nil, err
+	}
+	if err := s.AuthorizeDecrypt(req); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := s.WriteExport(context.Background(), &buf, req, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportSubmissionsByDateRange 按日期范围导出提交数据
+func (s *SubmissionExportService) ExportSubmissionsByDateRange(popupID uuid.UUID, startDate, endDate string, format string) ([]byte, error) {
+	return s.ExportSubmissions(&ExportSubmissionsRequest{
+		PopupID:   popupID,
+		Format:    format,
+		StartDate: startDate,
+		EndDate:   endDate,
+	})
+}
+
+// ValidateExportRequest 校验导出参数
+func (s *SubmissionExportService) ValidateExportRequest(req *ExportSubmissionsRequest) error {
+	switch req.Format {
+	case ExportFormatJSON, ExportFormatCSV, ExportFormatXLSX:
+	default:
+		return errors.New("unsupported export format")
+	}
+	switch req.Columns {
+	case "", ExportColumnsSchema, ExportColumnsUnion:
+	default:
+		return errors.New("unsupported export columns, expected schema or union")
+	}
+	if req.StartDate != "" {
+		if _, err := time.ParseInLocation(exportDateLayout, req.StartDate, time.Local); err != nil {
+			return errors.New("invalid start date, expected YYYY-MM-DD")
+		}
 	}
+	if req.EndDate != "" {
+		if _, err := time.ParseInLocation(exportDateLayout, req.EndDate, time.Local); err != nil {
+			return errors.New("invalid end date, expected YYYY-MM-DD")
+		}
+	}
+	return nil
 }
 
-// ExportSubmissions 导出提交数据
-func (s *SubmissionExportService) ExportSubmissions(popupID uuid.UUID, format string) ([]byte, error) {
+// AuthorizeDecrypt 请求导出敏感字段原文时检查用户的解密权限并记录审计日志，没有权限时返回 ErrDecryptForbidden
+func (s *SubmissionExportService) AuthorizeDecrypt(req *ExportSubmissionsRequest) error {
+	if !req.Decrypt {
+		return nil
+	}
+	if !s.encryption.Enabled() {
+		return errors.New("field encryption is not configured")
+	}
+	return s.encryption.AuthorizeDecrypt(req.Actor, AuditActionSubmissionsExported, AuditResourcePopup, req.PopupID.String(), map[string]interface{}{
+		"format":     req.Format,
+		"start_date": req.StartDate,
+		"end_date":   req.EndDate,
+	})
+}
+
+// CountSubmissions 统计符合导出条件的提交记录数
+func (s *SubmissionExportService) CountSubmissions(ctx context.Context, req *ExportSubmissionsRequest) (int64, error) {
+	if err := s.ValidateExportRequest(req); err != nil {
+		return 0, err
+	}
+	var count int64
+	err := s.exportQuery(ctx, req).Count(&count).Error
+	return count, err
+}
+
+// WriteExport 按数据库游标逐条读取提交记录并写入 w，返回写入的记录数
+//
+// JSON格式导出完整的提交记录；CSV和XLSX格式把表单数据展开为每个字段一列，
+// 列在读取记录前由弹窗表单配置和数据库中出现过的字段名确定，不需要把所有记录读入内存。
+// req.Decrypt 为 true 时导出敏感字段和客户端信息的原文，否则导出脱敏文本，解密权限应在调用前检查
+func (s *SubmissionExportService) WriteExport(ctx context.Context, w io.Writer, req *ExportSubmissionsRequest, progress ExportProgress) (int64, error) {
+	if err := s.ValidateExportRequest(req); err != nil {
+		return 0, err
+	}
+
 	// 验证弹窗是否存在
 	var popup models.Popup
-	if err := s.db.First(&popup, popupID).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&popup, req.PopupID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("popup not found")
+			return 0, errors.New("popup not found")
 		}
-		return nil, err
+		return 0, err
 	}
 
-	// 获取所有提交数据
-	var submissions []*models.Submission
-	if err := s.db.Where("popup_id = ?", popupID).Order("created_at DESC").Find(&submissions).Error; err != nil {
-		return nil, err
+	query := s.exportQuery(ctx, req)
+	var table tableWriter
+	var columns []exportColumn
+	if req.Format != ExportFormatJSON {
+		var keys []string
+		if err := query.Where("jsonb_typeof(form_data) = 'object'").
+			Distinct().Pluck("jsonb_object_keys(form_data)", &keys).Error; err != nil {
+			return 0, fmt.Errorf("failed to load form fields: %w", err)
+		}
+		columns = s.exportColumns(&popup, keys, req.Columns)
+
+		var err error
+		if req.Format == ExportFormatXLSX {
+			table, err = xlsx.NewWriter(w, popup.Title)
+		} else {
+			table, err = newCSVTableWriter(w, req.BOM)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := table.WriteHeader(exportHeaders(columns)); err != nil {
+			return 0, err
+		}
 	}
 
-	// 根据格式导出数据
-	switch format {
-	case "json":
-		return json.MarshalIndent(submissions, "", "  ")
-	case "csv":
-		return s.exportToCSV(submissions)
-	default:
-		return nil, errors.New("unsupported export format")
+	rows, err := query.Order("created_at DESC").Rows()
+	if err != nil {
+		return 0, err
 	}
-}
+	defer rows.Close()
+
+	var count int64
+	if table == nil {
+		if _, err := io.WriteString(w, "["); err != nil {
+			return 0, err
+		}
+	}
+	for rows.Next() {
+		var submission models.Submission
+		if err := s.db.ScanRows(rows, &submission); err != nil {
+			return count, err
+		}
+		if req.Decrypt {
+			if err := s.encryption.RevealSubmission(&submission); err != nil {
+				return count, fmt.Errorf("submission %s: %w", submission.ID, err)
+			}
+		} else {
+			maskSubmission(&submission)
+		}
+
+		if table == nil {
+			if err := writeJSONElement(w, &submission, count == 0); err != nil {
+				return count, err
+			}
+		} else if err := table.WriteRow(s.exportRow(&submission, columns)); err != nil {
+			return count, err
+		}
 
-// exportToCSV 导出为CSV格式
-func (s *SubmissionExportService) exportToCSV(submissions []*models.Submission) ([]byte, error) {
-	if len(submissions) == 0 {
-		return []byte("id,popup_id,form_data,user_agent,user_ip,referrer_url,created_at\n"), nil
+		count++
+		if progress != nil && count%exportProgressInterval == 0 {
+			if err := progress(count); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
 	}
 
-	// CSV头部
-	csv := "id,popup_id,form_data,user_agent,user_ip,referrer_url,created_at\n"
+	if table != nil {
+		return count, table.Close()
+	}
+	closing := "]"
+	if count > 0 {
+		closing = "\n]"
+	}
+	_, err = io.WriteString(w, closing)
+	return count, err
+}
 
-	// 添加数据行
-	for _, submission := range submissions {
-		line := fmt.Sprintf("%d,%s,\"%s\",\"%s\",\"%s\",\"%s\",%s\n",
-			submission.ID,
-			submission.PopupID.String(),
-			escapeCSVField(submission.FormData),
-			escapeCSVField(submission.UserAgent),
-			escapeCSVField(submission.UserIP),
-			escapeCSVField(submission.ReferrerURL),
-			submission.CreatedAt.Format("2006-01-02 15:04:05"),
-		)
-		csv += line
+// writeJSONElement 写入JSON数组的一个元素，格式与 json.MarshalIndent(list, "", "  ") 一致
+func writeJSONElement(w io.Writer, value interface{}, first bool) error {
+	data, err := json.MarshalIndent(value, "  ", "  ")
+	if err != nil {
+		return err
 	}
+	separator := ",\n  "
+	if first {
+		separator = "\n  "
+	}
+	if _, err := io.WriteString(w, separator); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
 
-	return []byte(csv), nil
+// exportQuery 返回符合导出条件的提交记录查询，可以重复使用
+func (s *SubmissionExportService) exportQuery(ctx context.Context, req *ExportSubmissionsRequest) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&models.Submission{}).Where("popup_id = ?", req.PopupID)
+	if start, err := time.ParseInLocation(exportDateLayout, req.StartDate, time.Local); err == nil {
+		query = query.Where("created_at >= ?", start)
+	}
+	if end, err := time.ParseInLocation(exportDateLayout, req.EndDate, time.Local); err == nil {
+		query = query.Where("created_at < ?", end.AddDate(0, 0, 1))
+	}
+	return query.Session(&gorm.Session{})
 }
 
-// escapeCSVField 转义CSV字段中的特殊字符
-func escapeCSVField(field string) string {
-	// 替换双引号为两个双引号（CSV标准转义方式）
-	escaped := ""
-	for _, char := range field {
-		if char == '"' {
-			escaped += "\"\""
+// exportColumns 返回表单字段列，keys 为提交数据中出现过的字段名
+func (s *SubmissionExportService) exportColumns(popup *models.Popup, keys []string, mode string) []exportColumn {
+	var columns []exportColumn
+	seen := make(map[string]bool)
+
+	if mode != ExportColumnsUnion {
+		form, err := popupspec.ParseFormConfig(popup.FormConfig)
+		if err != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"popup_id": popup.ID,
+				"error":    err.Error(),
+			}).Warn("Failed to parse popup form config for export, falling back to submitted fields")
 		} else {
-			escaped += string(char)
+			for _, step := range form.StepList() {
+				for _, field := range step.Fields {
+					if seen[field.Name] {
+						continue
+					}
+					seen[field.Name] = true
+					title := field.Label
+					if title == "" {
+						title = field.Name
+					}
+					columns = append(columns, exportColumn{key: field.Name, title: title})
+				}
+			}
 		}
 	}
-	return escaped
+
+	// 表单配置中没有的字段（配置修改前提交的字段或通过API创建的提交）按名称排序追加
+	extra := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		columns = append(columns, exportColumn{key: key, title: key})
+	}
+	return columns
 }
 
-// ExportSubmissionsByDateRange 按日期范围导出提交数据
-func (s *SubmissionExportService) ExportSubmissionsByDateRange(popupID uuid.UUID, startDate, endDate string, format string) ([]byte, error) {
-	// 验证弹窗是否存在
-	var popup models.Popup
-	if err := s.db.First(&popup, popupID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("popup not found")
+// exportHeaders 返回表头，表单字段的标题与其他列重复时附加字段名
+func exportHeaders(columns []exportColumn) []string {
+	headers := append([]string(nil), exportBaseColumns...)
+	used := make(map[string]bool, len(headers)+len(columns))
+	for _, header := range headers {
+		used[header] = true
+	}
+	for _, column := range columns {
+		title := column.title
+		if used[title] && title != column.key {
+			title = column.title + " (" + column.key + ")"
 		}
-		return nil, err
+		if used[title] {
+			title = "form_data." + column.key
+		}
+		used[title] = true
+		headers = append(headers, title)
 	}
+	return headers
+}
 
-	// 获取指定日期范围的提交数据
-	var submissions []*models.Submission
-	query := s.db.Where("popup_id = ?", popupID)
+// exportRow 把一条提交记录转换为表格的一行
+func (s *SubmissionExportService) exportRow(submission *models.Submission, columns []exportColumn) []interface{} {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(submission.FormData), &data); err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"submission_id": submission.ID,
+			"error":         err.Error(),
+		}).Warn("Failed to parse submission form data for export")
+	}
 
-	if startDate != "" {
-		query = query.Where("created_at >= ?", startDate)
+	var variantID interface{}
+	if submission.VariantID != nil {
+		variantID = submission.VariantID.String()
+	}
+	var completedAt interface{}
+	if submission.CompletedAt != nil {
+		completedAt = *submission.CompletedAt
 	}
+	row := make([]interface{}, 0, len(exportBaseColumns)+len(columns))
+	row = append(row,
+		submission.ID.String(),
+		submission.PopupID.String(),
+		variantID,
+		submission.VisitorID,
+		submission.SessionID,
+		submission.IsPartial,
+		submission.LastStep,
+		submission.CreatedAt,
+		completedAt,
+		submission.UserIP,
+		submission.UserAgent,
+		submission.ReferrerURL,
+	)
+	for _, column := range columns {
+		row = append(row, exportValue(data[column.key]))
+	}
+	return row
+}
 
-	if endDate != "" {
-		query = query.Where("created_at <= ?", endDate+" 23:59:59")
+// exportValue 把表单字段值转换为单元格的值
+//
+// 文件字段导出文件名，简单值组成的数组以逗号连接，其他对象和数组导出为JSON
+func exportValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, float64:
+		return v
+	case map[string]interface{}:
+		if id := popupspec.FileID(v); id != "" {
+			if name, ok := v["name"].(string); ok && name != "" {
+				return name
+			}
+			return id
+		}
+	case []interface{}:
+		if joined, ok := joinScalars(v); ok {
+			return joined
+		}
 	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
 
-	if err := query.Order("created_at DESC").Find(&submissions).Error; err != nil {
-		return nil, err
+// joinScalars 以逗号连接数组中的简单值，数组包含对象或嵌套数组时返回 false
+func joinScalars(values []interface{}) (string, bool) {
+	parts := make([]string, 0, len(values))
+	for _, item := range values {
+		switch item := item.(type) {
+		case string:
+			parts = append(parts, item)
+		case bool:
+			parts = append(parts, strconv.FormatBool(item))
+		case float64:
+			parts = append(parts, strconv.FormatFloat(item, 'f', -1, 64))
+		default:
+			return "", false
+		}
 	}
+	return strings.Join(parts, ", "), true
+}
 
-	// 根据格式导出数据
-	switch format {
-	case "json":
-		return json.MarshalIndent(submissions, "", "  ")
-	case "csv":
-		return s.exportToCSV(submissions)
-	default:
-		return nil, errors.New("unsupported export format")
+// csvTableWriter CSV格式的行写入器
+type csvTableWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+// newCSVTableWriter 创建CSV写入器，bom 为 true 时先写入UTF-8 BOM
+func newCSVTableWriter(w io.Writer, bom bool) (*csvTableWriter, error) {
+	if bom {
+		if _, err := io.WriteString(w, utf8BOM); err != nil {
+			return nil, err
+		}
+	}
+	return &csvTableWriter{w: csv.NewWriter(w)}, nil
+}
+
+// WriteHeader 写入表头
+func (c *csvTableWriter) WriteHeader(titles []string) error {
+	return c.w.Write(titles)
+}
+
+// WriteRow 写入一行
+func (c *csvTableWriter) WriteRow(values []interface{}) error {
+	c.record = c.record[:0]
+	for _, value := range values {
+		c.record = append(c.record, csvCell(value))
+	}
+	return c.w.Write(c.record)
+}
+
+// Close 写出缓冲的内容
+func (c *csvTableWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvCell 把单元格的值格式化为CSV文本
+//
+// 以 = + - @ 或制表符、回车开头的文本会被电子表格当作公式执行，加上单引号前缀作为普通文本显示
+func csvCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(exportTimeLayout)
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
 	}
+	return fmt.Sprint(value)
 }
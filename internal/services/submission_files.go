@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/popupspec"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UploadFormFile 保存代理页面上传的表单文件
+//
+// 访客选择文件后页面脚本立即上传，得到的文件ID作为字段值随步骤提交。文件提交前不属于任何提交记录，
+// 未被引用的上传文件可以通过文件清理删除
+func (s *SubmissionCRUDService) UploadFormFile(req *FormFileUploadRequest) (*FormFileResult, error) {
+	if s.files == nil {
+		return nil, &InputError{Message: "file uploads are not enabled"}
+	}
+	if req.VisitorID == "" {
+		return nil, &InputError{Message: "visitor not identified"}
+	}
+	if err := s.guard.CheckUpload(req); err != nil {
+		return nil, err
+	}
+
+	popup, err := s.findProxyPopup(req.PopupID, req.ProxyConfigID)
+	if err != nil {
+		return nil, err
+	}
+	form, err := popupspec.ParseFormConfig(popup.FormConfig)
+	if err != nil {
+		return nil, fmt.Errorf("popup form config is invalid: %w", err)
+	}
+	field := form.FindField(req.Field)
+	if field == nil || field.Type != popupspec.FieldFile {
+		return nil, &InputError{Message: "file field not found"}
+	}
+
+	popupID := popup.ID
+	file, err := s.files.Upload(&UploadFileRequest{
+		Reader:    req.Reader,
+		Filename:  req.Filename,
+		Size:      req.Size,
+		Category:  FileCategoryForm,
+		PopupID:   &popupID,
+		FieldName: field.Name,
+		VisitorID: req.VisitorID,
+		MaxSize:   field.FileMaxSize(),
+		Accept:    field.AcceptsType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &FormFileResult{
+		FileID:      file.ID,
+		Name:        file.OriginalName,
+		Size:        file.Size,
+		ContentType: file.ContentType,
+	}, nil
+}
+
+// resolveFormFiles 校验步骤中文件字段引用的文件，并把字段值替换为包含文件名、大小和类型的对象
+//
+// 只能引用同一访客为该弹窗字段上传、且未被其他提交记录引用的文件，返回引用的文件ID
+func (s *SubmissionCRUDService) resolveFormFiles(tx *gorm.DB, step *popupspec.FormStep, req *SubmitFormStepRequest, data map[string]interface{}, submissionID *uuid.UUID) ([]uuid.UUID, error) {
+	if step == nil {
+		return nil, nil
+	}
+	var ids []uuid.UUID
+	for i := range step.Fields {
+		field := &step.Fields[i]
+		if field.Type != popupspec.FieldFile {
+			continue
+		}
+		id := popupspec.FileID(data[field.Name])
+		if id == "" {
+			continue
+		}
+
+		query := tx.Where("id = ? AND category = ? AND popup_id = ? AND visitor_id = ? AND field_name = ?",
+			id, FileCategoryForm, req.PopupID, req.VisitorID, field.Name)
+		if submissionID != nil {
+			query = query.Where("submission_id IS NULL OR submission_id = ?", *submissionID)
+		} else {
+			query = query.Where("submission_id IS NULL")
+		}
+		var file models.File
+		if err := query.First(&file).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				name := field.Label
+				if name == "" {
+					name = field.Name
+				}
+				return nil, &InputError{Message: fmt.Sprintf("%s must be an uploaded file", name)}
+			}
+			return nil, err
+		}
+
+		data[field.Name] = map[string]interface{}{
+			popupspec.FileIDKey: file.ID.String(),
+			"name":              file.OriginalName,
+			"size":              file.Size,
+			"content_type":      file.ContentType,
+		}
+		ids = append(ids, file.ID)
+	}
+	return ids, nil
+}
+
+// linkFormFiles 把步骤引用的文件关联到提交记录，并取消该步骤中已被替换的文件的关联
+func (s *SubmissionCRUDService) linkFormFiles(tx *gorm.DB, submissionID uuid.UUID, step *popupspec.FormStep, ids []uuid.UUID) error {
+	if step == nil {
+		return nil
+	}
+	var names []string
+	for _, field := range step.Fields {
+		if field.Type == popupspec.FieldFile {
+			names = append(names, field.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	unlink := tx.Model(&models.File{}).Where("submission_id = ? AND field_name IN ?", submissionID, names)
+	if len(ids) > 0 {
+		unlink = unlink.Where("id NOT IN ?", ids)
+	}
+	if err := unlink.Update("submission_id", nil).Error; err != nil {
+		return fmt.Errorf("failed to update form files: %w", err)
+	}
+	if len(ids) > 0 {
+		if err := tx.Model(&models.File{}).Where("id IN ?", ids).Update("submission_id", submissionID).Error; err != nil {
+			return fmt.Errorf("failed to update form files: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"proxy-enhancer-ultra/internal/fieldcrypt"
+	"proxy-enhancer-ultra/internal/popupspec"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// submissionValuesExpr 表单数据所有字段值组成的JSON文本，全文搜索使用该表达式上的trigram索引，
+// 必须与迁移中创建索引的表达式一致
+const submissionValuesExpr = "(jsonb_path_query_array(form_data, '$.*')::text)"
+
+// 提交列表查询的限制
+const (
+	maxSubmissionFieldFilters = 10  // 表单字段条件的数量上限
+	maxSubmissionFilterValue  = 200 // 搜索文本和字段条件值的最大长度（字符）
+)
+
+// submissionSortColumns 可以排序的提交记录列
+var submissionSortColumns = []string{"created_at", "updated_at", "completed_at", "processed_at", "status"}
+
+// submissionFieldOps 表单字段条件支持的比较方式
+var submissionFieldOps = []string{
+	FieldOpEq, FieldOpContains, FieldOpPrefix, FieldOpExists,
+	FieldOpGt, FieldOpGte, FieldOpLt, FieldOpLte,
+}
+
+// submissionRangeOps 范围比较方式对应的jsonpath运算符
+var submissionRangeOps = map[string]string{
+	FieldOpGt:  ">",
+	FieldOpGte: ">=",
+	FieldOpLt:  "<",
+	FieldOpLte: "<=",
+}
+
+// ParseSubmissionFieldFilter 解析 字段:比较方式[:值] 格式的表单字段条件，例如 phone:prefix:138、company:exists
+func ParseSubmissionFieldFilter(value string) (SubmissionFieldFilter, error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) < 2 {
+		return SubmissionFieldFilter{}, fmt.Errorf("invalid field filter %q, expected field:op:value", value)
+	}
+	filter := SubmissionFieldFilter{Field: strings.TrimSpace(parts[0]), Op: strings.TrimSpace(parts[1])}
+	if len(parts) == 3 {
+		filter.Value = parts[2]
+	}
+	return filter, filter.Validate()
+}
+
+// Validate 校验表单字段条件
+func (f SubmissionFieldFilter) Validate() error {
+	if !popupspec.ValidFieldName(f.Field) {
+		return fmt.Errorf("invalid field name %q", f.Field)
+	}
+	if !slices.Contains(submissionFieldOps, f.Op) {
+		return fmt.Errorf("invalid operator %q for field %s, expected one of %s", f.Op, f.Field, strings.Join(submissionFieldOps, ", "))
+	}
+	if f.Op != FieldOpExists && f.Value == "" {
+		return fmt.Errorf("value is required for field %s", f.Field)
+	}
+	if len([]rune(f.Value)) > maxSubmissionFilterValue {
+		return fmt.Errorf("value for field %s must be at most %d characters", f.Field, maxSubmissionFilterValue)
+	}
+	return nil
+}
+
+// Validate 校验提交列表查询条件
+func (f *SubmissionFilter) Validate() error {
+	for _, status := range f.Status {
+		if !slices.Contains(SubmissionStatuses, status) {
+			return fmt.Errorf("invalid submission status %q", status)
+		}
+	}
+	if len([]rune(f.Search)) > maxSubmissionFilterValue {
+		return fmt.Errorf("search must be at most %d characters", maxSubmissionFilterValue)
+	}
+	if len(f.Fields) > maxSubmissionFieldFilters {
+		return fmt.Errorf("at most %d field filters are allowed", maxSubmissionFieldFilters)
+	}
+	for _, field := range f.Fields {
+		if err := field.Validate(); err != nil {
+			return err
+		}
+	}
+	if f.IP != "" && net.ParseIP(f.IP) == nil {
+		if _, _, err := net.ParseCIDR(f.IP); err != nil {
+			return errors.New("ip must be an IP address or CIDR range")
+		}
+	}
+	if f.Sort != "" {
+		column := strings.TrimPrefix(f.Sort, "-")
+		if field, ok := strings.CutPrefix(column, "form."); ok {
+			if !popupspec.ValidFieldName(field) {
+				return fmt.Errorf("invalid sort field name %q", field)
+			}
+		} else if !slices.Contains(submissionSortColumns, column) {
+			return fmt.Errorf("invalid sort %q, expected one of %s or form.<field>", f.Sort, strings.Join(submissionSortColumns, ", "))
+		}
+	}
+	return nil
+}
+
+// applySubmissionFilter 把查询条件添加到提交记录查询中，调用前应先校验条件
+func applySubmissionFilter(query *gorm.DB, filter *SubmissionFilter) (*gorm.DB, error) {
+	if filter.PopupID != nil {
+		query = query.Where("popup_id = ?", *filter.PopupID)
+	}
+
+	if filter.StartDate != nil {
+		query = query.Where("created_at >= ?", *filter.StartDate)
+	}
+
+	if filter.EndDate != nil {
+		query = query.Where("created_at <= ?", *filter.EndDate)
+	}
+
+	if len(filter.Status) > 0 {
+		query = query.Where("status IN ?", filter.Status)
+	}
+
+	if filter.Processed != nil {
+		if *filter.Processed {
+			query = query.Where("status <> ?", SubmissionStatusNew)
+		} else {
+			query = query.Where("status = ?", SubmissionStatusNew)
+		}
+	}
+
+	if filter.Tag != "" {
+		tag, err := json.Marshal([]string{filter.Tag})
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("tags @> ?::jsonb", string(tag))
+	}
+
+	if filter.AssigneeID != nil {
+		query = query.Where("assignee_id = ?", *filter.AssigneeID)
+	} else if filter.Unassigned {
+		query = query.Where("assignee_id IS NULL")
+	}
+
+	if filter.Search != "" {
+		query = query.Where(submissionValuesExpr+" ILIKE ?", "%"+jsonLikePattern(filter.Search)+"%")
+	}
+
+	for _, field := range filter.Fields {
+		var err error
+		if query, err = applySubmissionFieldFilter(query, field); err != nil {
+			return nil, err
+		}
+	}
+
+	if filter.IP != "" {
+		query = query.Where("user_ip <<= ?::inet", filter.IP)
+	}
+
+	if filter.Referrer != "" {
+		query = query.Where("referrer_url ILIKE ?", "%"+likeEscape(filter.Referrer)+"%")
+	}
+
+	if filter.UserAgent != "" {
+		query = query.Where("user_agent ILIKE ?", "%"+likeEscape(filter.UserAgent)+"%")
+	}
+
+	return query, nil
+}
+
+// applySubmissionFieldFilter 添加一个表单字段条件
+//
+// eq 和 exists 使用表单数据上的GIN索引，eq 通过盲索引匹配加密的敏感字段；contains 和 prefix 先用字段值全文的trigram索引筛选，
+// 再比较该字段的值；范围比较通过 jsonpath 进行，字段值不是数字时不匹配数字条件。
+// 字段名已校验只包含字母、数字、_ 和 -，可以直接写入 jsonpath
+func applySubmissionFieldFilter(query *gorm.DB, field SubmissionFieldFilter) (*gorm.DB, error) {
+	path := `$."` + field.Field + `"`
+
+	switch field.Op {
+	case FieldOpEq:
+		candidates, err := submissionEqualCandidates(field.Field, field.Value)
+		if err != nil {
+			return nil, err
+		}
+		if field.blindIndex != "" {
+			encrypted, err := json.Marshal(map[string]interface{}{
+				field.Field: map[string]string{fieldcrypt.IndexKey: field.blindIndex},
+			})
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, string(encrypted))
+		}
+		conditions := make([]string, len(candidates))
+		vars := make([]interface{}, len(candidates))
+		for i, candidate := range candidates {
+			conditions[i] = "form_data @> ?::jsonb"
+			vars[i] = candidate
+		}
+		return query.Where("("+strings.Join(conditions, " OR ")+")", vars...), nil
+	case FieldOpExists:
+		// @? 运算符中的问号会被当作参数占位符，路径直接写入SQL
+		return query.Where("form_data @? '" + path + "'::jsonpath"), nil
+	case FieldOpContains:
+		pattern := "%" + likeEscape(field.Value) + "%"
+		return query.Where(submissionValuesExpr+" ILIKE ? AND form_data ->> ? ILIKE ?",
+			"%"+jsonLikePattern(field.Value)+"%", field.Field, pattern), nil
+	case FieldOpPrefix:
+		pattern := likeEscape(field.Value) + "%"
+		return query.Where(submissionValuesExpr+" ILIKE ? AND form_data ->> ? ILIKE ?",
+			"%"+jsonLikePattern(field.Value)+"%", field.Field, pattern), nil
+	}
+
+	op := submissionRangeOps[field.Op]
+	var value interface{} = field.Value
+	if number, ok := submissionNumber(field.Value); ok {
+		// 数字条件同时匹配数字和数字文本的字段值
+		path += " ? (@.double() " + op + " $v)"
+		value = number
+	} else {
+		path += " ? (@ " + op + " $v)"
+	}
+	vars, err := json.Marshal(map[string]interface{}{"v": value})
+	if err != nil {
+		return nil, err
+	}
+	return query.Where("jsonb_path_exists(form_data, ?::jsonpath, ?::jsonb, true)", path, string(vars)), nil
+}
+
+// submissionEqualCandidates 返回 eq 条件的包含匹配文档：文本值、多选字段中包含该值，
+// 以及值可以解析为数字或布尔值时的对应类型
+func submissionEqualCandidates(field, value string) ([]string, error) {
+	values := []interface{}{value, []string{value}}
+	if number, ok := submissionNumber(value); ok {
+		values = append(values, number)
+	}
+	if b, err := strconv.ParseBool(value); err == nil && (value == "true" || value == "false") {
+		values = append(values, b)
+	}
+	candidates := make([]string, 0, len(values))
+	for _, v := range values {
+		data, err := json.Marshal(map[string]interface{}{field: v})
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, string(data))
+	}
+	return candidates, nil
+}
+
+// submissionNumber 把符合JSON数字格式的值解析为数字
+func submissionNumber(value string) (json.Number, bool) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", false
+	}
+	var number json.Number
+	if json.Unmarshal([]byte(value), &number) != nil {
+		return "", false
+	}
+	return number, true
+}
+
+// submissionOrder 返回排序条件，相同时按创建时间和ID倒序
+func submissionOrder(sort string) interface{} {
+	if sort == "" {
+		return "created_at DESC, id DESC"
+	}
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+	if field, ok := strings.CutPrefix(sort, "form."); ok {
+		return clause.OrderBy{Expression: clause.Expr{
+			SQL:  "form_data ->> ? " + direction + " NULLS LAST, created_at DESC, id DESC",
+			Vars: []interface{}{field},
+		}}
+	}
+	return sort + " " + direction + " NULLS LAST, created_at DESC, id DESC"
+}
+
+// jsonLikePattern 把文本转换为字段值在JSON文本中的写法并转义LIKE通配符，用于在 submissionValuesExpr 中匹配
+func jsonLikePattern(value string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return likeEscape(value)
+	}
+	encoded := strings.TrimSuffix(buf.String(), "\n")
+	return likeEscape(encoded[1 : len(encoded)-1])
+}
+
+// likeEscape 转义 LIKE 模式中的通配符和转义字符
+func likeEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
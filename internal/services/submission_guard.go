@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"proxy-enhancer-ultra/internal/config"
+	"proxy-enhancer-ultra/internal/formguard"
+	"proxy-enhancer-ultra/internal/popupspec"
+	"proxy-enhancer-ultra/pkg/logger"
+)
+
+// 提交被防护拒绝的原因，记录在日志中
+const (
+	RejectRateLimited  = "rate_limited"  // 超过IP或弹窗的提交频率
+	RejectHoneypot     = "honeypot"      // 填写了访客看不到的蜜罐字段
+	RejectInvalidToken = "invalid_token" // 表单令牌缺失、签名错误或与弹窗、访客不匹配
+	RejectExpiredToken = "expired_token" // 表单令牌已过期
+	RejectTooFast      = "too_fast"      // 页面加载后过快提交
+	RejectCaptcha      = "captcha"       // 验证码错误或缺失
+	RejectUnknownIP    = "unknown_ip"    // 无法识别客户端IP，不能按IP限流
+)
+
+// captchaTTL 图片验证码的有效期
+const captchaTTL = 10 * time.Minute
+
+// SubmissionRejectedError 被防护拒绝的提交，Message 返回给访客，Reason 只写入日志
+type SubmissionRejectedError struct {
+	Reason  string
+	Message string
+}
+
+// Error 返回给访客的提示
+func (e *SubmissionRejectedError) Error() string {
+	return e.Message
+}
+
+// IsRateLimited 判断是否因提交频率被拒绝
+func (e *SubmissionRejectedError) IsRateLimited() bool {
+	return e.Reason == RejectRateLimited
+}
+
+// AsSubmissionRejected 返回被防护拒绝的错误，其他错误返回nil
+func AsSubmissionRejected(err error) *SubmissionRejectedError {
+	var rejected *SubmissionRejectedError
+	if errors.As(err, &rejected) {
+		return rejected
+	}
+	return nil
+}
+
+// SubmissionGuard 代理页面表单提交的防护：蜜罐字段、注入时签发的表单令牌、最短填写时间、按IP和弹窗限流以及可选的验证码
+//
+// 限流计数保存在进程内存中，多实例部署时每个实例分别计数
+type SubmissionGuard struct {
+	logger       logger.Logger
+	settings     config.SubmissionGuardConfig
+	signer       *formguard.Signer
+	captchas     *formguard.CaptchaStore
+	ipLimiter    *formguard.RateLimiter
+	popupLimiter *formguard.RateLimiter
+}
+
+// NewSubmissionGuard 创建提交防护，令牌密钥与代理服务器签发令牌使用的密钥相同
+func NewSubmissionGuard(cfg *config.Config, logger logger.Logger) *SubmissionGuard {
+	var settings config.SubmissionGuardConfig
+	var secret []byte
+	if cfg != nil {
+		settings = cfg.Security.Submissions
+		secret = cfg.FormTokenSecret()
+	}
+	return &SubmissionGuard{
+		logger:       logger,
+		settings:     settings.WithDefaults(),
+		signer:       formguard.NewSigner(secret),
+		captchas:     formguard.NewCaptchaStore(captchaTTL),
+		ipLimiter:    formguard.NewRateLimiter(time.Minute),
+		popupLimiter: formguard.NewRateLimiter(time.Minute),
+	}
+}
+
+// NewCaptcha 生成图片验证码
+func (g *SubmissionGuard) NewCaptcha() (*formguard.Captcha, error) {
+	return g.captchas.Generate()
+}
+
+// CheckRate 按IP和弹窗限流，在读取数据库之前调用
+func (g *SubmissionGuard) CheckRate(req *SubmitFormStepRequest) error {
+	if g == nil {
+		return nil
+	}
+	if req.IPAddress == "" {
+		return g.reject(req, RejectUnknownIP, "submission rejected")
+	}
+	now := time.Now()
+	if !g.ipLimiter.Allow(req.IPAddress, g.settings.IPLimit, now) {
+		return g.reject(req, RejectRateLimited, "too many submissions, please try again later")
+	}
+	if !g.popupLimiter.Allow(req.PopupID.String(), g.settings.PopupLimit, now) {
+		return g.reject(req, RejectRateLimited, "too many submissions, please try again later")
+	}
+	return nil
+}
+
+// CheckForm 校验蜜罐字段、表单令牌和最短填写时间，表单使用工作量证明时在完成表单的步骤校验
+func (g *SubmissionGuard) CheckForm(req *SubmitFormStepRequest, form *popupspec.FormConfig, completing bool) error {
+	if g == nil {
+		return nil
+	}
+	if req.Honeypot != "" {
+		return g.reject(req, RejectHoneypot, "submission rejected")
+	}
+
+	now := time.Now()
+	claims, err := g.verifyToken(req, now)
+	if err != nil {
+		return err
+	}
+	if now.Sub(claims.Issued()) < g.settings.MinFillTime {
+		return g.reject(req, RejectTooFast, "form submitted too quickly, please try again")
+	}
+
+	if completing && form.Captcha == popupspec.CaptchaProofOfWork {
+		if claims.Challenge == "" || !formguard.CheckProofOfWork(claims.Challenge, claims.Difficulty, req.ProofOfWork) {
+			return g.reject(req, RejectCaptcha, "captcha verification failed, please try again")
+		}
+	}
+	return nil
+}
+
+// CheckUpload 校验表单文件上传：按IP和弹窗限流并校验表单令牌，访客选择文件后立即上传，不检查最短填写时间
+func (g *SubmissionGuard) CheckUpload(req *FormFileUploadRequest) error {
+	if g == nil {
+		return nil
+	}
+	subject := &SubmitFormStepRequest{
+		PopupID:       req.PopupID,
+		Step:          req.Field,
+		FormToken:     req.FormToken,
+		ProxyConfigID: req.ProxyConfigID,
+		VisitorID:     req.VisitorID,
+		IPAddress:     req.IPAddress,
+		UserAgent:     req.UserAgent,
+	}
+	if err := g.CheckRate(subject); err != nil {
+		return err
+	}
+	_, err := g.verifyToken(subject, time.Now())
+	return err
+}
+
+// verifyToken 校验表单令牌的签名、有效期以及签发时的弹窗和访客
+func (g *SubmissionGuard) verifyToken(req *SubmitFormStepRequest, now time.Time) (*formguard.Claims, error) {
+	claims, err := g.signer.Verify(req.FormToken, g.settings.TokenTTL, now)
+	if errors.Is(err, formguard.ErrExpiredToken) {
+		return nil, g.reject(req, RejectExpiredToken, "form expired, please reload the page")
+	}
+	if err != nil || claims.PopupID != req.PopupID.String() || (claims.VisitorID != "" && claims.VisitorID != req.VisitorID) {
+		return nil, g.reject(req, RejectInvalidToken, "form expired, please reload the page")
+	}
+	return claims, nil
+}
+
+// CheckCaptcha 表单使用图片验证码时在完成表单的步骤校验，验证码校验后失效，应在字段校验通过后调用
+func (g *SubmissionGuard) CheckCaptcha(req *SubmitFormStepRequest, form *popupspec.FormConfig, completing bool) error {
+	if g == nil || !completing || form.Captcha != popupspec.CaptchaImage {
+		return nil
+	}
+	if !g.captchas.Verify(req.CaptchaID, req.CaptchaAnswer) {
+		return g.reject(req, RejectCaptcha, "captcha verification failed, please try again")
+	}
+	return nil
+}
+
+// reject 记录被拒绝的提交并返回错误
+func (g *SubmissionGuard) reject(req *SubmitFormStepRequest, reason, message string) error {
+	g.logger.WithFields(map[string]interface{}{
+		"popup_id":        req.PopupID,
+		"proxy_config_id": req.ProxyConfigID,
+		"visitor_id":      req.VisitorID,
+		"ip":              req.IPAddress,
+		"user_agent":      req.UserAgent,
+		"step":            req.Step,
+		"reason":          reason,
+	}).Warn("Popup form submission rejected")
+	return &SubmissionRejectedError{Reason: reason, Message: message}
+}
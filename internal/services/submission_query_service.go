@@ -2,6 +2,8 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	"proxy-enhancer-ultra/internal/models"
@@ -13,37 +15,40 @@ import (
 
 // SubmissionQueryService 提交记录查询服务
 type SubmissionQueryService struct {
-	db     *gorm.DB
-	logger logger.Logger
+	db         *gorm.DB
+	logger     logger.Logger
+	encryption *EncryptionService
 }
 
-// NewSubmissionQueryService 创建新的提交查询服务
-func NewSubmissionQueryService(db *gorm.DB, logger logger.Logger) *SubmissionQueryService {
+// NewSubmissionQueryService 创建新的提交查询服务，encryption 用于按敏感字段的值查找
+func NewSubmissionQueryService(db *gorm.DB, logger logger.Logger, encryption *EncryptionService) *SubmissionQueryService {
 	return &SubmissionQueryService{
-		db:     db,
-		logger: logger,
+		db:         db,
+		logger:     logger,
+		encryption: encryption,
 	}
 }
 
 // ListSubmissions 获取提交列表
-func (s *SubmissionQueryService) ListSubmissions(page, pageSize int, popupID *uuid.UUID, startDate, endDate *time.Time) ([]*models.Submission, int64, error) {
+func (s *SubmissionQueryService) ListSubmissions(page, pageSize int, filter *SubmissionFilter) ([]*models.Submission, int64, error) {
 	var submissions []*models.Submission
 	var total int64
 
-	// 构建查询
-	query := s.db.Model(&models.Submission{})
-
-	// 添加过滤条件
-	if popupID != nil {
-		query = query.Where("popup_id = ?", *popupID)
+	if filter == nil {
+		filter = &SubmissionFilter{}
 	}
-
-	if startDate != nil {
-		query = query.Where("created_at >= ?", *startDate)
+	if err := filter.Validate(); err != nil {
+		return nil, 0, invalidInput(err)
 	}
+	if err := s.checkEncryptedFields(filter); err != nil {
+		return nil, 0, err
+	}
+	filter = s.withBlindIndexes(filter)
 
-	if endDate != nil {
-		query = query.Where("created_at <= ?", *endDate)
+	// 构建查询
+	query, err := applySubmissionFilter(s.db.Model(&models.Submission{}), filter)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	// 获取总数
@@ -53,13 +58,52 @@ func (s *SubmissionQueryService) ListSubmissions(page, pageSize int, popupID *uu
 
 	// 分页查询
 	offset := (page - 1) * pageSize
-	if err := query.Preload("Popup").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&submissions).Error; err != nil {
+	if err := query.Preload("Popup").Order(submissionOrder(filter.Sort)).Offset(offset).Limit(pageSize).Find(&submissions).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return submissions, total, nil
 }
 
+// checkEncryptedFields 启用字段加密时，敏感字段的值以密文保存，只能使用 eq（通过盲索引）和 exists 条件
+func (s *SubmissionQueryService) checkEncryptedFields(filter *SubmissionFilter) error {
+	var names []string
+	for _, field := range filter.Fields {
+		if field.Op != FieldOpEq && field.Op != FieldOpExists {
+			names = append(names, field.Field)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sensitive, err := s.encryption.SensitiveFieldNames(filter.PopupID)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if slices.Contains(sensitive, name) {
+			return &InputError{Message: fmt.Sprintf("field %s is encrypted, only %s and %s filters are supported", name, FieldOpEq, FieldOpExists)}
+		}
+	}
+	return nil
+}
+
+// withBlindIndexes 返回为 eq 条件计算了盲索引的查询条件副本
+func (s *SubmissionQueryService) withBlindIndexes(filter *SubmissionFilter) *SubmissionFilter {
+	if !s.encryption.Enabled() || len(filter.Fields) == 0 {
+		return filter
+	}
+	copied := *filter
+	copied.Fields = append([]SubmissionFieldFilter(nil), filter.Fields...)
+	for i := range copied.Fields {
+		field := &copied.Fields[i]
+		if field.Op == FieldOpEq {
+			field.blindIndex, _ = s.encryption.BlindIndex(field.Field, field.Value)
+		}
+	}
+	return &copied
+}
+
 // GetSubmissionsByPopup 根据弹窗获取提交列表
 func (s *SubmissionQueryService) GetSubmissionsByPopup(popupID uuid.UUID) ([]*models.Submission, error) {
 	// 验证弹窗是否存在
@@ -109,11 +153,9 @@ func (s *SubmissionQueryService) SearchSubmissions(keyword string, popupID *uuid
 		query = query.Where("popup_id = ?", *popupID)
 	}
 
-	// 在表单数据、用户代理、IP地址中搜索关键词
+	// 在表单数据的字段值中搜索关键词
 	if keyword != "" {
-		searchPattern := "%" + keyword + "%"
-		query = query.Where("form_data LIKE ? OR user_agent LIKE ? OR user_ip LIKE ?",
-			searchPattern, searchPattern, searchPattern)
+		query = query.Where(submissionValuesExpr+" ILIKE ?", "%"+jsonLikePattern(keyword)+"%")
 	}
 
 	if err := query.Preload("Popup").Order("created_at DESC").Limit(limit).Find(&submissions).Error; err != nil {
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"errors"
 	"time"
 
+	"proxy-enhancer-ultra/internal/formguard"
 	"proxy-enhancer-ultra/internal/models"
 	"proxy-enhancer-ultra/pkg/logger"
 
@@ -16,23 +18,27 @@ type SubmissionService struct {
 	logger logger.Logger
 
 	// 组合的专门服务
-	crudService   *SubmissionCRUDService
-	queryService  *SubmissionQueryService
-	statsService  *SubmissionStatsService
-	exportService *SubmissionExportService
+	crudService     *SubmissionCRUDService
+	queryService    *SubmissionQueryService
+	statsService    *SubmissionStatsService
+	exportService   *SubmissionExportService
+	workflowService *SubmissionWorkflowService
+	encryption      *EncryptionService
 }
 
-// NewSubmissionService 创建新的提交服务
-func NewSubmissionService(db *gorm.DB, logger logger.Logger) *SubmissionService {
+// NewSubmissionService 创建新的提交服务，返回的提交记录中加密的敏感字段显示为脱敏文本
+func NewSubmissionService(db *gorm.DB, logger logger.Logger, guard *SubmissionGuard, files *FileService, webhooks *WebhookService, notifications *NotificationService, audit *AuditService, encryption *EncryptionService) *SubmissionService {
 	return &SubmissionService{
 		db:     db,
 		logger: logger,
 
 		// 初始化专门的服务
-		crudService:   NewSubmissionCRUDService(db, logger),
-		queryService:  NewSubmissionQueryService(db, logger),
-		statsService:  NewSubmissionStatsService(db, logger),
-		exportService: NewSubmissionExportService(db, logger),
+		crudService:     NewSubmissionCRUDService(db, logger, guard, files, webhooks, notifications, encryption),
+		queryService:    NewSubmissionQueryService(db, logger, encryption),
+		statsService:    NewSubmissionStatsService(db, logger),
+		exportService:   NewSubmissionExportService(db, logger, encryption),
+		workflowService: NewSubmissionWorkflowService(db, logger, audit),
+		encryption:      encryption,
 	}
 }
 
@@ -41,32 +47,44 @@ func NewSubmissionService(db *gorm.DB, logger logger.Logger) *SubmissionService
 
 // CreateSubmission 创建提交 - 委托给CRUD服务
 func (s *SubmissionService) CreateSubmission(req *CreateSubmissionRequest) (*models.Submission, error) {
-	return s.crudService.CreateSubmission(req)
+	return masked(s.crudService.CreateSubmission(req))
 }
 
 // GetSubmission 获取提交 - 委托给CRUD服务
-func (s *SubmissionService) GetSubmission(id uint) (*models.Submission, error) {
-	return s.crudService.GetSubmission(id)
+func (s *SubmissionService) GetSubmission(id uuid.UUID) (*models.Submission, error) {
+	return masked(s.crudService.GetSubmission(id))
+}
+
+// DecryptSubmission 获取敏感字段为原文的提交，需要解密权限 - 委托给字段加密服务
+func (s *SubmissionService) DecryptSubmission(id uuid.UUID, actor SubmissionActor) (*models.Submission, error) {
+	if !s.encryption.Enabled() {
+		return nil, errors.New("field encryption is not configured")
+	}
+	return s.encryption.DecryptSubmission(id, actor)
 }
 
 // UpdateSubmission 更新提交 - 委托给CRUD服务
-func (s *SubmissionService) UpdateSubmission(id uint, req *UpdateSubmissionRequest) error {
+func (s *SubmissionService) UpdateSubmission(id uuid.UUID, req *UpdateSubmissionRequest) error {
 	return s.crudService.UpdateSubmission(id, req)
 }
 
 // DeleteSubmission 删除提交 - 委托给CRUD服务
-func (s *SubmissionService) DeleteSubmission(id uint) error {
+func (s *SubmissionService) DeleteSubmission(id uuid.UUID) error {
 	return s.crudService.DeleteSubmission(id)
 }
 
 // ListSubmissions 获取提交列表 - 委托给查询服务
-func (s *SubmissionService) ListSubmissions(page, pageSize int, popupID *uuid.UUID, startDate, endDate *time.Time) ([]*models.Submission, int64, error) {
-	return s.queryService.ListSubmissions(page, pageSize, popupID, startDate, endDate)
+func (s *SubmissionService) ListSubmissions(page, pageSize int, filter *SubmissionFilter) ([]*models.Submission, int64, error) {
+	submissions, total, err := s.queryService.ListSubmissions(page, pageSize, filter)
+	maskSubmissions(submissions)
+	return submissions, total, err
 }
 
 // GetSubmissionsByPopup 根据弹窗获取提交列表 - 委托给查询服务
 func (s *SubmissionService) GetSubmissionsByPopup(popupID uuid.UUID) ([]*models.Submission, error) {
-	return s.queryService.GetSubmissionsByPopup(popupID)
+	submissions, err := s.queryService.GetSubmissionsByPopup(popupID)
+	maskSubmissions(submissions)
+	return submissions, err
 }
 
 // GetSubmissionStats 获取提交统计信息 - 委托给统计服务
@@ -74,17 +92,95 @@ func (s *SubmissionService) GetSubmissionStats(popupID uuid.UUID) (*SubmissionSt
 	return s.statsService.GetSubmissionStats(popupID)
 }
 
+// GetSourceBreakdown 按来源维度统计提交 - 委托给统计服务
+func (s *SubmissionService) GetSourceBreakdown(q *SourceAnalyticsQuery) (*SourceBreakdown, error) {
+	return s.statsService.GetSourceBreakdown(q)
+}
+
+// GetSourceTimeSeries 按时间段统计提交来源 - 委托给统计服务
+func (s *SubmissionService) GetSourceTimeSeries(q *SourceAnalyticsQuery) (*SourceTimeSeries, error) {
+	return s.statsService.GetSourceTimeSeries(q)
+}
+
 // GetSubmissionsByDateRange 根据日期范围获取提交 - 委托给查询服务
 func (s *SubmissionService) GetSubmissionsByDateRange(popupID uuid.UUID, startDate, endDate time.Time) ([]*models.Submission, error) {
-	return s.queryService.GetSubmissionsByDateRange(popupID, startDate, endDate)
+	submissions, err := s.queryService.GetSubmissionsByDateRange(popupID, startDate, endDate)
+	maskSubmissions(submissions)
+	return submissions, err
 }
 
 // ExportSubmissions 导出提交数据 - 委托给导出服务
-func (s *SubmissionService) ExportSubmissions(popupID uuid.UUID, format string) ([]byte, error) {
-	return s.exportService.ExportSubmissions(popupID, format)
+func (s *SubmissionService) ExportSubmissions(req *ExportSubmissionsRequest) ([]byte, error) {
+	return s.exportService.ExportSubmissions(req)
 }
 
 // DeleteSubmissionsByPopup 根据弹窗删除所有提交 - 委托给CRUD服务
 func (s *SubmissionService) DeleteSubmissionsByPopup(popupID uuid.UUID) error {
 	return s.crudService.DeleteSubmissionsByPopup(popupID)
 }
+
+// SubmitFormStep 保存代理页面提交的表单步骤 - 委托给CRUD服务
+func (s *SubmissionService) SubmitFormStep(req *SubmitFormStepRequest) (*FormStepResult, error) {
+	return s.crudService.SubmitFormStep(req)
+}
+
+// UploadFormFile 保存代理页面上传的表单文件 - 委托给CRUD服务
+func (s *SubmissionService) UploadFormFile(req *FormFileUploadRequest) (*FormFileResult, error) {
+	return s.crudService.UploadFormFile(req)
+}
+
+// NewCaptcha 生成弹窗表单和登录页使用的图片验证码 - 委托给CRUD服务
+func (s *SubmissionService) NewCaptcha() (*formguard.Captcha, error) {
+	return s.crudService.NewCaptcha()
+}
+
+// UpdateSubmissionStatus 更新提交的处理状态 - 委托给线索处理服务
+func (s *SubmissionService) UpdateSubmissionStatus(id uuid.UUID, status string, actor SubmissionActor) (*models.Submission, error) {
+	return masked(s.workflowService.UpdateStatus(id, status, actor))
+}
+
+// SetSubmissionTags 替换提交的全部标签 - 委托给线索处理服务
+func (s *SubmissionService) SetSubmissionTags(id uuid.UUID, tags []string, actor SubmissionActor) (*models.Submission, error) {
+	return masked(s.workflowService.SetTags(id, tags, actor))
+}
+
+// AssignSubmission 分配提交的负责人 - 委托给线索处理服务
+func (s *SubmissionService) AssignSubmission(id uuid.UUID, assigneeID *uuid.UUID, actor SubmissionActor) (*models.Submission, error) {
+	return masked(s.workflowService.Assign(id, assigneeID, actor))
+}
+
+// BatchUpdateSubmissionStatus 批量更新提交的处理状态 - 委托给线索处理服务
+func (s *SubmissionService) BatchUpdateSubmissionStatus(req *BatchUpdateSubmissionStatusRequest, actor SubmissionActor) (*BatchUpdateResult, error) {
+	return s.workflowService.BatchUpdateStatus(req, actor)
+}
+
+// BatchUpdateSubmissionTags 批量添加和移除提交标签 - 委托给线索处理服务
+func (s *SubmissionService) BatchUpdateSubmissionTags(req *BatchUpdateSubmissionTagsRequest, actor SubmissionActor) (*BatchUpdateResult, error) {
+	return s.workflowService.BatchUpdateTags(req, actor)
+}
+
+// BatchAssignSubmissions 批量分配提交的负责人 - 委托给线索处理服务
+func (s *SubmissionService) BatchAssignSubmissions(req *BatchAssignSubmissionsRequest, actor SubmissionActor) (*BatchUpdateResult, error) {
+	return s.workflowService.BatchAssign(req, actor)
+}
+
+// AddSubmissionNote 为提交添加内部备注 - 委托给线索处理服务
+func (s *SubmissionService) AddSubmissionNote(id uuid.UUID, body string, actor SubmissionActor) (*models.SubmissionNote, error) {
+	return s.workflowService.AddNote(id, body, actor)
+}
+
+// ListSubmissionNotes 获取提交的备注 - 委托给线索处理服务
+func (s *SubmissionService) ListSubmissionNotes(id uuid.UUID) ([]*models.SubmissionNote, error) {
+	return s.workflowService.ListNotes(id)
+}
+
+// ListSubmissionHistory 获取提交的处理历史 - 委托给线索处理服务
+func (s *SubmissionService) ListSubmissionHistory(id uuid.UUID, page, pageSize int) ([]*models.AuditLog, int64, error) {
+	return s.workflowService.ListHistory(id, page, pageSize)
+}
+
+// masked 把返回的提交记录中加密的敏感字段替换为脱敏文本
+func masked(submission *models.Submission, err error) (*models.Submission, error) {
+	maskSubmission(submission)
+	return submission, err
+}
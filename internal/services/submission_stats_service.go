@@ -11,6 +11,11 @@ import (
 	"gorm.io/gorm"
 )
 
+// leadStatsSelect 统计收到的提交总数、重复提交数和去重后的线索数，去重键只在同一弹窗内比较
+const leadStatsSelect = "COUNT(*) + COALESCE(SUM(duplicate_count), 0) AS raw_submissions, " +
+	"COALESCE(SUM(duplicate_count), 0) AS duplicate_submissions, " +
+	"COUNT(DISTINCT COALESCE(popup_id::text || NULLIF(dedup_key, ''), id::text)) FILTER (WHERE NOT is_partial) AS unique_leads"
+
 // SubmissionStatsService 提交统计服务
 type SubmissionStatsService struct {
 	db     *gorm.DB
@@ -45,6 +50,11 @@ func (s *SubmissionStatsService) GetSubmissionStats(popupID uuid.UUID) (*Submiss
 		return nil, err
 	}
 
+	// 获取去重后的线索数
+	if err := s.db.Model(&models.Submission{}).Select(leadStatsSelect).Where("popup_id = ?", popupID).Scan(&stats.LeadStats).Error; err != nil {
+		return nil, err
+	}
+
 	// 获取今日提交数
 	today := time.Now().Truncate(24 * time.Hour)
 	tomorrow := today.Add(24 * time.Hour)
@@ -91,6 +101,15 @@ func (s *SubmissionStatsService) GetOverallStats() (map[string]interface{}, erro
 	}
 	stats["total_submissions"] = totalSubmissions
 
+	// 去重后的线索数
+	var leads LeadStats
+	if err := s.db.Model(&models.Submission{}).Select(leadStatsSelect).Scan(&leads).Error; err != nil {
+		return nil, err
+	}
+	stats["raw_submissions"] = leads.RawSubmissions
+	stats["duplicate_submissions"] = leads.DuplicateSubmissions
+	stats["unique_leads"] = leads.UniqueLeads
+
 	// 今日提交数
 	today := time.Now().Truncate(24 * time.Hour)
 	tomorrow := today.Add(24 * time.Hour)
@@ -146,18 +165,120 @@ func (s *SubmissionStatsService) GetSubmissionTrends(popupID uuid.UUID, days int
 		date := today.AddDate(0, 0, -i)
 		nextDate := date.Add(24 * time.Hour)
 
-		var count int64
-		if err := s.db.Model(&models.Submission{}).
+		var day struct {
+			Count int64
+			LeadStats
+		}
+		if err := s.db.Model(&models.Submission{}).Select("COUNT(*) AS count, "+leadStatsSelect).
 			Where("popup_id = ? AND created_at >= ? AND created_at < ?", popupID, date, nextDate).
-			Count(&count).Error; err != nil {
+			Scan(&day).Error; err != nil {
 			return nil, err
 		}
 
 		trends = append(trends, map[string]interface{}{
-			"date":  date.Format("2006-01-02"),
-			"count": count,
+			"date":         date.Format("2006-01-02"),
+			"count":        day.Count,
+			"unique_leads": day.UniqueLeads,
 		})
 	}
 
 	return trends, nil
 }
+
+// GetSourceBreakdown 按来源维度统计提交，用于把线索归因到来源和推广活动
+func (s *SubmissionStatsService) GetSourceBreakdown(q *SourceAnalyticsQuery) (*SourceBreakdown, error) {
+	if err := q.Validate(false); err != nil {
+		return nil, err
+	}
+
+	result := &SourceBreakdown{
+		Dimension: q.Dimension,
+		StartDate: *q.StartDate,
+		EndDate:   *q.EndDate,
+		Rows:      []*SourceBreakdownRow{},
+	}
+	if err := s.sourceRows(q, &result.Rows); err != nil {
+		return nil, err
+	}
+	if err := applySourceQuery(s.db.Model(&models.Submission{}), q).
+		Select(sourceMetricsSelect).Scan(&result.Total).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetSourceTimeSeries 按小时、天或周统计提交，指定维度时按已完成提交数最多的维度值分别统计
+func (s *SubmissionStatsService) GetSourceTimeSeries(q *SourceAnalyticsQuery) (*SourceTimeSeries, error) {
+	if err := q.Validate(true); err != nil {
+		return nil, err
+	}
+
+	result := &SourceTimeSeries{
+		Dimension:   q.Dimension,
+		Granularity: q.Granularity,
+		Timezone:    q.Timezone,
+		StartDate:   *q.StartDate,
+		EndDate:     *q.EndDate,
+		Points:      []*SourceSeriesPoint{},
+	}
+
+	query := applySourceQuery(s.db.Model(&models.Submission{}), q)
+	selects := "date_trunc(?, created_at AT TIME ZONE ?) AS bucket, "
+	groups := "bucket"
+	values := []string{""}
+	if q.Dimension != "" {
+		var rows []*SourceBreakdownRow
+		if err := s.sourceRows(q, &rows); err != nil {
+			return nil, err
+		}
+		values = make([]string, 0, len(rows))
+		for _, row := range rows {
+			values = append(values, row.Value)
+		}
+		result.Values = values
+		if len(values) == 0 {
+			return result, nil
+		}
+		column := "COALESCE(" + q.Dimension + ", '')"
+		selects += column + " AS value, "
+		groups = "bucket, value"
+		query = query.Where(column+" IN ?", values)
+	}
+
+	var rows []struct {
+		Bucket time.Time
+		Value  string
+		SourceMetrics
+	}
+	if err := query.Select(selects+sourceMetricsSelect, q.Granularity, q.Timezone).
+		Group(groups).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	metrics := make(map[string]SourceMetrics, len(rows))
+	for _, row := range rows {
+		metrics[row.Bucket.Format(sourceBucketLayout)+"\x00"+row.Value] = row.SourceMetrics
+	}
+
+	// 没有提交的时间段补零，便于绘制图表
+	for _, bucket := range q.buckets() {
+		for _, value := range values {
+			result.Points = append(result.Points, &SourceSeriesPoint{
+				Bucket:        bucket,
+				Value:         value,
+				SourceMetrics: metrics[bucket+"\x00"+value],
+			})
+		}
+	}
+	return result, nil
+}
+
+// sourceRows 按维度分组统计提交，返回已完成提交数最多的 Limit 个维度值
+func (s *SubmissionStatsService) sourceRows(q *SourceAnalyticsQuery, rows *[]*SourceBreakdownRow) error {
+	// 维度名来自固定列表，可以直接拼接；创建来源归因列之前的提交没有来源信息，与空值合并
+	return applySourceQuery(s.db.Model(&models.Submission{}), q).
+		Select("COALESCE(" + q.Dimension + ", '') AS value, " + sourceMetricsSelect).
+		Group("value").
+		Order("submissions DESC, value").
+		Limit(q.Limit).
+		Scan(rows).Error
+}
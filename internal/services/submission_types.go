@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,12 +9,16 @@ import (
 
 // CreateSubmissionRequest 创建提交请求
 type CreateSubmissionRequest struct {
-	PopupID     uuid.UUID              `json:"popup_id" binding:"required"`
-	FormData    map[string]interface{} `json:"form_data" binding:"required"`
-	UserAgent   string                 `json:"user_agent"`
-	IPAddress   string                 `json:"ip_address"`
-	Referrer    string                 `json:"referrer"`
-	SubmittedAt *time.Time             `json:"submitted_at"`
+	PopupID        uuid.UUID              `json:"popup_id" binding:"required"`
+	FormData       map[string]interface{} `json:"form_data" binding:"required"`
+	UserAgent      string                 `json:"user_agent"`
+	IPAddress      string                 `json:"ip_address"`
+	Referrer       string                 `json:"referrer"`
+	SubmittedAt    *time.Time             `json:"submitted_at"`
+	VariantID      *uuid.UUID             `json:"variant_id"` // 提交时展示的弹窗变体
+	VisitorID      string                 `json:"visitor_id"`
+	LandingPage    string                 `json:"landing_page"`    // 会话落地页的路径和查询参数，用于来源归因，为空时使用 referrer
+	ReferrerDomain string                 `json:"referrer_domain"` // 会话开始时的外部来源域名
 }
 
 // UpdateSubmissionRequest 更新提交请求
@@ -27,10 +32,309 @@ type UpdateSubmissionRequest struct {
 
 // SubmissionStats 提交统计信息
 type SubmissionStats struct {
-	TotalSubmissions int64      `json:"total_submissions"`
+	TotalSubmissions int64      `json:"total_submissions"` // 提交记录数，包括未完成的提交
 	TodaySubmissions int64      `json:"today_submissions"`
 	WeekSubmissions  int64      `json:"week_submissions"`
 	MonthSubmissions int64      `json:"month_submissions"`
 	LastSubmission   *time.Time `json:"last_submission"`
 	PopupID          uuid.UUID  `json:"popup_id"`
+
+	LeadStats
+}
+
+// LeadStats 去重后的线索统计
+type LeadStats struct {
+	RawSubmissions       int64 `json:"raw_submissions"`       // 收到的提交总数，包括被拒绝、更新或合并的重复提交
+	DuplicateSubmissions int64 `json:"duplicate_submissions"` // 被拒绝、更新或合并的重复提交数
+	UniqueLeads          int64 `json:"unique_leads"`          // 已完成提交中不同去重键的数量，没有去重键的提交各算一个线索
+}
+
+// SubmitFormStepRequest 代理页面提交弹窗表单的一个步骤，单页表单和未配置字段的表单视为只有一个步骤
+type SubmitFormStepRequest struct {
+	PopupID   uuid.UUID              `json:"popup_id"`
+	VariantID *uuid.UUID             `json:"variant_id"` // 展示的弹窗变体
+	SessionID string                 `json:"session_id"` // 访客会话ID，来自页面脚本的访客状态
+	Step      string                 `json:"step"`       // 步骤ID，单页表单可以为空
+	Values    map[string]interface{} `json:"values"`     // 该步骤的字段值
+	Locale    string                 `json:"locale"`     // 页面显示的弹窗语言，校验失败的提示使用该语言的翻译
+
+	// 防垃圾提交字段，由页面脚本填写
+	FormToken     string `json:"form_token"`     // 注入弹窗时签发的表单令牌
+	Honeypot      string `json:"honeypot"`       // 蜜罐字段的值，正常访客为空
+	CaptchaID     string `json:"captcha_id"`     // 图片验证码ID
+	CaptchaAnswer string `json:"captcha_answer"` // 图片验证码答案
+	ProofOfWork   string `json:"pow"`            // 工作量证明的答案
+
+	// 以下字段由处理器根据请求填写
+	ProxyConfigID uuid.UUID `json:"-"`
+	VisitorID     string    `json:"-"`
+	IPAddress     string    `json:"-"`
+	UserAgent     string    `json:"-"`
+	Referrer      string    `json:"-"`
+
+	// 来源归因，由处理器从访客状态Cookie中读取
+	LandingPage    string `json:"-"`
+	ReferrerDomain string `json:"-"`
+}
+
+// FormStepResult 表单步骤的保存结果
+type FormStepResult struct {
+	SubmissionID uuid.UUID `json:"submission_id"`
+	Step         string    `json:"step"`
+	NextStep     string    `json:"next_step,omitempty"` // 下一步骤ID，表单已完成时为空
+	Completed    bool      `json:"completed"`
+	Duplicate    bool      `json:"duplicate,omitempty"` // 重复提交已更新或合并到 SubmissionID 对应的已有提交
+}
+
+// InputError 调用方可以修正的请求错误，如字段校验失败、引用的弹窗或文件不存在，Error 可以返回给访客
+//
+// 代理数据面的公开接口只把该错误的内容返回给访客，其他错误视为服务端错误，详细信息只写入日志
+type InputError struct {
+	Message string
+}
+
+// Error 返回给调用方的提示
+func (e *InputError) Error() string {
+	return e.Message
+}
+
+// invalidInput 把校验错误包装为 InputError
+func invalidInput(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &InputError{Message: err.Error()}
+}
+
+// AsInputError 返回调用方可以修正的请求错误，其他错误返回nil
+func AsInputError(err error) *InputError {
+	var input *InputError
+	if errors.As(err, &input) {
+		return input
+	}
+	return nil
+}
+
+// ErrDuplicateSubmission 弹窗配置为拒绝重复提交，时间窗口内已有相同去重键的提交
+var ErrDuplicateSubmission = errors.New("this form has already been submitted")
+
+// 提交数据导出格式
+const (
+	ExportFormatJSON = "json"
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+)
+
+// 表格导出的表单字段列
+const (
+	ExportColumnsSchema = "schema" // 按弹窗表单配置声明的字段顺序，数据中的其他字段按名称排序追加在后
+	ExportColumnsUnion  = "union"  // 所有提交数据中出现过的字段，按名称排序
+)
+
+// ExportSubmissionsRequest 导出提交数据请求
+type ExportSubmissionsRequest struct {
+	PopupID   uuid.UUID
+	Format    string
+	Columns   string // 为空时弹窗配置了表单字段使用 schema，否则使用 union
+	BOM       bool   // CSV开头写入UTF-8 BOM，Excel据此识别编码
+	StartDate string // 开始日期 YYYY-MM-DD，包含当天
+	EndDate   string // 结束日期 YYYY-MM-DD，包含当天
+	Decrypt   bool   // 导出敏感字段原文，需要解密权限，否则导出脱敏文本
+
+	Actor SubmissionActor // 请求导出的用户，请求解密时检查权限并记录审计日志
+}
+
+// 提交记录的线索处理状态
+const (
+	SubmissionStatusNew       = "new"       // 新提交，尚未处理
+	SubmissionStatusContacted = "contacted" // 已联系
+	SubmissionStatusQualified = "qualified" // 有效线索
+	SubmissionStatusSpam      = "spam"      // 垃圾提交
+)
+
+// SubmissionStatuses 所有线索处理状态
+var SubmissionStatuses = []string{
+	SubmissionStatusNew,
+	SubmissionStatusContacted,
+	SubmissionStatusQualified,
+	SubmissionStatusSpam,
+}
+
+// 线索处理的限制
+const (
+	maxSubmissionTags      = 20   // 每条提交的标签数量上限
+	maxSubmissionTagLength = 50   // 标签的最大长度（字符）
+	maxSubmissionNoteSize  = 5000 // 备注的最大长度（字符）
+	maxSubmissionBatchSize = 500  // 批量操作一次最多处理的提交数量
+)
+
+// SubmissionFilter 提交列表查询条件
+type SubmissionFilter struct {
+	PopupID    *uuid.UUID
+	StartDate  *time.Time
+	EndDate    *time.Time
+	Status     []string   // 处理状态，多个状态之间为或
+	Processed  *bool      // true 只返回已处理（状态不为 new）的提交，false 只返回未处理的提交
+	Tag        string     // 包含该标签的提交
+	AssigneeID *uuid.UUID // 分配给该用户的提交
+	Unassigned bool       // 只返回未分配的提交
+
+	Search    string                  // 在表单数据的字段值中搜索，不区分大小写
+	Fields    []SubmissionFieldFilter // 表单字段条件，多个条件之间为且
+	IP        string                  // 用户IP地址或CIDR网段
+	Referrer  string                  // 来源页面URL包含的文本，不区分大小写
+	UserAgent string                  // 浏览器信息包含的文本，不区分大小写
+	Sort      string                  // 排序字段，前缀 - 表示倒序，表单字段写作 form.<字段名>，为空时按创建时间倒序
+}
+
+// 表单字段条件的比较方式，启用字段加密时敏感字段只支持 eq 和 exists
+const (
+	FieldOpEq       = "eq"       // 字段值等于
+	FieldOpContains = "contains" // 字段值包含文本，不区分大小写
+	FieldOpPrefix   = "prefix"   // 字段值以文本开头
+	FieldOpExists   = "exists"   // 存在该字段
+	FieldOpGt       = "gt"       // 大于，值为数字时按数字比较，否则按文本比较（可用于 YYYY-MM-DD 日期）
+	FieldOpGte      = "gte"      // 大于等于
+	FieldOpLt       = "lt"       // 小于
+	FieldOpLte      = "lte"      // 小于等于
+)
+
+// SubmissionFieldFilter 表单字段条件
+type SubmissionFieldFilter struct {
+	Field string
+	Op    string
+	Value string // exists 不需要值
+
+	blindIndex string // 值的盲索引，eq 条件同时匹配加密保存的字段值
+}
+
+// SubmissionActor 执行线索处理操作的用户，记录到备注和处理历史中
+type SubmissionActor struct {
+	UserID   uuid.UUID
+	Username string
+}
+
+// UpdateSubmissionStatusRequest 更新提交处理状态请求
+type UpdateSubmissionStatusRequest struct {
+	Status string `json:"status"` // 为空时标记为 contacted
+}
+
+// UpdateSubmissionTagsRequest 设置提交标签请求，替换原有的全部标签
+type UpdateSubmissionTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// AssignSubmissionRequest 分配提交负责人请求
+type AssignSubmissionRequest struct {
+	AssigneeID *uuid.UUID `json:"assignee_id"` // 为空时取消分配
+}
+
+// CreateSubmissionNoteRequest 添加提交备注请求
+type CreateSubmissionNoteRequest struct {
+	Body string `json:"body"`
+}
+
+// BatchUpdateSubmissionStatusRequest 批量更新提交处理状态请求
+type BatchUpdateSubmissionStatusRequest struct {
+	IDs    []uuid.UUID `json:"ids"`
+	Status string      `json:"status"` // 为空时标记为 contacted
+}
+
+// BatchUpdateSubmissionTagsRequest 批量添加和移除提交标签请求
+type BatchUpdateSubmissionTagsRequest struct {
+	IDs    []uuid.UUID `json:"ids"`
+	Add    []string    `json:"add"`
+	Remove []string    `json:"remove"`
+}
+
+// BatchAssignSubmissionsRequest 批量分配提交负责人请求
+type BatchAssignSubmissionsRequest struct {
+	IDs        []uuid.UUID `json:"ids"`
+	AssigneeID *uuid.UUID  `json:"assignee_id"` // 为空时取消分配
+}
+
+// BatchUpdateResult 批量操作结果
+type BatchUpdateResult struct {
+	Requested int `json:"requested"` // 请求中的提交数量
+	Updated   int `json:"updated"`   // 实际发生变化的提交数量，不存在或没有变化的提交不计入
+}
+
+// 提交来源分析的维度，与提交记录的来源归因列同名
+const (
+	SourceDimensionReferrerDomain = "referrer_domain"
+	SourceDimensionUTMSource      = "utm_source"
+	SourceDimensionUTMMedium      = "utm_medium"
+	SourceDimensionUTMCampaign    = "utm_campaign"
+	SourceDimensionUTMTerm        = "utm_term"
+	SourceDimensionUTMContent     = "utm_content"
+	SourceDimensionLandingPage    = "landing_page"
+	SourceDimensionProxiedPath    = "proxied_path"
+	SourceDimensionDeviceClass    = "device_class"
+)
+
+// SourceDimensions 所有来源分析维度
+var SourceDimensions = []string{
+	SourceDimensionReferrerDomain,
+	SourceDimensionUTMSource, SourceDimensionUTMMedium, SourceDimensionUTMCampaign, SourceDimensionUTMTerm, SourceDimensionUTMContent,
+	SourceDimensionLandingPage, SourceDimensionProxiedPath, SourceDimensionDeviceClass,
+}
+
+// 来源分析时间序列的粒度，按 Timezone 的本地时间划分，每周从周一开始
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+	GranularityWeek = "week"
+)
+
+// SourceAnalyticsQuery 提交来源分析查询条件
+type SourceAnalyticsQuery struct {
+	PopupID     *uuid.UUID
+	Dimension   string            // 分组维度，时间序列可以为空，为空时只按时间分组
+	Granularity string            // 时间序列的粒度，为空时按天
+	Timezone    string            // IANA时区，如 Asia/Shanghai，为空时使用UTC
+	StartDate   *time.Time        // 包含，为空时按粒度取默认范围
+	EndDate     *time.Time        // 不包含，为空时为当前时间
+	Filters     map[string]string // 维度等于指定值的提交，值为空字符串时匹配没有该来源信息的提交
+	Limit       int               // 返回的维度值数量上限，为0时使用默认值
+}
+
+// SourceMetrics 一组提交的来源分析指标
+type SourceMetrics struct {
+	Submissions        int64 `json:"submissions"`         // 已完成的提交数
+	PartialSubmissions int64 `json:"partial_submissions"` // 未完成的多步表单提交数
+
+	LeadStats
+}
+
+// SourceBreakdownRow 一个维度值的指标
+type SourceBreakdownRow struct {
+	Value string `json:"value"` // 维度值，为空表示没有该来源信息，如直接访问
+	SourceMetrics
+}
+
+// SourceBreakdown 按维度分组的提交来源分析结果，只返回已完成提交数最多的 Limit 个维度值
+type SourceBreakdown struct {
+	Dimension string                `json:"dimension"`
+	StartDate time.Time             `json:"start_date"`
+	EndDate   time.Time             `json:"end_date"`
+	Rows      []*SourceBreakdownRow `json:"rows"`
+	Total     SourceMetrics         `json:"total"` // 时间范围内所有提交的指标，包括未返回的维度值
+}
+
+// SourceSeriesPoint 一个时间段内一个维度值的指标
+type SourceSeriesPoint struct {
+	Bucket string `json:"bucket"`          // 时间段开始的本地时间，格式为 2006-01-02T15:04
+	Value  string `json:"value,omitempty"` // 维度值，未指定维度时为空
+	SourceMetrics
+}
+
+// SourceTimeSeries 按时间段分组的提交来源分析结果，没有提交的时间段也会返回
+type SourceTimeSeries struct {
+	Dimension   string               `json:"dimension,omitempty"`
+	Granularity string               `json:"granularity"`
+	Timezone    string               `json:"timezone"`
+	StartDate   time.Time            `json:"start_date"`
+	EndDate     time.Time            `json:"end_date"`
+	Values      []string             `json:"values,omitempty"` // 时间范围内已完成提交数最多的 Limit 个维度值
+	Points      []*SourceSeriesPoint `json:"points"`
 }
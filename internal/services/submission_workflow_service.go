@@ -0,0 +1,468 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SubmissionWorkflowService 提交线索处理服务
+//
+// 管理提交记录的处理状态、标签、负责人和内部备注，每次变更都在同一事务中写入审计日志，
+// 作为该提交的处理历史
+type SubmissionWorkflowService struct {
+	db     *gorm.DB
+	logger logger.Logger
+	audit  *AuditService
+}
+
+// NewSubmissionWorkflowService 创建新的提交线索处理服务
+func NewSubmissionWorkflowService(db *gorm.DB, logger logger.Logger, audit *AuditService) *SubmissionWorkflowService {
+	return &SubmissionWorkflowService{
+		db:     db,
+		logger: logger,
+		audit:  audit,
+	}
+}
+
+// submissionChange 对一条提交的变更，changed 为 false 时不更新也不记录历史
+type submissionChange struct {
+	changed bool
+	updates map[string]interface{}
+	action  string
+	details map[string]interface{}
+}
+
+// UpdateStatus 更新提交的处理状态
+func (s *SubmissionWorkflowService) UpdateStatus(id uuid.UUID, status string, actor SubmissionActor) (*models.Submission, error) {
+	status, err := normalizeSubmissionStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	return s.applyOne(id, actor, func(submission *models.Submission) (*submissionChange, error) {
+		return statusChange(submission, status, time.Now()), nil
+	})
+}
+
+// SetTags 替换提交的全部标签
+func (s *SubmissionWorkflowService) SetTags(id uuid.UUID, tags []string, actor SubmissionActor) (*models.Submission, error) {
+	tags, err := normalizeSubmissionTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	return s.applyOne(id, actor, func(submission *models.Submission) (*submissionChange, error) {
+		return tagsChange(submission, func([]string) []string { return tags })
+	})
+}
+
+// Assign 分配提交的负责人，assigneeID 为空时取消分配
+func (s *SubmissionWorkflowService) Assign(id uuid.UUID, assigneeID *uuid.UUID, actor SubmissionActor) (*models.Submission, error) {
+	if err := s.checkAssignee(assigneeID); err != nil {
+		return nil, err
+	}
+	return s.applyOne(id, actor, func(submission *models.Submission) (*submissionChange, error) {
+		return assigneeChange(submission, assigneeID), nil
+	})
+}
+
+// BatchUpdateStatus 批量更新提交的处理状态
+func (s *SubmissionWorkflowService) BatchUpdateStatus(req *BatchUpdateSubmissionStatusRequest, actor SubmissionActor) (*BatchUpdateResult, error) {
+	status, err := normalizeSubmissionStatus(req.Status)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return s.applyBatch(req.IDs, actor, func(submission *models.Submission) (*submissionChange, error) {
+		return statusChange(submission, status, now), nil
+	})
+}
+
+// BatchUpdateTags 批量为提交添加和移除标签，同时出现在两个列表中的标签被移除
+func (s *SubmissionWorkflowService) BatchUpdateTags(req *BatchUpdateSubmissionTagsRequest, actor SubmissionActor) (*BatchUpdateResult, error) {
+	add, err := normalizeSubmissionTags(req.Add)
+	if err != nil {
+		return nil, err
+	}
+	remove, err := normalizeSubmissionTags(req.Remove)
+	if err != nil {
+		return nil, err
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, errors.New("no tags to add or remove")
+	}
+	return s.applyBatch(req.IDs, actor, func(submission *models.Submission) (*submissionChange, error) {
+		return tagsChange(submission, func(current []string) []string {
+			return removeSubmissionTags(append(current, add...), remove)
+		})
+	})
+}
+
+// BatchAssign 批量分配提交的负责人，负责人为空时取消分配
+func (s *SubmissionWorkflowService) BatchAssign(req *BatchAssignSubmissionsRequest, actor SubmissionActor) (*BatchUpdateResult, error) {
+	if err := s.checkAssignee(req.AssigneeID); err != nil {
+		return nil, err
+	}
+	return s.applyBatch(req.IDs, actor, func(submission *models.Submission) (*submissionChange, error) {
+		return assigneeChange(submission, req.AssigneeID), nil
+	})
+}
+
+// AddNote 为提交添加内部备注
+func (s *SubmissionWorkflowService) AddNote(id uuid.UUID, body string, actor SubmissionActor) (*models.SubmissionNote, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, errors.New("note body is required")
+	}
+	if utf8.RuneCountInString(body) > maxSubmissionNoteSize {
+		return nil, fmt.Errorf("note must be at most %d characters", maxSubmissionNoteSize)
+	}
+
+	note := &models.SubmissionNote{
+		SubmissionID: id,
+		AuthorID:     actorID(actor),
+		Author:       actor.Username,
+		Body:         body,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.lockSubmission(tx, id); err != nil {
+			return err
+		}
+		if err := tx.Create(note).Error; err != nil {
+			return fmt.Errorf("failed to create note: %w", err)
+		}
+		return s.audit.RecordTx(tx, &AuditEntry{
+			Action:       AuditActionSubmissionNoteAdded,
+			ResourceType: AuditResourceSubmission,
+			ResourceID:   id.String(),
+			ActorID:      actorID(actor),
+			Details: map[string]interface{}{
+				"note_id": note.ID,
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"submission_id": id,
+		"note_id":       note.ID,
+		"author":        actor.Username,
+	}).Info("Submission note added")
+	return note, nil
+}
+
+// ListNotes 获取提交的备注，按时间正序
+func (s *SubmissionWorkflowService) ListNotes(id uuid.UUID) ([]*models.SubmissionNote, error) {
+	if err := s.checkSubmission(id); err != nil {
+		return nil, err
+	}
+	var notes []*models.SubmissionNote
+	if err := s.db.Where("submission_id = ?", id).Order("created_at, id").Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// ListHistory 分页获取提交的处理历史，按时间倒序
+func (s *SubmissionWorkflowService) ListHistory(id uuid.UUID, page, pageSize int) ([]*models.AuditLog, int64, error) {
+	if err := s.checkSubmission(id); err != nil {
+		return nil, 0, err
+	}
+	return s.audit.ListAuditLogs(page, pageSize, &AuditLogFilter{
+		ResourceType: AuditResourceSubmission,
+		ResourceID:   id.String(),
+	})
+}
+
+// applyOne 在事务中锁定一条提交，应用变更并记录处理历史
+func (s *SubmissionWorkflowService) applyOne(id uuid.UUID, actor SubmissionActor, change func(*models.Submission) (*submissionChange, error)) (*models.Submission, error) {
+	var submission models.Submission
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&submission, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("submission not found")
+			}
+			return err
+		}
+		_, err := s.apply(tx, &submission, actor, change)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &submission, nil
+}
+
+// applyBatch 在一个事务中锁定多条提交并逐条应用变更，不存在的提交被忽略
+func (s *SubmissionWorkflowService) applyBatch(ids []uuid.UUID, actor SubmissionActor, change func(*models.Submission) (*submissionChange, error)) (*BatchUpdateResult, error) {
+	ids = uniqueUUIDs(ids)
+	if len(ids) == 0 {
+		return nil, errors.New("ids are required")
+	}
+	if len(ids) > maxSubmissionBatchSize {
+		return nil, fmt.Errorf("at most %d submissions can be updated at once", maxSubmissionBatchSize)
+	}
+
+	result := &BatchUpdateResult{Requested: len(ids)}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 按ID顺序加锁，避免并发的批量操作互相死锁
+		var submissions []*models.Submission
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", ids).
+			Order("id").
+			Find(&submissions).Error; err != nil {
+			return err
+		}
+		for _, submission := range submissions {
+			changed, err := s.apply(tx, submission, actor, change)
+			if err != nil {
+				return err
+			}
+			if changed {
+				result.Updated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"requested": result.Requested,
+		"updated":   result.Updated,
+		"actor":     actor.Username,
+	}).Info("Submissions batch updated")
+	return result, nil
+}
+
+// apply 对已锁定的提交应用变更，有变化时更新记录并写入处理历史
+func (s *SubmissionWorkflowService) apply(tx *gorm.DB, submission *models.Submission, actor SubmissionActor, change func(*models.Submission) (*submissionChange, error)) (bool, error) {
+	c, err := change(submission)
+	if err != nil {
+		return false, err
+	}
+	if !c.changed {
+		return false, nil
+	}
+	if err := tx.Model(submission).Updates(c.updates).Error; err != nil {
+		return false, fmt.Errorf("failed to update submission: %w", err)
+	}
+	if err := s.audit.RecordTx(tx, &AuditEntry{
+		Action:       c.action,
+		ResourceType: AuditResourceSubmission,
+		ResourceID:   submission.ID.String(),
+		ActorID:      actorID(actor),
+		Details:      c.details,
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// lockSubmission 锁定提交记录，防止添加备注时提交被删除
+func (s *SubmissionWorkflowService) lockSubmission(tx *gorm.DB, id uuid.UUID) error {
+	var submission models.Submission
+	if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id").First(&submission, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("submission not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// checkSubmission 检查提交记录是否存在
+func (s *SubmissionWorkflowService) checkSubmission(id uuid.UUID) error {
+	var count int64
+	if err := s.db.Model(&models.Submission{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("submission not found")
+	}
+	return nil
+}
+
+// checkAssignee 检查负责人是启用的用户，为空表示取消分配
+func (s *SubmissionWorkflowService) checkAssignee(assigneeID *uuid.UUID) error {
+	if assigneeID == nil {
+		return nil
+	}
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("id = ? AND is_active = ?", *assigneeID, true).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("assignee not found")
+	}
+	return nil
+}
+
+// statusChange 计算处理状态的变更，离开 new 时记录处理时间，回到 new 时清除
+func statusChange(submission *models.Submission, status string, now time.Time) *submissionChange {
+	from := submission.Status
+	if from == "" {
+		from = SubmissionStatusNew
+	}
+	if from == status {
+		return &submissionChange{}
+	}
+	updates := map[string]interface{}{"status": status}
+	if status == SubmissionStatusNew {
+		updates["processed_at"] = nil
+	} else if from == SubmissionStatusNew {
+		updates["processed_at"] = now
+	}
+	return &submissionChange{
+		changed: true,
+		updates: updates,
+		action:  AuditActionSubmissionStatusChanged,
+		details: map[string]interface{}{
+			"from": from,
+			"to":   status,
+		},
+	}
+}
+
+// tagsChange 计算标签的变更，update 根据当前标签返回新的标签
+func tagsChange(submission *models.Submission, update func([]string) []string) (*submissionChange, error) {
+	current := parseSubmissionTags(submission.Tags)
+	tags, err := normalizeSubmissionTags(update(append([]string(nil), current...)))
+	if err != nil {
+		return nil, err
+	}
+	added := removeSubmissionTags(tags, current)
+	removed := removeSubmissionTags(current, tags)
+	if len(added) == 0 && len(removed) == 0 && len(tags) == len(current) {
+		return &submissionChange{}, nil
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return nil, err
+	}
+	return &submissionChange{
+		changed: true,
+		updates: map[string]interface{}{"tags": string(data)},
+		action:  AuditActionSubmissionTagsChanged,
+		details: map[string]interface{}{
+			"added":   added,
+			"removed": removed,
+			"tags":    tags,
+		},
+	}, nil
+}
+
+// assigneeChange 计算负责人的变更
+func assigneeChange(submission *models.Submission, assigneeID *uuid.UUID) *submissionChange {
+	from := submission.AssigneeID
+	if (from == nil && assigneeID == nil) || (from != nil && assigneeID != nil && *from == *assigneeID) {
+		return &submissionChange{}
+	}
+	return &submissionChange{
+		changed: true,
+		updates: map[string]interface{}{"assignee_id": assigneeID},
+		action:  AuditActionSubmissionAssigned,
+		details: map[string]interface{}{
+			"from": from,
+			"to":   assigneeID,
+		},
+	}
+}
+
+// normalizeSubmissionStatus 校验处理状态，为空时返回 contacted
+func normalizeSubmissionStatus(status string) (string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if status == "" {
+		return SubmissionStatusContacted, nil
+	}
+	for _, s := range SubmissionStatuses {
+		if s == status {
+			return status, nil
+		}
+	}
+	return "", fmt.Errorf("invalid submission status %q, expected one of %s", status, strings.Join(SubmissionStatuses, ", "))
+}
+
+// normalizeSubmissionTags 去除标签首尾空白、空标签和重复标签（不区分大小写，保留第一次出现的写法）
+func normalizeSubmissionTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxSubmissionTagLength {
+			return nil, fmt.Errorf("tag %q must be at most %d characters", tag, maxSubmissionTagLength)
+		}
+		key := strings.ToLower(tag)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, tag)
+	}
+	if len(result) > maxSubmissionTags {
+		return nil, fmt.Errorf("a submission can have at most %d tags", maxSubmissionTags)
+	}
+	return result, nil
+}
+
+// removeSubmissionTags 返回 tags 中不在 remove 里的标签，不区分大小写
+func removeSubmissionTags(tags, remove []string) []string {
+	removed := make(map[string]bool, len(remove))
+	for _, tag := range remove {
+		removed[strings.ToLower(tag)] = true
+	}
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if !removed[strings.ToLower(tag)] {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// parseSubmissionTags 解析提交记录中保存的标签，无效数据视为没有标签
+func parseSubmissionTags(data string) []string {
+	var tags []string
+	if data == "" || json.Unmarshal([]byte(data), &tags) != nil {
+		return nil
+	}
+	return tags
+}
+
+// actorID 返回操作用户ID，系统操作时为空
+func actorID(actor SubmissionActor) *uuid.UUID {
+	if actor.UserID == uuid.Nil {
+		return nil
+	}
+	id := actor.UserID
+	return &id
+}
+
+// uniqueUUIDs 去除重复和空的ID
+func uniqueUUIDs(ids []uuid.UUID) []uuid.UUID {
+	result := make([]uuid.UUID, 0, len(ids))
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		if id == uuid.Nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
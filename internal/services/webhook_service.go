@@ -0,0 +1,905 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"proxy-enhancer-ultra/internal/config"
+	"proxy-enhancer-ultra/internal/fieldcrypt"
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/webhook"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Webhook投递调度的时间间隔
+const (
+	webhookPollInterval      = 5 * time.Second     // 没有收到新投递通知时检查到期投递的间隔
+	webhookLeaseMargin       = time.Minute         // 领取投递后在请求超时之外额外保留的时间，实例崩溃后投递在租期结束时重新发送
+	webhookSweepInterval     = time.Hour           // 清理已投递记录的间隔
+	webhookDeliveryRetention = 30 * 24 * time.Hour // 投递成功的记录保留时间，死信保留到重放或删除Webhook
+)
+
+// webhookResponseLimit 投递失败时记录的响应内容长度上限
+const webhookResponseLimit = 512
+
+// webhookMinSecretLength 自定义签名密钥的最小长度
+const webhookMinSecretLength = 16
+
+// WebhookService Webhook服务
+//
+// 提交记录事件与提交记录在同一事务中写入投递表（发件箱），由后台工作协程用HMAC-SHA256签名后发送，
+// 失败时按指数退避重试，重试次数用完后进入死信列表，可以通过管理接口重放。
+// 到期的投递通过 FOR UPDATE SKIP LOCKED 领取，多个实例可以同时运行。
+// 投递记录中的敏感字段保持加密，发送时按订阅设置解密或脱敏
+type WebhookService struct {
+	db         *gorm.DB
+	logger     logger.Logger
+	cfg        config.WebhookConfig
+	client     *http.Client
+	encryption *EncryptionService
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWebhookService 创建新的Webhook服务
+func NewWebhookService(db *gorm.DB, logger logger.Logger, cfg config.WebhookConfig, encryption *EncryptionService) *WebhookService {
+	cfg = cfg.WithDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookService{
+		db:         db,
+		logger:     logger,
+		cfg:        cfg,
+		encryption: encryption,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// 不跟随重定向，接收地址变更时需要修改订阅
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start 启动投递工作协程和投递记录清理
+func (s *WebhookService) Start() {
+	for i := 0; i < s.cfg.Workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(webhookSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep(time.Now())
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]interface{}{
+		"workers":      s.cfg.Workers,
+		"max_attempts": s.cfg.MaxAttempts,
+	}).Info("Webhook delivery workers started")
+}
+
+// Stop 停止投递，正在发送的请求被取消并在下次启动后重新发送
+func (s *WebhookService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// CreateWebhook 创建Webhook订阅，返回结果包含签名密钥
+func (s *WebhookService) CreateWebhook(req *CreateWebhookRequest) (*WebhookWithSecret, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	events, err := normalizeWebhookEvents(req.Events)
+	if err != nil {
+		return nil, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = webhook.NewSecret(); err != nil {
+			return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+	} else if len(secret) < webhookMinSecretLength {
+		return nil, fmt.Errorf("secret must be at least %d characters", webhookMinSecretLength)
+	}
+	if err := s.checkScope(req.PopupID, req.ProxyConfigID); err != nil {
+		return nil, err
+	}
+	if !req.MaskSensitive {
+		if err := s.encryption.AuthorizePlaintextDelivery(req.Actor); err != nil {
+			return nil, err
+		}
+	}
+
+	hook := &models.Webhook{
+		Name:          name,
+		URL:           req.URL,
+		Secret:        secret,
+		Events:        events,
+		PopupID:       req.PopupID,
+		ProxyConfigID: req.ProxyConfigID,
+		IsActive:      req.IsActive == nil || *req.IsActive,
+		MaskSensitive: req.MaskSensitive,
+		Description:   req.Description,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(hook).Error; err != nil {
+			return err
+		}
+		// is_active 有数据库默认值，创建时 false 会被忽略
+		if !hook.IsActive {
+			return tx.Model(hook).Update("is_active", false).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"webhook_id":     hook.ID,
+		"url":            hook.URL,
+		"events":         hook.Events,
+		"mask_sensitive": hook.MaskSensitive,
+		"user_id":        req.Actor.UserID,
+	}).Info("Webhook created")
+	return &WebhookWithSecret{Webhook: hook, Secret: secret}, nil
+}
+
+// ListWebhooks 获取Webhook订阅列表
+func (s *WebhookService) ListWebhooks(page, pageSize int) ([]*models.Webhook, int64, error) {
+	var hooks []*models.Webhook
+	var total int64
+
+	query := s.db.Model(&models.Webhook{})
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&hooks).Error; err != nil {
+		return nil, 0, err
+	}
+	return hooks, total, nil
+}
+
+// GetWebhook 获取Webhook订阅
+func (s *WebhookService) GetWebhook(id uuid.UUID) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := s.db.First(&hook, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("webhook not found")
+		}
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// UpdateWebhook 更新Webhook订阅
+func (s *WebhookService) UpdateWebhook(id uuid.UUID, req *UpdateWebhookRequest) (*models.Webhook, error) {
+	hook, err := s.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != "" {
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			return nil, errors.New("name is required")
+		}
+		updates["name"] = name
+	}
+	if req.URL != "" {
+		if err := validateWebhookURL(req.URL); err != nil {
+			return nil, err
+		}
+		updates["url"] = req.URL
+	}
+	if req.Events != nil {
+		events, err := normalizeWebhookEvents(req.Events)
+		if err != nil {
+			return nil, err
+		}
+		updates["events"] = events
+	}
+	if err := s.checkScope(req.PopupID, req.ProxyConfigID); err != nil {
+		return nil, err
+	}
+	if req.ClearPopup {
+		updates["popup_id"] = nil
+	} else if req.PopupID != nil {
+		updates["popup_id"] = *req.PopupID
+	}
+	if req.ClearProxy {
+		updates["proxy_config_id"] = nil
+	} else if req.ProxyConfigID != nil {
+		updates["proxy_config_id"] = *req.ProxyConfigID
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if req.MaskSensitive != nil {
+		if hook.MaskSensitive && !*req.MaskSensitive {
+			if err := s.encryption.AuthorizePlaintextDelivery(req.Actor); err != nil {
+				return nil, err
+			}
+		}
+		updates["mask_sensitive"] = *req.MaskSensitive
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(hook).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update webhook: %w", err)
+		}
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"webhook_id": id,
+	}).Info("Webhook updated")
+	return s.GetWebhook(id)
+}
+
+// RotateSecret 生成新的签名密钥，之后的请求（包括重试）都使用新密钥签名
+func (s *WebhookService) RotateSecret(id uuid.UUID) (*WebhookWithSecret, error) {
+	hook, err := s.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	if err := s.db.Model(hook).Update("secret", secret).Error; err != nil {
+		return nil, fmt.Errorf("failed to rotate webhook secret: %w", err)
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"webhook_id": id,
+	}).Info("Webhook secret rotated")
+	return &WebhookWithSecret{Webhook: hook, Secret: secret}, nil
+}
+
+// DeleteWebhook 删除Webhook订阅和它的投递记录
+func (s *WebhookService) DeleteWebhook(id uuid.UUID) error {
+	if _, err := s.GetWebhook(id); err != nil {
+		return err
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("webhook_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Webhook{}, "id = ?", id).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"webhook_id": id,
+	}).Info("Webhook deleted")
+	return nil
+}
+
+// SendTest 创建一次 ping 事件投递，停用的Webhook也可以测试
+func (s *WebhookService) SendTest(id uuid.UUID) (*models.WebhookDelivery, error) {
+	hook, err := s.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := newWebhookDelivery(hook.ID, WebhookEventPing, map[string]interface{}{
+		"webhook_id": hook.ID,
+	}, nil, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(delivery).Error; err != nil {
+		return nil, fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	s.Notify()
+	return delivery, nil
+}
+
+// ListDeliveries 获取投递记录，按创建时间倒序
+func (s *WebhookService) ListDeliveries(filter *WebhookDeliveryFilter, page, pageSize int) ([]*models.WebhookDelivery, int64, error) {
+	var deliveries []*models.WebhookDelivery
+	var total int64
+
+	query := s.db.Model(&models.WebhookDelivery{})
+	if filter != nil {
+		if filter.WebhookID != nil {
+			query = query.Where("webhook_id = ?", *filter.WebhookID)
+		}
+		if filter.Status != "" {
+			query = query.Where("status = ?", filter.Status)
+		}
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+	for _, delivery := range deliveries {
+		delivery.Payload = maskWebhookPayload(delivery.Payload)
+	}
+	return deliveries, total, nil
+}
+
+// GetDelivery 获取投递记录，请求体中的敏感字段显示脱敏文本
+func (s *WebhookService) GetDelivery(id uuid.UUID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := s.db.First(&delivery, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("webhook delivery not found")
+		}
+		return nil, err
+	}
+	delivery.Payload = maskWebhookPayload(delivery.Payload)
+	return &delivery, nil
+}
+
+// ReplayDelivery 重新投递死信或已投递的记录，请求体和投递ID不变，重试次数重新计算
+func (s *WebhookService) ReplayDelivery(id uuid.UUID) (*models.WebhookDelivery, error) {
+	delivery, err := s.GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status == WebhookDeliveryPending {
+		return nil, errors.New("webhook delivery is already pending")
+	}
+
+	result := s.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status <> ?", id, WebhookDeliveryPending).
+		Updates(replayValues(time.Now()))
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to replay webhook delivery: %w", result.Error)
+	}
+	s.Notify()
+
+	s.logger.WithFields(map[string]interface{}{
+		"delivery_id": id,
+		"webhook_id":  delivery.WebhookID,
+	}).Info("Webhook delivery replayed")
+	return s.GetDelivery(id)
+}
+
+// ReplayDeadLetters 重新投递Webhook的所有死信，返回重新投递的数量
+func (s *WebhookService) ReplayDeadLetters(webhookID uuid.UUID) (int64, error) {
+	if _, err := s.GetWebhook(webhookID); err != nil {
+		return 0, err
+	}
+	result := s.db.Model(&models.WebhookDelivery{}).
+		Where("webhook_id = ? AND status = ?", webhookID, WebhookDeliveryDead).
+		Updates(replayValues(time.Now()))
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to replay webhook deliveries: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		s.Notify()
+	}
+
+	s.logger.WithFields(map[string]interface{}{
+		"webhook_id": webhookID,
+		"count":      result.RowsAffected,
+	}).Info("Webhook dead letters replayed")
+	return result.RowsAffected, nil
+}
+
+// EnqueueTx 在提交记录的事务中为订阅了事件的Webhook写入投递记录，事务提交后调用 Notify 立即投递
+//
+// proxyConfigID 为提交所经过的代理配置，为空时只匹配不限代理配置的订阅
+func (s *WebhookService) EnqueueTx(tx *gorm.DB, event string, submission *models.Submission, proxyConfigID *uuid.UUID) error {
+	if s == nil {
+		return nil
+	}
+	subscribed, err := json.Marshal([]string{event})
+	if err != nil {
+		return err
+	}
+	query := tx.Model(&models.Webhook{}).
+		Where("is_active = ? AND events @> ?::jsonb", true, string(subscribed)).
+		Where("popup_id IS NULL OR popup_id = ?", submission.PopupID)
+	if proxyConfigID != nil {
+		query = query.Where("proxy_config_id IS NULL OR proxy_config_id = ?", *proxyConfigID)
+	} else {
+		query = query.Where("proxy_config_id IS NULL")
+	}
+	var ids []uuid.UUID
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	data := webhookSubmissionOf(submission, proxyConfigID)
+	now := time.Now()
+	deliveries := make([]*models.WebhookDelivery, 0, len(ids))
+	for _, id := range ids {
+		delivery, err := newWebhookDelivery(id, event, data, &submission.ID, now)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := tx.Create(&deliveries).Error; err != nil {
+		return fmt.Errorf("failed to create webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// Notify 通知空闲的工作协程检查到期投递
+func (s *WebhookService) Notify() {
+	if s == nil {
+		return
+	}
+	// 通道已有通知时不需要重复发送
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// DeliverDue 在当前协程中依次发送所有到期的投递，返回发送的请求数，可用于不启动工作协程时手动投递
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	count := 0
+	for ctx.Err() == nil {
+		delivery, err := s.claim(time.Now())
+		if err != nil {
+			return count, err
+		}
+		if delivery == nil {
+			break
+		}
+		s.deliver(ctx, delivery)
+		count++
+	}
+	return count, ctx.Err()
+}
+
+// work 工作协程，循环领取并发送到期的投递
+func (s *WebhookService) work() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.ctx.Err() != nil {
+			return
+		}
+		delivery, err := s.claim(time.Now())
+		if err != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"error": err.Error(),
+			}).Error("Failed to claim webhook delivery")
+		}
+		if delivery != nil {
+			s.deliver(s.ctx, delivery)
+			continue
+		}
+
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// claim 领取最早到期的投递，增加投递次数并把下次投递时间推迟一个租期，没有到期投递时返回 nil
+func (s *WebhookService) claim(now time.Time) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", WebhookDeliveryPending, now).
+			Order("next_attempt_at").
+			First(&delivery).Error; err != nil {
+			return err
+		}
+		delivery.Attempts++
+		return tx.Model(&delivery).Updates(map[string]interface{}{
+			"attempts":        delivery.Attempts,
+			"next_attempt_at": now.Add(s.cfg.Timeout + webhookLeaseMargin),
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// deliver 发送一次投递并记录结果
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	var hook models.Webhook
+	if err := s.db.First(&hook, "id = ?", delivery.WebhookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.finish(delivery, WebhookDeliveryDead, 0, "webhook not found")
+			return
+		}
+		s.record(delivery, 0, err)
+		return
+	}
+	if !hook.IsActive && delivery.Event != WebhookEventPing {
+		s.finish(delivery, WebhookDeliveryDead, 0, "webhook is disabled")
+		return
+	}
+
+	status, err := s.send(ctx, &hook, delivery)
+	if err != nil && errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		// 服务停止导致请求中断，不计入投递次数
+		if err := s.db.Model(&models.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND attempts = ?", delivery.ID, WebhookDeliveryPending, delivery.Attempts).
+			Updates(map[string]interface{}{
+				"attempts":        delivery.Attempts - 1,
+				"next_attempt_at": time.Now(),
+			}).Error; err != nil {
+			s.logger.WithFields(map[string]interface{}{
+				"delivery_id": delivery.ID,
+				"error":       err.Error(),
+			}).Error("Failed to release webhook delivery")
+		}
+		return
+	}
+	s.record(delivery, status, err)
+}
+
+// send 发送签名的POST请求，接收方返回2xx视为成功，返回响应状态码
+func (s *WebhookService) send(ctx context.Context, hook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	body, err := s.payloadFor(hook, delivery)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ProxyEnhancerUltra-Webhook/1.0")
+	req.Header.Set(webhook.HeaderEvent, delivery.Event)
+	req.Header.Set(webhook.HeaderDelivery, delivery.ID.String())
+	req.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhook.HeaderSignature, webhook.Sign(hook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	// 读完剩余内容以复用连接
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	message := fmt.Sprintf("receiver responded with status %d", resp.StatusCode)
+	if text := strings.TrimSpace(strings.ToValidUTF8(string(snippet), "")); text != "" {
+		message += ": " + text
+	}
+	return resp.StatusCode, errors.New(message)
+}
+
+// payloadFor 返回发送给订阅的请求体，订阅设置为脱敏时敏感字段只发送脱敏文本，
+// 否则解密后发送并记录审计日志，每次发送原文都会记录
+func (s *WebhookService) payloadFor(hook *models.Webhook, delivery *models.WebhookDelivery) ([]byte, error) {
+	if hook.MaskSensitive {
+		return []byte(maskWebhookPayload(delivery.Payload)), nil
+	}
+	payload, formData, ok := decodeWebhookPayload(delivery.Payload)
+	if !ok {
+		return []byte(delivery.Payload), nil
+	}
+	opened, err := s.encryption.OpenFields(formData)
+	if err != nil {
+		return nil, err
+	}
+	if opened == 0 {
+		return []byte(delivery.Payload), nil
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	resourceID := ""
+	if delivery.SubmissionID != nil {
+		resourceID = delivery.SubmissionID.String()
+	}
+	if err := s.encryption.RecordDelivery(s.db, AuditResourceSubmission, resourceID, map[string]interface{}{
+		"channel":     "webhook",
+		"webhook_id":  hook.ID,
+		"delivery_id": delivery.ID,
+		"event":       delivery.Event,
+		"attempt":     delivery.Attempts,
+		"fields":      opened,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record decryption: %w", err)
+	}
+	return body, nil
+}
+
+// record 记录投递结果，失败时按投递次数安排重试或进入死信列表
+func (s *WebhookService) record(delivery *models.WebhookDelivery, status int, cause error) {
+	if cause == nil {
+		now := time.Now()
+		s.update(delivery, map[string]interface{}{
+			"status":          WebhookDeliveryDelivered,
+			"response_status": status,
+			"last_error":      "",
+			"delivered_at":    now,
+		})
+		s.logger.WithFields(map[string]interface{}{
+			"delivery_id": delivery.ID,
+			"webhook_id":  delivery.WebhookID,
+			"event":       delivery.Event,
+			"attempts":    delivery.Attempts,
+		}).Info("Webhook delivered")
+		return
+	}
+
+	message := truncateWebhookError(cause.Error())
+	if delivery.Attempts >= s.cfg.MaxAttempts {
+		s.finish(delivery, WebhookDeliveryDead, status, message)
+		return
+	}
+
+	delay := webhook.Backoff(delivery.Attempts, s.cfg.RetryBase, s.cfg.RetryMax)
+	s.update(delivery, map[string]interface{}{
+		"response_status": status,
+		"last_error":      message,
+		"next_attempt_at": time.Now().Add(delay),
+	})
+	s.logger.WithFields(map[string]interface{}{
+		"delivery_id": delivery.ID,
+		"webhook_id":  delivery.WebhookID,
+		"attempts":    delivery.Attempts,
+		"retry_in":    delay,
+		"error":       message,
+	}).Warn("Webhook delivery failed, will retry")
+}
+
+// finish 结束投递并设置最终状态
+func (s *WebhookService) finish(delivery *models.WebhookDelivery, status string, responseStatus int, message string) {
+	s.update(delivery, map[string]interface{}{
+		"status":          status,
+		"response_status": responseStatus,
+		"last_error":      message,
+	})
+	s.logger.WithFields(map[string]interface{}{
+		"delivery_id": delivery.ID,
+		"webhook_id":  delivery.WebhookID,
+		"event":       delivery.Event,
+		"attempts":    delivery.Attempts,
+		"error":       message,
+	}).Error("Webhook delivery moved to dead letters")
+}
+
+// update 更新待投递记录，记录已被删除或重放时不修改
+func (s *WebhookService) update(delivery *models.WebhookDelivery, values map[string]interface{}) {
+	if err := s.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ?", delivery.ID, WebhookDeliveryPending, delivery.Attempts).
+		Updates(values).Error; err != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"delivery_id": delivery.ID,
+			"error":       err.Error(),
+		}).Error("Failed to update webhook delivery")
+	}
+}
+
+// sweep 删除超过保留时间的已投递记录
+func (s *WebhookService) sweep(now time.Time) {
+	result := s.db.Unscoped().
+		Where("status = ? AND delivered_at < ?", WebhookDeliveryDelivered, now.Add(-webhookDeliveryRetention)).
+		Delete(&models.WebhookDelivery{})
+	if result.Error != nil {
+		s.logger.WithFields(map[string]interface{}{
+			"error": result.Error.Error(),
+		}).Error("Failed to clean up webhook deliveries")
+		return
+	}
+	if result.RowsAffected > 0 {
+		s.logger.WithFields(map[string]interface{}{
+			"deleted": result.RowsAffected,
+		}).Info("Webhook deliveries cleaned up")
+	}
+}
+
+// checkScope 验证订阅限定的弹窗和代理配置存在
+func (s *WebhookService) checkScope(popupID, proxyConfigID *uuid.UUID) error {
+	if popupID != nil {
+		var count int64
+		if err := s.db.Model(&models.Popup{}).Where("id = ?", *popupID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("popup not found")
+		}
+	}
+	if proxyConfigID != nil {
+		var count int64
+		if err := s.db.Model(&models.ProxyConfig{}).Where("id = ?", *proxyConfigID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("proxy config not found")
+		}
+	}
+	return nil
+}
+
+// newWebhookDelivery 创建待投递记录，投递ID在写入前生成以便写入请求体
+func newWebhookDelivery(webhookID uuid.UUID, event string, data interface{}, submissionID *uuid.UUID, now time.Time) (*models.WebhookDelivery, error) {
+	id := uuid.New()
+	payload, err := json.Marshal(WebhookPayload{ID: id, Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	return &models.WebhookDelivery{
+		BaseModel:     models.BaseModel{ID: id},
+		WebhookID:     webhookID,
+		Event:         event,
+		Payload:       string(payload),
+		SubmissionID:  submissionID,
+		Status:        WebhookDeliveryPending,
+		NextAttemptAt: now,
+	}, nil
+}
+
+// webhookSubmissionOf 返回事件中的提交记录，敏感字段保持加密，发送时再按订阅设置解密或脱敏
+func webhookSubmissionOf(submission *models.Submission, proxyConfigID *uuid.UUID) *WebhookSubmission {
+	formData := json.RawMessage(submission.FormData)
+	if !json.Valid(formData) {
+		formData = json.RawMessage("{}")
+	}
+	return &WebhookSubmission{
+		ID:            submission.ID,
+		PopupID:       submission.PopupID,
+		ProxyConfigID: proxyConfigID,
+		VariantID:     submission.VariantID,
+		VisitorID:     submission.VisitorID,
+		SessionID:     submission.SessionID,
+		FormData:      formData,
+		ReferrerURL:   submission.ReferrerURL,
+		LastStep:      submission.LastStep,
+		IsPartial:     submission.IsPartial,
+		CreatedAt:     submission.CreatedAt,
+		CompletedAt:   submission.CompletedAt,
+
+		DuplicateCount: submission.DuplicateCount,
+	}
+}
+
+// decodeWebhookPayload 解析投递请求体，返回请求体和其中提交记录的表单数据，没有表单数据时返回 false
+func decodeWebhookPayload(raw string) (map[string]interface{}, map[string]interface{}, bool) {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	// 保留数字原样，重新编码时不改变精度
+	decoder.UseNumber()
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, nil, false
+	}
+	data, ok := payload["data"].(map[string]interface{})
+	if !ok {
+		return nil, nil, false
+	}
+	formData, ok := data["form_data"].(map[string]interface{})
+	if !ok {
+		return nil, nil, false
+	}
+	return payload, formData, true
+}
+
+// maskWebhookPayload 把投递请求体中的加密字段值替换为脱敏文本，没有加密字段时原样返回
+func maskWebhookPayload(raw string) string {
+	payload, formData, ok := decodeWebhookPayload(raw)
+	if !ok || !fieldcrypt.MaskData(formData) {
+		return raw
+	}
+	masked, err := json.Marshal(payload)
+	if err != nil {
+		return raw
+	}
+	return string(masked)
+}
+
+// replayValues 重放投递时重置的字段
+func replayValues(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"status":          WebhookDeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"last_error":      "",
+		"response_status": 0,
+		"delivered_at":    nil,
+	}
+}
+
+// validateWebhookURL 验证接收地址是绝对的HTTP(S)地址
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// normalizeWebhookEvents 验证订阅的事件并序列化为JSON数组，重复的事件只保留一个
+func normalizeWebhookEvents(events []string) (string, error) {
+	if len(events) == 0 {
+		return "", errors.New("at least one event is required")
+	}
+	seen := make(map[string]bool, len(events))
+	normalized := make([]string, 0, len(events))
+	for _, event := range events {
+		valid := false
+		for _, known := range WebhookEvents {
+			if event == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return "", fmt.Errorf("unsupported event: %s", event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			normalized = append(normalized, event)
+		}
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// truncateWebhookError 限制记录的错误信息长度
+func truncateWebhookError(message string) string {
+	if utf8.RuneCountInString(message) > webhookResponseLimit {
+		return string([]rune(message)[:webhookResponseLimit])
+	}
+	return message
+}
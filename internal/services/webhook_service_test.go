@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"proxy-enhancer-ultra/internal/config"
+	"proxy-enhancer-ultra/internal/models"
+	"proxy-enhancer-ultra/internal/webhook"
+	"proxy-enhancer-ultra/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+// receivedWebhook 测试接收方收到的请求
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// newWebhookReceiver 启动测试接收方，收到的请求写入返回的通道，status 为响应状态码
+func newWebhookReceiver(t *testing.T, status int, response string) (*httptest.Server, <-chan receivedWebhook) {
+	t.Helper()
+	received := make(chan receivedWebhook, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request body: %v", err)
+		}
+		received <- receivedWebhook{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+// newTestDelivery 创建 submission.completed 事件的投递
+func newTestDelivery(t *testing.T, hook *models.Webhook, formData string) *models.WebhookDelivery {
+	t.Helper()
+	submission := &models.Submission{
+		BaseModel: models.BaseModel{ID: uuid.New(), CreatedAt: time.Now()},
+		PopupID:   uuid.New(),
+		FormData:  formData,
+	}
+	delivery, err := newWebhookDelivery(hook.ID, WebhookEventSubmissionCompleted, webhookSubmissionOf(submission, nil), &submission.ID, time.Now())
+	if err != nil {
+		t.Fatalf("newWebhookDelivery() error = %v", err)
+	}
+	return delivery
+}
+
+func TestWebhookSendRoundTrip(t *testing.T) {
+	const encrypted = `{"name":"Ann","phone":{"$enc":"v1.key.data","mask":"138****5678","bidx":"abc"}}`
+
+	tests := []struct {
+		name          string
+		maskSensitive bool
+		formData      string
+		wantFormData  map[string]interface{}
+	}{
+		{
+			name:         "plaintext fields",
+			formData:     `{"name":"Ann","phone":"13812345678"}`,
+			wantFormData: map[string]interface{}{"name": "Ann", "phone": "13812345678"},
+		},
+		{
+			name:          "masked sensitive fields",
+			maskSensitive: true,
+			formData:      encrypted,
+			wantFormData:  map[string]interface{}{"name": "Ann", "phone": "138****5678"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := newWebhookReceiver(t, http.StatusNoContent, "")
+			hook := &models.Webhook{
+				BaseModel:     models.BaseModel{ID: uuid.New()},
+				URL:           server.URL,
+				Secret:        "whsec_roundtrip_secret",
+				MaskSensitive: tt.maskSensitive,
+			}
+			delivery := newTestDelivery(t, hook, tt.formData)
+			s := NewWebhookService(nil, logger.NewLogrusLogger(), config.WebhookConfig{}, nil)
+
+			status, err := s.send(context.Background(), hook, delivery)
+			if err != nil {
+				t.Fatalf("send() error = %v", err)
+			}
+			if status != http.StatusNoContent {
+				t.Errorf("send() status = %d, want %d", status, http.StatusNoContent)
+			}
+
+			req := <-received
+			if got := req.header.Get(webhook.HeaderEvent); got != WebhookEventSubmissionCompleted {
+				t.Errorf("%s = %q, want %q", webhook.HeaderEvent, got, WebhookEventSubmissionCompleted)
+			}
+			if got := req.header.Get(webhook.HeaderDelivery); got != delivery.ID.String() {
+				t.Errorf("%s = %q, want %q", webhook.HeaderDelivery, got, delivery.ID)
+			}
+			if err := webhook.Verify(hook.Secret, req.header.Get(webhook.HeaderTimestamp), req.body,
+				req.header.Get(webhook.HeaderSignature), webhook.DefaultTolerance, time.Now()); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+
+			var payload struct {
+				ID   uuid.UUID `json:"id"`
+				Data struct {
+					FormData map[string]interface{} `json:"form_data"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(req.body, &payload); err != nil {
+				t.Fatalf("invalid payload: %v", err)
+			}
+			if payload.ID != delivery.ID {
+				t.Errorf("payload id = %s, want %s", payload.ID, delivery.ID)
+			}
+			got, _ := json.Marshal(payload.Data.FormData)
+			want, _ := json.Marshal(tt.wantFormData)
+			if string(got) != string(want) {
+				t.Errorf("form_data = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestWebhookSendReceiverError(t *testing.T) {
+	server, received := newWebhookReceiver(t, http.StatusServiceUnavailable, "try again later")
+	hook := &models.Webhook{BaseModel: models.BaseModel{ID: uuid.New()}, URL: server.URL, Secret: "whsec_roundtrip_secret"}
+	delivery := newTestDelivery(t, hook, `{"name":"Ann"}`)
+	s := NewWebhookService(nil, logger.NewLogrusLogger(), config.WebhookConfig{}, nil)
+
+	status, err := s.send(context.Background(), hook, delivery)
+	<-received
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("send() status = %d, want %d", status, http.StatusServiceUnavailable)
+	}
+	if err == nil || !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "try again later") {
+		t.Errorf("send() error = %v, want status and response body", err)
+	}
+}
+
+func TestWebhookSendEncryptedWithoutKey(t *testing.T) {
+	server, received := newWebhookReceiver(t, http.StatusOK, "")
+	hook := &models.Webhook{BaseModel: models.BaseModel{ID: uuid.New()}, URL: server.URL, Secret: "whsec_roundtrip_secret"}
+	delivery := newTestDelivery(t, hook, `{"phone":{"$enc":"v1.key.data","mask":"138****5678"}}`)
+	s := NewWebhookService(nil, logger.NewLogrusLogger(), config.WebhookConfig{}, nil)
+
+	// 订阅要求原文但无法解密时不能发送密文或脱敏文本
+	if _, err := s.send(context.Background(), hook, delivery); err == nil {
+		t.Fatal("send() error = nil, want decryption error")
+	}
+	select {
+	case <-received:
+		t.Error("receiver got a request for an undecryptable payload")
+	default:
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"encoding/json"
+	"time"
+
+	"proxy-enhancer-ultra/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Webhook事件类型
+const (
+	WebhookEventSubmissionCreated   = "submission.created"   // 新建提交记录，多步表单在保存第一步时触发
+	WebhookEventSubmissionCompleted = "submission.completed" // 提交记录完成，单步表单与 submission.created 同时触发
+	WebhookEventSubmissionDuplicate = "submission.duplicate" // 收到重复提交，发送被更新或合并后的已有提交记录
+	WebhookEventPing                = "ping"                 // 测试投递，不需要订阅
+)
+
+// WebhookEvents 可以订阅的事件类型
+var WebhookEvents = []string{WebhookEventSubmissionCreated, WebhookEventSubmissionCompleted, WebhookEventSubmissionDuplicate}
+
+// Webhook投递状态
+const (
+	WebhookDeliveryPending   = "pending"   // 等待投递或重试
+	WebhookDeliveryDelivered = "delivered" // 接收方返回2xx
+	WebhookDeliveryDead      = "dead"      // 重试次数用完，进入死信列表，可以重放
+)
+
+// CreateWebhookRequest 创建Webhook请求
+type CreateWebhookRequest struct {
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	Secret        string     `json:"secret"` // 为空时自动生成
+	Events        []string   `json:"events"`
+	PopupID       *uuid.UUID `json:"popup_id"`
+	ProxyConfigID *uuid.UUID `json:"proxy_config_id"`
+	IsActive      *bool      `json:"is_active"`      // 为空时启用
+	MaskSensitive bool       `json:"mask_sensitive"` // 敏感字段只发送脱敏文本，默认发送原文，启用加密时需要解密权限
+	Description   string     `json:"description"`
+
+	Actor SubmissionActor `json:"-"`
+}
+
+// UpdateWebhookRequest 更新Webhook请求，为空的字段不修改
+type UpdateWebhookRequest struct {
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	Events        []string   `json:"events"`
+	PopupID       *uuid.UUID `json:"popup_id"`
+	ProxyConfigID *uuid.UUID `json:"proxy_config_id"`
+	ClearPopup    bool       `json:"clear_popup"`        // 取消弹窗限制
+	ClearProxy    bool       `json:"clear_proxy_config"` // 取消代理配置限制
+	IsActive      *bool      `json:"is_active"`
+	MaskSensitive *bool      `json:"mask_sensitive"` // 改为发送原文时需要解密权限
+	Description   *string    `json:"description"`
+
+	Actor SubmissionActor `json:"-"`
+}
+
+// WebhookWithSecret 创建Webhook或轮换密钥时返回的结果，只有这两个接口返回签名密钥
+type WebhookWithSecret struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookDeliveryFilter 投递记录过滤条件
+type WebhookDeliveryFilter struct {
+	WebhookID *uuid.UUID
+	Status    string
+}
+
+// WebhookPayload 投递的请求体
+type WebhookPayload struct {
+	ID        uuid.UUID   `json:"id"`    // 投递ID，与 X-Webhook-Delivery 请求头相同
+	Event     string      `json:"event"` // 事件类型
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookSubmission 事件中的提交记录，不包含访客IP等仅供后台查看的信息
+type WebhookSubmission struct {
+	ID            uuid.UUID       `json:"id"`
+	PopupID       uuid.UUID       `json:"popup_id"`
+	ProxyConfigID *uuid.UUID      `json:"proxy_config_id,omitempty"`
+	VariantID     *uuid.UUID      `json:"variant_id,omitempty"`
+	VisitorID     string          `json:"visitor_id,omitempty"`
+	SessionID     string          `json:"session_id,omitempty"`
+	FormData      json.RawMessage `json:"form_data"`
+	ReferrerURL   string          `json:"referrer_url,omitempty"`
+	LastStep      string          `json:"last_step,omitempty"`
+	IsPartial     bool            `json:"is_partial"`
+	CreatedAt     time.Time       `json:"created_at"`
+	CompletedAt   *time.Time      `json:"completed_at,omitempty"`
+
+	DuplicateCount int `json:"duplicate_count"` // 被拒绝、更新或合并到该记录的重复提交次数
+}
@@ -0,0 +1,66 @@
+// Package storage 提供文件存储抽象，支持本地文件系统和S3兼容对象存储
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"proxy-enhancer-ultra/internal/config"
+)
+
+// ErrNotFound 文件不存在
+var ErrNotFound = errors.New("file not found")
+
+// Storage 文件存储后端，键为以 / 分隔的相对路径
+type Storage interface {
+	// Put 保存文件，size 为内容的字节数，同名文件会被覆盖
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open 打开文件，不存在时返回 ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 删除文件，文件不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+}
+
+// New 根据配置创建存储后端
+func New(cfg config.StorageConfig) (Storage, error) {
+	cfg = cfg.WithDefaults()
+	switch cfg.Driver {
+	case config.StorageDriverLocal:
+		return NewLocalStorage(cfg.Local.Path)
+	case config.StorageDriverS3:
+		return NewS3Storage(cfg.S3)
+	}
+	return nil, fmt.Errorf("unsupported storage driver %q", cfg.Driver)
+}
+
+// ValidateKey 校验文件键，只允许字母、数字和 ._- 组成的路径段，不允许 . 和 .. 段
+func ValidateKey(key string) error {
+	if key == "" || len(key) > 512 {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid storage key %q", key)
+		}
+		for _, r := range segment {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+				return fmt.Errorf("invalid storage key %q", key)
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteAll 删除多个文件，某个文件删除失败时继续删除其余的文件，返回所有失败的错误
+func DeleteAll(ctx context.Context, s Storage, keys ...string) error {
+	var errs []error
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
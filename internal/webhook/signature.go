@@ -0,0 +1,94 @@
+// Package webhook 提供Webhook投递使用的签名、签名校验和重试间隔计算，接收方也可以用 Verify 校验请求
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 投递请求的请求头
+const (
+	HeaderEvent     = "X-Webhook-Event"     // 事件类型，如 submission.completed
+	HeaderDelivery  = "X-Webhook-Delivery"  // 投递ID，重试和重放时不变，接收方可以据此去重
+	HeaderTimestamp = "X-Webhook-Timestamp" // 签名时间，Unix秒
+	HeaderSignature = "X-Webhook-Signature" // 签名，格式为 sha256=<hex>
+)
+
+// signaturePrefix 签名的算法前缀
+const signaturePrefix = "sha256="
+
+// secretPrefix 自动生成的密钥前缀
+const secretPrefix = "whsec_"
+
+// DefaultTolerance 校验签名时允许的时间偏差
+const DefaultTolerance = 5 * time.Minute
+
+// 签名校验错误
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredTimestamp = errors.New("webhook timestamp outside tolerance")
+)
+
+// Sign 计算签名：HMAC-SHA256(secret, "<timestamp>.<body>")，时间戳参与签名以防止重放旧请求
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验请求头中的时间戳和签名，tolerance 为0时不检查时间
+func Verify(secret, timestamp string, body []byte, signature string, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		diff := now.Sub(time.Unix(ts, 0))
+		if diff < -tolerance || diff > tolerance {
+			return ErrExpiredTimestamp
+		}
+	}
+	return nil
+}
+
+// NewSecret 生成随机签名密钥
+func NewSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Backoff 返回第 attempt 次投递失败后的重试间隔，从 base 开始每次翻倍，不超过 max
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{
+			name:      "json body",
+			secret:    "whsec_test",
+			timestamp: 1700000000,
+			body:      `{"id":"1"}`,
+			want:      "sha256=11bf4466ea17c3df3fd743af0b435368e16b7a05eb8eced85e8c4670767bdec5",
+		},
+		{
+			name:      "empty body",
+			secret:    "secret",
+			timestamp: 0,
+			body:      "",
+			want:      "sha256=3445798a051818ef95def46c2eb62b43d377ce6e3c29b4d0aec3da0e59577f79",
+		},
+		{
+			name:      "utf-8 secret",
+			secret:    "密钥",
+			timestamp: 1760000000,
+			body:      "hello world",
+			want:      "sha256=9d914f9e8b8f0249a74d8a2fea83d04c5d3e23a472853b5ed3a842bc9d18592e",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"id":"1"}`)
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	signature := Sign(secret, now.Unix(), body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		signature string
+		tolerance time.Duration
+		now       time.Time
+		want      error
+	}{
+		{"valid", secret, ts, body, signature, DefaultTolerance, now, nil},
+		{"valid within tolerance", secret, ts, body, signature, DefaultTolerance, now.Add(4 * time.Minute), nil},
+		{"no tolerance check", secret, ts, body, signature, 0, now.Add(24 * time.Hour), nil},
+		{"wrong secret", "whsec_other", ts, body, signature, DefaultTolerance, now, ErrInvalidSignature},
+		{"tampered body", secret, ts, []byte(`{"id":"2"}`), signature, DefaultTolerance, now, ErrInvalidSignature},
+		{"tampered timestamp", secret, strconv.FormatInt(now.Unix()+1, 10), body, signature, DefaultTolerance, now, ErrInvalidSignature},
+		{"invalid timestamp", secret, "yesterday", body, signature, DefaultTolerance, now, ErrInvalidSignature},
+		{"missing prefix", secret, ts, body, strings.TrimPrefix(signature, signaturePrefix), DefaultTolerance, now, ErrInvalidSignature},
+		{"uppercase hex", secret, ts, body, signaturePrefix + strings.ToUpper(strings.TrimPrefix(signature, signaturePrefix)), DefaultTolerance, now, ErrInvalidSignature},
+		{"expired", secret, ts, body, signature, DefaultTolerance, now.Add(6 * time.Minute), ErrExpiredTimestamp},
+		{"from the future", secret, ts, body, signature, DefaultTolerance, now.Add(-6 * time.Minute), ErrExpiredTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.timestamp, tt.body, tt.signature, tt.tolerance, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	first, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret() error = %v", err)
+	}
+	second, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret() error = %v", err)
+	}
+	if !strings.HasPrefix(first, secretPrefix) {
+		t.Errorf("NewSecret() = %s, want prefix %s", first, secretPrefix)
+	}
+	if first == second {
+		t.Errorf("NewSecret() returned the same secret twice")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 30*time.Second, time.Hour
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			if got := Backoff(tt.attempt, base, max); got != tt.want {
+				t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
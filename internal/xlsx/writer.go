@@ -0,0 +1,268 @@
+// Package xlsx 提供只包含一个工作表的XLSX文件写入器，按行流式写入，不依赖第三方库
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxCellLength Excel单元格最多容纳的字符数，超出部分被截断
+const MaxCellLength = 32767
+
+// MaxRows 一个工作表最多容纳的行数
+const MaxRows = 1048576
+
+// maxSheetNameLength 工作表名称的最大长度
+const maxSheetNameLength = 31
+
+// 单元格样式序号，对应 styles.xml 中的 cellXfs
+const (
+	styleDefault = 0
+	styleHeader  = 1
+	styleDate    = 2
+)
+
+// ErrTooManyRows 写入的行数超过工作表上限
+var ErrTooManyRows = errors.New("xlsx: too many rows")
+
+// Writer XLSX写入器，第一行可以通过 WriteHeader 写为加粗并冻结的表头
+type Writer struct {
+	zip    *zip.Writer
+	sheet  *bufio.Writer
+	rows   int
+	closed bool
+}
+
+// NewWriter 创建写入器并写入除工作表数据以外的文件部件，写完后必须调用 Close
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	}
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", rootRelsXML},
+		{"xl/workbook.xml", fmt.Sprintf(workbookXML, escape(normalizeSheetName(sheetName)))},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML},
+		{"xl/styles.xml", stylesXML},
+	}
+	for _, part := range parts {
+		f, err := create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, xml.Header+part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	sheet.WriteString(xml.Header + sheetHeaderXML)
+	return &Writer{zip: zw, sheet: sheet}, nil
+}
+
+// WriteHeader 写入加粗的表头行，只能作为第一行写入，滚动时表头保持可见
+func (w *Writer) WriteHeader(titles []string) error {
+	if w.rows > 0 {
+		return errors.New("xlsx: header must be the first row")
+	}
+	values := make([]interface{}, len(titles))
+	for i, title := range titles {
+		values[i] = title
+	}
+	return w.writeRow(values, styleHeader)
+}
+
+// WriteRow 写入一行
+//
+// 字符串写为文本，整数、浮点数写为数字，bool 写为逻辑值，time.Time 写为日期时间，
+// nil 写为空单元格，其他类型按 fmt.Sprint 写为文本
+func (w *Writer) WriteRow(values []interface{}) error {
+	return w.writeRow(values, styleDefault)
+}
+
+// Close 写入工作表结尾并结束ZIP文件，不关闭底层的 io.Writer
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.sheet.WriteString(sheetFooterXML)
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+// writeRow 写入一行，style 为整行文本和数字单元格使用的样式，日期时间单元格始终使用日期样式
+func (w *Writer) writeRow(values []interface{}, style int) error {
+	if w.closed {
+		return errors.New("xlsx: writer is closed")
+	}
+	if w.rows >= MaxRows {
+		return ErrTooManyRows
+	}
+	w.rows++
+	row := strconv.Itoa(w.rows)
+
+	b := w.sheet
+	b.WriteString(`<row r="` + row + `">`)
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		ref := columnName(i) + row
+		switch v := value.(type) {
+		case string:
+			writeStringCell(b, ref, v, style)
+		case bool:
+			text := "0"
+			if v {
+				text = "1"
+			}
+			writeCell(b, ref, "b", text, style)
+		case int:
+			writeCell(b, ref, "", strconv.Itoa(v), style)
+		case int64:
+			writeCell(b, ref, "", strconv.FormatInt(v, 10), style)
+		case uint:
+			writeCell(b, ref, "", strconv.FormatUint(uint64(v), 10), style)
+		case float64:
+			writeCell(b, ref, "", strconv.FormatFloat(v, 'f', -1, 64), style)
+		case time.Time:
+			if v.IsZero() {
+				continue
+			}
+			writeCell(b, ref, "", strconv.FormatFloat(excelTime(v), 'f', -1, 64), styleDate)
+		default:
+			writeStringCell(b, ref, fmt.Sprint(v), style)
+		}
+	}
+	_, err := b.WriteString(`</row>`)
+	return err
+}
+
+// writeCell 写入数字或逻辑值单元格
+func writeCell(b *bufio.Writer, ref, cellType, value string, style int) {
+	b.WriteString(`<c r="` + ref + `"`)
+	if cellType != "" {
+		b.WriteString(` t="` + cellType + `"`)
+	}
+	if style != styleDefault {
+		b.WriteString(` s="` + strconv.Itoa(style) + `"`)
+	}
+	b.WriteString(`><v>` + value + `</v></c>`)
+}
+
+// writeStringCell 以内联字符串写入文本单元格，不需要共享字符串表
+func writeStringCell(b *bufio.Writer, ref, value string, style int) {
+	if value == "" {
+		return
+	}
+	if utf8.RuneCountInString(value) > MaxCellLength {
+		value = string([]rune(value)[:MaxCellLength])
+	}
+	b.WriteString(`<c r="` + ref + `" t="inlineStr"`)
+	if style != styleDefault {
+		b.WriteString(` s="` + strconv.Itoa(style) + `"`)
+	}
+	b.WriteString(`><is><t xml:space="preserve">` + escape(value) + `</t></is></c>`)
+}
+
+// columnName 返回从0开始的列序号对应的列名，如 0 -> A、26 -> AA
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// excelTime 把时间转换为Excel的日期序列值，按时间自身的时区显示
+func excelTime(t time.Time) float64 {
+	_, offset := t.Zone()
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	local := t.Add(time.Duration(offset) * time.Second).UTC()
+	return local.Sub(epoch).Hours() / 24
+}
+
+// escape 转义XML文本，XML不允许的控制字符替换为 U+FFFD
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// normalizeSheetName 去掉工作表名称中不允许的字符并限制长度
+func normalizeSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if utf8.RuneCountInString(name) > maxSheetNameLength {
+		name = string([]rune(name)[:maxSheetNameLength])
+	}
+	if name == "" {
+		name = "Sheet1"
+	}
+	return name
+}
+
+const contentTypesXML = `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const rootRelsXML = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookXML = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const workbookRelsXML = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// stylesXML 样式表：0 默认、1 加粗表头、2 日期时间
+const stylesXML = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// sheetHeaderXML 工作表开头，冻结第一行
+const sheetHeaderXML = `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>` +
+	`<sheetData>`
+
+const sheetFooterXML = `</sheetData></worksheet>`
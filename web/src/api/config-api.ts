@@ -39,7 +39,7 @@ export const updateSecurityConfig = (config: SystemConfig['security']) => {
 }
 
 export const getEmailConfig = () => {
-  return api.get<ApiResponse<SystemConfig['email']>>('/monitoring/dashboard')
+  return api.get<ApiResponse<SystemConfig['email']>>('/notifications/email')
 }
 
 export const updateEmailConfig = (config: SystemConfig['email']) => {
@@ -87,11 +87,12 @@ export const validateConfig = (key: string, value: any) => {
 }
 
 // 测试配置
-export const testEmailConfig = (config: SystemConfig['email']) => {
+// 发送测试邮件，to 为空时发送给发件人地址
+export const testEmailConfig = (config: SystemConfig['email'], to?: string) => {
   return api.post<ApiResponse<{
     success: boolean
     message: string
-  }>>('/monitoring/dashboard', config)
+  }>>('/notifications/email/test', { ...config, to })
 }
 
 export const testSmsConfig = (config: SystemConfig['sms']) => {
@@ -87,6 +87,7 @@ export interface SubmissionData {
   referrer?: string
   submittedAt: string
   processed?: boolean
+  status?: 'new' | 'contacted' | 'qualified' | 'spam'
   tags?: string[]
 }
 
@@ -167,14 +168,14 @@ export const getSubmissionDetail = (id: string) => {
   return api.get<ApiResponse<SubmissionData>>(`/submissions/${id}`)
 }
 
-// 标记提交数据为已处理
-export const markSubmissionProcessed = (id: string) => {
-  return api.patch<ApiResponse<void>>(`/submissions/${id}/processed`)
+// 标记提交数据为已处理，不传状态时标记为 contacted
+export const markSubmissionProcessed = (id: string, status?: 'new' | 'contacted' | 'qualified' | 'spam') => {
+  return api.patch<ApiResponse<void>>(`/submissions/${id}/processed`, { status })
 }
 
 // 批量标记提交数据为已处理
-export const batchMarkSubmissionProcessed = (ids: string[]) => {
-  return api.patch<ApiResponse<void>>('/submissions/batch/processed', { ids })
+export const batchMarkSubmissionProcessed = (ids: string[], status?: 'new' | 'contacted' | 'qualified' | 'spam') => {
+  return api.patch<ApiResponse<void>>('/submissions/batch/processed', { ids, status })
 }
 
 // 删除提交数据
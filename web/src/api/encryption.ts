@@ -0,0 +1,20 @@
+import api from './index'
+import type { DataKey, EncryptionStatus } from '@/types'
+
+// 提交敏感字段加密相关API（管理员）
+export const encryptionApi = {
+  // 获取加密配置、数据密钥和拥有解密权限的角色
+  getStatus() {
+    return api.get<EncryptionStatus>('/encryption')
+  },
+
+  // 轮换数据密钥，已有的提交在后台重新加密
+  rotateDataKey() {
+    return api.post<DataKey>('/encryption/rotate')
+  },
+
+  // 设置拥有解密权限的角色
+  updateDecryptRoles(roles: string[]) {
+    return api.put<{ roles: string[] }>('/encryption/decrypt-roles', { roles })
+  }
+}
@@ -1,5 +1,23 @@
 import api from './index'
-import type { Popup, Submission, PaginatedResponse } from '@/types'
+import type {
+  Popup,
+  PopupTranslation,
+  PopupTranslationInput,
+  TranslationBundle,
+  TranslationImportResult,
+  Submission,
+  SubmissionNote,
+  SubmissionStatus,
+  BatchUpdateResult,
+  AuditLog,
+  ExportJob,
+  PopupNotification,
+  PaginatedResponse,
+  SourceAnalyticsParams,
+  SourceBreakdown,
+  SourceDimension,
+  SourceTimeSeries
+} from '@/types'
 import type { ApiResponse } from './index'
 
 // 弹窗管理相关API
@@ -47,6 +65,31 @@ export const popupApi = {
   // 复制弹窗
   duplicatePopup(id: number, name: string) {
     return api.post<Popup>(`/popups/${id}/duplicate`, { name })
+  },
+  
+  // 获取弹窗翻译
+  getTranslations(id: string) {
+    return api.get<{ data: PopupTranslation[] }>(`/popups/${id}/translations`)
+  },
+  
+  // 创建或替换某个语言的翻译
+  saveTranslation(id: string, locale: string, data: PopupTranslationInput) {
+    return api.put<{ data: PopupTranslation }>(`/popups/${id}/translations/${encodeURIComponent(locale)}`, data)
+  },
+  
+  // 删除某个语言的翻译
+  deleteTranslation(id: string, locale: string) {
+    return api.delete<null>(`/popups/${id}/translations/${encodeURIComponent(locale)}`)
+  },
+  
+  // 导出翻译文件，popup_ids 为逗号分隔的弹窗ID，为空时导出所有弹窗
+  exportTranslations(params: { locale: string; popup_ids?: string }) {
+    return api.get<TranslationBundle>('/popups/translations/export', { params })
+  },
+  
+  // 导入翻译人员填写的翻译文件
+  importTranslations(bundle: TranslationBundle) {
+    return api.post<{ data: TranslationImportResult }>('/popups/translations/import', bundle)
   }
 }
 
@@ -60,14 +103,74 @@ export const submissionApi = {
     start_date?: string
     end_date?: string
     search?: string
+    status?: string // 处理状态，多个用逗号分隔
+    processed?: boolean
+    tag?: string
+    assignee_id?: string // 'none' 表示未分配
+    field?: string[] // 表单字段条件 字段:比较方式[:值]，比较方式为 eq、contains、prefix、exists、gt、gte、lt、lte
+    ip?: string // IP地址或CIDR网段
+    referrer?: string
+    user_agent?: string
+    sort?: string // created_at、updated_at、completed_at、processed_at、status 或 form.<字段名>，前缀 - 表示倒序
   }) {
-    return api.get<PaginatedResponse<Submission>>('/submissions', { params })
+    // 多个 field 条件使用重复的参数名传递
+    return api.get<PaginatedResponse<Submission>>('/submissions', { params, paramsSerializer: { indexes: null } })
+  },
+
+  // 更新提交处理状态，不传状态时标记为 contacted
+  updateSubmissionStatus(id: string, status?: SubmissionStatus) {
+    return api.patch<Submission>(`/submissions/${id}/processed`, { status })
+  },
+
+  // 替换提交的全部标签
+  setSubmissionTags(id: string, tags: string[]) {
+    return api.patch<Submission>(`/submissions/${id}/tags`, { tags })
+  },
+
+  // 分配提交负责人，assigneeId 为 null 时取消分配
+  assignSubmission(id: string, assigneeId: string | null) {
+    return api.patch<Submission>(`/submissions/${id}/assignee`, { assignee_id: assigneeId })
+  },
+
+  // 获取提交备注
+  getSubmissionNotes(id: string) {
+    return api.get<SubmissionNote[]>(`/submissions/${id}/notes`)
+  },
+
+  // 添加提交备注
+  addSubmissionNote(id: string, body: string) {
+    return api.post<SubmissionNote>(`/submissions/${id}/notes`, { body })
+  },
+
+  // 获取提交处理历史
+  getSubmissionHistory(id: string, params?: { page?: number; pageSize?: number }) {
+    return api.get<{ history: AuditLog[]; total: number; page: number; pageSize: number }>(`/submissions/${id}/history`, { params })
+  },
+
+  // 批量更新提交处理状态
+  batchUpdateSubmissionStatus(ids: string[], status?: SubmissionStatus) {
+    return api.patch<BatchUpdateResult>('/submissions/batch/processed', { ids, status })
+  },
+
+  // 批量添加和移除提交标签
+  batchUpdateSubmissionTags(ids: string[], add: string[], remove: string[] = []) {
+    return api.patch<BatchUpdateResult>('/submissions/batch/tags', { ids, add, remove })
+  },
+
+  // 批量分配提交负责人
+  batchAssignSubmissions(ids: string[], assigneeId: string | null) {
+    return api.patch<BatchUpdateResult>('/submissions/batch/assignee', { ids, assignee_id: assigneeId })
   },
   
   // 获取单个提交数据
   getSubmission(id: number) {
     return api.get<Submission>(`/submissions/${id}`)
   },
+
+  // 获取敏感字段为原文的提交数据，需要解密权限，每次查看记录审计日志
+  decryptSubmission(id: string) {
+    return api.get<Submission>(`/submissions/${id}/decrypt`)
+  },
   
   // 删除提交数据
   deleteSubmission(id: number) {
@@ -84,9 +187,12 @@ export const submissionApi = {
     popup_id?: number
     start_date?: string
     end_date?: string
-    format?: 'csv' | 'excel' | 'json'
+    format?: 'csv' | 'excel' | 'xlsx' | 'json'
+    columns?: 'schema' | 'union' // 表单字段列：按弹窗表单配置或所有提交中出现过的字段
+    bom?: boolean // CSV开头写入UTF-8 BOM，便于Excel识别编码
+    decrypt?: boolean // 导出敏感字段原文，需要解密权限
   }) {
-    return api.get<{ download_url: string }>('/submissions/export', { params })
+    return api.get<Blob>('/submissions/export', { params, responseType: 'blob' })
   },
   
   // 获取提交数据统计
@@ -98,9 +204,72 @@ export const submissionApi = {
   }) {
     return api.get<{
       total_submissions: number
+      raw_submissions: number // 包括被去重的重复提交
+      duplicate_submissions: number
+      unique_leads: number
       unique_visitors: number
       conversion_rate: number
       chart_data: { date: string; count: number }[]
     }>('/submissions/stats', { params })
+  },
+  
+  // 按来源维度统计提交，用于把线索归因到来源和推广活动
+  getSubmissionSources(params: SourceAnalyticsParams & { dimension: SourceDimension }) {
+    return api.get<SourceBreakdown>('/submissions/analytics/sources', { params })
+  },
+  
+  // 按小时、天或周统计提交来源，指定维度时返回提交最多的维度值各自的趋势
+  getSubmissionSourceTimeSeries(params?: SourceAnalyticsParams) {
+    return api.get<SourceTimeSeries>('/submissions/analytics/timeseries', { params })
+  },
+  
+  // 创建后台导出任务，适用于数据量较大的导出
+  createExportJob(data: {
+    popup_id: string
+    format: 'json' | 'csv' | 'xlsx'
+    columns?: 'schema' | 'union'
+    bom?: boolean
+    start_date?: string
+    end_date?: string
+    decrypt?: boolean
+  }) {
+    return api.post<ExportJob>('/exports', data)
+  },
+  
+  // 获取当前用户的导出任务列表
+  getExportJobs(params?: { page?: number; pageSize?: number }) {
+    return api.get<{ jobs: ExportJob[]; total: number; page: number; pageSize: number }>('/exports', { params })
+  },
+  
+  // 获取导出任务进度
+  getExportJob(id: string) {
+    return api.get<ExportJob>(`/exports/${id}`)
+  },
+  
+  // 下载已完成的导出文件
+  downloadExportJob(id: string) {
+    return api.get<Blob>(`/exports/${id}/download`, { responseType: 'blob' })
+  },
+  
+  // 删除导出任务，正在执行的任务会被中止
+  deleteExportJob(id: string) {
+    return api.delete<null>(`/exports/${id}`)
+  },
+  
+  // 获取弹窗的提交通知设置
+  getNotificationSettings(id: string) {
+    return api.get<PopupNotification>(`/popups/${id}/notifications`)
+  },
+  
+  // 保存弹窗的提交通知设置，模板为空时使用默认模板
+  updateNotificationSettings(id: string, data: {
+    mode: PopupNotification['mode']
+    recipients: string[]
+    subject_template?: string
+    body_template?: string
+    digest_hour?: number
+    mask_sensitive?: boolean // 发送原文需要解密权限
+  }) {
+    return api.put<PopupNotification>(`/popups/${id}/notifications`, data)
   }
 }
\ No newline at end of file
@@ -0,0 +1,20 @@
+import api from './index'
+import type { ErasureResult, RetentionRun, RetentionStatus } from '@/types'
+
+// 数据保留和个人数据删除相关API（管理员）
+export const retentionApi = {
+  // 获取保留配置、单独设置了保留策略的弹窗和最近一次清理的结果
+  getStatus() {
+    return api.get<RetentionStatus>('/retention')
+  },
+
+  // 立即执行一次清理
+  run() {
+    return api.post<RetentionRun>('/retention/run')
+  },
+
+  // 删除所有弹窗中包含指定邮箱或手机号的提交，dry_run 时只返回匹配的提交
+  eraseSubject(data: { email?: string; phone?: string; dry_run?: boolean }) {
+    return api.post<ErasureResult>('/retention/erasure', data)
+  }
+}
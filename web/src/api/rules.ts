@@ -64,6 +64,41 @@ export interface RuleExecutionLog {
   clientIp?: string
 }
 
+// 规则试运行中单条规则的执行结果
+export interface RuleApplication {
+  rule_id: string
+  rule_name: string
+  priority: number
+  selector: string
+  actions: string[]
+  matched: number
+  skipped?: boolean
+  overlaps?: string[]
+  duration_us: number
+  error?: string
+}
+
+// 试运行前后页面的节点差异
+export interface RuleTestDiffEntry {
+  op: 'insert' | 'delete'
+  path: string
+  depth: number
+  node: string
+}
+
+// 规则试运行结果
+export interface RuleTestResult {
+  matched: boolean
+  target_url: string
+  status_code: number
+  original_html: string
+  transformed_html: string
+  diff: RuleTestDiffEntry[]
+  diff_truncated: boolean
+  rules: RuleApplication[]
+  fetch_time: number
+}
+
 // 获取规则列表
 export const getRuleList = (params: PageParams & {
   type?: string
@@ -98,14 +133,12 @@ export const batchDeleteRule = (ids: number[]) => {
   return api.delete<ApiResponse<void>>('/rules/batch', { data: { ids } })
 }
 
-// 测试规则
-export const testRule = (id: number, testUrl: string) => {
-  return api.post<ApiResponse<{
-    matched: boolean
-    action: string
-    proxyId?: number
-    responseTime: number
-  }>>(`/rules/${id}/test`, { url: testUrl })
+// 测试规则，未指定代理配置时使用规则唯一绑定的代理配置
+export const testRule = (id: number | string, testUrl: string, proxyConfigId?: string) => {
+  return api.post<{ data: RuleTestResult }>(`/rules/${id}/test`, {
+    url: testUrl,
+    proxy_config_id: proxyConfigId
+  })
 }
 
 // 启用/禁用规则
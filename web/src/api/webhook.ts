@@ -0,0 +1,76 @@
+import api from './index'
+import type { Webhook, WebhookWithSecret, WebhookDelivery, WebhookEvent } from '@/types'
+
+export interface WebhookInput {
+  name?: string
+  url?: string
+  secret?: string
+  events?: WebhookEvent[]
+  popup_id?: string | null
+  proxy_config_id?: string | null
+  clear_popup?: boolean
+  clear_proxy_config?: boolean
+  is_active?: boolean
+  mask_sensitive?: boolean // 敏感字段只发送脱敏文本，发送原文需要解密权限
+  description?: string
+}
+
+type DeliveryPage = { deliveries: WebhookDelivery[]; total: number; page: number; pageSize: number }
+
+// Webhook管理相关API（管理员）
+export const webhookApi = {
+  // 获取Webhook列表
+  getWebhooks(params?: { page?: number; pageSize?: number }) {
+    return api.get<{ webhooks: Webhook[]; total: number; page: number; pageSize: number }>('/webhooks', { params })
+  },
+
+  // 获取单个Webhook
+  getWebhook(id: string) {
+    return api.get<Webhook>(`/webhooks/${id}`)
+  },
+
+  // 创建Webhook，签名密钥只在响应中返回一次
+  createWebhook(data: WebhookInput) {
+    return api.post<WebhookWithSecret>('/webhooks', data)
+  },
+
+  // 更新Webhook
+  updateWebhook(id: string, data: WebhookInput) {
+    return api.put<Webhook>(`/webhooks/${id}`, data)
+  },
+
+  // 删除Webhook和投递记录
+  deleteWebhook(id: string) {
+    return api.delete<null>(`/webhooks/${id}`)
+  },
+
+  // 轮换签名密钥
+  rotateSecret(id: string) {
+    return api.post<WebhookWithSecret>(`/webhooks/${id}/rotate-secret`)
+  },
+
+  // 发送 ping 测试事件
+  testWebhook(id: string) {
+    return api.post<WebhookDelivery>(`/webhooks/${id}/test`)
+  },
+
+  // 获取Webhook的投递记录
+  getDeliveries(id: string, params?: { status?: WebhookDelivery['status']; page?: number; pageSize?: number }) {
+    return api.get<DeliveryPage>(`/webhooks/${id}/deliveries`, { params })
+  },
+
+  // 获取死信列表
+  getDeadLetters(params?: { webhook_id?: string; page?: number; pageSize?: number }) {
+    return api.get<DeliveryPage>('/webhooks/dead-letters', { params })
+  },
+
+  // 重放单条投递
+  replayDelivery(id: string) {
+    return api.post<WebhookDelivery>(`/webhooks/deliveries/${id}/replay`)
+  },
+
+  // 重放Webhook的所有死信
+  replayDeadLetters(id: string) {
+    return api.post<{ replayed: number }>(`/webhooks/${id}/replay-dead`)
+  }
+}
@@ -67,14 +67,24 @@ export interface Domain extends BaseModel {
   is_active: boolean
 }
 
+// 规则、弹窗与代理配置的绑定
+export interface ProxyConfigBinding {
+  proxy_config_id: string
+  created_at: string
+  proxy_config?: ProxyConfig
+}
+
 // 规则引擎类型
 export interface Rule extends BaseModel {
   name: string
   description?: string
+  rule_type?: string
   conditions: RuleCondition[]
   actions: RuleAction[]
   is_active: boolean
   priority: number
+  is_global: boolean
+  proxy_configs?: ProxyConfigBinding[]
 }
 
 export interface RuleCondition {
@@ -95,22 +105,231 @@ export interface Popup extends BaseModel {
   form_config: FormConfig
   trigger_rules: TriggerRule[]
   is_active: boolean
+  is_global: boolean
+  proxy_configs?: ProxyConfigBinding[]
+  variants?: PopupVariant[]
+  default_locale?: string // 原文语言，没有匹配的翻译时使用原文
+  translations?: PopupTranslation[]
+  display_rules?: PopupDisplayRules
+  style_config?: PopupStyleConfig
+  trigger_type?: PopupTriggerType
+  trigger_value?: string
+  trigger_config?: PopupAPICallTrigger | Record<string, never>
+  start_at?: string | null
+  end_at?: string | null
+  timezone?: string
+  weekly_schedule?: PopupWeeklySlot[]
+  schedule_status?: '' | 'pending' | 'active' | 'off_hours' | 'expired'
+  retention?: PopupRetention
+  dedup?: PopupDedup
+}
+
+// 弹窗提交数据保留策略，创建/更新弹窗时通过 retention 字段提交，{} 表示使用全局配置
+export interface PopupRetention {
+  days?: number
+  mode?: RetentionMode
+  forever?: boolean
+}
+
+export type RetentionMode = 'delete' | 'anonymize'
+
+// 弹窗提交去重配置，去重字段的值都相同且在时间窗口内的完成提交视为重复提交，{} 表示不去重
+export interface PopupDedup {
+  fields?: string[]
+  window_hours?: number // 为 0 时不限制时间
+  action?: DedupAction // 默认 reject，重复提交返回 409
+}
+
+export type DedupAction = 'reject' | 'update' | 'merge'
+
+// 弹窗样式配置，弹窗渲染在 Shadow DOM 中，页面样式不会影响弹窗
+export interface PopupStyleConfig {
+  position?: 'center' | 'top' | 'bottom' | 'left' | 'right' | 'top-left' | 'top-right' | 'bottom-left' | 'bottom-right'
+  width?: string
+  hide_overlay?: boolean
+  colors?: {
+    background?: string
+    text?: string
+    accent?: string
+    overlay?: string
+  }
+  font?: {
+    family?: string
+    size?: string
+  }
+  radius?: string
+  animation?: 'fade' | 'slide' | 'zoom' | 'none'
+  mobile?: {
+    layout?: 'fullscreen' | 'bottom_sheet'
+    breakpoint?: number
+  }
+}
+
+export type PopupTriggerType =
+  | 'page_load'
+  | 'time_delay'
+  | 'scroll_percentage'
+  | 'element_click'
+  | 'exit_intent'
+  | 'form_submit'
+  | 'api_call'
+
+// 接口调用触发条件，创建/更新弹窗时通过 api_call 字段提交
+export interface PopupAPICallTrigger {
+  methods?: string[]
+  url_pattern: string
+  statuses?: string[]
+  next_page?: boolean
+}
+
+// 弹窗投放排期，创建/更新弹窗时通过 schedule 字段提交
+export interface PopupSchedule {
+  start_at?: string
+  end_at?: string
+  timezone?: string
+  weekly?: PopupWeeklySlot[]
+}
+
+export interface PopupWeeklySlot {
+  days: Array<'mon' | 'tue' | 'wed' | 'thu' | 'fri' | 'sat' | 'sun'>
+  start: string
+  end: string
+}
+
+export interface PopupDisplayRules {
+  frequency?: {
+    once_per_session?: boolean
+    max_per_day?: number
+    stop_after_submit?: boolean
+    stop_after_close?: boolean
+  }
+  audience?: {
+    visitor?: 'new' | 'returning'
+    min_page_views?: number
+    max_page_views?: number
+    utm_sources?: string[]
+  }
+}
+
+export interface PopupVariant extends BaseModel {
+  popup_id: string
+  name: string
+  title: string
+  content: string
+  style_config: Record<string, any>
+  weight: number
+  is_control: boolean
+  is_active: boolean
+}
+
+// 弹窗翻译，注入时按 URL 语言前缀、pe_lang Cookie、Accept-Language 的顺序选择
+export interface PopupTranslation extends BaseModel {
+  popup_id: string
+  locale: string
+  title: string
+  content: string
+  form_translation: FormTranslation | Record<string, never>
+}
+
+export interface FormTranslation {
+  submit_label?: string
+  next_label?: string
+  back_label?: string
+  captcha_label?: string
+  success_message?: string
+  steps?: Record<string, string> // 步骤ID -> 标题
+  fields?: Record<string, FieldTranslation> // 字段名 -> 字段文字
+}
+
+export interface FieldTranslation {
+  label?: string
+  placeholder?: string
+  message?: string
+  options?: Record<string, string> // 选项值 -> 显示文字
+}
+
+export interface PopupTranslationInput {
+  title?: string
+  content?: string
+  form?: FormTranslation
+}
+
+// 翻译文件，导出给翻译人员填写 translation 后导入
+export interface TranslationBundle {
+  locale: string
+  exported_at: string
+  popups: {
+    popup_id: string
+    source_locale: string
+    source: PopupTranslationInput
+    translation: PopupTranslationInput
+  }[]
+}
+
+export interface TranslationImportResult {
+  locale: string
+  imported: number
+  skipped: number
+}
+
+export interface PopupVariantStats {
+  variant_id: string | null
+  name: string
+  weight: number
+  is_control: boolean
+  is_active: boolean
+  impressions: number
+  clicks: number
+  closes: number
+  submissions: number
+  conversion_rate: number
+  click_through_rate: number
+  dismiss_rate: number
+  lift: number | null
+  z_score: number | null
+  p_value: number | null
+  significant: boolean
 }
 
 export interface FormConfig {
-  fields: FormField[]
-  submit_url: string
+  fields?: FormField[] // 单页表单，与 steps 二选一
+  steps?: FormStep[]
+  show_progress?: boolean
+  submit_label?: string
+  next_label?: string
+  back_label?: string
+  submit_url?: string
   success_message?: string
+  captcha?: 'image' | 'pow' // 验证码类型，不设置时只使用蜜罐、表单令牌和限流
+  captcha_label?: string
+}
+
+export interface FormStep {
+  id: string
+  title?: string
+  fields: FormField[]
 }
 
 export interface FormField {
   name: string
   label: string
-  type: 'text' | 'email' | 'number' | 'select' | 'textarea' | 'checkbox'
+  type: 'text' | 'email' | 'tel' | 'number' | 'select' | 'radio' | 'textarea' | 'checkbox' | 'file'
   required: boolean
   options?: string[]
+  option_labels?: Record<string, string> // 选项值 -> 显示文字
   placeholder?: string
   validation?: FieldValidation
+  show_if?: FieldCondition // 只能引用之前声明的字段
+  accept?: string[] // 文件字段接受的MIME类型，如 image/*、application/pdf
+  max_size?: number // 文件字段的最大字节数
+  sensitive?: boolean // 敏感字段，加密保存，列表中显示脱敏文本，文件字段不支持
+}
+
+export interface FieldCondition {
+  field: string
+  operator: 'eq' | 'neq' | 'in' | 'not_in' | 'not_empty' | 'empty'
+  value?: string
+  values?: string[]
 }
 
 export interface FieldValidation {
@@ -132,9 +351,128 @@ export interface Submission extends BaseModel {
   user_agent?: string
   ip_address?: string
   referrer?: string
+  variant_id?: string | null
+  visitor_id?: string
+  session_id?: string
+  last_step?: string // 最近保存的表单步骤
+  is_partial: boolean // 多步表单尚未提交最后一步
+  completed_at?: string | null
+  status: SubmissionStatus // 线索处理状态
+  tags: string // JSON 数组字符串
+  assignee_id?: string | null
+  processed_at?: string | null
+  masked_fields?: string[] // 显示为脱敏文本的加密字段，有解密权限时可以查看原文
+  anonymized_at?: string | null // 超过保留期限后被匿名化的时间
+  duplicate_count: number // 被去重合并的重复提交次数
+  last_duplicate_at?: string | null
+  deduplicated?: boolean // 创建提交时新数据被更新或合并到该已有记录
+  // 来源归因，创建提交时记录
+  referrer_domain?: string // 会话开始时的外部来源域名，直接访问时为空
+  utm_source?: string
+  utm_medium?: string
+  utm_campaign?: string
+  utm_term?: string
+  utm_content?: string
+  landing_page?: string // 会话落地页路径
+  proxied_path?: string // 提交表单的代理页面路径
+  device_class?: DeviceClass
+}
+
+export type DeviceClass = 'desktop' | 'mobile' | 'tablet' | 'bot'
+
+export type SubmissionStatus = 'new' | 'contacted' | 'qualified' | 'spam'
+
+// 提交的内部备注
+export interface SubmissionNote extends BaseModel {
+  submission_id: string
+  author_id?: string | null
+  author: string
+  body: string
+}
+
+// 批量操作结果
+export interface BatchUpdateResult {
+  requested: number
+  updated: number // 实际发生变化的提交数量
+}
+
+// 后台导出任务，完成后在 expires_at 之前可以下载
+export interface ExportJob extends BaseModel {
+  user_id: string
+  popup_id: string
+  format: 'json' | 'csv' | 'xlsx'
+  columns?: 'schema' | 'union' | ''
+  bom: boolean
+  start_date?: string
+  end_date?: string
+  status: 'pending' | 'running' | 'completed' | 'failed' | 'expired'
+  total_rows: number
+  processed_rows: number
+  file_size: number
+  error?: string
+  started_at?: string | null
+  completed_at?: string | null
+  expires_at?: string | null
+  decrypt: boolean // 导出敏感字段原文
+}
+
+export interface PopupNotification {
+  id?: string
+  popup_id: string
+  mode: 'off' | 'instant' | 'hourly' | 'daily'
+  recipients: string // 收件人数组的JSON字符串
+  subject_template: string
+  body_template: string
+  digest_hour: number
+  mask_sensitive: boolean // 邮件中敏感字段只显示脱敏文本
+  last_digest_at?: string | null
+  mail_enabled: boolean
+  default_subject_template: string
+  default_body_template: string
+}
+
+export type WebhookEvent = 'submission.created' | 'submission.completed' | 'submission.duplicate'
+
+export interface Webhook extends BaseModel {
+  name: string
+  url: string
+  events: string // WebhookEvent 数组的JSON字符串
+  popup_id: string | null
+  proxy_config_id: string | null
+  is_active: boolean
+  mask_sensitive: boolean // 敏感字段只发送脱敏文本，否则发送原文
+  description?: string
+}
+
+// 创建Webhook和轮换密钥时返回签名密钥
+export interface WebhookWithSecret extends Webhook {
+  secret: string
+}
+
+export interface WebhookDelivery extends BaseModel {
+  webhook_id: string
+  event: WebhookEvent | 'ping'
+  payload: string // 请求体的JSON字符串
+  submission_id: string | null
+  status: 'pending' | 'delivered' | 'dead'
+  attempts: number
+  next_attempt_at: string
+  last_error?: string
+  response_status: number
+  delivered_at?: string | null
 }
 
 // 系统监控类型
+export interface AuditLog {
+  id: number
+  action: string
+  resource_type: string
+  resource_id: string
+  actor_id: string | null
+  details: Record<string, any>
+  created_at: string
+}
+
 export interface SystemMetric extends BaseModel {
   metric_name: string
   metric_value: number
@@ -233,4 +571,123 @@ export interface ChartData {
     backgroundColor?: string
     borderColor?: string
   }[]
-}
\ No newline at end of file
+}
+
+// 字段加密的数据密钥
+export interface DataKey extends BaseModel {
+  purpose: 'data' | 'index'
+  master_key_id: string
+  status: 'active' | 'retired'
+  retired_at?: string | null
+  submissions: number // 使用该密钥加密的提交数
+}
+
+export interface EncryptionStatus {
+  enabled: boolean
+  master_key_id?: string
+  encrypt_client_info: boolean
+  decrypt_roles: string[]
+  keys: DataKey[]
+}
+
+export interface RetentionPolicy {
+  days: number // 为0时不清理
+  mode: RetentionMode
+}
+
+export interface RetentionStatus {
+  interval: string
+  submissions: RetentionPolicy
+  proxy_logs: RetentionPolicy
+  system_metrics: RetentionPolicy
+  popups: Array<{
+    popup_id: string
+    title: string
+    retention: PopupRetention
+    effective: RetentionPolicy
+  }>
+  last_run: RetentionRun | null
+}
+
+export interface RetentionRun {
+  started_at: string
+  finished_at: string
+  results: Array<{
+    table: 'submissions' | 'proxy_logs' | 'system_metrics'
+    popup_id?: string
+    mode: RetentionMode
+    cutoff: string
+    rows: number
+  }>
+  error?: string
+}
+
+export interface ErasureResult {
+  submissions: number
+  files: number
+  mails: number // 删除的通知邮件数
+  exports: number // 因包含被删除的提交而作废的导出任务数
+  submission_ids: string[]
+  popup_ids: string[]
+  dry_run: boolean
+}
+
+// 提交来源分析维度
+export type SourceDimension =
+  | 'referrer_domain'
+  | 'utm_source'
+  | 'utm_medium'
+  | 'utm_campaign'
+  | 'utm_term'
+  | 'utm_content'
+  | 'landing_page'
+  | 'proxied_path'
+  | 'device_class'
+
+export type SourceGranularity = 'hour' | 'day' | 'week'
+
+// 来源分析查询参数，维度名作为参数名时表示过滤条件，如 { utm_source: 'google' }
+export type SourceAnalyticsParams = {
+  popup_id?: string
+  dimension?: SourceDimension
+  granularity?: SourceGranularity
+  timezone?: string
+  start_date?: string // RFC3339 时间或 YYYY-MM-DD
+  end_date?: string // 日期包含当天
+  limit?: number
+} & Partial<Record<SourceDimension, string>>
+
+export interface SourceMetrics {
+  submissions: number
+  partial_submissions: number
+  raw_submissions: number
+  duplicate_submissions: number
+  unique_leads: number
+}
+
+export interface SourceBreakdownRow extends SourceMetrics {
+  value: string // 为空表示没有该来源信息，如直接访问
+}
+
+export interface SourceBreakdown {
+  dimension: SourceDimension
+  start_date: string
+  end_date: string
+  rows: SourceBreakdownRow[]
+  total: SourceMetrics
+}
+
+export interface SourceSeriesPoint extends SourceMetrics {
+  bucket: string // 时间段开始的本地时间，如 2026-03-30T00:00
+  value?: string
+}
+
+export interface SourceTimeSeries {
+  dimension?: SourceDimension
+  granularity: SourceGranularity
+  timezone: string
+  start_date: string
+  end_date: string
+  values?: string[]
+  points: SourceSeriesPoint[]
+}